@@ -0,0 +1,146 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+// gonawin-server serves gonawin outside App Engine.
+//
+// It serves the same json API as the App Engine application, with the
+// storage, the task queue, the cache and the mail service replaced by
+// local implementations. It is configured by the "server" section of
+// config.json, read from the current directory:
+//
+//	"server": {
+//	    "address": ":8080",          address to listen on.
+//	    "staticDir": "app",          directory of the web app.
+//	    "storage": "file",           "memory" or "file".
+//	    "storagePath": "gonawin.db", data file of the "file" storage.
+//	    "mailDir": "mails",          directory where emails are written, they are logged when empty.
+//	    "admins": ["google/1234"]    gonawin admins, by user id or by account.
+//	}
+//
+// Admins are given by the id of their user, like "42", or by an account they
+// sign in with, as "provider/externalId", like "google/1234" for the Google
+// account 1234. Emails are not accepted, they are not verified by all providers.
+//
+// Build it with the App Engine SDK and run it from the gonawin directory:
+//
+//	goapp build github.com/taironas/gonawin/cmd/gonawin-server
+//	cd $GOPATH/src/github.com/taironas/gonawin/gonawin && gonawin-server
+//
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/taironas/gonawin/gonawin"
+	"github.com/taironas/gonawin/helpers/mail"
+	"github.com/taironas/gonawin/helpers/memcache"
+	"github.com/taironas/gonawin/helpers/platform"
+	"github.com/taironas/gonawin/helpers/taskqueue"
+	"github.com/taironas/gonawin/repository"
+
+	gwconfig "github.com/taironas/gonawin/config"
+)
+
+// cronJob is a job run periodically, as defined in gonawin/cron.yaml.
+type cronJob struct {
+	path  string
+	every time.Duration
+}
+
+var cronJobs = []cronJob{
+	{"/a/expire/teamrequests", 24 * time.Hour},
+	{"/a/expire/sessions", 24 * time.Hour},
+	{"/a/delete/users", 24 * time.Hour},
+}
+
+func main() {
+	config, err := gwconfig.ReadConfig("")
+	if err != nil {
+		log.Fatalf("gonawin-server: unable to read config file: %v", err)
+	}
+	server := config.Server
+
+	platform.UseStandalone(server.Admins)
+
+	var repo repository.Repository
+	if repo, err = newRepository(server); err != nil {
+		log.Fatalf("gonawin-server: unable to set up storage: %v", err)
+	}
+	repository.Use(repo)
+
+	router := gonawin.Router()
+	memcache.Use(memcache.NewMemory())
+	taskqueue.Use(taskqueue.NewInProcess(router))
+	mail.Use(mail.NewLocalSink(server.MailDir))
+
+	for _, job := range cronJobs {
+		go runCronJob(job)
+	}
+
+	address := server.Address
+	if len(address) == 0 {
+		address = ":8080"
+	}
+	log.Printf("gonawin-server: listening on %s", address)
+	log.Fatal(http.ListenAndServe(address, newServeMux(router, server.StaticDir)))
+}
+
+// newRepository returns the repository selected by the server settings.
+func newRepository(server gwconfig.Server) (repository.Repository, error) {
+	switch server.Storage {
+	case "", "memory":
+		return repository.NewMemory(), nil
+	case "file":
+		path := server.StoragePath
+		if len(path) == 0 {
+			path = "gonawin.db"
+		}
+		return repository.NewFile(path)
+	}
+	return nil, fmt.Errorf("unknown storage %q", server.Storage)
+}
+
+// newServeMux returns the handler of the server: the json API and the web app.
+// Admin handlers are not served, they are only run by the task queue.
+func newServeMux(router http.Handler, staticDir string) *http.ServeMux {
+	if len(staticDir) == 0 {
+		staticDir = "app"
+	}
+	static := http.FileServer(http.Dir(staticDir))
+
+	mux := http.NewServeMux()
+	mux.Handle("/j/", router)
+	mux.Handle("/a/", http.NotFoundHandler())
+	mux.Handle("/app/", http.StripPrefix("/app", static))
+	mux.Handle("/", static)
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "robots.txt")
+	})
+	return mux
+}
+
+// runCronJob adds a task for the job to the task queue periodically.
+func runCronJob(job cronJob) {
+	c := platform.NewContext(nil)
+	for range time.Tick(job.every) {
+		if _, err := taskqueue.Add(c, &taskqueue.Task{Path: job.path, Method: "GET"}, "cron"); err != nil {
+			log.Printf("gonawin-server: unable to add cron task %s: %v", job.path, err)
+		}
+	}
+}
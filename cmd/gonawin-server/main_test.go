@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestCronJobs tests that the server runs all the cron jobs of gonawin/cron.yaml.
+//
+func TestCronJobs(t *testing.T) {
+	f, err := os.Open("../../gonawin/cron.yaml")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	defer f.Close()
+
+	paths := make(map[string]bool)
+	for _, job := range cronJobs {
+		paths[job.path] = true
+	}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "url:") {
+			continue
+		}
+		if path := strings.TrimSpace(strings.TrimPrefix(line, "url:")); !paths[path] {
+			t.Errorf("Error: cron job %s is not run by the server", path)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+}
@@ -11,13 +11,16 @@ import (
 // GwConfig is configuration structure to hold the JSON unmarshalled data.
 //
 type GwConfig struct {
-	APIVersion  string     `json:"apiVersion"`
-	OfflineMode bool       `json:"offlineMode"`
-	OfflineUser User       `json:"offlineUser"`
-	DevUsers    []User     `json:"devUsers"`
-	Twitter     Twitter    `json:"twitter"`
-	Facebook    Facebook   `json:"facebook"`
-	GooglePlus  GooglePlus `json:"googlePlus"`
+	APIVersion    string               `json:"apiVersion"`
+	OfflineMode   bool                 `json:"offlineMode"`
+	OfflineUser   User                 `json:"offlineUser"`
+	DevUsers      []User               `json:"devUsers"`
+	Twitter       Twitter              `json:"twitter"`
+	Facebook      Facebook             `json:"facebook"`
+	GooglePlus    GooglePlus           `json:"googlePlus"`
+	OpenIDConnect []OpenIDConnect      `json:"openIDConnect"`
+	Server        Server               `json:"server"`
+	RateLimits    map[string]RateLimit `json:"rateLimits"` // overrides the default rate limits of route groups.
 }
 
 // User is the user structure used for authentication.
@@ -47,6 +50,36 @@ type GooglePlus struct {
 	ClientId string `json:"clientId"`
 }
 
+// OpenIDConnect holds data needed for authentication with an OpenID Connect provider.
+//
+type OpenIDConnect struct {
+	Name         string   `json:"name"`         // name of the provider in gonawin, like "acme".
+	Title        string   `json:"title"`        // name of the provider shown to the users, like "ACME".
+	Issuer       string   `json:"issuer"`       // issuer URL, its configuration is discovered at /.well-known/openid-configuration.
+	ClientId     string   `json:"clientId"`     // id of gonawin at the provider.
+	ClientSecret string   `json:"clientSecret"` // secret of gonawin at the provider.
+	Scopes       []string `json:"scopes"`       // scopes to request, "openid email profile" by default.
+}
+
+// RateLimit holds the number of requests allowed to a group of routes, like "search" or "invite".
+//
+type RateLimit struct {
+	PerUser int `json:"perUser"` // requests of a user per period, no limit when 0.
+	PerIP   int `json:"perIP"`   // requests of an IP address per period, no limit when 0.
+	Period  int `json:"period"`  // length of the period in seconds.
+}
+
+// Server holds the settings of the standalone server, used when gonawin runs outside App Engine.
+//
+type Server struct {
+	Address     string   `json:"address"`     // address to listen on, ":8080" by default.
+	StaticDir   string   `json:"staticDir"`   // directory of the web app, "app" by default.
+	Storage     string   `json:"storage"`     // "memory" or "file".
+	StoragePath string   `json:"storagePath"` // path of the data file of the "file" storage.
+	MailDir     string   `json:"mailDir"`     // directory where sent emails are written, emails are logged when empty.
+	Admins      []string `json:"admins"`      // gonawin admins, by user id ("42") or by account ("google/1234").
+}
+
 // ReadConfig reads configuration file and return it.
 //
 func ReadConfig(filename string) (*GwConfig, error) {
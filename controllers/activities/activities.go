@@ -19,40 +19,39 @@ package activities
 
 import (
 	"errors"
-	"math"
 	"net/http"
 
-	"appengine"
-
 	"github.com/taironas/gonawin/extract"
 	"github.com/taironas/gonawin/helpers"
+	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/platform"
 	templateshlp "github.com/taironas/gonawin/helpers/templates"
 
 	mdl "github.com/taironas/gonawin/models"
 )
 
 // Index activity handler, use it to get the activities of a user.
-// You can pass a 'count' and a 'page' param to the http.Request to
-// filter the activities that you want. default values are 20 and 1
-// respectively.
+// You can pass a 'count' and a 'cursor' param to the http.Request to
+// filter the activities that you want. By default the 20 most recent
+// activities are returned. The 'Next' cursor of the response gives the
+// following page, it is empty on the last page. Activities of users hiding
+// them from the feeds of non teammates are skipped.
 //
 func Index(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "GET" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
 	desc := "Index activity handler:"
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	extract := extract.NewContext(c, desc, r)
 
 	count := extract.Count()
-	page := extract.Page()
 
-	activities := mdl.FindActivities(c, u, count, page)
-
-	lastPage := math.Ceil(float64(int64(len(activities)) / count))
+	activities, next, err := mdl.FindActivitiesByCursor(c, u, count, extract.Cursor())
+	if err != nil {
+		log.Errorf(c, "%s unable to get activities: %v", desc, err)
+		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeInvalidCursor)}
+	}
+	activities = mdl.FilterHiddenActivities(c, activities, u)
 
-	vm := buildIndexActivitiesViewModel(activities, count, page, int64(lastPage))
+	vm := buildIndexActivitiesViewModel(activities, count, next)
 
 	return templateshlp.RenderJSON(w, c, vm)
 }
@@ -62,28 +61,26 @@ type indexActivitiesViewModel struct {
 	Status  string
 }
 
-func buildIndexActivitiesViewModel(activities []*mdl.Activity, perPage, currentPage, lastPage int64) indexActivitiesViewModel {
+func buildIndexActivitiesViewModel(activities []*mdl.Activity, perPage int64, next string) indexActivitiesViewModel {
 	return indexActivitiesViewModel{
-		Results: buildActivitiesViewModel(activities, perPage, currentPage, lastPage),
+		Results: buildActivitiesViewModel(activities, perPage, next),
 		Status:  "OK",
 	}
 }
 
 type activitiesViewModel struct {
-	Total       int64
-	PerPage     int64
-	CurrentPage int64
-	LastPage    int64
-	Activities  []mdl.ActivityJSON
+	Total      int64
+	PerPage    int64
+	Next       string
+	Activities []mdl.ActivityJSON
 }
 
-func buildActivitiesViewModel(activities []*mdl.Activity, perPage, currentPage, lastPage int64) activitiesViewModel {
+func buildActivitiesViewModel(activities []*mdl.Activity, perPage int64, next string) activitiesViewModel {
 	return activitiesViewModel{
-		Total:       int64(len(activities)),
-		PerPage:     perPage,
-		CurrentPage: currentPage,
-		LastPage:    lastPage,
-		Activities:  buildJSONActivities(activities),
+		Total:      int64(len(activities)),
+		PerPage:    perPage,
+		Next:       next,
+		Activities: buildJSONActivities(activities),
 	}
 }
 
@@ -24,27 +24,30 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"appengine"
-	"appengine/taskqueue"
 
 	"github.com/taironas/gonawin/helpers"
 	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/memcache"
+	"github.com/taironas/gonawin/helpers/platform"
+	"github.com/taironas/gonawin/helpers/taskqueue"
 	templateshlp "github.com/taironas/gonawin/helpers/templates"
 
 	mdl "github.com/taironas/gonawin/models"
 )
 
+// dailyInvitations is the number of invitation emails a user can send in a day.
+const dailyInvitations = 50
+
 // Invite handler, use it to invite users to use gonawin.
 // It expects a list of emails using the url param 'emails'
+// A user cannot send more than dailyInvitations emails a day.
 //
 func Invite(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "POST" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
 	desc := "invite handler:"
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 
 	var emailsList string
 	if emailsList = r.FormValue("emails"); len(emailsList) <= 0 {
@@ -58,6 +61,11 @@ func Invite(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeInviteEmailsInvalid)}
 	}
 
+	if wait, ok := takeInvitations(c, u, len(emails)); !ok {
+		log.Infof(c, "%s user %d reached the daily limit of invitations", desc, u.Id)
+		return &helpers.TooManyRequests{Err: errors.New(helpers.ErrorCodeInviteDailyLimit), RetryAfter: wait}
+	}
+
 	body := buildEmailBody(r)
 
 	// send tasks to send emails
@@ -68,6 +76,28 @@ func Invite(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 	return templateshlp.RenderJSON(w, c, vm)
 }
 
+// takeInvitations counts n invitation emails of the user in the current day.
+// It reports whether the user is still under the daily limit and if not, how long the user must wait for the next day.
+// Emails over the limit are not counted, so the user can still send the ones left.
+func takeInvitations(c appengine.Context, u *mdl.User, n int) (time.Duration, bool) {
+	now := time.Now().UTC()
+	day := now.Truncate(24 * time.Hour)
+	key := fmt.Sprintf("invite:emails:%d:%s", u.Id, day.Format("2006-01-02"))
+
+	count, err := memcache.Increment(c, key, int64(n), 24*time.Hour)
+	if err != nil {
+		log.Errorf(c, "invite handler: unable to count invitations of user %d: %v", u.Id, err)
+		return 0, true
+	}
+	if count <= dailyInvitations {
+		return 0, true
+	}
+	if _, err = memcache.Increment(c, key, -int64(n), 24*time.Hour); err != nil {
+		log.Errorf(c, "invite handler: unable to uncount invitations of user %d: %v", u.Id, err)
+	}
+	return day.Add(24 * time.Hour).Sub(now), false
+}
+
 func processEmails(c appengine.Context, desc string, emails []string, body string, u *mdl.User) error {
 
 	bname := encode(c, desc, u.Name)
@@ -0,0 +1,184 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+// Package reports provides the JSON handlers to report abusive users and teams to the gonawin admins.
+//
+// It provides the following methods
+//
+//	POST	/j/reports/new/			Reports a user or a team.
+//	GET	/j/reports/?state=open		Retrieves the reports, for gonawin admins only.
+//	POST	/j/reports/resolve/[0-9]+/	Resolves the report with the given id, for gonawin admins only.
+//
+package reports
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/taironas/gonawin/extract"
+	"github.com/taironas/gonawin/helpers"
+	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/platform"
+	templateshlp "github.com/taironas/gonawin/helpers/templates"
+
+	mdl "github.com/taironas/gonawin/models"
+)
+
+// ReportData holds the data of a new report.
+//
+type ReportData struct {
+	Kind     string // user or team.
+	TargetId int64  // id of the reported user or team.
+	Reason   string
+}
+
+// ResolutionData holds the note of an admin when resolving a report.
+//
+type ResolutionData struct {
+	Resolution string
+}
+
+// New handler, use it to report an abusive user or team.
+//	POST	/j/reports/new/		Reports a user or a team.
+// The body holds the kind of the reported entity, its id and the reason of the report.
+// Response: JSON formatted report.
+//
+func New(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
+	c := platform.NewContext(r)
+	desc := "New Report Handler:"
+
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Errorf(c, "%s Error when reading request body err: %v", desc, err)
+		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeReportCannotCreate)}
+	}
+
+	var data ReportData
+	if err = json.Unmarshal(body, &data); err != nil {
+		log.Errorf(c, "%s Error when decoding request body err: %v", desc, err)
+		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeReportCannotCreate)}
+	}
+
+	switch data.Kind {
+	case mdl.ReportKindUser:
+		if _, err = mdl.UserByID(c, data.TargetId); err != nil {
+			return &helpers.NotFound{Err: errors.New(helpers.ErrorCodeUserNotFound)}
+		}
+	case mdl.ReportKindTeam:
+		if _, err = mdl.TeamByID(c, data.TargetId); err != nil {
+			return &helpers.NotFound{Err: errors.New(helpers.ErrorCodeTeamNotFound)}
+		}
+	default:
+		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeReportKindNotSupported)}
+	}
+
+	if len(data.Reason) > mdl.ReportReasonMaxLength {
+		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeReportReasonTooLong)}
+	}
+
+	if mdl.WasReportSent(c, u.Id, data.Kind, data.TargetId) {
+		return &helpers.Forbidden{Err: errors.New(helpers.ErrorCodeReportAlreadySent)}
+	}
+
+	var report *mdl.Report
+	if report, err = mdl.CreateReport(c, u.Id, data.Kind, data.TargetId, data.Reason); err != nil {
+		log.Errorf(c, "%s error when trying to create a report: %v", desc, err)
+		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeReportCannotCreate)}
+	}
+
+	vm := buildReportViewModel(report, "Thank you, your report was sent to the gonawin admins.")
+	return templateshlp.RenderJSON(w, c, vm)
+}
+
+// Index handler, use it to get the reports.
+//	GET	/j/reports/?state=open		Retrieves the reports with the given state, open by default.
+// Response: array of JSON formatted reports.
+//
+func Index(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
+	c := platform.NewContext(r)
+
+	state := r.FormValue("state")
+	if len(state) == 0 {
+		state = mdl.ReportOpen
+	}
+
+	reports := mdl.FindReports(c, "State", state)
+
+	fieldsToKeep := []string{"Id", "ReporterId", "Kind", "TargetId", "Reason", "State", "Created", "ResolverId", "Resolution", "Resolved"}
+	reportsJSON := make([]mdl.ReportJSON, len(reports))
+	helpers.TransformFromArrayOfPointers(&reports, &reportsJSON, fieldsToKeep)
+
+	data := struct {
+		Reports []mdl.ReportJSON
+	}{
+		reportsJSON,
+	}
+
+	return templateshlp.RenderJSON(w, c, data)
+}
+
+// Resolve handler, use it to resolve a report.
+//	POST	/j/reports/resolve/[0-9]+/	Resolves the report with the given id.
+// The body can hold a note about the resolution.
+// Response: JSON formatted report.
+//
+func Resolve(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
+	c := platform.NewContext(r)
+	desc := "Resolve Report Handler:"
+	extract := extract.NewContext(c, desc, r)
+
+	var report *mdl.Report
+	var err error
+	if report, err = extract.Report(); err != nil {
+		return err
+	}
+
+	var data ResolutionData
+	defer r.Body.Close()
+	if body, err := ioutil.ReadAll(r.Body); err != nil {
+		log.Errorf(c, "%s Error when reading request body err: %v", desc, err)
+		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeReportCannotResolve)}
+	} else if len(body) > 0 {
+		if err = json.Unmarshal(body, &data); err != nil {
+			log.Errorf(c, "%s Error when decoding request body err: %v", desc, err)
+			return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeReportCannotResolve)}
+		}
+	}
+
+	if err = report.Resolve(c, u.Id, data.Resolution); err != nil {
+		log.Errorf(c, "%s unable to resolve report: %v", desc, err)
+		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeReportCannotResolve)}
+	}
+
+	vm := buildReportViewModel(report, "The report was resolved.")
+	return templateshlp.RenderJSON(w, c, vm)
+}
+
+type reportViewModel struct {
+	MessageInfo string `json:",omitempty"`
+	Report      mdl.ReportJSON
+}
+
+func buildReportViewModel(report *mdl.Report, msg string) reportViewModel {
+	var rJSON mdl.ReportJSON
+	fieldsToKeep := []string{"Id", "Kind", "TargetId", "Reason", "State", "Created", "Resolution", "Resolved"}
+	helpers.InitPointerStructure(report, &rJSON, fieldsToKeep)
+
+	return reportViewModel{msg, rJSON}
+}
@@ -0,0 +1,159 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+// Package search provides the JSON handler to search users, teams and tournaments at once.
+package search
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"appengine"
+
+	"github.com/taironas/gonawin/extract"
+	"github.com/taironas/gonawin/helpers"
+	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/platform"
+	templateshlp "github.com/taironas/gonawin/helpers/templates"
+
+	mdl "github.com/taironas/gonawin/models"
+)
+
+// Search handler returns the users, teams and tournaments matching a query, ranked by relevance.
+// It uses parameter 'q' to make the query and an optional parameter 'kinds',
+// a comma separated list of kinds to search (user, team, tournament), all by default.
+// You can pass a 'count' and a 'page' param to get a page of the results, default values are 20 and 1.
+// Only the entities of the page are loaded.
+//
+//	GET	/j/search/			Search for all entities respecting the query "q"
+//
+func Search(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
+
+	keywords := r.FormValue("q")
+	if len(keywords) == 0 {
+		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
+	}
+
+	c := platform.NewContext(r)
+	desc := "Search Handler:"
+	extract := extract.NewContext(c, desc, r)
+
+	count := extract.Count()
+	page := extract.Page()
+
+	var kinds []string
+	if k := r.FormValue("kinds"); len(k) > 0 {
+		kinds = strings.Split(k, ",")
+		for _, kind := range kinds {
+			if !mdl.IsValidSearchKind(kind) {
+				return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
+			}
+		}
+	}
+
+	results, err := mdl.Search(c, keywords, kinds...)
+	if err != nil {
+		log.Errorf(c, "%s error occurred when searching: %v", desc, err)
+		data := struct {
+			MessageDanger string `json:",omitempty"`
+		}{
+			"Oops! something went wrong, we are unable to perform search query.",
+		}
+		return templateshlp.RenderJSON(w, c, data)
+	}
+
+	vm := buildSearchViewModel(c, mdl.SearchResultsPage(results, count, page), u)
+	vm.Total = int64(len(results))
+	vm.Count = count
+	vm.Page = page
+	if len(vm.Results) == 0 {
+		data := struct {
+			MessageInfo string `json:",omitempty"`
+		}{
+			fmt.Sprintf("Oops! Your search - %s - did not match anything.", keywords),
+		}
+		return templateshlp.RenderJSON(w, c, data)
+	}
+
+	return templateshlp.RenderJSON(w, c, vm)
+}
+
+type searchViewModel struct {
+	Results []searchResultViewModel
+	Total   int64
+	Count   int64
+	Page    int64
+}
+
+type searchResultViewModel struct {
+	Kind     string
+	Id       int64 `json:"Id"`
+	Name     string
+	ImageURL string
+	Score    float64
+}
+
+// buildSearchViewModel loads the entities of the search results by kind and
+// returns them in the order of the results. Results whose entity no longer exists are skipped,
+// as well as the users hidden from the search results of the current user.
+//
+func buildSearchViewModel(c appengine.Context, results []mdl.SearchResult, viewer *mdl.User) searchViewModel {
+
+	ids := make(map[string][]int64)
+	for _, r := range results {
+		ids[r.Kind] = append(ids[r.Kind], r.Id)
+	}
+
+	found := make(map[string]map[int64]searchResultViewModel)
+	for kind := range ids {
+		found[kind] = make(map[int64]searchResultViewModel)
+	}
+
+	if len(ids[mdl.UserSearchKind]) > 0 {
+		users, _ := mdl.UsersByIds(c, ids[mdl.UserSearchKind])
+		for _, u := range users {
+			if u.IsHiddenFromSearch(viewer) {
+				continue
+			}
+			found[mdl.UserSearchKind][u.Id] = searchResultViewModel{Name: u.Username, ImageURL: helpers.UserImageURL(u.Name, u.Id)}
+		}
+	}
+	if len(ids[mdl.TeamSearchKind]) > 0 {
+		teams, _ := mdl.TeamsByIDs(c, ids[mdl.TeamSearchKind])
+		for _, t := range teams {
+			found[mdl.TeamSearchKind][t.Id] = searchResultViewModel{Name: t.Name, ImageURL: helpers.TeamImageURL(t.Name, t.Id)}
+		}
+	}
+	if len(ids[mdl.TournamentSearchKind]) > 0 {
+		tournaments, _ := mdl.TournamentsByIds(c, ids[mdl.TournamentSearchKind])
+		for _, t := range tournaments {
+			found[mdl.TournamentSearchKind][t.Id] = searchResultViewModel{Name: t.Name, ImageURL: helpers.TournamentImageURL(t.Name, t.Id)}
+		}
+	}
+
+	var vm searchViewModel
+	for _, r := range results {
+		if rvm, ok := found[r.Kind][r.Id]; ok {
+			rvm.Kind = r.Kind
+			rvm.Id = r.Id
+			rvm.Score = r.Score
+			vm.Results = append(vm.Results, rvm)
+		}
+	}
+	return vm
+}
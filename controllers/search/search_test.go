@@ -0,0 +1,147 @@
+package search
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/taironas/gonawin/helpers/memcache"
+	"github.com/taironas/gonawin/helpers/platform"
+	mdl "github.com/taironas/gonawin/models"
+	"github.com/taironas/gonawin/repository"
+)
+
+// TestSearchHiddenUsers tests that the users hidden from the search are not returned with the other
+// results, except to themselves and to the gonawin admins.
+//
+func TestSearchHiddenUsers(t *testing.T) {
+	platform.UseStandalone(nil)
+	defer platform.UseStandalone(nil)
+	repository.Use(repository.NewMemory())
+	defer repository.Use(repository.Datastore)
+	memcache.Use(memcache.NewMemory())
+
+	c := repository.NewLocalContext(nil)
+
+	users := make(map[string]*mdl.User)
+	for _, name := range []string{"jon snow", "jon arryn", "sansa stark", "admin"} {
+		u, err := mdl.CreateUser(c, name+"@gonawin.com", name, name, "", name == "admin", "")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		users[name] = u
+	}
+	hidden := users["jon arryn"]
+	hidden.Privacy.HideFromSearch = true
+	if err := hidden.Update(c); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	team, err := mdl.CreateTeam(c, "jon fans", "", users["sansa stark"].Id, false)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	tests := []struct {
+		title  string
+		viewer string
+		want   []searchResultViewModel
+	}{
+		{
+			title:  "hidden users are not found",
+			viewer: "sansa stark",
+			want:   []searchResultViewModel{{Kind: mdl.UserSearchKind, Id: users["jon snow"].Id}, {Kind: mdl.TeamSearchKind, Id: team.Id}},
+		},
+		{
+			title:  "hidden users find themselves",
+			viewer: "jon arryn",
+			want:   []searchResultViewModel{{Kind: mdl.UserSearchKind, Id: users["jon snow"].Id}, {Kind: mdl.UserSearchKind, Id: hidden.Id}, {Kind: mdl.TeamSearchKind, Id: team.Id}},
+		},
+		{
+			title:  "admins find hidden users",
+			viewer: "admin",
+			want:   []searchResultViewModel{{Kind: mdl.UserSearchKind, Id: users["jon snow"].Id}, {Kind: mdl.UserSearchKind, Id: hidden.Id}, {Kind: mdl.TeamSearchKind, Id: team.Id}},
+		},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+
+		r := httptest.NewRequest("GET", "/j/search?q=jon", nil)
+		w := httptest.NewRecorder()
+		if err := Search(w, r, users[test.viewer]); err != nil {
+			t.Fatalf("test %v - Error: %v", i, err)
+		}
+
+		var got searchViewModel
+		if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+			t.Fatalf("test %v - Error: %v", i, err)
+		}
+		found := make(map[string]map[int64]bool)
+		for _, res := range got.Results {
+			if found[res.Kind] == nil {
+				found[res.Kind] = make(map[int64]bool)
+			}
+			found[res.Kind][res.Id] = true
+		}
+		for _, want := range test.want {
+			if !found[want.Kind][want.Id] {
+				t.Errorf("test %v - Error: want %s %d in %+v", i, want.Kind, want.Id, got.Results)
+			}
+		}
+		if len(got.Results) != len(test.want) {
+			t.Errorf("test %v - Error: want %d results, got %+v", i, len(test.want), got.Results)
+		}
+	}
+}
+
+// TestSearchPage tests that a page of the results is returned with the total number of results.
+//
+func TestSearchPage(t *testing.T) {
+	platform.UseStandalone(nil)
+	defer platform.UseStandalone(nil)
+	repository.Use(repository.NewMemory())
+	defer repository.Use(repository.Datastore)
+	memcache.Use(memcache.NewMemory())
+
+	c := repository.NewLocalContext(nil)
+
+	var viewer *mdl.User
+	for _, name := range []string{"jon snow", "jon arryn", "jon connington"} {
+		u, err := mdl.CreateUser(c, name+"@gonawin.com", name, name, "", false, "")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		viewer = u
+	}
+
+	tests := []struct {
+		title string
+		query string
+		want  int
+	}{
+		{title: "first page", query: "q=jon&count=2", want: 2},
+		{title: "last page", query: "q=jon&count=2&page=2", want: 1},
+		{title: "page after the results", query: "q=jon&count=2&page=3", want: 0},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+
+		r := httptest.NewRequest("GET", "/j/search?"+test.query, nil)
+		w := httptest.NewRecorder()
+		if err := Search(w, r, viewer); err != nil {
+			t.Fatalf("test %v - Error: %v", i, err)
+		}
+
+		var got searchViewModel
+		if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+			t.Fatalf("test %v - Error: %v", i, err)
+		}
+		if len(got.Results) != test.want {
+			t.Errorf("test %v - Error: want %d results, got %+v", i, test.want, got.Results)
+		}
+		if test.want > 0 && got.Total != 3 {
+			t.Errorf("test %v - Error: want 3 results in total, got %d", i, got.Total)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package sessions
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"appengine"
+
+	"github.com/taironas/gonawin/extract"
+	"github.com/taironas/gonawin/helpers"
+	authhlp "github.com/taironas/gonawin/helpers/auth"
+	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/platform"
+	templateshlp "github.com/taironas/gonawin/helpers/templates"
+
+	mdl "github.com/taironas/gonawin/models"
+)
+
+// sessionViewModel holds the JSON data of a session.
+type sessionViewModel struct {
+	Id       int64
+	Device   string
+	Created  time.Time
+	LastUsed time.Time
+	Expires  time.Time
+	Current  bool // true for the session of the request.
+}
+
+// Index handler, use it to get the active sessions of the current user.
+//
+//	GET	/j/sessions
+//
+func Index(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
+	c := platform.NewContext(r)
+
+	var currentID int64
+	if current, err := authhlp.CurrentSession(r); err == nil {
+		currentID = current.Id
+	}
+
+	sessions := mdl.UserSessions(c, u.Id)
+	vm := make([]sessionViewModel, len(sessions))
+	for i, s := range sessions {
+		vm[i] = sessionViewModel{s.Id, s.Device, s.Created, s.LastUsed, s.Expires, s.Id == currentID}
+	}
+
+	data := struct {
+		Sessions []sessionViewModel
+	}{
+		vm,
+	}
+
+	return templateshlp.RenderJSON(w, c, data)
+}
+
+// Logout handler, use it to sign out the session of the request.
+//
+//	POST	/j/sessions/logout
+//
+func Logout(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
+	c := platform.NewContext(r)
+	desc := "Session Logout Handler:"
+
+	session, err := authhlp.CurrentSession(r)
+	if err != nil {
+		log.Errorf(c, "%s session of user %d not found: %v", desc, u.Id, err)
+		return &helpers.NotFound{Err: errors.New(helpers.ErrorCodeSessionNotFound)}
+	}
+
+	return destroySession(w, c, desc, u, session)
+}
+
+// LogoutAll handler, use it to sign out all the sessions of the current user.
+//
+//	POST	/j/sessions/logout/all
+//
+func LogoutAll(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
+	c := platform.NewContext(r)
+	desc := "Session Logout All Handler:"
+
+	if err := mdl.DestroyUserSessions(c, u.Id); err != nil {
+		log.Errorf(c, "%s unable to delete sessions of user %d: %v", desc, u.Id, err)
+		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeSessionCannotDelete)}
+	}
+
+	return templateshlp.RenderJSON(w, c, struct{ MessageInfo string }{"All your sessions have been signed out"})
+}
+
+// Destroy handler, use it to sign out one of the sessions of the current user.
+//
+//	POST	/j/sessions/destroy/:sessionId
+//
+func Destroy(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
+	c := platform.NewContext(r)
+	desc := "Session Destroy Handler:"
+	extract := extract.NewContext(c, desc, r)
+
+	session, err := extract.Session(u.Id)
+	if err != nil {
+		return err
+	}
+
+	return destroySession(w, c, desc, u, session)
+}
+
+// destroySession signs out a session of a user.
+func destroySession(w http.ResponseWriter, c appengine.Context, desc string, u *mdl.User, s *mdl.Session) error {
+	if err := s.Destroy(c); err != nil {
+		log.Errorf(c, "%s unable to delete session %d of user %d: %v", desc, s.Id, u.Id, err)
+		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeSessionCannotDelete)}
+	}
+
+	return templateshlp.RenderJSON(w, c, struct{ MessageInfo string }{"The session has been signed out"})
+}
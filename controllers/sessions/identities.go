@@ -0,0 +1,136 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package sessions
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/taironas/gonawin/helpers"
+	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/platform"
+	templateshlp "github.com/taironas/gonawin/helpers/templates"
+
+	mdl "github.com/taironas/gonawin/models"
+)
+
+// identityViewModel holds the JSON data of an identity.
+type identityViewModel struct {
+	Provider string
+	Created  time.Time
+}
+
+// Identities handler, use it to get the accounts the current user can sign in with.
+//
+//	GET	/j/auth/identities
+//
+func Identities(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
+	c := platform.NewContext(r)
+
+	identities := u.Identities(c)
+	ivm := make([]identityViewModel, len(identities))
+	for i, identity := range identities {
+		ivm[i] = identityViewModel{identity.Provider, identity.Created}
+	}
+
+	data := struct {
+		Identities []identityViewModel
+	}{
+		ivm,
+	}
+
+	return templateshlp.RenderJSON(w, c, data)
+}
+
+// Link handler, use it to link an account of another provider to the current user.
+//
+//	POST	/j/auth/identities/link?provider=[google|facebook]&access_token=
+//	POST	/j/auth/identities/link?provider=twitter&oauth_token=&oauth_verifier=
+//	POST	/j/auth/identities/link?provider=:oidcProvider&code=&state=
+//
+func Link(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
+	c := platform.NewContext(r)
+	desc := "Identity Link Handler:"
+
+	provider := r.FormValue("provider")
+	if !mdl.IsValidIdentityProvider(provider) {
+		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeIdentityInvalidProvider)}
+	}
+
+	var accountID string
+	switch provider {
+	case mdl.IdentityTwitter:
+		userInfo, err := twitterUserInfo(c, r, desc)
+		if err != nil {
+			return err
+		}
+		accountID = strconv.FormatInt(userInfo.Id, 10)
+	case mdl.IdentityGoogle, mdl.IdentityFacebook:
+		userInfo, err := verifiedUserInfo(r, provider, r.FormValue("access_token"))
+		if err != nil {
+			log.Errorf(c, "%s access token of %s account is not valid: %v", desc, provider, err)
+			return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeSessionsAccessTokenNotValid)}
+		}
+		accountID = userInfo.Id
+	default:
+		p, err := openIDConnectProvider(c, r, desc)
+		if err != nil {
+			return err
+		}
+		claims, err := openIDConnectClaims(c, w, r, p, desc)
+		if err != nil {
+			return err
+		}
+		accountID = claims.Subject
+	}
+
+	if err := u.LinkIdentity(c, provider, accountID); err == mdl.ErrIdentityLinked {
+		return &helpers.Forbidden{Err: errors.New(helpers.ErrorCodeIdentityLinked)}
+	} else if err == mdl.ErrIdentityProviderLinked {
+		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeIdentityProviderLinked)}
+	} else if err != nil {
+		log.Errorf(c, "%s unable to link %s account of user %d: %v", desc, provider, u.Id, err)
+		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeIdentityCannotLink)}
+	}
+
+	return templateshlp.RenderJSON(w, c, struct{ MessageInfo string }{"Your " + provider + " account has been linked"})
+}
+
+// Unlink handler, use it to unlink the account of a provider from the current user.
+//
+//	POST	/j/auth/identities/unlink?provider=
+//
+func Unlink(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
+	c := platform.NewContext(r)
+	desc := "Identity Unlink Handler:"
+
+	provider := r.FormValue("provider")
+	if !mdl.IsValidIdentityProvider(provider) {
+		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeIdentityInvalidProvider)}
+	}
+
+	if err := u.UnlinkIdentity(c, provider); err == mdl.ErrLastIdentity {
+		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeIdentityLastCannotUnlink)}
+	} else if err != nil {
+		log.Errorf(c, "%s unable to unlink %s account of user %d: %v", desc, provider, u.Id, err)
+		return &helpers.NotFound{Err: errors.New(helpers.ErrorCodeIdentityNotFound)}
+	}
+
+	return templateshlp.RenderJSON(w, c, struct{ MessageInfo string }{"Your " + provider + " account has been unlinked"})
+}
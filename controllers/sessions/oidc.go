@@ -0,0 +1,259 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package sessions
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	golog "log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"appengine"
+
+	"github.com/taironas/route"
+
+	"github.com/taironas/gonawin/helpers"
+	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/memcache"
+	"github.com/taironas/gonawin/helpers/oidc"
+	"github.com/taironas/gonawin/helpers/platform"
+	templateshlp "github.com/taironas/gonawin/helpers/templates"
+
+	mdl "github.com/taironas/gonawin/models"
+)
+
+const (
+	// oidcStateLifetime is the time a user has to sign in at an OpenID Connect provider.
+	oidcStateLifetime = 10 * time.Minute
+	// oidcStateCookie is the cookie binding the state of an authorization request to the browser which sent it.
+	oidcStateCookie = "gw-oidc-state"
+	// oidcCookiePath is the path of the handlers the state cookie is sent to, signing in or linking an account.
+	oidcCookiePath = "/j/auth/"
+)
+
+var (
+	oidcMu        sync.Mutex
+	oidcProviders = make(map[string]*oidc.Provider) // discovered OpenID Connect providers by name.
+)
+
+// oidcState holds the data of an authorization request sent to an OpenID Connect provider.
+type oidcState struct {
+	Provider string
+	Nonce    string
+}
+
+// registerOpenIDConnectProviders lets users sign in with the OpenID Connect providers of the config.
+func registerOpenIDConnectProviders() {
+	for _, p := range config.OpenIDConnect {
+		if err := mdl.RegisterIdentityProvider(p.Name); err != nil {
+			golog.Printf("Error: unable to register OpenID Connect provider; %v", err)
+		}
+	}
+}
+
+// openIDConnectProvider returns the OpenID Connect provider of the request.
+// The configuration of a provider is discovered the first time it is used.
+func openIDConnectProvider(c appengine.Context, r *http.Request, desc string) (*oidc.Provider, error) {
+	name, err := route.Context.Get(r, "provider")
+	if err != nil {
+		name = r.FormValue("provider")
+	}
+
+	oidcMu.Lock()
+	defer oidcMu.Unlock()
+
+	if p, ok := oidcProviders[name]; ok {
+		return p, nil
+	}
+	for _, cfg := range config.OpenIDConnect {
+		if cfg.Name != name {
+			continue
+		}
+		p, err := oidc.Discover(platform.Client(c), cfg)
+		if err != nil {
+			log.Errorf(c, "%s unable to discover OpenID Connect provider %s: %v", desc, name, err)
+			return nil, &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeSessionsCannotGetLoginURL)}
+		}
+		oidcProviders[name] = p
+		return p, nil
+	}
+	log.Errorf(c, "%s OpenID Connect provider %s is not configured", desc, name)
+	return nil, &helpers.NotFound{Err: errors.New(helpers.ErrorCodeSessionsProviderNotFound)}
+}
+
+// baseURL returns the scheme and host of the request. The scheme is https when the request
+// was received over TLS or forwarded from TLS by a proxy.
+func baseURL(r *http.Request) string {
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		return "https://" + r.Host
+	}
+	return "http://" + r.Host
+}
+
+// openIDConnectRedirectURL returns the URL the provider redirects users to once they signed in.
+func openIDConnectRedirectURL(r *http.Request, p *oidc.Provider) string {
+	return baseURL(r) + "/j/auth/oidc/" + p.Name + "/callback"
+}
+
+// openIDConnectClaims completes the authorization of the request and returns the verified claims of the user.
+// The state of the request can be used only once, by the browser which started the authorization.
+func openIDConnectClaims(c appengine.Context, w http.ResponseWriter, r *http.Request, p *oidc.Provider, desc string) (*oidc.Claims, error) {
+	key := "oidc:state:" + r.FormValue("state")
+
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(r.FormValue("state"))) != 1 {
+		log.Errorf(c, "%s state of %s authorization was not started by this browser: %v", desc, p.Name, err)
+		return nil, &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeSessionsStateNotValid)}
+	}
+	setOpenIDConnectStateCookie(w, r, "", -1)
+
+	var state oidcState
+	if err = memcache.GetValue(c, key, &state); err != nil || state.Provider != p.Name {
+		log.Errorf(c, "%s state of %s authorization is not valid: %v", desc, p.Name, err)
+		return nil, &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeSessionsStateNotValid)}
+	}
+	if err = memcache.Delete(c, key); err != nil {
+		log.Errorf(c, "%s Error when trying to delete memcached state: %v", desc, err)
+	}
+
+	idToken, err := p.Exchange(platform.Client(c), r.FormValue("code"), openIDConnectRedirectURL(r, p))
+	if err != nil {
+		log.Errorf(c, "%s cannot exchange %s code: %v", desc, p.Name, err)
+		return nil, &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeSessionsAccessTokenNotValid)}
+	}
+
+	claims, err := p.Verify(platform.Client(c), idToken, state.Nonce)
+	if err != nil {
+		log.Errorf(c, "%s %s ID token is not valid: %v", desc, p.Name, err)
+		return nil, &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeSessionsIDTokenNotValid)}
+	}
+	return claims, nil
+}
+
+// newOpenIDConnectState stores the state of a new authorization request and returns its key.
+func newOpenIDConnectState(c appengine.Context, p *oidc.Provider) (string, oidcState, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", oidcState{}, err
+	}
+	key := hex.EncodeToString(b[:16])
+	state := oidcState{Provider: p.Name, Nonce: hex.EncodeToString(b[16:])}
+
+	if err := memcache.SetValue(c, "oidc:state:"+key, state, oidcStateLifetime); err != nil {
+		return "", oidcState{}, err
+	}
+	return key, state, nil
+}
+
+// setOpenIDConnectStateCookie sets the key of the state of an authorization request in the browser,
+// or removes it when maxAge is negative. The cookie is only read by the server so it is HttpOnly.
+func setOpenIDConnectStateCookie(w http.ResponseWriter, r *http.Request, key string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    key,
+		Path:     oidcCookiePath,
+		MaxAge:   maxAge,
+		Secure:   r.TLS != nil,
+		HttpOnly: true,
+	})
+}
+
+// OpenIDConnectAuth handler, use it to get the URL where users sign in with an OpenID Connect provider.
+//
+//	GET	/j/auth/oidc/:provider
+//
+func OpenIDConnectAuth(w http.ResponseWriter, r *http.Request) error {
+	c := platform.NewContext(r)
+	desc := "OpenID Connect Auth handler:"
+
+	p, err := openIDConnectProvider(c, r, desc)
+	if err != nil {
+		return err
+	}
+
+	key, state, err := newOpenIDConnectState(c, p)
+	if err != nil {
+		log.Errorf(c, "%s unable to store state of %s authorization: %v", desc, p.Name, err)
+		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeSessionsCannotGetLoginURL)}
+	}
+	setOpenIDConnectStateCookie(w, r, key, int(oidcStateLifetime/time.Second))
+
+	loginData := struct {
+		URL string `json:"Url"`
+	}{
+		p.AuthCodeURL(openIDConnectRedirectURL(r, p), key, state.Nonce),
+	}
+
+	return templateshlp.RenderJSON(w, c, loginData)
+}
+
+// OpenIDConnectCallback handler, use it to make a callback for OpenID Connect authentication.
+//
+//	GET	/j/auth/oidc/:provider/callback
+//
+func OpenIDConnectCallback(w http.ResponseWriter, r *http.Request) error {
+	provider, _ := route.Context.Get(r, "provider")
+
+	v := url.Values{}
+	v.Set("provider", provider)
+	v.Set("code", r.FormValue("code"))
+	v.Set("state", r.FormValue("state"))
+	http.Redirect(w, r, baseURL(r)+"/#/auth/oidc/callback?"+v.Encode(), http.StatusFound)
+	return nil
+}
+
+// OpenIDConnectUser handler, use it to get the user signed in with an OpenID Connect provider.
+//
+//	GET	/j/auth/oidc/:provider/user?code=&state=
+//
+func OpenIDConnectUser(w http.ResponseWriter, r *http.Request) error {
+	c := platform.NewContext(r)
+	desc := "OpenID Connect User handler:"
+
+	p, err := openIDConnectProvider(c, r, desc)
+	if err != nil {
+		return err
+	}
+
+	claims, err := openIDConnectClaims(c, w, r, p, desc)
+	if err != nil {
+		return err
+	}
+
+	username := claims.PreferredUsername
+	if len(username) == 0 {
+		username = claims.Name
+	}
+
+	var user *mdl.User
+	if user, err = mdl.SigninUserWithIdentity(c, p.Name, claims.Subject, claims.Email, claims.EmailVerified, username, claims.Name); err != nil {
+		log.Errorf(c, "%s Unable to signin %s user %s. %v", desc, p.Name, claims.Subject, err)
+		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeSessionsUnableToSignin)}
+	}
+
+	userData, err := newSigninData(c, r, user)
+	if err != nil {
+		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeSessionsUnableToSignin)}
+	}
+
+	return templateshlp.RenderJSON(w, c, userData)
+}
@@ -0,0 +1,130 @@
+package sessions
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/taironas/route"
+
+	"github.com/taironas/gonawin/helpers"
+	"github.com/taironas/gonawin/helpers/memcache"
+	"github.com/taironas/gonawin/helpers/oidc"
+	"github.com/taironas/gonawin/helpers/platform"
+	"github.com/taironas/gonawin/repository"
+)
+
+// TestOpenIDConnectState tests that the state of an OpenID Connect authorization is only accepted
+// from the browser which started it.
+//
+func TestOpenIDConnectState(t *testing.T) {
+	platform.UseStandalone(nil)
+	defer platform.UseStandalone(nil)
+	repository.Use(repository.NewMemory())
+	defer repository.Use(repository.Datastore)
+	memcache.Use(memcache.NewMemory())
+
+	// the token endpoint is not set so that a valid state fails at the code exchange.
+	oidcMu.Lock()
+	oidcProviders["acme"] = &oidc.Provider{Name: "acme", AuthorizationEndpoint: "https://acme.com/auth"}
+	oidcMu.Unlock()
+	defer func() {
+		oidcMu.Lock()
+		delete(oidcProviders, "acme")
+		oidcMu.Unlock()
+	}()
+
+	var err error
+	router := new(route.Router)
+	router.HandleFunc("/j/auth/oidc/:provider", func(w http.ResponseWriter, r *http.Request) {
+		err = OpenIDConnectAuth(w, r)
+	})
+	router.HandleFunc("/j/auth/oidc/:provider/user", func(w http.ResponseWriter, r *http.Request) {
+		err = OpenIDConnectUser(w, r)
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/j/auth/oidc/acme", nil))
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	var login struct{ Url string }
+	if err := json.NewDecoder(w.Body).Decode(&login); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	u, err := url.Parse(login.Url)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	state := u.Query().Get("state")
+
+	var cookie *http.Cookie
+	for _, ck := range w.Result().Cookies() {
+		if ck.Name == oidcStateCookie {
+			cookie = ck
+		}
+	}
+	if cookie == nil || cookie.Value != state || !cookie.HttpOnly || cookie.MaxAge <= 0 {
+		t.Fatalf("Error: want a short-lived HttpOnly cookie with the state %s, got %+v", state, cookie)
+	}
+
+	tests := []struct {
+		title  string
+		cookie string
+		err    string
+	}{
+		{title: "state without cookie", cookie: "", err: helpers.ErrorCodeSessionsStateNotValid},
+		{title: "state of another browser", cookie: "another", err: helpers.ErrorCodeSessionsStateNotValid},
+		{title: "state of the browser", cookie: state, err: helpers.ErrorCodeSessionsAccessTokenNotValid},
+		{title: "state used twice", cookie: state, err: helpers.ErrorCodeSessionsStateNotValid},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+		r := httptest.NewRequest("GET", "/j/auth/oidc/acme/user?code=1234&state="+state, nil)
+		if len(test.cookie) > 0 {
+			r.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: test.cookie})
+		}
+		router.ServeHTTP(httptest.NewRecorder(), r)
+		if _, ok := err.(*helpers.BadRequest); !ok || err.Error() != test.err {
+			t.Errorf("test %v - Error: want bad request %q, got %v", i, test.err, err)
+		}
+	}
+}
+
+// TestOpenIDConnectCallback tests that users are redirected to the web app with the scheme of the request.
+//
+func TestOpenIDConnectCallback(t *testing.T) {
+	tests := []struct {
+		title     string
+		tls       bool
+		forwarded string
+		want      string
+	}{
+		{title: "http request", want: "http://gonawin.com/#/auth/oidc/callback?"},
+		{title: "https request", tls: true, want: "https://gonawin.com/#/auth/oidc/callback?"},
+		{title: "https request forwarded by a proxy", forwarded: "https", want: "https://gonawin.com/#/auth/oidc/callback?"},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+		r := httptest.NewRequest("GET", "http://gonawin.com/j/auth/oidc/acme/callback?code=1234&state=5678", nil)
+		if test.tls {
+			r.TLS = &tls.ConnectionState{}
+		}
+		if len(test.forwarded) > 0 {
+			r.Header.Set("X-Forwarded-Proto", test.forwarded)
+		}
+		w := httptest.NewRecorder()
+		if err := OpenIDConnectCallback(w, r); err != nil {
+			t.Fatalf("test %v - Error: %v", i, err)
+		}
+		if got := w.Header().Get("Location"); !strings.HasPrefix(got, test.want) {
+			t.Errorf("test %v - Error: want redirect to %s, got %s", i, test.want, got)
+		}
+	}
+}
@@ -19,14 +19,14 @@ package sessions
 
 import (
 	"errors"
+	"fmt"
 	golog "log"
 	"net/http"
 	"net/url"
+	"strconv"
+	"time"
 
 	"appengine"
-	"appengine/datastore"
-	"appengine/urlfetch"
-	"appengine/user"
 
 	oauth "github.com/garyburd/go-oauth/oauth"
 
@@ -34,10 +34,12 @@ import (
 	authhlp "github.com/taironas/gonawin/helpers/auth"
 	"github.com/taironas/gonawin/helpers/log"
 	"github.com/taironas/gonawin/helpers/memcache"
+	"github.com/taironas/gonawin/helpers/platform"
 	templateshlp "github.com/taironas/gonawin/helpers/templates"
 
 	gwconfig "github.com/taironas/gonawin/config"
 	mdl "github.com/taironas/gonawin/models"
+	"github.com/taironas/gonawin/repository"
 )
 
 var (
@@ -53,6 +55,7 @@ func init() {
 	var err error
 	if config, err = gwconfig.ReadConfig(""); err != nil {
 		golog.Printf("Error: unable to read config file; %v", err)
+		config = &gwconfig.GwConfig{}
 	}
 	// Set up a configuration for twitter.
 	twitterConfig = oauth.Client{
@@ -62,61 +65,89 @@ func init() {
 		TokenRequestURI:               "https://api.twitter.com/oauth/access_token",
 	}
 	twitterCallbackURL = "/j/auth/twitter/callback"
-	googleVerifyTokenURL = "https://www.google.com/accounts/AuthSubTokenInfo?bearer_token"
-	facebookVerifyTokenURL = "https://graph.facebook.com/me?access_token"
+	googleVerifyTokenURL = "https://www.googleapis.com/oauth2/v1/tokeninfo?access_token"
+	facebookVerifyTokenURL = "https://graph.facebook.com/me?fields=id,name,email&access_token"
+
+	registerOpenIDConnectProviders()
 }
 
 // Authenticate handler, use it to authenticate a user.
 // It returns the JSON data of the requested user.
+// The account and its email are given by the provider of the access token, the 'name' parameter
+// is only used when the provider does not return one.
 func Authenticate(w http.ResponseWriter, r *http.Request) error {
-	if r.Method != "GET" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
-
-	userInfo := authhlp.UserInfo{Id: r.FormValue("id"), Email: r.FormValue("email"), Name: r.FormValue("name")}
-
-	var verifyURL string
-	if r.FormValue("provider") == "google" {
-		verifyURL = googleVerifyTokenURL
-	} else if r.FormValue("provider") == "facebook" {
-		verifyURL = facebookVerifyTokenURL
-	}
+	c := platform.NewContext(r)
 
-	if !authhlp.CheckUserValidity(r, verifyURL, r.FormValue("access_token")) {
+	provider := r.FormValue("provider")
+	id := r.FormValue("id")
+	userInfo, err := verifiedUserInfo(r, provider, r.FormValue("access_token"))
+	if err != nil || (len(id) > 0 && id != userInfo.Id) {
+		log.Errorf(c, "Authenticate: access token of %s account %s is not valid: %v", provider, id, err)
 		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeSessionsAccessTokenNotValid)}
 	}
+	if len(userInfo.Name) == 0 {
+		userInfo.Name = r.FormValue("name")
+	}
 
 	var user *mdl.User
-	var err error
-	if user, err = mdl.SigninUser(c, "Email", userInfo.Email, userInfo.Name, userInfo.Name); err != nil {
+	if user, err = mdl.SigninUserWithIdentity(c, provider, userInfo.Id, userInfo.Email, userInfo.EmailVerified, userInfo.Name, userInfo.Name); err != nil {
 		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeSessionsUnableToSignin)}
 	}
 
-	imageURL := helpers.UserImageURL(user.Username, user.Id)
-
-	userData := struct {
-		User     *mdl.User
-		ImageURL string
-	}{
-		user,
-		imageURL,
+	userData, err := newSigninData(c, r, user)
+	if err != nil {
+		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeSessionsUnableToSignin)}
 	}
 
 	return templateshlp.RenderJSON(w, c, userData)
 }
 
-// TwitterAuth handler, use it to authenticate via twitter.
-func TwitterAuth(w http.ResponseWriter, r *http.Request) error {
-	if r.Method != "GET" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
+// verifiedUserInfo returns the info of the Google or Facebook account of an access token, as
+// given by the provider.
+func verifiedUserInfo(r *http.Request, provider, accessToken string) (*authhlp.UserInfo, error) {
+	switch provider {
+	case mdl.IdentityGoogle:
+		return authhlp.FetchUserInfo(r, googleVerifyTokenURL, accessToken)
+	case mdl.IdentityFacebook:
+		return authhlp.FetchUserInfo(r, facebookVerifyTokenURL, accessToken)
 	}
+	return nil, fmt.Errorf("unknown provider %q", provider)
+}
+
+// signinData holds the JSON data of a signed in user.
+type signinData struct {
+	User             *mdl.User
+	ImageURL         string
+	TeamsCount       int
+	TournamentsCount int
+	Token            string    // token of the session, to send in the Authorization header of the requests.
+	Expires          time.Time // expiry of the session, extended while the session is used.
+}
 
-	c := appengine.NewContext(r)
+// newSigninData opens a session for the device of the request and returns the data of the signed in user.
+func newSigninData(c appengine.Context, r *http.Request, user *mdl.User) (*signinData, error) {
+	session, token, err := mdl.CreateSession(c, user.Id, r.Header.Get("User-Agent"))
+	if err != nil {
+		log.Errorf(c, "Signin: unable to create session for user %d: %v", user.Id, err)
+		return nil, err
+	}
+
+	return &signinData{
+		user,
+		helpers.UserImageURL(user.Username, user.Id),
+		len(user.TeamIDs(c)),
+		len(user.TournamentIDs(c)),
+		token,
+		session.Expires,
+	}, nil
+}
+
+// TwitterAuth handler, use it to authenticate via twitter.
+func TwitterAuth(w http.ResponseWriter, r *http.Request) error {
+	c := platform.NewContext(r)
 	desc := "Twitter Auth handler:"
 
-	credentials, err := twitterConfig.RequestTemporaryCredentials(urlfetch.Client(c), "http://"+r.Host+twitterCallbackURL, nil)
+	credentials, err := twitterConfig.RequestTemporaryCredentials(platform.Client(c), "http://"+r.Host+twitterCallbackURL, nil)
 	if err != nil {
 		c.Errorf("JsonTwitterAuth, error = %v", err)
 		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeSessionsCannotGetTempCredentials)}
@@ -124,14 +155,14 @@ func TwitterAuth(w http.ResponseWriter, r *http.Request) error {
 
 	if err = memcache.Set(c, "secret", credentials.Secret); err != nil {
 		// store secret in datastore
-		secretId, _, err := datastore.AllocateIDs(c, "Secret", nil, 1)
+		secretId, _, err := repository.AllocateIDs(c, "Secret", 1)
 		if err != nil {
 			log.Errorf(c, "%s Cannot allocate Id for secret. %v", desc, err)
 		}
 
-		key := datastore.NewKey(c, "Secret", "", secretId, nil)
+		key := repository.NewKey("Secret", "", secretId)
 
-		_, err = datastore.Put(c, key, credentials.Secret)
+		_, err = repository.Put(c, key, credentials.Secret)
 		if err != nil {
 			log.Errorf(c, "%s Cannot put secret in Datastore. %v", desc, err)
 			return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeSessionsCannotSetSecretValue)}
@@ -150,25 +181,36 @@ func TwitterAuth(w http.ResponseWriter, r *http.Request) error {
 
 // TwitterAuthCallback handler, use it to make a callback for Twitter Authentication.
 func TwitterAuthCallback(w http.ResponseWriter, r *http.Request) error {
-	if r.Method != "GET" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
 	http.Redirect(w, r, "http://"+r.Host+"/#/auth/twitter/callback?oauth_token="+r.FormValue("oauth_token")+"&oauth_verifier="+r.FormValue("oauth_verifier"), http.StatusFound)
 	return nil
 }
 
 // TwitterUser handler, use it to get the Twitter user data.
 func TwitterUser(w http.ResponseWriter, r *http.Request) error {
-	if r.Method != "GET" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Twitter User handler:"
 
+	userInfo, err := twitterUserInfo(c, r, desc)
+	if err != nil {
+		return err
+	}
+
 	var user *mdl.User
+	if user, err = mdl.SigninUserWithIdentity(c, mdl.IdentityTwitter, strconv.FormatInt(userInfo.Id, 10), "", false, userInfo.ScreenName, userInfo.Name); err != nil {
+		log.Errorf(c, "%s Unable to signin user %s. %v", desc, userInfo.Name, err)
+		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeSessionsUnableToSignin)}
+	}
 
+	userData, err := newSigninData(c, r, user)
+	if err != nil {
+		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeSessionsUnableToSignin)}
+	}
+
+	return templateshlp.RenderJSON(w, c, userData)
+}
+
+// twitterUserInfo completes the authorization of the Twitter account of the request and returns its user info.
+func twitterUserInfo(c appengine.Context, r *http.Request, desc string) (*authhlp.TwitterUserInfo, error) {
 	// get the request token
 	requestToken := r.FormValue("oauth_token")
 
@@ -180,17 +222,17 @@ func TwitterUser(w http.ResponseWriter, r *http.Request) error {
 	} else {
 		log.Errorf(c, "%s cannot get secret value from memcache: %v", desc, err)
 		// try to get secret from datastore
-		q := datastore.NewQuery("Secret")
+		q := repository.NewQuery("Secret")
 		var secrets []string
 		if keys, err := q.GetAll(c, &secrets); err == nil && len(secrets) > 0 {
 			// delete secret from datastore
-			if err = datastore.Delete(c, keys[0]); err != nil {
+			if err = repository.Delete(c, keys[0]); err != nil {
 				log.Errorf(c, "%s Error when trying to delete 'secret' key in Datastore: %v", desc, err)
 			}
 
 		} else if err != nil || len(secrets) == 0 {
 			log.Errorf(c, "%s cannot get secret value from Datastore: %v", desc, err)
-			return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeSessionsCannotGetSecretValue)}
+			return nil, &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeSessionsCannotGetSecretValue)}
 		}
 	}
 
@@ -198,58 +240,39 @@ func TwitterUser(w http.ResponseWriter, r *http.Request) error {
 		log.Errorf(c, "%s Error when trying to delete memcached 'secret' key: %v", desc, err)
 	}
 
-	token, values, err := twitterConfig.RequestToken(urlfetch.Client(c), &cred, r.FormValue("oauth_verifier"))
+	token, values, err := twitterConfig.RequestToken(platform.Client(c), &cred, r.FormValue("oauth_verifier"))
 	if err != nil {
 		log.Errorf(c, "%s Error when trying to delete memcached 'secret' key: %v", desc, err)
-		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeSessionsCannotGetRequestToken)}
+		return nil, &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeSessionsCannotGetRequestToken)}
 	}
 
 	// get user info
 	urlValues := url.Values{}
 	urlValues.Set("user_id", values.Get("user_id"))
-	resp, err := twitterConfig.Get(urlfetch.Client(c), token, "https://api.twitter.com/1.1/users/show.json", urlValues)
+	resp, err := twitterConfig.Get(platform.Client(c), token, "https://api.twitter.com/1.1/users/show.json", urlValues)
 	if err != nil {
 		log.Errorf(c, "%s Cannot get user info from twitter. %v", desc, err)
-		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeSessionsCannotGetUserInfo)}
+		return nil, &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeSessionsCannotGetUserInfo)}
 	}
 
 	userInfo, err := authhlp.FetchTwitterUserInfo(resp)
 	if err != nil {
 		log.Errorf(c, "%s Cannot get user info by fetching twitter response. %v", desc, err)
-		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeSessionsCannotGetUserInfo)}
-	}
-
-	if user, err = mdl.SigninUser(c, "Username", "", userInfo.ScreenName, userInfo.Name); err != nil {
-		log.Errorf(c, "%s Unable to signin user %s. %v", desc, userInfo.Name, err)
-		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeSessionsUnableToSignin)}
+		return nil, &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeSessionsCannotGetUserInfo)}
 	}
 
-	imageURL := helpers.UserImageURL(user.Username, user.Id)
-
-	userData := struct {
-		User     *mdl.User
-		ImageURL string
-	}{
-		user,
-		imageURL,
-	}
-
-	return templateshlp.RenderJSON(w, c, userData)
+	return userInfo, nil
 }
 
 // GoogleAccountsLoginURL handler, use it to get Google accounts login URL.
 //
 func GoogleAccountsLoginURL(w http.ResponseWriter, r *http.Request) error {
-	if r.Method != "GET" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Google Accounts Login URL Handler:"
 
 	var url string
 	var err error
-	url, err = user.LoginURL(c, "/j/auth/google/callback/")
+	url, err = platform.LoginURL(c, "/j/auth/google/callback/")
 	if err != nil {
 		log.Errorf(c, "%s error when getting Google accounts login URL", desc)
 		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeSessionsCannotGetGoogleLoginURL)}
@@ -266,14 +289,10 @@ func GoogleAccountsLoginURL(w http.ResponseWriter, r *http.Request) error {
 
 // GoogleAuthCallback handler, use it to make a callback for Google Authentication.
 func GoogleAuthCallback(w http.ResponseWriter, r *http.Request) error {
-	if r.Method != "GET" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Google Accounts Auth Callback Handler:"
 
-	u := user.Current(c)
+	u := platform.CurrentUser(c)
 	if u == nil {
 		log.Errorf(c, "%s user cannot be nil", desc)
 		return &helpers.InternalServerError{Err: errors.New("user cannot be nil")}
@@ -285,14 +304,10 @@ func GoogleAuthCallback(w http.ResponseWriter, r *http.Request) error {
 
 // GoogleUser handler, use it to get Google accounts user.
 func GoogleUser(w http.ResponseWriter, r *http.Request) error {
-	if r.Method != "GET" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Google Accounts User Handler:"
 
-	u := user.Current(c)
+	u := platform.CurrentUser(c)
 	if u == nil {
 		log.Errorf(c, "%s user cannot be nil", desc)
 		return &helpers.InternalServerError{Err: errors.New("user cannot be nil")}
@@ -307,18 +322,13 @@ func GoogleUser(w http.ResponseWriter, r *http.Request) error {
 
 	var user *mdl.User
 	var err error
-	if user, err = mdl.SigninUser(c, "Email", userInfo.Email, userInfo.Name, userInfo.Name); err != nil {
+	if user, err = mdl.SigninUserWithIdentity(c, mdl.IdentityGoogle, userInfo.Id, userInfo.Email, userInfo.EmailVerified, userInfo.Name, userInfo.Name); err != nil {
 		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeSessionsUnableToSignin)}
 	}
 
-	imageURL := helpers.UserImageURL(user.Username, user.Id)
-
-	userData := struct {
-		User     *mdl.User
-		ImageURL string
-	}{
-		user,
-		imageURL,
+	userData, err := newSigninData(c, r, user)
+	if err != nil {
+		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeSessionsUnableToSignin)}
 	}
 
 	return templateshlp.RenderJSON(w, c, userData)
@@ -326,14 +336,10 @@ func GoogleUser(w http.ResponseWriter, r *http.Request) error {
 
 // GoogleDeleteCookie handler, use it to delete cookie created by Google account.
 func GoogleDeleteCookie(w http.ResponseWriter, r *http.Request) error {
-	if r.Method != "GET" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 
 	cookieName := "ACSID"
-	if appengine.IsDevAppServer() {
+	if platform.IsDevAppServer() {
 		cookieName = "dev_appserver_login"
 	}
 	cookie := http.Cookie{Name: cookieName, Path: "/", MaxAge: -1}
@@ -342,19 +348,43 @@ func GoogleDeleteCookie(w http.ResponseWriter, r *http.Request) error {
 	return templateshlp.RenderJSON(w, c, "Google user has been logged out")
 }
 
-// AuthServiceIds handler, use it to get the identifiers of Gonawin
+// AuthServiceIds handler, use it to get the identifiers of Gonawin at the providers users can sign in with.
+// Providers lists all the configured providers, with the title of the OpenID Connect providers.
 func AuthServiceIds(w http.ResponseWriter, r *http.Request) error {
-	if r.Method != "GET" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
+	c := platform.NewContext(r)
+
+	type provider struct {
+		Name          string
+		Title         string
+		OpenIDConnect bool
+	}
+
+	var providers []provider
+	if len(config.GooglePlus.ClientId) > 0 {
+		providers = append(providers, provider{mdl.IdentityGoogle, "Google", false})
+	}
+	if len(config.Facebook.AppId) > 0 {
+		providers = append(providers, provider{mdl.IdentityFacebook, "Facebook", false})
+	}
+	if len(config.Twitter.Token) > 0 {
+		providers = append(providers, provider{mdl.IdentityTwitter, "Twitter", false})
+	}
+	for _, p := range config.OpenIDConnect {
+		title := p.Title
+		if len(title) == 0 {
+			title = p.Name
+		}
+		providers = append(providers, provider{p.Name, title, true})
 	}
-	c := appengine.NewContext(r)
 
 	data := struct {
-		GooglePlusClientId string `json:"GooglePlusClientId"`
-		FacebookAppId      string `json:"FacebookAppId"`
+		GooglePlusClientId string     `json:"GooglePlusClientId"`
+		FacebookAppId      string     `json:"FacebookAppId"`
+		Providers          []provider `json:"Providers"`
 	}{
 		config.GooglePlus.ClientId,
 		config.Facebook.AppId,
+		providers,
 	}
 	return templateshlp.RenderJSON(w, c, data)
 }
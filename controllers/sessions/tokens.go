@@ -0,0 +1,138 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package sessions
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/taironas/gonawin/extract"
+	"github.com/taironas/gonawin/helpers"
+	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/platform"
+	templateshlp "github.com/taironas/gonawin/helpers/templates"
+
+	mdl "github.com/taironas/gonawin/models"
+)
+
+// accessTokenViewModel holds the JSON data of a personal access token.
+type accessTokenViewModel struct {
+	Id       int64
+	Name     string
+	Scopes   []string
+	Created  time.Time
+	LastUsed time.Time
+}
+
+func buildAccessTokenViewModel(t *mdl.AccessToken) accessTokenViewModel {
+	return accessTokenViewModel{t.Id, t.Name, t.Scopes, t.Created, t.LastUsed}
+}
+
+// Tokens handler, use it to get the personal access tokens of the current user.
+//
+//	GET	/j/tokens
+//
+func Tokens(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
+	c := platform.NewContext(r)
+
+	tokens := mdl.UserAccessTokens(c, u.Id)
+	vm := make([]accessTokenViewModel, len(tokens))
+	for i, t := range tokens {
+		vm[i] = buildAccessTokenViewModel(t)
+	}
+
+	data := struct {
+		Tokens []accessTokenViewModel
+		Scopes []string
+	}{
+		vm,
+		mdl.AccessTokenScopes,
+	}
+
+	return templateshlp.RenderJSON(w, c, data)
+}
+
+// NewToken handler, use it to create a personal access token for a bot or a script.
+// It expects the name of the token and its scopes, separated by commas, using the url params 'name' and 'scopes'.
+// The token is only returned by this handler, it is not stored.
+//
+//	POST	/j/tokens/new?name=&scopes=
+//
+func NewToken(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
+	c := platform.NewContext(r)
+	desc := "New Access Token Handler:"
+
+	name := r.FormValue("name")
+	if len(strings.TrimSpace(name)) == 0 {
+		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNameCannotBeEmpty)}
+	}
+
+	var scopes []string
+	for _, s := range strings.Split(r.FormValue("scopes"), ",") {
+		if s = strings.TrimSpace(s); len(s) > 0 {
+			scopes = append(scopes, s)
+		}
+	}
+
+	t, token, err := mdl.CreateAccessToken(c, u.Id, name, scopes)
+	switch err {
+	case nil:
+	case mdl.ErrAccessTokenScope:
+		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeAccessTokenScopesNotValid)}
+	case mdl.ErrAccessTokenLimit:
+		return &helpers.Forbidden{Err: errors.New(helpers.ErrorCodeAccessTokenLimit)}
+	default:
+		log.Errorf(c, "%s unable to create access token of user %d: %v", desc, u.Id, err)
+		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeAccessTokenCannotCreate)}
+	}
+
+	data := struct {
+		Token       accessTokenViewModel
+		Secret      string // the token, to be sent in the Authorization header.
+		MessageInfo string `json:",omitempty"`
+	}{
+		buildAccessTokenViewModel(t),
+		token,
+		"Copy your access token now, you will not be able to see it again",
+	}
+
+	return templateshlp.RenderJSON(w, c, data)
+}
+
+// DestroyToken handler, use it to revoke one of the personal access tokens of the current user.
+//
+//	POST	/j/tokens/destroy/:tokenId
+//
+func DestroyToken(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
+	c := platform.NewContext(r)
+	desc := "Destroy Access Token Handler:"
+	extract := extract.NewContext(c, desc, r)
+
+	t, err := extract.AccessToken(u.Id)
+	if err != nil {
+		return err
+	}
+
+	if err = t.Destroy(c); err != nil {
+		log.Errorf(c, "%s unable to delete access token %d of user %d: %v", desc, t.Id, u.Id, err)
+		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeAccessTokenCannotDelete)}
+	}
+
+	return templateshlp.RenderJSON(w, c, struct{ MessageInfo string }{"The access token has been revoked"})
+}
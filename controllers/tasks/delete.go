@@ -17,38 +17,107 @@
 package tasks
 
 import (
-	"encoding/json"
 	"errors"
 	"net/http"
+	"net/url"
+	"strconv"
 
 	"appengine"
 
 	"github.com/taironas/gonawin/helpers"
 	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/platform"
+	"github.com/taironas/gonawin/helpers/taskqueue"
 	mdl "github.com/taironas/gonawin/models"
 )
 
-// DeleteUserPredicts task handler, use it to delete the predictions of a given user.
-//
-func DeleteUserPredicts(w http.ResponseWriter, r *http.Request) error {
-
-	c := appengine.NewContext(r)
-	desc := "Task queue - DeleteUserPredicts Handler:"
+// userDeletionBatchSize is the number of entities deleted by a task.
+const userDeletionBatchSize = 100
 
-	if r.Method != "POST" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
+// DeleteUsers task handler, use it to delete all the data of the users who deleted their account.
+// Deletions are run by batches and can be resumed where they stopped.
+//
+//	GET	/a/delete/users/		Dispatches a task resuming each running deletion, or restarting the deletion of the given 'userId'.
+//	POST	/a/delete/users/		Deletes a batch of the data of the given 'userId', then dispatches the next batch.
+//
+func DeleteUsers(w http.ResponseWriter, r *http.Request) error {
 
-	predictIdsBlob := []byte(r.FormValue("predict_ids"))
+	c := platform.NewContext(r)
+	desc := "Task queue - DeleteUsers Handler:"
 
-	var predictIds []int64
-	if err := json.Unmarshal(predictIdsBlob, &predictIds); err != nil {
-		log.Errorf(c, "%s unable to extract predictIds from data, %v", desc, err)
+	var userID int64
+	if strID := r.FormValue("userId"); len(strID) > 0 {
+		var err error
+		if userID, err = strconv.ParseInt(strID, 0, 64); err != nil {
+			log.Errorf(c, "%s error when extracting user id: %v", desc, err)
+			return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeUserNotFound)}
+		}
 	}
 
-	if err := mdl.DestroyPredicts(c, predictIds); err != nil {
-		log.Errorf(c, "%s predicts have not been deleted. %v", desc, err)
+	switch r.Method {
+	case "GET":
+		var deletions []*mdl.UserDeletion
+		if userID != 0 {
+			// only the users who deleted their account can be deleted again.
+			if _, err := mdl.UserDeletionByUserID(c, userID); err != nil {
+				log.Errorf(c, "%s deletion of user %d not found: %v", desc, userID, err)
+				return &helpers.NotFound{Err: errors.New(helpers.ErrorCodeUserDeletionNotFound)}
+			}
+			d, err := mdl.RestartUserDeletion(c, userID)
+			if err != nil {
+				log.Errorf(c, "%s unable to restart deletion of user %d: %v", desc, userID, err)
+				return err
+			}
+			deletions = append(deletions, d)
+		} else {
+			var err error
+			if deletions, err = mdl.UserDeletions(c); err != nil {
+				log.Errorf(c, "%s unable to get user deletions: %v", desc, err)
+				return err
+			}
+		}
+		for _, d := range deletions {
+			if d.IsCompleted() {
+				continue
+			}
+			if err := addUserDeletionTask(c, d.UserId); err != nil {
+				log.Errorf(c, "%s unable to add task to taskqueue for user %d: %v", desc, d.UserId, err)
+				return err
+			}
+			log.Infof(c, "%s add task to taskqueue successfully for user %d", desc, d.UserId)
+		}
+		return nil
+	case "POST":
+		if userID == 0 {
+			return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
+		}
+		d, err := mdl.UserDeletionByUserID(c, userID)
+		if err != nil {
+			log.Errorf(c, "%s deletion of user %d not found: %v", desc, userID, err)
+			return &helpers.NotFound{Err: errors.New(helpers.ErrorCodeUserDeletionNotFound)}
+		}
+		if err = d.Run(c, userDeletionBatchSize); err != nil {
+			log.Errorf(c, "%s unable to delete data of user %d: %v", desc, userID, err)
+			return err
+		}
+		if d.IsCompleted() {
+			log.Infof(c, "%s deletion of user %d %s", desc, userID, d.State())
+			return nil
+		}
+		if err = addUserDeletionTask(c, userID); err != nil {
+			log.Errorf(c, "%s unable to add task to taskqueue for next batch of user %d: %v", desc, userID, err)
+			return err
+		}
+		return nil
 	}
+	return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
+}
 
-	return nil
+// addUserDeletionTask adds a task deleting the next batch of the data of a user.
+func addUserDeletionTask(c appengine.Context, userID int64) error {
+	task := taskqueue.NewPOSTTask("/a/delete/users/", url.Values{
+		"userId": []string{strconv.FormatInt(userID, 10)},
+	})
+	_, err := taskqueue.Add(c, task, "")
+	return err
 }
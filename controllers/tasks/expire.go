@@ -0,0 +1,93 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package tasks
+
+import (
+	"net/http"
+	"net/url"
+
+	"appengine"
+
+	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/platform"
+	"github.com/taironas/gonawin/helpers/taskqueue"
+	mdl "github.com/taironas/gonawin/models"
+)
+
+// teamRequestsBatchSize is the number of expired team requests deleted by a task.
+const teamRequestsBatchSize = 100
+
+// ExpireTeamRequests cron handler, use it to delete the team requests that expired.
+// The requests are deleted by batches.
+//
+//	GET	/a/expire/teamrequests/		Deletes the first batch of expired team requests, then dispatches the next batch.
+//	POST	/a/expire/teamrequests/		Deletes a batch of expired team requests from 'cursor', then dispatches the next batch.
+//
+func ExpireTeamRequests(w http.ResponseWriter, r *http.Request) error {
+
+	c := platform.NewContext(r)
+	desc := "Cron - ExpireTeamRequests Handler:"
+
+	expired, next, err := mdl.ExpiredTeamRequestsByCursor(c, teamRequestsBatchSize, r.FormValue("cursor"))
+	if err != nil {
+		log.Errorf(c, "%s unable to get expired team requests: %v", desc, err)
+		return err
+	}
+	log.Infof(c, "%s %d team requests expired", desc, len(expired))
+
+	for _, tr := range expired {
+		if err := tr.Destroy(c); err != nil {
+			log.Errorf(c, "%s team request %d has not been deleted. %v", desc, tr.Id, err)
+		}
+	}
+
+	if len(next) == 0 {
+		return nil
+	}
+	if err = addExpireTeamRequestsTask(c, next); err != nil {
+		log.Errorf(c, "%s unable to add task to taskqueue for next team requests: %v", desc, err)
+		return err
+	}
+	return nil
+}
+
+// addExpireTeamRequestsTask adds a task deleting the expired team requests from a cursor.
+func addExpireTeamRequestsTask(c appengine.Context, cursor string) error {
+	task := taskqueue.NewPOSTTask("/a/expire/teamrequests/", url.Values{
+		"cursor": []string{cursor},
+	})
+	_, err := taskqueue.Add(c, task, "")
+	return err
+}
+
+// ExpireSessions cron handler, use it to delete the sessions that expired.
+//
+//	GET	/a/expire/sessions/
+//
+func ExpireSessions(w http.ResponseWriter, r *http.Request) error {
+
+	c := platform.NewContext(r)
+	desc := "Cron - ExpireSessions Handler:"
+
+	n, err := mdl.DestroyExpiredSessions(c)
+	if err != nil {
+		log.Errorf(c, "%s expired sessions have not been deleted. %v", desc, err)
+	}
+	log.Infof(c, "%s %d sessions expired", desc, n)
+
+	return nil
+}
@@ -22,25 +22,22 @@ import (
 	"net/http"
 
 	"appengine"
-	"appengine/datastore"
-	"appengine/mail"
 
 	"github.com/taironas/gonawin/helpers"
 	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/mail"
+	"github.com/taironas/gonawin/helpers/platform"
+	"github.com/taironas/gonawin/repository"
 )
 
 // Invite task handler, use it to send an invitation via email.
 //
 func Invite(w http.ResponseWriter, r *http.Request) error {
 
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Task queue - Invite Handler:"
 
-	if r.Method != "POST" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	err := datastore.RunInTransaction(c, func(c appengine.Context) error {
+	err := repository.RunInTransaction(c, func(c appengine.Context) error {
 
 		msg := buildMessage(c, desc, r)
 
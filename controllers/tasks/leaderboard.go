@@ -0,0 +1,94 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package tasks
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/taironas/gonawin/helpers"
+	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/platform"
+	"github.com/taironas/gonawin/helpers/taskqueue"
+	mdl "github.com/taironas/gonawin/models"
+	"github.com/taironas/gonawin/repository"
+)
+
+// RebuildLeaderboards handler, use it to rebuild the leaderboards of tournaments from the score entities.
+//
+//	GET	/a/rebuild/leaderboards/		Dispatches a task rebuilding the leaderboards of each tournament, or of the given 'tournamentId'.
+//	POST	/a/rebuild/leaderboards/		Rebuilds the leaderboards of the given 'tournamentId'.
+//
+func RebuildLeaderboards(w http.ResponseWriter, r *http.Request) error {
+
+	c := platform.NewContext(r)
+	desc := "Task queue - RebuildLeaderboards Handler:"
+
+	var ids []int64
+	if strID := r.FormValue("tournamentId"); len(strID) > 0 {
+		id, err := strconv.ParseInt(strID, 0, 64)
+		if err != nil {
+			log.Errorf(c, "%s error when extracting permalink id: %v", desc, err)
+			return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeTournamentNotFound)}
+		}
+		ids = []int64{id}
+	}
+
+	switch r.Method {
+	case "GET":
+		if len(ids) == 0 {
+			keys, err := repository.NewQuery("Tournament").KeysOnly().GetAll(c, nil)
+			if err != nil {
+				log.Errorf(c, "%s unable to get tournaments: %v", desc, err)
+				return err
+			}
+			for _, k := range keys {
+				ids = append(ids, k.IntID())
+			}
+		}
+		for _, id := range ids {
+			task := taskqueue.NewPOSTTask("/a/rebuild/leaderboards/", url.Values{
+				"tournamentId": []string{strconv.FormatInt(id, 10)},
+			})
+			if _, err := taskqueue.Add(c, task, ""); err != nil {
+				log.Errorf(c, "%s unable to add task to taskqueue for tournament %d: %v", desc, id, err)
+				return err
+			}
+			log.Infof(c, "%s add task to taskqueue successfully for tournament %d", desc, id)
+		}
+		return nil
+	case "POST":
+		if len(ids) != 1 {
+			return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
+		}
+		t, err := mdl.TournamentByID(c, ids[0])
+		if err != nil {
+			log.Errorf(c, "%s tournament not found: %v", desc, err)
+			return &helpers.NotFound{Err: errors.New(helpers.ErrorCodeTournamentNotFound)}
+		}
+		n, err := mdl.RebuildLeaderboards(c, t)
+		if err != nil {
+			log.Errorf(c, "%s unable to rebuild leaderboards of tournament %d: %v", desc, t.Id, err)
+			return err
+		}
+		log.Infof(c, "%s leaderboards of tournament %d rebuilt with %d users", desc, t.Id, n)
+		return nil
+	}
+	return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
+}
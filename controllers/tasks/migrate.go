@@ -0,0 +1,102 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package tasks
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"appengine"
+
+	"github.com/taironas/gonawin/helpers"
+	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/platform"
+	"github.com/taironas/gonawin/helpers/taskqueue"
+	mdl "github.com/taironas/gonawin/models"
+)
+
+// migrationBatchSize is the number of entities migrated by a task.
+const migrationBatchSize = 100
+
+// MigrateRelations handler, use it to move the legacy lists of ids of the user, team and
+// tournament entities to relation entities.
+// The application keeps working during the migration, as the models migrate the entities
+// they access.
+//
+//	GET	/a/migrate/relations/		Dispatches a task migrating the entities of each kind, or of the given 'kind'.
+//	POST	/a/migrate/relations/		Migrates a batch of entities of the given 'kind' from 'cursor', then dispatches the next batch.
+//
+func MigrateRelations(w http.ResponseWriter, r *http.Request) error {
+
+	c := platform.NewContext(r)
+	desc := "Task queue - MigrateRelations Handler:"
+
+	kinds := mdl.RelationsMigrationKinds
+	if kind := r.FormValue("kind"); len(kind) > 0 {
+		valid := false
+		for _, k := range kinds {
+			valid = valid || k == kind
+		}
+		if !valid {
+			return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
+		}
+		kinds = []string{kind}
+	}
+
+	switch r.Method {
+	case "GET":
+		for _, kind := range kinds {
+			if err := addMigrationTask(c, kind, ""); err != nil {
+				log.Errorf(c, "%s unable to add task to taskqueue for kind %s: %v", desc, kind, err)
+				return err
+			}
+			log.Infof(c, "%s add task to taskqueue successfully for kind %s", desc, kind)
+		}
+		return nil
+	case "POST":
+		if len(kinds) != 1 {
+			return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
+		}
+		n, next, err := mdl.MigrateRelations(c, kinds[0], migrationBatchSize, r.FormValue("cursor"))
+		if err != nil {
+			log.Errorf(c, "%s unable to migrate %s entities: %v", desc, kinds[0], err)
+			return err
+		}
+		log.Infof(c, "%s %d %s entities migrated", desc, n, kinds[0])
+		if len(next) == 0 {
+			log.Infof(c, "%s migration of %s entities done", desc, kinds[0])
+			return nil
+		}
+		if err = addMigrationTask(c, kinds[0], next); err != nil {
+			log.Errorf(c, "%s unable to add task to taskqueue for next %s entities: %v", desc, kinds[0], err)
+			return err
+		}
+		return nil
+	}
+	return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
+}
+
+// addMigrationTask adds a task migrating the entities of a kind from a cursor.
+func addMigrationTask(c appengine.Context, kind, cursor string) error {
+	task := taskqueue.NewPOSTTask("/a/migrate/relations/", url.Values{
+		"kind":   []string{kind},
+		"cursor": []string{cursor},
+	})
+	_, err := taskqueue.Add(c, task, "")
+	return err
+}
@@ -0,0 +1,53 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package tasks
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/taironas/gonawin/helpers"
+	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/platform"
+	mdl "github.com/taironas/gonawin/models"
+)
+
+// ResolvePrices task handler, use it to resolve the winners of the prices of the teams of a tournament that is over.
+//
+//	POST	/a/resolve/prices/	Resolves the prices of the given 'tournamentId'.
+//
+func ResolvePrices(w http.ResponseWriter, r *http.Request) error {
+
+	c := platform.NewContext(r)
+	desc := "Task queue - ResolvePrices Handler:"
+
+	tournamentID, err := strconv.ParseInt(r.FormValue("tournamentId"), 0, 64)
+	if err != nil {
+		log.Errorf(c, "%s error when extracting tournament id: %v", desc, err)
+		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeTournamentNotFound)}
+	}
+
+	t, err := mdl.TournamentByID(c, tournamentID)
+	if err != nil {
+		log.Errorf(c, "%s tournament %d not found: %v", desc, tournamentID, err)
+		return &helpers.NotFound{Err: errors.New(helpers.ErrorCodeTournamentNotFound)}
+	}
+
+	t.ResolvePrices(c)
+	return nil
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package tasks
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"appengine"
+
+	"github.com/taironas/gonawin/helpers"
+	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/platform"
+	"github.com/taironas/gonawin/helpers/taskqueue"
+	mdl "github.com/taironas/gonawin/models"
+)
+
+// rebuildBatchSize is the number of entities indexed by a task.
+const rebuildBatchSize = 500
+
+// RebuildSearchIndexes handler, use it to rebuild the inverted indexes of the search engine from the entities.
+//
+//	GET	/a/rebuild/searchindexes/		Dispatches a task rebuilding the index of each kind, or of the given 'kind'.
+//	POST	/a/rebuild/searchindexes/		Rebuilds the index of the given 'kind' from a batch of entities starting at 'cursor', then dispatches the next batch.
+//
+func RebuildSearchIndexes(w http.ResponseWriter, r *http.Request) error {
+
+	c := platform.NewContext(r)
+	desc := "Task queue - RebuildSearchIndexes Handler:"
+
+	kinds := mdl.SearchKinds()
+	if kind := r.FormValue("kind"); len(kind) > 0 {
+		if !mdl.IsValidSearchKind(kind) {
+			return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
+		}
+		kinds = []string{kind}
+	}
+
+	switch r.Method {
+	case "GET":
+		for _, kind := range kinds {
+			if err := addRebuildTask(c, kind, ""); err != nil {
+				log.Errorf(c, "%s unable to add task to taskqueue for kind %s: %v", desc, kind, err)
+				return err
+			}
+			log.Infof(c, "%s add task to taskqueue successfully for kind %s", desc, kind)
+		}
+		return nil
+	case "POST":
+		if len(kinds) != 1 {
+			return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
+		}
+		n, next, err := mdl.RebuildInvertedIndexByCursor(c, kinds[0], rebuildBatchSize, r.FormValue("cursor"))
+		if err != nil {
+			log.Errorf(c, "%s unable to rebuild %s index: %v", desc, kinds[0], err)
+			return err
+		}
+		log.Infof(c, "%s %d %s entities indexed", desc, n, kinds[0])
+		if len(next) == 0 {
+			log.Infof(c, "%s %s index rebuilt", desc, kinds[0])
+			return nil
+		}
+		if err = addRebuildTask(c, kinds[0], next); err != nil {
+			log.Errorf(c, "%s unable to add task to taskqueue for next %s entities: %v", desc, kinds[0], err)
+			return err
+		}
+		return nil
+	}
+	return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
+}
+
+// addRebuildTask adds a task rebuilding the index of a kind from a cursor.
+func addRebuildTask(c appengine.Context, kind, cursor string) error {
+	task := taskqueue.NewPOSTTask("/a/rebuild/searchindexes/", url.Values{
+		"kind":   []string{kind},
+		"cursor": []string{cursor},
+	})
+	_, err := taskqueue.Add(c, task, "")
+	return err
+}
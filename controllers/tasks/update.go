@@ -23,33 +23,28 @@ import (
 	"net/http"
 	"net/url"
 
-	"appengine"
-	"appengine/datastore"
-	"appengine/taskqueue"
-
 	"github.com/taironas/gonawin/helpers"
 	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/platform"
+	"github.com/taironas/gonawin/helpers/taskqueue"
 
 	mdl "github.com/taironas/gonawin/models"
+	"github.com/taironas/gonawin/repository"
 )
 
 // UpdateScores updates the scores of all users in tournaments.
 // it does this by dispatching different tasks.
 //
-//	GET	/a/update/scores/	update
+//	POST	/a/update/scores/	update
 //
 // The response is ...
 func UpdateScores(w http.ResponseWriter, r *http.Request /*, u *mdl.User*/) error {
 
-	if r.Method != "POST" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Task queue - Update Scores Handler:"
 
 	// we are unable to run this task in a single transaction using:
-	// err := datastore.RunInTransaction(c, func(c appengine.Context) error
+	// err := repository.RunInTransaction(c, func(c appengine.Context) error
 	// the error below was rised from that:
 	// ERROR: pw:  Predict.ByIds, error occurred during ByIds call: API error 1 (datastore_v3: BAD_REQUEST):
 	// operating on too many entity groups in a single transaction.
@@ -201,6 +196,15 @@ func UpdateScores(w http.ResponseWriter, r *http.Request /*, u *mdl.User*/) erro
 	}
 	log.Infof(c, "%s add task to taskqueue successfully", desc)
 	log.Infof(c, "%s task queue for publishing user score activities: <--", desc)
+
+	// the tournament is over, the prices are resolved after the scores are added.
+	if t.IsLastMatch(c, &m) {
+		if err = t.AddResolvePricesTask(c); err != nil {
+			log.Errorf(c, "%s unable to add task to taskqueue.", desc)
+			return err
+		}
+		log.Infof(c, "%s add task to resolve the prices successfully", desc)
+	}
 	log.Infof(c, "%s task done!", desc)
 	return nil
 }
@@ -208,11 +212,7 @@ func UpdateScores(w http.ResponseWriter, r *http.Request /*, u *mdl.User*/) erro
 // UpdateUsersScores handler, use it to update users scores.
 func UpdateUsersScores(w http.ResponseWriter, r *http.Request) error {
 
-	if r.Method != "POST" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Task queue - Update Users Scores Handler:"
 
 	log.Infof(c, "%s processing...", desc)
@@ -258,14 +258,9 @@ func UpdateUsersScores(w http.ResponseWriter, r *http.Request) error {
 
 // CreateScoreEntities handler, use it to create the score entities.
 func CreateScoreEntities(w http.ResponseWriter, r *http.Request) error {
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Task queue - Create score entities Handler:"
 
-	if r.Method != "POST" {
-		log.Infof(c, "%s something went wrong...", desc)
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
 	log.Infof(c, "%s processing...", desc)
 	log.Infof(c, "%s preparing data", desc)
 
@@ -291,7 +286,7 @@ func CreateScoreEntities(w http.ResponseWriter, r *http.Request) error {
 
 	var users []*mdl.User
 	var scores []*mdl.Score
-	var keyScores []*datastore.Key
+	var keyScores []*repository.Key
 
 	var err2 error
 	log.Infof(c, "%s create score entities as it does not exist", desc)
@@ -325,13 +320,9 @@ func CreateScoreEntities(w http.ResponseWriter, r *http.Request) error {
 
 // AddScoreToScoreEntities handler, use it to add a score to score model.
 func AddScoreToScoreEntities(w http.ResponseWriter, r *http.Request) error {
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Task queue - Add score to score entity Handler:"
 
-	if r.Method != "POST" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
 	log.Infof(c, "%s processing...", desc)
 	log.Infof(c, "%s reading data...", desc)
 
@@ -389,6 +380,12 @@ func AddScoreToScoreEntities(w http.ResponseWriter, r *http.Request) error {
 		log.Errorf(c, "%s cannot add scores to score entities. %v", desc, err)
 		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeInternal)}
 	}
+
+	log.Infof(c, "%s update leaderboards", desc)
+	if err := mdl.UpdateLeaderboards(c, &t, users, tournamentScores); err != nil {
+		log.Errorf(c, "%s cannot update leaderboards. %v", desc, err)
+		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeInternal)}
+	}
 	log.Infof(c, "%s task done!", desc)
 	return nil
 }
@@ -397,11 +394,7 @@ func AddScoreToScoreEntities(w http.ResponseWriter, r *http.Request) error {
 //
 func PublishUsersScoreActivities(w http.ResponseWriter, r *http.Request) error {
 
-	if r.Method != "POST" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Task queue - Publish Users Score Activities Handler:"
 
 	log.Infof(c, "%s processing...", desc)
@@ -17,13 +17,12 @@
 package teams
 
 import (
-	"errors"
 	"net/http"
 
 	"appengine"
 
 	"github.com/taironas/gonawin/extract"
-	"github.com/taironas/gonawin/helpers"
+	"github.com/taironas/gonawin/helpers/platform"
 	templateshlp "github.com/taironas/gonawin/helpers/templates"
 
 	mdl "github.com/taironas/gonawin/models"
@@ -37,11 +36,7 @@ import (
 //
 func Accuracies(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 
-	if r.Method != "GET" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	extract := extract.NewContext(c, "Team Accuracies Handler:", r)
 
 	var t *mdl.Team
@@ -71,11 +66,7 @@ func buildTeamAccuraciesViewModel(c appengine.Context, t *mdl.Team) teamAccuraci
 // The response is an array of accurracies for the specified team team group by tournament with all it's progressions.
 //
 func AccuracyByTournament(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "GET" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Team Accuracies by tournament Handler:"
 	extract := extract.NewContext(c, desc, r)
 
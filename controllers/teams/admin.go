@@ -21,11 +21,10 @@ import (
 	"fmt"
 	"net/http"
 
-	"appengine"
-
 	"github.com/taironas/gonawin/extract"
 	"github.com/taironas/gonawin/helpers"
 	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/platform"
 	templateshlp "github.com/taironas/gonawin/helpers/templates"
 
 	mdl "github.com/taironas/gonawin/models"
@@ -33,14 +32,10 @@ import (
 
 // AddAdmin handler, use it to add an admin to a team.
 //
-//	GET	/j/teams/:teamId/admin/add/:userId
+//	POST	/j/teams/:teamId/admin/add/:userId
 //
 func AddAdmin(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "POST" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Team add admin Handler:"
 	extract := extract.NewContext(c, desc, r)
 
@@ -57,6 +52,11 @@ func AddAdmin(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeInternal)}
 	}
 
+	if !team.CanSetRole(c, u.Id, newAdmin.Id, mdl.TeamRoleAdmin) {
+		log.Errorf(c, "%s user is not allowed to add admins", desc)
+		return &helpers.Forbidden{Err: errors.New(helpers.ErrorCodeTeamRoleForbiden)}
+	}
+
 	if err = team.AddAdmin(c, newAdmin.Id); err != nil {
 		log.Errorf(c, "%s error on AddAdmin to team: %v", desc, err)
 		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeInternal)}
@@ -84,14 +84,10 @@ func buildTeamAddAdminViewModel(team *mdl.Team, newAdmin *mdl.User) teamAddAdmin
 // RemoveAdmin handler, use it to remove an admin from a team.
 //
 // Use this handler to remove a user as admin of the current team.
-//	GET	/j/teams/:teamId/admin/remove/:userId
+//	POST	/j/teams/:teamId/admin/remove/:userId
 //
 func RemoveAdmin(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "POST" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Team remove admin Handler:"
 	extract := extract.NewContext(c, desc, r)
 
@@ -108,6 +104,11 @@ func RemoveAdmin(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 		return &helpers.InternalServerError{Err: err}
 	}
 
+	if !team.CanSetRole(c, u.Id, oldAdmin.Id, mdl.TeamRoleMember) {
+		log.Errorf(c, "%s user is not allowed to remove admins", desc)
+		return &helpers.Forbidden{Err: errors.New(helpers.ErrorCodeTeamRoleForbiden)}
+	}
+
 	if err = team.RemoveAdmin(c, oldAdmin.Id); err != nil {
 		log.Errorf(c, "%s error on RemoveAdmin to team: %v.", desc, err)
 		return &helpers.InternalServerError{Err: err}
@@ -132,3 +133,143 @@ func buildTeamRemoveAdminViewModel(team *mdl.Team, oldAdmin *mdl.User) teamRemov
 	return teamRemoveAdminViewModel{msg, t}
 
 }
+
+// SetRole handler, use it to give a role to a member of a team.
+//
+//	POST	/j/teams/:teamId/roles/set/:userId/:role
+//
+// A user can only give roles below his own role, the owner role is given by a transfer of ownership.
+//
+func SetRole(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
+	c := platform.NewContext(r)
+	desc := "Team set role Handler:"
+	extract := extract.NewContext(c, desc, r)
+
+	var team *mdl.Team
+	var err error
+	if team, err = extract.Team(); err != nil {
+		return err
+	}
+
+	var member *mdl.User
+	if member, err = extract.User(); err != nil {
+		return err
+	}
+
+	var role string
+	if role, err = extract.TeamRole(); err != nil {
+		return err
+	}
+
+	if !team.CanSetRole(c, u.Id, member.Id, role) {
+		log.Errorf(c, "%s user %d is not allowed to give role %s to user %d", desc, u.Id, role, member.Id)
+		return &helpers.Forbidden{Err: errors.New(helpers.ErrorCodeTeamRoleForbiden)}
+	}
+
+	if err = team.SetRole(c, member.Id, role); err != nil {
+		log.Errorf(c, "%s error on SetRole: %v", desc, err)
+		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeTeamCannotUpdateRole)}
+	}
+
+	var t mdl.TeamJSON
+	fieldsToKeep := []string{"Id", "Name", "AdminIds", "Private", "OwnerIds", "ModeratorIds", "SpectatorIds"}
+	helpers.InitPointerStructure(team, &t, fieldsToKeep)
+
+	data := struct {
+		MessageInfo string `json:",omitempty"`
+		Team        mdl.TeamJSON
+	}{
+		fmt.Sprintf("%s is now %s of team %s.", member.Username, role, team.Name),
+		t,
+	}
+
+	return templateshlp.RenderJSON(w, c, data)
+}
+
+// TransferOwnership handler, use it to transfer the ownership of a team to one of its members.
+//
+//	POST	/j/teams/:teamId/owner/transfer/:userId
+//
+// The current owner becomes an admin of the team.
+//
+func TransferOwnership(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
+	c := platform.NewContext(r)
+	desc := "Team transfer ownership Handler:"
+	extract := extract.NewContext(c, desc, r)
+
+	var team *mdl.Team
+	var err error
+	if team, err = extract.Team(); err != nil {
+		return err
+	}
+
+	var newOwner *mdl.User
+	if newOwner, err = extract.User(); err != nil {
+		return err
+	}
+
+	if err = team.TransferOwnership(c, u.Id, newOwner.Id); err != nil {
+		log.Errorf(c, "%s error on TransferOwnership: %v", desc, err)
+		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeTeamCannotUpdateRole)}
+	}
+
+	// publish new activity
+	u.Publish(c, "team", "transferred the ownership of team", team.Entity(), newOwner.Entity())
+
+	var t mdl.TeamJSON
+	fieldsToKeep := []string{"Id", "Name", "AdminIds", "Private", "OwnerIds", "ModeratorIds", "SpectatorIds"}
+	helpers.InitPointerStructure(team, &t, fieldsToKeep)
+
+	data := struct {
+		MessageInfo string `json:",omitempty"`
+		Team        mdl.TeamJSON
+	}{
+		fmt.Sprintf("%s is now the owner of team %s.", newOwner.Username, team.Name),
+		t,
+	}
+
+	return templateshlp.RenderJSON(w, c, data)
+}
+
+// Roles handler, use it to get the roles of the members of a team and the permissions of each role.
+//
+//	GET	/j/teams/:teamId/roles
+//
+func Roles(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
+	c := platform.NewContext(r)
+	desc := "Team roles Handler:"
+	extract := extract.NewContext(c, desc, r)
+
+	var team *mdl.Team
+	var err error
+	if team, err = extract.Team(); err != nil {
+		return err
+	}
+
+	var players []*mdl.User
+	if players, err = team.Players(c); err != nil {
+		log.Errorf(c, "%s unable to get players of team: %v", desc, err)
+		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeInternal)}
+	}
+
+	permissions := make(map[string][]string)
+	for _, role := range mdl.TeamRoles {
+		for _, p := range mdl.TeamPermissions {
+			if mdl.RoleHasPermission(role, p) {
+				permissions[role] = append(permissions[role], p)
+			}
+		}
+	}
+
+	data := struct {
+		Role        string
+		Players     []playerViewModel
+		Permissions map[string][]string
+	}{
+		team.Role(c, u.Id),
+		buildPlayersViewModel(c, team, players),
+		permissions,
+	}
+
+	return templateshlp.RenderJSON(w, c, data)
+}
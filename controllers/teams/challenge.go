@@ -0,0 +1,314 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package teams
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/taironas/gonawin/extract"
+	"github.com/taironas/gonawin/helpers"
+	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/platform"
+	templateshlp "github.com/taironas/gonawin/helpers/templates"
+
+	mdl "github.com/taironas/gonawin/models"
+)
+
+// ChallengeData holds basic information of a Challenge entity.
+//
+type ChallengeData struct {
+	TeamId int64  // id of the challenged team.
+	Phase  string // name of the phase, empty for the whole tournament.
+	Mode   string // accuracy or score.
+}
+
+// NewChallenge handler, use it to challenge another team in a tournament.
+//	POST	/j/teams/[0-9]+/challenges/new/[0-9]+/	Challenges a team in the tournament with the given id.
+// The body holds the id of the challenged team, the phase and the mode of the challenge.
+// Response: JSON formatted challenge.
+//
+func NewChallenge(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
+	c := platform.NewContext(r)
+	desc := "Team New Challenge Handler:"
+	extract := extract.NewContext(c, desc, r)
+
+	var team *mdl.Team
+	var err error
+	if team, err = extract.Team(); err != nil {
+		return err
+	}
+
+	var tournament *mdl.Tournament
+	if tournament, err = extract.Tournament(); err != nil {
+		return err
+	}
+
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Errorf(c, "%s Error when reading request body err: %v", desc, err)
+		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeChallengeCannotCreate)}
+	}
+
+	var data ChallengeData
+	if err = json.Unmarshal(body, &data); err != nil {
+		log.Errorf(c, "%s Error when decoding request body err: %v", desc, err)
+		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeChallengeCannotCreate)}
+	}
+
+	if data.TeamId == team.Id {
+		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeChallengeSameTeam)}
+	}
+
+	if len(data.Mode) == 0 {
+		data.Mode = mdl.ChallengeModeAccuracy
+	}
+	if !mdl.IsValidChallengeMode(data.Mode) {
+		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeChallengeModeNotSupported)}
+	}
+
+	if len(data.Phase) > 0 {
+		var tb mdl.TournamentBuilder
+		if tb = mdl.GetTournamentBuilder(tournament); tb == nil {
+			log.Errorf(c, "%s TournamentBuilder not found", desc)
+			return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeInternal)}
+		}
+		if !helpers.SliceContains(tb.ArrayOfPhases(), data.Phase) {
+			return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeChallengePhaseNotSupported)}
+		}
+	}
+
+	var opponent *mdl.Team
+	if opponent, err = mdl.TeamByID(c, data.TeamId); err != nil {
+		log.Errorf(c, "%s challenged team not found: %v", desc, err)
+		return &helpers.NotFound{Err: errors.New(helpers.ErrorCodeTeamNotFound)}
+	}
+
+	if !tournament.TeamJoined(c, team) || !tournament.TeamJoined(c, opponent) {
+		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeChallengeTeamNotInTourney)}
+	}
+
+	if mdl.ChallengeExists(c, tournament.Id, data.Phase, team.Id, opponent.Id) {
+		return &helpers.Forbidden{Err: errors.New(helpers.ErrorCodeChallengeAlreadyExists)}
+	}
+
+	var challenge *mdl.Challenge
+	if challenge, err = mdl.CreateChallenge(c, tournament, team, opponent, data.Phase, data.Mode, u.Id); err != nil {
+		log.Errorf(c, "%s error when trying to create a challenge: %v", desc, err)
+		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeChallengeCannotCreate)}
+	}
+
+	// publish new activity
+	team.Publish(c, "challenge", "challenged", opponent.Entity(), tournament.Entity())
+
+	msg := fmt.Sprintf("Team %s challenged team %s.", team.Name, opponent.Name)
+	vm := buildChallengeViewModel(challenge, msg)
+
+	return templateshlp.RenderJSON(w, c, vm)
+}
+
+type challengeViewModel struct {
+	MessageInfo string `json:",omitempty"`
+	Challenge   mdl.ChallengeJSON
+}
+
+func buildChallengeViewModel(challenge *mdl.Challenge, msg string) challengeViewModel {
+	var chJSON mdl.ChallengeJSON
+	fieldsToKeep := []string{"Id", "TournamentId", "TournamentName", "Phase", "Mode", "ChallengerTeamId", "ChallengerName", "ChallengedTeamId", "ChallengedName", "State", "WinnerTeamId", "Days", "Created", "Finished"}
+	helpers.InitPointerStructure(challenge, &chJSON, fieldsToKeep)
+
+	return challengeViewModel{msg, chJSON}
+}
+
+// Challenges handler, use it to get the challenges of a team.
+//	GET	/j/teams/[0-9]+/challenges/	Retrieves the challenges of a team, as challenger or as challenged team.
+// Response: array of JSON formatted challenges.
+//
+func Challenges(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
+	c := platform.NewContext(r)
+	desc := "Team Challenges Handler:"
+	extract := extract.NewContext(c, desc, r)
+
+	var teamID int64
+	var err error
+	if teamID, err = extract.TeamId(); err != nil {
+		return err
+	}
+
+	challenges := mdl.TeamChallenges(c, teamID)
+
+	fieldsToKeep := []string{"Id", "TournamentId", "TournamentName", "Phase", "Mode", "ChallengerTeamId", "ChallengerName", "ChallengedTeamId", "ChallengedName", "State", "WinnerTeamId", "Created", "Finished"}
+	challengesJSON := make([]mdl.ChallengeJSON, len(challenges))
+	helpers.TransformFromArrayOfPointers(&challenges, &challengesJSON, fieldsToKeep)
+
+	data := struct {
+		Challenges []mdl.ChallengeJSON
+	}{
+		challengesJSON,
+	}
+
+	return templateshlp.RenderJSON(w, c, data)
+}
+
+// ShowChallenge handler, use it to get a challenge and the comparison of both teams by matchday.
+//	GET	/j/teams/challenges/show/[0-9]+/	Retrieves the challenge with the given id.
+// While the challenge is running the values of the matchdays that are over are the stored ones,
+// the values of the current matchday are computed from its finished matches.
+// Response: JSON formatted challenge.
+//
+func ShowChallenge(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
+	c := platform.NewContext(r)
+	desc := "Team Show Challenge Handler:"
+	extract := extract.NewContext(c, desc, r)
+
+	var challenge *mdl.Challenge
+	var err error
+	if challenge, err = extract.Challenge(); err != nil {
+		return err
+	}
+
+	if challenge.State == mdl.ChallengeAccepted {
+		var tournament *mdl.Tournament
+		if tournament, err = mdl.TournamentByID(c, challenge.TournamentId); err != nil {
+			log.Errorf(c, "%s tournament not found: %v", desc, err)
+			return &helpers.NotFound{Err: errors.New(helpers.ErrorCodeTournamentNotFound)}
+		}
+		if challenge.Days, err = challenge.Comparison(c, tournament); err != nil {
+			log.Errorf(c, "%s unable to compare teams: %v", desc, err)
+			return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeInternal)}
+		}
+	}
+
+	challenger, challenged := challenge.Totals()
+
+	data := struct {
+		Challenge        mdl.ChallengeJSON
+		ChallengerTotal  float64
+		ChallengedTotal  float64
+		ChallengerImgURL string
+		ChallengedImgURL string
+	}{
+		buildChallengeViewModel(challenge, "").Challenge,
+		challenger,
+		challenged,
+		helpers.TeamImageURL(challenge.ChallengerName, challenge.ChallengerTeamId),
+		helpers.TeamImageURL(challenge.ChallengedName, challenge.ChallengedTeamId),
+	}
+
+	return templateshlp.RenderJSON(w, c, data)
+}
+
+// AcceptChallenge handler, use it to accept a challenge.
+//	POST	/j/teams/challenges/accept/[0-9]+/	Accepts the challenge with the given id.
+// Only an admin of the challenged team can accept the challenge.
+// Response: JSON formatted challenge.
+//
+func AcceptChallenge(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
+	c := platform.NewContext(r)
+	desc := "Team Accept Challenge Handler:"
+	extract := extract.NewContext(c, desc, r)
+
+	var challenge *mdl.Challenge
+	var err error
+	if challenge, err = extract.Challenge(); err != nil {
+		return err
+	}
+
+	if !mdl.IsTeamAdmin(c, challenge.ChallengedTeamId, u.Id) {
+		log.Errorf(c, "%s user is not admin of challenged team", desc)
+		return &helpers.Forbidden{Err: errors.New(helpers.ErrorCodeChallengeForbiden)}
+	}
+
+	if err = challenge.Accept(c); err != nil {
+		log.Errorf(c, "%s unable to accept challenge: %v", desc, err)
+		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeChallengeCannotUpdate)}
+	}
+
+	// publish new activity
+	if team, err := mdl.TeamByID(c, challenge.ChallengedTeamId); err != nil {
+		log.Errorf(c, "%s team not found: %v", desc, err)
+	} else {
+		object := mdl.ActivityEntity{Id: challenge.ChallengerTeamId, Type: "team", DisplayName: challenge.ChallengerName}
+		target := mdl.ActivityEntity{Id: challenge.TournamentId, Type: "tournament", DisplayName: challenge.TournamentName}
+		team.Publish(c, "challenge", "accepted the challenge of", object, target)
+	}
+
+	msg := fmt.Sprintf("You accepted the challenge of team %s.", challenge.ChallengerName)
+	vm := buildChallengeViewModel(challenge, msg)
+
+	return templateshlp.RenderJSON(w, c, vm)
+}
+
+// DeclineChallenge handler, use it to decline a challenge.
+//	POST	/j/teams/challenges/decline/[0-9]+/	Declines the challenge with the given id.
+// An admin of either team can decline a pending challenge.
+// Response: JSON formatted challenge.
+//
+func DeclineChallenge(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
+	c := platform.NewContext(r)
+	desc := "Team Decline Challenge Handler:"
+	extract := extract.NewContext(c, desc, r)
+
+	var challenge *mdl.Challenge
+	var err error
+	if challenge, err = extract.Challenge(); err != nil {
+		return err
+	}
+
+	if !mdl.IsTeamAdmin(c, challenge.ChallengedTeamId, u.Id) && !mdl.IsTeamAdmin(c, challenge.ChallengerTeamId, u.Id) {
+		log.Errorf(c, "%s user is not admin of any team of the challenge", desc)
+		return &helpers.Forbidden{Err: errors.New(helpers.ErrorCodeChallengeForbiden)}
+	}
+
+	if err = challenge.Decline(c); err != nil {
+		log.Errorf(c, "%s unable to decline challenge: %v", desc, err)
+		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeChallengeCannotUpdate)}
+	}
+
+	msg := fmt.Sprintf("The challenge between %s and %s was declined.", challenge.ChallengerName, challenge.ChallengedName)
+	vm := buildChallengeViewModel(challenge, msg)
+
+	return templateshlp.RenderJSON(w, c, vm)
+}
+
+// Trophies handler, use it to get the trophies won by a team in challenges.
+//	GET	/j/teams/[0-9]+/trophies/	Retrieves the trophies of the team with the given id.
+// Response: array of JSON formatted trophies.
+//
+func Trophies(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
+	c := platform.NewContext(r)
+	desc := "Team Trophies Handler:"
+	extract := extract.NewContext(c, desc, r)
+
+	var team *mdl.Team
+	var err error
+	if team, err = extract.Team(); err != nil {
+		return err
+	}
+
+	data := struct {
+		Trophies []*mdl.Trophy
+	}{
+		team.Trophies(c),
+	}
+
+	return templateshlp.RenderJSON(w, c, data)
+}
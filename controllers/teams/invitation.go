@@ -17,29 +17,41 @@
 package teams
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io/ioutil"
 	"net/http"
-
-	"appengine"
+	"time"
 
 	"github.com/taironas/gonawin/extract"
 	"github.com/taironas/gonawin/helpers"
 	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/platform"
 	templateshlp "github.com/taironas/gonawin/helpers/templates"
 
 	mdl "github.com/taironas/gonawin/models"
 )
 
+// RequestData holds the message sent by a user with a request to join a team.
+//
+type RequestData struct {
+	Message string
+}
+
+// RequestsData holds the ids of the requests to handle at once.
+//
+type RequestsData struct {
+	RequestIds []int64
+}
+
 // RequestInvite handler, use it to request an invitation to a team.
 //  POST	/j/teams/requestinvite/[0-9]+/     Request an invitation to a private team with the given id.
+// The body can hold a message to the team. A user whose request was denied has to wait before requesting again.
 // Response: a JSON formatted status message.
 //
 func RequestInvite(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "POST" {
-		return &helpers.NotFound{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Team Request Invite Handler:"
 	extract := extract.NewContext(c, desc, r)
 
@@ -50,11 +62,36 @@ func RequestInvite(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 		return err
 	}
 
+	if team.IsBanned(u.Id) {
+		return &helpers.Forbidden{Err: errors.New(helpers.ErrorCodeTeamBanned)}
+	}
+
 	if mdl.WasTeamRequestSent(c, team.Id, u.Id) {
 		return &helpers.Forbidden{Err: errors.New(helpers.ErrorCodeTeamRequestAlreadySent)}
 	}
 
-	if _, err := mdl.CreateTeamRequest(c, team.Id, team.Name, u.Id, u.Username); err != nil {
+	if allowedAt := mdl.TeamRequestAllowedAt(c, team.Id, u.Id); time.Now().Before(allowedAt) {
+		log.Errorf(c, "%s user %d cannot request again before %v", desc, u.Id, allowedAt)
+		return &helpers.Forbidden{Err: errors.New(helpers.ErrorCodeTeamRequestTooSoon)}
+	}
+
+	var data RequestData
+	defer r.Body.Close()
+	if body, err := ioutil.ReadAll(r.Body); err != nil {
+		log.Errorf(c, "%s Error when reading request body err: %v", desc, err)
+		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeTeamCannotInvite)}
+	} else if len(body) > 0 {
+		if err = json.Unmarshal(body, &data); err != nil {
+			log.Errorf(c, "%s Error when decoding request body err: %v", desc, err)
+			return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeTeamCannotInvite)}
+		}
+	}
+
+	if len(data.Message) > mdl.TeamRequestMessageMaxLength {
+		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeTeamMessageTooLong)}
+	}
+
+	if _, err := mdl.CreateTeamRequestWithMessage(c, team.Id, team.Name, u.Id, u.Username, data.Message); err != nil {
 		log.Errorf(c, "%s teams.Invite, error when trying to create a team request: %v", desc, err)
 		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeTeamCannotInvite)}
 	}
@@ -66,14 +103,11 @@ func RequestInvite(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 // SendInvite handler, use it to send an invitation to gonawin.
 //	POST	/j/teams/sendinvite/[0-9]+/			Send an invitation to a user with the given team id and user id.
 // An activity is published when the invitation is sent.
+// A user cannot be invited twice, nor by a user he blocked, nor to a team he is banned from.
 // Response: a JSON formatted status message.
 //
 func SendInvite(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "POST" {
-		return &helpers.NotFound{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Team Send User Invitation Handler:"
 	extract := extract.NewContext(c, desc, r)
 
@@ -90,6 +124,19 @@ func SendInvite(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 		return err
 	}
 
+	if user.HasBlocked(u.Id) {
+		log.Errorf(c, "%s user %d has blocked user %d", desc, user.Id, u.Id)
+		return &helpers.Forbidden{Err: errors.New(helpers.ErrorCodeUserBlocked)}
+	}
+
+	if team.IsBanned(user.Id) {
+		return &helpers.Forbidden{Err: errors.New(helpers.ErrorCodeTeamUserBanned)}
+	}
+
+	if mdl.FindUserRequestByTeamAndUser(c, team.Id, user.Id) != nil {
+		return &helpers.Forbidden{Err: errors.New(helpers.ErrorCodeTeamUserAlreadyInvited)}
+	}
+
 	if _, err := mdl.CreateUserRequest(c, team.Id, user.Id); err != nil {
 		log.Errorf(c, "%s teams.SendInvite, error when trying to create a user request: %v", desc, err)
 		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeTeamCannotInvite)}
@@ -106,12 +153,8 @@ func SendInvite(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 // Response: array of JSON formatted users.
 //
 func Invited(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "GET" {
-		return &helpers.NotFound{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
 	desc := "Team Invited Handler:"
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	extract := extract.NewContext(c, desc, r)
 
 	var teamID int64
@@ -163,16 +206,12 @@ func buildTeamInvitedViewModel(users []*mdl.User) teamInvitedViewModel {
 }
 
 // AllowRequest handler, use it to allow a user to join a team.
-//	GET  /j/teams/allow/[0-9]+/			Allow a request send by a user on a team.
+//	POST /j/teams/allow/[0-9]+/			Allow a request send by a user on a team.
 // After this, the user that send the request will be part of the team.
 // Response: a JSON formatted status message.
 //
 func AllowRequest(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "POST" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Team Allow Request Handler:"
 	extract := extract.NewContext(c, desc, r)
 
@@ -190,30 +229,27 @@ func AllowRequest(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 		log.Errorf(c, "%s team not found. id: %v, err: %v", desc, teamRequest.TeamId, err)
 		return &helpers.NotFound{Err: errors.New(helpers.ErrorCodeTeamRequestNotFound)}
 	}
-	user, err := mdl.UserByID(c, teamRequest.UserId)
-	if err != nil {
-		log.Errorf(c, "%s user not found, err: %v", desc, err)
-		return &helpers.NotFound{Err: errors.New(helpers.ErrorCodeUserNotFound)}
+
+	if !team.HasPermission(c, u.Id, mdl.TeamPermissionApproveRequests) {
+		log.Errorf(c, "%s user is not allowed to handle requests", desc)
+		return &helpers.Forbidden{Err: errors.New(helpers.ErrorCodeTeamRequestForbiden)}
 	}
 
-	team.Join(c, user)
-	// request is no more needed so clear it from datastore
-	teamRequest.Destroy(c)
+	if err = teamRequest.Allow(c, team); err != nil {
+		log.Errorf(c, "%s unable to allow request: %v", desc, err)
+		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeInternal)}
+	}
 
 	return templateshlp.RenderJSON(w, c, "team request was handled")
 }
 
 // DenyRequest handler, use it to not allow a user to join a team.
-//	GET  /j/teams/deny/[0-9]+/			Deny a request send by a user on a team.
-// After this, the user will not be able to be part of the team.
+//	POST /j/teams/deny/[0-9]+/			Deny a request send by a user on a team.
+// After this, the user will not be able to request again to join the team during a week.
 // Response: a JSON formatted status message.
 //
 func DenyRequest(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "POST" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Team Deny Request Handler:"
 	extract := extract.NewContext(c, desc, r)
 
@@ -225,8 +261,122 @@ func DenyRequest(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 		return err
 	}
 
-	// request is no more needed so clear it from datastore
-	teamRequest.Destroy(c)
+	if !mdl.HasTeamPermission(c, teamRequest.TeamId, u.Id, mdl.TeamPermissionApproveRequests) {
+		log.Errorf(c, "%s user is not allowed to handle requests", desc)
+		return &helpers.Forbidden{Err: errors.New(helpers.ErrorCodeTeamRequestForbiden)}
+	}
+
+	if err = teamRequest.Deny(c); err != nil {
+		log.Errorf(c, "%s unable to deny request: %v", desc, err)
+		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeInternal)}
+	}
 
 	return templateshlp.RenderJSON(w, c, "team request was handled")
 }
+
+// Requests handler, use it to get the queue of the pending requests to join a team.
+//	GET	/j/teams/[0-9]+/requests/?count=n&page=p	Retrieves the pending requests of a team, the oldest first.
+// Expired requests are not part of the queue.
+// Response: array of JSON formatted team requests and the total number of pending requests.
+//
+func Requests(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
+	c := platform.NewContext(r)
+	desc := "Team Requests Handler:"
+	extract := extract.NewContext(c, desc, r)
+
+	var team *mdl.Team
+	var err error
+	if team, err = extract.Team(); err != nil {
+		return err
+	}
+
+	count := extract.Count()
+	page := extract.Page()
+
+	requests, total := mdl.TeamRequestsQueue(c, team.Id, count, page)
+
+	fieldsToKeep := []string{"Id", "TeamId", "UserId", "UserName", "Created", "Message"}
+	requestsJSON := make([]mdl.TeamRequestJSON, len(requests))
+	helpers.TransformFromArrayOfPointers(&requests, &requestsJSON, fieldsToKeep)
+
+	data := struct {
+		Requests []mdl.TeamRequestJSON
+		Total    int64
+		Count    int64
+		Page     int64
+	}{
+		requestsJSON,
+		total,
+		count,
+		page,
+	}
+
+	return templateshlp.RenderJSON(w, c, data)
+}
+
+// AllowRequests handler, use it to allow several requests to join a team at once.
+//	POST	/j/teams/[0-9]+/requests/allow/	Allows the requests with the given ids.
+// Response: a JSON formatted status message.
+//
+func AllowRequests(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
+	return handleRequests(w, r, u, "Team Allow Requests Handler:", true)
+}
+
+// DenyRequests handler, use it to deny several requests to join a team at once.
+//	POST	/j/teams/[0-9]+/requests/deny/	Denies the requests with the given ids.
+// Response: a JSON formatted status message.
+//
+func DenyRequests(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
+	return handleRequests(w, r, u, "Team Deny Requests Handler:", false)
+}
+
+// handleRequests allows or denies the requests which ids are in the body of the HTTP request.
+// Requests that do not belong to the team are ignored.
+//
+func handleRequests(w http.ResponseWriter, r *http.Request, u *mdl.User, desc string, allow bool) error {
+	c := platform.NewContext(r)
+	extract := extract.NewContext(c, desc, r)
+
+	var team *mdl.Team
+	var err error
+	if team, err = extract.Team(); err != nil {
+		return err
+	}
+
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Errorf(c, "%s Error when reading request body err: %v", desc, err)
+		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeInternal)}
+	}
+
+	var data RequestsData
+	if err = json.Unmarshal(body, &data); err != nil {
+		log.Errorf(c, "%s Error when decoding request body err: %v", desc, err)
+		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeTeamRequestNotFound)}
+	}
+
+	handled := 0
+	for _, tr := range mdl.TeamRequestsByIds(c, team.Id, data.RequestIds) {
+		if allow {
+			err = tr.Allow(c, team)
+		} else {
+			err = tr.Deny(c)
+		}
+		if err != nil {
+			log.Errorf(c, "%s unable to handle request %d: %v", desc, tr.Id, err)
+			continue
+		}
+		handled++
+	}
+
+	result := struct {
+		MessageInfo string `json:",omitempty"`
+		Handled     int
+	}{
+		fmt.Sprintf("%d of %d team requests were handled.", handled, len(data.RequestIds)),
+		handled,
+	}
+
+	return templateshlp.RenderJSON(w, c, result)
+}
@@ -0,0 +1,131 @@
+package teams
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/taironas/route"
+
+	"github.com/taironas/gonawin/helpers"
+	"github.com/taironas/gonawin/helpers/memcache"
+	"github.com/taironas/gonawin/helpers/platform"
+	mdl "github.com/taironas/gonawin/models"
+	"github.com/taironas/gonawin/repository"
+)
+
+// TestInvitationsRefused tests that a user banned from a team can neither request to join it again nor be
+// invited to it, and that a user cannot invite a user who blocked him.
+//
+func TestInvitationsRefused(t *testing.T) {
+	platform.UseStandalone(nil)
+	defer platform.UseStandalone(nil)
+	repository.Use(repository.NewMemory())
+	defer repository.Use(repository.Datastore)
+	memcache.Use(memcache.NewMemory())
+
+	c := repository.NewLocalContext(nil)
+
+	users := make(map[string]*mdl.User)
+	for _, name := range []string{"ned", "arya", "jon", "sansa"} {
+		u, err := mdl.CreateUser(c, name+"@winterfell.com", name, name, "", false, "")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		users[name] = u
+	}
+
+	team, err := mdl.CreateTeam(c, "starks", "winter is coming", users["ned"].Id, true)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	for _, name := range []string{"ned", "arya"} {
+		if err = team.Join(c, users[name]); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+	}
+	if err = team.Ban(c, users["arya"]); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if err = users["jon"].Block(c, users["ned"].Id); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	tests := []struct {
+		title   string
+		pattern string
+		handler func(http.ResponseWriter, *http.Request, *mdl.User) error
+		user    string // user sending the request.
+		target  string // user requesting to join the team, or invited to it.
+		err     string
+	}{
+		{
+			title:   "banned user cannot request to join again",
+			pattern: "/j/teams/requestinvite/:teamId",
+			handler: RequestInvite,
+			user:    "arya",
+			target:  "arya",
+			err:     helpers.ErrorCodeTeamBanned,
+		},
+		{
+			title:   "banned user cannot be invited",
+			pattern: "/j/teams/sendinvite/:teamId/:userId",
+			handler: SendInvite,
+			user:    "ned",
+			target:  "arya",
+			err:     helpers.ErrorCodeTeamUserBanned,
+		},
+		{
+			title:   "blocked user cannot invite the user who blocked him",
+			pattern: "/j/teams/sendinvite/:teamId/:userId",
+			handler: SendInvite,
+			user:    "ned",
+			target:  "jon",
+			err:     helpers.ErrorCodeUserBlocked,
+		},
+		{
+			title:   "user can request to join",
+			pattern: "/j/teams/requestinvite/:teamId",
+			handler: RequestInvite,
+			user:    "sansa",
+			target:  "sansa",
+		},
+		{
+			title:   "user can be invited",
+			pattern: "/j/teams/sendinvite/:teamId/:userId",
+			handler: SendInvite,
+			user:    "ned",
+			target:  "sansa",
+		},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+
+		var err error
+		router := new(route.Router)
+		router.HandleFunc(test.pattern, func(w http.ResponseWriter, r *http.Request) {
+			err = test.handler(w, r, users[test.user])
+		})
+		path := strings.NewReplacer(
+			":teamId", strconv.FormatInt(team.Id, 10),
+			":userId", strconv.FormatInt(users[test.target].Id, 10),
+		).Replace(test.pattern)
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", path, nil))
+
+		if len(test.err) == 0 {
+			if err != nil {
+				t.Errorf("test %v - Error: %v", i, err)
+			}
+			continue
+		}
+		if _, ok := err.(*helpers.Forbidden); !ok || err.Error() != test.err {
+			t.Errorf("test %v - Error: want forbidden error %q, got %v", i, test.err, err)
+		}
+		if mdl.WasTeamRequestSent(c, team.Id, users[test.target].Id) || mdl.FindUserRequestByTeamAndUser(c, team.Id, users[test.target].Id) != nil {
+			t.Errorf("test %v - Error: no request should be created for %s", i, test.target)
+		}
+	}
+}
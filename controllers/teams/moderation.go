@@ -0,0 +1,135 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package teams
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/taironas/gonawin/extract"
+	"github.com/taironas/gonawin/helpers"
+	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/platform"
+	templateshlp "github.com/taironas/gonawin/helpers/templates"
+
+	mdl "github.com/taironas/gonawin/models"
+)
+
+// Kick handler, use it to remove a member from a team.
+//
+//	POST	/j/teams/:teamId/kick/:userId
+//
+// The member also leaves the running tournaments of the team.
+//
+func Kick(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
+	return removeMember(w, r, u, "Team kick Handler:", false)
+}
+
+// Ban handler, use it to remove a member from a team and prevent him from joining it again.
+//
+//	POST	/j/teams/:teamId/ban/:userId
+//
+// A user who is not a member can be banned as well, his pending requests and invitations are cleared.
+//
+func Ban(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
+	return removeMember(w, r, u, "Team ban Handler:", true)
+}
+
+// removeMember kicks or bans the user of the request from the team.
+//
+func removeMember(w http.ResponseWriter, r *http.Request, u *mdl.User, desc string, ban bool) error {
+	c := platform.NewContext(r)
+	extract := extract.NewContext(c, desc, r)
+
+	var team *mdl.Team
+	var err error
+	if team, err = extract.Team(); err != nil {
+		return err
+	}
+
+	var member *mdl.User
+	if member, err = extract.User(); err != nil {
+		return err
+	}
+
+	if !team.CanRemoveMember(c, u.Id, member.Id) {
+		log.Errorf(c, "%s user %d is not allowed to remove user %d", desc, u.Id, member.Id)
+		return &helpers.Forbidden{Err: errors.New(helpers.ErrorCodeTeamRemoveForbiden)}
+	}
+
+	if ban {
+		err = team.Ban(c, member)
+	} else {
+		err = team.Kick(c, member)
+	}
+	if err != nil {
+		log.Errorf(c, "%s unable to remove user %d: %v", desc, member.Id, err)
+		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeTeamCannotRemove)}
+	}
+
+	msg := fmt.Sprintf("%s was removed from team %s.", member.Username, team.Name)
+	if ban {
+		msg = fmt.Sprintf("%s was banned from team %s.", member.Username, team.Name)
+	}
+	vm := buildTeamModerationViewModel(team, msg)
+
+	return templateshlp.RenderJSON(w, c, vm)
+}
+
+// Unban handler, use it to lift the ban of a user.
+//
+//	POST	/j/teams/:teamId/unban/:userId
+//
+func Unban(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
+	c := platform.NewContext(r)
+	desc := "Team unban Handler:"
+	extract := extract.NewContext(c, desc, r)
+
+	var team *mdl.Team
+	var err error
+	if team, err = extract.Team(); err != nil {
+		return err
+	}
+
+	var userID int64
+	if userID, err = extract.UserId(); err != nil {
+		return err
+	}
+
+	if err = team.Unban(c, userID); err != nil {
+		log.Errorf(c, "%s unable to unban user %d: %v", desc, userID, err)
+		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeTeamCannotUnban)}
+	}
+
+	vm := buildTeamModerationViewModel(team, "The ban was lifted.")
+
+	return templateshlp.RenderJSON(w, c, vm)
+}
+
+type teamModerationViewModel struct {
+	MessageInfo string `json:",omitempty"`
+	Team        mdl.TeamJSON
+}
+
+func buildTeamModerationViewModel(team *mdl.Team, msg string) teamModerationViewModel {
+	var t mdl.TeamJSON
+	fieldsToKeep := []string{"Id", "Name", "AdminIds", "Private", "MembersCount", "BannedIds"}
+	helpers.InitPointerStructure(team, &t, fieldsToKeep)
+
+	return teamModerationViewModel{msg, t}
+}
@@ -22,11 +22,10 @@ import (
 	"io/ioutil"
 	"net/http"
 
-	"appengine"
-
 	"github.com/taironas/gonawin/extract"
 	"github.com/taironas/gonawin/helpers"
 	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/platform"
 	templateshlp "github.com/taironas/gonawin/helpers/templates"
 
 	mdl "github.com/taironas/gonawin/models"
@@ -37,11 +36,7 @@ import (
 // Response: array of JSON formatted prices.
 //
 func Prices(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "GET" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Team Prices Handler:"
 	extract := extract.NewContext(c, desc, r)
 
@@ -73,11 +68,7 @@ func buildTeamPricesViewModel(prices []*mdl.Price) teamPricesViewModel {
 // Response: JSON formatted price.
 //
 func PriceByTournament(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method == "GET" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Team Price by tournament Handler:"
 	extract := extract.NewContext(c, desc, r)
 
@@ -103,14 +94,12 @@ func PriceByTournament(w http.ResponseWriter, r *http.Request, u *mdl.User) erro
 
 // UpdatePrice handler, use it to update the price of a team for a specific tournament.
 //	POST	/j/teams/[0-9]+/prices/update/[0-9]+/		Updates price of a team with the given id for the specified tournament.
+// The body can hold a new description and the ranks of the price (first, second, woodenspoon, bestmatchday).
+// A price cannot be updated once its winners are resolved.
 // Response: JSON formatted price.
 //
 func UpdatePrice(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "POST" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Team update price Handler:"
 	extract := extract.NewContext(c, desc, r)
 
@@ -143,9 +132,26 @@ func UpdatePrice(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeTeamCannotUpdate)}
 	}
 
-	if helpers.IsStringValid(priceData.Description) && (p.Description != priceData.Description) {
+	if p.IsResolved() {
+		log.Errorf(c, "%s Cannot update because price is already resolved.", desc)
+		return &helpers.Forbidden{Err: errors.New(helpers.ErrorCodePriceAlreadyResolved)}
+	}
+
+	updateDescription := helpers.IsStringValid(priceData.Description) && (p.Description != priceData.Description)
+	updateRanks := priceData.Ranks != nil
+
+	if updateRanks {
+		if err = p.SetRanks(priceData.Ranks); err != nil {
+			log.Errorf(c, "%s Cannot update ranks: %v", desc, err)
+			return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodePriceRankNotSupported)}
+		}
+	}
+
+	if updateDescription || updateRanks {
 		// update data
-		p.Description = priceData.Description
+		if updateDescription {
+			p.Description = priceData.Description
+		}
 		p.Update(c)
 	} else {
 		log.Errorf(c, "%s Cannot update because updated is not valid.", desc)
@@ -165,3 +171,23 @@ type teamPriceViewModel struct {
 func buildTeamPriceViewModel(price *mdl.Price) teamPriceViewModel {
 	return teamPriceViewModel{Price: price}
 }
+
+// Winners handler, use it to get the winners history of a team.
+//	GET	/j/teams/[0-9]+/winners/	Retrieves the resolved prices of a team with the given id, the most recent first.
+// Response: array of JSON formatted prices with their winners.
+//
+func Winners(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
+	c := platform.NewContext(r)
+	desc := "Team Winners Handler:"
+	extract := extract.NewContext(c, desc, r)
+
+	var team *mdl.Team
+	var err error
+	if team, err = extract.Team(); err != nil {
+		return err
+	}
+
+	pvm := buildTeamPricesViewModel(team.WinnersHistory(c))
+
+	return templateshlp.RenderJSON(w, c, pvm)
+}
@@ -17,13 +17,11 @@
 package teams
 
 import (
-	"errors"
 	"net/http"
 
-	"appengine"
-
 	"github.com/taironas/gonawin/extract"
 	"github.com/taironas/gonawin/helpers"
+	"github.com/taironas/gonawin/helpers/platform"
 	templateshlp "github.com/taironas/gonawin/helpers/templates"
 
 	mdl "github.com/taironas/gonawin/models"
@@ -35,11 +33,7 @@ import (
 //	GET	/j/teams/[0-9]+/ranking/
 //
 func Ranking(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "GET" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Team Ranking Handler:"
 	extract := extract.NewContext(c, desc, r)
 
@@ -23,8 +23,10 @@ import (
 
 	"appengine"
 
+	"github.com/taironas/gonawin/extract"
 	"github.com/taironas/gonawin/helpers"
 	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/platform"
 	templateshlp "github.com/taironas/gonawin/helpers/templates"
 
 	mdl "github.com/taironas/gonawin/models"
@@ -32,49 +34,68 @@ import (
 
 // Search handler returns the result of a team search in a JSON format.
 // It uses parameter 'q' to make the query.
+// You can pass a 'count' and a 'page' param to get a page of the results, default values are 20 and 1.
+// Results can be filtered with 'visibility' (public or private) and 'notmember' (true for the teams
+// the user is not a member of), and sorted with 'sort' (relevance, members, accuracy or created).
+// The response holds the number of teams matching and the visibility and membership facets.
 //
 //	GET	/j/teams/search/			Search for all teams respecting the query "q"
 //
 func Search(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 
 	keywords := r.FormValue("q")
-	if r.Method != "GET" || len(keywords) == 0 {
+	if len(keywords) == 0 {
 		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
 	}
 
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Team Search Handler:"
+	extract := extract.NewContext(c, desc, r)
+
+	opts := mdl.TeamSearchOptions{
+		Visibility: r.FormValue("visibility"),
+		UserId:     u.Id,
+		NotMember:  r.FormValue("notmember") == "true",
+		Count:      extract.Count(),
+		Page:       extract.Page(),
+	}
+	if len(opts.Visibility) > 0 && opts.Visibility != mdl.TeamSearchPublic && opts.Visibility != mdl.TeamSearchPrivate {
+		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
+	}
 
-	words := helpers.SetOfStrings(keywords)
-
-	var ids []int64
 	var err error
-	if ids, err = mdl.GetTeamInvertedIndexes(c, words); err != nil {
-		return unableToPerformSearch(c, w, desc, err)
+	if opts.Sort, err = extract.Sort(mdl.TeamSearchSorts); err != nil {
+		return err
 	}
 
-	result := mdl.TeamScore(c, keywords, ids)
-	log.Infof(c, "%s result from TeamScore: %v", desc, result)
-
 	var teams []*mdl.Team
-	if teams, err = mdl.TeamsByIDs(c, result); err != nil {
-		log.Infof(c, "%v something failed when calling TeamsByIDs: %v", desc, err)
-		return notFound(c, w, keywords)
-	}
-
-	if len(teams) == 0 {
-		return notFound(c, w, keywords)
+	var total int64
+	var facets mdl.SearchFacets
+	if teams, total, facets, err = mdl.SearchTeams(c, keywords, opts); err != nil {
+		return unableToPerformSearch(c, w, desc, err)
 	}
 
-	log.Infof(c, "%s ByIds result %v", desc, teams)
+	log.Infof(c, "%s SearchTeams result %v", desc, teams)
 
 	svm := buildTeamSearchViewModel(teams)
+	svm.Total = total
+	svm.Count = opts.Count
+	svm.Page = opts.Page
+	svm.Facets = facets
+	if total == 0 {
+		svm.MessageInfo = notFoundMessage(keywords)
+	}
 
 	return templateshlp.RenderJSON(w, c, svm)
 }
 
 type teamSearchViewModel struct {
-	Teams []teamSearchTeamViewModel
+	MessageInfo string `json:",omitempty"`
+	Teams       []teamSearchTeamViewModel
+	Total       int64
+	Count       int64
+	Page        int64
+	Facets      mdl.SearchFacets
 }
 
 type teamSearchTeamViewModel struct {
@@ -101,14 +122,8 @@ func buildTeamSearchViewModel(teams []*mdl.Team) teamSearchViewModel {
 	return teamSearchViewModel{Teams: tvm}
 }
 
-func notFound(c appengine.Context, w http.ResponseWriter, keywords string) error {
-	msg := fmt.Sprintf("Oops! Your search - %s - did not match any %s.", keywords, "team")
-	data := struct {
-		MessageInfo string `json:",omitempty"`
-	}{
-		msg,
-	}
-	return templateshlp.RenderJSON(w, c, data)
+func notFoundMessage(keywords string) string {
+	return fmt.Sprintf("Oops! Your search - %s - did not match any %s.", keywords, "team")
 }
 
 func unableToPerformSearch(c appengine.Context, w http.ResponseWriter, desc string, err error) error {
@@ -21,11 +21,10 @@ import (
 	"fmt"
 	"net/http"
 
-	"appengine"
-
 	"github.com/taironas/gonawin/extract"
 	"github.com/taironas/gonawin/helpers"
 	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/platform"
 	templateshlp "github.com/taironas/gonawin/helpers/templates"
 
 	mdl "github.com/taironas/gonawin/models"
@@ -40,11 +39,7 @@ import (
 //
 func Join(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 
-	if r.Method != "POST" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Team Join Handler"
 	extract := extract.NewContext(c, desc, r)
 
@@ -54,6 +49,11 @@ func Join(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 		return &helpers.InternalServerError{Err: err}
 	}
 
+	if team.IsBanned(u.Id) {
+		log.Errorf(c, "%s  user %d is banned from the team.", desc, u.Id)
+		return &helpers.Forbidden{Err: errors.New(helpers.ErrorCodeTeamBanned)}
+	}
+
 	if team.Private {
 		log.Errorf(c, "%s  Private team cannot be joined without consent.", desc)
 		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeTeamPrivateJoinForbiden)}
@@ -96,11 +96,7 @@ func buildTeamJoinViewModel(team *mdl.Team) TeamJoinViewModel {
 //	POST	/j/teams/leave/[0-9]+/?			Make a user leave a team with the given id.
 //
 func Leave(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "POST" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Team Leave Handler:"
 	extract := extract.NewContext(c, desc, r)
 
@@ -111,9 +107,9 @@ func Leave(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 		return err
 	}
 
-	if mdl.IsTeamAdmin(c, team.Id, u.Id) {
-		log.Errorf(c, "%s Team administrator cannot leave the team", desc)
-		return &helpers.Forbidden{Err: errors.New(helpers.ErrorCodeTeamAdminCannotLeave)}
+	if team.IsLastOwner(u.Id) {
+		log.Errorf(c, "%s Last owner cannot leave the team", desc)
+		return &helpers.Forbidden{Err: errors.New(helpers.ErrorCodeTeamLastOwnerCannotLeave)}
 	}
 
 	if err := team.Leave(c, u); err != nil {
@@ -25,12 +25,28 @@
 //	POST	/j/teams/destroy/[0-9]+/		Destroys the team with the given id.
 //	POST	/j/teams/allow/[0-9]+/			Allow a user to be a member of a team with the given id.
 //	POST	/j/teams/deny/[0-9]+/			Deny entrance of user to be a member of a team with the given id.
+//	GET	/j/teams/[0-9]+/requests/		Retrieves the queue of pending requests to join a team, paginated with count and page.
+//	POST	/j/teams/[0-9]+/requests/allow/		Allows several requests to join a team at once.
+//	POST	/j/teams/[0-9]+/requests/deny/		Denies several requests to join a team at once.
 //	POST	/j/teams/join/[0-9]+/			Make a user join a team with the given id.
 //	GET	/j/teams/search/			Search for all teams respecting the query "q"
 //	GET	/j/teams/[0-9]+/members/		Retrieves all members of a team with the given id.
 //	GET	/j/teams/[0-9]+/ranking/		Retrieves the ranking of a team with the given id.
 //	GET	/j/teams/[0-9]+/accuracies/		Retrieves all the tournament accuracies of a team with the given id.
 //	GET	/j/teams/[0-9]+/accuracies/[0-9]+/	Retrieves accuracies of a team with the given id for the specified tournament.
+//	GET	/j/teams/[0-9]+/roles/			Retrieves the roles of the members of a team and the permissions of each role.
+//	POST	/j/teams/[0-9]+/roles/set/[0-9]+/[a-z]+/	Gives a role to a member of the team.
+//	POST	/j/teams/[0-9]+/owner/transfer/[0-9]+/	Transfers the ownership of the team to a member.
+//	POST	/j/teams/[0-9]+/kick/[0-9]+/		Removes a member from the team.
+//	POST	/j/teams/[0-9]+/ban/[0-9]+/		Removes a user from the team and prevents him from joining it again.
+//	POST	/j/teams/[0-9]+/unban/[0-9]+/		Lifts the ban of a user.
+//	GET	/j/teams/[0-9]+/winners/		Retrieves the winners of the prices of a team across all its tournaments.
+//	GET	/j/teams/[0-9]+/challenges/		Retrieves all the challenges of a team with the given id.
+//	POST	/j/teams/[0-9]+/challenges/new/[0-9]+/	Challenges another team in the tournament with the given id.
+//	GET	/j/teams/challenges/show/[0-9]+/	Retrieves the challenge with the given id.
+//	POST	/j/teams/challenges/accept/[0-9]+/	Accepts the challenge with the given id.
+//	POST	/j/teams/challenges/decline/[0-9]+/	Declines the challenge with the given id.
+//	GET	/j/teams/[0-9]+/trophies/		Retrieves the trophies won by a team with the given id.
 //
 //
 // Every method below gives more information about every API call, its parameters, and its resutls.
@@ -42,13 +58,13 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"strconv"
 
 	"appengine"
 
 	"github.com/taironas/gonawin/extract"
 	"github.com/taironas/gonawin/helpers"
 	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/platform"
 	templateshlp "github.com/taironas/gonawin/helpers/templates"
 
 	mdl "github.com/taironas/gonawin/models"
@@ -66,51 +82,39 @@ type TeamData struct {
 //
 type PriceData struct {
 	Description string
+	Ranks       []mdl.PriceRank
 }
 
 // Index handler, use it to get the team data.
-//      GET     /j/teams/?			List users not joined by user.
+//      GET     /j/teams/?			List teams not joined by user.
 // Parameters:
-//   'page' a int indicating the page number.
+//   'cursor' the cursor of the page, returned as 'Next' by the previous page.
 //   'count' a int indicating the number of teams per page number. default value is 25
-// Response: array of JSON formatted teams.
+// Response: array of JSON formatted teams and the cursor of the next page.
 //
 func Index(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "GET" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "teams index handler:"
+	extract := extract.NewContext(c, desc, r)
 
-	// get count parameter, if not present count is set to 25
-	strcount := r.FormValue("count")
-	count := int64(25)
-	if len(strcount) > 0 {
-		if n, err := strconv.ParseInt(strcount, 0, 64); err != nil {
-			log.Errorf(c, "%s: error during conversion of count parameter: %v", desc, err)
-		} else {
-			count = n
-		}
-	}
-
-	// get page parameter, if not present set page to the first one.
-	strpage := r.FormValue("page")
-	page := int64(1)
-	if len(strpage) > 0 {
-		if p, err := strconv.ParseInt(strpage, 0, 64); err != nil {
-			log.Errorf(c, "%s error during conversion of page parameter: %v", desc, err)
-		} else {
-			page = p
-		}
-	}
+	count := extract.CountOrDefault(25)
 
 	// fetch teams
-	teams := mdl.GetNotJoinedTeams(c, u, count, page)
+	teams, next, err := mdl.GetNotJoinedTeamsByCursor(c, u, count, extract.Cursor())
+	if err != nil {
+		log.Errorf(c, "%s unable to get teams: %v", desc, err)
+		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeInvalidCursor)}
+	}
 
-	tvm := buildIndexTeamsViewModel(teams)
+	data := struct {
+		Teams []indexTeamViewModel
+		Next  string
+	}{
+		buildIndexTeamsViewModel(teams),
+		next,
+	}
 
-	return templateshlp.RenderJSON(w, c, tvm)
+	return templateshlp.RenderJSON(w, c, data)
 }
 
 type indexTeamViewModel struct {
@@ -142,11 +146,7 @@ func buildIndexTeamsViewModel(teams []*mdl.Team) []indexTeamViewModel {
 //
 func New(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 
-	if r.Method != "POST" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Team New Handler:"
 
 	defer r.Body.Close()
@@ -218,11 +218,7 @@ func buildNewTeamsViewModel(team *mdl.Team) newTeamViewModel {
 // Response: JSON formatted team.
 //
 func Show(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "GET" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Team Show Handler:"
 	extract := extract.NewContext(c, desc, r)
 
@@ -255,6 +251,7 @@ type showViewModel struct {
 	Players     []playerViewModel         `json:",omitempty"`
 	Tournaments []showTournamentViewModel `json:",omitempty"`
 	ImageURL    string                    `json:",omitempty"`
+	Role        string                    `json:",omitempty"`
 }
 
 func buildShowViewModel(c appengine.Context, t *mdl.Team, u *mdl.User, players []*mdl.User, tournaments []*mdl.Tournament) showViewModel {
@@ -263,7 +260,7 @@ func buildShowViewModel(c appengine.Context, t *mdl.Team, u *mdl.User, players [
 	fieldsToKeep := []string{"Id", "Name", "Description", "AdminIds", "Private", "TournamentIds", "Accuracy"}
 	helpers.InitPointerStructure(t, &tJSON, fieldsToKeep)
 
-	pvm := buildPlayersViewModel(c, players)
+	pvm := buildPlayersViewModel(c, t, players)
 	tvm := buildShowTournamentViewModel(c, tournaments)
 
 	return showViewModel{
@@ -273,6 +270,7 @@ func buildShowViewModel(c appengine.Context, t *mdl.Team, u *mdl.User, players [
 		pvm,
 		tvm,
 		helpers.TeamImageURL(t.Name, t.Id),
+		t.Role(c, u.Id),
 	}
 }
 
@@ -282,9 +280,10 @@ type playerViewModel struct {
 	Alias    string
 	Score    int64
 	ImageURL string
+	Role     string
 }
 
-func buildPlayersViewModel(c appengine.Context, players []*mdl.User) []playerViewModel {
+func buildPlayersViewModel(c appengine.Context, t *mdl.Team, players []*mdl.User) []playerViewModel {
 	pvm := make([]playerViewModel, len(players))
 	for i, p := range players {
 		pvm[i].Id = p.Id
@@ -292,6 +291,7 @@ func buildPlayersViewModel(c appengine.Context, players []*mdl.User) []playerVie
 		pvm[i].Alias = p.Alias
 		pvm[i].Score = p.Score
 		pvm[i].ImageURL = helpers.UserImageURL(p.Name, p.Id)
+		pvm[i].Role = t.Role(c, p.Id)
 	}
 
 	return pvm
@@ -311,7 +311,7 @@ func buildShowTournamentViewModel(c appengine.Context, tournaments []*mdl.Tourna
 	for i, t := range tournaments {
 		tvm[i].Id = t.Id
 		tvm[i].Name = t.Name
-		tvm[i].ParticipantsCount = len(t.UserIds)
+		tvm[i].ParticipantsCount = int(t.CountParticipants())
 		tvm[i].TeamsCount = len(t.TeamIds)
 		tvm[i].Progress = t.Progress(c)
 		tvm[i].ImageURL = helpers.TournamentImageURL(t.Name, t.Id)
@@ -325,11 +325,7 @@ func buildShowTournamentViewModel(c appengine.Context, tournaments []*mdl.Tourna
 // Response: JSON formatted team.
 //
 func Update(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "POST" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Team Update Handler:"
 	extract := extract.NewContext(c, desc, r)
 
@@ -340,11 +336,6 @@ func Update(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 		return err
 	}
 
-	if !mdl.IsTeamAdmin(c, team.Id, u.Id) {
-		log.Errorf(c, "%s user is not admin", desc)
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeTeamUpdateForbiden)}
-	}
-
 	// only work on name and private. Other values should not be editable
 	defer r.Body.Close()
 	body, err := ioutil.ReadAll(r.Body)
@@ -412,11 +403,7 @@ func buildUpdateTeamsViewModel(team *mdl.Team) updateTeamViewModel {
 // Response: JSON formatted message.
 //
 func Destroy(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "POST" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Team Destroy Handler:"
 	extract := extract.NewContext(c, desc, r)
 
@@ -427,36 +414,17 @@ func Destroy(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 		return err
 	}
 
-	if !mdl.IsTeamAdmin(c, team.Id, u.Id) {
-		log.Errorf(c, "%s user is not admin", desc)
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeTeamDeleteForbiden)}
-	}
-
-	// delete all team-user relationships
-	var players []*mdl.User
-	if players, err = team.Players(c); err != nil {
-		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeInternal)}
-	}
-
-	for _, player := range players {
-		if err := player.RemoveTeamID(c, team.Id); err != nil {
-			log.Errorf(c, "%s error when trying to destroy team relationship: %v", desc, err)
-		} else if u.Id == player.Id {
-			// Be sure that current user has the latest data,
-			// as the u.Publish method will update again the user,
-			// we don't want to override the team Id removal.
-			u = player
-		}
-	}
-
 	// delete all tournament-team relationships
 	for _, tournament := range team.Tournaments(c) {
 		if err := tournament.RemoveTeamID(c, team.Id); err != nil {
 			log.Errorf(c, "%s error when trying to destroy tournament relationship: %v", desc, err)
 		}
 	}
-	// delete the team
-	team.Destroy(c)
+	// delete the team and its team-user relationships
+	if err = team.Destroy(c); err != nil {
+		log.Errorf(c, "%s error when trying to destroy team: %v", desc, err)
+		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeInternal)}
+	}
 
 	// publish new activity
 	u.Publish(c, "team", "deleted team", team.Entity(), mdl.ActivityEntity{})
@@ -479,16 +447,15 @@ func buildDestroyTeamsViewModel(team *mdl.Team) destroyTeamViewModel {
 	return tvm
 }
 
-// Members handler, use it to get all members of a team.
+// Members handler, use it to get the members of a team.
 //	/j/teams/[0-9]+/members/	GET			use this handler to get members of a team.
-// Response: array of JSON formatted users.
+// Parameters:
+//   'cursor' the cursor of the page, returned as 'Next' by the previous page.
+//   'count' a int indicating the number of members per page. default value is 100
+// Response: array of JSON formatted users and the cursor of the next page.
 //
 func Members(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "GET" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Team Members Handler:"
 	extract := extract.NewContext(c, desc, r)
 
@@ -501,11 +468,14 @@ func Members(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 
 	// build members json
 	var members []*mdl.User
-	if members, err = team.Players(c); err != nil {
-		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeInternal)}
+	var next string
+	if members, next, err = team.PlayersByCursor(c, extract.CountOrDefault(100), extract.Cursor()); err != nil {
+		log.Errorf(c, "%s unable to get members: %v", desc, err)
+		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeInvalidCursor)}
 	}
 
 	mvm := buildMembersViewModel(c, members)
+	mvm.Next = next
 
 	return templateshlp.RenderJSON(w, c, mvm)
 }
@@ -520,6 +490,7 @@ type memberViewModel struct {
 
 type membersViewModel struct {
 	Members []memberViewModel
+	Next    string
 }
 
 func buildMembersViewModel(c appengine.Context, members []*mdl.User) membersViewModel {
@@ -21,26 +21,21 @@ import (
 	"fmt"
 	"net/http"
 
-	"appengine"
-
 	"github.com/taironas/gonawin/extract"
 	"github.com/taironas/gonawin/helpers"
 	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/platform"
 	templateshlp "github.com/taironas/gonawin/helpers/templates"
 
 	mdl "github.com/taironas/gonawin/models"
 )
 
 // AddAdmin let you add an admin to a tournament.
-//	GET	/j/tournaments/[0-9]+/admin/add/
+//	POST	/j/tournaments/[0-9]+/admin/add/
 //
 func AddAdmin(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 
-	if r.Method != "POST" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Tournament add admin Handler:"
 	extract := extract.NewContext(c, desc, r)
 
@@ -87,15 +82,11 @@ func AddAdmin(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 // RemoveAdmin handler lets you remove an admin from a tournament.
 //
 // Use this handler to remove a user as admin of the current tournament.
-//	GET	/j/tournaments/[0-9]+/admin/remove/
+//	POST	/j/tournaments/[0-9]+/admin/remove/
 //
 func RemoveAdmin(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 
-	if r.Method != "POST" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Tournament remove admin Handler:"
 	extract := extract.NewContext(c, desc, r)
 
@@ -136,18 +127,59 @@ func RemoveAdmin(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 	return templateshlp.RenderJSON(w, c, data)
 }
 
+// SetPredictionVisibility handler lets you choose when the predictions of the participants
+// are revealed to the other participants.
+//
+// Use the 'visibility' parameter: always, kickoff (the default) or finished.
+//	POST	/j/tournaments/[0-9]+/admin/predictions/
+//
+func SetPredictionVisibility(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
+
+	c := platform.NewContext(r)
+	desc := "Tournament set prediction visibility handler:"
+	extract := extract.NewContext(c, desc, r)
+
+	var tournament *mdl.Tournament
+	var err error
+
+	if tournament, err = extract.Tournament(); err != nil {
+		return err
+	}
+
+	visibility := r.FormValue("visibility")
+	if !mdl.IsValidPredictionVisibility(visibility) {
+		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodePredictionVisibilityNotSupported)}
+	}
+
+	tournament.PredictionVisibility = visibility
+	if err = tournament.Update(c); err != nil {
+		log.Errorf(c, "%s unable to update tournament %d: %v", desc, tournament.Id, err)
+		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeTournamentCannotUpdate)}
+	}
+
+	var tJSON mdl.TournamentJSON
+	fieldsToKeep := []string{"Id", "Name", "PredictionVisibility"}
+	helpers.InitPointerStructure(tournament, &tJSON, fieldsToKeep)
+
+	msg := fmt.Sprintf("The predictions of tournament %s are now visible: %s.", tournament.Name, visibility)
+	data := struct {
+		MessageInfo string `json:",omitempty"`
+		Tournament  mdl.TournamentJSON
+	}{
+		msg,
+		tJSON,
+	}
+	return templateshlp.RenderJSON(w, c, data)
+}
+
 // ActivatePhase handler let you  activate phase of tournament.
 //
 // Use this handler to activate all the matches of given phase in tournament.
-//	GET	/j/tournaments/[0-9]+/admin/activatephase/
+//	POST	/j/tournaments/[0-9]+/admin/activatephase/
 //
 func ActivatePhase(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 
-	if r.Method != "POST" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Tournament activate phase handler:"
 	extract := extract.NewContext(c, desc, r)
 
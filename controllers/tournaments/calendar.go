@@ -28,6 +28,7 @@ import (
 	"github.com/taironas/gonawin/extract"
 	"github.com/taironas/gonawin/helpers"
 	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/platform"
 	templateshlp "github.com/taironas/gonawin/helpers/templates"
 
 	mdl "github.com/taironas/gonawin/models"
@@ -63,6 +64,7 @@ type UserPredictionJSON struct {
 	Username string
 	Alias    string
 	Predict  string
+	Hidden   bool `json:",omitempty"` // the prediction of the player is not revealed yet.
 }
 
 // PhaseJSON is a variable to hold a the name of a phase and an array of days.
@@ -85,11 +87,7 @@ type PhaseJSON struct {
 // each of which would have an array of days who would have an array of matches.
 //
 func Calendar(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "GET" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Tournament Calendar Handler:"
 
 	extract := extract.NewContext(c, desc, r)
@@ -142,11 +140,7 @@ func Calendar(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 // by default the data returned is grouped by days.This means we will return an array of days, each of which can have an array of matches.
 // the 'groupby' parameter does not support 'phases' yet.
 func CalendarWithPrediction(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "GET" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Tournament Calendar with prediction Handler:"
 	extract := extract.NewContext(c, desc, r)
 
@@ -170,8 +164,8 @@ func CalendarWithPrediction(w http.ResponseWriter, r *http.Request, u *mdl.User)
 	predictsByPlayer := make([]mdl.Predicts, len(players))
 	for i, p := range players {
 		var predicts []*mdl.Predict
-		if predicts, err = mdl.PredictsByIds(c, p.PredictIds); err != nil {
-			log.Infof(c, "%v something failed when calling PredictsByIds for player %v : %v", desc, p.Id, err)
+		if predicts, err = p.Predicts(c); err != nil {
+			log.Infof(c, "%v something failed when calling Predicts for player %v : %v", desc, p.Id, err)
 			continue
 		}
 		predictsByPlayer[i] = predicts
@@ -207,31 +201,42 @@ func buildTournamentCalendarViewModel(c appengine.Context, t *mdl.Tournament, u
 
 	for i, day := range matchesByDay {
 		daysWithPredictions[i].Date = day.Date
-		matchesWithPredictions := matchesWithPredictions(day, players, predictsByPlayer)
+		matchesWithPredictions := matchesWithPredictions(t, day, u, players, predictsByPlayer)
 		daysWithPredictions[i].Matches = matchesWithPredictions
 	}
 	return tournamentCalendarViewModel{daysWithPredictions}
 }
 
-func matchesWithPredictions(day DayJSON, players []*mdl.User, predictsByPlayer []mdl.Predicts) []MatchWithPredictionJSON {
+func matchesWithPredictions(t *mdl.Tournament, day DayJSON, u *mdl.User, players []*mdl.User, predictsByPlayer []mdl.Predicts) []MatchWithPredictionJSON {
 
 	matchesWithPredictions := make([]MatchWithPredictionJSON, len(day.Matches))
 
 	for i, m := range day.Matches {
 		matchesWithPredictions[i].Match = m
-		participants := matchParticipants(m, players, predictsByPlayer)
+		participants := matchParticipants(t, m, u, players, predictsByPlayer)
 		matchesWithPredictions[i].Participants = participants
 	}
 	return matchesWithPredictions
 }
 
-func matchParticipants(m MatchJSON, players []*mdl.User, predictsByPlayer []mdl.Predicts) []UserPredictionJSON {
+// matchParticipants returns the predictions of the players on a match, as seen by the user u.
+// The predictions of the other players are not returned until the tournament reveals them,
+// nor before kickoff for the players hiding them.
+//
+func matchParticipants(t *mdl.Tournament, m MatchJSON, u *mdl.User, players []*mdl.User, predictsByPlayer []mdl.Predicts) []UserPredictionJSON {
+
+	revealed := t.RevealsPredictions(&mdl.Tmatch{Date: m.Date, Finished: m.Finished, CanPredict: m.CanPredict})
 
 	participants := make([]UserPredictionJSON, len(players))
 	for i, p := range players {
 		participants[i].Id = p.Id
 		participants[i].Username = p.Username
 		participants[i].Alias = p.Alias
+		if p.Id != u.Id && (!revealed || p.HidesPredictionFrom(u, m.Date)) {
+			participants[i].Predict = "-"
+			participants[i].Hidden = true
+			continue
+		}
 		prediction := "-"
 		if ok, index := predictsByPlayer[i].ContainsMatchID(m.Id); ok {
 			prediction = fmt.Sprintf("%v - %v", predictsByPlayer[i][index].Result1, predictsByPlayer[i][index].Result2)
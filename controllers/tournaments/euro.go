@@ -21,10 +21,9 @@ import (
 	"net/http"
 	"time"
 
-	"appengine"
-
 	"github.com/taironas/gonawin/helpers"
 	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/platform"
 	templateshlp "github.com/taironas/gonawin/helpers/templates"
 
 	mdl "github.com/taironas/gonawin/models"
@@ -34,11 +33,7 @@ import (
 //
 func NewEuro(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 
-	if r.Method != "POST" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "New Euro Handler:"
 
 	tournament, err := mdl.CreateEuro2016(c, u.Id)
@@ -54,11 +49,7 @@ func NewEuro(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 //
 func GetEuro(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 
-	if r.Method != "GET" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Get Euro Handler:"
 
 	tournaments := mdl.FindTournaments(c, "Name", "2016 UEFA Euro")
@@ -17,13 +17,10 @@
 package tournaments
 
 import (
-	"errors"
 	"net/http"
 
-	"appengine"
-
 	"github.com/taironas/gonawin/extract"
-	"github.com/taironas/gonawin/helpers"
+	"github.com/taironas/gonawin/helpers/platform"
 	templateshlp "github.com/taironas/gonawin/helpers/templates"
 
 	mdl "github.com/taironas/gonawin/models"
@@ -49,11 +46,7 @@ type TeamJSON struct {
 // Groups handelr sends the JSON tournament groups data.
 // use this handler to get groups of a tournament.
 func Groups(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "GET" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Tournament Group Handler:"
 	extract := extract.NewContext(c, desc, r)
 
@@ -0,0 +1,161 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package tournaments
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"appengine"
+
+	"github.com/taironas/gonawin/extract"
+	"github.com/taironas/gonawin/helpers"
+	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/platform"
+	templateshlp "github.com/taironas/gonawin/helpers/templates"
+
+	mdl "github.com/taironas/gonawin/models"
+	"github.com/taironas/gonawin/repository"
+)
+
+// LeaderboardPositionJSON is the JSON representation of the position of a user in a leaderboard.
+//
+type LeaderboardPositionJSON struct {
+	Rank     int64
+	UserId   int64
+	Username string
+	Alias    string
+	Score    int64
+}
+
+// Leaderboard is the Tournament leaderboard handler:
+// Use this handler to get a page of the precomputed leaderboard of a tournament,
+// or of a team in a tournament with the 'teamId' parameter.
+// Users with the same score share the same rank.
+// With the 'neighbours' parameter, the handler returns the positions around
+// the current user instead of a page.
+//	GET	/j/tournaments/[0-9]+/leaderboard?page=1&count=20
+//	GET	/j/tournaments/[0-9]+/leaderboard?teamId=[0-9]+&neighbours=5
+//
+// The response is an array of positions, the total number of users in the leaderboard
+// and the position of the current user if he is ranked.
+//
+func Leaderboard(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
+	c := platform.NewContext(r)
+	desc := "Tournament Leaderboard Handler:"
+
+	extract := extract.NewContext(c, desc, r)
+
+	var err error
+	var t *mdl.Tournament
+	if t, err = extract.Tournament(); err != nil {
+		return err
+	}
+
+	l := mdl.TournamentLeaderboard(t.Id)
+	if strTeamID := r.FormValue("teamId"); len(strTeamID) > 0 {
+		var teamID int64
+		if teamID, err = strconv.ParseInt(strTeamID, 0, 64); err != nil {
+			log.Errorf(c, "%s error when extracting team id: %v", desc, err)
+			return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeTeamNotFound)}
+		}
+		if ok, _ := t.ContainsTeamID(teamID); !ok {
+			return &helpers.NotFound{Err: errors.New(helpers.ErrorCodeTeamNotFound)}
+		}
+		l = mdl.TeamLeaderboard(teamID, t.Id)
+	}
+
+	var me *mdl.LeaderboardPosition
+	if me, err = l.Position(c, u.Id); err != nil && err != repository.ErrNoSuchEntity {
+		log.Errorf(c, "%s unable to get position of user %d: %v", desc, u.Id, err)
+		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeInternal)}
+	}
+
+	page := extract.Page()
+	count := extract.Count()
+
+	var positions []mdl.LeaderboardPosition
+	if strNeighbours := r.FormValue("neighbours"); len(strNeighbours) > 0 {
+		var n int64
+		if n, err = strconv.ParseInt(strNeighbours, 0, 64); err != nil || n < 0 {
+			return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
+		}
+		if me != nil {
+			if positions, err = l.Neighbours(c, u.Id, int(n)); err != nil {
+				log.Errorf(c, "%s unable to get neighbours of user %d: %v", desc, u.Id, err)
+				return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeInternal)}
+			}
+		}
+	} else if positions, err = l.Top(c, int(page), int(count)); err != nil {
+		log.Errorf(c, "%s unable to get leaderboard: %v", desc, err)
+		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeInternal)}
+	}
+
+	var total int
+	if total, err = l.Count(c); err != nil {
+		log.Errorf(c, "%s unable to count leaderboard: %v", desc, err)
+		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeInternal)}
+	}
+
+	positionsJSON := buildLeaderboardPositions(c, positions)
+
+	var meJSON *LeaderboardPositionJSON
+	if me != nil {
+		meJSON = &LeaderboardPositionJSON{me.Rank, u.Id, u.Username, u.Alias, me.Score}
+	}
+
+	data := struct {
+		Positions []LeaderboardPositionJSON
+		Total     int
+		Page      int64
+		Me        *LeaderboardPositionJSON `json:",omitempty"`
+	}{
+		positionsJSON,
+		total,
+		page,
+		meJSON,
+	}
+
+	return templateshlp.RenderJSON(w, c, data)
+}
+
+// buildLeaderboardPositions returns the JSON representation of leaderboard positions with the names of the users.
+func buildLeaderboardPositions(c appengine.Context, positions []mdl.LeaderboardPosition) []LeaderboardPositionJSON {
+	ids := make([]int64, len(positions))
+	for i, p := range positions {
+		ids[i] = p.UserId
+	}
+	users, err := mdl.UsersByIds(c, ids)
+	if err != nil {
+		log.Errorf(c, "buildLeaderboardPositions: unable to get users: %v", err)
+	}
+	byID := make(map[int64]*mdl.User, len(users))
+	for _, user := range users {
+		byID[user.Id] = user
+	}
+
+	positionsJSON := make([]LeaderboardPositionJSON, len(positions))
+	for i, p := range positions {
+		positionsJSON[i] = LeaderboardPositionJSON{Rank: p.Rank, UserId: p.UserId, Score: p.Score}
+		if user, ok := byID[p.UserId]; ok {
+			positionsJSON[i].Username = user.Username
+			positionsJSON[i].Alias = user.Alias
+		}
+	}
+	return positionsJSON
+}
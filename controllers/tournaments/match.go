@@ -29,6 +29,8 @@ import (
 	"github.com/taironas/gonawin/extract"
 	"github.com/taironas/gonawin/helpers"
 	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/memcache"
+	"github.com/taironas/gonawin/helpers/platform"
 	templateshlp "github.com/taironas/gonawin/helpers/templates"
 
 	mdl "github.com/taironas/gonawin/models"
@@ -60,11 +62,7 @@ type MatchJSON struct {
 // if filter is equal to 'second' you will get the matches of the second phase of the tournament.
 //
 func Matches(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "GET" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Tournament Matches Handler:"
 	extract := extract.NewContext(c, desc, r)
 
@@ -101,11 +99,7 @@ func Matches(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 // from parameter 'result' with format 'result1 result2' the match information is updated accordingly.
 //
 func UpdateMatchResult(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "POST" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Tournament Update Match Result Handler:"
 	extract := extract.NewContext(c, desc, r)
 
@@ -187,11 +181,7 @@ func UpdateMatchResult(w http.ResponseWriter, r *http.Request, u *mdl.User) erro
 // BlockMatchPrediction is the handler allowing to block the prediction for match of tournament.
 //
 func BlockMatchPrediction(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "POST" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Tournament block match prediction Handler:"
 	extract := extract.NewContext(c, desc, r)
 
@@ -244,25 +234,71 @@ func BlockMatchPrediction(w http.ResponseWriter, r *http.Request, u *mdl.User) e
 // From a tournament entity return an array of MatchJSON data structure.
 // second phase matches will have the specific rules in there team names
 func buildMatchesFromTournament(c appengine.Context, t *mdl.Tournament, u *mdl.User) []MatchJSON {
-	matchesJSON := buildFirstPhaseMatches(c, t, u)
-	matches2ndPhase := buildSecondPhaseMatches(c, t, u)
+	matchesJSON := cachedMatches(c, t, "first")
+	matches2ndPhase := cachedMatches(c, t, "second")
 	matchesJSON = append(matchesJSON, matches2ndPhase...)
 
-	return matchesJSON
+	return withPredicts(c, matchesJSON, u)
 }
 
 // From a tournament entity return an array of first phase MatchJSON data structure.
 func buildFirstPhaseMatches(c appengine.Context, t *mdl.Tournament, u *mdl.User) []MatchJSON {
-	desc := "buildFirstPhaseMatches"
+	return withPredicts(c, cachedMatches(c, t, "first"), u)
+}
+
+// From a tournament entity return an array of second phase MatchJSON data structure.
+func buildSecondPhaseMatches(c appengine.Context, t *mdl.Tournament, u *mdl.User) []MatchJSON {
+	return withPredicts(c, cachedMatches(c, t, "second"), u)
+}
+
+// cachedMatches returns the matches of a phase of a tournament, without predictions.
+// They are cached until the tournament or a match is updated.
+func cachedMatches(c appengine.Context, t *mdl.Tournament, phase string) []MatchJSON {
+	desc := "cachedMatches"
+
+	key := memcache.Key(c, "tournament-matches-"+phase, memcache.Namespace("Tournament", t.Id), memcache.KindNamespace("Tmatch"))
+	var matchesJSON []MatchJSON
+	if err := memcache.ReadThrough(c, key, mdl.CalendarCacheTTL, &matchesJSON, func() error {
+		if phase == "first" {
+			matchesJSON = firstPhaseMatches(c, t)
+		} else {
+			matchesJSON = secondPhaseMatches(c, t)
+		}
+		return nil
+	}); err != nil {
+		log.Errorf(c, "%s unable to get matches, %v", desc, err)
+	}
+	return matchesJSON
+}
+
+// withPredicts sets the predictions of the user on an array of MatchJSON data structure.
+func withPredicts(c appengine.Context, matchesJSON []MatchJSON, u *mdl.User) []MatchJSON {
+	desc := "withPredicts"
 
-	matches := mdl.Matches(c, t.Matches1stStage)
 	var predicts mdl.Predicts
 	var err error
-	if predicts, err = mdl.PredictsByIds(c, u.PredictIds); err != nil {
+	if predicts, err = u.Predicts(c); err != nil {
 		log.Errorf(c, "%s predictions not found, %v", desc, err)
 		return []MatchJSON{}
 	}
 
+	for i := range matchesJSON {
+		if hasMatch, j := predicts.ContainsMatchID(matchesJSON[i].Id); hasMatch == true {
+			matchesJSON[i].HasPredict = true
+			matchesJSON[i].Predict = fmt.Sprintf("%v - %v", predicts[j].Result1, predicts[j].Result2)
+		} else {
+			matchesJSON[i].HasPredict = false
+		}
+	}
+	return matchesJSON
+}
+
+// From a tournament entity return an array of first phase MatchJSON data structure, without predictions.
+func firstPhaseMatches(c appengine.Context, t *mdl.Tournament) []MatchJSON {
+	desc := "firstPhaseMatches"
+
+	matches := mdl.Matches(c, t.Matches1stStage)
+
 	var tb mdl.TournamentBuilder
 	if tb = mdl.GetTournamentBuilder(t); tb == nil {
 		log.Errorf(c, "%s tournament builder not found", desc)
@@ -288,29 +324,17 @@ func buildFirstPhaseMatches(c appengine.Context, t *mdl.Tournament, u *mdl.User)
 		matchesJSON[i].Finished = m.Finished
 		matchesJSON[i].Ready = m.Ready
 		matchesJSON[i].CanPredict = m.CanPredict
-		if hasMatch, j := predicts.ContainsMatchID(m.Id); hasMatch == true {
-			matchesJSON[i].HasPredict = true
-			matchesJSON[i].Predict = fmt.Sprintf("%v - %v", predicts[j].Result1, predicts[j].Result2)
-		} else {
-			matchesJSON[i].HasPredict = false
-		}
 	}
 
 	return matchesJSON
 }
 
-// From a tournament entity return an array of second phase MatchJSON data structure.
+// From a tournament entity return an array of second phase MatchJSON data structure, without predictions.
 // second phase matches will have the specific rules in there team names
-func buildSecondPhaseMatches(c appengine.Context, t *mdl.Tournament, u *mdl.User) []MatchJSON {
+func secondPhaseMatches(c appengine.Context, t *mdl.Tournament) []MatchJSON {
 
 	matches2ndPhase := mdl.Matches(c, t.Matches2ndStage)
 
-	var predicts mdl.Predicts
-	var err error
-	if predicts, err = mdl.PredictsByIds(c, u.PredictIds); err != nil {
-		return []MatchJSON{}
-	}
-
 	var tb mdl.TournamentBuilder
 	if tb = mdl.GetTournamentBuilder(t); tb == nil {
 		return []MatchJSON{}
@@ -360,13 +384,6 @@ func buildSecondPhaseMatches(c appengine.Context, t *mdl.Tournament, u *mdl.User
 		matchesJSON[i].Finished = m.Finished
 		matchesJSON[i].Ready = m.Ready
 		matchesJSON[i].CanPredict = m.CanPredict
-
-		if hasMatch, j := predicts.ContainsMatchID(m.Id); hasMatch == true {
-			matchesJSON[i].HasPredict = true
-			matchesJSON[i].Predict = fmt.Sprintf("%v - %v", predicts[j].Result1, predicts[j].Result2)
-		} else {
-			matchesJSON[i].HasPredict = false
-		}
 	}
 	return matchesJSON
 }
@@ -22,11 +22,10 @@ import (
 	"math/rand"
 	"net/http"
 
-	"appengine"
-
 	"github.com/taironas/gonawin/extract"
 	"github.com/taironas/gonawin/helpers"
 	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/platform"
 	templateshlp "github.com/taironas/gonawin/helpers/templates"
 	mdl "github.com/taironas/gonawin/models"
 )
@@ -35,10 +34,7 @@ import (
 //    POST /j/tournaments/[0-9]+/matches/simulate?phase=:phaseName
 //
 func SimulateMatches(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "POST" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Tournament Simulate Matches Handler:"
 	extract := extract.NewContext(c, desc, r)
 
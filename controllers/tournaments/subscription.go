@@ -22,11 +22,10 @@ import (
 	"net/http"
 	"time"
 
-	"appengine"
-
 	"github.com/taironas/gonawin/extract"
 	"github.com/taironas/gonawin/helpers"
 	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/platform"
 	templateshlp "github.com/taironas/gonawin/helpers/templates"
 
 	mdl "github.com/taironas/gonawin/models"
@@ -38,11 +37,7 @@ import (
 //
 func Join(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 
-	if r.Method != "POST" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Tournament Join Handler:"
 	extract := extract.NewContext(c, desc, r)
 
@@ -89,11 +84,7 @@ func Join(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 //	POST	j/tournaments/joinasteam/:tournamentId/:teamId	let a team join a tournament.
 //
 func JoinAsTeam(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "POST" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Tournament Join as a Team Handler:"
 	extract := extract.NewContext(c, desc, r)
 
@@ -151,11 +142,7 @@ func JoinAsTeam(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 // LeaveAsTeam makes the team leave the tournament.
 //
 func LeaveAsTeam(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "POST" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Tournament Leave as a Team Handler:"
 	extract := extract.NewContext(c, desc, r)
 
@@ -176,6 +163,7 @@ func LeaveAsTeam(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 		log.Errorf(c, "team not found: %v", desc, err)
 		return &helpers.NotFound{Err: errors.New(helpers.ErrorCodeTeamNotFound)}
 	}
+
 	// leave team
 	if err = tournament.TeamLeave(c, team); err != nil {
 		log.Errorf(c, "%s error when trying to leave team: %v", desc, err)
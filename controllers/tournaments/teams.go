@@ -20,11 +20,10 @@ import (
 	"errors"
 	"net/http"
 
-	"appengine"
-
 	"github.com/taironas/gonawin/extract"
 	"github.com/taironas/gonawin/helpers"
 	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/platform"
 	templateshlp "github.com/taironas/gonawin/helpers/templates"
 
 	mdl "github.com/taironas/gonawin/models"
@@ -51,11 +50,7 @@ type teamJSON struct {
 // The response is an array of teams group by phase.
 //
 func Teams(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "GET" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Tournament Teams Handler:"
 	extract := extract.NewContext(c, desc, r)
 
@@ -138,11 +133,7 @@ func teamContains(teams []teamJSON, name string) bool {
 // UpdateTeam is the Update team handler. replaces a team for the second phase of the tournament.
 //
 func UpdateTeam(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "POST" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Tournament Update Team handler:"
 	extract := extract.NewContext(c, desc, r)
 
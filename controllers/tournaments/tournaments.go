@@ -26,13 +26,12 @@ import (
 	"strconv"
 	"time"
 
-	"appengine"
-
 	"github.com/taironas/route"
 
 	"github.com/taironas/gonawin/extract"
 	"github.com/taironas/gonawin/helpers"
 	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/platform"
 	templateshlp "github.com/taironas/gonawin/helpers/templates"
 
 	mdl "github.com/taironas/gonawin/models"
@@ -46,39 +45,22 @@ type TournamentData struct {
 }
 
 // Index handler, use it to get the data of current tournaments.
+// Parameters:
+//   'cursor' the cursor of the page, returned as 'Next' by the previous page.
+//   'count' a int indicating the number of tournaments per page. default value is 25
+// Response: array of JSON formatted tournaments and the cursor of the next page.
+//
 func Index(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "GET" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "tournament index handler:"
+	extract := extract.NewContext(c, desc, r)
 
-	// get count parameter, if not present count is set to 25
-	strcount := r.FormValue("count")
-	count := int64(25)
-	if len(strcount) > 0 {
-		if n, err := strconv.ParseInt(strcount, 0, 64); err != nil {
-			log.Errorf(c, "%s: error during conversion of count parameter: %v", desc, err)
-		} else {
-			count = n
-		}
-	}
+	count := extract.CountOrDefault(25)
 
-	// get page parameter, if not present set page to the first one.
-	strpage := r.FormValue("page")
-	page := int64(1)
-	if len(strpage) > 0 {
-		if p, err := strconv.ParseInt(strpage, 0, 64); err != nil {
-			log.Errorf(c, "%s error during conversion of page parameter: %v", desc, err)
-			page = 1
-		} else {
-			page = p
-		}
-	}
-	tournaments := mdl.FindAllTournaments(c, count, page)
-	if len(tournaments) == 0 {
-		return templateshlp.RenderEmptyJSONArray(w, c)
+	tournaments, next, err := mdl.FindTournamentsByCursor(c, count, extract.Cursor())
+	if err != nil {
+		log.Errorf(c, "%s unable to get tournaments: %v", desc, err)
+		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeInvalidCursor)}
 	}
 
 	type tournament struct {
@@ -93,21 +75,26 @@ func Index(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 	for i, t := range tournaments {
 		ts[i].Id = t.Id
 		ts[i].Name = t.Name
-		ts[i].ParticipantsCount = len(t.UserIds)
+		ts[i].ParticipantsCount = int(t.CountParticipants())
 		ts[i].TeamsCount = len(t.TeamIds)
 		ts[i].Progress = t.Progress(c)
 		ts[i].ImageURL = helpers.TournamentImageURL(t.Name, t.Id)
 	}
 
-	return templateshlp.RenderJSON(w, c, ts)
+	data := struct {
+		Tournaments []tournament
+		Next        string
+	}{
+		ts,
+		next,
+	}
+
+	return templateshlp.RenderJSON(w, c, data)
 }
 
 // New handler, use it to create a new tournament.
 func New(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "POST" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Tournament New Handler:"
 
 	defer r.Body.Close()
@@ -161,11 +148,7 @@ func New(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 
 // Show handler, use it to get the data of a specific tournament.
 func Show(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "GET" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Tournament Show Handler:"
 	extract := extract.NewContext(c, desc, r)
 
@@ -179,9 +162,13 @@ func Show(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 	participants := tournament.Participants(c)
 	teams := tournament.Teams(c)
 
-	fieldsToKeep := []string{"Id", "Name", "Description", "AdminIds", "IsFirstStageComplete"}
+	fieldsToKeep := []string{"Id", "Name", "Description", "AdminIds", "IsFirstStageComplete", "PredictionVisibility"}
 	var TournamentJSON mdl.TournamentJSON
 	helpers.InitPointerStructure(tournament, &TournamentJSON, fieldsToKeep)
+	if len(tournament.PredictionVisibility) == 0 {
+		visibility := mdl.PredictionsAtKickoff
+		TournamentJSON.PredictionVisibility = &visibility
+	}
 
 	participantFieldsToKeep := []string{"Id", "Username", "Alias"}
 	participantsJSON := make([]mdl.UserJSON, len(participants))
@@ -230,11 +217,7 @@ func Show(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 // Destroy is the handler allowing to detroy a tournament.
 //
 func Destroy(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "POST" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Tournament Destroy Handler:"
 	extract := extract.NewContext(c, desc, r)
 
@@ -246,23 +229,6 @@ func Destroy(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 		return err
 	}
 
-	if !mdl.IsTournamentAdmin(c, tournament.Id, u.Id) {
-		log.Errorf(c, "%s user is not admin", desc)
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeTournamentDeleteForbiden)}
-	}
-
-	// delete all tournament-user relationships
-	for _, participant := range tournament.Participants(c) {
-		if err := participant.RemoveTournamentID(c, tournament.Id); err != nil {
-			log.Errorf(c, " %s error when trying to remove tournament id from user: %v", desc, err)
-		} else if u.Id == participant.Id {
-			// Be sure that current user has the latest data,
-			// as the u.Publish method will update again the user,
-			// we don't want to override the tournament Id removal.
-			u = participant
-		}
-	}
-
 	// delete all tournament-team relationships
 	for _, team := range tournament.Teams(c) {
 		if err := tournament.TeamLeave(c, team); err != nil {
@@ -285,7 +251,7 @@ func Destroy(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 		log.Errorf(c, "%s error when trying to destroy tournament's groups: %v", desc, err)
 	}
 
-	// delete the tournament
+	// delete the tournament and its tournament-user relationships
 	tournament.Destroy(c)
 
 	// publish new activity
@@ -305,11 +271,7 @@ func Destroy(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 // Update is the hanlder allowing to update a tournament.
 //
 func Update(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "POST" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Tournament Update handler:"
 	extract := extract.NewContext(c, desc, r)
 
@@ -321,11 +283,6 @@ func Update(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 		return err
 	}
 
-	if !mdl.IsTournamentAdmin(c, tournament.Id, u.Id) {
-		log.Errorf(c, "%s user is not admin", desc)
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeTournamentUpdateForbiden)}
-	}
-
 	// only work on name other values should not be editable
 	defer r.Body.Close()
 	body, err := ioutil.ReadAll(r.Body)
@@ -381,40 +338,44 @@ func Update(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 }
 
 // Search is the handler allowing to get all the tournaments that match the query.
+// You can pass a 'count' and a 'page' param to get a page of the results, default values are 20 and 1.
+// Results can be filtered with 'state' (upcoming, ongoing or finished) and 'official' (true for the
+// official tournaments only), and sorted with 'sort' (relevance, members or created).
+// The response holds the number of tournaments matching and the state and official facets.
 //
 func Search(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 
 	keywords := r.FormValue("q")
 
-	if r.Method != "GET" || len(keywords) == 0 {
+	if len(keywords) == 0 {
 		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
 	}
 
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Tournament Search handler:"
+	extract := extract.NewContext(c, desc, r)
 
-	words := helpers.SetOfStrings(keywords)
-	ids, err := mdl.GetTournamentInvertedIndexes(c, words)
-	if err != nil {
-		log.Errorf(c, "%s tournaments.Index, error occurred when getting indexes of words: %v", desc, err)
-		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeTournamentCannotSearch)}
+	opts := mdl.TournamentSearchOptions{
+		State:    r.FormValue("state"),
+		Official: r.FormValue("official") == "true",
+		Count:    extract.Count(),
+		Page:     extract.Page(),
+	}
+	switch opts.State {
+	case "", mdl.TournamentUpcoming, mdl.TournamentOngoing, mdl.TournamentFinished:
+	default:
+		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
 	}
 
-	result := mdl.TournamentScore(c, keywords, ids)
-
-	var tournaments []*mdl.Tournament
-	if tournaments, err = mdl.TournamentsByIds(c, result); err != nil {
-		log.Errorf(c, "%v something failed when calling TournamentsByIds: %v", desc, err)
+	var err error
+	if opts.Sort, err = extract.Sort(mdl.TournamentSearchSorts); err != nil {
+		return err
 	}
 
-	if len(tournaments) == 0 {
-		msg := fmt.Sprintf("Oops! Your search - %s - did not match any %s.", keywords, "tournament")
-		data := struct {
-			MessageInfo string `json:",omitempty"`
-		}{
-			msg,
-		}
-		return templateshlp.RenderJSON(w, c, data)
+	tournaments, total, facets, err := mdl.SearchTournaments(c, keywords, opts)
+	if err != nil {
+		log.Errorf(c, "%s tournaments.Index, error occurred when searching tournaments: %v", desc, err)
+		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeTournamentCannotSearch)}
 	}
 
 	type tournament struct {
@@ -429,7 +390,7 @@ func Search(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 	for i, t := range tournaments {
 		ts[i].Id = t.Id
 		ts[i].Name = t.Name
-		ts[i].ParticipantsCount = len(t.UserIds)
+		ts[i].ParticipantsCount = int(t.CountParticipants())
 		ts[i].TeamsCount = len(t.TeamIds)
 		ts[i].Progress = t.Progress(c)
 		ts[i].ImageURL = helpers.TournamentImageURL(t.Name, t.Id)
@@ -437,20 +398,28 @@ func Search(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 
 	// we should not directly return an array. so we add an extra layer.
 	data := struct {
+		MessageInfo string       `json:",omitempty"`
 		Tournaments []tournament `json:",omitempty"`
+		Total       int64
+		Count       int64
+		Page        int64
+		Facets      mdl.SearchFacets
 	}{
-		ts,
+		Tournaments: ts,
+		Total:       total,
+		Count:       opts.Count,
+		Page:        opts.Page,
+		Facets:      facets,
+	}
+	if total == 0 {
+		data.MessageInfo = fmt.Sprintf("Oops! Your search - %s - did not match any %s.", keywords, "tournament")
 	}
 	return templateshlp.RenderJSON(w, c, data)
 }
 
 // CandidateTeams handler, use it to get the list of teams that you can add to a tournament.
 func CandidateTeams(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "GET" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Tournament Candidate Teams handler:"
 	extract := extract.NewContext(c, desc, r)
 
@@ -463,7 +432,7 @@ func CandidateTeams(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 
 	// query teams
 	var teams []*mdl.Team
-	for _, teamID := range u.TeamIds {
+	for _, teamID := range u.TeamIDs(c) {
 		if team, err1 := mdl.TeamByID(c, teamID); err1 == nil {
 			for _, aID := range team.AdminIds {
 				if aID == u.Id {
@@ -502,13 +471,10 @@ func CandidateTeams(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 }
 
 // Participants handler, use it to get the participants to a tournament.
-// use this handler to get participants of a tournament.
+// use this handler to get participants of a tournament, with the 'count' and 'cursor' parameters.
+// The response holds the cursor of the next page in 'Next'.
 func Participants(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "GET" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Tournament Participants handler:"
 	extract := extract.NewContext(c, desc, r)
 
@@ -519,7 +485,12 @@ func Participants(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 		return err
 	}
 
-	participants := tournament.Participants(c)
+	var participants []*mdl.User
+	var next string
+	if participants, next, err = tournament.ParticipantsByCursor(c, extract.CountOrDefault(100), extract.Cursor()); err != nil {
+		log.Errorf(c, "%s unable to get participants: %v", desc, err)
+		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeInvalidCursor)}
+	}
 
 	participantFieldsToKeep := []string{"Id", "Username", "Alias"}
 	participantsJSON := make([]mdl.UserJSON, len(participants))
@@ -527,8 +498,10 @@ func Participants(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 
 	data := struct {
 		Participants []mdl.UserJSON
+		Next         string
 	}{
 		participantsJSON,
+		next,
 	}
 
 	return templateshlp.RenderJSON(w, c, data)
@@ -536,11 +509,7 @@ func Participants(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 
 // Reset handler, use it to reset points and goals of a tournament.
 func Reset(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "POST" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Tournament Reset handler:"
 	extract := extract.NewContext(c, desc, r)
 
@@ -572,11 +541,7 @@ func Reset(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 
 // Predict handler, use it to set the predictions of a match to the current user.
 func Predict(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "POST" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Tournament Predict Handler:"
 	extract := extract.NewContext(c, desc, r)
 
@@ -644,11 +609,6 @@ func Predict(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 			return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeCannotSetPrediction)}
 		}
 
-		// add p.Id to User predict table.
-		if err = u.AddPredictID(c, predict.Id); err != nil {
-			log.Errorf(c, "%s unable to add predict id in user entity: error: %v", desc, err)
-			return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeCannotSetPrediction)}
-		}
 		p = predict
 
 		msg = fmt.Sprintf("You set a prediction: %s %d:%d %s.", mapIDTeams[match.TeamId1], p.Result1, p.Result2, mapIDTeams[match.TeamId2])
@@ -21,10 +21,9 @@ import (
 	"net/http"
 	"time"
 
-	"appengine"
-
 	"github.com/taironas/gonawin/helpers"
 	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/platform"
 	templateshlp "github.com/taironas/gonawin/helpers/templates"
 
 	mdl "github.com/taironas/gonawin/models"
@@ -33,60 +32,54 @@ import (
 // NewWorldCup is the new world cup tournament handler.
 //
 func NewWorldCup(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "New World Cup Handler:"
 
-	if r.Method == "POST" {
-		tournament, err := mdl.CreateWorldCup(c, u.Id)
-		if err != nil {
-			log.Errorf(c, "%s error when trying to create a tournament: %v", desc, err)
-			return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeTournamentCannotCreate)}
-		}
-
-		return templateshlp.RenderJSON(w, c, tournament)
+	tournament, err := mdl.CreateWorldCup(c, u.Id)
+	if err != nil {
+		log.Errorf(c, "%s error when trying to create a tournament: %v", desc, err)
+		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeTournamentCannotCreate)}
 	}
-	return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
+
+	return templateshlp.RenderJSON(w, c, tournament)
 }
 
 // GetWorldCup is the get world cup tournament handler.
 //
 func GetWorldCup(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "Get World Cup Handler:"
 
-	if r.Method == "GET" {
-		tournaments := mdl.FindTournaments(c, "Name", "2014 FIFA World Cup")
-		if tournaments == nil {
-			log.Errorf(c, "%s World Cup tournament was not found.", desc)
-			return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeTournamentNotFound)}
-		}
-
-		tournament := tournaments[0]
+	tournaments := mdl.FindTournaments(c, "Name", "2014 FIFA World Cup")
+	if tournaments == nil {
+		log.Errorf(c, "%s World Cup tournament was not found.", desc)
+		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeTournamentNotFound)}
+	}
 
-		// tournament
-		fieldsToKeep := []string{"Id", "Name", "Description"}
-		var TournamentJSON mdl.TournamentJSON
-		helpers.InitPointerStructure(tournament, &TournamentJSON, fieldsToKeep)
-		// formatted start and end
-		const layout = "2 January 2006"
-		start := tournament.Start.Format(layout)
-		end := tournament.End.Format(layout)
-		// remaining days
-		remainingDays := int64(tournament.Start.Sub(time.Now()).Hours() / 24)
-		// data
-		data := struct {
-			Tournament    mdl.TournamentJSON
-			Start         string
-			End           string
-			RemainingDays int64
-		}{
-			TournamentJSON,
-			start,
-			end,
-			remainingDays,
-		}
+	tournament := tournaments[0]
 
-		return templateshlp.RenderJSON(w, c, data)
+	// tournament
+	fieldsToKeep := []string{"Id", "Name", "Description"}
+	var TournamentJSON mdl.TournamentJSON
+	helpers.InitPointerStructure(tournament, &TournamentJSON, fieldsToKeep)
+	// formatted start and end
+	const layout = "2 January 2006"
+	start := tournament.Start.Format(layout)
+	end := tournament.End.Format(layout)
+	// remaining days
+	remainingDays := int64(tournament.Start.Sub(time.Now()).Hours() / 24)
+	// data
+	data := struct {
+		Tournament    mdl.TournamentJSON
+		Start         string
+		End           string
+		RemainingDays int64
+	}{
+		TournamentJSON,
+		start,
+		end,
+		remainingDays,
 	}
-	return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
+
+	return templateshlp.RenderJSON(w, c, data)
 }
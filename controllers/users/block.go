@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package users
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/taironas/gonawin/extract"
+	"github.com/taironas/gonawin/helpers"
+	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/platform"
+	templateshlp "github.com/taironas/gonawin/helpers/templates"
+	mdl "github.com/taironas/gonawin/models"
+)
+
+// Block handler, use it to block a user.
+// A blocked user cannot invite the current user to a team nor see his profile.
+//
+//	POST	/j/users/block/:userId
+//
+func Block(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
+	c := platform.NewContext(r)
+	desc := "User block handler:"
+	extract := extract.NewContext(c, desc, r)
+
+	var user *mdl.User
+	var err error
+	if user, err = extract.User(); err != nil {
+		return err
+	}
+
+	if err = u.Block(c, user.Id); err != nil {
+		log.Errorf(c, "%s unable to block user %d: %v", desc, user.Id, err)
+		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeUserCannotBlock)}
+	}
+
+	vm := buildBlockViewModel(u, fmt.Sprintf("You blocked %s.", user.Username))
+	return templateshlp.RenderJSON(w, c, vm)
+}
+
+// Unblock handler, use it to unblock a user.
+//
+//	POST	/j/users/unblock/:userId
+//
+func Unblock(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
+	c := platform.NewContext(r)
+	desc := "User unblock handler:"
+	extract := extract.NewContext(c, desc, r)
+
+	var userID int64
+	var err error
+	if userID, err = extract.UserId(); err != nil {
+		return err
+	}
+
+	if err = u.Unblock(c, userID); err != nil {
+		log.Errorf(c, "%s unable to unblock user %d: %v", desc, userID, err)
+		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeUserCannotUnblock)}
+	}
+
+	vm := buildBlockViewModel(u, "The user was unblocked.")
+	return templateshlp.RenderJSON(w, c, vm)
+}
+
+type blockViewModel struct {
+	MessageInfo string `json:",omitempty"`
+	User        mdl.UserJSON
+}
+
+func buildBlockViewModel(u *mdl.User, msg string) blockViewModel {
+	var uJSON mdl.UserJSON
+	fieldsToKeep := []string{"Id", "Username", "BlockedIds"}
+	helpers.InitPointerStructure(u, &uJSON, fieldsToKeep)
+
+	return blockViewModel{msg, uJSON}
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+package users
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/taironas/gonawin/extract"
+	"github.com/taironas/gonawin/helpers"
+	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/platform"
+	templateshlp "github.com/taironas/gonawin/helpers/templates"
+
+	mdl "github.com/taironas/gonawin/models"
+	"github.com/taironas/gonawin/repository"
+)
+
+// Export handler, use it to download all the data linked to a user as a JSON archive:
+// profile, linked accounts, sessions, access tokens, teams, tournaments, predictions, scores,
+// activities, team requests, invitations and reports.
+//
+//	GET	/j/users/:userId/export
+//
+func Export(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
+	c := platform.NewContext(r)
+	desc := "User Export Handler:"
+	extract := extract.NewContext(c, desc, r)
+
+	user, err := extract.User()
+	if err != nil {
+		return err
+	}
+
+	data, err := mdl.ExportUserData(c, user)
+	if err != nil {
+		log.Errorf(c, "%s unable to export data of user %d: %v", desc, user.Id, err)
+		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeUserCannotExport)}
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"gonawin-%d.json\"", user.Id))
+	return templateshlp.RenderJSON(w, c, data)
+}
+
+// Deletion handler, use it to follow the deletion of a user.
+// The deletion can be followed by the user until his account is deleted, by the gonawin admins afterwards.
+//
+//	GET	/j/users/:userId/deletion
+//
+func Deletion(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
+	c := platform.NewContext(r)
+	desc := "User Deletion Handler:"
+	extract := extract.NewContext(c, desc, r)
+
+	userID, err := extract.UserId()
+	if err != nil {
+		return err
+	}
+
+	d, err := mdl.UserDeletionByUserID(c, userID)
+	if err == repository.ErrNoSuchEntity {
+		return &helpers.NotFound{Err: errors.New(helpers.ErrorCodeUserDeletionNotFound)}
+	} else if err != nil {
+		log.Errorf(c, "%s unable to get deletion of user %d: %v", desc, userID, err)
+		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeInternal)}
+	}
+
+	return templateshlp.RenderJSON(w, c, buildUserDeletionViewModel(d))
+}
+
+// userDeletionViewModel holds the JSON data of the deletion of a user.
+type userDeletionViewModel struct {
+	UserId    int64
+	State     string
+	Steps     []mdl.UserDeletionStep
+	Requested time.Time
+	Updated   time.Time
+	Completed *time.Time              `json:",omitempty"`
+	Remaining []mdl.UserDataReference `json:",omitempty"`
+}
+
+func buildUserDeletionViewModel(d *mdl.UserDeletion) userDeletionViewModel {
+	vm := userDeletionViewModel{
+		UserId:    d.UserId,
+		State:     d.State(),
+		Steps:     d.Steps,
+		Requested: d.Requested,
+		Updated:   d.Updated,
+		Remaining: d.Remaining,
+	}
+	if d.IsCompleted() {
+		vm.Completed = &d.Completed
+	}
+	return vm
+}
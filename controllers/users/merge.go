@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package users
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/taironas/gonawin/extract"
+	"github.com/taironas/gonawin/helpers"
+	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/platform"
+	templateshlp "github.com/taironas/gonawin/helpers/templates"
+
+	mdl "github.com/taironas/gonawin/models"
+)
+
+// Merge handler, use it to merge the account of a user into the account of another user.
+// The teams, tournaments, predictions, scores and linked accounts of the user are moved
+// to the other user and the user is deleted. Only gonawin admins can merge users.
+//
+//	POST	/j/users/merge/:userId?into=
+//
+func Merge(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
+	c := platform.NewContext(r)
+	desc := "User merge handler:"
+	extract := extract.NewContext(c, desc, r)
+
+	var from *mdl.User
+	var err error
+	if from, err = extract.User(); err != nil {
+		return err
+	}
+
+	var intoID int64
+	if intoID, err = strconv.ParseInt(r.FormValue("into"), 0, 64); err != nil {
+		log.Errorf(c, "%s error converting into id from string to int64, err:%v", desc, err)
+		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeUserNotFound)}
+	}
+
+	var into *mdl.User
+	if into, err = mdl.UserByID(c, intoID); err != nil {
+		log.Errorf(c, "%s user %d not found: %v", desc, intoID, err)
+		return &helpers.NotFound{Err: errors.New(helpers.ErrorCodeUserNotFound)}
+	}
+
+	if err = mdl.MergeUsers(c, from, into); err != nil {
+		log.Errorf(c, "%s unable to merge user %d into user %d: %v", desc, from.Id, into.Id, err)
+		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeUserCannotMerge)}
+	}
+
+	msg := fmt.Sprintf("The user %s was merged into the user %s.", from.Username, into.Username)
+	return templateshlp.RenderJSON(w, c, struct{ MessageInfo string }{msg})
+}
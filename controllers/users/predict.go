@@ -0,0 +1,63 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package users
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/taironas/gonawin/extract"
+	"github.com/taironas/gonawin/helpers"
+	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/platform"
+	templateshlp "github.com/taironas/gonawin/helpers/templates"
+	mdl "github.com/taironas/gonawin/models"
+)
+
+// Predicts handler, returns a page of the predictions of the requested user,
+// starting with the most recent ones.
+// Only the user and the gonawin administrators can see the predictions.
+// count parameter: default 25
+// cursor parameter: the page of predictions, returned as 'Next' by the previous page.
+//
+func Predicts(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
+	c := platform.NewContext(r)
+	desc := "User Predicts Handler:"
+	extract := extract.NewContext(c, desc, r)
+
+	var user *mdl.User
+	var err error
+	if user, err = extract.User(); err != nil {
+		return err
+	}
+
+	var predicts []*mdl.Predict
+	var next string
+	if predicts, next, err = user.PredictsByCursor(c, extract.CountOrDefault(25), extract.Cursor()); err != nil {
+		log.Errorf(c, "%s unable to get predictions: %v", desc, err)
+		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeInvalidCursor)}
+	}
+
+	vm := predictsUserViewModel{predicts, next}
+
+	return templateshlp.RenderJSON(w, c, vm)
+}
+
+type predictsUserViewModel struct {
+	Predicts []*mdl.Predict
+	Next     string
+}
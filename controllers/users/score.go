@@ -20,10 +20,9 @@ import (
 	"errors"
 	"net/http"
 
-	"appengine"
-
 	"github.com/taironas/gonawin/extract"
 	"github.com/taironas/gonawin/helpers"
+	"github.com/taironas/gonawin/helpers/platform"
 	templateshlp "github.com/taironas/gonawin/helpers/templates"
 	mdl "github.com/taironas/gonawin/models"
 )
@@ -31,11 +30,7 @@ import (
 // Score handler, returns the score data of the requested user.
 //
 func Score(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "GET" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	extract := extract.NewContext(c, "User Score Handler:", r)
 
 	var user *mdl.User
@@ -44,6 +39,10 @@ func Score(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 		return err
 	}
 
+	if !user.CanSeeProfile(c, u) {
+		return &helpers.Forbidden{Err: errors.New(helpers.ErrorCodeUserProfilePrivate)}
+	}
+
 	scores := user.TournamentsScores(c)
 
 	vm := buildScoreUserViewModel(scores)
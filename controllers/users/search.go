@@ -23,12 +23,22 @@ import (
 
 	"appengine"
 
+	"github.com/taironas/gonawin/extract"
 	"github.com/taironas/gonawin/helpers"
 	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/platform"
 	templateshlp "github.com/taironas/gonawin/helpers/templates"
 	mdl "github.com/taironas/gonawin/models"
 )
 
+type searchUsersViewModel struct {
+	MessageInfo string                `json:",omitempty"`
+	Users       []searchUserViewModel `json:",omitempty"`
+	Total       int64
+	Count       int64
+	Page        int64
+}
+
 type searchUserViewModel struct {
 	Id       int64 `json:"Id"`
 	Username string
@@ -39,40 +49,44 @@ type searchUserViewModel struct {
 
 // Search handler returns the result of a user search in a JSON format.
 // It uses parameter 'q' to make the query.
+// You can pass a 'count' and a 'page' param to get a page of the results, default values are 20 and 1,
+// and a 'sort' param (relevance or created).
 //
 //	GET	/j/user/search/			Search for all users respecting the query "q"
 //
 func Search(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 
 	keywords := r.FormValue("q")
-	if r.Method != "GET" || len(keywords) == 0 {
+	if len(keywords) == 0 {
 		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
 	}
 
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "User Search Handler:"
+	extract := extract.NewContext(c, desc, r)
 
-	words := helpers.SetOfStrings(keywords)
+	count := extract.Count()
+	page := extract.Page()
 
-	var ids []int64
-	var err error
-	if ids, err = mdl.GetUserInvertedIndexes(c, words); err != nil {
-		return unableToPerformSearch(c, w, desc, err)
+	sort, err := extract.Sort(mdl.UserSearchSorts)
+	if err != nil {
+		return err
 	}
 
-	result := mdl.UserScore(c, keywords, ids)
-
 	var users []*mdl.User
-	if users, err = mdl.UsersByIds(c, result); len(users) == 0 || err != nil {
-		return notFound(c, w, keywords)
+	var total int64
+	if users, total, err = mdl.SearchUsers(c, keywords, sort, count, page, u); err != nil {
+		return unableToPerformSearch(c, w, desc, err)
 	}
 
-	uvm := buildSearchUserViewModel(users)
-
-	data := struct {
-		Users []searchUserViewModel `json:",omitempty"`
-	}{
-		uvm,
+	data := searchUsersViewModel{
+		Users: buildSearchUserViewModel(users),
+		Total: total,
+		Count: count,
+		Page:  page,
+	}
+	if total == 0 {
+		data.MessageInfo = fmt.Sprintf("Oops! Your search - %s - did not match any %s.", keywords, "user")
 	}
 	return templateshlp.RenderJSON(w, c, data)
 }
@@ -89,16 +103,6 @@ func buildSearchUserViewModel(users []*mdl.User) []searchUserViewModel {
 	return uvm
 }
 
-func notFound(c appengine.Context, w http.ResponseWriter, keywords string) error {
-	msg := fmt.Sprintf("Oops! Your search - %s - did not match any %s.", keywords, "user")
-	data := struct {
-		MessageInfo string `json:",omitempty"`
-	}{
-		msg,
-	}
-	return templateshlp.RenderJSON(w, c, data)
-}
-
 func unableToPerformSearch(c appengine.Context, w http.ResponseWriter, desc string, err error) error {
 	log.Errorf(c, "%s users.Index, error occurred when getting indexes of words: %v", desc, err)
 	data := struct {
@@ -0,0 +1,86 @@
+package users
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/taironas/gonawin/helpers/memcache"
+	"github.com/taironas/gonawin/helpers/platform"
+	mdl "github.com/taironas/gonawin/models"
+	"github.com/taironas/gonawin/repository"
+)
+
+// TestSearchHiddenUsers tests that the users hidden from the search are neither returned nor counted,
+// except to themselves and to the gonawin admins.
+//
+func TestSearchHiddenUsers(t *testing.T) {
+	platform.UseStandalone(nil)
+	defer platform.UseStandalone(nil)
+	repository.Use(repository.NewMemory())
+	defer repository.Use(repository.Datastore)
+	memcache.Use(memcache.NewMemory())
+
+	c := repository.NewLocalContext(nil)
+
+	users := make(map[string]*mdl.User)
+	for _, name := range []string{"jon snow", "jon arryn", "sansa stark", "admin"} {
+		u, err := mdl.CreateUser(c, name+"@gonawin.com", name, name, "", name == "admin", "")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		users[name] = u
+	}
+	hidden := users["jon arryn"]
+	hidden.Privacy.HideFromSearch = true
+	if err := hidden.Update(c); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	tests := []struct {
+		title  string
+		viewer string
+		count  string
+		want   []int64
+		total  int64
+	}{
+		{title: "hidden users are not found", viewer: "sansa stark", want: []int64{users["jon snow"].Id}, total: 1},
+		{title: "hidden users are not counted in the pages", viewer: "sansa stark", count: "1", want: []int64{users["jon snow"].Id}, total: 1},
+		{title: "hidden users find themselves", viewer: "jon arryn", want: []int64{users["jon snow"].Id, hidden.Id}, total: 2},
+		{title: "admins find hidden users", viewer: "admin", want: []int64{users["jon snow"].Id, hidden.Id}, total: 2},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+
+		r := httptest.NewRequest("GET", "/j/users/search?q=jon&count="+test.count, nil)
+		w := httptest.NewRecorder()
+		if err := Search(w, r, users[test.viewer]); err != nil {
+			t.Fatalf("test %v - Error: %v", i, err)
+		}
+
+		var got searchUsersViewModel
+		if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+			t.Fatalf("test %v - Error: %v", i, err)
+		}
+		if got.Total != test.total {
+			t.Errorf("test %v - Error: want total %d, got %d", i, test.total, got.Total)
+		}
+		ids := make(map[int64]bool)
+		for _, u := range got.Users {
+			ids[u.Id] = true
+		}
+		for _, id := range test.want {
+			if !ids[id] {
+				t.Errorf("test %v - Error: want user %d in %+v", i, id, got.Users)
+			}
+		}
+		if len(got.Users) != len(test.want) {
+			t.Errorf("test %v - Error: want %d users, got %+v", i, len(test.want), got.Users)
+		}
+		if w.Code != http.StatusOK {
+			t.Errorf("test %v - Error: want status %d, got %d", i, http.StatusOK, w.Code)
+		}
+	}
+}
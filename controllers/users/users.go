@@ -24,13 +24,15 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strconv"
 
 	"appengine"
-	"appengine/taskqueue"
 
 	"github.com/taironas/gonawin/extract"
 	"github.com/taironas/gonawin/helpers"
 	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/platform"
+	"github.com/taironas/gonawin/helpers/taskqueue"
 	templateshlp "github.com/taironas/gonawin/helpers/templates"
 	mdl "github.com/taironas/gonawin/models"
 )
@@ -39,11 +41,7 @@ import (
 // current user.
 //
 func Index(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "GET" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 
 	users := mdl.FindAllUsers(c)
 
@@ -62,14 +60,12 @@ func buildIndexUsersViewModel(users []*mdl.User) []mdl.UserJSON {
 // Show User handler, use it to get the user JSON data.
 // including parameter: {teams, tournaments, teamrequests}
 // 'count' parameter: default 25
-// 'page' parameter: default 1
+// 'cursor' parameter: the page of teams, returned as 'TeamsNext' by the previous page.
+// Only the username and the alias are returned when the profile of the user is hidden
+// from the current user, see the privacy settings of the user.
 //
 func Show(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "GET" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	extract := extract.NewContext(c, "User show handler:", r)
 
 	var user *mdl.User
@@ -78,30 +74,50 @@ func Show(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 		return err
 	}
 
+	if user.HasBlocked(u.Id) && !u.IsAdmin {
+		return &helpers.Forbidden{Err: errors.New(helpers.ErrorCodeUserBlocked)}
+	}
+
 	log.Infof(c, "User: %v", user)
-	log.Infof(c, "User: %v", user.TeamIds)
+
+	if !user.CanSeeProfile(c, u) {
+		return templateshlp.RenderJSON(w, c, buildPrivateShowViewModel(user))
+	}
 
 	with := r.FormValue("including")
 	params := helpers.SetOfStrings(with)
 
-	teams := extractTeams(c, extract, user, params)
+	teams, teamsNext, err := extractTeams(c, extract, user, params)
+	if err != nil {
+		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeInvalidCursor)}
+	}
 	teamRequests := extractTeamRequests(c, teams, params)
 	tournaments := extractTournaments(c, user, params)
 	invitations := extractInvitations(c, user, params)
 
 	shvm := buildShowViewModel(c, user, teams, tournaments, teamRequests, invitations)
+	if user.Id == u.Id {
+		shvm.User.Privacy = &user.Privacy
+	}
+	shvm.TeamsNext = teamsNext
+	shvm.TeamsCount = len(user.TeamIDs(c))
+	shvm.TournamentsCount = len(user.TournamentIDs(c))
 
 	return templateshlp.RenderJSON(w, c, shvm)
 }
 
 type showViewModel struct {
-	User            mdl.UserJSON                   `json:",omitempty"`
-	Teams           []showTeamViewModel            `json:",omitempty"`
-	TeamRequests    []mdl.TeamRequestJSON          `json:",omitempty"`
-	Tournaments     []showTournamentViewModel      `json:",omitempty"`
-	TournamentStats []showTournamentStatsViewModel `json:",omitempty"`
-	Invitations     []mdl.TeamJSON                 `json:",omitempty"`
-	ImageURL        string                         `json:",omitempty"`
+	User             mdl.UserJSON        `json:",omitempty"`
+	Teams            []showTeamViewModel `json:",omitempty"`
+	TeamsNext        string              `json:",omitempty"`
+	TeamsCount       int
+	TournamentsCount int
+	TeamRequests     []mdl.TeamRequestJSON          `json:",omitempty"`
+	Tournaments      []showTournamentViewModel      `json:",omitempty"`
+	TournamentStats  []showTournamentStatsViewModel `json:",omitempty"`
+	Invitations      []mdl.TeamJSON                 `json:",omitempty"`
+	ImageURL         string                         `json:",omitempty"`
+	Private          bool                           `json:",omitempty"`
 }
 
 func buildShowViewModel(c appengine.Context, u *mdl.User, teams []*mdl.Team, tournaments []*mdl.Tournament, trs []*mdl.TeamRequest, invs []*mdl.Team) showViewModel {
@@ -119,30 +135,46 @@ func buildShowViewModel(c appengine.Context, u *mdl.User, teams []*mdl.Team, tou
 	return showViewModel{
 		uvm,
 		tvm,
+		"",
+		0,
+		0,
 		trsvm,
 		tourvm,
 		tsvm,
 		ivm,
 		imageURL,
+		false,
+	}
+}
+
+// buildPrivateShowViewModel returns the public part of a hidden profile.
+//
+func buildPrivateShowViewModel(u *mdl.User) showViewModel {
+	var uvm mdl.UserJSON
+	helpers.InitPointerStructure(u, &uvm, []string{"Id", "Username", "Alias"})
+
+	return showViewModel{
+		User:     uvm,
+		ImageURL: helpers.UserImageURL(u.Username, u.Id),
+		Private:  true,
 	}
 }
 
 func buildShowUserViewModel(user *mdl.User) (u mdl.UserJSON) {
-	fieldsToKeep := []string{"Id", "Username", "Name", "Alias", "Email", "Created", "IsAdmin", "Auth", "TeamIds", "TournamentIds", "Score"}
+	fieldsToKeep := []string{"Id", "Username", "Name", "Alias", "Email", "Created", "IsAdmin", "Score"}
 
 	helpers.InitPointerStructure(user, &u, fieldsToKeep)
 	return
 }
 
-func extractTeams(c appengine.Context, extract extract.Context, user *mdl.User, params []string) (teams []*mdl.Team) {
+func extractTeams(c appengine.Context, extract extract.Context, user *mdl.User, params []string) (teams []*mdl.Team, next string, err error) {
 
 	for _, param := range params {
 		if param != "teams" {
 			continue
 		}
 		count := extract.CountOrDefault(25)
-		page := extract.Page()
-		teams = user.TeamsByPage(c, count, page)
+		teams, next, err = user.TeamsByCursor(c, count, extract.Cursor())
 		break
 	}
 	return
@@ -220,7 +252,7 @@ func buildShowTournamentStatsViewModel(c appengine.Context, tournaments []*mdl.T
 	for i, t := range tournaments {
 		stats[i].Id = t.Id
 		stats[i].Name = t.Name
-		stats[i].ParticipantsCount = len(t.UserIds)
+		stats[i].ParticipantsCount = int(t.CountParticipants())
 		stats[i].TeamsCount = len(t.TeamIds)
 		stats[i].Progress = t.Progress(c)
 		stats[i].ImageURL = helpers.TournamentImageURL(t.Name, t.Id)
@@ -229,11 +261,11 @@ func buildShowTournamentStatsViewModel(c appengine.Context, tournaments []*mdl.T
 }
 
 type showTournamentViewModel struct {
-	Id       int64 `json:"Id"`
-	Name     string
-	UserIds  []int64
-	TeamIds  []int64
-	ImageURL string
+	Id                int64 `json:"Id"`
+	Name              string
+	ParticipantsCount int
+	TeamIds           []int64
+	ImageURL          string
 }
 
 func buildShowTournamentViewModel(tournaments []*mdl.Tournament) []showTournamentViewModel {
@@ -241,7 +273,7 @@ func buildShowTournamentViewModel(tournaments []*mdl.Tournament) []showTournamen
 	tournaments2 := make([]showTournamentViewModel, len(tournaments))
 	for i, t := range tournaments {
 		tournaments2[i].Id = t.Id
-		tournaments2[i].UserIds = t.UserIds
+		tournaments2[i].ParticipantsCount = int(t.CountParticipants())
 		tournaments2[i].TeamIds = t.TeamIds
 		tournaments2[i].ImageURL = helpers.TournamentImageURL(t.Name, t.Id)
 	}
@@ -271,31 +303,19 @@ type userData struct {
 		Name     string
 		Alias    string
 		Email    string
+		Privacy  *mdl.UserPrivacy
 	}
 }
 
 // Update user handler, use this handler to update a user entity.
+// The privacy settings are replaced by the 'Privacy' field when it is present.
 //
 func Update(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "POST" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "User update handler:"
-	extract := extract.NewContext(c, desc, r)
-
-	var userID int64
-	var err error
-
-	if userID, err = extract.UserId(); err != nil {
-		return err
-	} else if userID != u.Id {
-		log.Errorf(c, "%s error user ids do not match. url id:%s user id: %s", desc, userID, u.Id)
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeUserCannotUpdate)}
-	}
 
 	var updatedData *userData
+	var err error
 	if updatedData, err = userDataFromHTTPRequest(c, desc, r); err != nil {
 		return err
 	}
@@ -311,6 +331,14 @@ func Update(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 		update = true
 	}
 
+	if p := updatedData.User.Privacy; p != nil && *p != u.Privacy {
+		if len(p.Profile) > 0 && !mdl.IsValidProfileVisibility(p.Profile) {
+			return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeUserPrivacyNotValid)}
+		}
+		u.Privacy = *p
+		update = true
+	}
+
 	if !update {
 		return nothingToUpdate(c, w)
 	}
@@ -331,7 +359,7 @@ type updateViewModel struct {
 
 func buildUpdateViewModel(u *mdl.User) updateViewModel {
 
-	fieldsToKeep := []string{"Id", "Username", "Name", "Alias", "Email"}
+	fieldsToKeep := []string{"Id", "Username", "Name", "Alias", "Email", "Privacy"}
 	var uJSON mdl.UserJSON
 	helpers.InitPointerStructure(u, &uJSON, fieldsToKeep)
 
@@ -379,14 +407,12 @@ func nothingToUpdate(c appengine.Context, w http.ResponseWriter) error {
 }
 
 // Destroy hander, use this to remove a user from gonawin.
+// All the data of the user is deleted by a task, the progress of the deletion is returned by the Deletion handler.
+// A user cannot be deleted while he is the last owner of a team or the only admin of a tournament.
 //	POST	/j/user/destroy/[0-9]+/		Destroys the user with the given id.
 //
 func Destroy(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "POST" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "User Destroy Handler:"
 	extract := extract.NewContext(c, desc, r)
 
@@ -396,112 +422,53 @@ func Destroy(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 		return err
 	}
 
-	if err = removeTeamUserRels(c, desc, user, u); err != nil {
-		return err
-	}
-	if err = removeTournameUserRels(c, desc, user, u); err != nil {
-		return err
+	var d *mdl.UserDeletion
+	switch d, err = mdl.StartUserDeletion(c, user); err {
+	case nil:
+	case mdl.ErrUserLastTeamOwner:
+		return &helpers.Forbidden{Err: errors.New(helpers.ErrorCodeUserIsTeamAdminCannotDelete)}
+	case mdl.ErrUserLastTournamentAdmin:
+		return &helpers.Forbidden{Err: errors.New(helpers.ErrorCodeUserIsTournamentAdminCannotDelete)}
+	default:
+		log.Errorf(c, "%s unable to start deletion of user %d: %v", desc, user.Id, err)
+		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeUserCannotDelete)}
 	}
 
-	sendTaskDeleteUserPredictions(c, desc, u)
-
-	user.Destroy(c)
+	if err = sendTaskDeleteUser(c, user.Id); err != nil {
+		log.Errorf(c, "%s unable to add task to taskqueue: %v", desc, err)
+		return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeUserCannotDelete)}
+	}
 
-	dvm := buildDestroyUserViewModel(user)
+	dvm := buildDestroyUserViewModel(user, d)
 	return templateshlp.RenderJSON(w, c, dvm)
 }
 
 type destroyUserViewModel struct {
 	MessageInfo string `json:",omitempty"`
+	Deletion    userDeletionViewModel
 }
 
-func buildDestroyUserViewModel(user *mdl.User) destroyUserViewModel {
-	msg := fmt.Sprintf("The user %s was correctly deleted!", user.Username)
-	return destroyUserViewModel{msg}
-}
-
-// removeTeamUserRels remove all team - user relationships.
-//
-func removeTeamUserRels(c appengine.Context, desc string, requestUser, currentUser *mdl.User) error {
-	var err error
-	for _, teamID := range requestUser.TeamIds {
-		if mdl.IsTeamAdmin(c, teamID, currentUser.Id) {
-			var team *mdl.Team
-			if team, err = mdl.TeamByID(c, teamID); err != nil {
-				log.Errorf(c, "%s team %d not found", desc, teamID)
-				return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeTeamNotFound)}
-			}
-			if err = team.RemoveAdmin(c, requestUser.Id); err != nil {
-				log.Infof(c, "%s error occurred during admin deletion: %v", desc, err)
-				return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeUserIsTeamAdminCannotDelete)}
-			}
-		} else {
-			if err = requestUser.RemoveTeamID(c, teamID); err != nil {
-				log.Errorf(c, "%s error when trying to destroy team relationship: %v", desc, err)
-			}
-		}
-	}
-	return nil
-}
-
-// removeTournameUserRels deletes all tournament-user relationships.
-//
-func removeTournameUserRels(c appengine.Context, desc string, requestUser, currentUser *mdl.User) error {
-
-	var err error
-	for _, tournamentId := range requestUser.TournamentIds {
-		if mdl.IsTournamentAdmin(c, tournamentId, currentUser.Id) {
-			var tournament *mdl.Tournament
-			if tournament, err = mdl.TournamentByID(c, tournamentId); err != nil {
-				log.Errorf(c, "%s tournament %d not found", desc, tournamentId)
-				return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeTournamentNotFound)}
-			}
-			if err = tournament.RemoveAdmin(c, requestUser.Id); err != nil {
-				log.Infof(c, "%s error occurred during admin deletion: %v", desc, err)
-				return &helpers.InternalServerError{Err: errors.New(helpers.ErrorCodeUserIsTournamentAdminCannotDelete)}
-			}
-		} else {
-			if err := requestUser.RemoveTournamentID(c, tournamentId); err != nil {
-				log.Errorf(c, "%s error when trying to destroy tournament relationship: %v", desc, err)
-			}
-		}
-	}
-	return nil
+func buildDestroyUserViewModel(user *mdl.User, d *mdl.UserDeletion) destroyUserViewModel {
+	msg := fmt.Sprintf("The deletion of the user %s has started.", user.Username)
+	return destroyUserViewModel{msg, buildUserDeletionViewModel(d)}
 }
 
-// sendTaskDeleteUserPredictions sends a task to delete predicts of the user.
+// sendTaskDeleteUser sends a task to delete the data of the user.
 //
-func sendTaskDeleteUserPredictions(c appengine.Context, desc string, u *mdl.User) {
-
-	log.Infof(c, "%s Sending to taskqueue: delete predicts", desc)
-
-	var predictsIds []byte
-	var err error
-	if predictsIds, err = json.Marshal(u.PredictIds); err != nil {
-		log.Errorf(c, "%s Error marshaling %v", desc, err)
-	}
-
-	task := taskqueue.NewPOSTTask("/a/publish/users/deletepredicts/", url.Values{
-		"predict_ids": []string{string(predictsIds)},
+func sendTaskDeleteUser(c appengine.Context, userID int64) error {
+	task := taskqueue.NewPOSTTask("/a/delete/users/", url.Values{
+		"userId": []string{strconv.FormatInt(userID, 10)},
 	})
-
-	if _, err = taskqueue.Add(c, task, ""); err != nil {
-		log.Errorf(c, "%s unable to add task to taskqueue. %v", desc, err)
-	} else {
-		log.Infof(c, "%s add task to taskqueue successfully", desc)
-	}
+	_, err := taskqueue.Add(c, task, "")
+	return err
 }
 
 // Teams handler, use this to retrieve the teams of the current user.
-// count parameter: default 12
-// page parameter: default 1
+// count parameter: default 25
+// cursor parameter: the page of teams, returned as 'Next' by the previous page.
 //
 func Teams(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "GET" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "User joined teams handler:"
 	extract := extract.NewContext(c, desc, r)
 
@@ -511,38 +478,43 @@ func Teams(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 		return err
 	}
 
+	if !user.CanSeeProfile(c, u) {
+		return &helpers.Forbidden{Err: errors.New(helpers.ErrorCodeUserProfilePrivate)}
+	}
+
 	count := extract.CountOrDefault(25)
-	page := extract.Page()
 
 	var teams []*mdl.Team
-	teams = user.TeamsByPage(c, count, page)
+	var next string
+	if teams, next, err = user.TeamsByCursor(c, count, extract.Cursor()); err != nil {
+		log.Errorf(c, "%s unable to get teams: %v", desc, err)
+		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeInvalidCursor)}
+	}
 
-	tvm := buildTeamsUserViewModel(teams)
+	tvm := buildTeamsUserViewModel(teams, next)
 	return templateshlp.RenderJSON(w, c, tvm)
 }
 
 type teamsUserViewModel struct {
 	Teams []mdl.TeamJSON `json:",omitempty"`
+	Next  string
 }
 
-func buildTeamsUserViewModel(teams []*mdl.Team) teamsUserViewModel {
+func buildTeamsUserViewModel(teams []*mdl.Team, next string) teamsUserViewModel {
 	teamsFieldsToKeep := []string{"Id", "Name"}
 	teamsJSON := make([]mdl.TeamJSON, len(teams))
 	helpers.TransformFromArrayOfPointers(&teams, &teamsJSON, teamsFieldsToKeep)
 
-	return teamsUserViewModel{teamsJSON}
+	return teamsUserViewModel{teamsJSON, next}
 }
 
 // Tournaments user handler, use this to retrieve the JSON data of the tournaments of the user.
 // count parameter: default 25
-// page parameter: default 1
+// cursor parameter: the page of tournaments, returned as 'Next' by the previous page.
 func Tournaments(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "GET" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
-	extract := extract.NewContext(c, "User joined tournaments handler", r)
+	c := platform.NewContext(r)
+	desc := "User joined tournaments handler"
+	extract := extract.NewContext(c, desc, r)
 
 	var user *mdl.User
 	var err error
@@ -550,37 +522,42 @@ func Tournaments(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 		return err
 	}
 
+	if !user.CanSeeProfile(c, u) {
+		return &helpers.Forbidden{Err: errors.New(helpers.ErrorCodeUserProfilePrivate)}
+	}
+
 	count := extract.CountOrDefault(25)
-	page := extract.Page()
 
-	tournaments := user.TournamentsByPage(c, count, page)
+	var tournaments []*mdl.Tournament
+	var next string
+	if tournaments, next, err = user.TournamentsByCursor(c, count, extract.Cursor()); err != nil {
+		log.Errorf(c, "%s unable to get tournaments: %v", desc, err)
+		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeInvalidCursor)}
+	}
 
-	tvm := buildTournamentsUserViewModel(tournaments)
+	tvm := buildTournamentsUserViewModel(tournaments, next)
 
 	return templateshlp.RenderJSON(w, c, tvm)
 }
 
 type tournamentsUserViewModel struct {
 	Tournaments []mdl.TournamentJSON `json:",omitempty"`
+	Next        string
 }
 
-func buildTournamentsUserViewModel(tournaments []*mdl.Tournament) tournamentsUserViewModel {
+func buildTournamentsUserViewModel(tournaments []*mdl.Tournament, next string) tournamentsUserViewModel {
 	fieldsToKeep := []string{"Id", "Name"}
 	json := make([]mdl.TournamentJSON, len(tournaments))
 	helpers.TransformFromArrayOfPointers(&tournaments, &json, fieldsToKeep)
 
-	return tournamentsUserViewModel{json}
+	return tournamentsUserViewModel{json, next}
 }
 
 // AllowInvitation handler, use it to allow an invitation to a team.
 //
 func AllowInvitation(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
 
-	if r.Method != "POST" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "User allow invitation handler:"
 	extract := extract.NewContext(c, desc, r)
 
@@ -590,6 +567,10 @@ func AllowInvitation(w http.ResponseWriter, r *http.Request, u *mdl.User) error
 		return err
 	}
 
+	if team.IsBanned(u.Id) {
+		return &helpers.Forbidden{Err: errors.New(helpers.ErrorCodeTeamBanned)}
+	}
+
 	// find user request
 	var ur *mdl.UserRequest
 	if ur = mdl.FindUserRequestByTeamAndUser(c, team.Id, u.Id); ur == nil {
@@ -638,11 +619,7 @@ func buildAllowInvitationUserViewModel(team *mdl.Team) allowInvitationUserViewMo
 // DenyInvitation handler, use it to deny an invitation to a team.
 //
 func DenyInvitation(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
-	if r.Method != "POST" {
-		return &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
-	}
-
-	c := appengine.NewContext(r)
+	c := platform.NewContext(r)
 	desc := "User deny invitation handler:"
 	extract := extract.NewContext(c, desc, r)
 
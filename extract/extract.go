@@ -151,6 +151,167 @@ func (c Context) TeamRequest() (*mdl.TeamRequest, error) {
 	return teamRequest, nil
 }
 
+// ChallengeID returns a int64 challengeId from the HTTP request.
+//
+func (c Context) ChallengeID() (int64, error) {
+
+	strChallengeID, err := route.Context.Get(c.r, "challengeId")
+	if err != nil {
+		log.Errorf(c.c, "%s error getting challenge id, err:%v", c.desc, err)
+		return 0, &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeChallengeNotFound)}
+	}
+
+	var challengeID int64
+	challengeID, err = strconv.ParseInt(strChallengeID, 0, 64)
+	if err != nil {
+		log.Errorf(c.c, "%s error converting challenge id from string to int64, err:%v", c.desc, err)
+		return 0, &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeChallengeNotFound)}
+	}
+	return challengeID, nil
+}
+
+// Challenge returns a challenge between two teams from an HTTP request.
+//
+func (c Context) Challenge() (*mdl.Challenge, error) {
+
+	challengeID, err := c.ChallengeID()
+	if err != nil {
+		return nil, err
+	}
+
+	var challenge *mdl.Challenge
+	if challenge, err = mdl.ChallengeByID(c.c, challengeID); err != nil {
+		log.Errorf(c.c, "%s challenge not found: %v", c.desc, err)
+		return nil, &helpers.NotFound{Err: errors.New(helpers.ErrorCodeChallengeNotFound)}
+	}
+	return challenge, nil
+}
+
+// TeamRole returns a team role from the HTTP request.
+//
+func (c Context) TeamRole() (string, error) {
+
+	role, err := route.Context.Get(c.r, "role")
+	if err != nil {
+		log.Errorf(c.c, "%s error getting role, err:%v", c.desc, err)
+		return "", &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeTeamRoleNotSupported)}
+	}
+
+	if !mdl.IsValidTeamRole(role) {
+		log.Errorf(c.c, "%s role %s is not supported", c.desc, role)
+		return "", &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeTeamRoleNotSupported)}
+	}
+	return role, nil
+}
+
+// ReportID returns a int64 reportId from the HTTP request.
+//
+func (c Context) ReportID() (int64, error) {
+
+	strReportID, err := route.Context.Get(c.r, "reportId")
+	if err != nil {
+		log.Errorf(c.c, "%s error getting report id, err:%v", c.desc, err)
+		return 0, &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeReportNotFound)}
+	}
+
+	var reportID int64
+	reportID, err = strconv.ParseInt(strReportID, 0, 64)
+	if err != nil {
+		log.Errorf(c.c, "%s error converting report id from string to int64, err:%v", c.desc, err)
+		return 0, &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeReportNotFound)}
+	}
+	return reportID, nil
+}
+
+// Report returns a report from an HTTP request.
+//
+func (c Context) Report() (*mdl.Report, error) {
+
+	reportID, err := c.ReportID()
+	if err != nil {
+		return nil, err
+	}
+
+	var report *mdl.Report
+	if report, err = mdl.ReportByID(c.c, reportID); err != nil {
+		log.Errorf(c.c, "%s report not found: %v", c.desc, err)
+		return nil, &helpers.NotFound{Err: errors.New(helpers.ErrorCodeReportNotFound)}
+	}
+	return report, nil
+}
+
+// SessionID returns a int64 sessionId from the HTTP request.
+//
+func (c Context) SessionID() (int64, error) {
+
+	strSessionID, err := route.Context.Get(c.r, "sessionId")
+	if err != nil {
+		log.Errorf(c.c, "%s error getting session id, err:%v", c.desc, err)
+		return 0, &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeSessionNotFound)}
+	}
+
+	var sessionID int64
+	sessionID, err = strconv.ParseInt(strSessionID, 0, 64)
+	if err != nil {
+		log.Errorf(c.c, "%s error converting session id from string to int64, err:%v", c.desc, err)
+		return 0, &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeSessionNotFound)}
+	}
+	return sessionID, nil
+}
+
+// Session returns a session of a user from an HTTP request.
+//
+func (c Context) Session(userID int64) (*mdl.Session, error) {
+
+	sessionID, err := c.SessionID()
+	if err != nil {
+		return nil, err
+	}
+
+	var session *mdl.Session
+	if session, err = mdl.UserSessionByID(c.c, userID, sessionID); err != nil {
+		log.Errorf(c.c, "%s session not found: %v", c.desc, err)
+		return nil, &helpers.NotFound{Err: errors.New(helpers.ErrorCodeSessionNotFound)}
+	}
+	return session, nil
+}
+
+// AccessTokenID returns a int64 tokenId from the HTTP request.
+//
+func (c Context) AccessTokenID() (int64, error) {
+
+	strTokenID, err := route.Context.Get(c.r, "tokenId")
+	if err != nil {
+		log.Errorf(c.c, "%s error getting access token id, err:%v", c.desc, err)
+		return 0, &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeAccessTokenNotFound)}
+	}
+
+	var tokenID int64
+	tokenID, err = strconv.ParseInt(strTokenID, 0, 64)
+	if err != nil {
+		log.Errorf(c.c, "%s error converting access token id from string to int64, err:%v", c.desc, err)
+		return 0, &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeAccessTokenNotFound)}
+	}
+	return tokenID, nil
+}
+
+// AccessToken returns a personal access token of a user from an HTTP request.
+//
+func (c Context) AccessToken(userID int64) (*mdl.AccessToken, error) {
+
+	tokenID, err := c.AccessTokenID()
+	if err != nil {
+		return nil, err
+	}
+
+	var token *mdl.AccessToken
+	if token, err = mdl.UserAccessTokenByID(c.c, userID, tokenID); err != nil {
+		log.Errorf(c.c, "%s access token not found: %v", c.desc, err)
+		return nil, &helpers.NotFound{Err: errors.New(helpers.ErrorCodeAccessTokenNotFound)}
+	}
+	return token, nil
+}
+
 // TournamentId returns the Id of the tournament that the request holds.
 //
 func (c Context) TournamentId() (int64, error) {
@@ -264,3 +425,27 @@ func (c Context) Page() int64 {
 	}
 	return page
 }
+
+// Cursor extracts the 'cursor' value from the given http.Request
+// returns an empty cursor, the first page, if none is found.
+//
+func (c Context) Cursor() string {
+	return c.r.FormValue("cursor")
+}
+
+// Sort extracts the 'sort' value from the given http.Request
+// returns the first option if none is found.
+//
+func (c Context) Sort(options []string) (string, error) {
+
+	sort := c.r.FormValue("sort")
+	if len(sort) == 0 {
+		return options[0], nil
+	}
+
+	if !helpers.SliceContains(options, sort) {
+		log.Errorf(c.c, "%s sort parameter %s is not supported", c.desc, sort)
+		return "", &helpers.BadRequest{Err: errors.New(helpers.ErrorCodeNotSupported)}
+	}
+	return sort, nil
+}
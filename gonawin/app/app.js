@@ -10,6 +10,7 @@ angular.module('gonawingApp', [
   'directive.twittersignin',
   'directive.googlesignin',
   'directive.facebooksignin',
+  'directive.openidconnectsignin',
   'directive.formValidation',
   'directive.formFocus',
   'directive.joinButton',
@@ -144,6 +145,8 @@ angular.module('gonawingApp').run(['$rootScope', '$location', '$window', '$cooki
       sAuth.signinWithTwitter(($location.search()).oauth_token, ($location.search()).oauth_verifier);
     } else if($location.$$path === '/auth/google/callback') {
       sAuth.signinWithGoogle(($location.search()).auth_token);
+    } else if($location.$$path === '/auth/oidc/callback') {
+      sAuth.signinWithOpenIDConnect(($location.search()).provider, ($location.search()).code, ($location.search()).state);
     } else {
       // Everytime the route in our app changes check authentication status.
       // Get current user only if we are logged in.
@@ -177,7 +180,7 @@ angular.module('gonawingApp').run(['$rootScope', '$location', '$window', '$cooki
         email:userInfo.emails[0].value } );
       $rootScope.currentUser.$promise.then(function(currentUser){
         console.log('event:google-plus-signin-success: current user = ', currentUser);
-        sAuth.storeCookies(authResult.access_token, currentUser.User.Auth, currentUser.User.Id);
+        sAuth.storeCookies(authResult.access_token, currentUser.Token, currentUser.User.Id);
         $cookieStore.put('provider', 'google_plus');
         $rootScope.isLoggedIn = true;
         $location.path('/');
@@ -4,15 +4,16 @@ var activitiesControllers = angular.module('activitiesControllers', []);
 
 activitiesControllers.controller('ActivitiesCtrl', ['$scope', '$location', 'Activity', function($scope, $location, Activity) {
   console.log("activities controller");
-  // Fetch activities based on the count and page variables.
+  // Fetch activities based on the count and cursor variables.
   // Concatenate new activities when more button is clicked.
   $scope.loadActivities = function()
   {
-    Activity.get({ count:$scope.count, page:$scope.page}).$promise.then(function(response){
+    Activity.get({ count:$scope.count, cursor:$scope.cursor}).$promise.then(function(response){
       if (response.Status == "OK") {
         $scope.activities = $scope.activities.concat(response.Results.Activities);
 
-        $scope.more = response.Results.CurrentPage == response.Results.LastPage;
+        $scope.cursor = response.Results.Next;
+        $scope.more = response.Results.Next !== "";
       }
       else {
         $scope.messageDanger = response.Status;
@@ -25,12 +26,11 @@ activitiesControllers.controller('ActivitiesCtrl', ['$scope', '$location', 'Acti
   };
   // Triggers the loading of new activities
   $scope.showMore = function() {
-    $scope.page += 1;
     $scope.loadActivities();
   };
 
   $scope.count = 20;  // number of activities per page
-  $scope.page = 1;    // current page
+  $scope.cursor = ""; // cursor of the next page
   $scope.activities = [];
   $scope.more = true;
   $scope.loadActivities();
@@ -1,7 +1,7 @@
 'use strict'
 var authService = angular.module('authService', ['ngResource']);
 
-authService.factory('sAuth', function($rootScope, $cookieStore, $cookies, $location, $q, $timeout, User, Session) {
+authService.factory('sAuth', function($rootScope, $http, $cookieStore, $cookies, $location, $q, $timeout, User, Session) {
   return {
     /* returns true when user is logged in based on cookies */
     isLoggedIn: function() {
@@ -38,7 +38,7 @@ authService.factory('sAuth', function($rootScope, $cookieStore, $cookies, $locat
           email:userInfo.email } );
         $rootScope.currentUser.$promise.then(function(currentUser){
           console.log('authServices.getFBUserInfo: current user = ', currentUser);
-          _self.storeCookies(accessToken, currentUser.User.Auth, currentUser.User.Id);
+          _self.storeCookies(accessToken, currentUser.Token, currentUser.User.Id);
           $cookieStore.put('provider', 'facebook');
           $rootScope.isLoggedIn = true;
           $location.path('/');
@@ -50,6 +50,7 @@ authService.factory('sAuth', function($rootScope, $cookieStore, $cookies, $locat
     storeCookies: function(accessToken, auth, userId) {
       $cookieStore.put('access_token', accessToken);
       $cookieStore.put('auth', auth);
+      $http.defaults.headers.common['Authorization'] = auth;
       $cookieStore.put('user_id', userId);
       $cookieStore.put('logged_in', true);
     },
@@ -88,7 +89,7 @@ authService.factory('sAuth', function($rootScope, $cookieStore, $cookies, $locat
       $rootScope.currentUser = Session.fetchTwitterUser({ oauth_token: oauthToken, oauth_verifier: oauthVerifier });
       $rootScope.currentUser.$promise.then(function(currentUser){
         console.log('signinWithTwitter: current user = ', currentUser);
-        _self.storeCookies(oauthToken, currentUser.User.Auth, currentUser.User.Id);
+        _self.storeCookies(oauthToken, currentUser.Token, currentUser.User.Id);
         $cookieStore.put('provider', 'twitter');
         $rootScope.isLoggedIn = true;
         $location.path('/');
@@ -102,13 +103,29 @@ authService.factory('sAuth', function($rootScope, $cookieStore, $cookies, $locat
       $rootScope.currentUser = Session.fetchGoogleUser({ auth_token: authToken });
       $rootScope.currentUser.$promise.then(function(currentUser){
         console.log('signinWithGoogle: current user = ', currentUser);
-        _self.storeCookies(authToken, currentUser.User.Auth, currentUser.User.Id);
+        _self.storeCookies(authToken, currentUser.Token, currentUser.User.Id);
         $cookieStore.put('provider', 'google');
         $rootScope.isLoggedIn = true;
         $location.path('/');
       }, function(error){
         $rootScope.currentUser = undefined;
       });
+    },
+    /* Complete signin with an OpenID Connect provider.
+     * Fetch the user of the authorization code then set the current user
+     * and store the cookies */
+    signinWithOpenIDConnect: function(provider, code, state) {
+      var _self = this;
+      $rootScope.currentUser = Session.fetchOpenIDConnectUser({ provider: provider, code: code, state: state });
+      $rootScope.currentUser.$promise.then(function(currentUser){
+        console.log('signinWithOpenIDConnect: current user = ', currentUser);
+        _self.storeCookies(state, currentUser.Token, currentUser.User.Id);
+        $cookieStore.put('provider', provider);
+        $rootScope.isLoggedIn = true;
+        $location.path('/');
+      }, function(error){
+        $rootScope.currentUser = undefined;
+      });
     }
   }
 });
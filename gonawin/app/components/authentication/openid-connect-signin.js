@@ -0,0 +1,28 @@
+'use strict';
+
+angular.module('directive.openidconnectsignin', []).
+  directive('openidConnectSignin', function (Session, $rootScope) {
+    return {
+      restrict: 'E',
+      template: '<div><div class="row" ng-repeat="provider in providers"><button class="btn btn-block btn-social btn-openid" ng-click="signin(provider.Name)"><i class="fa fa-openid"></i> Signin with {{provider.Title}}</button></div></div>',
+      replace: true,
+      link: function (scope, element, attrs) {
+        scope.providers = [];
+        $rootScope.serviceIds.$promise.then(function(response){
+          angular.forEach(response.Providers, function(provider){
+            if(provider.OpenIDConnect) {
+              scope.providers.push(provider);
+            }
+          });
+        });
+        scope.signin = function(name) {
+          console.log("Sign in with " + name + " has started...");
+          Session.fetchOpenIDConnectLoginUrl({ provider: name }).$promise.then(function(data){
+            window.location.replace(data.Url);
+          }, function(error) {
+            console.log('fetchOpenIDConnectLoginUrl: error = ', error);
+          });
+        };
+      }
+    };
+  });
@@ -14,6 +14,9 @@ sessionService.factory('Session', function($cookieStore, $resource) {
     fetchGoogleUser: { method:'GET', params: { auth_token: '@auth_token' }, url: '/j/auth/google/user/' },
     DeleteGoogleCookie: { method: 'GET', url: '/j/auth/google/deletecookie'},
     serviceIds: { method:'GET', url: '/j/auth/serviceids/' },
+    fetchOpenIDConnectLoginUrl: { method:'GET', params: { provider: '@provider' }, url: '/j/auth/oidc/:provider' },
+    fetchOpenIDConnectUser: { method:'GET', params: { provider: '@provider', code: '@code', state: '@state' }, url: '/j/auth/oidc/:provider/user' },
+    signout: { method:'POST', url: '/j/sessions/logout' },
   });
 
   // Need to define displayname function here again as User can be either returned by the server or the session.
@@ -123,17 +123,8 @@ dashboardControllers.controller('DashboardCtrl', ['$scope', '$rootScope', '$rout
           $scope.imageURL = currentUser.ImageURL;
 	  
 
-          if (currentUser.User.TournamentIds){
-            $scope.dashboard.ntournaments = currentUser.User.TournamentIds.length;
-          } else {
-            $scope.dashboard.ntournaments = 0;
-          }
-
-          if (currentUser.User.TeamIds){
-            $scope.dashboard.nteams = currentUser.User.TeamIds.length;
-          } else {
-            $scope.dashboard.nteams = 0;
-          }
+          $scope.dashboard.ntournaments = currentUser.TournamentsCount || 0;
+          $scope.dashboard.nteams = currentUser.TeamsCount || 0;
           // get user score information:
           $scope.dashboard.score = currentUser.User.Score;
           // get user tournaments.
@@ -218,17 +209,8 @@ dashboardControllers.controller('DashboardCtrl', ['$scope', '$rootScope', '$rout
 
 	  $scope.imageURL = currentUser.ImageURL;
 
-          if (currentUser.User.TournamentIds){
-            $scope.dashboard.ntournaments = currentUser.User.TournamentIds.length;
-          } else {
-            $scope.dashboard.ntournaments = 0;
-          }
-
-          if (currentUser.User.TeamIds){
-            $scope.dashboard.nteams = currentUser.User.TeamIds.length;
-          } else {
-            $scope.dashboard.nteams = 0;
-          }
+          $scope.dashboard.ntournaments = currentUser.TournamentsCount || 0;
+          $scope.dashboard.nteams = currentUser.TeamsCount || 0;
           // get user score information:
           $scope.dashboard.score = currentUser.User.Score;
 
@@ -258,17 +240,8 @@ dashboardControllers.controller('DashboardCtrl', ['$scope', '$rootScope', '$rout
 
 	  $scope.imageURL = currentUser.ImageURL;
 
-          if (currentUser.User.TournamentIds){
-            $scope.dashboard.ntournaments = currentUser.User.TournamentIds.length;
-          } else {
-            $scope.dashboard.ntournaments = 0;
-          }
-
-          if (currentUser.User.TeamIds){
-            $scope.dashboard.nteams = currentUser.User.TeamIds.length;
-          } else{
-            $scope.dashboard.nteams = 0;
-          }
+          $scope.dashboard.ntournaments = currentUser.TournamentsCount || 0;
+          $scope.dashboard.nteams = currentUser.TeamsCount || 0;
           // get user score information:
           $scope.dashboard.score = currentUser.User.Score;
         });
@@ -24,6 +24,8 @@ navigationControllers.controller('NavigationCtrl', ['$scope', '$rootScope', '$lo
       if(providerCookie == 'google') {
         Session.DeleteGoogleCookie();
       }
+      // sign out the gonawin session
+      Session.signout();
       // reset rootScope variables
       $rootScope.currentUser = undefined;
       $rootScope.isLoggedIn = false;
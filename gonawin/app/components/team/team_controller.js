@@ -12,55 +12,57 @@ teamControllers.controller('TeamListCtrl', ['$rootScope', '$scope', 'Team', 'Use
     $rootScope.title = 'gonawin - Teams';
 
     $scope.countTeams = 25; // counter for the number of teams to display in view.
-    $scope.pageTeams = 1;   // page counter for teams, to know which page to display next.
+    $scope.cursorTeams = '';   // cursor of the next page of teams, to know which page to display next.
 
     $rootScope.currentUser.$promise.then(function(currentUser) {
       $scope.showMyTeams();
     });
 
     $scope.showMyTeams = function() {
-      var userData = User.get({ id:$rootScope.currentUser.User.Id, including: "Teams", count:$scope.countTeams, page:$scope.pageTeams});
+      var userData = User.get({ id:$rootScope.currentUser.User.Id, including: "Teams", count:$scope.countTeams});
     	console.log('user data = ', userData);
     	userData.$promise.then(function(response) {
         $scope.teams = response.Teams;
+        $scope.cursorTeams = response.TeamsNext;
         if(!$scope.teams || ($scope.teams && !$scope.teams.length)) {
     		    $scope.noTeamsMessage = 'You haven\'t joined a team yet';
   	    } else if($scope.teams !== undefined) {
-    		    $scope.showMoreTeams = (response.Teams.length == $scope.countTeams);
+    		    $scope.showMoreTeams = !!response.TeamsNext;
   	    }
     	});
     };
 
     $scope.showOtherTeams = function() {
-      Team.query({count:$scope.countTeams, page:$scope.pageTeams}).$promise.then(function(teams) {
-        $scope.teams = teams;
+      Team.list({count:$scope.countTeams}).$promise.then(function(response) {
+        $scope.teams = response.Teams;
+        $scope.cursorTeams = response.Next;
         if(!$scope.teams || ($scope.teams && !$scope.teams.length)) {
       	    $scope.noTeamsMessage = 'There are no teams yet';
       	} else if($scope.teams !== undefined) {
-      	    $scope.showMoreTeams = (teams.length == $scope.countTeams);
+      	    $scope.showMoreTeams = !!response.Next;
       	}
       });
     };
 
     // show more teams function:
-    // retrieve teams by page and increment page.
+    // retrieve the next page of teams with the cursor.
     $scope.moreTeams = function() {
     	console.log('more teams');
-    	$scope.pageTeams = $scope.pageTeams + 1;
-    	Team.query({count:$scope.countTeams, page:$scope.pageTeams}).$promise.then(function(response) {
+    	Team.list({count:$scope.countTeams, cursor:$scope.cursorTeams}).$promise.then(function(response) {
   	    console.log('response: ', response);
-  	    $scope.teams = $scope.teams.concat(response);
-  	    $scope.showMoreTeams = (response.length == $scope.countTeams);
+  	    $scope.teams = $scope.teams.concat(response.Teams);
+  	    $scope.cursorTeams = response.Next;
+  	    $scope.showMoreTeams = !!response.Next;
     	});
     };
 
     $scope.moreJoinedTeams = function() {
     	console.log('more joined teams');
-    	$scope.pageTeams = $scope.pageTeams + 1;
-    	User.teams({id:$rootScope.currentUser.User.Id, count:$scope.countTeams, page:$scope.pageTeams}).$promise.then(function(response) {
+    	User.teams({id:$rootScope.currentUser.User.Id, count:$scope.countTeams, cursor:$scope.cursorTeams}).$promise.then(function(response) {
   	    console.log('response: ', response);
   	    $scope.teams = $scope.teams.concat(response.Teams);
-  	    $scope.showMoreTeams = (response.Teams.length == $scope.countTeams);
+  	    $scope.cursorTeams = response.Next;
+  	    $scope.showMoreTeams = !!response.Next;
     	});
     };
 
@@ -13,9 +13,10 @@ teamService.factory('Team', function($http, $resource, $cookieStore) {
       limit: '@limit',
       userId: '@userId',
       count: '@count',
-      page: '@page'
+      cursor: '@cursor'
     },
     {
+      list: { method: 'GET', url: 'j/teams' },
       get: { method: 'GET', url: 'j/teams/show/:id' },
       save: { method: 'POST', url: 'j/teams/new' },
       update: { method: 'POST', url: 'j/teams/update/:id' },
@@ -12,28 +12,28 @@ tournamentControllers.controller('TournamentListCtrl', ['$scope', '$rootScope',
     $rootScope.title = 'gonawin - Tournaments';
 
     $scope.countTournaments = 25;  // counter for the number of tournaments to display in view.
-    $scope.pageTournaments = 1;    // page counter for tournaments, to know which page to display next.
+    $scope.cursorTournaments = '';    // cursor of the next page of tournaments, to know which page to display next.
 
     // main query to /j/tournaments to get all tournaments.
-    $scope.tournaments = Tournament.query({count:$scope.countTournaments, page:$scope.pageTournaments});
-
-    $scope.tournaments.$promise.then(function(response){
+    Tournament.list({count:$scope.countTournaments}).$promise.then(function(response){
+	$scope.tournaments = response.Tournaments;
+	$scope.cursorTournaments = response.Next;
 	if(!$scope.tournaments || ($scope.tournaments && !$scope.tournaments.length)){
 	    $scope.noTournamentsMessage = 'There are no tournaments yet';
 	}else if($scope.tournaments !== undefined){
-	    $scope.showMoreTournaments = (response.length == $scope.countTournaments);
+	    $scope.showMoreTournaments = !!response.Next;
 	}
     });
 
     // show more tournaments function:
-    // retrieve tournaments by page and increment page.
+    // retrieve the next page of tournaments with the cursor.
     $scope.moreTournaments = function(){
 	console.log('more tournaments');
-	$scope.pageTournaments = $scope.pageTournaments + 1;
-	Tournament.query({count:$scope.countTournaments, page:$scope.pageTournaments}).$promise.then(function(response){
+	Tournament.list({count:$scope.countTournaments, cursor:$scope.cursorTournaments}).$promise.then(function(response){
 	    console.log('response: ', response);
-	    $scope.tournaments = $scope.tournaments.concat(response);
-	    $scope.showMoreTournaments = (response.length == $scope.countTournaments);
+	    $scope.tournaments = $scope.tournaments.concat(response.Tournaments);
+	    $scope.cursorTournaments = response.Next;
+	    $scope.showMoreTournaments = !!response.Next;
 	});
     };
 
@@ -21,9 +21,12 @@ tournamentService.factory('Tournament', function($http, $resource, $cookieStore)
        limit: '@limit',
        oldName: '@oldName',
        newName: '@newName',
-       userId: '@userId'
+       userId: '@userId',
+       count: '@count',
+       cursor: '@cursor'
      },
      {
+       list: { method: 'GET', url: 'j/tournaments' },
        get: { method: 'GET', url: 'j/tournaments/show/:id' },
        save: { method: 'POST', url: 'j/tournaments/new' },
        update: { method: 'POST', url: 'j/tournaments/update/:id' },
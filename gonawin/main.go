@@ -30,132 +30,195 @@ import (
 
 	activitiesctrl "github.com/taironas/gonawin/controllers/activities"
 	invitectrl "github.com/taironas/gonawin/controllers/invite"
+	reportsctrl "github.com/taironas/gonawin/controllers/reports"
+	searchctrl "github.com/taironas/gonawin/controllers/search"
 	sessionsctrl "github.com/taironas/gonawin/controllers/sessions"
 	tasksctrl "github.com/taironas/gonawin/controllers/tasks"
 	teamsctrl "github.com/taironas/gonawin/controllers/teams"
 	tournamentsctrl "github.com/taironas/gonawin/controllers/tournaments"
 	usersctrl "github.com/taironas/gonawin/controllers/users"
+
+	mdl "github.com/taironas/gonawin/models"
 )
 
 // entry point of application
 func init() {
+	http.Handle("/", Router())
+}
+
+// Router returns the router serving the gonawin json API and the admin handlers.
+//
+func Router() http.Handler {
 
 	r := new(route.Router)
 
 	checkErrors := handlers.ErrorHandler
 	authorized := handlers.Authorized
-	adminAuthorized := handlers.AdminAuthorized
+	get := handlers.Get
+	post := handlers.Post
+	limited := handlers.RateLimited
 	// ------------- Json Server -----------------
 
 	// session
-	r.HandleFunc("/j/auth", checkErrors(sessionsctrl.Authenticate))
-	r.HandleFunc("/j/auth/twitter", checkErrors(sessionsctrl.TwitterAuth))
-	r.HandleFunc("/j/auth/twitter/callback", checkErrors(sessionsctrl.TwitterAuthCallback))
-	r.HandleFunc("/j/auth/twitter/user", checkErrors(sessionsctrl.TwitterUser))
-	r.HandleFunc("/j/auth/googleloginurl", checkErrors(sessionsctrl.GoogleAccountsLoginURL))
-	r.HandleFunc("/j/auth/google/callback", checkErrors(sessionsctrl.GoogleAuthCallback))
-	r.HandleFunc("/j/auth/google/user", checkErrors(sessionsctrl.GoogleUser))
-	r.HandleFunc("/j/auth/google/deletecookie", checkErrors(sessionsctrl.GoogleDeleteCookie))
-	r.HandleFunc("/j/auth/serviceids", checkErrors(sessionsctrl.AuthServiceIds))
+	r.HandleFunc("/j/auth", checkErrors(get(sessionsctrl.Authenticate)))
+	r.HandleFunc("/j/auth/twitter", checkErrors(get(sessionsctrl.TwitterAuth)))
+	r.HandleFunc("/j/auth/twitter/callback", checkErrors(get(sessionsctrl.TwitterAuthCallback)))
+	r.HandleFunc("/j/auth/twitter/user", checkErrors(get(sessionsctrl.TwitterUser)))
+	r.HandleFunc("/j/auth/googleloginurl", checkErrors(get(sessionsctrl.GoogleAccountsLoginURL)))
+	r.HandleFunc("/j/auth/google/callback", checkErrors(get(sessionsctrl.GoogleAuthCallback)))
+	r.HandleFunc("/j/auth/google/user", checkErrors(get(sessionsctrl.GoogleUser)))
+	r.HandleFunc("/j/auth/google/deletecookie", checkErrors(get(sessionsctrl.GoogleDeleteCookie)))
+	r.HandleFunc("/j/auth/serviceids", checkErrors(get(sessionsctrl.AuthServiceIds)))
+	r.HandleFunc("/j/auth/oidc/:provider", checkErrors(get(sessionsctrl.OpenIDConnectAuth)))
+	r.HandleFunc("/j/auth/oidc/:provider/callback", checkErrors(get(sessionsctrl.OpenIDConnectCallback)))
+	r.HandleFunc("/j/auth/oidc/:provider/user", checkErrors(get(sessionsctrl.OpenIDConnectUser)))
+	r.HandleFunc("/j/auth/identities", checkErrors(get(authorized(sessionsctrl.Identities))))
+	r.HandleFunc("/j/auth/identities/link", checkErrors(post(authorized(sessionsctrl.Link))))
+	r.HandleFunc("/j/auth/identities/unlink", checkErrors(post(authorized(sessionsctrl.Unlink))))
+	r.HandleFunc("/j/sessions", checkErrors(get(authorized(sessionsctrl.Index))))
+	r.HandleFunc("/j/sessions/logout", checkErrors(post(authorized(sessionsctrl.Logout))))
+	r.HandleFunc("/j/sessions/logout/all", checkErrors(post(authorized(sessionsctrl.LogoutAll))))
+	r.HandleFunc("/j/sessions/destroy/:sessionId", checkErrors(post(authorized(sessionsctrl.Destroy))))
+	r.HandleFunc("/j/tokens", checkErrors(get(authorized(sessionsctrl.Tokens))))
+	r.HandleFunc("/j/tokens/new", checkErrors(post(authorized(sessionsctrl.NewToken))))
+	r.HandleFunc("/j/tokens/destroy/:tokenId", checkErrors(post(authorized(sessionsctrl.DestroyToken))))
 
 	// user
-	r.HandleFunc("/j/users", checkErrors(adminAuthorized(usersctrl.Index)))
-	r.HandleFunc("/j/users/show/:userId", checkErrors(authorized(usersctrl.Show)))
-	r.HandleFunc("/j/users/update/:userId", checkErrors(authorized(usersctrl.Update)))
-	r.HandleFunc("/j/users/destroy/:userId", checkErrors(authorized(usersctrl.Destroy)))
-	r.HandleFunc("/j/users/:userId/scores", checkErrors(authorized(usersctrl.Score)))
-	r.HandleFunc("/j/users/search", checkErrors(authorized(usersctrl.Search)))
-	r.HandleFunc("/j/users/:userId/teams", checkErrors(authorized(usersctrl.Teams)))
-	r.HandleFunc("/j/users/:userId/tournaments", checkErrors(authorized(usersctrl.Tournaments)))
-	r.HandleFunc("/j/users/allow/:teamId", checkErrors(authorized(usersctrl.AllowInvitation)))
-	r.HandleFunc("/j/users/deny/:teamId", checkErrors(authorized(usersctrl.DenyInvitation)))
+	r.HandleFunc("/j/users", checkErrors(get(authorized(usersctrl.Index, handlers.SiteAdmin))))
+	r.HandleFunc("/j/users/show/:userId", checkErrors(get(authorized(usersctrl.Show))))
+	r.HandleFunc("/j/users/update/:userId", checkErrors(post(authorized(usersctrl.Update, handlers.Self))))
+	r.HandleFunc("/j/users/destroy/:userId", checkErrors(post(authorized(usersctrl.Destroy, handlers.Self))))
+	r.HandleFunc("/j/users/:userId/scores", checkErrors(get(authorized(usersctrl.Score))))
+	r.HandleFunc("/j/users/search", checkErrors(get(limited(authorized(usersctrl.Search), "search"))))
+	r.HandleFunc("/j/users/:userId/teams", checkErrors(get(authorized(usersctrl.Teams))))
+	r.HandleFunc("/j/users/:userId/tournaments", checkErrors(get(authorized(usersctrl.Tournaments))))
+	r.HandleFunc("/j/users/:userId/predicts", checkErrors(get(authorized(usersctrl.Predicts, handlers.AnyOf(handlers.Self, handlers.SiteAdmin)))))
+	r.HandleFunc("/j/users/allow/:teamId", checkErrors(post(authorized(usersctrl.AllowInvitation))))
+	r.HandleFunc("/j/users/deny/:teamId", checkErrors(post(authorized(usersctrl.DenyInvitation))))
+	r.HandleFunc("/j/users/block/:userId", checkErrors(post(authorized(usersctrl.Block))))
+	r.HandleFunc("/j/users/unblock/:userId", checkErrors(post(authorized(usersctrl.Unblock))))
+	r.HandleFunc("/j/users/merge/:userId", checkErrors(post(authorized(usersctrl.Merge, handlers.SiteAdmin))))
+	r.HandleFunc("/j/users/:userId/export", checkErrors(get(limited(authorized(usersctrl.Export, handlers.Self), "export"))))
+	r.HandleFunc("/j/users/:userId/deletion", checkErrors(get(authorized(usersctrl.Deletion, handlers.AnyOf(handlers.Self, handlers.SiteAdmin)))))
 
 	// team
-	r.HandleFunc("/j/teams", checkErrors(authorized(teamsctrl.Index)))
-	r.HandleFunc("/j/teams/new", checkErrors(authorized(teamsctrl.New)))
-	r.HandleFunc("/j/teams/show/:teamId", checkErrors(authorized(teamsctrl.Show)))
-	r.HandleFunc("/j/teams/update/:teamId", checkErrors(authorized(teamsctrl.Update)))
-	r.HandleFunc("/j/teams/destroy/:teamId", checkErrors(authorized(teamsctrl.Destroy)))
-	r.HandleFunc("/j/teams/requestinvite/:teamId", checkErrors(authorized(teamsctrl.RequestInvite)))
-	r.HandleFunc("/j/teams/sendinvite/:teamId/:userId", checkErrors(authorized(teamsctrl.SendInvite)))
-	r.HandleFunc("/j/teams/invited/:teamId", checkErrors(authorized(teamsctrl.Invited)))
-	r.HandleFunc("/j/teams/allow/:requestId", checkErrors(authorized(teamsctrl.AllowRequest)))
-	r.HandleFunc("/j/teams/deny/:requestId", checkErrors(authorized(teamsctrl.DenyRequest)))
-	r.HandleFunc("/j/teams/search", checkErrors(authorized(teamsctrl.Search)))
-	r.HandleFunc("/j/teams/:teamId/members", checkErrors(authorized(teamsctrl.Members)))
-	r.HandleFunc("/j/teams/:teamId/ranking", checkErrors(authorized(teamsctrl.Ranking)))
-	r.HandleFunc("/j/teams/:teamId/accuracies/:tournamentId", checkErrors(authorized(teamsctrl.AccuracyByTournament)))
-	r.HandleFunc("/j/teams/:teamId/accuracies", checkErrors(authorized(teamsctrl.Accuracies)))
-	r.HandleFunc("/j/teams/:teamId/prices", checkErrors(authorized(teamsctrl.Prices)))
-	r.HandleFunc("/j/teams/:teamId/prices/:tournamentId", checkErrors(authorized(teamsctrl.PriceByTournament)))
-	r.HandleFunc("/j/teams/:teamId/prices/update/:tournamentId", checkErrors(authorized(teamsctrl.UpdatePrice)))
-	r.HandleFunc("/j/teams/:teamId/admin/add/:userId", checkErrors(authorized(teamsctrl.AddAdmin)))
-	r.HandleFunc("/j/teams/:teamId/admin/remove/:userId", checkErrors(authorized(teamsctrl.RemoveAdmin)))
+	r.HandleFunc("/j/teams", checkErrors(get(authorized(teamsctrl.Index))))
+	r.HandleFunc("/j/teams/new", checkErrors(post(authorized(teamsctrl.New))))
+	r.HandleFunc("/j/teams/show/:teamId", checkErrors(get(authorized(teamsctrl.Show))))
+	r.HandleFunc("/j/teams/update/:teamId", checkErrors(post(authorized(teamsctrl.Update, handlers.TeamPermission(mdl.TeamPermissionUpdate)))))
+	r.HandleFunc("/j/teams/destroy/:teamId", checkErrors(post(authorized(teamsctrl.Destroy, handlers.TeamPermission(mdl.TeamPermissionDelete)))))
+	r.HandleFunc("/j/teams/requestinvite/:teamId", checkErrors(post(limited(authorized(teamsctrl.RequestInvite), "requestinvite"))))
+	r.HandleFunc("/j/teams/sendinvite/:teamId/:userId", checkErrors(post(limited(authorized(teamsctrl.SendInvite, handlers.TeamPermission(mdl.TeamPermissionInvite)), "invite"))))
+	r.HandleFunc("/j/teams/invited/:teamId", checkErrors(get(authorized(teamsctrl.Invited))))
+	r.HandleFunc("/j/teams/allow/:requestId", checkErrors(post(authorized(teamsctrl.AllowRequest))))
+	r.HandleFunc("/j/teams/deny/:requestId", checkErrors(post(authorized(teamsctrl.DenyRequest))))
+	r.HandleFunc("/j/teams/:teamId/requests", checkErrors(get(authorized(teamsctrl.Requests, handlers.TeamPermission(mdl.TeamPermissionApproveRequests)))))
+	r.HandleFunc("/j/teams/:teamId/requests/allow", checkErrors(post(authorized(teamsctrl.AllowRequests, handlers.TeamPermission(mdl.TeamPermissionApproveRequests)))))
+	r.HandleFunc("/j/teams/:teamId/requests/deny", checkErrors(post(authorized(teamsctrl.DenyRequests, handlers.TeamPermission(mdl.TeamPermissionApproveRequests)))))
+	r.HandleFunc("/j/teams/search", checkErrors(get(limited(authorized(teamsctrl.Search), "search"))))
+	r.HandleFunc("/j/teams/:teamId/members", checkErrors(get(authorized(teamsctrl.Members))))
+	r.HandleFunc("/j/teams/:teamId/ranking", checkErrors(get(authorized(teamsctrl.Ranking, handlers.TokenScope(mdl.ScopeReadRankings)))))
+	r.HandleFunc("/j/teams/:teamId/accuracies/:tournamentId", checkErrors(get(authorized(teamsctrl.AccuracyByTournament))))
+	r.HandleFunc("/j/teams/:teamId/accuracies", checkErrors(get(authorized(teamsctrl.Accuracies))))
+	r.HandleFunc("/j/teams/:teamId/prices", checkErrors(get(authorized(teamsctrl.Prices))))
+	r.HandleFunc("/j/teams/:teamId/prices/:tournamentId", checkErrors(get(authorized(teamsctrl.PriceByTournament))))
+	r.HandleFunc("/j/teams/:teamId/prices/update/:tournamentId", checkErrors(post(authorized(teamsctrl.UpdatePrice, handlers.TeamPermission(mdl.TeamPermissionEditPrices)))))
+	r.HandleFunc("/j/teams/:teamId/winners", checkErrors(get(authorized(teamsctrl.Winners))))
+	r.HandleFunc("/j/teams/:teamId/admin/add/:userId", checkErrors(post(authorized(teamsctrl.AddAdmin, handlers.TeamPermission(mdl.TeamPermissionManageRoles)))))
+	r.HandleFunc("/j/teams/:teamId/admin/remove/:userId", checkErrors(post(authorized(teamsctrl.RemoveAdmin, handlers.TeamPermission(mdl.TeamPermissionManageRoles)))))
+	r.HandleFunc("/j/teams/:teamId/roles", checkErrors(get(authorized(teamsctrl.Roles))))
+	r.HandleFunc("/j/teams/:teamId/roles/set/:userId/:role", checkErrors(post(authorized(teamsctrl.SetRole, handlers.TeamPermission(mdl.TeamPermissionManageRoles)))))
+	r.HandleFunc("/j/teams/:teamId/owner/transfer/:userId", checkErrors(post(authorized(teamsctrl.TransferOwnership, handlers.TeamOwner))))
+	r.HandleFunc("/j/teams/:teamId/kick/:userId", checkErrors(post(authorized(teamsctrl.Kick, handlers.TeamPermission(mdl.TeamPermissionRemoveMembers)))))
+	r.HandleFunc("/j/teams/:teamId/ban/:userId", checkErrors(post(authorized(teamsctrl.Ban, handlers.TeamPermission(mdl.TeamPermissionRemoveMembers)))))
+	r.HandleFunc("/j/teams/:teamId/unban/:userId", checkErrors(post(authorized(teamsctrl.Unban, handlers.TeamPermission(mdl.TeamPermissionRemoveMembers)))))
+	r.HandleFunc("/j/teams/:teamId/challenges", checkErrors(get(authorized(teamsctrl.Challenges))))
+	r.HandleFunc("/j/teams/:teamId/challenges/new/:tournamentId", checkErrors(post(authorized(teamsctrl.NewChallenge, handlers.TeamAdmin))))
+	r.HandleFunc("/j/teams/challenges/show/:challengeId", checkErrors(get(authorized(teamsctrl.ShowChallenge))))
+	r.HandleFunc("/j/teams/challenges/accept/:challengeId", checkErrors(post(authorized(teamsctrl.AcceptChallenge))))
+	r.HandleFunc("/j/teams/challenges/decline/:challengeId", checkErrors(post(authorized(teamsctrl.DeclineChallenge))))
+	r.HandleFunc("/j/teams/:teamId/trophies", checkErrors(get(authorized(teamsctrl.Trophies))))
 
 	// tournament
-	r.HandleFunc("/j/tournaments", checkErrors(authorized(tournamentsctrl.Index)))
-	r.HandleFunc("/j/tournaments/new", checkErrors(adminAuthorized(tournamentsctrl.New)))
-	r.HandleFunc("/j/tournaments/show/:tournamentId", checkErrors(authorized(tournamentsctrl.Show)))
-	r.HandleFunc("/j/tournaments/update/:tournamentId", checkErrors(adminAuthorized(tournamentsctrl.Update)))
-	r.HandleFunc("/j/tournaments/destroy/:tournamentId", checkErrors(adminAuthorized(tournamentsctrl.Destroy)))
-	r.HandleFunc("/j/tournaments/search", checkErrors(authorized(tournamentsctrl.Search)))
-	r.HandleFunc("/j/tournaments/:tournamentId/candidates", checkErrors(authorized(tournamentsctrl.CandidateTeams)))
-	r.HandleFunc("/j/tournaments/:tournamentId/participants", checkErrors(authorized(tournamentsctrl.Participants)))
+	r.HandleFunc("/j/tournaments", checkErrors(get(authorized(tournamentsctrl.Index))))
+	r.HandleFunc("/j/tournaments/new", checkErrors(post(authorized(tournamentsctrl.New, handlers.SiteAdmin))))
+	r.HandleFunc("/j/tournaments/show/:tournamentId", checkErrors(get(authorized(tournamentsctrl.Show))))
+	r.HandleFunc("/j/tournaments/update/:tournamentId", checkErrors(post(authorized(tournamentsctrl.Update, handlers.SiteAdmin, handlers.TournamentAdmin))))
+	r.HandleFunc("/j/tournaments/destroy/:tournamentId", checkErrors(post(authorized(tournamentsctrl.Destroy, handlers.SiteAdmin, handlers.TournamentAdmin))))
+	r.HandleFunc("/j/tournaments/search", checkErrors(get(limited(authorized(tournamentsctrl.Search), "search"))))
+	r.HandleFunc("/j/tournaments/:tournamentId/candidates", checkErrors(get(authorized(tournamentsctrl.CandidateTeams))))
+	r.HandleFunc("/j/tournaments/:tournamentId/participants", checkErrors(get(authorized(tournamentsctrl.Participants))))
 
 	// relationships
-	r.HandleFunc("/j/teams/join/:teamId", checkErrors(authorized(teamsctrl.Join)))
-	r.HandleFunc("/j/teams/leave/:teamId", checkErrors(authorized(teamsctrl.Leave)))
-	r.HandleFunc("/j/tournaments/join/:tournamentId", checkErrors(authorized(tournamentsctrl.Join)))
-	r.HandleFunc("/j/tournaments/joinasteam/:tournamentId/:teamId", checkErrors(authorized(tournamentsctrl.JoinAsTeam)))
-	r.HandleFunc("/j/tournaments/leaveasteam/:tournamentId/:teamId", checkErrors(authorized(tournamentsctrl.LeaveAsTeam)))
+	r.HandleFunc("/j/teams/join/:teamId", checkErrors(post(authorized(teamsctrl.Join))))
+	r.HandleFunc("/j/teams/leave/:teamId", checkErrors(post(authorized(teamsctrl.Leave))))
+	r.HandleFunc("/j/tournaments/join/:tournamentId", checkErrors(post(authorized(tournamentsctrl.Join))))
+	r.HandleFunc("/j/tournaments/joinasteam/:tournamentId/:teamId", checkErrors(post(authorized(tournamentsctrl.JoinAsTeam, handlers.TeamPermission(mdl.TeamPermissionJoinTournaments)))))
+	r.HandleFunc("/j/tournaments/leaveasteam/:tournamentId/:teamId", checkErrors(post(authorized(tournamentsctrl.LeaveAsTeam, handlers.TeamPermission(mdl.TeamPermissionJoinTournaments)))))
 
 	// invite
-	r.HandleFunc("/j/invite", checkErrors(authorized(invitectrl.Invite)))
+	r.HandleFunc("/j/invite", checkErrors(post(limited(authorized(invitectrl.Invite), "invite"))))
 
 	// tournament world cup
-	r.HandleFunc("/j/tournaments/newwc", checkErrors(adminAuthorized(tournamentsctrl.NewWorldCup)))
-	r.HandleFunc("/j/tournaments/getwc", checkErrors(authorized(tournamentsctrl.GetWorldCup)))
+	r.HandleFunc("/j/tournaments/newwc", checkErrors(post(authorized(tournamentsctrl.NewWorldCup, handlers.SiteAdmin))))
+	r.HandleFunc("/j/tournaments/getwc", checkErrors(get(authorized(tournamentsctrl.GetWorldCup))))
 
 	// tournament champions league
-	r.HandleFunc("/j/tournaments/newcl", checkErrors(adminAuthorized(tournamentsctrl.NewChampionsLeague)))
-	r.HandleFunc("/j/tournaments/getcl", checkErrors(authorized(tournamentsctrl.GetChampionsLeague)))
+	r.HandleFunc("/j/tournaments/newcl", checkErrors(post(authorized(tournamentsctrl.NewChampionsLeague, handlers.SiteAdmin))))
+	r.HandleFunc("/j/tournaments/getcl", checkErrors(get(authorized(tournamentsctrl.GetChampionsLeague))))
 
 	// tournament copa america
-	r.HandleFunc("/j/tournaments/newca", checkErrors(adminAuthorized(tournamentsctrl.NewCopaAmerica)))
-	r.HandleFunc("/j/tournaments/getca", checkErrors(authorized(tournamentsctrl.GetCopaAmerica)))
+	r.HandleFunc("/j/tournaments/newca", checkErrors(post(authorized(tournamentsctrl.NewCopaAmerica, handlers.SiteAdmin))))
+	r.HandleFunc("/j/tournaments/getca", checkErrors(get(authorized(tournamentsctrl.GetCopaAmerica))))
 
 	// tournament euro
-	r.HandleFunc("/j/tournaments/neweuro", checkErrors(adminAuthorized(tournamentsctrl.NewEuro)))
-	r.HandleFunc("/j/tournaments/geteuro", checkErrors(authorized(tournamentsctrl.GetEuro)))
+	r.HandleFunc("/j/tournaments/neweuro", checkErrors(post(authorized(tournamentsctrl.NewEuro, handlers.SiteAdmin))))
+	r.HandleFunc("/j/tournaments/geteuro", checkErrors(get(authorized(tournamentsctrl.GetEuro))))
 
 	// tournament
-	r.HandleFunc("/j/tournaments/:tournamentId/groups", checkErrors(authorized(tournamentsctrl.Groups)))
-	r.HandleFunc("/j/tournaments/:tournamentId/calendar", checkErrors(authorized(tournamentsctrl.Calendar)))
-	r.HandleFunc("/j/tournaments/:tournamentId/:teamId/calendarwithprediction", checkErrors(authorized(tournamentsctrl.CalendarWithPrediction)))
-	r.HandleFunc("/j/tournaments/:tournamentId/matches", checkErrors(authorized(tournamentsctrl.Matches)))
-	r.HandleFunc("/j/tournaments/:tournamentId/matches/:matchId/update", checkErrors(adminAuthorized(tournamentsctrl.UpdateMatchResult)))
-	r.HandleFunc("/j/tournaments/:tournamentId/matches/:matchId/predict", checkErrors(authorized(tournamentsctrl.Predict)))
-	r.HandleFunc("/j/tournaments/:tournamentId/matches/:matchId/blockprediction", checkErrors(adminAuthorized(tournamentsctrl.BlockMatchPrediction)))
-	r.HandleFunc("/j/tournaments/:tournamentId/ranking", checkErrors(authorized(tournamentsctrl.Ranking)))
-	r.HandleFunc("/j/tournaments/:tournamentId/teams", checkErrors(authorized(tournamentsctrl.Teams)))
-	r.HandleFunc("/j/tournaments/:tournamentId/admin/reset", checkErrors(adminAuthorized(tournamentsctrl.Reset)))
-	r.HandleFunc("/j/tournaments/:tournamentId/matches/simulate", checkErrors(adminAuthorized(tournamentsctrl.SimulateMatches)))
-	r.HandleFunc("/j/tournaments/:tournamentId/admin/updateteam", checkErrors(adminAuthorized(tournamentsctrl.UpdateTeam)))
-	r.HandleFunc("/j/tournaments/:tournamentId/admin/add/:userId", checkErrors(adminAuthorized(tournamentsctrl.AddAdmin)))
-	r.HandleFunc("/j/tournaments/:tournamentId/admin/remove/:userId", checkErrors(adminAuthorized(tournamentsctrl.RemoveAdmin)))
-	r.HandleFunc("/j/tournaments/:tournamentId/admin/activatephase", checkErrors(adminAuthorized(tournamentsctrl.ActivatePhase)))
+	r.HandleFunc("/j/tournaments/:tournamentId/groups", checkErrors(get(authorized(tournamentsctrl.Groups, handlers.TokenScope(mdl.ScopeReadCalendar)))))
+	r.HandleFunc("/j/tournaments/:tournamentId/calendar", checkErrors(get(authorized(tournamentsctrl.Calendar, handlers.TokenScope(mdl.ScopeReadCalendar)))))
+	r.HandleFunc("/j/tournaments/:tournamentId/:teamId/calendarwithprediction", checkErrors(get(authorized(tournamentsctrl.CalendarWithPrediction, handlers.TokenScope(mdl.ScopeReadCalendar)))))
+	r.HandleFunc("/j/tournaments/:tournamentId/matches", checkErrors(get(authorized(tournamentsctrl.Matches, handlers.TokenScope(mdl.ScopeReadCalendar)))))
+	r.HandleFunc("/j/tournaments/:tournamentId/matches/:matchId/update", checkErrors(post(authorized(tournamentsctrl.UpdateMatchResult, handlers.SiteAdmin))))
+	r.HandleFunc("/j/tournaments/:tournamentId/matches/:matchId/predict", checkErrors(post(limited(authorized(tournamentsctrl.Predict, handlers.TokenScope(mdl.ScopeWritePredictions)), "predict"))))
+	r.HandleFunc("/j/tournaments/:tournamentId/matches/:matchId/blockprediction", checkErrors(post(authorized(tournamentsctrl.BlockMatchPrediction, handlers.SiteAdmin))))
+	r.HandleFunc("/j/tournaments/:tournamentId/ranking", checkErrors(get(authorized(tournamentsctrl.Ranking, handlers.TokenScope(mdl.ScopeReadRankings)))))
+	r.HandleFunc("/j/tournaments/:tournamentId/leaderboard", checkErrors(get(authorized(tournamentsctrl.Leaderboard, handlers.TokenScope(mdl.ScopeReadRankings)))))
+	r.HandleFunc("/j/tournaments/:tournamentId/teams", checkErrors(get(authorized(tournamentsctrl.Teams))))
+	r.HandleFunc("/j/tournaments/:tournamentId/admin/reset", checkErrors(post(authorized(tournamentsctrl.Reset, handlers.SiteAdmin))))
+	r.HandleFunc("/j/tournaments/:tournamentId/matches/simulate", checkErrors(post(authorized(tournamentsctrl.SimulateMatches, handlers.SiteAdmin))))
+	r.HandleFunc("/j/tournaments/:tournamentId/admin/updateteam", checkErrors(post(authorized(tournamentsctrl.UpdateTeam, handlers.SiteAdmin))))
+	r.HandleFunc("/j/tournaments/:tournamentId/admin/add/:userId", checkErrors(post(authorized(tournamentsctrl.AddAdmin, handlers.SiteAdmin))))
+	r.HandleFunc("/j/tournaments/:tournamentId/admin/remove/:userId", checkErrors(post(authorized(tournamentsctrl.RemoveAdmin, handlers.SiteAdmin))))
+	r.HandleFunc("/j/tournaments/:tournamentId/admin/predictions", checkErrors(post(authorized(tournamentsctrl.SetPredictionVisibility, handlers.AnyOf(handlers.SiteAdmin, handlers.TournamentAdmin)))))
+	r.HandleFunc("/j/tournaments/:tournamentId/admin/activatephase", checkErrors(post(authorized(tournamentsctrl.ActivatePhase, handlers.SiteAdmin))))
 
 	// activities
-	r.HandleFunc("/j/activities", checkErrors(authorized(activitiesctrl.Index)))
+	r.HandleFunc("/j/activities", checkErrors(get(authorized(activitiesctrl.Index))))
+
+	// search
+	r.HandleFunc("/j/search", checkErrors(get(limited(authorized(searchctrl.Search), "search"))))
+
+	// reports
+	r.HandleFunc("/j/reports", checkErrors(get(authorized(reportsctrl.Index, handlers.SiteAdmin))))
+	r.HandleFunc("/j/reports/new", checkErrors(post(authorized(reportsctrl.New))))
+	r.HandleFunc("/j/reports/resolve/:reportId", checkErrors(post(authorized(reportsctrl.Resolve, handlers.SiteAdmin))))
 
 	// admin handlers
-	r.HandleFunc("/a/update/scores", checkErrors(tasksctrl.UpdateScores))
-	r.HandleFunc("/a/update/users/scores", checkErrors(tasksctrl.UpdateUsersScores))
-	r.HandleFunc("/a/publish/users/scoreactivities", checkErrors(tasksctrl.PublishUsersScoreActivities))
-	r.HandleFunc("/a/create/scoreentities", checkErrors(tasksctrl.CreateScoreEntities))
-	r.HandleFunc("/a/add/scoreentities/score", checkErrors(tasksctrl.AddScoreToScoreEntities))
-	r.HandleFunc("/a/invite", checkErrors(tasksctrl.Invite))
-	r.HandleFunc("/a/publish/users/deletepredicts", checkErrors(tasksctrl.DeleteUserPredicts))
-
-	http.Handle("/", r)
+	r.HandleFunc("/a/update/scores", checkErrors(post(tasksctrl.UpdateScores)))
+	r.HandleFunc("/a/update/users/scores", checkErrors(post(tasksctrl.UpdateUsersScores)))
+	r.HandleFunc("/a/publish/users/scoreactivities", checkErrors(post(tasksctrl.PublishUsersScoreActivities)))
+	r.HandleFunc("/a/create/scoreentities", checkErrors(post(tasksctrl.CreateScoreEntities)))
+	r.HandleFunc("/a/add/scoreentities/score", checkErrors(post(tasksctrl.AddScoreToScoreEntities)))
+	r.HandleFunc("/a/invite", checkErrors(post(tasksctrl.Invite)))
+	r.HandleFunc("/a/resolve/prices", checkErrors(post(tasksctrl.ResolvePrices)))
+	r.HandleFunc("/a/delete/users", checkErrors(handlers.Methods(tasksctrl.DeleteUsers, "GET", "POST")))
+	r.HandleFunc("/a/expire/teamrequests", checkErrors(handlers.Methods(tasksctrl.ExpireTeamRequests, "GET", "POST")))
+	r.HandleFunc("/a/expire/sessions", checkErrors(get(tasksctrl.ExpireSessions)))
+	r.HandleFunc("/a/rebuild/searchindexes", checkErrors(handlers.Methods(tasksctrl.RebuildSearchIndexes, "GET", "POST")))
+	r.HandleFunc("/a/rebuild/leaderboards", checkErrors(handlers.Methods(tasksctrl.RebuildLeaderboards, "GET", "POST")))
+	r.HandleFunc("/a/migrate/relations", checkErrors(handlers.Methods(tasksctrl.MigrateRelations, "GET", "POST")))
+
+	return r
 }
@@ -0,0 +1,199 @@
+package gonawin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"appengine"
+
+	"github.com/taironas/gonawin/helpers"
+	"github.com/taironas/gonawin/helpers/memcache"
+	"github.com/taironas/gonawin/helpers/platform"
+	"github.com/taironas/gonawin/helpers/taskqueue"
+	mdl "github.com/taironas/gonawin/models"
+	"github.com/taironas/gonawin/repository"
+)
+
+// routerUsers are the users calling the protected routes: a user who is not a member of the team,
+// a plain member, an admin of the team and a gonawin admin.
+var routerUsers = []string{"stranger", "member", "teamadmin", "admin"}
+
+// TestRouterPermissions tests that the protected routes of the router are only served to the users
+// granted their permissions: the other users get a 403 and the requests without a valid session a 400.
+// The :userId param of the routes is the plain member, :teamId his team and :tournamentId a tournament of the team owner.
+//
+func TestRouterPermissions(t *testing.T) {
+	taskqueue.Use(droppedQueue{})
+	memcache.Use(memcache.NewMemory())
+	defer repository.Use(repository.Datastore)
+	defer platform.UseStandalone(nil)
+
+	all := routerUsers
+	tests := []struct {
+		method  string
+		pattern string
+		granted []string // users granted the permissions of the route.
+	}{
+		{"GET", "/j/users", []string{"admin"}},
+		{"POST", "/j/users/update/:userId", []string{"member"}},
+		{"POST", "/j/users/destroy/:userId", []string{"member"}},
+		{"GET", "/j/users/:userId/predicts", []string{"member", "admin"}},
+		{"POST", "/j/users/merge/:userId", []string{"admin"}},
+		{"GET", "/j/users/:userId/export", []string{"member"}},
+		{"GET", "/j/users/:userId/deletion", []string{"member", "admin"}},
+		{"POST", "/j/teams/update/:teamId", []string{"teamadmin"}},
+		{"POST", "/j/teams/destroy/:teamId", nil},
+		{"POST", "/j/teams/sendinvite/:teamId/:userId", []string{"member", "teamadmin"}},
+		{"GET", "/j/teams/:teamId/requests", []string{"teamadmin"}},
+		{"POST", "/j/teams/:teamId/requests/allow", []string{"teamadmin"}},
+		{"POST", "/j/teams/:teamId/requests/deny", []string{"teamadmin"}},
+		{"GET", "/j/teams/:teamId/ranking", all},
+		{"POST", "/j/teams/:teamId/prices/update/:tournamentId", []string{"teamadmin"}},
+		{"POST", "/j/teams/:teamId/admin/add/:userId", []string{"teamadmin"}},
+		{"POST", "/j/teams/:teamId/admin/remove/:userId", []string{"teamadmin"}},
+		{"POST", "/j/teams/:teamId/roles/set/:userId/:role", []string{"teamadmin"}},
+		{"POST", "/j/teams/:teamId/owner/transfer/:userId", nil},
+		{"POST", "/j/teams/:teamId/kick/:userId", []string{"teamadmin"}},
+		{"POST", "/j/teams/:teamId/ban/:userId", []string{"teamadmin"}},
+		{"POST", "/j/teams/:teamId/unban/:userId", []string{"teamadmin"}},
+		{"POST", "/j/teams/:teamId/challenges/new/:tournamentId", []string{"teamadmin"}},
+		{"POST", "/j/tournaments/new", []string{"admin"}},
+		{"POST", "/j/tournaments/update/:tournamentId", nil},
+		{"POST", "/j/tournaments/destroy/:tournamentId", nil},
+		{"POST", "/j/tournaments/joinasteam/:tournamentId/:teamId", []string{"teamadmin"}},
+		{"POST", "/j/tournaments/leaveasteam/:tournamentId/:teamId", []string{"teamadmin"}},
+		{"POST", "/j/tournaments/newwc", []string{"admin"}},
+		{"POST", "/j/tournaments/newcl", []string{"admin"}},
+		{"POST", "/j/tournaments/newca", []string{"admin"}},
+		{"POST", "/j/tournaments/neweuro", []string{"admin"}},
+		{"GET", "/j/tournaments/:tournamentId/groups", all},
+		{"GET", "/j/tournaments/:tournamentId/calendar", all},
+		{"GET", "/j/tournaments/:tournamentId/:teamId/calendarwithprediction", all},
+		{"GET", "/j/tournaments/:tournamentId/matches", all},
+		{"POST", "/j/tournaments/:tournamentId/matches/:matchId/update", []string{"admin"}},
+		{"POST", "/j/tournaments/:tournamentId/matches/:matchId/predict", all},
+		{"POST", "/j/tournaments/:tournamentId/matches/:matchId/blockprediction", []string{"admin"}},
+		{"GET", "/j/tournaments/:tournamentId/ranking", all},
+		{"GET", "/j/tournaments/:tournamentId/leaderboard", all},
+		{"POST", "/j/tournaments/:tournamentId/admin/reset", []string{"admin"}},
+		{"POST", "/j/tournaments/:tournamentId/matches/simulate", []string{"admin"}},
+		{"POST", "/j/tournaments/:tournamentId/admin/updateteam", []string{"admin"}},
+		{"POST", "/j/tournaments/:tournamentId/admin/add/:userId", []string{"admin"}},
+		{"POST", "/j/tournaments/:tournamentId/admin/remove/:userId", []string{"admin"}},
+		{"POST", "/j/tournaments/:tournamentId/admin/predictions", []string{"admin"}},
+		{"POST", "/j/tournaments/:tournamentId/admin/activatephase", []string{"admin"}},
+		{"GET", "/j/reports", []string{"admin"}},
+		{"POST", "/j/reports/resolve/:reportId", []string{"admin"}},
+	}
+
+	router := Router()
+	for i, test := range tests {
+		t.Log(test.method, test.pattern)
+
+		// each route is called on new data, as the granted users may change it.
+		params, tokens := newRouterData(t)
+		path := params.Replace(test.pattern)
+
+		serve := func(user string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(test.method, path, nil)
+			req.Header.Set("Authorization", tokens[user])
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			return w
+		}
+
+		if w := serve("anonymous"); w.Code != http.StatusBadRequest {
+			t.Errorf("test %v - Error: anonymous user, want status %d, got %d %s", i, http.StatusBadRequest, w.Code, w.Body.String())
+		}
+		// the denied users are served first, so that they are checked before the data is changed.
+		for _, granted := range []bool{false, true} {
+			for _, user := range routerUsers {
+				if contains(test.granted, user) != granted {
+					continue
+				}
+				// the controller of a granted route can still deny the request, for another reason.
+				w := serve(user)
+				denied := w.Code == http.StatusForbidden && strings.TrimSpace(w.Body.String()) == helpers.ErrorCodeForbidden
+				if !granted && !denied {
+					t.Errorf("test %v - Error: %s, want to be denied the route, got %d %s", i, user, w.Code, w.Body.String())
+				}
+				if granted && denied {
+					t.Errorf("test %v - Error: %s is not granted the route", i, user)
+				}
+			}
+		}
+	}
+}
+
+// newRouterData creates the users calling the routes, with a session each, the team of the plain member and
+// a tournament of the team owner. It returns the params of the routes and the session tokens of the users.
+func newRouterData(t *testing.T) (*strings.Replacer, map[string]string) {
+	repository.Use(repository.NewMemory())
+	platform.UseStandalone(nil)
+
+	c := repository.NewLocalContext(nil)
+
+	users := make(map[string]*mdl.User)
+	tokens := map[string]string{"anonymous": "unknown"}
+	for _, name := range append([]string{"owner"}, routerUsers...) {
+		u, err := mdl.CreateUser(c, name+"@gonawin.com", name, name, "", false, "")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		_, token, err := mdl.CreateSession(c, u.Id, "test")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		users[name] = u
+		tokens[name] = token
+	}
+	platform.UseStandalone([]string{strconv.FormatInt(users["admin"].Id, 10)})
+
+	team, err := mdl.CreateTeam(c, "starks", "winter is coming", users["owner"].Id, false)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	for _, name := range []string{"owner", "teamadmin", "member"} {
+		if err = team.Join(c, users[name]); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+	}
+	if err = team.SetRole(c, users["teamadmin"].Id, mdl.TeamRoleAdmin); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	tournament, err := mdl.CreateTournament(c, "world cup", "", time.Now(), time.Now().AddDate(0, 1, 0), users["owner"].Id)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	params := strings.NewReplacer(
+		":userId", strconv.FormatInt(users["member"].Id, 10),
+		":teamId", strconv.FormatInt(team.Id, 10),
+		":tournamentId", strconv.FormatInt(tournament.Id, 10),
+		":matchId", "1",
+		":reportId", "1",
+		":role", mdl.TeamRoleModerator,
+	)
+	return params, tokens
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// droppedQueue drops the tasks queued by the controllers.
+type droppedQueue struct{}
+
+func (droppedQueue) Add(c appengine.Context, task *taskqueue.Task, queueName string) (*taskqueue.Task, error) {
+	return task, nil
+}
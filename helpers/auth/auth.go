@@ -20,17 +20,18 @@ package auth
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	golog "log"
-	"math/rand"
 	"net/http"
+	"strings"
 
 	"appengine"
-	"appengine/urlfetch"
 	"appengine/user"
 
 	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/platform"
 
 	gwconfig "github.com/taironas/gonawin/config"
 	mdl "github.com/taironas/gonawin/models"
@@ -47,6 +48,7 @@ func init() {
 	var err error
 	if config, err = gwconfig.ReadConfig(""); err != nil {
 		golog.Printf("Error: unable to read config file; %v", err)
+		config = &gwconfig.GwConfig{}
 	}
 	KOfflineMode = config.OfflineMode
 }
@@ -54,9 +56,10 @@ func init() {
 // UserInfo represents the user infor needed for authentication.
 //
 type UserInfo struct {
-	Id    string
-	Email string
-	Name  string
+	Id            string
+	Email         string
+	Name          string
+	EmailVerified bool // the provider verified that the email belongs to the account.
 }
 
 // TwitterUserInfo represents the twitter data needed for authentication.
@@ -67,30 +70,102 @@ type TwitterUserInfo struct {
 	ScreenName string `json:"screen_name,omitempty"`
 }
 
-// CheckUserValidity checks user validity from an accessToken string.
-// verify if google user account is valid.
+// FetchUserInfo returns the info of the account of an accessToken, as returned by the provider url.
+// The provider answers with the account info in JSON when the token is valid. The email is only
+// verified when the provider says so, with the 'verified_email' field of Google.
 //
-func CheckUserValidity(r *http.Request, url string, accessToken string) bool {
-	c := appengine.NewContext(r)
+func FetchUserInfo(r *http.Request, url string, accessToken string) (*UserInfo, error) {
+	c := platform.NewContext(r)
 
 	if len(url) == 0 || len(accessToken) == 0 {
-		return false
+		return nil, errors.New("missing access token")
 	}
 
-	client := urlfetch.Client(c)
+	client := platform.Client(c)
 	resp, err := client.Get(url + "=" + accessToken)
 	if err != nil {
-		log.Errorf(c, " CheckUserValidity: %v", err)
+		log.Errorf(c, " FetchUserInfo: %v", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("access token rejected with status %d", resp.StatusCode)
 	}
 
-	return resp.StatusCode == 200
+	var info struct {
+		Id            string `json:"id"`
+		UserId        string `json:"user_id"`
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"verified_email"`
+		Name          string `json:"name"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, err
+	}
+	if len(info.Id) == 0 {
+		info.Id = info.UserId
+	}
+	if len(info.Id) == 0 {
+		return nil, errors.New("no account id in provider response")
+	}
+	return &UserInfo{Id: info.Id, Email: info.Email, Name: info.Name, EmailVerified: info.EmailVerified && len(info.Email) > 0}, nil
 }
 
 // CheckAuthenticationData checks if authorization information in HTTP.Request is valid,
-// ie: if it matches a user.
+// ie: if it matches an active session of a user. The expiry of the session is extended.
 //
 func CheckAuthenticationData(r *http.Request) *mdl.User {
-	return mdl.FindUser(appengine.NewContext(r), "Auth", r.Header.Get("Authorization"))
+	c := platform.NewContext(r)
+
+	s, err := CurrentSession(r)
+	if err != nil {
+		return nil
+	}
+	if err = s.Refresh(c); err != nil {
+		log.Errorf(c, " CheckAuthenticationData: unable to refresh session %d: %v", s.Id, err)
+	}
+
+	u, err := mdl.UserByID(c, s.UserId)
+	if err != nil {
+		log.Errorf(c, " CheckAuthenticationData: user %d of session %d not found: %v", s.UserId, s.Id, err)
+		return nil
+	}
+	return u
+}
+
+// CheckAccessToken checks if authorization information in HTTP.Request is a personal access token of a user.
+// It returns the user and the token, whose last use is recorded.
+//
+func CheckAccessToken(r *http.Request) (*mdl.User, *mdl.AccessToken) {
+	c := platform.NewContext(r)
+
+	t, err := mdl.AccessTokenByToken(c, SessionToken(r))
+	if err != nil {
+		return nil, nil
+	}
+	if err = t.Use(c); err != nil {
+		log.Errorf(c, " CheckAccessToken: unable to record use of access token %d: %v", t.Id, err)
+	}
+
+	u, err := mdl.UserByID(c, t.UserId)
+	if err != nil {
+		log.Errorf(c, " CheckAccessToken: user %d of access token %d not found: %v", t.UserId, t.Id, err)
+		return nil, nil
+	}
+	return u, t
+}
+
+// SessionToken returns the session token, or the personal access token, sent in the Authorization header of a request.
+//
+func SessionToken(r *http.Request) string {
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
+
+// CurrentSession returns the session matching the token of a request.
+//
+func CurrentSession(r *http.Request) (*mdl.Session, error) {
+	return mdl.SessionByToken(platform.NewContext(r), SessionToken(r))
 }
 
 // Is app in offline mode and email an offline user.
@@ -103,8 +178,17 @@ func isEmailOfflineUser(email string) bool {
 
 // IsGonawinAdmin checks if user is gonawin admin.
 //
-func IsGonawinAdmin(c appengine.Context) bool {
-	return user.IsAdmin(c)
+func IsGonawinAdmin(c appengine.Context, u *mdl.User) bool {
+	if u == nil {
+		return platform.IsAdmin(c, 0, nil)
+	}
+	var accounts []string
+	if platform.Standalone() {
+		for _, i := range u.Identities(c) {
+			accounts = append(accounts, i.Account())
+		}
+	}
+	return platform.IsAdmin(c, u.Id, accounts)
 }
 
 // FetchTwitterUserInfo unmarshals twitter response
@@ -130,7 +214,7 @@ func CurrentOfflineUser(r *http.Request, c appengine.Context) *mdl.User {
 	var u *mdl.User
 	if config.OfflineMode {
 		if currentUser := mdl.FindUser(c, "Username", config.OfflineUser.Name); currentUser == nil {
-			u, _ = mdl.CreateUser(c, config.OfflineUser.Email, config.OfflineUser.Name, config.OfflineUser.Username, "", true, mdl.GenerateAuthKey())
+			u, _ = mdl.CreateUser(c, config.OfflineUser.Email, config.OfflineUser.Name, config.OfflineUser.Username, "", true, "")
 		} else {
 			u = currentUser
 		}
@@ -140,11 +224,12 @@ func CurrentOfflineUser(r *http.Request, c appengine.Context) *mdl.User {
 
 // GetUserGoogleInfo returns user information from Google Accounts user.
 // If on development server only email (example@example.com) will be present.
-// So Id and Name will be added.
+// So the email is used as Id, so that the user signs in to the same account, and Name is added.
+// The email of a Google account is verified by Google.
 //
 func GetUserGoogleInfo(u *user.User) UserInfo {
-	if appengine.IsDevAppServer() {
-		return UserInfo{Id: fmt.Sprintf("%d", rand.Int63()), Email: u.Email, Name: "John Smith"}
+	if platform.IsDevAppServer() {
+		return UserInfo{Id: u.Email, Email: u.Email, Name: "John Smith", EmailVerified: true}
 	}
-	return UserInfo{Id: u.ID, Email: u.Email, Name: u.String()}
+	return UserInfo{Id: u.ID, Email: u.Email, Name: u.String(), EmailVerified: true}
 }
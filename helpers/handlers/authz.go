@@ -0,0 +1,181 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"appengine"
+
+	"github.com/taironas/gonawin/extract"
+	"github.com/taironas/gonawin/helpers"
+	"github.com/taironas/gonawin/helpers/auth"
+	"github.com/taironas/gonawin/helpers/log"
+
+	mdl "github.com/taironas/gonawin/models"
+)
+
+// Permission is a rule the current user must satisfy to call a handler.
+// Routes declare their permissions in main.go, they are checked with the teams,
+// tournaments and users of the route params before the handler is called.
+//
+type Permission struct {
+	name  string
+	scope string // scope of the personal access tokens allowed, cf TokenScope.
+	allow func(c appengine.Context, x extract.Context, u *mdl.User) (bool, error)
+}
+
+// String returns the name of the permission, as declared in main.go.
+//
+func (p Permission) String() string {
+	return p.name
+}
+
+var (
+	// SiteAdmin is granted to the gonawin admins.
+	SiteAdmin = Permission{name: "SiteAdmin", allow: func(c appengine.Context, x extract.Context, u *mdl.User) (bool, error) {
+		return auth.IsGonawinAdmin(c, u), nil
+	}}
+
+	// TournamentAdmin is granted to the admins of the :tournamentId tournament.
+	TournamentAdmin = Permission{name: "TournamentAdmin", allow: func(c appengine.Context, x extract.Context, u *mdl.User) (bool, error) {
+		tournament, err := x.Tournament()
+		if err != nil {
+			return false, err
+		}
+		ok, _ := tournament.ContainsAdminID(u.Id)
+		return ok, nil
+	}}
+
+	// TeamOwner is granted to the owners of the :teamId team.
+	TeamOwner = teamPermission("TeamOwner", func(c appengine.Context, team *mdl.Team, u *mdl.User) bool {
+		return team.IsOwner(u.Id)
+	})
+
+	// TeamAdmin is granted to the owners and the admins of the :teamId team.
+	TeamAdmin = teamPermission("TeamAdmin", func(c appengine.Context, team *mdl.Team, u *mdl.User) bool {
+		role := team.Role(c, u.Id)
+		return role == mdl.TeamRoleOwner || role == mdl.TeamRoleAdmin
+	})
+
+	// TeamMember is granted to the members of the :teamId team.
+	TeamMember = teamPermission("TeamMember", func(c appengine.Context, team *mdl.Team, u *mdl.User) bool {
+		return team.Joined(c, u)
+	})
+
+	// Self is granted to the :userId user.
+	Self = Permission{name: "Self", allow: func(c appengine.Context, x extract.Context, u *mdl.User) (bool, error) {
+		userID, err := x.UserId()
+		if err != nil {
+			return false, err
+		}
+		return userID == u.Id, nil
+	}}
+)
+
+// TeamPermission is granted to the users whose role in the :teamId team has the given permission,
+// one of mdl.TeamPermissions.
+//
+func TeamPermission(permission string) Permission {
+	return teamPermission("TeamPermission("+permission+")", func(c appengine.Context, team *mdl.Team, u *mdl.User) bool {
+		return team.HasPermission(c, u.Id, permission)
+	})
+}
+
+// TokenScope allows the personal access tokens with the given scope, one of mdl.AccessTokenScopes,
+// to call the route. Routes without TokenScope cannot be called with personal access tokens.
+// It is always granted to users signed in with a session.
+//
+func TokenScope(scope string) Permission {
+	return Permission{name: "TokenScope(" + scope + ")", scope: scope, allow: func(c appengine.Context, x extract.Context, u *mdl.User) (bool, error) {
+		return true, nil
+	}}
+}
+
+// AnyOf is granted to the users who are granted one of the given permissions.
+//
+func AnyOf(perms ...Permission) Permission {
+	names := make([]string, len(perms))
+	for i, p := range perms {
+		names[i] = p.name
+	}
+
+	return Permission{name: "AnyOf(" + strings.Join(names, ", ") + ")", allow: func(c appengine.Context, x extract.Context, u *mdl.User) (bool, error) {
+		var firstErr error
+		for _, p := range perms {
+			ok, err := p.allow(c, x, u)
+			if ok {
+				return true, nil
+			}
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		return false, firstErr
+	}}
+}
+
+// teamPermission returns a permission granted on the :teamId team.
+func teamPermission(name string, allow func(c appengine.Context, team *mdl.Team, u *mdl.User) bool) Permission {
+	return Permission{name: name, allow: func(c appengine.Context, x extract.Context, u *mdl.User) (bool, error) {
+		team, err := x.Team()
+		if err != nil {
+			return false, err
+		}
+		return allow(c, team, u), nil
+	}}
+}
+
+// authorize checks that the current user is granted all the permissions of a route.
+// It returns a Forbidden error for the first permission he is not granted, or the error
+// of the route params, like a NotFound error for an unknown team.
+func authorize(c appengine.Context, r *http.Request, u *mdl.User, perms []Permission) error {
+	desc := "Authorize:"
+	x := extract.NewContext(c, desc, r)
+
+	for _, p := range perms {
+		ok, err := p.allow(c, x, u)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			log.Errorf(c, "%s user %d is not granted %s on %s", desc, u.Id, p, r.URL.Path)
+			return &helpers.Forbidden{Err: errors.New(helpers.ErrorCodeForbidden)}
+		}
+	}
+	return nil
+}
+
+// authorizeAccessToken checks that a personal access token can call a route: the route must allow
+// one of the scopes of the token and the token must be under its rate limit.
+func authorizeAccessToken(c appengine.Context, r *http.Request, t *mdl.AccessToken, perms []Permission) error {
+	allowed := false
+	for _, p := range perms {
+		if len(p.scope) > 0 && t.HasScope(p.scope) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		log.Errorf(c, "Authorize: access token %d of user %d cannot call %s", t.Id, t.UserId, r.URL.Path)
+		return &helpers.Forbidden{Err: errors.New(helpers.ErrorCodeAccessTokenScope)}
+	}
+
+	return limitAccessToken(c, t)
+}
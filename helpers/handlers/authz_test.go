@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/taironas/route"
+
+	"github.com/taironas/gonawin/helpers/memcache"
+	"github.com/taironas/gonawin/helpers/platform"
+	mdl "github.com/taironas/gonawin/models"
+	"github.com/taironas/gonawin/repository"
+)
+
+// TestAuthorized tests that the permissions of a route are checked with its params before calling the handler.
+//
+func TestAuthorized(t *testing.T) {
+	platform.UseStandalone(nil)
+	repository.Use(repository.NewMemory())
+	defer repository.Use(repository.Datastore)
+	memcache.Use(memcache.NewMemory())
+
+	c := repository.NewLocalContext(nil)
+
+	users := make(map[string]*mdl.User)
+	tokens := make(map[string]string)
+	for _, name := range []string{"admin", "accountadmin", "owner", "teamadmin", "moderator", "member", "stranger", "tournamentadmin"} {
+		u, err := mdl.CreateUser(c, name+"@gonawin.com", name, name, "", false, "")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		_, token, err := mdl.CreateSession(c, u.Id, "test")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		users[name] = u
+		tokens[name] = token
+	}
+
+	// admins are configured by user id and by account, an email does not make a user admin.
+	if err := users["accountadmin"].LinkIdentity(c, mdl.IdentityGoogle, "1234"); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	platform.UseStandalone([]string{strconv.FormatInt(users["admin"].Id, 10), "google/1234", "stranger@gonawin.com"})
+	defer platform.UseStandalone(nil)
+
+	team, err := mdl.CreateTeam(c, "starks", "winter is coming", users["owner"].Id, false)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	for name, role := range map[string]string{"owner": mdl.TeamRoleOwner, "teamadmin": mdl.TeamRoleAdmin, "moderator": mdl.TeamRoleModerator, "member": mdl.TeamRoleMember} {
+		if err = team.Join(c, users[name]); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if role != mdl.TeamRoleOwner && role != mdl.TeamRoleMember {
+			if err = team.SetRole(c, users[name].Id, role); err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+		}
+	}
+
+	tournament, err := mdl.CreateTournament(c, "world cup", "", time.Now(), time.Now(), users["tournamentadmin"].Id)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	teamPath := fmt.Sprintf("/j/teams/%d", team.Id)
+	tournamentPath := fmt.Sprintf("/j/tournaments/%d", tournament.Id)
+	ownerPath := fmt.Sprintf("/j/users/%d", users["owner"].Id)
+
+	tests := []struct {
+		title   string
+		pattern string
+		path    string
+		perms   []Permission
+		user    string
+		status  int
+	}{
+		{title: "no permission, signed in user", pattern: "/j/teams", path: "/j/teams", user: "stranger", status: http.StatusOK},
+		{title: "no permission, anonymous user", pattern: "/j/teams", path: "/j/teams", status: http.StatusBadRequest},
+		{title: "site admin, admin", pattern: "/j/users", path: "/j/users", perms: []Permission{SiteAdmin}, user: "admin", status: http.StatusOK},
+		{title: "site admin, user", pattern: "/j/users", path: "/j/users", perms: []Permission{SiteAdmin}, user: "owner", status: http.StatusForbidden},
+		{title: "site admin, admin by account", pattern: "/j/users", path: "/j/users", perms: []Permission{SiteAdmin}, user: "accountadmin", status: http.StatusOK},
+		{title: "site admin, user with the email of an admin", pattern: "/j/users", path: "/j/users", perms: []Permission{SiteAdmin}, user: "stranger", status: http.StatusForbidden},
+		{title: "self, same user", pattern: "/j/users/:userId", path: ownerPath, perms: []Permission{Self}, user: "owner", status: http.StatusOK},
+		{title: "self, another user", pattern: "/j/users/:userId", path: ownerPath, perms: []Permission{Self}, user: "admin", status: http.StatusForbidden},
+		{title: "self, invalid user id", pattern: "/j/users/:userId", path: "/j/users/john", perms: []Permission{Self}, user: "owner", status: http.StatusBadRequest},
+		{title: "self or site admin, site admin", pattern: "/j/users/:userId", path: ownerPath, perms: []Permission{AnyOf(Self, SiteAdmin)}, user: "admin", status: http.StatusOK},
+		{title: "self or site admin, another user", pattern: "/j/users/:userId", path: ownerPath, perms: []Permission{AnyOf(Self, SiteAdmin)}, user: "member", status: http.StatusForbidden},
+		{title: "team owner, owner", pattern: "/j/teams/:teamId", path: teamPath, perms: []Permission{TeamOwner}, user: "owner", status: http.StatusOK},
+		{title: "team owner, admin", pattern: "/j/teams/:teamId", path: teamPath, perms: []Permission{TeamOwner}, user: "teamadmin", status: http.StatusForbidden},
+		{title: "team admin, owner", pattern: "/j/teams/:teamId", path: teamPath, perms: []Permission{TeamAdmin}, user: "owner", status: http.StatusOK},
+		{title: "team admin, admin", pattern: "/j/teams/:teamId", path: teamPath, perms: []Permission{TeamAdmin}, user: "teamadmin", status: http.StatusOK},
+		{title: "team admin, moderator", pattern: "/j/teams/:teamId", path: teamPath, perms: []Permission{TeamAdmin}, user: "moderator", status: http.StatusForbidden},
+		{title: "team admin, site admin", pattern: "/j/teams/:teamId", path: teamPath, perms: []Permission{TeamAdmin}, user: "admin", status: http.StatusForbidden},
+		{title: "team admin, unknown team", pattern: "/j/teams/:teamId", path: "/j/teams/666", perms: []Permission{TeamAdmin}, user: "owner", status: http.StatusNotFound},
+		{title: "team member, member", pattern: "/j/teams/:teamId", path: teamPath, perms: []Permission{TeamMember}, user: "member", status: http.StatusOK},
+		{title: "team member, stranger", pattern: "/j/teams/:teamId", path: teamPath, perms: []Permission{TeamMember}, user: "stranger", status: http.StatusForbidden},
+		{title: "team permission, granted role", pattern: "/j/teams/:teamId", path: teamPath, perms: []Permission{TeamPermission(mdl.TeamPermissionApproveRequests)}, user: "moderator", status: http.StatusOK},
+		{title: "team permission, role without the permission", pattern: "/j/teams/:teamId", path: teamPath, perms: []Permission{TeamPermission(mdl.TeamPermissionApproveRequests)}, user: "member", status: http.StatusForbidden},
+		{title: "team permission, owner only", pattern: "/j/teams/:teamId", path: teamPath, perms: []Permission{TeamPermission(mdl.TeamPermissionDelete)}, user: "teamadmin", status: http.StatusForbidden},
+		{title: "tournament admin, admin", pattern: "/j/tournaments/:tournamentId", path: tournamentPath, perms: []Permission{TournamentAdmin}, user: "tournamentadmin", status: http.StatusOK},
+		{title: "tournament admin, user", pattern: "/j/tournaments/:tournamentId", path: tournamentPath, perms: []Permission{TournamentAdmin}, user: "owner", status: http.StatusForbidden},
+		{title: "tournament admin, unknown tournament", pattern: "/j/tournaments/:tournamentId", path: "/j/tournaments/666", perms: []Permission{TournamentAdmin}, user: "tournamentadmin", status: http.StatusNotFound},
+		{title: "all permissions, only one granted", pattern: "/j/tournaments/:tournamentId", path: tournamentPath, perms: []Permission{SiteAdmin, TournamentAdmin}, user: "tournamentadmin", status: http.StatusForbidden},
+		{title: "any permission, none granted", pattern: "/j/teams/:teamId", path: teamPath, perms: []Permission{AnyOf(TeamOwner, SiteAdmin)}, user: "member", status: http.StatusForbidden},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+
+		called := false
+		r := new(route.Router)
+		r.HandleFunc(test.pattern, ErrorHandler(Authorized(func(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
+			called = true
+			return nil
+		}, test.perms...)))
+
+		req, _ := http.NewRequest("GET", test.path, nil)
+		if len(test.user) > 0 {
+			req.Header.Set("Authorization", tokens[test.user])
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != test.status {
+			t.Errorf("test %v - Error: want status %d, got %d %s", i, test.status, w.Code, w.Body.String())
+		}
+		if called != (test.status == http.StatusOK) {
+			t.Errorf("test %v - Error: handler called: %v", i, called)
+		}
+	}
+}
+
+// TestPermissionString tests the names of the permissions, as declared in main.go.
+//
+func TestPermissionString(t *testing.T) {
+	tests := []struct {
+		perm Permission
+		want string
+	}{
+		{SiteAdmin, "SiteAdmin"},
+		{TeamPermission(mdl.TeamPermissionUpdate), "TeamPermission(update)"},
+		{AnyOf(Self, SiteAdmin), "AnyOf(Self, SiteAdmin)"},
+	}
+
+	for i, test := range tests {
+		if got := test.perm.String(); got != test.want {
+			t.Errorf("test %v - Error: want %q, got %q", i, test.want, got)
+		}
+	}
+}
+
+// TestAuthorizedAccessToken tests that personal access tokens can only call the routes allowing one of their scopes.
+//
+func TestAuthorizedAccessToken(t *testing.T) {
+	platform.UseStandalone(nil)
+	repository.Use(repository.NewMemory())
+	defer repository.Use(repository.Datastore)
+	memcache.Use(memcache.NewMemory())
+
+	rateLimits["tokens"] = RateLimit{PerUser: 3, Period: time.Hour}
+	defer func() { rateLimits["tokens"] = RateLimit{PerUser: 600, Period: time.Hour} }()
+
+	c := repository.NewLocalContext(nil)
+
+	u, err := mdl.CreateUser(c, "arya@gonawin.com", "arya", "arya", "", false, "")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	_, session, err := mdl.CreateSession(c, u.Id, "test")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	at, token, err := mdl.CreateAccessToken(c, u.Id, "ranking bot", []string{mdl.ScopeReadRankings})
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	tests := []struct {
+		title  string
+		perms  []Permission
+		token  string
+		status int
+	}{
+		{title: "token with the scope of the route", perms: []Permission{TokenScope(mdl.ScopeReadRankings)}, token: token, status: http.StatusOK},
+		{title: "token with one of the scopes of the route", perms: []Permission{TokenScope(mdl.ScopeReadCalendar), TokenScope(mdl.ScopeReadRankings)}, token: token, status: http.StatusOK},
+		{title: "token without the scope of the route", perms: []Permission{TokenScope(mdl.ScopeWritePredictions)}, token: token, status: http.StatusForbidden},
+		{title: "token on a route without scope", token: token, status: http.StatusForbidden},
+		{title: "token with the scope, missing permission", perms: []Permission{TokenScope(mdl.ScopeReadRankings), SiteAdmin}, token: token, status: http.StatusForbidden},
+		{title: "session on a route with a scope", perms: []Permission{TokenScope(mdl.ScopeWritePredictions)}, token: session, status: http.StatusOK},
+		{title: "unknown token", perms: []Permission{TokenScope(mdl.ScopeReadRankings)}, token: mdl.AccessTokenPrefix + "foo", status: http.StatusBadRequest},
+		{title: "token above its rate limit", perms: []Permission{TokenScope(mdl.ScopeReadRankings)}, token: token, status: http.StatusTooManyRequests},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+
+		called := false
+		r := new(route.Router)
+		r.HandleFunc("/j/tournaments", ErrorHandler(Authorized(func(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
+			called = true
+			return nil
+		}, test.perms...)))
+
+		req, _ := http.NewRequest("GET", "/j/tournaments", nil)
+		req.Header.Set("Authorization", "Bearer "+test.token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != test.status {
+			t.Errorf("test %v - Error: want status %d, got %d %s", i, test.status, w.Code, w.Body.String())
+		}
+		if called != (test.status == http.StatusOK) {
+			t.Errorf("test %v - Error: handler called: %v", i, called)
+		}
+	}
+
+	got, err := mdl.AccessTokenByToken(c, token)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if got.Id != at.Id || got.LastUsed.IsZero() {
+		t.Errorf("Error: want the last use of the token to be recorded, got %v", got.LastUsed)
+	}
+}
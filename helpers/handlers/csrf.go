@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+
+	"github.com/taironas/gonawin/helpers"
+	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/platform"
+)
+
+const (
+	// CSRFCookie is the cookie holding the CSRF token of the browser.
+	// The web app reads it and sends it back in the CSRFHeader, as AngularJS does for XSRF-TOKEN.
+	CSRFCookie = "XSRF-TOKEN"
+	// CSRFHeader is the header the CSRF token is sent back in.
+	CSRFHeader = "X-XSRF-TOKEN"
+)
+
+// CSRF runs the function pass by parameter and checks that a request changing data was not forged by another site.
+// GET and HEAD requests set the CSRF cookie of the browser if it is missing. Other requests are
+// accepted when they carry an Authorization header or are issued by App Engine (task queues, cron),
+// as no other site can add headers to the requests of a browser. Requests relying on cookies only,
+// such as the App Engine login of admin handlers, must send the token of the CSRF cookie in the
+// CSRF header. Will rise a forbidden error otherwise.
+//
+func CSRF(f func(w http.ResponseWriter, r *http.Request) error) ErrorHandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		cookie, err := r.Cookie(CSRFCookie)
+		if r.Method == "GET" || r.Method == "HEAD" {
+			if err != nil || len(cookie.Value) == 0 {
+				setCSRFCookie(w, r)
+			}
+			return f(w, r)
+		}
+
+		if !csrfExempt(r) && (err != nil || !validCSRFToken(cookie.Value, r.Header.Get(CSRFHeader))) {
+			c := platform.NewContext(r)
+			log.Errorf(c, "CSRF: %s %s has no valid CSRF token", r.Method, r.URL.Path)
+			return &helpers.Forbidden{Err: errors.New(helpers.ErrorCodeCSRFTokenNotValid)}
+		}
+		return f(w, r)
+	}
+}
+
+// csrfExempt reports whether the request cannot be sent by a browser on behalf of another site.
+func csrfExempt(r *http.Request) bool {
+	return len(r.Header.Get("Authorization")) > 0 ||
+		len(r.Header.Get("X-AppEngine-QueueName")) > 0 ||
+		len(r.Header.Get("X-AppEngine-Cron")) > 0
+}
+
+// validCSRFToken reports whether the token sent in the header is the token of the cookie.
+func validCSRFToken(cookie, header string) bool {
+	return len(cookie) > 0 && subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) == 1
+}
+
+// setCSRFCookie sets a new CSRF token in the cookie of the browser.
+// The cookie is read by the web app so it is not HttpOnly.
+func setCSRFCookie(w http.ResponseWriter, r *http.Request) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		c := platform.NewContext(r)
+		log.Errorf(c, "CSRF: unable to generate token: %v", err)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:   CSRFCookie,
+		Value:  base64.RawURLEncoding.EncodeToString(b),
+		Path:   "/",
+		Secure: r.TLS != nil,
+	})
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestCSRF tests that requests changing data must carry a header no other site can send.
+//
+func TestCSRF(t *testing.T) {
+	tests := []struct {
+		title   string
+		method  string
+		headers map[string]string
+		cookie  string
+		status  int
+	}{
+		{title: "GET request without token", method: "GET", status: http.StatusOK},
+		{title: "POST request with the token of the cookie", method: "POST", cookie: "secret", headers: map[string]string{CSRFHeader: "secret"}, status: http.StatusOK},
+		{title: "POST request with an Authorization header", method: "POST", headers: map[string]string{"Authorization": "token"}, status: http.StatusOK},
+		{title: "POST request from a task queue", method: "POST", headers: map[string]string{"X-AppEngine-QueueName": "default"}, status: http.StatusOK},
+		{title: "POST request from cron", method: "POST", headers: map[string]string{"X-AppEngine-Cron": "true"}, status: http.StatusOK},
+		{title: "POST request with cookies only", method: "POST", cookie: "secret", status: http.StatusForbidden},
+		{title: "POST request with another token", method: "POST", cookie: "secret", headers: map[string]string{CSRFHeader: "guess"}, status: http.StatusForbidden},
+		{title: "POST request with a token and no cookie", method: "POST", headers: map[string]string{CSRFHeader: "secret"}, status: http.StatusForbidden},
+		{title: "POST request with an empty token", method: "POST", cookie: "", headers: map[string]string{CSRFHeader: ""}, status: http.StatusForbidden},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+
+		called := false
+		h := ErrorHandler(CSRF(func(w http.ResponseWriter, r *http.Request) error {
+			called = true
+			return nil
+		}))
+
+		r, _ := http.NewRequest(test.method, "/a/rebuild/leaderboards", nil)
+		for k, v := range test.headers {
+			r.Header.Set(k, v)
+		}
+		if len(test.cookie) > 0 {
+			r.AddCookie(&http.Cookie{Name: CSRFCookie, Value: test.cookie})
+		}
+		w := httptest.NewRecorder()
+		h(w, r)
+
+		if w.Code != test.status {
+			t.Errorf("test %v - Error: want status %d, got %d", i, test.status, w.Code)
+		}
+		if called != (test.status == http.StatusOK) {
+			t.Errorf("test %v - Error: handler called: %v", i, called)
+		}
+	}
+}
+
+// TestCSRFCookie tests that GET requests give a CSRF token to browsers without one.
+//
+func TestCSRFCookie(t *testing.T) {
+	h := ErrorHandler(CSRF(func(w http.ResponseWriter, r *http.Request) error { return nil }))
+
+	r, _ := http.NewRequest("GET", "/j/teams", nil)
+	w := httptest.NewRecorder()
+	h(w, r)
+
+	cookies := (&http.Response{Header: w.Header()}).Cookies()
+	if len(cookies) != 1 || cookies[0].Name != CSRFCookie || len(cookies[0].Value) == 0 || cookies[0].HttpOnly {
+		t.Fatalf("Error: want a %s cookie readable by the web app, got %v", CSRFCookie, cookies)
+	}
+
+	r, _ = http.NewRequest("GET", "/j/teams", nil)
+	r.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	h(w, r)
+	if len(w.Header()["Set-Cookie"]) != 0 {
+		t.Errorf("Error: want the CSRF cookie to be kept, got %v", w.Header()["Set-Cookie"])
+	}
+
+	r, _ = http.NewRequest("POST", "/j/teams", nil)
+	r.AddCookie(cookies[0])
+	r.Header.Set(CSRFHeader, cookies[0].Value)
+	w = httptest.NewRecorder()
+	h(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("Error: want status %d with the token of the cookie, got %d", http.StatusOK, w.Code)
+	}
+}
@@ -23,12 +23,12 @@ package handlers
 import (
 	"errors"
 	"net/http"
-
-	"appengine"
+	"strings"
 
 	"github.com/taironas/gonawin/helpers"
 	"github.com/taironas/gonawin/helpers/auth"
 	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/platform"
 
 	mdl "github.com/taironas/gonawin/models"
 )
@@ -52,12 +52,18 @@ func ErrorHandler(f func(w http.ResponseWriter, r *http.Request) error) http.Han
 			http.Error(w, err.Error(), http.StatusNotFound)
 		case *helpers.Forbidden:
 			http.Error(w, err.Error(), http.StatusForbidden)
+		case *helpers.MethodNotAllowed:
+			w.Header().Set("Allow", strings.Join(err.(*helpers.MethodNotAllowed).Allow, ", "))
+			http.Error(w, err.Error(), http.StatusMethodNotAllowed)
+		case *helpers.TooManyRequests:
+			w.Header().Set("Retry-After", retryAfter(err.(*helpers.TooManyRequests).RetryAfter))
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
 		case *helpers.Unauthorized:
 			http.Error(w, err.Error(), http.StatusUnauthorized)
 		case *helpers.InternalServerError:
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		default:
-			c := appengine.NewContext(r)
+			c := platform.NewContext(r)
 			log.Errorf(c, "%v", err)
 			http.Error(w, "Sorry, something went wrong.", http.StatusInternalServerError)
 		}
@@ -66,12 +72,19 @@ func ErrorHandler(f func(w http.ResponseWriter, r *http.Request) error) http.Han
 
 // Authorized runs the function pass by parameter and checks authentication data prior to any call.
 // Will rise a bad request error handler if authentication fails.
+// The user must also be granted all the given permissions, cf Permission.
+// Personal access tokens are accepted if the route allows one of their scopes, cf TokenScope.
 //
-func Authorized(f func(w http.ResponseWriter, r *http.Request, u *mdl.User) error) ErrorHandlerFunc {
+func Authorized(f func(w http.ResponseWriter, r *http.Request, u *mdl.User) error, perms ...Permission) ErrorHandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) error {
+		c := platform.NewContext(r)
+
 		var user *mdl.User
+		var token *mdl.AccessToken
 		if auth.KOfflineMode {
-			user = auth.CurrentOfflineUser(r, appengine.NewContext(r))
+			user = auth.CurrentOfflineUser(r, c)
+		} else if mdl.IsAccessToken(auth.SessionToken(r)) {
+			user, token = auth.CheckAccessToken(r)
 		} else {
 			user = auth.CheckAuthenticationData(r)
 		}
@@ -80,6 +93,20 @@ func Authorized(f func(w http.ResponseWriter, r *http.Request, u *mdl.User) erro
 			return &helpers.BadRequest{Err: errors.New("Bad Authentication data")}
 		}
 
+		if err := limitUser(c, r, user); err != nil {
+			return err
+		}
+
+		if token != nil {
+			if err := authorizeAccessToken(c, r, token, perms); err != nil {
+				return err
+			}
+		}
+
+		if err := authorize(c, r, user, perms); err != nil {
+			return err
+		}
+
 		return f(w, r, user)
 	}
 }
@@ -88,19 +115,5 @@ func Authorized(f func(w http.ResponseWriter, r *http.Request, u *mdl.User) erro
 // Will rise a bad request error handler if authentication fails. User should be a gonawin admin .
 //
 func AdminAuthorized(f func(w http.ResponseWriter, r *http.Request, u *mdl.User) error) ErrorHandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) error {
-		var user *mdl.User
-		if auth.KOfflineMode {
-			user = auth.CurrentOfflineUser(r, appengine.NewContext(r))
-		} else {
-			user = auth.CheckAuthenticationData(r)
-			if user == nil {
-				return &helpers.BadRequest{Err: errors.New("Bad Authentication data")}
-			}
-		}
-		if !auth.IsGonawinAdmin(appengine.NewContext(r)) { //user) {
-			return &helpers.Forbidden{Err: errors.New(helpers.ErrorCodeSessionsForbiden)}
-		}
-		return f(w, r, user)
-	}
+	return Authorized(f, SiteAdmin)
 }
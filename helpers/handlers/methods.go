@@ -0,0 +1,61 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/taironas/gonawin/helpers"
+)
+
+// Methods runs the function pass by parameter if the request method is one of the given methods.
+// Will rise a method not allowed error with the allowed methods otherwise.
+// A GET route also serves HEAD requests. Requests which are not GET or HEAD are checked against
+// cross site request forgery, cf CSRF.
+//
+func Methods(f func(w http.ResponseWriter, r *http.Request) error, methods ...string) ErrorHandlerFunc {
+	allow := make([]string, 0, len(methods)+1)
+	for _, m := range methods {
+		allow = append(allow, m)
+		if m == "GET" {
+			allow = append(allow, "HEAD")
+		}
+	}
+	csrf := CSRF(f)
+
+	return func(w http.ResponseWriter, r *http.Request) error {
+		for _, m := range allow {
+			if r.Method == m {
+				return csrf(w, r)
+			}
+		}
+		return &helpers.MethodNotAllowed{Err: errors.New(helpers.ErrorCodeMethodNotAllowed), Allow: allow}
+	}
+}
+
+// Get runs the function pass by parameter on GET requests only, cf Methods.
+//
+func Get(f func(w http.ResponseWriter, r *http.Request) error) ErrorHandlerFunc {
+	return Methods(f, "GET")
+}
+
+// Post runs the function pass by parameter on POST requests only, cf Methods.
+//
+func Post(f func(w http.ResponseWriter, r *http.Request) error) ErrorHandlerFunc {
+	return Methods(f, "POST")
+}
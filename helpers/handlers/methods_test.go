@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestMethods tests that a route only serves its methods and answers the others with its Allow header.
+//
+func TestMethods(t *testing.T) {
+	tests := []struct {
+		title   string
+		methods []string
+		method  string
+		status  int
+		allow   string
+	}{
+		{title: "GET route, GET request", methods: []string{"GET"}, method: "GET", status: http.StatusOK},
+		{title: "GET route, HEAD request", methods: []string{"GET"}, method: "HEAD", status: http.StatusOK},
+		{title: "GET route, POST request", methods: []string{"GET"}, method: "POST", status: http.StatusMethodNotAllowed, allow: "GET, HEAD"},
+		{title: "POST route, POST request", methods: []string{"POST"}, method: "POST", status: http.StatusOK},
+		{title: "POST route, GET request", methods: []string{"POST"}, method: "GET", status: http.StatusMethodNotAllowed, allow: "POST"},
+		{title: "POST route, DELETE request", methods: []string{"POST"}, method: "DELETE", status: http.StatusMethodNotAllowed, allow: "POST"},
+		{title: "GET and POST route, POST request", methods: []string{"GET", "POST"}, method: "POST", status: http.StatusOK},
+		{title: "GET and POST route, PUT request", methods: []string{"GET", "POST"}, method: "PUT", status: http.StatusMethodNotAllowed, allow: "GET, HEAD, POST"},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+
+		called := false
+		h := ErrorHandler(Methods(func(w http.ResponseWriter, r *http.Request) error {
+			called = true
+			return nil
+		}, test.methods...))
+
+		r, _ := http.NewRequest(test.method, "/j/teams", nil)
+		r.Header.Set("Authorization", "token")
+		w := httptest.NewRecorder()
+		h(w, r)
+
+		if w.Code != test.status {
+			t.Errorf("test %v - Error: want status %d, got %d", i, test.status, w.Code)
+		}
+		if got := w.Header().Get("Allow"); got != test.allow {
+			t.Errorf("test %v - Error: want Allow header %q, got %q", i, test.allow, got)
+		}
+		if called != (test.status == http.StatusOK) {
+			t.Errorf("test %v - Error: handler called: %v", i, called)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	golog "log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"appengine"
+
+	gwconfig "github.com/taironas/gonawin/config"
+	"github.com/taironas/gonawin/helpers"
+	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/memcache"
+	"github.com/taironas/gonawin/helpers/platform"
+
+	mdl "github.com/taironas/gonawin/models"
+)
+
+// RateLimit is the number of requests a user and an IP address can send to a group of routes in a period.
+// A zero number means no limit.
+//
+type RateLimit struct {
+	PerUser int // requests of each user, all his sessions and personal access tokens together.
+	PerIP   int // requests of each IP address, signed in or not.
+	Period  time.Duration
+}
+
+// rateLimits holds the rate limit of each group of routes, they can be overridden in the
+// rateLimits section of config.json.
+var rateLimits = map[string]RateLimit{
+	"invite":        {PerUser: 10, PerIP: 30, Period: time.Hour},    // emails and team invitations.
+	"requestinvite": {PerUser: 20, PerIP: 60, Period: time.Hour},    // requests to join a team.
+	"search":        {PerUser: 60, PerIP: 120, Period: time.Minute}, // searches of users, teams and tournaments.
+	"predict":       {PerUser: 60, PerIP: 120, Period: time.Minute}, // predictions of matches.
+	"tokens":        {PerUser: 600, Period: time.Hour},              // requests of each personal access token.
+	"export":        {PerUser: 5, PerIP: 10, Period: time.Hour},     // exports of the data of users.
+}
+
+var (
+	limitedMu       sync.Mutex
+	limitedRequests = make(map[*http.Request]string) // rate limit group of the requests being served.
+)
+
+func init() {
+	config, err := gwconfig.ReadConfig("")
+	if err != nil {
+		golog.Printf("Error: unable to read config file; %v", err)
+		return
+	}
+	for group, limit := range config.RateLimits {
+		rateLimits[group] = RateLimit{
+			PerUser: limit.PerUser,
+			PerIP:   limit.PerIP,
+			Period:  time.Duration(limit.Period) * time.Second,
+		}
+	}
+}
+
+// RateLimited runs the function pass by parameter if the IP address and the user of the request
+// did not send more requests to the group of routes than its rate limit allows in the current period.
+// Will rise a too many requests error with the time left in the period otherwise.
+// It wraps Authorized: requests are counted by IP address before the user is looked up, so that the
+// requests above the limit do not reach the datastore, then by user once Authorized authenticated him.
+// Requests whose credentials do not resolve to a user are only counted by IP address.
+// Requests are counted in memcache, in the memory of the instance when memcache cannot be reached.
+//
+func RateLimited(f func(w http.ResponseWriter, r *http.Request) error, group string) ErrorHandlerFunc {
+	if _, ok := rateLimits[group]; !ok {
+		panic("handlers: unknown rate limit group " + group)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) error {
+		c := platform.NewContext(r)
+		limit := rateLimits[group]
+
+		if wait, ok := takeRequest(c, group, "ip:"+remoteIP(r), limit.PerIP, limit.Period); !ok {
+			log.Infof(c, "RateLimited: %s exceeded the %s rate limit", remoteIP(r), group)
+			return &helpers.TooManyRequests{Err: errors.New(helpers.ErrorCodeTooManyRequests), RetryAfter: wait}
+		}
+
+		// the user is counted by Authorized, cf limitUser.
+		limitedMu.Lock()
+		limitedRequests[r] = group
+		limitedMu.Unlock()
+		defer func() {
+			limitedMu.Lock()
+			delete(limitedRequests, r)
+			limitedMu.Unlock()
+		}()
+		return f(w, r)
+	}
+}
+
+// limitUser counts a request of an authenticated user when the route is rate limited, cf RateLimited.
+// Will rise a too many requests error above the limit of the group of the route.
+func limitUser(c appengine.Context, r *http.Request, u *mdl.User) error {
+	limitedMu.Lock()
+	group, ok := limitedRequests[r]
+	limitedMu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	limit := rateLimits[group]
+	if wait, ok := takeRequest(c, group, fmt.Sprintf("user:%d", u.Id), limit.PerUser, limit.Period); !ok {
+		log.Infof(c, "RateLimited: user %d exceeded the %s rate limit", u.Id, group)
+		return &helpers.TooManyRequests{Err: errors.New(helpers.ErrorCodeTooManyRequests), RetryAfter: wait}
+	}
+	return nil
+}
+
+// limitAccessToken counts a request of a personal access token, whose requests to all the routes are
+// limited by the "tokens" rate limit. Will rise a too many requests error above the limit.
+func limitAccessToken(c appengine.Context, t *mdl.AccessToken) error {
+	limit := rateLimits["tokens"]
+	if wait, ok := takeRequest(c, "tokens", fmt.Sprintf("token:%d", t.Id), limit.PerUser, limit.Period); !ok {
+		log.Infof(c, "RateLimited: access token %d exceeded its rate limit", t.Id)
+		return &helpers.TooManyRequests{Err: errors.New(helpers.ErrorCodeTooManyRequests), RetryAfter: wait}
+	}
+	return nil
+}
+
+// takeRequest counts a request of the subject in the current period of the group.
+// It reports whether the subject is still under the limit and if not, how long it must wait for the next period.
+// Requests are allowed when they cannot be counted.
+func takeRequest(c appengine.Context, group, subject string, limit int, period time.Duration) (time.Duration, bool) {
+	if limit <= 0 || period <= 0 {
+		return 0, true
+	}
+
+	now := time.Now()
+	start := now.Truncate(period)
+	key := fmt.Sprintf("ratelimit:%s:%s:%d", group, subject, start.Unix())
+	n, err := memcache.Increment(c, key, 1, period)
+	if err != nil {
+		log.Errorf(c, "RateLimited: unable to count request of %s: %v", subject, err)
+		return 0, true
+	}
+	if n <= uint64(limit) {
+		return 0, true
+	}
+	return start.Add(period).Sub(now), false
+}
+
+// remoteIP returns the IP address of the client of the request.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// retryAfter returns the value of a Retry-After header, a number of seconds rounded up.
+func retryAfter(d time.Duration) string {
+	seconds := int64((d + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return strconv.FormatInt(seconds, 10)
+}
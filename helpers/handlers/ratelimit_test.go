@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"appengine"
+
+	"github.com/taironas/gonawin/helpers/memcache"
+	"github.com/taironas/gonawin/helpers/platform"
+	mdl "github.com/taironas/gonawin/models"
+	"github.com/taironas/gonawin/repository"
+)
+
+// unreachableCache is a cache that cannot be reached.
+type unreachableCache struct{}
+
+var errUnreachable = errors.New("memcache: unreachable")
+
+func (unreachableCache) Set(c appengine.Context, key string, value []byte, expiration time.Duration) error {
+	return errUnreachable
+}
+
+func (unreachableCache) Get(c appengine.Context, key string) ([]byte, error) {
+	return nil, errUnreachable
+}
+
+func (unreachableCache) Delete(c appengine.Context, key string) error {
+	return errUnreachable
+}
+
+func (unreachableCache) Increment(c appengine.Context, key string, delta int64, expiration time.Duration) (uint64, error) {
+	return 0, errUnreachable
+}
+
+// TestRateLimited tests that IP addresses are limited to the requests of their rate limit before the user
+// is authenticated, and users once they are authenticated, whatever the session or access token they use.
+//
+func TestRateLimited(t *testing.T) {
+	platform.UseStandalone(nil)
+	repository.Use(repository.NewMemory())
+	defer repository.Use(repository.Datastore)
+	defer memcache.Use(memcache.NewMemory())
+	memcache.Use(memcache.NewMemory())
+
+	rateLimits["test"] = RateLimit{PerUser: 2, PerIP: 3, Period: time.Hour}
+	defer delete(rateLimits, "test")
+
+	c := repository.NewLocalContext(nil)
+
+	tokens := make(map[string]string)
+	for _, name := range []string{"arya", "sansa"} {
+		u, err := mdl.CreateUser(c, name+"@winterfell.com", name, name, "", false, "")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		for _, device := range []string{"firefox", "chrome"} {
+			if _, tokens[name+" "+device], err = mdl.CreateSession(c, u.Id, device); err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+		}
+		if _, tokens[name+" bot"], err = mdl.CreateAccessToken(c, u.Id, "bot", []string{mdl.ScopeReadRankings}); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+	}
+	tokens["unknown"] = "unknown session"
+
+	type request struct {
+		token  string
+		ip     string
+		status int
+	}
+
+	tests := []struct {
+		title    string
+		cache    memcache.Cache
+		requests []request
+	}{
+		{
+			title: "users are limited, all their sessions and access tokens together",
+			cache: memcache.NewMemory(),
+			requests: []request{
+				{"arya firefox", "10.0.0.1", http.StatusOK},
+				{"arya bot", "10.0.0.2", http.StatusOK},
+				{"arya chrome", "10.0.0.3", http.StatusTooManyRequests},
+				{"sansa firefox", "10.0.0.4", http.StatusOK},
+			},
+		},
+		{
+			title: "IP addresses are limited",
+			cache: memcache.NewMemory(),
+			requests: []request{
+				{"arya firefox", "10.0.0.1", http.StatusOK},
+				{"sansa firefox", "10.0.0.1", http.StatusOK},
+				{"", "10.0.0.1", http.StatusBadRequest},
+				{"sansa chrome", "10.0.0.1", http.StatusTooManyRequests},
+				{"sansa chrome", "10.0.0.2", http.StatusOK},
+			},
+		},
+		{
+			title: "requests without a user are only limited by IP address",
+			cache: memcache.NewMemory(),
+			requests: []request{
+				{"unknown", "10.0.0.5", http.StatusBadRequest},
+				{"unknown", "10.0.0.5", http.StatusBadRequest},
+				{"", "10.0.0.5", http.StatusBadRequest},
+				{"unknown", "10.0.0.5", http.StatusTooManyRequests},
+				{"unknown", "10.0.0.6", http.StatusBadRequest},
+			},
+		},
+		{
+			title: "requests are counted in memory when memcache cannot be reached",
+			cache: unreachableCache{},
+			requests: []request{
+				{"sansa bot", "10.0.0.9", http.StatusOK},
+				{"sansa firefox", "10.0.0.9", http.StatusOK},
+				{"sansa chrome", "10.0.0.9", http.StatusTooManyRequests},
+			},
+		},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+		memcache.Use(test.cache)
+
+		for j, req := range test.requests {
+			h := ErrorHandler(RateLimited(Authorized(func(w http.ResponseWriter, r *http.Request, u *mdl.User) error {
+				return nil
+			}, TokenScope(mdl.ScopeReadRankings)), "test"))
+
+			r, _ := http.NewRequest("POST", "/j/invite", nil)
+			r.RemoteAddr = req.ip + ":1234"
+			if len(req.token) > 0 {
+				r.Header.Set("Authorization", "Bearer "+tokens[req.token])
+			}
+			w := httptest.NewRecorder()
+			h(w, r)
+
+			if w.Code != req.status {
+				t.Errorf("test %v - request %v - Error: want status %d, got %d", i, j, req.status, w.Code)
+			}
+			if req.status != http.StatusTooManyRequests {
+				continue
+			}
+			seconds, err := strconv.Atoi(w.Header().Get("Retry-After"))
+			if err != nil || seconds < 1 || seconds > 3600 {
+				t.Errorf("test %v - request %v - Error: want Retry-After within the period, got %q", i, j, w.Header().Get("Retry-After"))
+			}
+		}
+	}
+	if len(limitedRequests) != 0 {
+		t.Errorf("Error: want the rate limited requests forgotten once served, got %d", len(limitedRequests))
+	}
+}
+
+// TestRateLimitedUnknownGroup tests that routes cannot be limited by a group without rate limit.
+//
+func TestRateLimitedUnknownGroup(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Error: want a panic for an unknown group")
+		}
+	}()
+	RateLimited(func(w http.ResponseWriter, r *http.Request) error { return nil }, "unknown")
+}
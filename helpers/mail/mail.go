@@ -0,0 +1,118 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+// Package mail provides a set of functions to send emails in gonawin.
+//
+// Emails are sent with the App Engine mail service by default. The
+// standalone server writes them to a local mail sink instead.
+//
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"appengine"
+	"appengine/mail"
+
+	"github.com/taironas/gonawin/helpers/log"
+)
+
+// Message represents an email message.
+//
+type Message struct {
+	Sender   string
+	To       []string
+	Subject  string
+	Body     string
+	HTMLBody string
+}
+
+// Mailer is the interface implemented by the services sending emails.
+//
+type Mailer interface {
+	Send(c appengine.Context, msg *Message) error
+}
+
+// current is the mailer used by gonawin.
+var current Mailer = appengineMailer{}
+
+// Use sets the mailer used by gonawin.
+//
+func Use(m Mailer) {
+	current = m
+}
+
+// Send sends an email message.
+//
+func Send(c appengine.Context, msg *Message) error {
+	return current.Send(c, msg)
+}
+
+// appengineMailer sends emails with the App Engine mail service.
+type appengineMailer struct{}
+
+func (appengineMailer) Send(c appengine.Context, msg *Message) error {
+	return mail.Send(c, &mail.Message{
+		Sender:   msg.Sender,
+		To:       msg.To,
+		Subject:  msg.Subject,
+		Body:     msg.Body,
+		HTMLBody: msg.HTMLBody,
+	})
+}
+
+// localSink writes emails to files in a directory, or logs them.
+type localSink struct {
+	dir   string
+	count int64
+}
+
+// NewLocalSink returns a mailer that writes each email to a file in dir.
+// Emails are logged when dir is empty.
+//
+func NewLocalSink(dir string) Mailer {
+	return &localSink{dir: dir}
+}
+
+func (s *localSink) Send(c appengine.Context, msg *Message) error {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\n", msg.Sender)
+	fmt.Fprintf(&b, "To: %s\n", strings.Join(msg.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\n\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString(msg.Body)
+	if len(msg.HTMLBody) > 0 {
+		b.WriteString("\n\n")
+		b.WriteString(msg.HTMLBody)
+	}
+
+	if len(s.dir) == 0 {
+		log.Infof(c, "mail sink:\n%s", b.String())
+		return nil
+	}
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%d.eml", time.Now().UnixNano(), atomic.AddInt64(&s.count, 1))
+	return ioutil.WriteFile(filepath.Join(s.dir, name), b.Bytes(), 0644)
+}
@@ -16,10 +16,16 @@
 
 // Package memcache provides a set of functions to use memcache in gonawin.
 //
+// Values are cached in App Engine memcache by default. The standalone
+// server caches them in memory instead.
+//
 package memcache
 
 import (
 	"fmt"
+	"strconv"
+	"sync"
+	"time"
 
 	"appengine"
 	"appengine/memcache"
@@ -27,6 +33,32 @@ import (
 	"github.com/taironas/gonawin/helpers/log"
 )
 
+// ErrCacheMiss is returned when a key is not in the cache.
+var ErrCacheMiss = memcache.ErrCacheMiss
+
+// Cache is the interface implemented by caches.
+//
+type Cache interface {
+	Set(c appengine.Context, key string, value []byte, expiration time.Duration) error
+	Get(c appengine.Context, key string) ([]byte, error)
+	Delete(c appengine.Context, key string) error
+	// Increment atomically adds delta to the counter of key and returns its new value.
+	// A missing counter starts at zero and expires after expiration.
+	Increment(c appengine.Context, key string, delta int64, expiration time.Duration) (uint64, error)
+}
+
+// current is the cache used by gonawin.
+var current Cache = appengineCache{}
+
+// fallback counts in memory when the current cache cannot be reached.
+var fallback = NewMemory()
+
+// Use sets the cache used by gonawin.
+//
+func Use(cache Cache) {
+	current = cache
+}
+
 // Set sets a key value pair to memcache.
 //
 func Set(c appengine.Context, key string, value interface{}) error {
@@ -39,12 +71,8 @@ func Set(c appengine.Context, key string, value interface{}) error {
 		bytes = []byte(fmt.Sprintf("%d", v))
 	}
 
-	item := &memcache.Item{
-		Key:   key,
-		Value: bytes,
-	}
 	// Set the item, unconditionally
-	if err := memcache.Set(c, item); err != nil {
+	if err := current.Set(c, key, bytes, 0); err != nil {
 		log.Errorf(c, " error setting item: %v", err)
 		return err
 	}
@@ -56,18 +84,162 @@ func Set(c appengine.Context, key string, value interface{}) error {
 //
 func Get(c appengine.Context, key string) (interface{}, error) {
 	// Get the item from the memcache
-	item, err := memcache.Get(c, key)
+	value, err := current.Get(c, key)
 
 	if err != nil {
 		log.Errorf(c, " error getting item: %v", err)
 		return nil, err
 	}
 
-	return item.Value, err
+	return value, err
 }
 
 // Delete deletes a key from memcache.
 //
 func Delete(c appengine.Context, key string) error {
+	return current.Delete(c, key)
+}
+
+// Increment atomically adds delta to the counter of key and returns its new value.
+// A missing counter starts at zero and expires after expiration. Counters are kept
+// in the memory of the instance while the cache cannot be reached.
+//
+func Increment(c appengine.Context, key string, delta int64, expiration time.Duration) (uint64, error) {
+	n, err := current.Increment(c, key, delta, expiration)
+	if err != nil {
+		log.Errorf(c, " error incrementing counter %s, counting in memory: %v", key, err)
+		return fallback.Increment(c, key, delta, expiration)
+	}
+	return n, nil
+}
+
+// appengineCache caches values in App Engine memcache.
+type appengineCache struct{}
+
+func (appengineCache) Set(c appengine.Context, key string, value []byte, expiration time.Duration) error {
+	return memcache.Set(c, &memcache.Item{Key: key, Value: value, Expiration: expiration})
+}
+
+func (appengineCache) Get(c appengine.Context, key string) ([]byte, error) {
+	item, err := memcache.Get(c, key)
+	if err != nil {
+		return nil, err
+	}
+	return item.Value, nil
+}
+
+func (appengineCache) Delete(c appengine.Context, key string) error {
 	return memcache.Delete(c, key)
 }
+
+func (appengineCache) Increment(c appengine.Context, key string, delta int64, expiration time.Duration) (uint64, error) {
+	n, err := memcache.IncrementExisting(c, key, delta)
+	if err != memcache.ErrCacheMiss {
+		return n, err
+	}
+	// memcache.Increment cannot set an expiration, the counter is added first.
+	if delta < 0 {
+		delta = 0
+	}
+	err = memcache.Add(c, &memcache.Item{Key: key, Value: []byte(strconv.FormatInt(delta, 10)), Expiration: expiration})
+	if err == memcache.ErrNotStored {
+		return memcache.IncrementExisting(c, key, delta)
+	}
+	return uint64(delta), err
+}
+
+// memoryCache caches values in memory.
+type memoryCache struct {
+	mu     sync.RWMutex
+	values map[string]memoryItem
+}
+
+// memoryItem is a value cached in memory.
+type memoryItem struct {
+	value   []byte
+	expires time.Time // zero when the value does not expire.
+}
+
+func (i memoryItem) expired(now time.Time) bool {
+	return !i.expires.IsZero() && now.After(i.expires)
+}
+
+// memorySweepSize is the number of cached values above which expired values are removed on Set.
+const memorySweepSize = 10000
+
+// NewMemory returns an empty in-memory cache.
+//
+func NewMemory() Cache {
+	return &memoryCache{values: make(map[string]memoryItem)}
+}
+
+func (m *memoryCache) Set(c appengine.Context, key string, value []byte, expiration time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if len(m.values) >= memorySweepSize {
+		for k, item := range m.values {
+			if item.expired(now) {
+				delete(m.values, k)
+			}
+		}
+	}
+	item := memoryItem{value: append([]byte(nil), value...)}
+	if expiration > 0 {
+		item.expires = now.Add(expiration)
+	}
+	m.values[key] = item
+	return nil
+}
+
+func (m *memoryCache) Get(c appengine.Context, key string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	item, ok := m.values[key]
+	if !ok || item.expired(time.Now()) {
+		return nil, ErrCacheMiss
+	}
+	return append([]byte(nil), item.value...), nil
+}
+
+func (m *memoryCache) Delete(c appengine.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.values[key]; !ok {
+		return ErrCacheMiss
+	}
+	delete(m.values, key)
+	return nil
+}
+
+func (m *memoryCache) Increment(c appengine.Context, key string, delta int64, expiration time.Duration) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var n int64
+	item, ok := m.values[key]
+	if ok && !item.expired(now) {
+		if n, ok = parseCounter(item.value); !ok {
+			return 0, fmt.Errorf("memcache: value of %s is not a counter", key)
+		}
+	} else {
+		item = memoryItem{}
+		if expiration > 0 {
+			item.expires = now.Add(expiration)
+		}
+	}
+	if n += delta; n < 0 {
+		n = 0
+	}
+	item.value = []byte(strconv.FormatInt(n, 10))
+	m.values[key] = item
+	return uint64(n), nil
+}
+
+// parseCounter returns the value of a counter stored as a decimal number, as memcache does.
+func parseCounter(b []byte) (int64, bool) {
+	n, err := strconv.ParseInt(string(b), 10, 64)
+	return n, err == nil
+}
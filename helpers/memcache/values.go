@@ -0,0 +1,135 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package memcache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"appengine"
+
+	"github.com/taironas/gonawin/helpers/log"
+)
+
+// namespaceVersionTTL is how long the version of a namespace is kept.
+// It must outlast the values cached in the namespace.
+const namespaceVersionTTL = 7 * 24 * time.Hour
+
+// Namespace returns the name of the cache namespace of an entity.
+// Values depending on an entity are cached in its namespace and are
+// invalidated with it.
+//
+func Namespace(kind string, id int64) string {
+	return fmt.Sprintf("%s:%d", kind, id)
+}
+
+// KindNamespace returns the name of the cache namespace of all the entities of a kind.
+//
+func KindNamespace(kind string) string {
+	return kind + ":*"
+}
+
+// namespaceVersionKey returns the cache key of the version of a namespace.
+func namespaceVersionKey(namespace string) string {
+	return "gw:ns:" + namespace
+}
+
+// namespaceVersion returns the current version of a namespace.
+// A namespace that has no version yet gets a new one.
+func namespaceVersion(c appengine.Context, namespace string) string {
+	key := namespaceVersionKey(namespace)
+	if v, err := current.Get(c, key); err == nil {
+		return string(v)
+	}
+	v := strconv.FormatInt(time.Now().UnixNano(), 36)
+	if err := current.Set(c, key, []byte(v), namespaceVersionTTL); err != nil {
+		log.Errorf(c, " error setting version of namespace %s: %v", namespace, err)
+	}
+	return v
+}
+
+// Key returns the cache key of a value that depends on the given namespaces.
+// The key changes each time one of the namespaces is invalidated, so the
+// key must be computed before loading the value to cache.
+//
+func Key(c appengine.Context, name string, namespaces ...string) string {
+	parts := make([]string, 0, len(namespaces)+2)
+	parts = append(parts, "gw", name)
+	for _, ns := range namespaces {
+		parts = append(parts, ns+"@"+namespaceVersion(c, ns))
+	}
+	return strings.Join(parts, "|")
+}
+
+// Invalidate invalidates all the values cached in the given namespaces.
+//
+func Invalidate(c appengine.Context, namespaces ...string) error {
+	var err error
+	for _, ns := range namespaces {
+		v := strconv.FormatInt(time.Now().UnixNano(), 36)
+		if e := current.Set(c, namespaceVersionKey(ns), []byte(v), namespaceVersionTTL); e != nil {
+			log.Errorf(c, " error invalidating namespace %s: %v", ns, e)
+			err = e
+		}
+	}
+	return err
+}
+
+// SetValue caches value, of any gob encodable type, for the duration ttl.
+// A zero ttl means the value does not expire.
+//
+func SetValue(c appengine.Context, key string, value interface{}, ttl time.Duration) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(value); err != nil {
+		return err
+	}
+	return current.Set(c, key, buf.Bytes(), ttl)
+}
+
+// GetValue loads the value cached for key into dst, a pointer.
+// It returns ErrCacheMiss when the value is not cached.
+//
+func GetValue(c appengine.Context, key string, dst interface{}) error {
+	data, err := current.Get(c, key)
+	if err != nil {
+		return err
+	}
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(dst)
+}
+
+// ReadThrough loads the value cached for key into dst. When the value is
+// not cached, load is called to fill dst and dst is cached for the duration ttl.
+//
+func ReadThrough(c appengine.Context, key string, ttl time.Duration, dst interface{}, load func() error) error {
+	if err := GetValue(c, key, dst); err == nil {
+		return nil
+	} else if err != ErrCacheMiss {
+		log.Errorf(c, " error getting cached value %s: %v", key, err)
+	}
+
+	if err := load(); err != nil {
+		return err
+	}
+	if err := SetValue(c, key, dst, ttl); err != nil {
+		log.Errorf(c, " error caching value %s: %v", key, err)
+	}
+	return nil
+}
@@ -23,6 +23,12 @@ const (
 	ErrorCodeInternal          = "Internal error"
 	ErrorCodeNotFound          = "Not Found"
 	ErrorCodeNameCannotBeEmpty = "Name field cannot be empty"
+	ErrorCodeInvalidCursor     = "Invalid cursor"
+	ErrorCodeForbidden         = "You are not allowed to do this"
+	ErrorCodeMethodNotAllowed  = "Method not allowed"
+	ErrorCodeCSRFTokenNotValid = "Request cannot be verified, please reload the page"
+	ErrorCodeTooManyRequests   = "Too many requests, please try again later"
+	ErrorCodeAccessTokenScope  = "This url cannot be called with this access token"
 
 	// sessions
 	ErrorCodeSessionsAccessTokenNotValid      = "Access token is not valid"
@@ -34,6 +40,23 @@ const (
 	ErrorCodeSessionsCannotGetRequestToken    = "Error getting request token"
 	ErrorCodeSessionsCannotGetUserInfo        = "Error getting user info from Twitter"
 	ErrorCodeSessionsCannotGetGoogleLoginURL  = "Error getting Google accounts login URL"
+	ErrorCodeSessionsProviderNotFound         = "Login provider not found"
+	ErrorCodeSessionsCannotGetLoginURL        = "Error getting the login URL of the provider"
+	ErrorCodeSessionsStateNotValid            = "Login request is not valid or has expired"
+	ErrorCodeSessionsIDTokenNotValid          = "ID token is not valid"
+	ErrorCodeSessionNotFound                  = "Session not found"
+	ErrorCodeSessionCannotDelete              = "Could not sign out the session"
+	ErrorCodeAccessTokenNotFound              = "Access token not found"
+	ErrorCodeAccessTokenCannotCreate          = "Could not create the access token"
+	ErrorCodeAccessTokenCannotDelete          = "Could not revoke the access token"
+	ErrorCodeAccessTokenScopesNotValid        = "Access token scopes are not valid"
+	ErrorCodeAccessTokenLimit                 = "You cannot create more access tokens"
+	ErrorCodeIdentityInvalidProvider          = "Unknown provider"
+	ErrorCodeIdentityNotFound                 = "Linked account not found"
+	ErrorCodeIdentityLinked                   = "This account is already linked to another user"
+	ErrorCodeIdentityProviderLinked           = "You already linked an account of this provider"
+	ErrorCodeIdentityLastCannotUnlink         = "You cannot unlink the only account you sign in with"
+	ErrorCodeIdentityCannotLink               = "Could not link the account"
 
 	// users
 	ErrorCodeUserNotFound                      = "User not found"
@@ -45,6 +68,15 @@ const (
 	ErrorCodeUsersCannotPublishScore           = "Could not pusblish score activities"
 	ErrorCodeUserIsTeamAdminCannotDelete       = "User cannot be deleted because he is team admin"
 	ErrorCodeUserIsTournamentAdminCannotDelete = "User cannot be deleted because he is tournament admin"
+	ErrorCodeUserBlocked                       = "Sorry, this user is not available"
+	ErrorCodeUserCannotBlock                   = "Could not block the user"
+	ErrorCodeUserCannotUnblock                 = "Could not unblock the user"
+	ErrorCodeUserCannotMerge                   = "Could not merge the users"
+	ErrorCodeUserCannotDelete                  = "Could not delete the user"
+	ErrorCodeUserDeletionNotFound              = "Deletion of the user not found"
+	ErrorCodeUserCannotExport                  = "Could not export the data of the user"
+	ErrorCodeUserProfilePrivate                = "Sorry, the profile of this user is private"
+	ErrorCodeUserPrivacyNotValid               = "Privacy settings are not valid"
 	// teams
 	ErrorCodeTeamAlreadyExists        = "Sorry, that team already exists"
 	ErrorCodeTeamCannotCreate         = "Could not create the team"
@@ -52,8 +84,6 @@ const (
 	ErrorCodeTeamNotFoundCannotUpdate = "Team not found, unable to update"
 	ErrorCodeTeamNotFoundCannotDelete = "Team not found, unable to delete"
 	ErrorCodeTeamNotFoundCannotInvite = "Team not found, unable to send invitation"
-	ErrorCodeTeamUpdateForbiden       = "Team can only be updated by the team administrator"
-	ErrorCodeTeamDeleteForbiden       = "Team can only be deleted by the team administrator"
 	ErrorCodeTeamCannotUpdate         = "Could not update team"
 	ErrorCodeTeamCannotInvite         = "Could not send invitation"
 	ErrorCodeTeamRequestNotFound      = "Request not found"
@@ -61,14 +91,47 @@ const (
 	ErrorCodeTeamAdminCannotLeave     = "Team administrator cannot leave the team"
 	ErrorCodeTeamPrivateJoinForbiden  = "Private Team cannot be joined without consent. Please request an invitation"
 	ErrorCodeTeamRequestAlreadySent   = "Sorry, you already requested an invitation"
+	ErrorCodeTeamLastOwnerCannotLeave = "The last owner of the team cannot leave it, please transfer the ownership first"
+	ErrorCodeTeamRequestForbiden      = "You are not allowed to handle the requests of this team"
+	ErrorCodeTeamRoleForbiden         = "You are not allowed to give this role"
+	ErrorCodeTeamRoleNotSupported     = "Team role is not supported"
+	ErrorCodeTeamCannotUpdateRole     = "Could not update the role"
+	ErrorCodeTeamRequestTooSoon       = "Sorry, your last request was denied, please try again later"
+	ErrorCodeTeamMessageTooLong       = "Sorry, your message is too long"
+	ErrorCodeTeamBanned               = "Sorry, you are banned from this team"
+	ErrorCodeTeamUserBanned           = "This user is banned from the team"
+	ErrorCodeTeamUserAlreadyInvited   = "This user is already invited to join the team"
+	ErrorCodeTeamRemoveForbiden       = "You are not allowed to remove this member"
+	ErrorCodeTeamCannotRemove         = "Could not remove the member"
+	ErrorCodeTeamCannotUnban          = "Could not lift the ban of the user"
+	// challenges
+	ErrorCodeChallengeNotFound          = "Challenge not found"
+	ErrorCodeChallengeCannotCreate      = "Could not create the challenge"
+	ErrorCodeChallengeCannotUpdate      = "Could not update the challenge"
+	ErrorCodeChallengeForbiden          = "Challenges can only be handled by the team administrator"
+	ErrorCodeChallengeSameTeam          = "A team cannot challenge itself"
+	ErrorCodeChallengeAlreadyExists     = "Sorry, a challenge between these teams already exists"
+	ErrorCodeChallengeTeamNotInTourney  = "Both teams have to join the tournament to be challenged"
+	ErrorCodeChallengeModeNotSupported  = "Challenge mode is not supported"
+	ErrorCodeChallengePhaseNotSupported = "Challenge phase does not exist in tournament"
+
+	// reports
+	ErrorCodeReportNotFound         = "Report not found"
+	ErrorCodeReportCannotCreate     = "Could not send the report"
+	ErrorCodeReportCannotResolve    = "Could not resolve the report"
+	ErrorCodeReportKindNotSupported = "Only users and teams can be reported"
+	ErrorCodeReportAlreadySent      = "Sorry, you already reported it"
+	ErrorCodeReportReasonTooLong    = "Sorry, the reason of your report is too long"
+
+	// prices
+	ErrorCodePriceRankNotSupported = "Price rank is not supported"
+	ErrorCodePriceAlreadyResolved  = "The winners of this price are already known, it cannot be updated"
 	//tournaments
 	ErrorCodeTournamentAlreadyExists          = "Sorry, that tournament already exists"
 	ErrorCodeTournamentCannotCreate           = "Could not create the team"
 	ErrorCodeTournamentNotFound               = "Tournament not found"
 	ErrorCodeTournamentNotFoundCannotUpdate   = "Tournament not found, unable to update"
 	ErrorCodeTournamentNotFoundCannotDelete   = "Tournament not found, unable to delete"
-	ErrorCodeTournamentUpdateForbiden         = "Tournament can only be updated by the team administrator"
-	ErrorCodeTournamentDeleteForbiden         = "Tournament can only be deleted by the team administrator"
 	ErrorCodeTournamentCannotUpdate           = "Could not update tournament"
 	ErrorCodeTournamentCannotSearch           = "Something went wrong, we are unable to perform search query"
 	ErrorCodeMatchCannotUpdate                = "Something went wrong, unable to update match"
@@ -79,11 +142,13 @@ const (
 	ErrorCodeCannotSetPrediction              = "Something went wrong, unable to set prediction"
 	ErrorCodeNotAllowedToSetPrediction        = "You have to join the tournament to be able to set a predict for this match"
 	ErrorCodeTeamsCannotUpdate                = "Could not update teams"
+	ErrorCodePredictionVisibilityNotSupported = "Visibility of the predictions is not supported"
 
 	// invite
 	ErrorCodeInviteNoEmailAddr     = "No email address has been entered"
 	ErrorCodeInviteEmailsInvalid   = "Emails list is not properly formatted"
 	ErrorCodeInviteEmailCannotSend = "Sorry, we were unable to send the Email"
+	ErrorCodeInviteDailyLimit      = "You cannot send more invitations today"
 
 	// relations
 
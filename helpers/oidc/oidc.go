@@ -0,0 +1,367 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+// Package oidc provides the functions needed to authenticate users with an OpenID Connect provider.
+//
+// A provider is discovered from its issuer URL. Users are sent to its authorization endpoint,
+// the code it returns is exchanged for an ID token and the signature and claims of the ID token
+// are verified with the keys the provider publishes.
+//
+package oidc
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	gwconfig "github.com/taironas/gonawin/config"
+)
+
+// DiscoveryPath is the path of the configuration of a provider, relative to its issuer URL.
+//
+const DiscoveryPath = "/.well-known/openid-configuration"
+
+// clockSkew is the time an ID token is still accepted after its expiry.
+const clockSkew = time.Minute
+
+// now returns the current time, it is replaced in the tests.
+var now = time.Now
+
+var (
+	// ErrInvalidToken is returned when an ID token is malformed or its signature is not valid.
+	ErrInvalidToken = errors.New("oidc: invalid ID token")
+	// ErrUnknownKey is returned when an ID token is signed with a key the provider does not publish.
+	ErrUnknownKey = errors.New("oidc: ID token signed with an unknown key")
+)
+
+// Provider is an OpenID Connect provider, as configured in gonawin and discovered at its issuer URL.
+//
+type Provider struct {
+	Name                  string
+	Title                 string
+	Issuer                string
+	ClientId              string
+	Scopes                []string
+	AuthorizationEndpoint string
+	TokenEndpoint         string
+	JWKSURI               string
+
+	clientSecret string
+
+	mu   sync.Mutex
+	keys map[string]*rsa.PublicKey // public keys of the provider by key id.
+}
+
+// discovery holds the JSON configuration published by a provider.
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Claims holds the claims of an ID token.
+//
+type Claims struct {
+	Issuer            string   `json:"iss"`
+	Subject           string   `json:"sub"`
+	Audience          audience `json:"aud"`
+	Expiry            int64    `json:"exp"`
+	IssuedAt          int64    `json:"iat"`
+	Nonce             string   `json:"nonce"`
+	Email             string   `json:"email"`
+	EmailVerified     bool     `json:"email_verified"`
+	Name              string   `json:"name"`
+	PreferredUsername string   `json:"preferred_username"`
+}
+
+// audience is the audience of an ID token, a single client id or a list of them.
+type audience []string
+
+// UnmarshalJSON reads an audience given as a string or as an array of strings.
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*a = audience{s}
+		return nil
+	}
+	var l []string
+	if err := json.Unmarshal(b, &l); err != nil {
+		return err
+	}
+	*a = audience(l)
+	return nil
+}
+
+// contains checks if a client id is in the audience.
+func (a audience) contains(clientID string) bool {
+	for _, id := range a {
+		if id == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+// Discover fetches the configuration of a provider at its issuer URL.
+//
+func Discover(client *http.Client, config gwconfig.OpenIDConnect) (*Provider, error) {
+	if len(config.Name) == 0 || len(config.Issuer) == 0 || len(config.ClientId) == 0 {
+		return nil, errors.New("oidc: provider needs a name, an issuer and a client id")
+	}
+
+	issuer := strings.TrimSuffix(config.Issuer, "/")
+	var d discovery
+	if err := getJSON(client, issuer+DiscoveryPath, &d); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(d.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("oidc: provider %s has issuer %q, want %q", config.Name, d.Issuer, issuer)
+	}
+	if len(d.AuthorizationEndpoint) == 0 || len(d.TokenEndpoint) == 0 || len(d.JWKSURI) == 0 {
+		return nil, fmt.Errorf("oidc: configuration of provider %s is missing endpoints", config.Name)
+	}
+
+	scopes := config.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile"}
+	}
+	title := config.Title
+	if len(title) == 0 {
+		title = config.Name
+	}
+
+	return &Provider{
+		Name:                  config.Name,
+		Title:                 title,
+		Issuer:                d.Issuer,
+		ClientId:              config.ClientId,
+		Scopes:                scopes,
+		AuthorizationEndpoint: d.AuthorizationEndpoint,
+		TokenEndpoint:         d.TokenEndpoint,
+		JWKSURI:               d.JWKSURI,
+		clientSecret:          config.ClientSecret,
+	}, nil
+}
+
+// AuthCodeURL returns the URL of the provider where users authorize gonawin.
+// The provider redirects the user to redirectURL with a code and the given state.
+//
+func (p *Provider) AuthCodeURL(redirectURL, state, nonce string) string {
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", p.ClientId)
+	v.Set("redirect_uri", redirectURL)
+	v.Set("scope", strings.Join(p.Scopes, " "))
+	v.Set("state", state)
+	v.Set("nonce", nonce)
+
+	sep := "?"
+	if strings.Contains(p.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return p.AuthorizationEndpoint + sep + v.Encode()
+}
+
+// Exchange exchanges an authorization code for the ID token of the user.
+//
+func (p *Provider) Exchange(client *http.Client, code, redirectURL string) (string, error) {
+	v := url.Values{}
+	v.Set("grant_type", "authorization_code")
+	v.Set("code", code)
+	v.Set("redirect_uri", redirectURL)
+
+	req, err := http.NewRequest("POST", p.TokenEndpoint, strings.NewReader(v.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(p.ClientId), url.QueryEscape(p.clientSecret))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var token struct {
+		IDToken string `json:"id_token"`
+		Error   string `json:"error"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("oidc: cannot read token response of provider %s: %v", p.Name, err)
+	}
+	if resp.StatusCode != http.StatusOK || len(token.Error) > 0 {
+		return "", fmt.Errorf("oidc: provider %s refused the code: %d %s", p.Name, resp.StatusCode, token.Error)
+	}
+	if len(token.IDToken) == 0 {
+		return "", fmt.Errorf("oidc: provider %s returned no ID token", p.Name)
+	}
+	return token.IDToken, nil
+}
+
+// Verify checks the signature and the claims of an ID token and returns its claims.
+// The token must be signed with RS256 by the provider, for gonawin, with the nonce of the
+// authorization request, and not be expired.
+//
+func (p *Provider) Verify(client *http.Client, idToken, nonce string) (*Claims, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("oidc: ID token algorithm %q is not supported", header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	key, err := p.key(client, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	hashed := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err = rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed[:], signature); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var claims Claims
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if claims.Issuer != p.Issuer {
+		return nil, fmt.Errorf("oidc: ID token issued by %q, want %q", claims.Issuer, p.Issuer)
+	}
+	if !claims.Audience.contains(p.ClientId) {
+		return nil, errors.New("oidc: ID token is not issued for gonawin")
+	}
+	if now().After(time.Unix(claims.Expiry, 0).Add(clockSkew)) {
+		return nil, errors.New("oidc: ID token is expired")
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.New("oidc: ID token nonce does not match")
+	}
+	if len(claims.Subject) == 0 {
+		return nil, errors.New("oidc: ID token has no subject")
+	}
+	return &claims, nil
+}
+
+// key returns the public key of the provider with the given id.
+// The keys are fetched again when the id is unknown, as providers rotate their keys.
+func (p *Provider) key(client *http.Client, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key := p.keyByID(kid); key != nil {
+		return key, nil
+	}
+
+	keys, err := fetchKeys(client, p.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+	if key := p.keyByID(kid); key != nil {
+		return key, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+// keyByID returns the known key with the given id, or the only key when the token has no key id.
+func (p *Provider) keyByID(kid string) *rsa.PublicKey {
+	if len(kid) == 0 && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key
+		}
+	}
+	return p.keys[kid]
+}
+
+// fetchKeys fetches the RSA public keys of a JSON Web Key Set.
+func fetchKeys(client *http.Client, jwksURI string) (map[string]*rsa.PublicKey, error) {
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := getJSON(client, jwksURI, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (len(k.Use) > 0 && k.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	return keys, nil
+}
+
+// getJSON fetches a JSON document and decodes it in v.
+func getJSON(client *http.Client, u string, v interface{}) error {
+	resp, err := client.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc: %s returned status %d", u, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// decodeSegment decodes a base64url encoded JSON segment of a token in v.
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
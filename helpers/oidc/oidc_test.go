@@ -0,0 +1,176 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	gwconfig "github.com/taironas/gonawin/config"
+	gonawintest "github.com/taironas/gonawin/test"
+)
+
+// noRedirect is an HTTP client that returns the redirects of the provider instead of following them.
+var noRedirect = &http.Client{
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// TestDiscover tests the discovery of a provider at its issuer URL.
+//
+func TestDiscover(t *testing.T) {
+	idp := gonawintest.NewIdentityProvider("gonawin", "secret")
+	defer idp.Close()
+
+	mismatch := idp.Config("acme")
+	mismatch.Issuer = idp.URL + "/other"
+
+	tests := []struct {
+		title  string
+		config gwconfig.OpenIDConnect
+		err    string
+	}{
+		{title: "can discover a provider", config: idp.Config("acme")},
+		{title: "can discover a provider with a trailing slash", config: gwconfig.OpenIDConnect{Name: "acme", Issuer: idp.URL + "/", ClientId: "gonawin"}},
+		{title: "cannot discover a provider without client id", config: gwconfig.OpenIDConnect{Name: "acme", Issuer: idp.URL}, err: "oidc: provider needs a name, an issuer and a client id"},
+		{title: "cannot discover a provider at an unknown issuer", config: mismatch, err: "oidc: " + idp.URL + "/other/.well-known/openid-configuration returned status 404"},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+		p, err := Discover(http.DefaultClient, test.config)
+		if gonawintest.ErrorString(err) != test.err {
+			t.Errorf("test %v - Error: want err %q, got %q", i, test.err, gonawintest.ErrorString(err))
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if p.Issuer != idp.URL || p.TokenEndpoint != idp.URL+"/token" || p.Title != "acme" {
+			t.Errorf("test %v - Error: unexpected provider %+v", i, p)
+		}
+		if strings.Join(p.Scopes, " ") != "openid email profile" {
+			t.Errorf("test %v - Error: want default scopes, got %v", i, p.Scopes)
+		}
+	}
+}
+
+// TestAuthorizationCodeFlow tests the sign in of a user from the authorization URL to the claims of his ID token.
+//
+func TestAuthorizationCodeFlow(t *testing.T) {
+	idp := gonawintest.NewIdentityProvider("gonawin", "secret")
+	defer idp.Close()
+
+	p, err := Discover(http.DefaultClient, idp.Config("acme"))
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	redirectURL := "http://gonawin.test/j/auth/oidc/acme/callback"
+	resp, err := noRedirect.Get(p.AuthCodeURL(redirectURL, "state", "nonce") + "&login_hint=arya.stark")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	resp.Body.Close()
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if location.Query().Get("state") != "state" {
+		t.Errorf("Error: want state %q, got %q", "state", location.Query().Get("state"))
+	}
+
+	code := location.Query().Get("code")
+	idToken, err := p.Exchange(http.DefaultClient, code, redirectURL)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	claims, err := p.Verify(http.DefaultClient, idToken, "nonce")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if claims.Subject != "arya.stark" || claims.Email != "arya.stark@example.com" || !claims.EmailVerified {
+		t.Errorf("Error: unexpected claims %+v", claims)
+	}
+
+	if _, err = p.Exchange(http.DefaultClient, code, redirectURL); err == nil {
+		t.Errorf("Error: a code should be exchanged only once")
+	}
+
+	wrongSecret, err := Discover(http.DefaultClient, gwconfig.OpenIDConnect{Name: "acme", Issuer: idp.URL, ClientId: "gonawin", ClientSecret: "guess"})
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if _, err = wrongSecret.Exchange(http.DefaultClient, idp.Code(idp.Claims("arya.stark", "")), redirectURL); err == nil {
+		t.Errorf("Error: a code should not be exchanged with a wrong client secret")
+	}
+}
+
+// TestVerify tests the verification of the signature and the claims of ID tokens.
+//
+func TestVerify(t *testing.T) {
+	idp := gonawintest.NewIdentityProvider("gonawin", "secret")
+	defer idp.Close()
+
+	p, err := Discover(http.DefaultClient, idp.Config("acme"))
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	claims := func(name string, value interface{}) map[string]interface{} {
+		c := idp.Claims("john.snow", "nonce")
+		c[name] = value
+		return c
+	}
+	valid := idp.IDToken(idp.Claims("john.snow", "nonce"))
+	parts := strings.Split(valid, ".")
+	tampered := strings.Split(idp.IDToken(claims("sub", "ramsay.bolton")), ".")
+
+	tests := []struct {
+		title   string
+		idToken func() string
+		nonce   string
+		err     string
+	}{
+		{title: "valid token", idToken: func() string { return valid }},
+		{title: "valid token for several audiences", idToken: func() string { return idp.IDToken(claims("aud", []string{"other", "gonawin"})) }},
+		{title: "token with a tampered payload", idToken: func() string { return parts[0] + "." + tampered[1] + "." + parts[2] }, err: ErrInvalidToken.Error()},
+		{title: "token without signature", idToken: func() string { return parts[0] + "." + parts[1] + "." }, err: ErrInvalidToken.Error()},
+		{title: "token with another algorithm", idToken: func() string { return "eyJhbGciOiJub25lIn0." + parts[1] + "." }, err: `oidc: ID token algorithm "none" is not supported`},
+		{title: "malformed token", idToken: func() string { return "token" }, err: ErrInvalidToken.Error()},
+		{title: "token of another issuer", idToken: func() string { return idp.IDToken(claims("iss", "https://other.com")) }, err: `oidc: ID token issued by "https://other.com", want "` + idp.URL + `"`},
+		{title: "token of another client", idToken: func() string { return idp.IDToken(claims("aud", "other")) }, err: "oidc: ID token is not issued for gonawin"},
+		{title: "expired token", idToken: func() string { return idp.IDToken(claims("exp", time.Now().Add(-time.Hour).Unix())) }, err: "oidc: ID token is expired"},
+		{title: "token of another authorization request", idToken: func() string { return idp.IDToken(idp.Claims("john.snow", "nonce")) }, nonce: "other", err: "oidc: ID token nonce does not match"},
+		{title: "token without subject", idToken: func() string { return idp.IDToken(claims("sub", "")) }, err: "oidc: ID token has no subject"},
+		{title: "valid token after a key rotation", idToken: func() string { idp.RotateKey(); return idp.IDToken(idp.Claims("john.snow", "nonce")) }},
+		{title: "token of the previous key after a key rotation", idToken: func() string { return valid }, err: ErrUnknownKey.Error()},
+		{title: "token signed with another key", idToken: func() string { return gonawintest.SignToken(other, "key-1", idp.Claims("john.snow", "nonce")) }, err: ErrUnknownKey.Error()},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+		nonce := test.nonce
+		if len(nonce) == 0 {
+			nonce = "nonce"
+		}
+		c, err := p.Verify(http.DefaultClient, test.idToken(), nonce)
+		if gonawintest.ErrorString(err) != test.err {
+			t.Errorf("test %v - Error: want err %q, got %q", i, test.err, gonawintest.ErrorString(err))
+			continue
+		}
+		if err == nil && c.Subject != "john.snow" {
+			t.Errorf("test %v - Error: want subject john.snow, got %q", i, c.Subject)
+		}
+	}
+}
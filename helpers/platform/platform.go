@@ -0,0 +1,123 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+// Package platform provides the services gonawin gets from the platform it runs on.
+//
+// gonawin runs on App Engine by default. When it runs as a standalone
+// server, requests get a local context and the App Engine users API and
+// url fetch service are replaced.
+//
+package platform
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"appengine"
+	"appengine/urlfetch"
+	"appengine/user"
+
+	"github.com/taironas/gonawin/repository"
+)
+
+// ErrNotSupported is returned when a service is not available on the current platform.
+var ErrNotSupported = errors.New("platform: service not supported outside App Engine")
+
+var (
+	standalone bool
+	admins     []string
+)
+
+// UseStandalone makes gonawin run outside App Engine.
+// adminIDs are the gonawin admins, given by the id of their user, like "42", or by an
+// account they sign in with, as "provider/externalId", like "google/1234".
+//
+func UseStandalone(adminIDs []string) {
+	standalone = true
+	admins = adminIDs
+}
+
+// Standalone reports whether gonawin runs outside App Engine.
+//
+func Standalone() bool {
+	return standalone
+}
+
+// NewContext returns a context for a request.
+//
+func NewContext(r *http.Request) appengine.Context {
+	if standalone {
+		return repository.NewLocalContext(r)
+	}
+	return appengine.NewContext(r)
+}
+
+// IsDevAppServer reports whether gonawin runs on the App Engine development server.
+//
+func IsDevAppServer() bool {
+	return !standalone && appengine.IsDevAppServer()
+}
+
+// Client returns an HTTP client to fetch external resources.
+//
+func Client(c appengine.Context) *http.Client {
+	if standalone {
+		return http.DefaultClient
+	}
+	return urlfetch.Client(c)
+}
+
+// IsAdmin reports whether a user is a gonawin admin, given the id of the user (0 when
+// he does not exist yet) and the accounts he signs in with, as "provider/externalId".
+// On App Engine, admins are the administrators of the application signed in
+// with their Google account. Outside App Engine, they are the configured admins.
+// An email never makes a user admin, it is not verified by all the providers.
+//
+func IsAdmin(c appengine.Context, userID int64, accounts []string) bool {
+	if standalone {
+		for _, a := range admins {
+			if userID != 0 && a == strconv.FormatInt(userID, 10) {
+				return true
+			}
+			for _, account := range accounts {
+				if a == account {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return user.IsAdmin(c)
+}
+
+// CurrentUser returns the Google account signed in, nil if there is none.
+//
+func CurrentUser(c appengine.Context) *user.User {
+	if standalone {
+		return nil
+	}
+	return user.Current(c)
+}
+
+// LoginURL returns the URL to sign in with a Google account and then redirect to dest.
+//
+func LoginURL(c appengine.Context, dest string) (string, error) {
+	if standalone {
+		return "", ErrNotSupported
+	}
+	return user.LoginURL(c, dest)
+}
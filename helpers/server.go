@@ -19,6 +19,7 @@ package helpers
 import (
 	"io"
 	"net/http"
+	"time"
 )
 
 // Error404 writes a 404 not found in ResponseWriter.
@@ -61,6 +62,30 @@ func (e *Forbidden) Error() string {
 	return e.Err.Error()
 }
 
+// MethodNotAllowed is handled by setting the status code in the reply to StatusMethodNotAllowed
+// and the Allow header to the methods of the route.
+type MethodNotAllowed struct {
+	Err   error
+	Allow []string
+}
+
+// Implementation of error, returns string error on Err structure.
+func (e *MethodNotAllowed) Error() string {
+	return e.Err.Error()
+}
+
+// TooManyRequests is handled by setting the status code in the reply to StatusTooManyRequests
+// and the Retry-After header to the time the client must wait.
+type TooManyRequests struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+// Implementation of error, returns string error on Err structure.
+func (e *TooManyRequests) Error() string {
+	return e.Err.Error()
+}
+
 // Unauthorized is handled by setting the status code in the reply to StatusUnauthorized.
 type Unauthorized struct {
 	Err error
@@ -35,3 +35,13 @@ func Contains(s []int64, value int64) (bool, int) {
 	}
 	return false, -1
 }
+
+// Remove removes a value from a given slice if it exists.
+// The order of the slice is not preserved.
+func Remove(s []int64, value int64) []int64 {
+	if ok, i := Contains(s, value); ok {
+		s[i] = s[len(s)-1]
+		s = s[0 : len(s)-1]
+	}
+	return s
+}
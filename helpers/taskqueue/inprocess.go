@@ -0,0 +1,130 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package taskqueue
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"appengine"
+)
+
+const (
+	maxAttempts  = 5           // number of times a failed task is run.
+	retryBackoff = time.Second // delay before the first retry, doubled after each retry.
+	queueSize    = 1000        // number of tasks a queue holds before Add blocks.
+)
+
+// inProcessQueue runs tasks by calling a handler in process.
+// Each named queue runs its tasks one at a time, in order.
+type inProcessQueue struct {
+	handler http.Handler
+	mu      sync.Mutex
+	queues  map[string]chan *Task
+}
+
+// NewInProcess returns a queue that runs tasks by serving them with handler.
+// A failed task, that is a task whose response status is not 2xx, is retried
+// with an exponential backoff.
+//
+func NewInProcess(handler http.Handler) Queue {
+	return &inProcessQueue{handler: handler, queues: make(map[string]chan *Task)}
+}
+
+func (q *inProcessQueue) Add(c appengine.Context, task *Task, queueName string) (*Task, error) {
+	if queueName == "" {
+		queueName = "default"
+	}
+
+	q.mu.Lock()
+	tasks, ok := q.queues[queueName]
+	if !ok {
+		tasks = make(chan *Task, queueSize)
+		q.queues[queueName] = tasks
+		go q.work(queueName, tasks)
+	}
+	q.mu.Unlock()
+
+	tasks <- task
+	return task, nil
+}
+
+// work runs the tasks of a queue.
+func (q *inProcessQueue) work(queueName string, tasks chan *Task) {
+	for task := range tasks {
+		backoff := retryBackoff
+		for attempt := 1; ; attempt++ {
+			status := q.run(queueName, task)
+			if status >= 200 && status < 300 {
+				break
+			}
+			if attempt == maxAttempts {
+				log.Printf("ERROR: gonawin: task %s %s failed %d times with status %d, giving up", task.Method, task.Path, attempt, status)
+				break
+			}
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+}
+
+// run serves a task and returns the response status.
+func (q *inProcessQueue) run(queueName string, task *Task) int {
+	method := task.Method
+	if method == "" {
+		method = "POST"
+	}
+	r, err := http.NewRequest(method, task.Path, bytes.NewReader(task.Payload))
+	if err != nil {
+		log.Printf("ERROR: gonawin: unable to create request for task %s: %v", task.Path, err)
+		return http.StatusBadRequest
+	}
+	for k, v := range task.Header {
+		r.Header[k] = v
+	}
+	r.Header.Set("X-AppEngine-QueueName", queueName)
+
+	w := &statusRecorder{header: make(http.Header), status: http.StatusOK}
+	q.handler.ServeHTTP(w, r)
+	return w.status
+}
+
+// statusRecorder is an http.ResponseWriter that only records the response status.
+type statusRecorder struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusRecorder) Header() http.Header {
+	return w.header
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return len(b), nil
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+// Package taskqueue provides a set of functions to queue tasks in gonawin.
+//
+// Tasks are sent to App Engine task queues by default. The standalone
+// server runs them in process instead.
+//
+package taskqueue
+
+import (
+	"net/http"
+	"net/url"
+
+	"appengine"
+	"appengine/taskqueue"
+)
+
+// Task represents a task to run, a request to a gonawin handler.
+//
+type Task struct {
+	Path    string      // path of the handler.
+	Payload []byte      // body of the request.
+	Header  http.Header // headers of the request.
+	Method  string      // method of the request.
+}
+
+// NewPOSTTask creates a task that will POST to a path with the given form data.
+//
+func NewPOSTTask(path string, params url.Values) *Task {
+	h := make(http.Header)
+	h.Set("Content-Type", "application/x-www-form-urlencoded")
+	return &Task{
+		Path:    path,
+		Payload: []byte(params.Encode()),
+		Header:  h,
+		Method:  "POST",
+	}
+}
+
+// Queue is the interface implemented by task queues.
+//
+type Queue interface {
+	Add(c appengine.Context, task *Task, queueName string) (*Task, error)
+}
+
+// current is the queue used by gonawin.
+var current Queue = appengineQueue{}
+
+// Use sets the queue used by gonawin.
+//
+func Use(q Queue) {
+	current = q
+}
+
+// Add adds the task to a named queue. An empty queue name means that the default queue will be used.
+//
+func Add(c appengine.Context, task *Task, queueName string) (*Task, error) {
+	return current.Add(c, task, queueName)
+}
+
+// appengineQueue sends tasks to App Engine task queues.
+type appengineQueue struct{}
+
+func (appengineQueue) Add(c appengine.Context, task *Task, queueName string) (*Task, error) {
+	t := &taskqueue.Task{
+		Path:    task.Path,
+		Payload: task.Payload,
+		Header:  task.Header,
+		Method:  task.Method,
+	}
+	if _, err := taskqueue.Add(c, t, queueName); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
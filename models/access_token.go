@@ -0,0 +1,243 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package models
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"appengine"
+
+	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/repository"
+)
+
+const (
+	// AccessTokenPrefix starts the personal access tokens, to tell them from session tokens.
+	AccessTokenPrefix = "gwt_"
+	// AccessTokenUseInterval is the minimum duration between two updates of the last use of a token.
+	AccessTokenUseInterval = time.Minute
+	// maxUserAccessTokens is the maximum number of personal access tokens of a user.
+	maxUserAccessTokens = 20
+	// maxAccessTokenNameLength is the maximum length of the name of a token.
+	maxAccessTokenNameLength = 100
+)
+
+// Scopes of the personal access tokens.
+//
+const (
+	ScopeReadRankings     = "rankings:read"     // read the rankings and leaderboards of teams and tournaments.
+	ScopeReadCalendar     = "calendar:read"     // read the matches and groups of tournaments.
+	ScopeWritePredictions = "predictions:write" // predict the results of matches.
+)
+
+// AccessTokenScopes holds all the scopes of the personal access tokens.
+//
+var AccessTokenScopes = []string{
+	ScopeReadRankings,
+	ScopeReadCalendar,
+	ScopeWritePredictions,
+}
+
+var (
+	// ErrAccessTokenScope is returned when a token is created with an unknown scope or without scope.
+	ErrAccessTokenScope = errors.New("model/access token: unknown scope")
+	// ErrAccessTokenLimit is returned when a user already has maxUserAccessTokens tokens.
+	ErrAccessTokenLimit = errors.New("model/access token: too many tokens")
+)
+
+// AccessToken represents a personal access token of a user, used by bots and scripts.
+//
+// Unlike sessions, tokens do not expire but can only call the routes allowing one of their
+// scopes. A token is revoked by destroying it. The token itself is never stored, the
+// access token is keyed by its hash.
+//
+type AccessToken struct {
+	Id        int64
+	UserId    int64
+	Name      string   // name given by the user, like "ranking bot".
+	TokenHash string   `json:"-"` // hash of the token, also the key of the access token.
+	Scopes    []string // scopes granted to the token.
+	Created   time.Time
+	LastUsed  time.Time // zero when the token was never used.
+}
+
+// CreateAccessToken creates a personal access token of a user with the given scopes.
+// It returns the access token and the token, to be sent in the Authorization header of the requests.
+//
+func CreateAccessToken(c appengine.Context, userID int64, name string, scopes []string) (*AccessToken, string, error) {
+	if len(scopes) == 0 {
+		return nil, "", ErrAccessTokenScope
+	}
+	for _, s := range scopes {
+		if !isAccessTokenScope(s) {
+			return nil, "", ErrAccessTokenScope
+		}
+	}
+	if len(UserAccessTokens(c, userID)) >= maxUserAccessTokens {
+		return nil, "", ErrAccessTokenLimit
+	}
+
+	b := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		log.Errorf(c, "AccessToken.Create: unable to generate token: %v", err)
+		return nil, "", err
+	}
+	token := fmt.Sprintf("%s%x", AccessTokenPrefix, b)
+
+	id, _, err := repository.AllocateIDs(c, "AccessToken", 1)
+	if err != nil {
+		log.Errorf(c, "AccessToken.Create: %v", err)
+		return nil, "", err
+	}
+
+	if name = strings.TrimSpace(name); len(name) > maxAccessTokenNameLength {
+		name = name[:maxAccessTokenNameLength]
+	}
+
+	t := &AccessToken{
+		Id:        id,
+		UserId:    userID,
+		Name:      name,
+		TokenHash: hashSessionToken(token),
+		Scopes:    scopes,
+		Created:   time.Now(),
+	}
+	if _, err = repository.Put(c, t.key(), t); err != nil {
+		log.Errorf(c, "AccessToken.Create: %v", err)
+		return nil, "", errors.New("model/access token: unable to put access token in Datastore")
+	}
+	return t, token, nil
+}
+
+// isAccessTokenScope reports whether s is a scope of the personal access tokens.
+func isAccessTokenScope(s string) bool {
+	for _, scope := range AccessTokenScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAccessToken reports whether a token sent in the Authorization header is a personal access token.
+//
+func IsAccessToken(token string) bool {
+	return strings.HasPrefix(token, AccessTokenPrefix)
+}
+
+// key returns the key of the access token.
+func (t *AccessToken) key() *repository.Key {
+	return repository.NewKey("AccessToken", t.TokenHash, 0)
+}
+
+// AccessTokenByToken returns the personal access token of a token.
+//
+func AccessTokenByToken(c appengine.Context, token string) (*AccessToken, error) {
+	if !IsAccessToken(token) {
+		return nil, repository.ErrNoSuchEntity
+	}
+
+	var t AccessToken
+	if err := repository.Get(c, repository.NewKey("AccessToken", hashSessionToken(token), 0), &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// HasScope reports whether the token was granted the scope.
+//
+func (t *AccessToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Use records that the token was just used.
+// The token is written at most once per AccessTokenUseInterval.
+//
+func (t *AccessToken) Use(c appengine.Context) error {
+	now := time.Now()
+	if now.Sub(t.LastUsed) < AccessTokenUseInterval {
+		return nil
+	}
+	t.LastUsed = now
+	_, err := repository.Put(c, t.key(), t)
+	return err
+}
+
+// Destroy removes an access token, revoking it.
+//
+func (t *AccessToken) Destroy(c appengine.Context) error {
+	return repository.Delete(c, t.key())
+}
+
+// UserAccessTokens returns the personal access tokens of a user, starting with the most recently created.
+//
+func UserAccessTokens(c appengine.Context, userID int64) []*AccessToken {
+	q := repository.NewQuery("AccessToken").Filter("UserId =", userID)
+
+	var tokens []*AccessToken
+	if _, err := q.GetAll(c, &tokens); err != nil {
+		log.Errorf(c, "AccessToken.UserAccessTokens: error occurred during GetAll: %v", err)
+		return nil
+	}
+	sort.Sort(AccessTokenByCreation(tokens))
+	return tokens
+}
+
+// UserAccessTokenByID returns the personal access token of a user with the given id.
+//
+func UserAccessTokenByID(c appengine.Context, userID, id int64) (*AccessToken, error) {
+	q := repository.NewQuery("AccessToken").Filter("UserId =", userID).Filter("Id =", id)
+
+	var tokens []*AccessToken
+	if _, err := q.GetAll(c, &tokens); err != nil {
+		log.Errorf(c, "AccessToken.UserAccessTokenByID: error occurred during GetAll: %v", err)
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, repository.ErrNoSuchEntity
+	}
+	return tokens[0], nil
+}
+
+// DestroyUserAccessTokens removes all the personal access tokens of a user.
+//
+func DestroyUserAccessTokens(c appengine.Context, userID int64) error {
+	keys, err := repository.NewQuery("AccessToken").Filter("UserId =", userID).KeysOnly().GetAll(c, nil)
+	if err != nil {
+		return err
+	}
+	return repository.DeleteMulti(c, keys)
+}
+
+// AccessTokenByCreation type used to sort access tokens from the most recently created to the oldest.
+//
+type AccessTokenByCreation []*AccessToken
+
+func (a AccessTokenByCreation) Len() int           { return len(a) }
+func (a AccessTokenByCreation) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a AccessTokenByCreation) Less(i, j int) bool { return a[i].Created.After(a[j].Created) }
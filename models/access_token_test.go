@@ -0,0 +1,170 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/taironas/gonawin/helpers/memcache"
+	"github.com/taironas/gonawin/repository"
+)
+
+// TestCreateAccessToken tests the creation of personal access tokens and their lookup by token.
+//
+func TestCreateAccessToken(t *testing.T) {
+	repository.Use(repository.NewMemory())
+	defer repository.Use(repository.Datastore)
+	memcache.Use(memcache.NewMemory())
+
+	c := repository.NewLocalContext(nil)
+
+	tests := []struct {
+		title  string
+		name   string
+		scopes []string
+		err    error
+	}{
+		{title: "can create a token with a scope", name: "ranking bot", scopes: []string{ScopeReadRankings}},
+		{title: "can create a token with all the scopes", name: "predictor", scopes: AccessTokenScopes},
+		{title: "cannot create a token without scope", name: "bot", err: ErrAccessTokenScope},
+		{title: "cannot create a token with an unknown scope", name: "bot", scopes: []string{ScopeReadCalendar, "users:write"}, err: ErrAccessTokenScope},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+		at, token, err := CreateAccessToken(c, 1, test.name, test.scopes)
+		if err != test.err {
+			t.Errorf("test %v - Error: want err %v, got %v", i, test.err, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if !IsAccessToken(token) || at.TokenHash == token {
+			t.Errorf("test %v - Error: want a new access token not stored, got token %q and hash %q", i, token, at.TokenHash)
+		}
+		got, err := AccessTokenByToken(c, token)
+		if err != nil || got.Id != at.Id || got.Name != test.name || len(got.Scopes) != len(test.scopes) {
+			t.Errorf("test %v - Error: want access token %+v, got %+v, %v", i, at, got, err)
+		}
+	}
+
+	_, session, err := CreateSession(c, 1, "firefox")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if IsAccessToken(session) {
+		t.Errorf("Error: a session token should not be an access token")
+	}
+	if _, err = AccessTokenByToken(c, session); err != repository.ErrNoSuchEntity {
+		t.Errorf("Error: want err %v for a session token, got %v", repository.ErrNoSuchEntity, err)
+	}
+	if _, err = AccessTokenByToken(c, AccessTokenPrefix+strings.Repeat("0", 64)); err != repository.ErrNoSuchEntity {
+		t.Errorf("Error: want err %v for an unknown token, got %v", repository.ErrNoSuchEntity, err)
+	}
+
+	for n := len(UserAccessTokens(c, 1)); n < maxUserAccessTokens; n++ {
+		if _, _, err = CreateAccessToken(c, 1, "bot", []string{ScopeReadCalendar}); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+	}
+	if _, _, err = CreateAccessToken(c, 1, "bot", []string{ScopeReadCalendar}); err != ErrAccessTokenLimit {
+		t.Errorf("Error: want err %v above the limit of tokens, got %v", ErrAccessTokenLimit, err)
+	}
+}
+
+// TestAccessTokenUse tests that the last use of a token is recorded at most once per AccessTokenUseInterval.
+//
+func TestAccessTokenUse(t *testing.T) {
+	repository.Use(repository.NewMemory())
+	defer repository.Use(repository.Datastore)
+	memcache.Use(memcache.NewMemory())
+
+	c := repository.NewLocalContext(nil)
+
+	at, token, err := CreateAccessToken(c, 1, "bot", []string{ScopeReadRankings})
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if !at.LastUsed.IsZero() {
+		t.Errorf("Error: a new token should not be used, got %v", at.LastUsed)
+	}
+
+	if err = at.Use(c); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	lastUsed := at.LastUsed
+	if err = at.Use(c); err != nil || !at.LastUsed.Equal(lastUsed) {
+		t.Errorf("Error: a recent use should not be recorded, got %v, %v", at.LastUsed, err)
+	}
+
+	at.LastUsed = at.LastUsed.Add(-2 * AccessTokenUseInterval)
+	if err = at.Use(c); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	var got *AccessToken
+	if got, err = AccessTokenByToken(c, token); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if got.LastUsed.Before(lastUsed) || time.Since(got.LastUsed) > time.Minute {
+		t.Errorf("Error: want last use after %v, got %v", lastUsed, got.LastUsed)
+	}
+}
+
+// TestUserAccessTokens tests the listing and the revocation of the tokens of a user.
+//
+func TestUserAccessTokens(t *testing.T) {
+	repository.Use(repository.NewMemory())
+	defer repository.Use(repository.Datastore)
+	memcache.Use(memcache.NewMemory())
+
+	c := repository.NewLocalContext(nil)
+
+	var ids []int64
+	var tokens []string
+	for _, name := range []string{"ranking bot", "calendar bot", "predictor"} {
+		at, token, err := CreateAccessToken(c, 1, name, []string{ScopeReadCalendar})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		at.Created = at.Created.Add(time.Duration(len(ids)) * time.Minute)
+		if _, err = repository.Put(c, at.key(), at); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		ids = append(ids, at.Id)
+		tokens = append(tokens, token)
+	}
+	if _, _, err := CreateAccessToken(c, 2, "bot", []string{ScopeReadCalendar}); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	list := UserAccessTokens(c, 1)
+	if len(list) != 3 || list[0].Id != ids[2] || list[2].Id != ids[0] {
+		t.Errorf("Error: want tokens %v from the most recently created, got %v", ids, list)
+	}
+	if _, err := UserAccessTokenByID(c, 2, ids[0]); err != repository.ErrNoSuchEntity {
+		t.Errorf("Error: a user should not get the token of another user, got %v", err)
+	}
+
+	at, err := UserAccessTokenByID(c, 1, ids[0])
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if err = at.Destroy(c); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if _, err = AccessTokenByToken(c, tokens[0]); err != repository.ErrNoSuchEntity {
+		t.Errorf("Error: a revoked token should not be found, got %v", err)
+	}
+
+	if err = DestroyUserAccessTokens(c, 1); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if n := len(UserAccessTokens(c, 1)); n != 0 {
+		t.Errorf("Error: want no token after revoking all tokens, got %d", n)
+	}
+	if n := len(UserAccessTokens(c, 2)); n != 1 {
+		t.Errorf("Error: the tokens of other users should not be revoked, got %d", n)
+	}
+}
@@ -18,9 +18,9 @@ package models
 
 import (
 	"appengine"
-	"appengine/datastore"
 
 	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/repository"
 )
 
 // Accuracy is a placeholder for progression of the accuracy of a team in a tournament.
@@ -65,14 +65,14 @@ type AccuracyJSON struct {
 // CreateAccuracy creates an Accuracy entity.
 //
 func CreateAccuracy(c appengine.Context, teamID int64, tournamentId int64, oldmatches int) (*Accuracy, error) {
-	accuracyID, _, err := datastore.AllocateIDs(c, "Accuracy", nil, 1)
+	accuracyID, _, err := repository.AllocateIDs(c, "Accuracy", 1)
 	if err != nil {
 		return nil, err
 	}
-	key := datastore.NewKey(c, "Accuracy", "", accuracyID, nil)
+	key := repository.NewKey("Accuracy", "", accuracyID)
 	accuracies := make([]float64, oldmatches)
 	a := &Accuracy{accuracyID, teamID, tournamentId, accuracies}
-	if _, err = datastore.Put(c, key, a); err != nil {
+	if _, err = repository.Put(c, key, a); err != nil {
 		return nil, err
 	}
 	return a, nil
@@ -93,8 +93,8 @@ func (a *Accuracy) Add(c appengine.Context, acc float64) (float64, error) {
 func (a *Accuracy) Update(c appengine.Context) error {
 	k := AccuracyKeyByID(c, a.Id)
 	oldAcc := new(Accuracy)
-	if err := datastore.Get(c, k, oldAcc); err == nil {
-		if _, err = datastore.Put(c, k, a); err != nil {
+	if err := repository.Get(c, k, oldAcc); err == nil {
+		if _, err = repository.Put(c, k, a); err != nil {
 			return err
 		}
 	}
@@ -117,8 +117,8 @@ func sumInt64(a *[]int64) (sum int64) {
 
 // AccuracyKeyByID gets an accuracy key given an id.
 //
-func AccuracyKeyByID(c appengine.Context, id int64) *datastore.Key {
-	key := datastore.NewKey(c, "Accuracy", "", id, nil)
+func AccuracyKeyByID(c appengine.Context, id int64) *repository.Key {
+	key := repository.NewKey("Accuracy", "", id)
 	return key
 }
 
@@ -127,9 +127,9 @@ func AccuracyKeyByID(c appengine.Context, id int64) *datastore.Key {
 func AccuracyByID(c appengine.Context, id int64) (*Accuracy, error) {
 
 	var a Accuracy
-	key := datastore.NewKey(c, "Accuracy", "", id, nil)
+	key := repository.NewKey("Accuracy", "", id)
 
-	if err := datastore.Get(c, key, &a); err != nil {
+	if err := repository.Get(c, key, &a); err != nil {
 		log.Errorf(c, " AccuracyByID: accuracy not found : %v", err)
 		return &a, err
 	}
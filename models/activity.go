@@ -21,9 +21,9 @@ import (
 	"time"
 
 	"appengine"
-	"appengine/datastore"
 
 	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/repository"
 )
 
 // Activity is an update that shows the activity of the user on gonawin.
@@ -63,6 +63,12 @@ type ActivityJSON struct {
 	CreatorID *int64          `json:",omitempty"`
 }
 
+// publishedByUser reports whether the activity was published by a user, the creator of the
+// activities of teams and tournaments being the team or the tournament.
+func (a *Activity) publishedByUser() bool {
+	return a.CreatorID != 0 && a.Actor.Type == "user"
+}
+
 // Publisher interface
 type Publisher interface {
 	Publish(c appengine.Context, activityType string, verb string, object ActivityEntity, target ActivityEntity) error
@@ -75,14 +81,14 @@ func FindActivities(c appengine.Context, u *User, count int64, page int64) []*Ac
 	var activities []*Activity
 
 	// loop backward on all of these ids to fetch the activities
-	ids := u.ActivityIds
+	ids := u.ActivityIDs(c)
 	start, end := calculateStartAndEnd(int64(len(ids)), count, page)
 
 	for i := start; i >= end; i-- {
-		key := datastore.NewKey(c, "Activity", "", ids[i], nil)
+		key := repository.NewKey("Activity", "", ids[i])
 
 		var activity Activity
-		if err := datastore.Get(c, key, &activity); err != nil {
+		if err := repository.Get(c, key, &activity); err != nil {
 			log.Errorf(c, " Activity.FindActivities: error occurred during Get call id: %v: %v", ids[i], err)
 			continue // skip activity if not found..
 		}
@@ -92,30 +98,57 @@ func FindActivities(c appengine.Context, u *User, count int64, page int64) []*Ac
 	return activities
 }
 
+// FindActivitiesByCursor returns a page of activities for a specific user, starting
+// with the most recent ones, and the cursor of the next page.
+//
+func FindActivitiesByCursor(c appengine.Context, u *User, count int64, cursor string) ([]*Activity, string, error) {
+	if err := u.migrateRelations(c); err != nil {
+		return nil, "", err
+	}
+	ids, next, err := relatedIDsByCursor(c, userActivityKind, "FromId", u.Id, count, cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var activities []*Activity
+	for _, id := range ids {
+		key := repository.NewKey("Activity", "", id)
+
+		var activity Activity
+		if err := repository.Get(c, key, &activity); err != nil {
+			log.Errorf(c, " Activity.FindActivitiesByCursor: error occurred during Get call id: %v: %v", id, err)
+			continue // skip activity if not found..
+		}
+		activities = append(activities, &activity)
+	}
+
+	return activities, next, nil
+}
+
 // DestroyActivities deletes activities in array.
 //
 func DestroyActivities(c appengine.Context, activityIds []int64) error {
-	var keys []*datastore.Key
+	var keys []*repository.Key
 	for _, id := range activityIds {
-		keys = append(keys, datastore.NewKey(c, "Activity", "", id, nil))
+		keys = append(keys, repository.NewKey("Activity", "", id))
 	}
 
-	return datastore.DeleteMulti(c, keys)
+	return repository.DeleteMulti(c, keys)
 }
 
 // SaveActivities updates an array of users.
 //
 func SaveActivities(c appengine.Context, activities []*Activity) error {
-	var keys []*datastore.Key // := make([]*datastore.Key, len(activities))
+	var keys []*repository.Key // := make([]*repository.Key, len(activities))
 	var acts []*Activity
 	for i := range activities {
 		if activities[i] != nil {
-			key := datastore.NewKey(c, "Activity", "", activities[i].Id, nil)
+			key := repository.NewKey("Activity", "", activities[i].Id)
 			keys = append(keys, key)
 			acts = append(acts, activities[i])
 		}
 	}
-	if _, err := datastore.PutMulti(c, keys, acts); err != nil {
+	if _, err := repository.PutMulti(c, keys, acts); err != nil {
 		return err
 	}
 	return nil
@@ -126,14 +159,14 @@ func SaveActivities(c appengine.Context, activities []*Activity) error {
 //
 func (a *Activity) save(c appengine.Context) error {
 	// create new activity
-	id, _, err1 := datastore.AllocateIDs(c, "Activity", nil, 1)
+	id, _, err1 := repository.AllocateIDs(c, "Activity", 1)
 	if err1 != nil {
 		log.Errorf(c, " Activity.save: error occurred during AllocateIDs call: %v", err1)
 		return errors.New("Activity.save: unable to allocate an identifier for Activity")
 	}
-	key := datastore.NewKey(c, "Activity", "", id, nil)
+	key := repository.NewKey("Activity", "", id)
 	a.Id = id
-	if _, err := datastore.Put(c, key, a); err != nil {
+	if _, err := repository.Put(c, key, a); err != nil {
 		log.Errorf(c, " Activity.save: error occurred during Put call: %v", err)
 		return errors.New("Activity.save: unable to put Activity in Datastore")
 	}
@@ -143,11 +176,48 @@ func (a *Activity) save(c appengine.Context) error {
 // AddNewActivityID adds new activity id for a specific user.
 //
 func (a *Activity) AddNewActivityID(c appengine.Context, u *User) error {
-	// add new activity id to user activities
-	u.ActivityIds = append(u.ActivityIds, a.Id)
-	return nil
-	// // update user with new activity id
-	// return u.Update(c)
+	return a.addToFeeds(c, []int64{u.Id})
+}
+
+// addToFeeds adds the activity to the activities of users.
+func (a *Activity) addToFeeds(c appengine.Context, userIDs []int64) error {
+	relations := make([]*Relation, len(userIDs))
+	for i, id := range userIDs {
+		relations[i] = &Relation{id, a.Id, a.Published}
+	}
+	return putRelations(c, userActivityKind, relations)
+}
+
+// activityRelations returns the relations of a legacy list of activity ids of a user.
+// The relations are dated with the publication of the activities, missing activities are skipped.
+func activityRelations(c appengine.Context, userID int64, ids []int64) ([]*Relation, error) {
+	var relations []*Relation
+	for len(ids) > 0 {
+		n := len(ids)
+		if n > maxRelationsPerCall {
+			n = maxRelationsPerCall
+		}
+		keys := make([]*repository.Key, n)
+		for i, id := range ids[:n] {
+			keys[i] = repository.NewKey("Activity", "", id)
+		}
+		activities := make([]Activity, n)
+		var errs appengine.MultiError
+		if err := repository.GetMulti(c, keys, activities); err != nil {
+			var ok bool
+			if errs, ok = err.(appengine.MultiError); !ok {
+				return nil, err
+			}
+		}
+		for i := range activities {
+			if errs != nil && errs[i] != nil {
+				continue
+			}
+			relations = append(relations, &Relation{userID, ids[i], activities[i].Published})
+		}
+		ids = ids[n:]
+	}
+	return relations, nil
 }
 
 // Calculates the start and the end position in the activities slice.
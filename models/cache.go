@@ -0,0 +1,65 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package models
+
+import (
+	"time"
+
+	"appengine"
+
+	"github.com/taironas/gonawin/helpers/memcache"
+)
+
+// Time to live of cached values.
+const (
+	CalendarCacheTTL = time.Hour
+	RankingCacheTTL  = 10 * time.Minute
+)
+
+// ChangeHook is a function called after entities of a kind are updated or destroyed.
+//
+type ChangeHook func(c appengine.Context, kind string, ids []int64)
+
+var changeHooks []ChangeHook
+
+// OnChange registers a hook called after Team, Tournament, User, Tmatch and
+// Score entities are updated or destroyed.
+//
+func OnChange(hook ChangeHook) {
+	changeHooks = append(changeHooks, hook)
+}
+
+// changed runs the change hooks for entities of a kind.
+func changed(c appengine.Context, kind string, ids ...int64) {
+	for _, hook := range changeHooks {
+		hook(c, kind, ids)
+	}
+}
+
+// invalidateCache invalidates the values cached for the entities and for their kind.
+func invalidateCache(c appengine.Context, kind string, ids []int64) {
+	namespaces := make([]string, 0, len(ids)+1)
+	namespaces = append(namespaces, memcache.KindNamespace(kind))
+	for _, id := range ids {
+		namespaces = append(namespaces, memcache.Namespace(kind, id))
+	}
+	memcache.Invalidate(c, namespaces...)
+}
+
+func init() {
+	OnChange(invalidateCache)
+}
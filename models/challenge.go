@@ -0,0 +1,504 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"appengine"
+
+	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/repository"
+)
+
+// Challenge modes, what is compared between the two teams for each matchday.
+//
+const (
+	ChallengeModeAccuracy = "accuracy" // compare the team accuracy of each matchday.
+	ChallengeModeScore    = "score"    // compare the average score of the team members of each matchday.
+)
+
+// Challenge states.
+//
+const (
+	ChallengePending  = "pending"  // waiting for the challenged team to answer.
+	ChallengeAccepted = "accepted" // challenge is running.
+	ChallengeDeclined = "declined" // challenged team refused the challenge.
+	ChallengeFinished = "finished" // phase is over and the winner is known.
+)
+
+// ChallengeDay holds the values of both teams of a challenge for a single matchday.
+//
+type ChallengeDay struct {
+	Date       time.Time
+	Challenger float64 // value of the challenger team.
+	Challenged float64 // value of the challenged team.
+}
+
+// Challenge represents a competition between two teams of a tournament,
+// over a single phase or over the whole tournament.
+//
+type Challenge struct {
+	Id               int64
+	TournamentId     int64
+	TournamentName   string
+	Phase            string // name of the phase, empty when the challenge is over the whole tournament.
+	Mode             string // what is compared: accuracy or score.
+	ChallengerTeamId int64  // id of the team that created the challenge.
+	ChallengerName   string
+	ChallengedTeamId int64 // id of the team that has to accept the challenge.
+	ChallengedName   string
+	CreatorId        int64          // id of the admin who created the challenge.
+	State            string         // pending, accepted, declined or finished.
+	WinnerTeamId     int64          // id of the winner team, 0 when not finished or draw.
+	Days             []ChallengeDay // comparison of both teams, matchday by matchday.
+	Created          time.Time
+	Finished         time.Time
+}
+
+// ChallengeJSON is the JSON representation of the Challenge entity.
+//
+type ChallengeJSON struct {
+	Id               *int64          `json:",omitempty"`
+	TournamentId     *int64          `json:",omitempty"`
+	TournamentName   *string         `json:",omitempty"`
+	Phase            *string         `json:",omitempty"`
+	Mode             *string         `json:",omitempty"`
+	ChallengerTeamId *int64          `json:",omitempty"`
+	ChallengerName   *string         `json:",omitempty"`
+	ChallengedTeamId *int64          `json:",omitempty"`
+	ChallengedName   *string         `json:",omitempty"`
+	CreatorId        *int64          `json:",omitempty"`
+	State            *string         `json:",omitempty"`
+	WinnerTeamId     *int64          `json:",omitempty"`
+	Days             *[]ChallengeDay `json:",omitempty"`
+	Created          *time.Time      `json:",omitempty"`
+	Finished         *time.Time      `json:",omitempty"`
+}
+
+// IsValidChallengeMode checks if mode is a supported challenge mode.
+//
+func IsValidChallengeMode(mode string) bool {
+	return mode == ChallengeModeAccuracy || mode == ChallengeModeScore
+}
+
+// CreateChallenge creates a pending challenge of team challenger against team challenged in a tournament.
+// An empty phase means that the challenge lasts the whole tournament.
+//
+func CreateChallenge(c appengine.Context, t *Tournament, challenger *Team, challenged *Team, phase string, mode string, creatorID int64) (*Challenge, error) {
+
+	if !IsValidChallengeMode(mode) {
+		return nil, fmt.Errorf("model/challenge: mode %s is not supported", mode)
+	}
+
+	id, _, err := repository.AllocateIDs(c, "Challenge", 1)
+	if err != nil {
+		return nil, err
+	}
+
+	key := repository.NewKey("Challenge", "", id)
+
+	var emptyDays []ChallengeDay
+	challenge := &Challenge{
+		Id:               id,
+		TournamentId:     t.Id,
+		TournamentName:   t.Name,
+		Phase:            phase,
+		Mode:             mode,
+		ChallengerTeamId: challenger.Id,
+		ChallengerName:   challenger.Name,
+		ChallengedTeamId: challenged.Id,
+		ChallengedName:   challenged.Name,
+		CreatorId:        creatorID,
+		State:            ChallengePending,
+		Days:             emptyDays,
+		Created:          time.Now(),
+	}
+
+	if _, err = repository.Put(c, key, challenge); err != nil {
+		return nil, err
+	}
+
+	return challenge, nil
+}
+
+// Destroy a challenge entity.
+//
+func (ch *Challenge) Destroy(c appengine.Context) error {
+
+	if _, err := ChallengeByID(c, ch.Id); err != nil {
+		return fmt.Errorf("Cannot find challenge with Id=%d", ch.Id)
+	}
+
+	key := repository.NewKey("Challenge", "", ch.Id)
+
+	return repository.Delete(c, key)
+}
+
+// ChallengeByID gets a challenge given an id.
+//
+func ChallengeByID(c appengine.Context, id int64) (*Challenge, error) {
+
+	var ch Challenge
+	key := repository.NewKey("Challenge", "", id)
+
+	if err := repository.Get(c, key, &ch); err != nil {
+		log.Errorf(c, " challenge not found : %v", err)
+		return nil, err
+	}
+	return &ch, nil
+}
+
+// ChallengeKeyByID gets a challenge key given an id.
+//
+func ChallengeKeyByID(c appengine.Context, id int64) *repository.Key {
+	return repository.NewKey("Challenge", "", id)
+}
+
+// Update a challenge entity.
+//
+func (ch *Challenge) Update(c appengine.Context) error {
+	k := ChallengeKeyByID(c, ch.Id)
+	old := new(Challenge)
+	if err := repository.Get(c, k, old); err == nil {
+		if _, err = repository.Put(c, k, ch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FindChallenges searches for all challenge entities with respect of a filter and a value.
+//
+func FindChallenges(c appengine.Context, filter string, value interface{}) []*Challenge {
+
+	q := repository.NewQuery("Challenge").Filter(filter+" =", value)
+
+	var challenges []*Challenge
+
+	if _, err := q.GetAll(c, &challenges); err != nil {
+		log.Errorf(c, " Challenge.Find, error occurred during GetAll: %v", err)
+		return nil
+	}
+
+	return challenges
+}
+
+// TeamChallenges returns all the challenges a team is involved in, either as challenger or as challenged team.
+//
+func TeamChallenges(c appengine.Context, teamID int64) []*Challenge {
+	challenges := FindChallenges(c, "ChallengerTeamId", teamID)
+	return append(challenges, FindChallenges(c, "ChallengedTeamId", teamID)...)
+}
+
+// ChallengeExists checks if a pending or running challenge already exists between two teams
+// for the same tournament and phase, whatever team created it.
+//
+func ChallengeExists(c appengine.Context, tournamentID int64, phase string, teamID1 int64, teamID2 int64) bool {
+	for _, ch := range FindChallenges(c, "TournamentId", tournamentID) {
+		if ch.Phase != phase || ch.State == ChallengeDeclined || ch.State == ChallengeFinished {
+			continue
+		}
+		if ch.Involves(teamID1) && ch.Involves(teamID2) {
+			return true
+		}
+	}
+	return false
+}
+
+// Involves checks if a team takes part in the challenge.
+//
+func (ch *Challenge) Involves(teamID int64) bool {
+	return ch.ChallengerTeamId == teamID || ch.ChallengedTeamId == teamID
+}
+
+// Accept sets the challenge as running.
+//
+func (ch *Challenge) Accept(c appengine.Context) error {
+	if ch.State != ChallengePending {
+		return errors.New("model/challenge: only a pending challenge can be accepted")
+	}
+	ch.State = ChallengeAccepted
+	return ch.Update(c)
+}
+
+// Decline sets the challenge as declined.
+//
+func (ch *Challenge) Decline(c appengine.Context) error {
+	if ch.State != ChallengePending {
+		return errors.New("model/challenge: only a pending challenge can be declined")
+	}
+	ch.State = ChallengeDeclined
+	return ch.Update(c)
+}
+
+// Matches returns the matches of the tournament the challenge is about.
+//
+func (ch *Challenge) Matches(c appengine.Context, t *Tournament) []*Tmatch {
+	if len(ch.Phase) == 0 {
+		return GetAllMatchesFromTournament(c, t)
+	}
+	return GetMatchesByPhase(c, t, ch.Phase)
+}
+
+// Comparison computes, for each matchday with finished matches, the value of both teams.
+// The values of the matchdays that are over are the stored ones, see RecordChallengeDays.
+//
+func (ch *Challenge) Comparison(c appengine.Context, t *Tournament) ([]ChallengeDay, error) {
+
+	var finished []Tmatch
+	for _, m := range ch.Matches(c, t) {
+		if m.Finished {
+			finished = append(finished, *m)
+		}
+	}
+
+	days := MatchesGroupByDay(finished)
+	comparison := make([]ChallengeDay, len(days))
+	var challengerPlayers, challengedPlayers []*User
+	loaded := false
+	for i, day := range days {
+		if stored := ch.day(day.Date); stored != nil {
+			comparison[i] = *stored
+			continue
+		}
+		if !loaded {
+			var err error
+			if challengerPlayers, challengedPlayers, err = ch.players(c); err != nil {
+				return nil, err
+			}
+			loaded = true
+		}
+		comparison[i].Date = day.Date
+		comparison[i].Challenger = ch.matchdayValue(c, challengerPlayers, day.Matches)
+		comparison[i].Challenged = ch.matchdayValue(c, challengedPlayers, day.Matches)
+	}
+	return comparison, nil
+}
+
+// recordFinishedDays stores the values of both teams for the matchdays whose matches are all finished,
+// with the current members of the teams. The matchdays already stored are kept as they are.
+//
+func (ch *Challenge) recordFinishedDays(c appengine.Context, t *Tournament) error {
+
+	var matches []Tmatch
+	for _, m := range ch.Matches(c, t) {
+		matches = append(matches, *m)
+	}
+
+	var challengerPlayers, challengedPlayers []*User
+	recorded := false
+	for _, day := range MatchesGroupByDay(matches) {
+		if ch.day(day.Date) != nil || !dayIsOver(day) {
+			continue
+		}
+		if !recorded {
+			var err error
+			if challengerPlayers, challengedPlayers, err = ch.players(c); err != nil {
+				return err
+			}
+			recorded = true
+		}
+		ch.Days = append(ch.Days, ChallengeDay{
+			Date:       day.Date,
+			Challenger: ch.matchdayValue(c, challengerPlayers, day.Matches),
+			Challenged: ch.matchdayValue(c, challengedPlayers, day.Matches),
+		})
+	}
+	if !recorded {
+		return nil
+	}
+	return ch.Update(c)
+}
+
+// day returns the stored values of the matchday at date, nil if they are not stored.
+func (ch *Challenge) day(date time.Time) *ChallengeDay {
+	for i := range ch.Days {
+		if ch.Days[i].Date.Equal(date) {
+			return &ch.Days[i]
+		}
+	}
+	return nil
+}
+
+// players returns the current members of the challenger and of the challenged teams.
+func (ch *Challenge) players(c appengine.Context) ([]*User, []*User, error) {
+	var challenger, challenged *Team
+	var err error
+	if challenger, err = TeamByID(c, ch.ChallengerTeamId); err != nil {
+		return nil, nil, err
+	}
+	if challenged, err = TeamByID(c, ch.ChallengedTeamId); err != nil {
+		return nil, nil, err
+	}
+
+	var challengerPlayers, challengedPlayers []*User
+	if challengerPlayers, err = challenger.Players(c); err != nil {
+		return nil, nil, err
+	}
+	if challengedPlayers, err = challenged.Players(c); err != nil {
+		return nil, nil, err
+	}
+	return challengerPlayers, challengedPlayers, nil
+}
+
+// dayIsOver checks if all the matches of a day are finished.
+func dayIsOver(day Tday) bool {
+	for _, m := range day.Matches {
+		if !m.Finished {
+			return false
+		}
+	}
+	return true
+}
+
+// matchdayValue computes the value of a team for the matches of a single day.
+// In accuracy mode it is the sum of the scores of the members over the maximum score the team could get.
+// In score mode it is the average score of the members.
+//
+func (ch *Challenge) matchdayValue(c appengine.Context, players []*User, matches []Tmatch) float64 {
+	if len(players) == 0 || len(matches) == 0 {
+		return float64(0)
+	}
+
+	sum := int64(0)
+	for _, p := range players {
+		for i := range matches {
+			if score, err := p.ScoreForMatch(c, &matches[i]); err == nil {
+				sum += score
+			}
+		}
+	}
+
+	if ch.Mode == ChallengeModeAccuracy {
+		max := 3 * len(players) * len(matches)
+		return float64(sum) / float64(max)
+	}
+	return float64(sum) / float64(len(players))
+}
+
+// Totals returns the sum of the matchday values for the challenger and the challenged team.
+//
+func (ch *Challenge) Totals() (challenger float64, challenged float64) {
+	for _, d := range ch.Days {
+		challenger += d.Challenger
+		challenged += d.Challenged
+	}
+	return
+}
+
+// finish computes the final comparison of the challenge, declares the winner
+// and gives a trophy to the winner team.
+//
+func (ch *Challenge) finish(c appengine.Context, t *Tournament) error {
+	desc := "Challenge.finish:"
+
+	if err := ch.recordFinishedDays(c, t); err != nil {
+		return err
+	}
+	days, err := ch.Comparison(c, t)
+	if err != nil {
+		return err
+	}
+
+	ch.Days = days
+	ch.State = ChallengeFinished
+	ch.Finished = time.Now()
+
+	challenger, challenged := ch.Totals()
+	if challenger > challenged {
+		ch.WinnerTeamId = ch.ChallengerTeamId
+	} else if challenged > challenger {
+		ch.WinnerTeamId = ch.ChallengedTeamId
+	}
+
+	if err = ch.Update(c); err != nil {
+		return err
+	}
+
+	if ch.WinnerTeamId == 0 {
+		log.Infof(c, "%s challenge %d ended with a draw", desc, ch.Id)
+		return nil
+	}
+
+	var winner, loser *Team
+	if winner, err = TeamByID(c, ch.WinnerTeamId); err != nil {
+		return err
+	}
+	loserID := ch.ChallengedTeamId
+	if ch.WinnerTeamId == ch.ChallengedTeamId {
+		loserID = ch.ChallengerTeamId
+	}
+	if loser, err = TeamByID(c, loserID); err != nil {
+		return err
+	}
+
+	description := fmt.Sprintf("Won the %s challenge against %s", ch.Mode, loser.Name)
+	if len(ch.Phase) > 0 {
+		description = fmt.Sprintf("%s (%s)", description, ch.Phase)
+	}
+
+	var trophy *Trophy
+	if trophy, err = CreateTrophy(c, winner.Id, t.Id, t.Name, ch.Id, description); err != nil {
+		return err
+	}
+
+	if err = winner.AddTrophyID(c, trophy.Id); err != nil {
+		return err
+	}
+
+	// publish new activity
+	winner.Publish(c, "challenge", "won the challenge against", loser.Entity(), t.Entity())
+	return nil
+}
+
+// ResolveChallenges finishes all the running challenges of the tournament
+// that are about the given phase. When lastPhase is true, the challenges
+// over the whole tournament are finished as well.
+//
+func (t *Tournament) ResolveChallenges(c appengine.Context, phase string, lastPhase bool) {
+	desc := "Tournament.ResolveChallenges:"
+
+	for _, ch := range FindChallenges(c, "TournamentId", t.Id) {
+		if ch.State != ChallengeAccepted {
+			continue
+		}
+		if ch.Phase == phase || (lastPhase && len(ch.Phase) == 0) {
+			if err := ch.finish(c, t); err != nil {
+				log.Errorf(c, "%s unable to finish challenge %d: %v", desc, ch.Id, err)
+			}
+		}
+	}
+}
+
+// RecordChallengeDays stores the values of the matchdays that are over for all the running challenges
+// of the tournament, so that the members who join or leave a team afterwards do not change them.
+//
+func (t *Tournament) RecordChallengeDays(c appengine.Context) {
+	desc := "Tournament.RecordChallengeDays:"
+
+	for _, ch := range FindChallenges(c, "TournamentId", t.Id) {
+		if ch.State != ChallengeAccepted {
+			continue
+		}
+		if err := ch.recordFinishedDays(c, t); err != nil {
+			log.Errorf(c, "%s unable to record the matchdays of challenge %d: %v", desc, ch.Id, err)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"appengine/aetest"
+
+	"github.com/taironas/gonawin/helpers/memcache"
+	"github.com/taironas/gonawin/repository"
+)
+
+// TestChallengeStates tests that a challenge can only be accepted or declined while pending.
+//
+func TestChallengeStates(t *testing.T) {
+	var c aetest.Context
+	var err error
+	options := aetest.Options{StronglyConsistentDatastore: true}
+
+	if c, err = aetest.NewContext(&options); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var tournament *Tournament
+	if tournament, err = CreateTournament(c, "tournament", "description", time.Now(), time.Now(), 10); err != nil {
+		t.Fatal(err)
+	}
+
+	teamIDs := createTeamsFromTestTeams(t, c, createTestTeams(2))
+	var challenger, challenged *Team
+	if challenger, err = TeamByID(c, teamIDs[0]); err != nil {
+		t.Fatal(err)
+	}
+	if challenged, err = TeamByID(c, teamIDs[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		title  string
+		mode   string
+		accept bool
+		state  string
+	}{
+		{
+			title:  "can accept an accuracy challenge",
+			mode:   ChallengeModeAccuracy,
+			accept: true,
+			state:  ChallengeAccepted,
+		},
+		{
+			title:  "can decline a score challenge",
+			mode:   ChallengeModeScore,
+			accept: false,
+			state:  ChallengeDeclined,
+		},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+		var got *Challenge
+		if got, err = CreateChallenge(c, tournament, challenger, challenged, "", test.mode, 10); err != nil {
+			t.Errorf("test %v - Error: %v", i, err)
+			continue
+		}
+		if got.State != ChallengePending {
+			t.Errorf("test %v - Error: want State == %s, got %s", i, ChallengePending, got.State)
+		}
+		if !ChallengeExists(c, tournament.Id, "", challenged.Id, challenger.Id) {
+			t.Errorf("test %v - Error: challenge not found", i)
+		}
+
+		if test.accept {
+			err = got.Accept(c)
+		} else {
+			err = got.Decline(c)
+		}
+		if err != nil {
+			t.Errorf("test %v - Error: %v", i, err)
+		}
+
+		var updated *Challenge
+		if updated, err = ChallengeByID(c, got.Id); err != nil {
+			t.Errorf("test %v - Error: %v", i, err)
+		} else if updated.State != test.state {
+			t.Errorf("test %v - Error: want State == %s, got %s", i, test.state, updated.State)
+		}
+
+		if err = got.Accept(c); err == nil {
+			t.Errorf("test %v - Error: challenge accepted twice", i)
+		}
+
+		if err = got.Destroy(c); err != nil {
+			t.Errorf("test %v - Error: %v", i, err)
+		}
+	}
+}
+
+// TestChallengeTotals tests the sum of the matchday values of a challenge.
+//
+func TestChallengeTotals(t *testing.T) {
+	tests := []struct {
+		title      string
+		days       []ChallengeDay
+		challenger float64
+		challenged float64
+	}{
+		{
+			title: "no matchday played",
+		},
+		{
+			title:      "two matchdays played",
+			days:       []ChallengeDay{{time.Now(), 0.5, 0.25}, {time.Now(), 0.25, 0.5}},
+			challenger: 0.75,
+			challenged: 0.75,
+		},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+		ch := Challenge{Days: test.days}
+		challenger, challenged := ch.Totals()
+		if challenger != test.challenger || challenged != test.challenged {
+			t.Errorf("test %v - Error: want totals == %v/%v, got %v/%v", i, test.challenger, test.challenged, challenger, challenged)
+		}
+	}
+}
+
+// TestChallengeMatchdayValues tests that the values of a matchday are stored when it is over, and are not
+// changed by the members who join or leave a team afterwards.
+// The first matchday has a match, the second one has two matches.
+//
+func TestChallengeMatchdayValues(t *testing.T) {
+	repository.Use(repository.NewMemory())
+	defer repository.Use(repository.Datastore)
+	memcache.Use(memcache.NewMemory())
+
+	c := repository.NewLocalContext(nil)
+
+	users := make(map[string]*User)
+	for _, name := range []string{"arya", "sansa", "cersei"} {
+		u, err := CreateUser(c, name+"@westeros.com", name, name, "", false, "")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		users[name] = u
+	}
+
+	teams := make(map[string]*Team)
+	for name, member := range map[string]string{"starks": "arya", "lannisters": "cersei"} {
+		team, err := CreateTeam(c, name, "", users[member].Id, false)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if err = team.Join(c, users[member]); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		teams[name] = team
+	}
+
+	tournament, err := CreateTournament(c, "world cup", "", time.Now(), time.Now(), users["arya"].Id)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	day := time.Date(2014, time.June, 12, 17, 0, 0, 0, time.UTC)
+	var matches []*Tmatch
+	for _, m := range []Tmatch{
+		{Date: day, Result1: 1, Result2: 0, Finished: true},
+		{Date: day.AddDate(0, 0, 1), Result1: 2, Result2: 1, Finished: true},
+		{Date: day.AddDate(0, 0, 1).Add(3 * time.Hour)},
+	} {
+		var id int64
+		if id, _, err = repository.AllocateIDs(c, "Tmatch", 1); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		match := m
+		match.Id = id
+		match.IdNumber = int64(len(matches) + 1)
+		if _, err = repository.Put(c, MatchKeyByID(c, id), &match); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		matches = append(matches, &match)
+		tournament.Matches1stStage = append(tournament.Matches1stStage, id)
+	}
+
+	// arya scores 3 on the first two matches, cersei 0 then 1, and sansa 0 on each match.
+	predicts := map[string][][3]int64{
+		"arya":   {{0, 1, 0}, {1, 2, 1}},
+		"cersei": {{0, 0, 1}, {1, 1, 0}},
+		"sansa":  {{0, 0, 1}, {1, 0, 3}, {2, 0, 3}},
+	}
+	for name, ps := range predicts {
+		for _, p := range ps {
+			if _, err = CreatePredict(c, users[name].Id, p[1], p[2], matches[p[0]].Id); err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+		}
+	}
+
+	challenge, err := CreateChallenge(c, tournament, teams["starks"], teams["lannisters"], "", ChallengeModeScore, users["arya"].Id)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if err = challenge.Accept(c); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	tests := []struct {
+		title  string
+		change func() error
+		stored int          // number of matchdays stored.
+		want   [][2]float64 // values of the challenger and the challenged team of each matchday.
+	}{
+		{
+			title:  "the first matchday is over",
+			change: func() error { tournament.RecordChallengeDays(c); return nil },
+			stored: 1,
+			want:   [][2]float64{{3, 0}, {3, 1}},
+		},
+		{
+			title:  "a member joining does not change the matchdays that are over",
+			change: func() error { return teams["starks"].Join(c, users["sansa"]) },
+			stored: 1,
+			want:   [][2]float64{{3, 0}, {1.5, 1}},
+		},
+		{
+			title: "the second matchday is over",
+			change: func() error {
+				matches[2].Result1, matches[2].Result2, matches[2].Finished = 1, 1, true
+				if err := UpdateMatch(c, matches[2]); err != nil {
+					return err
+				}
+				tournament.RecordChallengeDays(c)
+				return nil
+			},
+			stored: 2,
+			want:   [][2]float64{{3, 0}, {1.5, 1}},
+		},
+		{
+			title:  "a member leaving does not change the matchdays that are over",
+			change: func() error { return teams["starks"].Kick(c, users["sansa"]) },
+			stored: 2,
+			want:   [][2]float64{{3, 0}, {1.5, 1}},
+		},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+		if err = test.change(); err != nil {
+			t.Fatalf("test %v - Error: %v", i, err)
+		}
+
+		var ch *Challenge
+		if ch, err = ChallengeByID(c, challenge.Id); err != nil {
+			t.Fatalf("test %v - Error: %v", i, err)
+		}
+		if len(ch.Days) != test.stored {
+			t.Errorf("test %v - Error: want %d matchdays stored, got %d", i, test.stored, len(ch.Days))
+		}
+
+		var days []ChallengeDay
+		if days, err = ch.Comparison(c, tournament); err != nil {
+			t.Fatalf("test %v - Error: %v", i, err)
+		}
+		if len(days) != len(test.want) {
+			t.Fatalf("test %v - Error: want %d matchdays, got %d", i, len(test.want), len(days))
+		}
+		for j, d := range days {
+			if d.Challenger != test.want[j][0] || d.Challenged != test.want[j][1] {
+				t.Errorf("test %v - Error: matchday %d, want values %v, got %v/%v", i, j, test.want[j], d.Challenger, d.Challenged)
+			}
+		}
+	}
+}
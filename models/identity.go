@@ -0,0 +1,266 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"appengine"
+
+	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/platform"
+	"github.com/taironas/gonawin/repository"
+)
+
+// Providers of the identities a user can sign in with.
+const (
+	IdentityGoogle   = "google"
+	IdentityFacebook = "facebook"
+	IdentityTwitter  = "twitter"
+)
+
+// IdentityProviders is the list of the providers a user can sign in with.
+//
+var IdentityProviders = []string{IdentityGoogle, IdentityFacebook, IdentityTwitter}
+
+var (
+	// ErrIdentityLinked is returned when linking an identity already linked to another user.
+	ErrIdentityLinked = errors.New("model/identity: identity already linked to another user")
+	// ErrIdentityProviderLinked is returned when linking a second identity of the same provider to a user.
+	ErrIdentityProviderLinked = errors.New("model/identity: user already has an identity of this provider")
+	// ErrLastIdentity is returned when unlinking the only identity a user can sign in with.
+	ErrLastIdentity = errors.New("model/identity: cannot unlink the last identity of a user")
+)
+
+// Identity represents the account of a user at a provider, like his Twitter account.
+//
+// An identity is keyed by its provider and the id of the account at the provider, so
+// that a user signs in to the same gonawin user whatever the email or name he uses.
+//
+type Identity struct {
+	UserId     int64
+	Provider   string // one of IdentityProviders.
+	ExternalId string // id of the account at the provider.
+	Created    time.Time
+}
+
+// IsValidIdentityProvider checks if users can sign in with a provider.
+//
+func IsValidIdentityProvider(provider string) bool {
+	for _, p := range IdentityProviders {
+		if p == provider {
+			return true
+		}
+	}
+	return false
+}
+
+// RegisterIdentityProvider adds a provider to the providers users can sign in with,
+// like an OpenID Connect provider configured for gonawin.
+//
+func RegisterIdentityProvider(provider string) error {
+	if len(provider) == 0 || strings.Contains(provider, "/") {
+		return fmt.Errorf("model/identity: invalid provider name %q", provider)
+	}
+	if IsValidIdentityProvider(provider) {
+		return fmt.Errorf("model/identity: provider %s is already registered", provider)
+	}
+	IdentityProviders = append(IdentityProviders, provider)
+	return nil
+}
+
+// identityKey returns the key of the identity of an account at a provider.
+func identityKey(provider, externalID string) *repository.Key {
+	return repository.NewKey("Identity", identityAccount(provider, externalID), 0)
+}
+
+// identityAccount returns the name of an account at a provider, "provider/externalId".
+func identityAccount(provider, externalID string) string {
+	return provider + "/" + externalID
+}
+
+// Account returns the name of the account of the identity, "provider/externalId", as
+// used to configure the gonawin admins of the standalone server.
+//
+func (i *Identity) Account() string {
+	return identityAccount(i.Provider, i.ExternalId)
+}
+
+// IdentityByProvider returns the identity of an account at a provider.
+//
+func IdentityByProvider(c appengine.Context, provider, externalID string) (*Identity, error) {
+	if !IsValidIdentityProvider(provider) || len(externalID) == 0 {
+		return nil, repository.ErrNoSuchEntity
+	}
+
+	var i Identity
+	if err := repository.Get(c, identityKey(provider, externalID), &i); err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+// Identities returns the identities linked to the user.
+//
+func (u *User) Identities(c appengine.Context) []*Identity {
+	q := repository.NewQuery("Identity").Filter("UserId =", u.Id)
+
+	var identities []*Identity
+	if _, err := q.GetAll(c, &identities); err != nil {
+		log.Errorf(c, "User.Identities: error occurred during GetAll: %v", err)
+	}
+	return identities
+}
+
+// identity returns the identity of the user at a provider, nil if there is none.
+func (u *User) identity(c appengine.Context, provider string) *Identity {
+	for _, i := range u.Identities(c) {
+		if i.Provider == provider {
+			return i
+		}
+	}
+	return nil
+}
+
+// LinkIdentity links the account of a provider to the user, the user can then sign in with it.
+// A user has at most one identity per provider and an identity belongs to a single user.
+//
+func (u *User) LinkIdentity(c appengine.Context, provider, externalID string) error {
+	if !IsValidIdentityProvider(provider) || len(externalID) == 0 {
+		return fmt.Errorf("model/identity: invalid identity %s/%s", provider, externalID)
+	}
+
+	if i, err := IdentityByProvider(c, provider, externalID); err == nil {
+		if i.UserId != u.Id {
+			return ErrIdentityLinked
+		}
+		return nil
+	} else if err != repository.ErrNoSuchEntity {
+		return err
+	}
+
+	if u.identity(c, provider) != nil {
+		return ErrIdentityProviderLinked
+	}
+
+	i := &Identity{u.Id, provider, externalID, time.Now()}
+	if _, err := repository.Put(c, identityKey(provider, externalID), i); err != nil {
+		log.Errorf(c, "User.LinkIdentity: %v", err)
+		return err
+	}
+	return nil
+}
+
+// UnlinkIdentity unlinks the account of a provider from the user.
+// The last identity of a user cannot be unlinked, he would not be able to sign in anymore.
+//
+func (u *User) UnlinkIdentity(c appengine.Context, provider string) error {
+	identities := u.Identities(c)
+
+	var i *Identity
+	for _, identity := range identities {
+		if identity.Provider == provider {
+			i = identity
+		}
+	}
+	if i == nil {
+		return repository.ErrNoSuchEntity
+	}
+	if len(identities) == 1 {
+		return ErrLastIdentity
+	}
+	return repository.Delete(c, identityKey(i.Provider, i.ExternalId))
+}
+
+// DestroyUserIdentities unlinks all the accounts linked to a user.
+//
+func DestroyUserIdentities(c appengine.Context, userID int64) error {
+	keys, err := repository.NewQuery("Identity").Filter("UserId =", userID).KeysOnly().GetAll(c, nil)
+	if err != nil {
+		return err
+	}
+	return repository.DeleteMulti(c, keys)
+}
+
+// SigninUserWithIdentity signs in the user of the account of a provider and returns a pointer to it.
+//
+// The email must be given by the provider. Only when the provider verified it, emailVerified, the user
+// with this email is found and the identity is linked to him. A user who signed in before identities
+// existed is found once as he was then, see legacyUser. Otherwise a user is created, accounts of the
+// same person can then be merged by an admin.
+//
+func SigninUserWithIdentity(c appengine.Context, provider, externalID, email string, emailVerified bool, username, name string) (*User, error) {
+	if !IsValidIdentityProvider(provider) || len(externalID) == 0 {
+		return nil, fmt.Errorf("model/identity: invalid identity %s/%s", provider, externalID)
+	}
+
+	if i, err := IdentityByProvider(c, provider, externalID); err == nil {
+		return UserByID(c, i.UserId)
+	} else if err != repository.ErrNoSuchEntity {
+		return nil, err
+	}
+
+	var user *User
+	if emailVerified && len(email) > 0 {
+		user = FindUser(c, "Email", strings.ToLower(email))
+	}
+	if user == nil {
+		user = legacyUser(c, provider, email, username)
+	}
+	// a user with another account of the provider is a different person.
+	if user != nil && user.identity(c, provider) != nil {
+		user = nil
+	}
+
+	if user == nil {
+		var err error
+		isAdmin := platform.IsAdmin(c, 0, []string{identityAccount(provider, externalID)})
+		if user, err = CreateUser(c, email, username, name, "", isAdmin, ""); err != nil {
+			log.Errorf(c, "Signup: %v", err)
+			return nil, errors.New("model/user: unable to create user")
+		}
+		// publish new activity
+		user.Publish(c, "welcome", "joined gonawin", ActivityEntity{}, ActivityEntity{})
+	}
+
+	if err := user.LinkIdentity(c, provider, externalID); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// legacyUser returns the user who signed in with a provider before identities existed, found as he was
+// then: by his username for Twitter, the users created by Twitter have no email, and by his email for Facebook.
+// The user is only linked once, when he has no identity of the provider yet.
+func legacyUser(c appengine.Context, provider, email, username string) *User {
+	switch provider {
+	case IdentityTwitter:
+		if len(username) > 0 {
+			if u := FindUser(c, "Username", username); u != nil && len(u.Email) == 0 {
+				return u
+			}
+		}
+	case IdentityFacebook:
+		if len(email) > 0 {
+			return FindUser(c, "Email", strings.ToLower(email))
+		}
+	}
+	return nil
+}
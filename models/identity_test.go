@@ -0,0 +1,164 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/taironas/gonawin/helpers/memcache"
+	"github.com/taironas/gonawin/repository"
+)
+
+// TestSigninUserWithIdentity tests that a user signs in to the same account with his linked identities.
+//
+func TestSigninUserWithIdentity(t *testing.T) {
+	repository.Use(repository.NewMemory())
+	defer repository.Use(repository.Datastore)
+	memcache.Use(memcache.NewMemory())
+
+	c := repository.NewLocalContext(nil)
+
+	// users who signed in before identities existed, with Google, Twitter and Facebook.
+	legacy, err := CreateUser(c, "robb.stark@winterfell.com", "robb.stark", "Robb Stark", "", false, "")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	tyrion, err := CreateUser(c, "", "imp", "Tyrion Lannister", "", false, "")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	catelyn, err := CreateUser(c, "catelyn@riverrun.com", "Catelyn Stark", "Catelyn Stark", "", false, "")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	john, err := SigninUserWithIdentity(c, IdentityGoogle, "1", "john.snow@winterfell.com", true, "john.snow", "John Snow")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if err = john.LinkIdentity(c, IdentityTwitter, "42"); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	tests := []struct {
+		title      string
+		provider   string
+		externalID string
+		email      string
+		verified   bool
+		username   string
+		want       int64
+		created    bool
+	}{
+		{title: "same identity signs in to the same user", provider: IdentityGoogle, externalID: "1", email: "john@castleblack.com", want: john.Id},
+		{title: "linked identity signs in to the same user", provider: IdentityTwitter, externalID: "42", username: "lord.snow", want: john.Id},
+		{title: "unverified email does not sign in to the user with this email", provider: IdentityGoogle, externalID: "6", email: "robb.stark@winterfell.com", created: true},
+		{title: "username does not sign in to a user who did not sign in with Twitter", provider: IdentityTwitter, externalID: "8", username: "robb.stark", created: true},
+		{title: "legacy Twitter user is found by username", provider: IdentityTwitter, externalID: "10", username: "imp", want: tyrion.Id},
+		{title: "legacy Twitter user is found by identity once linked", provider: IdentityTwitter, externalID: "10", username: "halfman", want: tyrion.Id},
+		{title: "legacy Twitter user is linked only once", provider: IdentityTwitter, externalID: "11", username: "imp", created: true},
+		{title: "legacy Facebook user is found by email", provider: IdentityFacebook, externalID: "20", email: "Catelyn@Riverrun.com", want: catelyn.Id},
+		{title: "legacy Facebook user is found by identity once linked", provider: IdentityFacebook, externalID: "20", want: catelyn.Id},
+		{title: "legacy Facebook user is linked only once", provider: IdentityFacebook, externalID: "21", email: "catelyn@riverrun.com", created: true},
+		{title: "legacy user is found by verified email", provider: IdentityFacebook, externalID: "7", email: "Robb.Stark@winterfell.com", verified: true, want: legacy.Id},
+		{title: "legacy user is found by identity once linked", provider: IdentityFacebook, externalID: "7", want: legacy.Id},
+		{title: "another account of a linked provider is another user", provider: IdentityGoogle, externalID: "2", email: "john.snow@winterfell.com", verified: true, created: true},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+		u, err := SigninUserWithIdentity(c, test.provider, test.externalID, test.email, test.verified, test.username, "name")
+		if err != nil {
+			t.Errorf("test %v - Error: %v", i, err)
+			continue
+		}
+		if test.created {
+			if u.Id == john.Id || u.Id == legacy.Id || u.Id == tyrion.Id || u.Id == catelyn.Id {
+				t.Errorf("test %v - Error: want a new user, got user %d", i, u.Id)
+			}
+		} else if u.Id != test.want {
+			t.Errorf("test %v - Error: want user %d, got %d", i, test.want, u.Id)
+		}
+	}
+
+	if _, err = SigninUserWithIdentity(c, "myspace", "1", "", false, "", ""); err == nil {
+		t.Errorf("Error: want an error for an unknown provider")
+	}
+}
+
+// TestUserLinkIdentity tests the linking and unlinking of identities.
+//
+func TestUserLinkIdentity(t *testing.T) {
+	repository.Use(repository.NewMemory())
+	defer repository.Use(repository.Datastore)
+	memcache.Use(memcache.NewMemory())
+
+	c := repository.NewLocalContext(nil)
+
+	john, err := SigninUserWithIdentity(c, IdentityGoogle, "1", "john.snow@winterfell.com", true, "john.snow", "John Snow")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	robb, err := SigninUserWithIdentity(c, IdentityTwitter, "2", "", false, "robb.stark", "Robb Stark")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	tests := []struct {
+		title      string
+		provider   string
+		externalID string
+		err        error
+	}{
+		{title: "can link an identity", provider: IdentityFacebook, externalID: "3"},
+		{title: "can link an identity twice", provider: IdentityFacebook, externalID: "3"},
+		{title: "cannot link a second identity of a provider", provider: IdentityFacebook, externalID: "4", err: ErrIdentityProviderLinked},
+		{title: "cannot link the identity of another user", provider: IdentityTwitter, externalID: "2", err: ErrIdentityLinked},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+		if err = john.LinkIdentity(c, test.provider, test.externalID); err != test.err {
+			t.Errorf("test %v - Error: want err %v, got %v", i, test.err, err)
+		}
+	}
+
+	if n := len(john.Identities(c)); n != 2 {
+		t.Errorf("Error: want 2 identities, got %d", n)
+	}
+	if err = john.UnlinkIdentity(c, IdentityFacebook); err != nil {
+		t.Errorf("Error: %v", err)
+	}
+	if err = john.UnlinkIdentity(c, IdentityFacebook); err != repository.ErrNoSuchEntity {
+		t.Errorf("Error: want err %v, got %v", repository.ErrNoSuchEntity, err)
+	}
+	if err = robb.UnlinkIdentity(c, IdentityTwitter); err != ErrLastIdentity {
+		t.Errorf("Error: want err %v, got %v", ErrLastIdentity, err)
+	}
+}
+
+// TestRegisterIdentityProvider tests the registration of the providers users can sign in with.
+//
+func TestRegisterIdentityProvider(t *testing.T) {
+	defer func(providers []string) { IdentityProviders = providers }(IdentityProviders)
+
+	tests := []struct {
+		title    string
+		provider string
+		ok       bool
+	}{
+		{title: "can register a provider", provider: "acme", ok: true},
+		{title: "cannot register a provider twice", provider: "acme"},
+		{title: "cannot register a builtin provider", provider: IdentityGoogle},
+		{title: "cannot register a provider without name", provider: ""},
+		{title: "cannot register a provider with a slash", provider: "acme/corp"},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+		if err := RegisterIdentityProvider(test.provider); (err == nil) != test.ok {
+			t.Errorf("test %v - Error: want ok %v, got err %v", i, test.ok, err)
+		}
+	}
+	if !IsValidIdentityProvider("acme") {
+		t.Errorf("Error: acme should be a valid provider")
+	}
+}
@@ -0,0 +1,694 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package models
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"appengine"
+
+	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/repository"
+)
+
+// Search index storage parameters.
+//
+// The ids of the entities using a word are split in SearchPostingShards shards by id,
+// so indexing an entity rewrites a small shard and concurrent updates of different
+// entities rarely write the same shard. The word counter of a kind is split in
+// SearchCounterShards shards, a random shard being updated on each change.
+//
+const (
+	SearchPostingShards = 16
+	SearchCounterShards = 16
+)
+
+const (
+	searchBatchSize    = 500 // max number of entities in a datastore multi call.
+	searchTxMaxEntries = 20  // max number of shards updated in a cross group transaction.
+)
+
+// SearchField holds an entity field indexed by the search engine and its weight in the score of a document.
+//
+type SearchField struct {
+	Name   string
+	Weight float64
+}
+
+// SearchKind describes an entity kind registered with the search engine.
+//
+// Entity is the datastore kind of the indexed entities, Postings and Counter are the datastore kinds of
+// the posting shards and of the word counter shards of the kind.
+// Documents returns, for each given id, the values of the indexed fields in the order of Fields.
+//
+type SearchKind struct {
+	Name      string
+	Entity    string
+	Postings  string
+	Counter   string
+	Fields    []SearchField
+	Documents func(c appengine.Context, ids []int64) map[int64][]string
+}
+
+var (
+	searchKinds     = make(map[string]*SearchKind)
+	searchKindNames []string
+)
+
+// RegisterSearchKind registers an entity kind with the search engine.
+// It panics if the kind is registered twice.
+//
+func RegisterSearchKind(k SearchKind) {
+	if _, ok := searchKinds[k.Name]; ok {
+		panic("models: search kind registered twice: " + k.Name)
+	}
+	searchKinds[k.Name] = &k
+	searchKindNames = append(searchKindNames, k.Name)
+}
+
+// SearchKinds returns the names of the kinds registered with the search engine, in registration order.
+//
+func SearchKinds() []string {
+	return searchKindNames
+}
+
+// IsValidSearchKind tells whether a kind is registered with the search engine.
+//
+func IsValidSearchKind(kind string) bool {
+	_, ok := searchKinds[kind]
+	return ok
+}
+
+func searchKind(kind string) (*SearchKind, error) {
+	if k, ok := searchKinds[kind]; ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("invid: search kind %s is not registered", kind)
+}
+
+// InvertedIndex holds a shard of the sorted ids of the entities of a kind that use a word.
+//
+type InvertedIndex struct {
+	Word  string
+	Shard int64
+	Ids   []int64 `datastore:",noindex"`
+}
+
+// WordCount holds a shard of the number of words indexed for a kind.
+//
+type WordCount struct {
+	Count int64
+}
+
+// postingShard returns the shard of the postings holding an id.
+//
+func postingShard(id int64) int64 {
+	if id < 0 {
+		id = -id
+	}
+	return id % SearchPostingShards
+}
+
+// postingKeyName returns the key name of a shard of the postings of a word.
+//
+func postingKeyName(word string, shard int64) string {
+	return fmt.Sprintf("%s %d", word, shard)
+}
+
+func postingKey(c appengine.Context, k *SearchKind, word string, shard int64) *repository.Key {
+	return repository.NewKey(k.Postings, postingKeyName(word, shard), 0)
+}
+
+// insertID inserts an id in a sorted array of ids, it returns false if the id was already there.
+//
+func insertID(ids []int64, id int64) ([]int64, bool) {
+	i := sort.Search(len(ids), func(i int) bool { return ids[i] >= id })
+	if i < len(ids) && ids[i] == id {
+		return ids, false
+	}
+	ids = append(ids, 0)
+	copy(ids[i+1:], ids[i:])
+	ids[i] = id
+	return ids, true
+}
+
+// removeID removes an id from a sorted array of ids, it returns false if the id was not there.
+//
+func removeID(ids []int64, id int64) ([]int64, bool) {
+	i := sort.Search(len(ids), func(i int) bool { return ids[i] >= id })
+	if i == len(ids) || ids[i] != id {
+		return ids, false
+	}
+	return append(ids[:i], ids[i+1:]...), true
+}
+
+// mergeIds merges sorted arrays of distinct ids in a sorted array.
+//
+func mergeIds(lists ...[]int64) []int64 {
+	var ids []int64
+	for _, l := range lists {
+		ids = append(ids, l...)
+	}
+	sort.Sort(int64Slice(ids))
+	return ids
+}
+
+// AddToInvertedIndex adds the words of a text to the inverted index of a kind.
+//
+func AddToInvertedIndex(c appengine.Context, kind string, text string, id int64) error {
+	return UpdateInvertedIndex(c, kind, nil, []string{text}, id)
+}
+
+// UpdateInvertedIndex updates the inverted index of a kind for the entity with the given id.
+// From the old and the new values of the indexed fields we handle the removal of the words
+// that are no longer present and the addition of the new words.
+//
+func UpdateInvertedIndex(c appengine.Context, kind string, oldValues []string, newValues []string, id int64) error {
+
+	k, err := searchKind(kind)
+	if err != nil {
+		return err
+	}
+
+	oldW := wordSet(searchTokens(joinValues(oldValues)))
+	newW := wordSet(searchTokens(joinValues(newValues)))
+
+	var removed, added []string
+	for w := range oldW {
+		if !newW[w] {
+			removed = append(removed, w)
+		}
+	}
+	for w := range newW {
+		if !oldW[w] {
+			added = append(added, w)
+		}
+	}
+
+	return updatePostings(c, k, id, added, removed)
+}
+
+func joinValues(values []string) string {
+	s := ""
+	for _, v := range values {
+		s = s + " " + v
+	}
+	return s
+}
+
+func wordSet(words []string) map[string]bool {
+	set := make(map[string]bool)
+	for _, w := range words {
+		set[w] = true
+	}
+	return set
+}
+
+// updatePostings adds an id to the postings of the added words and removes it from the postings
+// of the removed words. The shards holding the id are updated by batches in cross group transactions,
+// then the word counter is updated for the words that appeared or disappeared from the index.
+//
+func updatePostings(c appengine.Context, k *SearchKind, id int64, added []string, removed []string) error {
+
+	shard := postingShard(id)
+	words := append(append([]string{}, added...), removed...)
+	isAdded := wordSet(added)
+
+	var created, emptied []string
+	for start := 0; start < len(words); start += searchTxMaxEntries {
+		end := start + searchTxMaxEntries
+		if end > len(words) {
+			end = len(words)
+		}
+		batch := words[start:end]
+
+		var batchCreated, batchEmptied []string
+		err := repository.RunInTransaction(c, func(c appengine.Context) error {
+			batchCreated, batchEmptied = nil, nil
+
+			keys := make([]*repository.Key, len(batch))
+			for i, w := range batch {
+				keys[i] = postingKey(c, k, w, shard)
+			}
+			shards := make([]InvertedIndex, len(batch))
+			if err := getMulti(c, keys, shards); err != nil {
+				return err
+			}
+
+			var putKeys, deleteKeys []*repository.Key
+			var putShards []InvertedIndex
+			for i, w := range batch {
+				x := shards[i]
+				x.Word, x.Shard = w, shard
+				var changed bool
+				if isAdded[w] {
+					if x.Ids, changed = insertID(x.Ids, id); changed && len(x.Ids) == 1 {
+						batchCreated = append(batchCreated, w)
+					}
+				} else if x.Ids, changed = removeID(x.Ids, id); changed && len(x.Ids) == 0 {
+					batchEmptied = append(batchEmptied, w)
+					deleteKeys = append(deleteKeys, keys[i])
+					continue
+				}
+				if changed {
+					putKeys = append(putKeys, keys[i])
+					putShards = append(putShards, x)
+				}
+			}
+
+			if len(putKeys) > 0 {
+				if _, err := repository.PutMulti(c, putKeys, putShards); err != nil {
+					return err
+				}
+			}
+			if len(deleteKeys) > 0 {
+				return repository.DeleteMulti(c, deleteKeys)
+			}
+			return nil
+		}, &repository.TransactionOptions{XG: true})
+		if err != nil {
+			return fmt.Errorf(" invid.updatePostings, unable to update %s postings of %d: %v", k.Name, id, err)
+		}
+		created = append(created, batchCreated...)
+		emptied = append(emptied, batchEmptied...)
+	}
+
+	// a word is new to the index if its other shards are empty, and gone if all its shards are empty.
+	changes := append(append([]string{}, created...), emptied...)
+	if len(changes) == 0 {
+		return nil
+	}
+	postings, err := wordPostings(c, k, changes)
+	if err != nil {
+		return err
+	}
+	var delta int64
+	for _, w := range created {
+		if len(postings[w]) == 1 {
+			delta++
+		}
+	}
+	for _, w := range emptied {
+		if len(postings[w]) == 0 {
+			delta--
+		}
+	}
+	if delta != 0 {
+		if err = updateWordCount(c, k, delta); err != nil {
+			log.Errorf(c, " Error updating %s: %v", k.Counter, err)
+		}
+	}
+	return nil
+}
+
+// getMulti gets the entities of the given keys, leaving the missing ones to their zero value.
+//
+func getMulti(c appengine.Context, keys []*repository.Key, dst interface{}) error {
+	if err := repository.GetMulti(c, keys, dst); err != nil {
+		if me, ok := err.(appengine.MultiError); ok {
+			for _, merr := range me {
+				if merr != nil && merr != repository.ErrNoSuchEntity {
+					return merr
+				}
+			}
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// wordPostings returns, for each given word, the sorted ids of the entities of a kind that use it.
+// Words not in the index are not in the returned map.
+//
+func wordPostings(c appengine.Context, k *SearchKind, words []string) (map[string][]int64, error) {
+
+	var keys []*repository.Key
+	for _, w := range words {
+		for shard := int64(0); shard < SearchPostingShards; shard++ {
+			keys = append(keys, postingKey(c, k, w, shard))
+		}
+	}
+
+	postings := make(map[string][]int64)
+	for start := 0; start < len(keys); start += searchBatchSize {
+		end := start + searchBatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		shards := make([]InvertedIndex, end-start)
+		if err := getMulti(c, keys[start:end], shards); err != nil {
+			return nil, err
+		}
+		for _, x := range shards {
+			if len(x.Ids) > 0 {
+				postings[x.Word] = append(postings[x.Word], x.Ids...)
+			}
+		}
+	}
+
+	for w, ids := range postings {
+		postings[w] = mergeIds(ids)
+	}
+	return postings, nil
+}
+
+// wordsByPrefix returns at most limit words of the index of a kind starting with prefix, in alphabetical order.
+// It only reads the keys of the posting shards.
+//
+func wordsByPrefix(c appengine.Context, k *SearchKind, prefix string, limit int) ([]string, error) {
+	q := repository.NewQuery(k.Postings).Filter("Word >=", prefix).Filter("Word <", prefix+"\uffff").Order("Word").KeysOnly().Limit(limit * SearchPostingShards)
+
+	keys, err := q.GetAll(c, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var words []string
+	for _, key := range keys {
+		name := key.StringID()
+		w := name[:strings.LastIndex(name, " ")]
+		if len(words) > 0 && words[len(words)-1] == w {
+			continue
+		}
+		if len(words) == limit {
+			break
+		}
+		words = append(words, w)
+	}
+	return words, nil
+}
+
+// InvertedIndexes returns, given an array of words, the ids of the entities of a kind that use all these words.
+//
+func InvertedIndexes(c appengine.Context, kind string, words []string) ([]int64, error) {
+
+	k, err := searchKind(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	var searchWords []string
+	for _, w := range words {
+		searchWords = append(searchWords, searchWord(w))
+	}
+
+	postings, err := wordPostings(c, k, searchWords)
+	if err != nil {
+		log.Errorf(c, "invid.InvertedIndexes, unable to get %s postings of %v: %v", kind, words, err)
+		return nil, err
+	}
+
+	var ids []int64
+	for i, w := range searchWords {
+		if i == 0 {
+			ids = postings[w]
+			continue
+		}
+		var intersect []int64
+		for _, id := range ids {
+			if j := sort.Search(len(postings[w]), func(j int) bool { return postings[w][j] >= id }); j < len(postings[w]) && postings[w][j] == id {
+				intersect = append(intersect, id)
+			}
+		}
+		ids = intersect
+	}
+	return ids, nil
+}
+
+// updates a random shard of the word counter of a kind by delta in a transaction.
+func updateWordCount(c appengine.Context, k *SearchKind, delta int64) error {
+	return repository.RunInTransaction(c, func(c appengine.Context) error {
+		key := repository.NewKey(k.Counter, fmt.Sprintf("shard%d", rand.Intn(SearchCounterShards)), 0)
+		var x WordCount
+		if err := repository.Get(c, key, &x); err != nil && err != repository.ErrNoSuchEntity {
+			return err
+		}
+		x.Count += delta
+		_, err := repository.Put(c, key, &x)
+		return err
+	}, nil)
+}
+
+func wordCountKeys(c appengine.Context, k *SearchKind) []*repository.Key {
+	keys := make([]*repository.Key, SearchCounterShards)
+	for i := range keys {
+		keys[i] = repository.NewKey(k.Counter, fmt.Sprintf("shard%d", i), 0)
+	}
+	return keys
+}
+
+// InvertedIndexWordCount returns the current number of words indexed for a kind.
+//
+func InvertedIndexWordCount(c appengine.Context, kind string) (int64, error) {
+	k, err := searchKind(kind)
+	if err != nil {
+		return 0, err
+	}
+
+	shards := make([]WordCount, SearchCounterShards)
+	if err = getMulti(c, wordCountKeys(c, k), shards); err != nil {
+		return 0, err
+	}
+
+	var count int64
+	for _, x := range shards {
+		count += x.Count
+	}
+	return count, nil
+}
+
+// DocumentFrequency gets the number of entities of a kind that use a word.
+//
+func DocumentFrequency(c appengine.Context, kind string, word string) (int64, error) {
+
+	k, err := searchKind(kind)
+	if err != nil {
+		return 0, err
+	}
+
+	w := searchWord(word)
+	postings, err := wordPostings(c, k, []string{w})
+	if err != nil {
+		return 0, fmt.Errorf(" invid.DocumentFrequency, unable to get %s postings of %s: %v", kind, word, err)
+	}
+	return int64(len(postings[w])), nil
+}
+
+// WordFrequency gets the weighted frequency of a word in the indexed fields of an entity.
+//
+func WordFrequency(c appengine.Context, kind string, id int64, word string) float64 {
+
+	k, err := searchKind(kind)
+	if err != nil {
+		log.Errorf(c, "invid.WordFrequency: %v", err)
+		return 0
+	}
+
+	if values, ok := k.Documents(c, []int64{id})[id]; ok {
+		return termFrequency(k, documentTokens(values), searchWord(word))
+	}
+	return 0
+}
+
+// buildPostings adds the ids of the given documents to the posting shards of their words,
+// shards being indexed by key name. Ids are appended, so documents must be given by ascending ids
+// to keep the shards sorted.
+//
+func buildPostings(postings map[string]*InvertedIndex, ids []int64, documents map[int64][]string) {
+	for _, id := range ids {
+		values, ok := documents[id]
+		if !ok {
+			continue
+		}
+		shard := postingShard(id)
+		for w := range wordSet(searchTokens(joinValues(values))) {
+			name := postingKeyName(w, shard)
+			x, ok := postings[name]
+			if !ok {
+				x = &InvertedIndex{Word: w, Shard: shard}
+				postings[name] = x
+			}
+			x.Ids = append(x.Ids, id)
+		}
+	}
+}
+
+// RebuildInvertedIndex rebuilds the inverted index of a kind from its entities.
+//
+// It rebuilds the index by batches of entities in a single run, see RebuildInvertedIndexByCursor.
+//
+func RebuildInvertedIndex(c appengine.Context, kind string) (int64, error) {
+	var nbEntities int64
+	cursor := ""
+	for {
+		n, next, err := RebuildInvertedIndexByCursor(c, kind, searchBatchSize, cursor)
+		nbEntities += n
+		if err != nil {
+			return nbEntities, err
+		}
+		if len(next) == 0 {
+			return nbEntities, nil
+		}
+		cursor = next
+	}
+}
+
+// RebuildInvertedIndexByCursor rebuilds the inverted index of a kind from a batch of count entities
+// starting at cursor.
+//
+// An empty cursor starts the rebuild: the posting and the word counter shards of the kind are deleted.
+// The postings of the batch are then merged in the stored shards and the words new to the index are
+// added to the word counter. Merging a batch twice does not duplicate the ids of the postings.
+// It returns the number of entities of the batch and the cursor of the next batch, empty when all
+// the entities of the kind were indexed.
+// Updates of entities during the rebuild may be lost.
+//
+func RebuildInvertedIndexByCursor(c appengine.Context, kind string, count int, cursor string) (int64, string, error) {
+
+	k, err := searchKind(kind)
+	if err != nil {
+		return 0, "", err
+	}
+
+	if len(cursor) == 0 {
+		if err = deleteAll(c, k.Postings); err != nil {
+			return 0, "", err
+		}
+		if err = deleteAll(c, k.Counter); err != nil {
+			return 0, "", err
+		}
+	}
+
+	var ids []int64
+	next := ""
+	it := repository.NewQuery(k.Entity).Order("__key__").KeysOnly().Start(repository.Cursor(cursor)).Run(c)
+	for {
+		if len(ids) == count {
+			nc, err := it.Cursor()
+			if err != nil {
+				return 0, "", err
+			}
+			next = string(nc)
+			break
+		}
+		key, err := it.Next(nil)
+		if err == repository.Done {
+			break
+		} else if err != nil {
+			return 0, "", err
+		}
+		ids = append(ids, key.IntID())
+	}
+
+	postings := make(map[string]*InvertedIndex)
+	buildPostings(postings, ids, k.Documents(c, ids))
+	newWords, err := mergePostings(c, k, postings)
+	if err != nil {
+		return 0, "", err
+	}
+	if newWords > 0 {
+		if err = updateWordCount(c, k, newWords); err != nil {
+			return 0, "", err
+		}
+	}
+
+	log.Infof(c, "invid.RebuildInvertedIndexByCursor, %d %s entities indexed with %d new words", len(ids), kind, newWords)
+	return int64(len(ids)), next, nil
+}
+
+// mergePostings merges the given posting shards, indexed by key name, in the stored ones and
+// returns the number of words which were not in the index.
+func mergePostings(c appengine.Context, k *SearchKind, postings map[string]*InvertedIndex) (int64, error) {
+
+	var keys []*repository.Key
+	var shards []*InvertedIndex
+	for name, x := range postings {
+		keys = append(keys, repository.NewKey(k.Postings, name, 0))
+		shards = append(shards, x)
+	}
+
+	// words of the batch with a stored shard are already counted, the others are checked on all their shards.
+	words := make(map[string]bool)
+	for start := 0; start < len(keys); start += searchBatchSize {
+		end := start + searchBatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		stored := make([]InvertedIndex, end-start)
+		if err := getMulti(c, keys[start:end], stored); err != nil {
+			return 0, err
+		}
+		for i, x := range stored {
+			shard := shards[start+i]
+			if _, ok := words[shard.Word]; !ok {
+				words[shard.Word] = false
+			}
+			if len(x.Ids) == 0 {
+				continue
+			}
+			words[shard.Word] = true
+			ids := x.Ids
+			for _, id := range shard.Ids {
+				ids, _ = insertID(ids, id)
+			}
+			shard.Ids = ids
+		}
+	}
+
+	var candidates []string
+	for w, indexed := range words {
+		if !indexed {
+			candidates = append(candidates, w)
+		}
+	}
+	existing, err := wordPostings(c, k, candidates)
+	if err != nil {
+		return 0, err
+	}
+
+	for start := 0; start < len(keys); start += searchBatchSize {
+		end := start + searchBatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		if _, err = repository.PutMulti(c, keys[start:end], shards[start:end]); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(candidates) - len(existing)), nil
+}
+
+// deleteAll deletes all the entities of a datastore kind by batches.
+//
+func deleteAll(c appengine.Context, entity string) error {
+	for {
+		keys, err := repository.NewQuery(entity).KeysOnly().Limit(searchBatchSize).GetAll(c, nil)
+		if err != nil {
+			return err
+		}
+		if len(keys) == 0 {
+			return nil
+		}
+		if err = repository.DeleteMulti(c, keys); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,293 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"appengine"
+	"appengine/aetest"
+
+	"github.com/taironas/gonawin/helpers"
+	"github.com/taironas/gonawin/helpers/memcache"
+	"github.com/taironas/gonawin/repository"
+)
+
+// TestInsertRemoveID tests that ids are inserted and removed from sorted posting shards.
+//
+func TestInsertRemoveID(t *testing.T) {
+	tests := []struct {
+		title   string
+		ids     []int64
+		insert  bool
+		id      int64
+		want    []int64
+		changed bool
+	}{
+		{"can insert in empty shard", nil, true, 5, []int64{5}, true},
+		{"can insert in the middle", []int64{1, 9}, true, 5, []int64{1, 5, 9}, true},
+		{"cannot insert twice", []int64{1, 5, 9}, true, 5, []int64{1, 5, 9}, false},
+		{"can remove", []int64{1, 5, 9}, false, 5, []int64{1, 9}, true},
+		{"cannot remove missing id", []int64{1, 9}, false, 5, []int64{1, 9}, false},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+		var got []int64
+		var changed bool
+		if test.insert {
+			got, changed = insertID(test.ids, test.id)
+		} else {
+			got, changed = removeID(test.ids, test.id)
+		}
+		if changed != test.changed || fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("test %v - Error: want %v %v, got %v %v", i, test.want, test.changed, got, changed)
+		}
+	}
+}
+
+// TestRebuildInvertedIndex tests that the inverted index of a kind can be rebuilt from its entities.
+//
+func TestRebuildInvertedIndex(t *testing.T) {
+	var c aetest.Context
+	var err error
+	options := aetest.Options{StronglyConsistentDatastore: true}
+
+	if c, err = aetest.NewContext(&options); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	testTeams := createTestTeams(3)
+	teamIDs := createTeamsFromTestTeams(t, c, testTeams)
+
+	k, _ := searchKind(TeamSearchKind)
+	if err = deleteAll(c, k.Postings); err != nil {
+		t.Fatal(err)
+	}
+
+	var n int64
+	if n, err = RebuildInvertedIndex(c, TeamSearchKind); err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(teamIDs)) {
+		t.Errorf("want %v teams indexed, got %v", len(teamIDs), n)
+	}
+
+	tests := []struct {
+		title string
+		words []string
+		want  int
+	}{
+		{"common word is indexed", []string{"team"}, 3},
+		{"distinct word is indexed", []string{"team", "1"}, 1},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+		var ids []int64
+		if ids, err = InvertedIndexes(c, TeamSearchKind, test.words); err != nil {
+			t.Errorf("test %v - Error: %v", i, err)
+		}
+		if len(ids) != test.want {
+			t.Errorf("test %v - Error: want %v ids, got %v", i, test.want, ids)
+		}
+	}
+
+	// words: team, 0, 1, 2
+	if count, _ := InvertedIndexWordCount(c, TeamSearchKind); count != 4 {
+		t.Errorf("want word count 4, got %v", count)
+	}
+}
+
+// TestRebuildInvertedIndexByCursor tests that the inverted index of a kind can be rebuilt by batches
+// of entities, and that a batch rebuilt twice does not change the index.
+//
+func TestRebuildInvertedIndexByCursor(t *testing.T) {
+	repository.Use(repository.NewMemory())
+	defer repository.Use(repository.Datastore)
+	memcache.Use(memcache.NewMemory())
+
+	c := repository.NewLocalContext(nil)
+
+	putBenchmarkTeams(t, c, 5)
+	k, _ := searchKind(TeamSearchKind)
+	if err := updatePostings(c, k, 42, []string{"stale"}, nil); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	var cursors []string
+	cursor := ""
+	var total int64
+	for {
+		cursors = append(cursors, cursor)
+		n, next, err := RebuildInvertedIndexByCursor(c, TeamSearchKind, 2, cursor)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		total += n
+		if len(next) == 0 {
+			break
+		}
+		cursor = next
+	}
+	if total != 5 || len(cursors) != 3 {
+		t.Errorf("want 5 teams indexed in 3 batches, got %v teams in %v batches", total, len(cursors))
+	}
+	// the second batch is run again, as by a retried task.
+	if _, _, err := RebuildInvertedIndexByCursor(c, TeamSearchKind, 2, cursors[1]); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	tests := []struct {
+		title string
+		words []string
+		want  int
+	}{
+		{"common word is indexed once per team", []string{"team"}, 5},
+		{"distinct word is indexed", []string{"team", "3"}, 1},
+		{"shared word is indexed", []string{"gunners0"}, 2},
+		{"stale word is removed", []string{"stale"}, 0},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+		ids, err := InvertedIndexes(c, TeamSearchKind, test.words)
+		if err != nil {
+			t.Errorf("test %v - Error: %v", i, err)
+		}
+		if len(ids) != test.want {
+			t.Errorf("test %v - Error: want %v ids, got %v", i, test.want, ids)
+		}
+	}
+
+	// words: team, 0 to 4, gunners0 to gunners3
+	if count, _ := InvertedIndexWordCount(c, TeamSearchKind); count != 10 {
+		t.Errorf("want word count 10, got %v", count)
+	}
+}
+
+const benchmarkEntities = 100000
+
+// putBenchmarkTeams puts n teams named "team <i> gunners<i%4>" with ids 1 to n,
+// without indexing them.
+func putBenchmarkTeams(tb testing.TB, c appengine.Context, n int) {
+	for start := 0; start < n; start += searchBatchSize {
+		var keys []*repository.Key
+		var teams []*Team
+		for i := start; i < n && i < start+searchBatchSize; i++ {
+			id := int64(i + 1)
+			keys = append(keys, repository.NewKey("Team", "", id))
+			teams = append(teams, &Team{Id: id, Name: fmt.Sprintf("team %d gunners%d", i, i%4)})
+		}
+		if _, err := repository.PutMulti(c, keys, teams); err != nil {
+			tb.Fatal(err)
+		}
+	}
+}
+
+// newBenchmarkIndex returns a context on a memory repository with 100k teams, indexed if index is true.
+func newBenchmarkIndex(b *testing.B, index bool) appengine.Context {
+	repository.Use(repository.NewMemory())
+	memcache.Use(memcache.NewMemory())
+
+	c := repository.NewLocalContext(nil)
+	putBenchmarkTeams(b, c, benchmarkEntities)
+	if index {
+		if _, err := RebuildInvertedIndex(c, TeamSearchKind); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return c
+}
+
+// BenchmarkUpdatePostings indexes a new entity in an index of 100k entities of the memory repository.
+//
+func BenchmarkUpdatePostings(b *testing.B) {
+	c := newBenchmarkIndex(b, true)
+	defer repository.Use(repository.Datastore)
+	k, _ := searchKind(TeamSearchKind)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		words := []string{"team", strconv.Itoa(benchmarkEntities + i), "gunners0"}
+		if err := updatePostings(c, k, int64(benchmarkEntities+i+1), words, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkSearch searches a word used by a quarter of 100k indexed entities of the memory repository.
+//
+func BenchmarkSearch(b *testing.B) {
+	c := newBenchmarkIndex(b, true)
+	defer repository.Use(repository.Datastore)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Search(c, "gunners1", TeamSearchKind); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkRebuildInvertedIndex rebuilds the index of 100k entities of the memory repository.
+//
+func BenchmarkRebuildInvertedIndex(b *testing.B) {
+	c := newBenchmarkIndex(b, false)
+	defer repository.Use(repository.Datastore)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := RebuildInvertedIndex(c, TeamSearchKind); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkMergeIds adds an id to a space separated blob of 100k ids, as the previous index storage did.
+//
+func BenchmarkMergeIds(b *testing.B) {
+	strIds := make([]string, benchmarkEntities)
+	for i := range strIds {
+		strIds[i] = strconv.Itoa(i)
+	}
+	blob := []byte(strings.Join(strIds, " "))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		helpers.MergeIds(blob, benchmarkEntities)
+	}
+}
+
+// BenchmarkInsertID adds an id to a posting shard of a word used by 100k entities.
+//
+func BenchmarkInsertID(b *testing.B) {
+	shard := make([]int64, 0, benchmarkEntities/SearchPostingShards+1)
+	for id := int64(0); id < benchmarkEntities; id += SearchPostingShards {
+		shard = append(shard, id)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// the full slice forces insertID to copy the shard, as when it is read from the datastore.
+		insertID(shard[:len(shard):len(shard)], benchmarkEntities/2+1)
+	}
+}
+
+// BenchmarkBuildPostings builds the postings of 100k entities, as a rebuild of the index does.
+//
+func BenchmarkBuildPostings(b *testing.B) {
+	ids := make([]int64, benchmarkEntities)
+	documents := make(map[int64][]string)
+	for i := range ids {
+		ids[i] = int64(i + 1)
+		documents[ids[i]] = []string{fmt.Sprintf("team %d gunners%d", i, i%100)}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buildPostings(make(map[string]*InvertedIndex), ids, documents)
+	}
+}
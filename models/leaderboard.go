@@ -0,0 +1,302 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"appengine"
+
+	"github.com/taironas/gonawin/helpers"
+	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/repository"
+)
+
+// LeaderboardEntry entity is the precomputed score of a user in a leaderboard.
+//
+// A leaderboard ranks the participants of a tournament, or the members of a team
+// in a tournament. Its entries are updated by the score tasks so that rankings
+// do not need to load and sort all the users.
+//
+type LeaderboardEntry struct {
+	Leaderboard  string
+	TournamentId int64
+	TeamId       int64
+	UserId       int64
+	Score        int64
+	Updated      time.Time
+}
+
+// LeaderboardPosition holds the rank of a user in a leaderboard.
+// Users with the same score share the same rank.
+//
+type LeaderboardPosition struct {
+	Rank   int64
+	UserId int64
+	Score  int64
+}
+
+// Leaderboard identifies the leaderboard of a tournament, or of a team in a tournament.
+//
+type Leaderboard struct {
+	TournamentId int64
+	TeamId       int64
+}
+
+// TournamentLeaderboard returns the leaderboard of the participants of a tournament.
+//
+func TournamentLeaderboard(tournamentID int64) *Leaderboard {
+	return &Leaderboard{TournamentId: tournamentID}
+}
+
+// TeamLeaderboard returns the leaderboard of the members of a team in a tournament.
+//
+func TeamLeaderboard(teamID, tournamentID int64) *Leaderboard {
+	return &Leaderboard{TournamentId: tournamentID, TeamId: teamID}
+}
+
+// Name returns the name identifying the leaderboard.
+//
+func (l *Leaderboard) Name() string {
+	if l.TeamId != 0 {
+		return fmt.Sprintf("team/%d/tournament/%d", l.TeamId, l.TournamentId)
+	}
+	return fmt.Sprintf("tournament/%d", l.TournamentId)
+}
+
+// entryKey returns the key of the entry of a user in the leaderboard.
+func (l *Leaderboard) entryKey(userID int64) *repository.Key {
+	return repository.NewKey("LeaderboardEntry", fmt.Sprintf("%s/%d", l.Name(), userID), 0)
+}
+
+// query returns a query on the entries of the leaderboard, sorted by rank.
+func (l *Leaderboard) query() *repository.Query {
+	return repository.NewQuery("LeaderboardEntry").
+		Filter("Leaderboard =", l.Name()).
+		Order("-Score").
+		Order("UserId")
+}
+
+// SetScores sets the scores of users in the leaderboard.
+//
+func (l *Leaderboard) SetScores(c appengine.Context, userIDs []int64, scores []int64) error {
+	if len(userIDs) != len(scores) {
+		return fmt.Errorf("model/leaderboard: got %d scores for %d users", len(scores), len(userIDs))
+	}
+	if len(userIDs) == 0 {
+		return nil
+	}
+	now := time.Now()
+	keys := make([]*repository.Key, len(userIDs))
+	entries := make([]*LeaderboardEntry, len(userIDs))
+	for i, id := range userIDs {
+		keys[i] = l.entryKey(id)
+		entries[i] = &LeaderboardEntry{l.Name(), l.TournamentId, l.TeamId, id, scores[i], now}
+	}
+	if _, err := repository.PutMulti(c, keys, entries); err != nil {
+		log.Errorf(c, "model/leaderboard, SetScores: error occurred during PutMulti call: %v", err)
+		return err
+	}
+	return nil
+}
+
+// Remove removes users from the leaderboard.
+//
+func (l *Leaderboard) Remove(c appengine.Context, userIDs ...int64) error {
+	keys := make([]*repository.Key, len(userIDs))
+	for i, id := range userIDs {
+		keys[i] = l.entryKey(id)
+	}
+	return repository.DeleteMulti(c, keys)
+}
+
+// Clear removes all the users from the leaderboard.
+//
+func (l *Leaderboard) Clear(c appengine.Context) error {
+	keys, err := repository.NewQuery("LeaderboardEntry").Filter("Leaderboard =", l.Name()).KeysOnly().GetAll(c, nil)
+	if err != nil {
+		return err
+	}
+	return repository.DeleteMulti(c, keys)
+}
+
+// Count returns the number of users in the leaderboard.
+//
+func (l *Leaderboard) Count(c appengine.Context) (int, error) {
+	return repository.NewQuery("LeaderboardEntry").Filter("Leaderboard =", l.Name()).KeysOnly().Count(c)
+}
+
+// Top returns a page of the positions of the leaderboard, starting with the best scores.
+//
+func (l *Leaderboard) Top(c appengine.Context, page, count int) ([]LeaderboardPosition, error) {
+	if page < 1 || count < 1 {
+		return nil, nil
+	}
+	return l.positions(c, (page-1)*count, count)
+}
+
+// Position returns the position of a user in the leaderboard.
+//
+func (l *Leaderboard) Position(c appengine.Context, userID int64) (*LeaderboardPosition, error) {
+	var entry LeaderboardEntry
+	if err := repository.Get(c, l.entryKey(userID), &entry); err != nil {
+		return nil, err
+	}
+	rank, err := l.rank(c, entry.Score)
+	if err != nil {
+		return nil, err
+	}
+	return &LeaderboardPosition{rank, entry.UserId, entry.Score}, nil
+}
+
+// Neighbours returns the positions of the n users ranked before a user,
+// the position of the user and the positions of the n users ranked after.
+//
+func (l *Leaderboard) Neighbours(c appengine.Context, userID int64, n int) ([]LeaderboardPosition, error) {
+	var entry LeaderboardEntry
+	if err := repository.Get(c, l.entryKey(userID), &entry); err != nil {
+		return nil, err
+	}
+	// index of the user in the leaderboard: users with a better score,
+	// then users with the same score and a lower id.
+	better, err := l.countScores(c, "Score >", entry.Score)
+	if err != nil {
+		return nil, err
+	}
+	var tied int
+	if tied, err = repository.NewQuery("LeaderboardEntry").
+		Filter("Leaderboard =", l.Name()).
+		Filter("Score =", entry.Score).
+		Filter("UserId <", userID).
+		KeysOnly().
+		Count(c); err != nil {
+		return nil, err
+	}
+	index := better + tied
+
+	offset := index - n
+	if offset < 0 {
+		offset = 0
+	}
+	return l.positions(c, offset, index-offset+n+1)
+}
+
+// positions returns count positions of the leaderboard starting at offset.
+func (l *Leaderboard) positions(c appengine.Context, offset, count int) ([]LeaderboardPosition, error) {
+	var entries []*LeaderboardEntry
+	if _, err := l.query().Offset(offset).Limit(count).GetAll(c, &entries); err != nil {
+		log.Errorf(c, "model/leaderboard, positions: error occurred during GetAll call: %v", err)
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return []LeaderboardPosition{}, nil
+	}
+
+	// the first entry may share its rank with entries of previous pages.
+	rank, err := l.rank(c, entries[0].Score)
+	if err != nil {
+		return nil, err
+	}
+	positions := make([]LeaderboardPosition, len(entries))
+	for i, e := range entries {
+		if i > 0 && e.Score != entries[i-1].Score {
+			rank = int64(offset + i + 1)
+		}
+		positions[i] = LeaderboardPosition{rank, e.UserId, e.Score}
+	}
+	return positions, nil
+}
+
+// rank returns the rank of a score in the leaderboard.
+func (l *Leaderboard) rank(c appengine.Context, score int64) (int64, error) {
+	better, err := l.countScores(c, "Score >", score)
+	if err != nil {
+		return 0, err
+	}
+	return int64(better + 1), nil
+}
+
+// countScores counts the entries of the leaderboard matching a filter on the score.
+func (l *Leaderboard) countScores(c appengine.Context, filter string, score int64) (int, error) {
+	return repository.NewQuery("LeaderboardEntry").
+		Filter("Leaderboard =", l.Name()).
+		Filter(filter, score).
+		KeysOnly().
+		Count(c)
+}
+
+// UpdateLeaderboards updates the leaderboards of a tournament with the score
+// entities of users. scores[i] is the score entity of users[i] in the tournament,
+// nil users or scores are skipped.
+//
+func UpdateLeaderboards(c appengine.Context, t *Tournament, users []*User, scores []*Score) error {
+	members := make(map[int64][]int64, len(t.TeamIds))
+	for _, teamID := range t.TeamIds {
+		if team, err := TeamByID(c, teamID); err == nil {
+			members[teamID] = team.UserIDs(c)
+		}
+	}
+
+	var userIDs, totals []int64
+	teamUserIDs := make(map[int64][]int64)
+	teamTotals := make(map[int64][]int64)
+	for i := range users {
+		if users[i] == nil || i >= len(scores) || scores[i] == nil {
+			continue
+		}
+		total := sumInt64(&scores[i].Scores)
+		userIDs = append(userIDs, users[i].Id)
+		totals = append(totals, total)
+		for _, teamID := range t.TeamIds {
+			if ok, _ := helpers.Contains(members[teamID], users[i].Id); ok {
+				teamUserIDs[teamID] = append(teamUserIDs[teamID], users[i].Id)
+				teamTotals[teamID] = append(teamTotals[teamID], total)
+			}
+		}
+	}
+
+	if err := TournamentLeaderboard(t.Id).SetScores(c, userIDs, totals); err != nil {
+		return err
+	}
+	for teamID, ids := range teamUserIDs {
+		if err := TeamLeaderboard(teamID, t.Id).SetScores(c, ids, teamTotals[teamID]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RebuildLeaderboards rebuilds the leaderboards of a tournament from the score entities
+// of its participants. It returns the number of users ranked.
+//
+func RebuildLeaderboards(c appengine.Context, t *Tournament) (int, error) {
+	users := t.Participants(c)
+	scores := make([]*Score, len(users))
+	for i, u := range users {
+		if s, err := u.TournamentScore(c, t); err == nil {
+			scores[i] = s
+		} else {
+			// participants without score entity are ranked with a zero score.
+			scores[i] = &Score{UserId: u.Id, TournamentId: t.Id}
+		}
+	}
+	if err := UpdateLeaderboards(c, t, users, scores); err != nil {
+		return 0, err
+	}
+	return len(users), nil
+}
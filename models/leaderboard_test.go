@@ -0,0 +1,114 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/taironas/gonawin/helpers/memcache"
+	"github.com/taironas/gonawin/repository"
+)
+
+type testPosition struct {
+	rank   int64
+	userID int64
+}
+
+// TestLeaderboard tests the pages, positions and neighbours of a leaderboard with ties.
+//
+func TestLeaderboard(t *testing.T) {
+	repository.Use(repository.NewMemory())
+	defer repository.Use(repository.Datastore)
+	memcache.Use(memcache.NewMemory())
+
+	c := repository.NewLocalContext(nil)
+
+	l := TeamLeaderboard(7, 3)
+	if err := l.SetScores(c, []int64{1, 2, 3, 4, 5, 6}, []int64{4, 10, 4, 4, 0, 12}); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	// other leaderboards are not mixed with this one.
+	if err := TournamentLeaderboard(3).SetScores(c, []int64{1, 2}, []int64{100, 50}); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	if n, err := l.Count(c); err != nil || n != 6 {
+		t.Errorf("Error: got %v users, want 6, %v", n, err)
+	}
+
+	tests := []struct {
+		title      string
+		page       int
+		count      int
+		user       int64
+		neighbours int
+		want       []testPosition
+	}{
+		{
+			title: "first page",
+			page:  1, count: 3,
+			want: []testPosition{{1, 6}, {2, 2}, {3, 1}},
+		},
+		{
+			title: "second page shares the rank of tied users",
+			page:  2, count: 3,
+			want: []testPosition{{3, 3}, {3, 4}, {6, 5}},
+		},
+		{
+			title: "page after the last user",
+			page:  3, count: 3,
+			want: []testPosition{},
+		},
+		{
+			title: "neighbours of a tied user",
+			user:  3, neighbours: 1,
+			want: []testPosition{{3, 1}, {3, 3}, {3, 4}},
+		},
+		{
+			title: "neighbours of the first user",
+			user:  6, neighbours: 2,
+			want: []testPosition{{1, 6}, {2, 2}, {3, 1}},
+		},
+		{
+			title: "neighbours of the last user",
+			user:  5, neighbours: 2,
+			want: []testPosition{{3, 3}, {3, 4}, {6, 5}},
+		},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+		var positions []LeaderboardPosition
+		var err error
+		if test.user != 0 {
+			positions, err = l.Neighbours(c, test.user, test.neighbours)
+		} else {
+			positions, err = l.Top(c, test.page, test.count)
+		}
+		if err != nil {
+			t.Errorf("test %v - Error: %v", i, err)
+			continue
+		}
+		if len(positions) != len(test.want) {
+			t.Errorf("test %v - Error: got %v positions, want %v", i, positions, test.want)
+			continue
+		}
+		for j, p := range positions {
+			if p.Rank != test.want[j].rank || p.UserId != test.want[j].userID {
+				t.Errorf("test %v - Error: got %v, want %v", i, positions, test.want)
+				break
+			}
+		}
+	}
+
+	if p, err := l.Position(c, 4); err != nil || p.Rank != 3 || p.Score != 4 {
+		t.Errorf("Error: got position %v, want rank 3 with score 4, %v", p, err)
+	}
+	if err := l.Remove(c, 2); err != nil {
+		t.Errorf("Error: %v", err)
+	}
+	if p, err := l.Position(c, 4); err != nil || p.Rank != 2 {
+		t.Errorf("Error: got position %v, want rank 2, %v", p, err)
+	}
+	if _, err := l.Position(c, 2); err != repository.ErrNoSuchEntity {
+		t.Errorf("Error: want %v, got %v", repository.ErrNoSuchEntity, err)
+	}
+}
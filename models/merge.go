@@ -0,0 +1,275 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package models
+
+import (
+	"errors"
+
+	"appengine"
+
+	"github.com/taironas/gonawin/helpers"
+	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/repository"
+)
+
+// MergeUsers merges the account of a user into the account of another user, like two
+// accounts created by the same person with different providers.
+//
+// The teams, tournaments, roles, predictions, scores, activities and identities of the
+// merged user are moved to the other user, as well as the bans of the teams and the blocks
+// of the users, then the merged user is deleted.
+// When both users predicted the same match the prediction of the remaining user is kept,
+// when both users have a score in the same tournament the best score is kept.
+//
+func MergeUsers(c appengine.Context, from, into *User) error {
+	if from.Id == into.Id {
+		return errors.New("model/merge: cannot merge a user into himself")
+	}
+	desc := "MergeUsers:"
+
+	if err := from.migrateRelations(c); err != nil {
+		return err
+	}
+	if err := into.migrateRelations(c); err != nil {
+		return err
+	}
+
+	// teams the user is a member of, has a role in or is banned from.
+	var teams []*Team
+	seen := make(map[int64]bool)
+	for _, team := range append(append(FindTeams(c, "AdminIds", from.Id), FindTeams(c, "BannedIds", from.Id)...), from.Teams(c)...) {
+		if !seen[team.Id] {
+			seen[team.Id] = true
+			teams = append(teams, team)
+		}
+	}
+	for _, team := range teams {
+		if err := mergeTeamMember(c, team, from.Id, into.Id); err != nil {
+			log.Errorf(c, "%s unable to merge user %d in team %d: %v", desc, from.Id, team.Id, err)
+			return err
+		}
+	}
+
+	// tournaments the user participates in or administrates.
+	tournaments := FindTournaments(c, "AdminIds", from.Id)
+	for _, tournament := range from.Tournaments(c) {
+		if ok, _ := tournament.ContainsAdminID(from.Id); !ok {
+			tournaments = append(tournaments, tournament)
+		}
+	}
+	for _, tournament := range tournaments {
+		if err := mergeTournamentParticipant(c, tournament, from.Id, into.Id); err != nil {
+			log.Errorf(c, "%s unable to merge user %d in tournament %d: %v", desc, from.Id, tournament.Id, err)
+			return err
+		}
+	}
+
+	if err := mergePredicts(c, from, into); err != nil {
+		log.Errorf(c, "%s unable to merge predicts of user %d: %v", desc, from.Id, err)
+		return err
+	}
+	if err := mergeScores(c, from, into); err != nil {
+		log.Errorf(c, "%s unable to merge scores of user %d: %v", desc, from.Id, err)
+		return err
+	}
+
+	// activities of the feed.
+	relations, err := activityRelations(c, into.Id, from.ActivityIDs(c))
+	if err != nil {
+		return err
+	}
+	if err = putMissingRelations(c, userActivityKind, relations); err != nil {
+		return err
+	}
+	if err = removeRelations(c, userActivityKind, "FromId", from.Id); err != nil {
+		return err
+	}
+
+	for _, i := range from.Identities(c) {
+		if into.identity(c, i.Provider) != nil {
+			// the remaining user keeps his own account of the provider.
+			if err = repository.Delete(c, identityKey(i.Provider, i.ExternalId)); err != nil {
+				return err
+			}
+			continue
+		}
+		i.UserId = into.Id
+		if _, err = repository.Put(c, identityKey(i.Provider, i.ExternalId), i); err != nil {
+			return err
+		}
+	}
+
+	into.IsAdmin = into.IsAdmin || from.IsAdmin
+	into.BlockedIds = helpers.Remove(into.BlockedIds, from.Id)
+	for _, id := range from.BlockedIds {
+		if ok, _ := helpers.Contains(into.BlockedIds, id); !ok && id != into.Id {
+			into.BlockedIds = append(into.BlockedIds, id)
+		}
+	}
+	if err = into.Update(c); err != nil {
+		return err
+	}
+
+	// users who blocked the merged user block the remaining user.
+	for _, u := range FindUsers(c, "BlockedIds", from.Id) {
+		if u.Id == into.Id {
+			continue
+		}
+		u.BlockedIds = replaceID(u.BlockedIds, from.Id, into.Id)
+		if err = u.Update(c); err != nil {
+			log.Errorf(c, "%s unable to move the blocks of user %d to user %d: %v", desc, from.Id, into.Id, err)
+			return err
+		}
+	}
+
+	// rank the remaining user with his merged scores.
+	for _, tournament := range tournaments {
+		if err = TournamentLeaderboard(tournament.Id).Remove(c, from.Id); err != nil {
+			log.Errorf(c, "%s unable to remove user %d from leaderboard of tournament %d: %v", desc, from.Id, tournament.Id, err)
+		}
+		for _, teamID := range tournament.TeamIds {
+			if err = TeamLeaderboard(teamID, tournament.Id).Remove(c, from.Id); err != nil {
+				log.Errorf(c, "%s unable to remove user %d from leaderboard of team %d: %v", desc, from.Id, teamID, err)
+			}
+		}
+		if _, err = RebuildLeaderboards(c, tournament); err != nil {
+			log.Errorf(c, "%s unable to rebuild leaderboards of tournament %d: %v", desc, tournament.Id, err)
+		}
+	}
+
+	log.Infof(c, "%s user %d merged into user %d", desc, from.Id, into.Id)
+	return from.Destroy(c)
+}
+
+// replaceID replaces an id by another one in a list of ids, without duplicating it.
+func replaceID(ids []int64, from, into int64) []int64 {
+	if ok, _ := helpers.Contains(ids, from); !ok {
+		return ids
+	}
+	ids = helpers.Remove(ids, from)
+	if ok, _ := helpers.Contains(ids, into); !ok {
+		ids = append(ids, into)
+	}
+	return ids
+}
+
+// mergeTeamMember replaces a user by another one in the members, roles and bans of a team.
+func mergeTeamMember(c appengine.Context, t *Team, from, into int64) error {
+	t.OwnerIds = replaceID(t.OwnerIds, from, into)
+	t.AdminIds = replaceID(t.AdminIds, from, into)
+	t.ModeratorIds = replaceID(t.ModeratorIds, from, into)
+	t.SpectatorIds = replaceID(t.SpectatorIds, from, into)
+	t.BannedIds = replaceID(t.BannedIds, from, into)
+
+	if t.ContainsUserID(c, from) {
+		if err := t.RemoveUserID(c, from); err != nil {
+			return err
+		}
+		if !t.ContainsUserID(c, into) {
+			return t.AddUserID(c, into)
+		}
+	}
+	return t.Update(c)
+}
+
+// mergeTournamentParticipant replaces a user by another one in the participants and admins of a tournament.
+func mergeTournamentParticipant(c appengine.Context, t *Tournament, from, into int64) error {
+	t.AdminIds = replaceID(t.AdminIds, from, into)
+
+	if t.ContainsUserID(c, from) {
+		if err := t.RemoveUserID(c, from); err != nil {
+			return err
+		}
+		if !t.ContainsUserID(c, into) {
+			return t.AddUserID(c, into)
+		}
+	}
+	return t.Update(c)
+}
+
+// mergePredicts moves the predictions of a user to another one, unless he predicted the same match.
+func mergePredicts(c appengine.Context, from, into *User) error {
+	predicts, err := from.Predicts(c)
+	if err != nil {
+		return err
+	}
+	for _, p := range predicts {
+		if FindPredictByUserMatch(c, into.Id, p.MatchId) != nil {
+			if err = p.Destroy(c); err != nil {
+				return err
+			}
+			continue
+		}
+		p.UserId = into.Id
+		if err = p.Update(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeScores moves the tournament scores of a user to another one, keeping the best score
+// of a tournament when both users have one, and updates his overall score.
+func mergeScores(c appengine.Context, from, into *User) error {
+	for _, fromSot := range from.ScoreOfTournaments {
+		fromScore, err := ScoreByID(c, fromSot.ScoreId)
+		if err != nil {
+			log.Errorf(c, "mergeScores: score %d of user %d not found: %v", fromSot.ScoreId, from.Id, err)
+			continue
+		}
+		fromTotal := sumInt64(&fromScore.Scores)
+
+		found := -1
+		for i, sot := range into.ScoreOfTournaments {
+			if sot.TournamentId == fromSot.TournamentId {
+				found = i
+			}
+		}
+
+		var intoScore *Score
+		if found >= 0 {
+			if intoScore, err = ScoreByID(c, into.ScoreOfTournaments[found].ScoreId); err != nil {
+				intoScore = nil
+			}
+		}
+
+		if intoScore != nil && sumInt64(&intoScore.Scores) >= fromTotal {
+			if err = repository.Delete(c, ScoreKeyByID(c, fromScore.Id)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		fromScore.UserId = into.Id
+		if err = fromScore.Update(c); err != nil {
+			return err
+		}
+		if intoScore != nil {
+			into.Score -= sumInt64(&intoScore.Scores)
+			if err = repository.Delete(c, ScoreKeyByID(c, intoScore.Id)); err != nil {
+				return err
+			}
+		}
+		into.Score += fromTotal
+		if found >= 0 {
+			into.ScoreOfTournaments[found] = fromSot
+		} else {
+			into.ScoreOfTournaments = append(into.ScoreOfTournaments, fromSot)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"appengine"
+
+	"github.com/taironas/gonawin/helpers/memcache"
+	"github.com/taironas/gonawin/repository"
+)
+
+// TestMergeUsers tests that the teams, tournaments, predicts, scores, identities, bans and blocks of a user are moved to another user.
+//
+func TestMergeUsers(t *testing.T) {
+	repository.Use(repository.NewMemory())
+	defer repository.Use(repository.Datastore)
+	memcache.Use(memcache.NewMemory())
+
+	c := repository.NewLocalContext(nil)
+
+	from, err := SigninUserWithIdentity(c, IdentityTwitter, "1", "", false, "lord.snow", "John Snow")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	into, err := SigninUserWithIdentity(c, IdentityGoogle, "2", "john.snow@winterfell.com", true, "john.snow", "John Snow")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	// a team administrated by the merged user and a team of both users.
+	watch, err := CreateTeam(c, "night's watch", "guards of the wall", from.Id, false)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if err = watch.Join(c, from); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	starks, err := CreateTeam(c, "starks", "winter is coming", 10, false)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	for _, u := range []*User{from, into} {
+		if err = starks.Join(c, u); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+	}
+
+	// a team which banned the merged user and a user who blocked him.
+	lannisters, err := CreateTeam(c, "lannisters", "hear me roar", 10, false)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if err = lannisters.Ban(c, from); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	cersei, err := CreateUser(c, "cersei@casterlyrock.com", "cersei", "Cersei Lannister", "", false, "")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if err = cersei.Block(c, from.Id); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	tournament, err := CreateTournament(c, "world cup", "", time.Now(), time.Now(), 10)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if err = tournament.AddUserID(c, from.Id); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	// both users predicted match 1, only the merged user predicted match 2.
+	if _, err = CreatePredict(c, from.Id, 1, 0, 1); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if _, err = CreatePredict(c, from.Id, 2, 2, 2); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	kept, err := CreatePredict(c, into.Id, 0, 1, 1)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	score, err := CreateScore(c, from.Id, tournament.Id)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if err = score.Add(c, 4); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	from.ScoreOfTournaments = []ScoreOfTournament{{score.Id, tournament.Id}}
+	from.Score = 4
+	if err = from.Update(c); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	if err = MergeUsers(c, from, into); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	if _, err = UserByID(c, from.Id); err != repository.ErrNoSuchEntity {
+		t.Errorf("Error: merged user should be deleted, got %v", err)
+	}
+	if into, err = UserByID(c, into.Id); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if watch, err = TeamByID(c, watch.Id); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if starks, err = TeamByID(c, starks.Id); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if lannisters, err = TeamByID(c, lannisters.Id); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if cersei, err = UserByID(c, cersei.Id); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	predicts, err := into.Predicts(c)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	kept, err = PredictByID(c, kept.Id)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	tests := []struct {
+		title string
+		got   bool
+	}{
+		{title: "member of the team of the merged user", got: watch.ContainsUserID(c, into.Id) && !watch.ContainsUserID(c, from.Id)},
+		{title: "admin of the team of the merged user", got: len(watch.AdminIds) == 1 && watch.AdminIds[0] == into.Id},
+		{title: "single membership of a team of both users", got: starks.ContainsUserID(c, into.Id) && starks.MembersCount == 1},
+		{title: "participant of the tournament of the merged user", got: into.ContainsTournamentID(c, tournament.Id)},
+		{title: "predicts are merged, keeping the predict of the same match", got: len(predicts) == 2 && kept.Result2 == 1},
+		{title: "score is merged", got: into.Score == 4 && into.ScoreByTournament(c, tournament.Id) == 4},
+		{title: "can sign in with the identity of the merged user", got: signinUserID(c, IdentityTwitter, "1") == into.Id},
+		{title: "banned from the team which banned the merged user", got: lannisters.IsBanned(into.Id) && !lannisters.IsBanned(from.Id)},
+		{title: "blocked by the user who blocked the merged user", got: cersei.HasBlocked(into.Id) && !cersei.HasBlocked(from.Id)},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+		if !test.got {
+			t.Errorf("test %v - Error: %s", i, test.title)
+		}
+	}
+
+	if err = MergeUsers(c, into, into); err == nil {
+		t.Errorf("Error: a user should not be merged into himself")
+	}
+}
+
+// signinUserID returns the id of the user signing in with an identity.
+func signinUserID(c appengine.Context, provider, externalID string) int64 {
+	u, err := SigninUserWithIdentity(c, provider, externalID, "", false, "", "")
+	if err != nil {
+		return 0
+	}
+	return u.Id
+}
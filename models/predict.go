@@ -21,9 +21,9 @@ import (
 	"time"
 
 	"appengine"
-	"appengine/datastore"
 
 	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/repository"
 )
 
 // Predict is an entity defined by the result of a Match: Result1 and Result2 a match id and a user id.
@@ -41,13 +41,13 @@ type Predict struct {
 //
 func CreatePredict(c appengine.Context, userID, result1, result2, matchID int64) (*Predict, error) {
 
-	pID, _, err := datastore.AllocateIDs(c, "Predict", nil, 1)
+	pID, _, err := repository.AllocateIDs(c, "Predict", 1)
 	if err != nil {
 		return nil, err
 	}
-	key := datastore.NewKey(c, "Predict", "", pID, nil)
+	key := repository.NewKey("Predict", "", pID)
 	p := &Predict{pID, userID, result1, result2, matchID, time.Now()}
-	if _, err = datastore.Put(c, key, p); err != nil {
+	if _, err = repository.Put(c, key, p); err != nil {
 		return nil, err
 	}
 	return p, nil
@@ -61,27 +61,27 @@ func (p *Predict) Destroy(c appengine.Context) error {
 		return fmt.Errorf("Cannot find predict with Id=%d", p.Id)
 	}
 
-	key := datastore.NewKey(c, "Predict", "", p.Id, nil)
+	key := repository.NewKey("Predict", "", p.Id)
 
-	return datastore.Delete(c, key)
+	return repository.Delete(c, key)
 }
 
 // DestroyPredicts destroys a list of predicts.
 //
 func DestroyPredicts(c appengine.Context, predictIds []int64) error {
-	var keys []*datastore.Key
+	var keys []*repository.Key
 	for _, id := range predictIds {
-		keys = append(keys, datastore.NewKey(c, "Predict", "", id, nil))
+		keys = append(keys, repository.NewKey("Predict", "", id))
 	}
 
-	return datastore.DeleteMulti(c, keys)
+	return repository.DeleteMulti(c, keys)
 }
 
 // FindPredicts searches for all Predict entities with respect to a filter and a value.
 //
 func FindPredicts(c appengine.Context, filter string, value interface{}) []*Predict {
 
-	q := datastore.NewQuery("Predict").Filter(filter+" =", value)
+	q := repository.NewQuery("Predict").Filter(filter+" =", value)
 
 	var predicts []*Predict
 
@@ -98,7 +98,7 @@ func FindPredicts(c appengine.Context, filter string, value interface{}) []*Pred
 //
 func FindPredictByUserMatch(c appengine.Context, userID, matchID int64) *Predict {
 	desc := "Predict.FindPredictByUserMatch:"
-	q := datastore.NewQuery("Predict").
+	q := repository.NewQuery("Predict").
 		Filter("UserId"+" =", userID).
 		Filter("MatchId"+" =", matchID)
 
@@ -124,9 +124,9 @@ func FindPredictByUserMatch(c appengine.Context, userID, matchID int64) *Predict
 func PredictByID(c appengine.Context, id int64) (*Predict, error) {
 
 	var p Predict
-	key := datastore.NewKey(c, "Predict", "", id, nil)
+	key := repository.NewKey("Predict", "", id)
 
-	if err := datastore.Get(c, key, &p); err != nil {
+	if err := repository.Get(c, key, &p); err != nil {
 		log.Errorf(c, "predict not found : %v", err)
 		return &p, err
 	}
@@ -135,9 +135,9 @@ func PredictByID(c appengine.Context, id int64) (*Predict, error) {
 
 // PredictKeyByID gets a Predict key given an id.
 //
-func PredictKeyByID(c appengine.Context, id int64) *datastore.Key {
+func PredictKeyByID(c appengine.Context, id int64) *repository.Key {
 
-	key := datastore.NewKey(c, "Predict", "", id, nil)
+	key := repository.NewKey("Predict", "", id)
 
 	return key
 }
@@ -147,8 +147,8 @@ func PredictKeyByID(c appengine.Context, id int64) *datastore.Key {
 func (p *Predict) Update(c appengine.Context) error {
 	k := PredictKeyByID(c, p.Id)
 	old := new(Predict)
-	if err := datastore.Get(c, k, old); err == nil {
-		if _, err = datastore.Put(c, k, p); err != nil {
+	if err := repository.Get(c, k, old); err == nil {
+		if _, err = repository.Put(c, k, p); err != nil {
 			return err
 		}
 	}
@@ -158,7 +158,7 @@ func (p *Predict) Update(c appengine.Context) error {
 // FindAllPredicts gets all Predicts in datastore.
 //
 func FindAllPredicts(c appengine.Context) []*Predict {
-	q := datastore.NewQuery("Predict")
+	q := repository.NewQuery("Predict")
 
 	var predicts []*Predict
 
@@ -177,10 +177,10 @@ func PredictsByIds(c appengine.Context, ids []int64) ([]*Predict, error) {
 
 	var wrongIndexes []int
 
-	if err := datastore.GetMulti(c, keys, predicts); err != nil {
+	if err := repository.GetMulti(c, keys, predicts); err != nil {
 		if me, ok := err.(appengine.MultiError); ok {
 			for i, merr := range me {
-				if merr == datastore.ErrNoSuchEntity {
+				if merr == repository.ErrNoSuchEntity {
 					log.Errorf(c, "PredictsByIds, missing key: %v %v", err, keys[i].IntID())
 					wrongIndexes = append(wrongIndexes, i)
 				}
@@ -201,8 +201,8 @@ func PredictsByIds(c appengine.Context, ids []int64) ([]*Predict, error) {
 
 // PredictKeysByIds returns an array of keys with respect to a given array of ids.
 //
-func PredictKeysByIds(c appengine.Context, ids []int64) []*datastore.Key {
-	keys := make([]*datastore.Key, len(ids))
+func PredictKeysByIds(c appengine.Context, ids []int64) []*repository.Key {
+	keys := make([]*repository.Key, len(ids))
 	for i, id := range ids {
 		keys[i] = PredictKeyByID(c, id)
 	}
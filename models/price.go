@@ -18,36 +18,88 @@ package models
 
 import (
 	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
 	"time"
 
 	"appengine"
-	"appengine/datastore"
 
 	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/taskqueue"
+	"github.com/taironas/gonawin/repository"
 )
 
+// Ranks of a price.
+//
+const (
+	PriceRankFirst        = "first"        // best score of the team in the tournament.
+	PriceRankSecond       = "second"       // second best score of the team in the tournament.
+	PriceRankWoodenSpoon  = "woodenspoon"  // last place of the team in the tournament.
+	PriceRankBestMatchday = "bestmatchday" // best score of the team on a single matchday.
+)
+
+// PriceRanks holds the supported ranks of a price.
+//
+var PriceRanks = []string{PriceRankFirst, PriceRankSecond, PriceRankWoodenSpoon, PriceRankBestMatchday}
+
 // A Price entity is defined by a description of the price that the winner gets for a specific tournament.
 //
+// On top of the description, a price can define what each rank gets. When the tournament
+// finishes the winners of each rank are resolved from the ranking of the team members.
+//
 type Price struct {
-	Id             int64     // price id
-	TeamId         int64     // team id, a price is binded to a single team.
-	TournamentId   int64     // tournament id, a price is binded to a single team.
-	TournamentName string    // tournament name.
-	Description    string    // the description of the price
-	Created        time.Time // date of creation
+	Id             int64         // price id
+	TeamId         int64         // team id, a price is binded to a single team.
+	TournamentId   int64         // tournament id, a price is binded to a single team.
+	TournamentName string        // tournament name.
+	Description    string        // the description of the price
+	Created        time.Time     // date of creation
+	Ranks          []PriceRank   // what each rank of the team gets.
+	Winners        []PriceWinner // winners of each rank, set when the tournament is over.
+	Resolved       time.Time     // date of resolution of the winners, zero if not resolved yet.
+}
+
+// PriceRank holds the description of what a rank of the team gets.
+//
+type PriceRank struct {
+	Rank        string // one of PriceRanks.
+	Description string // what the winner of the rank gets.
+}
+
+// PriceWinner holds a user who won a rank of a price.
+//
+type PriceWinner struct {
+	Rank     string // one of PriceRanks.
+	UserId   int64  // id of the winner.
+	Username string // username of the winner.
+	Score    int64  // score that made the user win the rank.
+}
+
+// IsValidPriceRank checks that a rank is supported.
+//
+func IsValidPriceRank(rank string) bool {
+	for _, r := range PriceRanks {
+		if r == rank {
+			return true
+		}
+	}
+	return false
 }
 
 // CreatePrice creates a Price entity given a description, a team id and a tournament id.
 //
 func CreatePrice(c appengine.Context, teamID, tournamentId int64, tournamentName string, description string) (*Price, error) {
 
-	pID, _, err := datastore.AllocateIDs(c, "Price", nil, 1)
+	pID, _, err := repository.AllocateIDs(c, "Price", 1)
 	if err != nil {
 		return nil, err
 	}
-	key := datastore.NewKey(c, "Price", "", pID, nil)
-	p := &Price{pID, teamID, tournamentId, tournamentName, description, time.Now()}
-	if _, err = datastore.Put(c, key, p); err != nil {
+	key := repository.NewKey("Price", "", pID)
+	var emptyRanks []PriceRank
+	var emptyWinners []PriceWinner
+	p := &Price{pID, teamID, tournamentId, tournamentName, description, time.Now(), emptyRanks, emptyWinners, time.Time{}}
+	if _, err = repository.Put(c, key, p); err != nil {
 		return nil, err
 	}
 	return p, nil
@@ -61,9 +113,9 @@ func (p *Price) Destroy(c appengine.Context) error {
 		return fmt.Errorf("Cannot find price with Id=%d", p.Id)
 	}
 
-	key := datastore.NewKey(c, "Price", "", p.Id, nil)
+	key := repository.NewKey("Price", "", p.Id)
 
-	return datastore.Delete(c, key)
+	return repository.Delete(c, key)
 }
 
 // FindPricesByTeam searches for a Predict entity given a userId and a matchId.
@@ -71,7 +123,7 @@ func (p *Price) Destroy(c appengine.Context) error {
 //
 func FindPricesByTeam(c appengine.Context, teamID int64) []*Price {
 	desc := "Price.FindPriceByTeam:"
-	q := datastore.NewQuery("Price").
+	q := repository.NewQuery("Price").
 		Filter("TeamId"+" =", teamID)
 
 	var prices []*Price
@@ -93,9 +145,9 @@ func FindPricesByTeam(c appengine.Context, teamID int64) []*Price {
 func PriceByID(c appengine.Context, id int64) (*Price, error) {
 
 	var p Price
-	key := datastore.NewKey(c, "Price", "", id, nil)
+	key := repository.NewKey("Price", "", id)
 
-	if err := datastore.Get(c, key, &p); err != nil {
+	if err := repository.Get(c, key, &p); err != nil {
 		log.Errorf(c, "Price not found : %v", err)
 		return &p, err
 	}
@@ -104,9 +156,9 @@ func PriceByID(c appengine.Context, id int64) (*Price, error) {
 
 // PriceKeyByID gets a Price key given an id.
 //
-func PriceKeyByID(c appengine.Context, id int64) *datastore.Key {
+func PriceKeyByID(c appengine.Context, id int64) *repository.Key {
 
-	key := datastore.NewKey(c, "Price", "", id, nil)
+	key := repository.NewKey("Price", "", id)
 	return key
 }
 
@@ -115,8 +167,8 @@ func PriceKeyByID(c appengine.Context, id int64) *datastore.Key {
 func (p *Price) Update(c appengine.Context) error {
 	k := PriceKeyByID(c, p.Id)
 	old := new(Price)
-	if err := datastore.Get(c, k, old); err == nil {
-		if _, err = datastore.Put(c, k, p); err != nil {
+	if err := repository.Get(c, k, old); err == nil {
+		if _, err = repository.Put(c, k, p); err != nil {
 			return err
 		}
 	}
@@ -137,3 +189,186 @@ func PricesByIds(c appengine.Context, ids []int64) []*Price {
 	}
 	return prices
 }
+
+// IsResolved tells if the winners of the price have been resolved.
+//
+func (p *Price) IsResolved() bool {
+	return !p.Resolved.IsZero()
+}
+
+// SetRanks replaces the ranks of the price.
+// An error is returned if a rank is not supported or is defined twice.
+//
+func (p *Price) SetRanks(ranks []PriceRank) error {
+	seen := make(map[string]bool)
+	for _, r := range ranks {
+		if !IsValidPriceRank(r.Rank) {
+			return fmt.Errorf("rank %s is not supported", r.Rank)
+		}
+		if seen[r.Rank] {
+			return fmt.Errorf("rank %s is defined twice", r.Rank)
+		}
+		seen[r.Rank] = true
+	}
+	p.Ranks = ranks
+	return nil
+}
+
+// WinnersByRank returns the winners of a given rank.
+//
+func (p *Price) WinnersByRank(rank string) []PriceWinner {
+	var winners []PriceWinner
+	for _, w := range p.Winners {
+		if w.Rank == rank {
+			winners = append(winners, w)
+		}
+	}
+	return winners
+}
+
+// Resolve computes the winners of each rank of the price from the ranking of the team members
+// in the tournament. All the users with the same score share the rank.
+//
+func (p *Price) Resolve(c appengine.Context, t *Tournament, team *Team) error {
+
+	players, err := team.Players(c)
+	if err != nil {
+		return err
+	}
+
+	var winners []PriceWinner
+	if len(players) > 0 {
+		scores := make([]int64, len(players))
+		for i, u := range players {
+			scores[i] = u.ScoreByTournament(c, t.Id)
+		}
+
+		distinct := distinctScores(scores)
+		for _, r := range p.Ranks {
+			switch r.Rank {
+			case PriceRankFirst:
+				winners = append(winners, priceWinnersWithScore(r.Rank, players, scores, distinct[0])...)
+			case PriceRankSecond:
+				if len(distinct) > 1 {
+					winners = append(winners, priceWinnersWithScore(r.Rank, players, scores, distinct[1])...)
+				}
+			case PriceRankWoodenSpoon:
+				if len(distinct) > 1 {
+					winners = append(winners, priceWinnersWithScore(r.Rank, players, scores, distinct[len(distinct)-1])...)
+				}
+			case PriceRankBestMatchday:
+				winners = append(winners, bestMatchdayWinners(c, t, players)...)
+			}
+		}
+	}
+
+	p.Winners = winners
+	p.Resolved = time.Now()
+	return p.Update(c)
+}
+
+// distinctScores returns the distinct values of an array of scores sorted from the highest to the lowest.
+//
+func distinctScores(scores []int64) []int64 {
+	seen := make(map[int64]bool)
+	var distinct []int64
+	for _, s := range scores {
+		if !seen[s] {
+			seen[s] = true
+			distinct = append(distinct, s)
+		}
+	}
+	sort.Sort(sort.Reverse(int64Slice(distinct)))
+	return distinct
+}
+
+type int64Slice []int64
+
+func (a int64Slice) Len() int           { return len(a) }
+func (a int64Slice) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a int64Slice) Less(i, j int) bool { return a[i] < a[j] }
+
+// priceWinnersWithScore returns the players that have the given score as winners of a rank.
+//
+func priceWinnersWithScore(rank string, players []*User, scores []int64, score int64) []PriceWinner {
+	var winners []PriceWinner
+	for i, u := range players {
+		if scores[i] == score {
+			winners = append(winners, PriceWinner{rank, u.Id, u.Username, score})
+		}
+	}
+	return winners
+}
+
+// bestMatchdayWinners returns the players with the best score on a single matchday of the tournament.
+//
+func bestMatchdayWinners(c appengine.Context, t *Tournament, players []*User) []PriceWinner {
+
+	var finished []Tmatch
+	for _, m := range GetAllMatchesFromTournament(c, t) {
+		if m.Finished {
+			finished = append(finished, *m)
+		}
+	}
+
+	best := make([]int64, len(players))
+	for _, day := range MatchesGroupByDay(finished) {
+		for i, u := range players {
+			sum := int64(0)
+			for j := range day.Matches {
+				if score, err := u.ScoreForMatch(c, &day.Matches[j]); err == nil {
+					sum += score
+				}
+			}
+			if sum > best[i] {
+				best[i] = sum
+			}
+		}
+	}
+
+	max := int64(0)
+	for _, b := range best {
+		if b > max {
+			max = b
+		}
+	}
+	if max == 0 {
+		return nil
+	}
+	return priceWinnersWithScore(PriceRankBestMatchday, players, best, max)
+}
+
+// ResolvePrices resolves the winners of the prices of all the teams of the tournament
+// and publishes an activity for each team announcing its winners.
+//
+func (t *Tournament) ResolvePrices(c appengine.Context) {
+	desc := "Tournament.ResolvePrices:"
+
+	for _, team := range t.Teams(c) {
+		p := team.PriceByTournament(c, t.Id)
+		if p == nil || p.IsResolved() {
+			continue
+		}
+		if err := p.Resolve(c, t, team); err != nil {
+			log.Errorf(c, "%s unable to resolve price %d of team %d: %v", desc, p.Id, team.Id, err)
+			continue
+		}
+
+		// publish new activity
+		for _, w := range p.Winners {
+			object := ActivityEntity{Id: w.UserId, Type: "user", DisplayName: w.Username}
+			team.Publish(c, "price", fmt.Sprintf("awarded the %s price to", w.Rank), object, t.Entity())
+		}
+	}
+}
+
+// AddResolvePricesTask adds a task resolving the prices of the tournament. The task is added
+// to the queue of the score tasks, so that the prices are resolved once the scores are added.
+//
+func (t *Tournament) AddResolvePricesTask(c appengine.Context) error {
+	task := taskqueue.NewPOSTTask("/a/resolve/prices/", url.Values{
+		"tournamentId": []string{strconv.FormatInt(t.Id, 10)},
+	})
+	_, err := taskqueue.Add(c, task, "gw-queue")
+	return err
+}
@@ -0,0 +1,243 @@
+package models
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"appengine"
+
+	"github.com/taironas/gonawin/helpers/memcache"
+	"github.com/taironas/gonawin/repository"
+)
+
+// priceTestPlayers are the members of the team of the price tests, from the oldest to the most recent one.
+var priceTestPlayers = []string{"arya", "jon", "sansa"}
+
+// TestPriceResolve tests the winners of the ranks of a price, from the scores of the members of the team in the tournament.
+//
+func TestPriceResolve(t *testing.T) {
+	defer repository.Use(repository.Datastore)
+	memcache.Use(memcache.NewMemory())
+
+	tests := []struct {
+		title  string
+		scores []int64 // score of each player.
+		ranks  []string
+		want   []string
+	}{
+		{
+			title:  "ties share a rank",
+			scores: []int64{3, 3, 1},
+			ranks:  []string{PriceRankFirst, PriceRankSecond},
+			want:   []string{"first arya 3", "first jon 3", "second sansa 1"},
+		},
+		{
+			title:  "the wooden spoon is the lowest score",
+			scores: []int64{5, 2, 2},
+			ranks:  []string{PriceRankWoodenSpoon},
+			want:   []string{"woodenspoon jon 2", "woodenspoon sansa 2"},
+		},
+		{
+			title:  "second and wooden spoon need at least two distinct scores",
+			scores: []int64{2, 2, 2},
+			ranks:  []string{PriceRankFirst, PriceRankSecond, PriceRankWoodenSpoon},
+			want:   []string{"first arya 2", "first jon 2", "first sansa 2"},
+		},
+		{
+			title:  "no best matchday winner when every score is 0",
+			scores: []int64{0, 0, 0},
+			ranks:  []string{PriceRankBestMatchday},
+			want:   nil,
+		},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+		c, team, tournament, players := newPriceTestTeam(t)
+		for j, u := range players {
+			s, err := CreateScore(c, u.Id, tournament.Id)
+			if err != nil {
+				t.Fatalf("test %v - Error: %v", i, err)
+			}
+			s.Scores = []int64{test.scores[j]}
+			if err = s.Update(c); err != nil {
+				t.Fatalf("test %v - Error: %v", i, err)
+			}
+			u.ScoreOfTournaments = append(u.ScoreOfTournaments, ScoreOfTournament{s.Id, tournament.Id})
+			if err = u.Update(c); err != nil {
+				t.Fatalf("test %v - Error: %v", i, err)
+			}
+		}
+
+		p, err := CreatePrice(c, team.Id, tournament.Id, tournament.Name, "a trip to the wall")
+		if err != nil {
+			t.Fatalf("test %v - Error: %v", i, err)
+		}
+		var ranks []PriceRank
+		for _, r := range test.ranks {
+			ranks = append(ranks, PriceRank{Rank: r, Description: "a direwolf"})
+		}
+		if err = p.SetRanks(ranks); err != nil {
+			t.Fatalf("test %v - Error: %v", i, err)
+		}
+
+		if err = p.Resolve(c, tournament, team); err != nil {
+			t.Errorf("test %v - Error: %v", i, err)
+		}
+		if !p.IsResolved() {
+			t.Errorf("test %v - Error: price should be resolved", i)
+		}
+		if got := priceTestWinners(p.Winners); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("test %v - Error: winners should be %v, got %v", i, test.want, got)
+		}
+	}
+}
+
+// TestDistinctScores tests the distinct scores sorted from the highest to the lowest.
+//
+func TestDistinctScores(t *testing.T) {
+	tests := []struct {
+		title  string
+		scores []int64
+		want   []int64
+	}{
+		{title: "no scores", scores: nil, want: nil},
+		{title: "equal scores are kept once", scores: []int64{2, 2, 2}, want: []int64{2}},
+		{title: "scores are sorted from the highest", scores: []int64{1, 3, 0, 3, 1}, want: []int64{3, 1, 0}},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+		if got := distinctScores(test.scores); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("test %v - Error: distinct scores should be %v, got %v", i, test.want, got)
+		}
+	}
+}
+
+// TestBestMatchdayWinners tests the winners of the best score on a single matchday.
+// The tournament has two finished matches on the first day, 1-0 and 2-2, one on the
+// second day, 0-1, and a match that is not finished yet.
+//
+func TestBestMatchdayWinners(t *testing.T) {
+	defer repository.Use(repository.Datastore)
+	memcache.Use(memcache.NewMemory())
+
+	tests := []struct {
+		title    string
+		predicts map[string][][3]int64 // match index, result1 and result2 predicted by the players.
+		want     []string
+	}{
+		{
+			title: "best sum of the scores of a single matchday",
+			predicts: map[string][][3]int64{
+				"arya": {{0, 1, 0}, {1, 0, 0}, {2, 0, 2}},
+				"jon":  {{0, 2, 0}, {2, 0, 1}},
+			},
+			want: []string{"bestmatchday arya 4"},
+		},
+		{
+			title: "ties share the rank",
+			predicts: map[string][][3]int64{
+				"arya": {{0, 1, 0}},
+				"jon":  {{2, 0, 1}},
+			},
+			want: []string{"bestmatchday arya 3", "bestmatchday jon 3"},
+		},
+		{
+			title: "matches that are not finished are not counted",
+			predicts: map[string][][3]int64{
+				"arya":  {{0, 1, 0}},
+				"sansa": {{0, 2, 0}, {3, 1, 1}},
+			},
+			want: []string{"bestmatchday arya 3"},
+		},
+		{
+			title: "no winner when every score is 0",
+			predicts: map[string][][3]int64{
+				"arya": {{0, 0, 1}},
+				"jon":  {{2, 1, 0}},
+			},
+			want: nil,
+		},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+		c, _, tournament, players := newPriceTestTeam(t)
+		day := time.Date(2014, time.June, 12, 17, 0, 0, 0, time.UTC)
+		var matches []*Tmatch
+		for _, m := range []Tmatch{
+			{Date: day, Result1: 1, Result2: 0, Finished: true},
+			{Date: day.Add(3 * time.Hour), Result1: 2, Result2: 2, Finished: true},
+			{Date: day.AddDate(0, 0, 1), Result1: 0, Result2: 1, Finished: true},
+			{Date: day.AddDate(0, 0, 2), Result1: 1, Result2: 1},
+		} {
+			id, _, err := repository.AllocateIDs(c, "Tmatch", 1)
+			if err != nil {
+				t.Fatalf("test %v - Error: %v", i, err)
+			}
+			match := m
+			match.Id = id
+			match.IdNumber = int64(len(matches) + 1)
+			if _, err = repository.Put(c, MatchKeyByID(c, id), &match); err != nil {
+				t.Fatalf("test %v - Error: %v", i, err)
+			}
+			matches = append(matches, &match)
+			tournament.Matches1stStage = append(tournament.Matches1stStage, id)
+		}
+
+		for _, u := range players {
+			for _, p := range test.predicts[u.Username] {
+				if _, err := CreatePredict(c, u.Id, p[1], p[2], matches[p[0]].Id); err != nil {
+					t.Fatalf("test %v - Error: %v", i, err)
+				}
+			}
+		}
+
+		if got := priceTestWinners(bestMatchdayWinners(c, tournament, players)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("test %v - Error: winners should be %v, got %v", i, test.want, got)
+		}
+	}
+}
+
+// newPriceTestTeam creates a team with the price test players as members, and a tournament, on new data.
+func newPriceTestTeam(t *testing.T) (appengine.Context, *Team, *Tournament, []*User) {
+	repository.Use(repository.NewMemory())
+	c := repository.NewLocalContext(nil)
+
+	var players []*User
+	for _, name := range priceTestPlayers {
+		u, err := CreateUser(c, name+"@winterfell.com", name, name, "", false, "")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		players = append(players, u)
+	}
+
+	team, err := CreateTeam(c, "starks", "winter is coming", players[0].Id, false)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	for _, u := range players {
+		if err = team.Join(c, u); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+	}
+
+	tournament, err := CreateTournament(c, "world cup", "", time.Now(), time.Now(), players[0].Id)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	return c, team, tournament, players
+}
+
+// priceTestWinners returns the rank, username and score of each winner.
+func priceTestWinners(winners []PriceWinner) []string {
+	var got []string
+	for _, w := range winners {
+		got = append(got, fmt.Sprintf("%s %s %d", w.Rank, w.Username, w.Score))
+	}
+	return got
+}
@@ -0,0 +1,347 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"appengine"
+
+	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/repository"
+)
+
+// Kinds of the relations between entities.
+const (
+	teamMemberKind            = "TeamMember"            // from a team to one of its members.
+	tournamentParticipantKind = "TournamentParticipant" // from a tournament to one of its participants.
+	userActivityKind          = "UserActivity"          // from a user to one of the activities of his feed.
+)
+
+// maxRelationsPerCall is the maximum number of relations written in a single datastore call.
+const maxRelationsPerCall = 500
+
+// Relation entity links two entities, like a team and one of its members.
+//
+// Relations are stored one entity per link, so that the entities they link do not grow
+// with their number of members, participants or activities. The key of a relation is
+// made of the ids it links, a relation is then written without reading the entities.
+//
+type Relation struct {
+	FromId  int64
+	ToId    int64
+	Created time.Time
+}
+
+// relationKey returns the key of the relation of a kind between two entities.
+func relationKey(kind string, fromID, toID int64) *repository.Key {
+	return repository.NewKey(kind, fmt.Sprintf("%d/%d", fromID, toID), 0)
+}
+
+// relationIDs returns the ids linked by the key of a relation.
+func relationIDs(key *repository.Key) (fromID, toID int64, err error) {
+	if _, err = fmt.Sscanf(key.StringID(), "%d/%d", &fromID, &toID); err != nil {
+		return 0, 0, fmt.Errorf("model/relation: invalid relation key %v", key)
+	}
+	return fromID, toID, nil
+}
+
+// putRelations stores relations of a kind.
+func putRelations(c appengine.Context, kind string, relations []*Relation) error {
+	for len(relations) > 0 {
+		n := len(relations)
+		if n > maxRelationsPerCall {
+			n = maxRelationsPerCall
+		}
+		keys := make([]*repository.Key, n)
+		for i, r := range relations[:n] {
+			keys[i] = relationKey(kind, r.FromId, r.ToId)
+		}
+		if _, err := repository.PutMulti(c, keys, relations[:n]); err != nil {
+			log.Errorf(c, "model/relation, putRelations: error occurred during PutMulti call: %v", err)
+			return err
+		}
+		relations = relations[n:]
+	}
+	return nil
+}
+
+// addRelation links an entity to another one.
+func addRelation(c appengine.Context, kind string, fromID, toID int64) error {
+	return putRelations(c, kind, []*Relation{{fromID, toID, time.Now()}})
+}
+
+// removeRelation removes the link between two entities.
+func removeRelation(c appengine.Context, kind string, fromID, toID int64) error {
+	return repository.Delete(c, relationKey(kind, fromID, toID))
+}
+
+// hasRelation checks if an entity is linked to another one.
+func hasRelation(c appengine.Context, kind string, fromID, toID int64) (bool, error) {
+	var r Relation
+	if err := repository.Get(c, relationKey(kind, fromID, toID), &r); err == repository.ErrNoSuchEntity {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// relationQuery returns a query on the relations of a kind from an entity, or to an entity
+// when field is "ToId", starting with the most recent ones.
+func relationQuery(kind, field string, id int64) *repository.Query {
+	return repository.NewQuery(kind).Filter(field+" =", id).Order("-Created").KeysOnly()
+}
+
+// linkedID returns the id at the other end of a relation with respect to the filtered field.
+func linkedID(key *repository.Key, field string) (int64, error) {
+	fromID, toID, err := relationIDs(key)
+	if field == "ToId" {
+		return fromID, err
+	}
+	return toID, err
+}
+
+// relatedIDs returns the ids of the entities linked from an entity, or to an entity when
+// field is "ToId", from the oldest link to the most recent one.
+func relatedIDs(c appengine.Context, kind, field string, id int64) ([]int64, error) {
+	keys, err := relationQuery(kind, field, id).GetAll(c, nil)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, 0, len(keys))
+	for i := len(keys) - 1; i >= 0; i-- {
+		linked, err := linkedID(keys[i], field)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, linked)
+	}
+	return ids, nil
+}
+
+// relatedIDsByCursor returns a page of count ids linked from an entity, or to an entity
+// when field is "ToId", starting with the most recent links, and the cursor of the next page.
+func relatedIDsByCursor(c appengine.Context, kind, field string, id int64, count int64, cursor string) ([]int64, string, error) {
+	if count <= 0 {
+		return nil, "", nil
+	}
+	it := relationQuery(kind, field, id).Start(repository.Cursor(cursor)).Run(c)
+
+	var ids []int64
+	for int64(len(ids)) < count {
+		key, err := it.Next(nil)
+		if err == repository.Done {
+			return ids, "", nil
+		} else if err != nil {
+			return nil, "", err
+		}
+		var linked int64
+		if linked, err = linkedID(key, field); err != nil {
+			return nil, "", err
+		}
+		ids = append(ids, linked)
+	}
+	next, err := it.Cursor()
+	if err != nil {
+		return nil, "", err
+	}
+	return ids, string(next), nil
+}
+
+// removeRelations removes all the relations from an entity, or to an entity when field is "ToId",
+// by batches of maxRelationsPerCall relations.
+func removeRelations(c appengine.Context, kind, field string, id int64) error {
+	for {
+		n, err := removeRelationsUpTo(c, kind, field, id, maxRelationsPerCall)
+		if err != nil || n == 0 {
+			return err
+		}
+	}
+}
+
+// removeRelationsUpTo removes at most limit relations from an entity, or to an entity when field is "ToId",
+// and returns the number of relations removed.
+func removeRelationsUpTo(c appengine.Context, kind, field string, id int64, limit int) (int, error) {
+	keys, err := repository.NewQuery(kind).Filter(field+" =", id).KeysOnly().Limit(limit).GetAll(c, nil)
+	if err != nil {
+		return 0, err
+	}
+	return len(keys), repository.DeleteMulti(c, keys)
+}
+
+// legacyRelations returns the relations of a legacy list of ids, either from the owner of
+// the list to the ids, or from the ids to the owner when toOwner is true.
+// The relations keep the order of the list, the last id being the most recent link.
+func legacyRelations(ownerID int64, ids []int64, toOwner bool) []*Relation {
+	now := time.Now()
+	relations := make([]*Relation, len(ids))
+	for i, id := range ids {
+		created := now.Add(time.Duration(i-len(ids)) * time.Microsecond)
+		if toOwner {
+			relations[i] = &Relation{id, ownerID, created}
+		} else {
+			relations[i] = &Relation{ownerID, id, created}
+		}
+	}
+	return relations
+}
+
+// putMissingRelations stores the relations which are not stored yet.
+// Existing relations are left unchanged so that migrating both ends of a link keeps
+// its creation date.
+func putMissingRelations(c appengine.Context, kind string, relations []*Relation) error {
+	for len(relations) > 0 {
+		n := len(relations)
+		if n > maxRelationsPerCall {
+			n = maxRelationsPerCall
+		}
+		keys := make([]*repository.Key, n)
+		for i, r := range relations[:n] {
+			keys[i] = relationKey(kind, r.FromId, r.ToId)
+		}
+		existing := make([]Relation, n)
+		if err := repository.GetMulti(c, keys, existing); err != nil {
+			me, ok := err.(appengine.MultiError)
+			if !ok {
+				return err
+			}
+			var missing []*Relation
+			for i, merr := range me {
+				if merr == repository.ErrNoSuchEntity {
+					missing = append(missing, relations[i])
+				} else if merr != nil {
+					return merr
+				}
+			}
+			if err = putRelations(c, kind, missing); err != nil {
+				return err
+			}
+		}
+		relations = relations[n:]
+	}
+	return nil
+}
+
+// RelationsMigrationKinds are the kinds of the entities holding legacy lists of ids moved to relations.
+//
+var RelationsMigrationKinds = []string{"User", "Team", "Tournament"}
+
+// relationsMigrator is an entity holding legacy lists of ids to move to relations.
+type relationsMigrator interface {
+	migrateRelations(c appengine.Context) error
+}
+
+// MigrateRelations moves the legacy lists of ids of a batch of User, Team or Tournament
+// entities to relation entities. The entities are migrated one at a time and stay
+// readable during the migration, as the models migrate the entities they access.
+// It returns the number of entities of the batch and the cursor of the next batch,
+// empty when all the entities of the kind were processed.
+//
+func MigrateRelations(c appengine.Context, kind string, count int, cursor string) (int, string, error) {
+	var newEntity func() relationsMigrator
+	switch kind {
+	case "User":
+		newEntity = func() relationsMigrator { return new(User) }
+	case "Team":
+		newEntity = func() relationsMigrator { return new(Team) }
+	case "Tournament":
+		newEntity = func() relationsMigrator { return new(Tournament) }
+	default:
+		return 0, "", fmt.Errorf("model/relation: no relations to migrate for kind %s", kind)
+	}
+
+	it := repository.NewQuery(kind).Start(repository.Cursor(cursor)).Run(c)
+	n := 0
+	for n < count {
+		e := newEntity()
+		if _, err := it.Next(e); err == repository.Done {
+			return n, "", nil
+		} else if err != nil {
+			return n, "", err
+		}
+		if err := e.migrateRelations(c); err != nil {
+			return n, "", err
+		}
+		n++
+	}
+	next, err := it.Cursor()
+	if err != nil {
+		return n, "", err
+	}
+	return n, string(next), nil
+}
+
+// migrateRelations moves the legacy team, tournament, activity and predict ids of
+// the user to relation entities.
+func (u *User) migrateRelations(c appengine.Context) error {
+	if len(u.TeamIds) == 0 && len(u.TournamentIds) == 0 && len(u.ActivityIds) == 0 && len(u.PredictIds) == 0 {
+		return nil
+	}
+	if err := putMissingRelations(c, teamMemberKind, legacyRelations(u.Id, u.TeamIds, true)); err != nil {
+		return err
+	}
+	if err := putMissingRelations(c, tournamentParticipantKind, legacyRelations(u.Id, u.TournamentIds, true)); err != nil {
+		return err
+	}
+	activities, err := activityRelations(c, u.Id, u.ActivityIds)
+	if err != nil {
+		return err
+	}
+	if err = putMissingRelations(c, userActivityKind, activities); err != nil {
+		return err
+	}
+
+	// predicts hold the id of their user and need no relation.
+	u.TeamIds = nil
+	u.TournamentIds = nil
+	u.ActivityIds = nil
+	u.PredictIds = nil
+	log.Infof(c, "model/relation: relations of user %d migrated", u.Id)
+	return u.Update(c)
+}
+
+// migrateRelations moves the legacy member ids of the team to relation entities.
+func (t *Team) migrateRelations(c appengine.Context) error {
+	if len(t.UserIds) == 0 {
+		return nil
+	}
+	if err := putMissingRelations(c, teamMemberKind, legacyRelations(t.Id, t.UserIds, false)); err != nil {
+		return err
+	}
+
+	t.MembersCount = int64(len(t.UserIds))
+	t.UserIds = nil
+	log.Infof(c, "model/relation: relations of team %d migrated", t.Id)
+	return t.Update(c)
+}
+
+// migrateRelations moves the legacy participant ids of the tournament to relation entities.
+func (t *Tournament) migrateRelations(c appengine.Context) error {
+	if len(t.UserIds) == 0 {
+		return nil
+	}
+	if err := putMissingRelations(c, tournamentParticipantKind, legacyRelations(t.Id, t.UserIds, false)); err != nil {
+		return err
+	}
+
+	t.ParticipantsCount = int64(len(t.UserIds))
+	t.UserIds = nil
+	log.Infof(c, "model/relation: relations of tournament %d migrated", t.Id)
+	return t.Update(c)
+}
@@ -0,0 +1,361 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/taironas/gonawin/helpers/memcache"
+	"github.com/taironas/gonawin/repository"
+)
+
+// TestRelationJoinLeave tests that joining and leaving a team or a tournament maintains the relations and counts.
+//
+func TestRelationJoinLeave(t *testing.T) {
+	repository.Use(repository.NewMemory())
+	defer repository.Use(repository.Datastore)
+	memcache.Use(memcache.NewMemory())
+
+	c := repository.NewLocalContext(nil)
+
+	user, err := CreateUser(c, "john.snow@winterfell.com", "john.snow", "John Snow", "Crow", false, "")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	team, err := CreateTeam(c, "night's watch", "guards of the wall", 10, false)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	tournament := &Tournament{Id: 30, Name: "world cup"}
+	if err = tournament.Update(c); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	if err = team.Join(c, user); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if err = tournament.Join(c, user); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	tests := []struct {
+		title   string
+		got     bool
+		want    bool
+		count   int64
+		wantLen int64
+	}{
+		{title: "user is a member of the team", got: user.ContainsTeamID(c, team.Id), want: true, count: team.MembersCount, wantLen: 1},
+		{title: "team contains the user", got: team.ContainsUserID(c, user.Id), want: true, count: int64(len(team.UserIDs(c))), wantLen: 1},
+		{title: "user participates in the tournament", got: user.ContainsTournamentID(c, tournament.Id), want: true, count: tournament.CountParticipants(), wantLen: 1},
+		{title: "tournament contains the user", got: tournament.ContainsUserID(c, user.Id), want: true, count: int64(len(user.TournamentIDs(c))), wantLen: 1},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+		if test.got != test.want {
+			t.Errorf("test %v - Error: want %t, got %t", i, test.want, test.got)
+		}
+		if test.count != test.wantLen {
+			t.Errorf("test %v - Error: want count == %d, got %d", i, test.wantLen, test.count)
+		}
+	}
+
+	if err = team.Join(c, user); err == nil {
+		t.Errorf("Error: a user should not join twice the same team")
+	}
+	if err = team.Leave(c, user); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if user.ContainsTeamID(c, team.Id) || team.MembersCount != 0 || len(user.TeamIDs(c)) != 0 {
+		t.Errorf("Error: user should have left the team, members count %d", team.MembersCount)
+	}
+	if err = tournament.RemoveUserID(c, user.Id); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if user.ContainsTournamentID(c, tournament.Id) || tournament.CountParticipants() != 0 {
+		t.Errorf("Error: user should have left the tournament, participants count %d", tournament.CountParticipants())
+	}
+}
+
+// TestRelationConcurrentCounts tests that the counts of members and participants are kept when users
+// join and leave through copies of a team or a tournament loaded before the other changes.
+//
+func TestRelationConcurrentCounts(t *testing.T) {
+	repository.Use(repository.NewMemory())
+	defer repository.Use(repository.Datastore)
+	memcache.Use(memcache.NewMemory())
+
+	c := repository.NewLocalContext(nil)
+
+	var users []*User
+	for _, name := range []string{"jon", "sam", "grenn"} {
+		u, err := CreateUser(c, name+"@thewall.com", name, name, "", false, "")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		users = append(users, u)
+	}
+	team, err := CreateTeam(c, "night's watch", "guards of the wall", users[0].Id, false)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	tournament, err := CreateTournament(c, "world cup", "", time.Now(), time.Now(), users[0].Id)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	// every user joins and the first user leaves through a copy loaded before any of them joined.
+	var teams []*Team
+	var tournaments []*Tournament
+	for range users {
+		tm, err := TeamByID(c, team.Id)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		tr, err := TournamentByID(c, tournament.Id)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		teams, tournaments = append(teams, tm), append(tournaments, tr)
+	}
+	for i, u := range users {
+		if err = teams[i].AddUserID(c, u.Id); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if err = tournaments[i].AddUserID(c, u.Id); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+	}
+	if err = teams[0].RemoveUserID(c, users[0].Id); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if err = tournaments[0].RemoveUserID(c, users[0].Id); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	if team, err = TeamByID(c, team.Id); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if tournament, err = TournamentByID(c, tournament.Id); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if team.MembersCount != 2 || int64(len(team.UserIDs(c))) != 2 {
+		t.Errorf("Error: want 2 members, got count %d and %d members", team.MembersCount, len(team.UserIDs(c)))
+	}
+	if tournament.CountParticipants() != 2 || len(tournament.UserIDs(c)) != 2 {
+		t.Errorf("Error: want 2 participants, got count %d and %d participants", tournament.CountParticipants(), len(tournament.UserIDs(c)))
+	}
+}
+
+// TestRemoveRelations tests that more relations than a datastore call deletes are all removed.
+//
+func TestRemoveRelations(t *testing.T) {
+	repository.Use(repository.NewMemory())
+	defer repository.Use(repository.Datastore)
+	memcache.Use(memcache.NewMemory())
+
+	c := repository.NewLocalContext(nil)
+
+	ids := make([]int64, 2*maxRelationsPerCall+1)
+	for i := range ids {
+		ids[i] = int64(i + 1)
+	}
+	if err := putRelations(c, teamMemberKind, legacyRelations(1, ids, false)); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if err := putRelations(c, teamMemberKind, legacyRelations(2, ids[:1], false)); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	if err := removeRelations(c, teamMemberKind, "FromId", 1); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	keys, err := repository.NewQuery(teamMemberKind).KeysOnly().GetAll(c, nil)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if len(keys) != 1 {
+		t.Errorf("Error: want only the relation of another team left, got %d relations", len(keys))
+	}
+}
+
+// TestRelationPlayersByCursor tests that the members of a team are paginated from the most recent one.
+//
+func TestRelationPlayersByCursor(t *testing.T) {
+	repository.Use(repository.NewMemory())
+	defer repository.Use(repository.Datastore)
+	memcache.Use(memcache.NewMemory())
+
+	c := repository.NewLocalContext(nil)
+
+	team, err := CreateTeam(c, "night's watch", "guards of the wall", 10, false)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	var userIDs []int64
+	for i := 0; i < 5; i++ {
+		var user *User
+		if user, err = CreateUser(c, "john.snow@winterfell.com", "john.snow", "John Snow", "Crow", false, ""); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if err = team.Join(c, user); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		userIDs = append(userIDs, user.Id)
+	}
+
+	tests := []struct {
+		title string
+		count int64
+		want  []int64
+		more  bool
+	}{
+		{title: "first page", count: 2, want: []int64{userIDs[4], userIDs[3]}, more: true},
+		{title: "second page", count: 2, want: []int64{userIDs[2], userIDs[1]}, more: true},
+		{title: "last page", count: 2, want: []int64{userIDs[0]}, more: false},
+	}
+
+	cursor := ""
+	for i, test := range tests {
+		t.Log(test.title)
+		var players []*User
+		if players, cursor, err = team.PlayersByCursor(c, test.count, cursor); err != nil {
+			t.Fatalf("test %v - Error: %v", i, err)
+		}
+		if len(players) != len(test.want) {
+			t.Fatalf("test %v - Error: want %d players, got %d", i, len(test.want), len(players))
+		}
+		for j := range players {
+			if players[j].Id != test.want[j] {
+				t.Errorf("test %v - Error: want player %d == %d, got %d", i, j, test.want[j], players[j].Id)
+			}
+		}
+		if (cursor != "") != test.more {
+			t.Errorf("test %v - Error: want more pages == %t, got cursor %q", i, test.more, cursor)
+		}
+	}
+}
+
+// TestRelationMigration tests that the legacy lists of ids are moved to relations.
+//
+func TestRelationMigration(t *testing.T) {
+	repository.Use(repository.NewMemory())
+	defer repository.Use(repository.Datastore)
+	memcache.Use(memcache.NewMemory())
+
+	c := repository.NewLocalContext(nil)
+
+	// entities stored before the relations.
+	legacyUser := &User{Id: 1, Username: "john.snow", TeamIds: []int64{10, 11}, TournamentIds: []int64{30}}
+	if _, err := repository.Put(c, UserKeyByID(c, 1), legacyUser); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	legacyTeam := &Team{Id: 10, Name: "night's watch", UserIds: []int64{1, 2}}
+	if _, err := repository.Put(c, TeamKeyByID(c, 10), legacyTeam); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	legacyTournament := &Tournament{Id: 30, Name: "world cup", UserIds: []int64{1, 2, 3}}
+	if _, err := repository.Put(c, TournamentKeyByID(c, 30), legacyTournament); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	for _, kind := range RelationsMigrationKinds {
+		cursor := ""
+		for {
+			var err error
+			if _, cursor, err = MigrateRelations(c, kind, 1, cursor); err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			if cursor == "" {
+				break
+			}
+		}
+	}
+
+	user, err := UserByID(c, 1)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	team, err := TeamByID(c, 10)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	tournament, err := TournamentByID(c, 30)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	tests := []struct {
+		title string
+		got   []int64
+		want  []int64
+	}{
+		{title: "user teams", got: user.TeamIDs(c), want: []int64{10, 11}},
+		{title: "user tournaments", got: user.TournamentIDs(c), want: []int64{30}},
+		{title: "team members", got: team.UserIDs(c), want: []int64{1, 2}},
+		{title: "tournament participants", got: tournament.UserIDs(c), want: []int64{1, 2, 3}},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+		if len(test.got) != len(test.want) {
+			t.Errorf("test %v - Error: want ids %v, got %v", i, test.want, test.got)
+			continue
+		}
+		for j := range test.got {
+			if test.got[j] != test.want[j] {
+				t.Errorf("test %v - Error: want ids %v, got %v", i, test.want, test.got)
+				break
+			}
+		}
+	}
+
+	if len(user.TeamIds) != 0 || len(team.UserIds) != 0 || len(tournament.UserIds) != 0 {
+		t.Errorf("Error: legacy ids should have been cleared")
+	}
+	if team.MembersCount != 2 || tournament.CountParticipants() != 3 {
+		t.Errorf("Error: want counts 2 and 3, got %d and %d", team.MembersCount, tournament.CountParticipants())
+	}
+}
+
+// TestRelationActivities tests that published activities are added to the feeds of the users.
+//
+func TestRelationActivities(t *testing.T) {
+	repository.Use(repository.NewMemory())
+	defer repository.Use(repository.Datastore)
+	memcache.Use(memcache.NewMemory())
+
+	c := repository.NewLocalContext(nil)
+
+	user, err := CreateUser(c, "john.snow@winterfell.com", "john.snow", "John Snow", "Crow", false, "")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	team, err := CreateTeam(c, "night's watch", "guards of the wall", 10, false)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if err = team.Join(c, user); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	if err = user.Publish(c, "team", "joined team", team.Entity(), ActivityEntity{}); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if err = team.Publish(c, "team", "has a new member", user.Entity(), ActivityEntity{}); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	ids := user.ActivityIDs(c)
+	if len(ids) != 2 {
+		t.Fatalf("Error: want 2 activities in the user feed, got %d", len(ids))
+	}
+
+	activities, next, err := FindActivitiesByCursor(c, user, 1, "")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if len(activities) != 1 || activities[0].Id != ids[1] || next == "" {
+		t.Errorf("Error: want the most recent activity %d and a next page, got %v, %q", ids[1], activities, next)
+	}
+}
@@ -0,0 +1,175 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"appengine"
+
+	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/repository"
+)
+
+// Kinds of a report.
+//
+const (
+	ReportKindUser = "user" // report of an abusive user.
+	ReportKindTeam = "team" // report of an abusive team.
+)
+
+// States of a report.
+//
+const (
+	ReportOpen     = "open"     // the report has to be reviewed by a gonawin admin.
+	ReportResolved = "resolved" // the report has been reviewed by a gonawin admin.
+)
+
+// ReportReasonMaxLength is the maximum length of the reason of a report.
+//
+const ReportReasonMaxLength = 1000
+
+// Report holds a report of an abusive user or team to the gonawin admins.
+//
+type Report struct {
+	Id         int64
+	ReporterId int64     // id of the user who sent the report.
+	Kind       string    // kind of the reported entity, user or team.
+	TargetId   int64     // id of the reported entity.
+	Reason     string    `datastore:",noindex"` // reason of the report.
+	State      string    // open or resolved.
+	Created    time.Time // date of creation.
+	ResolverId int64     // id of the admin who resolved the report.
+	Resolution string    `datastore:",noindex"` // note of the admin who resolved the report.
+	Resolved   time.Time // date of resolution.
+}
+
+// ReportJSON is the JSON representation of the Report entity.
+//
+type ReportJSON struct {
+	Id         *int64     `json:",omitempty"`
+	ReporterId *int64     `json:",omitempty"`
+	Kind       *string    `json:",omitempty"`
+	TargetId   *int64     `json:",omitempty"`
+	Reason     *string    `json:",omitempty"`
+	State      *string    `json:",omitempty"`
+	Created    *time.Time `json:",omitempty"`
+	ResolverId *int64     `json:",omitempty"`
+	Resolution *string    `json:",omitempty"`
+	Resolved   *time.Time `json:",omitempty"`
+}
+
+// IsValidReportKind checks that a kind of report is supported.
+//
+func IsValidReportKind(kind string) bool {
+	return kind == ReportKindUser || kind == ReportKindTeam
+}
+
+// CreateReport creates a report given the reporter id, the kind and the id of the reported entity and a reason.
+//
+func CreateReport(c appengine.Context, reporterID int64, kind string, targetID int64, reason string) (*Report, error) {
+	if !IsValidReportKind(kind) {
+		return nil, fmt.Errorf("model/report: kind %s is not supported", kind)
+	}
+	if len(reason) > ReportReasonMaxLength {
+		return nil, fmt.Errorf("model/report: reason is too long, %d characters max", ReportReasonMaxLength)
+	}
+
+	id, _, err := repository.AllocateIDs(c, "Report", 1)
+	if err != nil {
+		return nil, err
+	}
+
+	key := repository.NewKey("Report", "", id)
+	report := &Report{
+		Id:         id,
+		ReporterId: reporterID,
+		Kind:       kind,
+		TargetId:   targetID,
+		Reason:     reason,
+		State:      ReportOpen,
+		Created:    time.Now(),
+	}
+
+	if _, err = repository.Put(c, key, report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// ReportByID gets a report given an id.
+//
+func ReportByID(c appengine.Context, id int64) (*Report, error) {
+	var r Report
+	key := ReportKeyByID(c, id)
+
+	if err := repository.Get(c, key, &r); err != nil {
+		log.Errorf(c, " report.ByID, error occurred during Get: %v", err)
+		return nil, err
+	}
+	return &r, nil
+}
+
+// ReportKeyByID gets a report key given an id.
+//
+func ReportKeyByID(c appengine.Context, id int64) *repository.Key {
+	return repository.NewKey("Report", "", id)
+}
+
+// Update a report entity.
+//
+func (r *Report) Update(c appengine.Context) error {
+	_, err := repository.Put(c, ReportKeyByID(c, r.Id), r)
+	return err
+}
+
+// FindReports searches for all Report entities with respect of a filter and a value.
+//
+func FindReports(c appengine.Context, filter string, value interface{}) []*Report {
+	q := repository.NewQuery("Report").Filter(filter+" =", value)
+
+	var reports []*Report
+	if _, err := q.GetAll(c, &reports); err != nil {
+		log.Errorf(c, " report.Find, error occurred during GetAll: %v", err)
+	}
+	return reports
+}
+
+// WasReportSent checks if a user has an open report on an entity.
+//
+func WasReportSent(c appengine.Context, reporterID int64, kind string, targetID int64) bool {
+	for _, r := range FindReports(c, "ReporterId", reporterID) {
+		if r.State == ReportOpen && r.Kind == kind && r.TargetId == targetID {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve closes a report with a note of the admin who reviewed it.
+//
+func (r *Report) Resolve(c appengine.Context, resolverID int64, resolution string) error {
+	if r.State != ReportOpen {
+		return fmt.Errorf("model/report: report %d is already resolved", r.Id)
+	}
+	r.State = ReportResolved
+	r.ResolverId = resolverID
+	r.Resolution = resolution
+	r.Resolved = time.Now()
+	return r.Update(c)
+}
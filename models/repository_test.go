@@ -0,0 +1,159 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/taironas/gonawin/helpers/memcache"
+	"github.com/taironas/gonawin/repository"
+)
+
+// TestTeamsInMemory tests that teams can be created, joined, found and searched
+// with the in-memory repository, without App Engine.
+//
+func TestTeamsInMemory(t *testing.T) {
+	repository.Use(repository.NewMemory())
+	defer repository.Use(repository.Datastore)
+	memcache.Use(memcache.NewMemory())
+
+	c := repository.NewLocalContext(nil)
+
+	var err error
+	var user *User
+	if user, err = CreateUser(c, "foo@foo.com", "john", "john snow", "", false, ""); err != nil {
+		t.Fatal(err)
+	}
+	var gunners, lions *Team
+	if gunners, err = CreateTeam(c, "London Gunners", "description", user.Id, false); err != nil {
+		t.Fatal(err)
+	}
+	if lions, err = CreateTeam(c, "Zürich Lions", "description", user.Id, true); err != nil {
+		t.Fatal(err)
+	}
+	if err = lions.Join(c, user); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		title  string
+		filter string
+		value  interface{}
+		query  string
+		want   []int64
+	}{
+		{
+			title:  "can find teams by name",
+			filter: "KeyName",
+			value:  "london gunners",
+			want:   []int64{gunners.Id},
+		},
+		{
+			title:  "can find teams by number of members",
+			filter: "MembersCount",
+			value:  int64(1),
+			want:   []int64{lions.Id},
+		},
+		{
+			title:  "can find teams by admin",
+			filter: "AdminIds",
+			value:  user.Id,
+			want:   []int64{gunners.Id, lions.Id},
+		},
+		{
+			title: "can search teams",
+			query: "zurich",
+			want:  []int64{lions.Id},
+		},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+		var teams []*Team
+		if test.query != "" {
+			if teams, _, _, err = SearchTeams(c, test.query, TeamSearchOptions{Count: 10, Page: 1}); err != nil {
+				t.Errorf("test %v - Error: %v", i, err)
+			}
+		} else {
+			teams = FindTeams(c, test.filter, test.value)
+		}
+		if len(teams) != len(test.want) {
+			t.Errorf("test %v - Error: got %v teams, want %v", i, len(teams), len(test.want))
+			continue
+		}
+		for j := range teams {
+			if teams[j].Id != test.want[j] {
+				t.Errorf("test %v - Error: got team %v, want %v", i, teams[j].Id, test.want[j])
+			}
+		}
+	}
+
+	if err = gunners.Destroy(c); err != nil {
+		t.Errorf("Error: %v", err)
+	}
+	if _, err = TeamByID(c, gunners.Id); err != repository.ErrNoSuchEntity {
+		t.Errorf("Error: want %v, got %v", repository.ErrNoSuchEntity, err)
+	}
+	if ids, _ := SearchIds(c, TeamSearchKind, "gunners"); len(ids) != 0 {
+		t.Errorf("Error: destroyed team is still indexed: %v", ids)
+	}
+}
+
+// TestRankingCacheInvalidation tests that a cached team ranking is refreshed
+// when a player is updated.
+//
+func TestRankingCacheInvalidation(t *testing.T) {
+	repository.Use(repository.NewMemory())
+	defer repository.Use(repository.Datastore)
+	memcache.Use(memcache.NewMemory())
+
+	c := repository.NewLocalContext(nil)
+
+	var err error
+	var john, arya *User
+	if john, err = CreateUser(c, "john@foo.com", "john", "john snow", "", false, ""); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if arya, err = CreateUser(c, "arya@foo.com", "arya", "arya stark", "", false, ""); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	var team *Team
+	if team, err = CreateTeam(c, "Winterfell", "description", john.Id, false); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	for _, u := range []*User{john, arya} {
+		if err = team.Join(c, u); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+	}
+	john.Score = 5
+	if err = john.Update(c); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	tests := []struct {
+		title string
+		score int64
+		want  int64
+	}{
+		{title: "ranking is computed", score: 0, want: john.Id},
+		{title: "ranking is refreshed after update", score: 10, want: arya.Id},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+		arya.Score = test.score
+		if err = arya.Update(c); err != nil {
+			t.Errorf("test %v - Error: %v", i, err)
+		}
+		if team, err = TeamByID(c, team.Id); err != nil {
+			t.Fatalf("test %v - Error: %v", i, err)
+		}
+		users := team.RankingByUser(c, 10)
+		if len(users) != 2 {
+			t.Errorf("test %v - Error: got %v users, want 2", i, len(users))
+			continue
+		}
+		if users[len(users)-1].Id != test.want {
+			t.Errorf("test %v - Error: got user %v last, want %v", i, users[len(users)-1].Id, test.want)
+		}
+	}
+}
@@ -18,9 +18,9 @@ package models
 
 import (
 	"appengine"
-	"appengine/datastore"
 
 	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/repository"
 )
 
 // Score entity is a placeholder for progression of the score of a user in a tournament.
@@ -62,14 +62,14 @@ type ScoreJSON struct {
 // CreateScore creates a Score entity.
 //
 func CreateScore(c appengine.Context, userID int64, tournamentId int64) (*Score, error) {
-	sID, _, err := datastore.AllocateIDs(c, "Score", nil, 1)
+	sID, _, err := repository.AllocateIDs(c, "Score", 1)
 	if err != nil {
 		return nil, err
 	}
-	key := datastore.NewKey(c, "Score", "", sID, nil)
+	key := repository.NewKey("Score", "", sID)
 	var scores []int64
 	s := &Score{sID, userID, tournamentId, scores}
-	if _, err = datastore.Put(c, key, s); err != nil {
+	if _, err = repository.Put(c, key, s); err != nil {
 		return nil, err
 	}
 	return s, nil
@@ -77,16 +77,16 @@ func CreateScore(c appengine.Context, userID int64, tournamentId int64) (*Score,
 
 // CreateScores creates a Score entity.
 //
-func CreateScores(c appengine.Context, userIDs []int64, tournamentId int64) ([]*Score, []*datastore.Key, error) {
-	var keys []*datastore.Key
+func CreateScores(c appengine.Context, userIDs []int64, tournamentId int64) ([]*Score, []*repository.Key, error) {
+	var keys []*repository.Key
 	var scoreEntities []*Score
 
 	for _, id := range userIDs {
-		sID, _, err := datastore.AllocateIDs(c, "Score", nil, 1)
+		sID, _, err := repository.AllocateIDs(c, "Score", 1)
 		if err != nil {
 			return nil, nil, err
 		}
-		k := datastore.NewKey(c, "Score", "", sID, nil)
+		k := repository.NewKey("Score", "", sID)
 		keys = append(keys, k)
 
 		var scores []int64
@@ -99,10 +99,15 @@ func CreateScores(c appengine.Context, userIDs []int64, tournamentId int64) ([]*
 
 // SaveScores saves an array of scores to the datastore.
 //
-func SaveScores(c appengine.Context, scores []*Score, keys []*datastore.Key) error {
-	if _, err := datastore.PutMulti(c, keys, scores); err != nil {
+func SaveScores(c appengine.Context, scores []*Score, keys []*repository.Key) error {
+	if _, err := repository.PutMulti(c, keys, scores); err != nil {
 		return err
 	}
+	ids := make([]int64, len(scores))
+	for i := range scores {
+		ids[i] = scores[i].Id
+	}
+	changed(c, "Score", ids...)
 	return nil
 }
 
@@ -133,13 +138,16 @@ func AddScores(c appengine.Context, tournamentScores []*Score, scores []int64) e
 // UpdateScores updates an array of scores.
 //
 func UpdateScores(c appengine.Context, scores []*Score) error {
-	keys := make([]*datastore.Key, len(scores))
+	keys := make([]*repository.Key, len(scores))
+	ids := make([]int64, len(scores))
 	for i := range keys {
 		keys[i] = ScoreKeyByID(c, scores[i].Id)
+		ids[i] = scores[i].Id
 	}
-	if _, err := datastore.PutMulti(c, keys, scores); err != nil {
+	if _, err := repository.PutMulti(c, keys, scores); err != nil {
 		return err
 	}
+	changed(c, "Score", ids...)
 	return nil
 }
 
@@ -148,19 +156,20 @@ func UpdateScores(c appengine.Context, scores []*Score) error {
 func (s *Score) Update(c appengine.Context) error {
 	k := ScoreKeyByID(c, s.Id)
 	oldScore := new(Score)
-	if err := datastore.Get(c, k, oldScore); err == nil {
-		if _, err = datastore.Put(c, k, s); err != nil {
+	if err := repository.Get(c, k, oldScore); err == nil {
+		if _, err = repository.Put(c, k, s); err != nil {
 			log.Errorf(c, "Score.Update: error at Put, %v", err)
 			return err
 		}
+		changed(c, "Score", s.Id)
 	}
 	return nil
 }
 
 // ScoreKeyByID gets a score key given an id.
 //
-func ScoreKeyByID(c appengine.Context, id int64) *datastore.Key {
-	key := datastore.NewKey(c, "Score", "", id, nil)
+func ScoreKeyByID(c appengine.Context, id int64) *repository.Key {
+	key := repository.NewKey("Score", "", id)
 	return key
 }
 
@@ -168,7 +177,7 @@ func ScoreKeyByID(c appengine.Context, id int64) *datastore.Key {
 //
 func ScoreByUserTournament(c appengine.Context, userID interface{}, tournamentId interface{}) []*Score {
 
-	q := datastore.NewQuery("Score").
+	q := repository.NewQuery("Score").
 		Filter("UserId"+" =", userID).
 		Filter("TournamentId"+" =", tournamentId)
 
@@ -186,9 +195,9 @@ func ScoreByUserTournament(c appengine.Context, userID interface{}, tournamentId
 //
 func ScoreByID(c appengine.Context, id int64) (*Score, error) {
 	var s Score
-	key := datastore.NewKey(c, "Score", "", id, nil)
+	key := repository.NewKey("Score", "", id)
 
-	if err := datastore.Get(c, key, &s); err != nil {
+	if err := repository.Get(c, key, &s); err != nil {
 		log.Errorf(c, "ScoreById: Score not found : %v", err)
 		return &s, err
 	}
@@ -20,6 +20,7 @@ import (
 	"math"
 	"sort"
 	"strings"
+	"unicode"
 
 	"appengine"
 
@@ -27,160 +28,540 @@ import (
 	"github.com/taironas/gonawin/helpers/log"
 )
 
-// TournamentScore computes a score vector, given a query string and an array of ids,
-// that has the doc ids and the score of each id with respect to the query.
+// SearchResult holds an entity found by the search engine and its score with respect to the query.
 //
-func TournamentScore(c appengine.Context, query string, ids []int64) []int64 {
-
-	words := strings.Split(query, " ")
-	setOfWords := helpers.SetOfStrings(query)
-	nbTournamentWords, _ := TournamentInvertedIndexGetWordCount(c)
-
-	// query vector
-	q := make([]float64, len(setOfWords))
-	for i, w := range setOfWords {
-		dft := 0
-		if invID, err := FindTournamentInvertedIndex(c, "KeyName", w); err != nil {
-			log.Errorf(c, " search.TournamentScore, unable to find KeyName=%s: %v", w, err)
-		} else if invID != nil {
-			dft = len(strings.Split(string(invID.TournamentIds), " "))
-		}
-		q[i] = math.Log10(1+float64(helpers.CountTerm(words, w))) * math.Log10(float64(nbTournamentWords+1)/float64(dft+1))
-	}
-
-	// d vector
-	dVect := make([][]float64, len(ids))
-	for i, id := range ids {
-		d := make([]float64, len(setOfWords))
-		for j, wi := range setOfWords {
-			// get word frequency by tournament (id, wi)
-			wordFreqByTournament := GetWordFrequencyForTournament(c, id, wi)
-			// get number of tournaments with word (wi)
-			tournamentFreqForWord, err := GetTournamentFrequencyForWord(c, wi)
-			if err != nil {
-				log.Errorf(c, " search.TournamentScore, error occurred when getting tournament frequency for word=%s: %v", wi, err)
-			}
+type SearchResult struct {
+	Kind  string
+	Id    int64
+	Score float64
+}
+
+// SearchResultByScore type used to sort search results by descending score.
+//
+type SearchResultByScore []SearchResult
+
+func (a SearchResultByScore) Len() int           { return len(a) }
+func (a SearchResultByScore) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a SearchResultByScore) Less(i, j int) bool { return a[i].Score > a[j].Score }
+
+// Search matching parameters.
+//
+// Query words of at least SearchMinPrefixLength letters also match the indexed words they
+// are a prefix of, at most SearchMaxExpansions of them. Query words of at least 4 letters
+// match the indexed words within 1 typo, 2 typos from 8 letters, amongst SearchFuzzyCandidates
+// indexed words for each of the prefixes returned by fuzzyPrefixes.
+//
+const (
+	SearchMinPrefixLength = 2
+	SearchMaxExpansions   = 20
+	SearchFuzzyCandidates = 200
+)
+
+// weights of the matches of an indexed word with respect to a query word.
+const (
+	searchExactWeight  = 1.0
+	searchPrefixWeight = 0.8
+	searchFuzzyWeight  = 0.5
+)
+
+// searchTerm holds a word of a query, its number of occurrences in the query and the indexed words matching it.
+//
+type searchTerm struct {
+	word    string
+	count   int64
+	matches map[string]searchMatch
+}
+
+// searchMatch holds the ids of the entities using an indexed word matching a query word and the weight of the match.
+//
+type searchMatch struct {
+	ids    []int64
+	weight float64
+}
 
-			d[j] = math.Log10(float64(1+wordFreqByTournament)) * math.Log10(float64(nbTournamentWords+1)/float64(tournamentFreqForWord+1))
+// Search looks for the entities of the given kinds that match all the words of the query.
+// The results of all kinds are merged and ranked by descending score.
+// If no kind is given, all the kinds registered with the search engine are searched.
+//
+// Words are matched accent and case insensitive, after stemming. A query word also matches
+// the indexed words it is a prefix of and the indexed words within a few typos, exact matches
+// weighting more than prefix matches which weight more than typo tolerant matches.
+//
+func Search(c appengine.Context, query string, kinds ...string) ([]SearchResult, error) {
+
+	if len(kinds) == 0 {
+		kinds = SearchKinds()
+	}
+
+	var results []SearchResult
+	for _, kind := range kinds {
+		k, err := searchKind(kind)
+		if err != nil {
+			return nil, err
+		}
+
+		var terms []searchTerm
+		if terms, err = searchTerms(c, k, query); err != nil {
+			return nil, err
+		}
+
+		for _, p := range sortMapByValueDesc(scores(c, k, terms, matchingIds(terms))) {
+			results = append(results, SearchResult{kind, p.Key, p.Value})
 		}
-		dVect[i] = make([]float64, len(setOfWords))
-		dVect[i] = d
 	}
 
-	// compute score vector
-	var score map[int64]float64
-	score = make(map[int64]float64)
-	for i, dVectIndex := range dVect {
-		score[ids[i]] = dotProduct(dVectIndex, q)
+	sort.Stable(SearchResultByScore(results))
+	return results, nil
+}
+
+// SearchIds returns the ids of the entities of a kind that match all the words of the query,
+// sorted by descending score.
+//
+func SearchIds(c appengine.Context, kind string, query string) ([]int64, error) {
+
+	results, err := Search(c, query, kind)
+	if err != nil {
+		return nil, err
 	}
 
-	sortedScore := sortMapByValueDesc(score)
+	ids := make([]int64, len(results))
+	for i, r := range results {
+		ids[i] = r.Id
+	}
+	return ids, nil
+}
 
-	return getKeysFrompairList(sortedScore)
+// searchTerms returns the terms of a query with the indexed words of a kind matching them.
+//
+func searchTerms(c appengine.Context, k *SearchKind, query string) ([]searchTerm, error) {
+
+	var terms []searchTerm
+	positions := make(map[string]int)
+	for _, folded := range normalizeText(query) {
+		word := stem(folded)
+		if i, ok := positions[word]; ok {
+			terms[i].count++
+			continue
+		}
+
+		matches, err := searchMatches(c, k, word, folded)
+		if err != nil {
+			return nil, err
+		}
+		positions[word] = len(terms)
+		terms = append(terms, searchTerm{word, 1, matches})
+	}
+	return terms, nil
 }
 
-// TeamScore computes a score vector, given a query string and an array of ids,
-//  that has the doc ids and the score of each id with respect to the query.
+// searchMatches returns the indexed words of a kind matching a query word, given its stem and its folded form.
 //
-func TeamScore(c appengine.Context, query string, ids []int64) []int64 {
+func searchMatches(c appengine.Context, k *SearchKind, word string, folded string) (map[string]searchMatch, error) {
 
-	words := strings.Split(query, " ")
-	setOfWords := helpers.SetOfStrings(query)
-	nbTeamWords, _ := TeamInvertedIndexGetWordCount(c)
+	weights := map[string]float64{word: searchExactWeight}
+	add := func(words []string, weight float64) {
+		for _, w := range words {
+			if weights[w] < weight {
+				weights[w] = weight
+			}
+		}
+	}
 
-	// query vector
-	q := make([]float64, len(setOfWords))
-	for i, w := range setOfWords {
-		dft := 0
-		if invID, err := FindTeamInvertedIndex(c, "KeyName", w); err != nil {
-			log.Errorf(c, " search.TeamScore, unable to find KeyName=%s: %v", w, err)
-		} else if invID != nil {
-			dft = len(strings.Split(string(invID.TeamIds), " "))
+	if len([]rune(folded)) >= SearchMinPrefixLength {
+		words, err := wordsByPrefix(c, k, folded, SearchMaxExpansions)
+		if err != nil {
+			return nil, err
 		}
-		q[i] = math.Log10(1+float64(helpers.CountTerm(words, w))) * math.Log10(float64(nbTeamWords+1)/float64(dft+1))
+		add(words, searchPrefixWeight)
 	}
 
-	// d vector
-	dVect := make([][]float64, len(ids))
-	for i, id := range ids {
-		d := make([]float64, len(setOfWords))
-		for j, wi := range setOfWords {
-			// get word frequency by team (id, wi)
-			wordFreqByTeam := GetWordFrequencyForTeam(c, id, wi)
-			// get number of teams with word (wi)
-			teamFreqForWord, err := GetTeamFrequencyForWord(c, wi)
+	if max := maxEdits(word); max > 0 {
+		for _, prefix := range fuzzyPrefixes(word) {
+			candidates, err := wordsByPrefix(c, k, prefix, SearchFuzzyCandidates)
 			if err != nil {
-				log.Errorf(c, " search.TeamScore, error occurred when getting team frequency for word=%s: %v", wi, err)
+				return nil, err
+			}
+			var words []string
+			for _, w := range candidates {
+				if editDistance(word, w) <= max {
+					words = append(words, w)
+				}
+			}
+			add(words, searchFuzzyWeight)
+		}
+	}
+
+	var words []string
+	for w := range weights {
+		words = append(words, w)
+	}
+	postings, err := wordPostings(c, k, words)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make(map[string]searchMatch)
+	for w, ids := range postings {
+		matches[w] = searchMatch{ids, weights[w]}
+	}
+	return matches, nil
+}
+
+// fuzzyPrefixes returns the prefixes of the indexed words looked for within a few typos of a word of at least 3 letters.
+// The first two letters of the word keep the candidates few when many words start with the same letter.
+// The first and third letters find the words missing the second letter of the word, the first two letters swapped
+// find the words they are swapped in, and the first letter alone finds the other typos amongst the first candidates.
+//
+func fuzzyPrefixes(word string) []string {
+	r := []rune(word)
+	var prefixes []string
+	seen := make(map[string]bool)
+	for _, p := range []string{string(r[:2]), string([]rune{r[0], r[2]}), string([]rune{r[1], r[0]}), string(r[:1])} {
+		if !seen[p] {
+			seen[p] = true
+			prefixes = append(prefixes, p)
+		}
+	}
+	return prefixes
+}
+
+// matchingIds returns the ids of the entities matching all the terms.
+//
+func matchingIds(terms []searchTerm) []int64 {
+
+	var ids []int64
+	for i, t := range terms {
+		set := make(map[int64]bool)
+		for _, m := range t.matches {
+			for _, id := range m.ids {
+				set[id] = true
+			}
+		}
+
+		if i == 0 {
+			for id := range set {
+				ids = append(ids, id)
 			}
+			continue
+		}
 
-			d[j] = math.Log10(float64(1+wordFreqByTeam)) * math.Log10(float64(nbTeamWords+1)/float64(teamFreqForWord+1))
+		var intersect []int64
+		for _, id := range ids {
+			if set[id] {
+				intersect = append(intersect, id)
+			}
 		}
-		dVect[i] = make([]float64, len(setOfWords))
-		dVect[i] = d
+		ids = intersect
 	}
+	return ids
+}
 
-	// compute score vector
-	var score map[int64]float64
-	score = make(map[int64]float64)
-	for i, dVectIndex := range dVect {
-		score[ids[i]] = dotProduct(dVectIndex, q)
+// Search sort options, relevance being the default.
+//
+const (
+	SearchSortRelevance = "relevance"
+	SearchSortMembers   = "members"
+	SearchSortAccuracy  = "accuracy"
+	SearchSortCreated   = "created"
+)
+
+// SearchFacets holds, for each facet of a search, the number of results by value of the facet.
+//
+type SearchFacets map[string]map[string]int64
+
+// add counts a result in the given value of a facet.
+//
+func (f SearchFacets) add(facet string, value string) {
+	if f[facet] == nil {
+		f[facet] = make(map[string]int64)
 	}
+	f[facet][value]++
+}
 
-	sortedScore := sortMapByValueDesc(score)
+// searchPageBounds returns the bounds of a page of results, given the total number of results,
+// the number of results by page and the page number starting at 1.
+//
+func searchPageBounds(total int64, count int64, page int64) (int64, int64) {
+	if count <= 0 || page <= 0 {
+		return 0, 0
+	}
+	from := count * (page - 1)
+	if from > total {
+		from = total
+	}
+	to := from + count
+	if to > total {
+		to = total
+	}
+	return from, to
+}
 
-	return getKeysFrompairList(sortedScore)
+// SearchResultsPage returns a page of the search results, given the number of results by page
+// and the page number starting at 1.
+//
+func SearchResultsPage(results []SearchResult, count int64, page int64) []SearchResult {
+	from, to := searchPageBounds(int64(len(results)), count, page)
+	return results[from:to]
 }
 
-// UserScore computes a score vector, given a query string and an array of ids,
+// scores computes a score vector, given the terms of a query and an array of ids of a kind,
 // that has the doc ids and the score of each id with respect to the query.
+// Each term of a document is weighted with the tf-idf of the best indexed word matching
+// it times the weight of the match, the term frequency of a document being the sum of the
+// frequencies of the word in each indexed field times the weight of the field.
 //
-func UserScore(c appengine.Context, query string, ids []int64) []int64 {
-
-	words := strings.Split(query, " ")
-	setOfWords := helpers.SetOfStrings(query)
-	nbUserWords, _ := UserInvertedIndexGetWordCount(c)
-
-	// query vector
-	q := make([]float64, len(setOfWords))
-	for i, w := range setOfWords {
-		dft := 0
-		if invID, err := FindUserInvertedIndex(c, "KeyName", w); err != nil {
-			log.Errorf(c, "search.UserScore, unable to find KeyName=%s: %v", w, err)
-		} else if invID != nil {
-			dft = len(strings.Split(string(invID.UserIds), " "))
-		}
-		q[i] = math.Log10(1+float64(helpers.CountTerm(words, w))) * math.Log10(float64(nbUserWords+1)/float64(dft+1))
-	}
-
-	// d vector
-	dVect := make([][]float64, len(ids))
-	for i, id := range ids {
-		d := make([]float64, len(setOfWords))
-		for j, wi := range setOfWords {
-			// get word frequency by user (id, wi)
-			wordFreqByUser := GetWordFrequencyForUser(c, id, wi)
-			// get number of users with word (wi)
-			userFreqForWord, err := GetUserFrequencyForWord(c, wi)
-			if err != nil {
-				log.Errorf(c, " search.UserScore, error occurred when getting user frequency for word=%s: %v", wi, err)
+func scores(c appengine.Context, k *SearchKind, terms []searchTerm, ids []int64) map[int64]float64 {
+
+	score := make(map[int64]float64)
+	if len(ids) == 0 {
+		return score
+	}
+
+	nbWords, err := InvertedIndexWordCount(c, k.Name)
+	if err != nil {
+		log.Errorf(c, " search.scores, unable to get %s word count: %v", k.Name, err)
+	}
+
+	// query vector and inverse document frequency of the matching words
+	q := make([]float64, len(terms))
+	idf := make(map[string]float64)
+	for i, t := range terms {
+		q[i] = math.Log10(1 + float64(t.count))
+		for w, m := range t.matches {
+			idf[w] = 1 + math.Log10(float64(nbWords+1)/float64(len(m.ids)+1))
+		}
+	}
+
+	// d vectors and score
+	documents := make(map[int64][]string)
+	searchBatches(ids, func(batch []int64) error {
+		for id, values := range k.Documents(c, batch) {
+			documents[id] = values
+		}
+		return nil
+	})
+	for _, id := range ids {
+		values, ok := documents[id]
+		if !ok {
+			continue
+		}
+		tokens := documentTokens(values)
+		d := make([]float64, len(terms))
+		for i, t := range terms {
+			for w, m := range t.matches {
+				if di := m.weight * math.Log10(1+termFrequency(k, tokens, w)) * idf[w]; di > d[i] {
+					d[i] = di
+				}
+			}
+		}
+		score[id] = dotProduct(d, q)
+	}
+
+	return score
+}
+
+// searchBatches calls f with the ids by batches of at most searchBatchSize ids, so that the entities
+// of a search are loaded by datastore calls of a bounded size. It stops at the first error of f.
+//
+func searchBatches(ids []int64, f func(batch []int64) error) error {
+	for len(ids) > 0 {
+		n := len(ids)
+		if n > searchBatchSize {
+			n = searchBatchSize
+		}
+		if err := f(ids[:n]); err != nil {
+			return err
+		}
+		ids = ids[n:]
+	}
+	return nil
+}
+
+// termFrequency returns the weighted frequency of a word in the tokens of the indexed fields of a document.
+//
+func termFrequency(k *SearchKind, tokens [][]string, word string) float64 {
+	var tf float64
+	for i, f := range k.Fields {
+		if i < len(tokens) {
+			tf += f.Weight * float64(helpers.CountTerm(tokens[i], word))
+		}
+	}
+	return tf
+}
+
+// documentTokens returns the tokens of each value of the indexed fields of a document.
+//
+func documentTokens(values []string) [][]string {
+	tokens := make([][]string, len(values))
+	for i, v := range values {
+		tokens[i] = searchTokens(v)
+	}
+	return tokens
+}
+
+// searchTokens splits a text in normalized and stemmed words, the words stored in the inverted indexes.
+//
+func searchTokens(text string) []string {
+	words := normalizeText(text)
+	for i, w := range words {
+		words[i] = stem(w)
+	}
+	return words
+}
+
+// searchWord returns the normalized and stemmed form of a word.
+//
+func searchWord(word string) string {
+	if words := searchTokens(word); len(words) > 0 {
+		return words[0]
+	}
+	return ""
+}
+
+// diacritics maps the letters with diacritics and the ligatures to their ascii form.
+var diacritics = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'œ': "oe", 'þ': "th", 'ð': "d", 'ø': "o", 'đ': "d", 'ħ': "h", 'ı': "i", 'ł': "l", 'ŧ': "t",
+}
+
+func init() {
+	letters := map[string]string{
+		"a": "àáâãäåāăą",
+		"c": "çćĉċč",
+		"d": "ď",
+		"e": "èéêëēĕėęě",
+		"g": "ĝğġģ",
+		"h": "ĥ",
+		"i": "ìíîïĩīĭį",
+		"j": "ĵ",
+		"k": "ķ",
+		"l": "ĺļľŀ",
+		"n": "ñńņňŉ",
+		"o": "òóôõöōŏő",
+		"r": "ŕŗř",
+		"s": "śŝşšș",
+		"t": "ţťț",
+		"u": "ùúûüũūŭůűų",
+		"w": "ŵ",
+		"y": "ýÿŷ",
+		"z": "źżž",
+	}
+	for ascii, runes := range letters {
+		for _, r := range runes {
+			diacritics[r] = ascii
+		}
+	}
+}
+
+// normalizeText lower cases a text, folds its diacritics and splits it in words.
+// Combining marks are dropped, apostrophes are removed and any other character
+// which is not a letter or a digit separates words.
+//
+func normalizeText(text string) []string {
+	folded := make([]rune, 0, len(text))
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.Is(unicode.Mn, r), r == '\'', r == '’':
+			continue
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if s, ok := diacritics[r]; ok {
+				folded = append(folded, []rune(s)...)
+			} else {
+				folded = append(folded, r)
 			}
+		default:
+			folded = append(folded, ' ')
+		}
+	}
+	return strings.Fields(string(folded))
+}
 
-			d[j] = math.Log10(float64(1+wordFreqByUser)) * math.Log10(float64(nbUserWords+1)/float64(userFreqForWord+1))
+// stem removes the common english plural and verb suffixes of a word,
+// so that "gunners" and "gunner" or "playing" and "played" share the same stem.
+//
+func stem(w string) string {
+	switch {
+	case strings.HasSuffix(w, "sses"):
+		w = w[:len(w)-2]
+	case strings.HasSuffix(w, "ies") && len(w) > 4:
+		w = w[:len(w)-3] + "y"
+	case strings.HasSuffix(w, "ss"), strings.HasSuffix(w, "us"), strings.HasSuffix(w, "is"):
+	case strings.HasSuffix(w, "s") && len(w) > 3:
+		w = w[:len(w)-1]
+	}
+
+	for _, suffix := range []string{"ing", "ed"} {
+		if strings.HasSuffix(w, suffix) && len(w)-len(suffix) >= 4 && hasVowel(w[:len(w)-len(suffix)]) {
+			w = undouble(w[:len(w)-len(suffix)])
+			break
 		}
-		dVect[i] = make([]float64, len(setOfWords))
-		dVect[i] = d
 	}
+	return w
+}
+
+func hasVowel(w string) bool {
+	return strings.ContainsAny(w, "aeiouy")
+}
+
+// undouble removes the last letter of a word ending with a double consonant, except l, s and z.
+//
+func undouble(w string) string {
+	n := len(w)
+	if n > 1 && w[n-1] == w[n-2] && !strings.ContainsRune("aeiouylsz", rune(w[n-1])) {
+		return w[:n-1]
+	}
+	return w
+}
 
-	// compute score vector
-	var score map[int64]float64
-	score = make(map[int64]float64)
-	for i, dVectIndex := range dVect {
-		score[ids[i]] = dotProduct(dVectIndex, q)
+// maxEdits returns the number of typos tolerated for a query word.
+//
+func maxEdits(w string) int {
+	switch n := len([]rune(w)); {
+	case n >= 8:
+		return 2
+	case n >= 4:
+		return 1
 	}
+	return 0
+}
 
-	sortedScore := sortMapByValueDesc(score)
+// editDistance returns the Damerau-Levenshtein distance between two words: the number of
+// insertions, deletions, substitutions and transpositions of adjacent letters needed to go from one to the other.
+//
+func editDistance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	d := make([][]int, len(s)+1)
+	for i := range d {
+		d[i] = make([]int, len(t)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			d[i][j] = minInt(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				d[i][j] = minInt(d[i][j], d[i-2][j-2]+cost)
+			}
+		}
+	}
+	return d[len(s)][len(t)]
+}
 
-	return getKeysFrompairList(sortedScore)
+// minInt returns the smallest of the given integers.
+//
+func minInt(first int, others ...int) int {
+	m := first
+	for _, o := range others {
+		if o < m {
+			m = o
+		}
+	}
+	return m
 }
 
 // A data structure to hold a key/value pair.
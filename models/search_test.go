@@ -0,0 +1,384 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"appengine/aetest"
+
+	"github.com/taironas/gonawin/helpers/memcache"
+	"github.com/taironas/gonawin/repository"
+)
+
+// TestSearch tests that you can search several kinds at once and get ranked results.
+//
+func TestSearch(t *testing.T) {
+	var c aetest.Context
+	var err error
+	options := aetest.Options{StronglyConsistentDatastore: true}
+
+	if c, err = aetest.NewContext(&options); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var team, otherTeam *Team
+	if team, err = CreateTeam(c, "gunners gunners", "description", 10, false); err != nil {
+		t.Fatal(err)
+	}
+	if otherTeam, err = CreateTeam(c, "london gunners", "description", 10, false); err != nil {
+		t.Fatal(err)
+	}
+	var zurich *Team
+	if zurich, err = CreateTeam(c, "Zürich Lions", "description", 10, false); err != nil {
+		t.Fatal(err)
+	}
+	var user *User
+	if user, err = CreateUser(c, "foo@foo.com", "gunners", "john gunners", "", false, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		title string
+		query string
+		kinds []string
+		want  []SearchResult
+	}{
+		{
+			title: "can search a single kind",
+			query: "london",
+			kinds: []string{TeamSearchKind},
+			want:  []SearchResult{{Kind: TeamSearchKind, Id: otherTeam.Id}},
+		},
+		{
+			title: "can search all kinds",
+			query: "gunners",
+			want: []SearchResult{
+				{Kind: TeamSearchKind, Id: team.Id},
+				{Kind: TeamSearchKind, Id: otherTeam.Id},
+				{Kind: UserSearchKind, Id: user.Id},
+			},
+		},
+		{
+			title: "all words of the query must match",
+			query: "john london",
+		},
+		{
+			title: "can search without accents",
+			query: "zurich",
+			kinds: []string{TeamSearchKind},
+			want:  []SearchResult{{Kind: TeamSearchKind, Id: zurich.Id}},
+		},
+		{
+			title: "can search by prefix",
+			query: "zür",
+			kinds: []string{TeamSearchKind},
+			want:  []SearchResult{{Kind: TeamSearchKind, Id: zurich.Id}},
+		},
+		{
+			title: "can search the singular of a word",
+			query: "lion",
+			kinds: []string{TeamSearchKind},
+			want:  []SearchResult{{Kind: TeamSearchKind, Id: zurich.Id}},
+		},
+		{
+			title: "can search with a typo",
+			query: "lodnon",
+			kinds: []string{TeamSearchKind},
+			want:  []SearchResult{{Kind: TeamSearchKind, Id: otherTeam.Id}},
+		},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+		var got []SearchResult
+		if got, err = Search(c, test.query, test.kinds...); err != nil {
+			t.Errorf("test %v - Error: %v", i, err)
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("test %v - Error: want %v results, got %v", i, len(test.want), len(got))
+			continue
+		}
+		for _, w := range test.want {
+			if !containsSearchResult(got, w) {
+				t.Errorf("test %v - Error: want %v %v in results, got %v", i, w.Kind, w.Id, got)
+			}
+		}
+		for j := 1; j < len(got); j++ {
+			if got[j-1].Score < got[j].Score {
+				t.Errorf("test %v - Error: results not sorted by score: %v", i, got)
+			}
+		}
+	}
+}
+
+// TestUpdateInvertedIndex tests that updating an entity updates its indexed words.
+//
+func TestUpdateInvertedIndex(t *testing.T) {
+	var c aetest.Context
+	var err error
+	options := aetest.Options{StronglyConsistentDatastore: true}
+
+	if c, err = aetest.NewContext(&options); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var team *Team
+	if team, err = CreateTeam(c, "old name", "description", 10, false); err != nil {
+		t.Fatal(err)
+	}
+	team.Name = "new name"
+	if err = team.Update(c); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		title string
+		word  string
+		want  int
+	}{
+		{"removed word is no longer indexed", "old", 0},
+		{"added word is indexed", "new", 1},
+		{"kept word is still indexed", "name", 1},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+		var ids []int64
+		if ids, err = InvertedIndexes(c, TeamSearchKind, []string{test.word}); err != nil {
+			t.Errorf("test %v - Error: %v", i, err)
+		}
+		if len(ids) != test.want {
+			t.Errorf("test %v - Error: want %v ids, got %v", i, test.want, ids)
+		}
+	}
+}
+
+func containsSearchResult(results []SearchResult, r SearchResult) bool {
+	for _, got := range results {
+		if got.Kind == r.Kind && got.Id == r.Id {
+			return true
+		}
+	}
+	return false
+}
+
+// TestSearchTokens tests that texts are normalized, folded and stemmed.
+//
+func TestSearchTokens(t *testing.T) {
+	tests := []struct {
+		title string
+		text  string
+		want  []string
+	}{
+		{"lower cases words", "London Gunners", []string{"london", "gunner"}},
+		{"folds diacritics", "Zürich São Ærø Straße", []string{"zurich", "sao", "aero", "strasse"}},
+		{"drops combining marks", "Cafe\u0301", []string{"cafe"}},
+		{"splits on punctuation", "o'neil-united", []string{"oneil", "unit"}},
+		{"stems words", "cities playing running class", []string{"city", "play", "run", "class"}},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+		got := searchTokens(test.text)
+		if strings.Join(got, " ") != strings.Join(test.want, " ") {
+			t.Errorf("test %v - Error: want %v, got %v", i, test.want, got)
+		}
+	}
+}
+
+// TestEditDistance tests the number of typos between two words.
+//
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"gunner", "gunner", 0},
+		{"gunner", "guner", 1},
+		{"london", "lodnon", 1},
+		{"zurich", "zuric", 1},
+		{"lions", "tigers", 4},
+	}
+
+	for i, test := range tests {
+		if got := editDistance(test.a, test.b); got != test.want {
+			t.Errorf("test %v - Error: editDistance(%v, %v) want %v, got %v", i, test.a, test.b, test.want, got)
+		}
+	}
+}
+
+// TestSearchFuzzyCandidates tests that words with a typo are found amongst more indexed words
+// starting with the same letter than SearchFuzzyCandidates.
+//
+func TestSearchFuzzyCandidates(t *testing.T) {
+	repository.Use(repository.NewMemory())
+	defer repository.Use(repository.Datastore)
+	memcache.Use(memcache.NewMemory())
+
+	c := repository.NewLocalContext(nil)
+
+	k, err := searchKind(TeamSearchKind)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	words := []string{stem("gunners")}
+	for i := 0; i < 2*SearchFuzzyCandidates; i++ {
+		words = append(words, fmt.Sprintf("ga%04d", i))
+	}
+	if err = updatePostings(c, k, 1, words, nil); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	tests := []struct {
+		title string
+		query string
+	}{
+		{"typo after the first two letters", "gunnres"},
+		{"first two letters swapped", "ugnners"},
+		{"extra second letter", "gaunners"},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+		matches, err := searchMatches(c, k, stem(test.query), test.query)
+		if err != nil {
+			t.Fatalf("test %v - Error: %v", i, err)
+		}
+		if _, ok := matches[stem("gunners")]; !ok {
+			t.Errorf("test %v - Error: want %s to match gunners, got %v", i, test.query, matches)
+		}
+	}
+}
+
+// TestSearchBatches tests that the ids of a search are loaded by batches of at most searchBatchSize ids.
+//
+func TestSearchBatches(t *testing.T) {
+	tests := []struct {
+		title string
+		ids   int
+		want  []int
+	}{
+		{"no ids", 0, nil},
+		{"a single batch", searchBatchSize, []int{searchBatchSize}},
+		{"more ids than a batch", 2*searchBatchSize + 1, []int{searchBatchSize, searchBatchSize, 1}},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+		ids := make([]int64, test.ids)
+		for j := range ids {
+			ids[j] = int64(j + 1)
+		}
+		var got []int
+		var next int64 = 1
+		searchBatches(ids, func(batch []int64) error {
+			got = append(got, len(batch))
+			for _, id := range batch {
+				if id != next {
+					t.Errorf("test %v - Error: want id %d, got %d", i, next, id)
+				}
+				next++
+			}
+			return nil
+		})
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("test %v - Error: want batches %v, got %v", i, test.want, got)
+		}
+	}
+}
+
+// TestSearchTeams tests that you can filter, sort and page the teams of a search.
+//
+func TestSearchTeams(t *testing.T) {
+	var c aetest.Context
+	var err error
+	options := aetest.Options{StronglyConsistentDatastore: true}
+
+	if c, err = aetest.NewContext(&options); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var public, private, joined *Team
+	if public, err = CreateTeam(c, "lions", "description", 10, false); err != nil {
+		t.Fatal(err)
+	}
+	if private, err = CreateTeam(c, "lions club", "description", 10, true); err != nil {
+		t.Fatal(err)
+	}
+	if joined, err = CreateTeam(c, "lions united", "description", 20, false); err != nil {
+		t.Fatal(err)
+	}
+	if err = joined.AddUserID(c, 20); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		title      string
+		opts       TeamSearchOptions
+		wantIDs    []int64
+		wantTotal  int64
+		wantFacets SearchFacets
+	}{
+		{
+			title:     "can filter public teams",
+			opts:      TeamSearchOptions{Visibility: TeamSearchPublic, Sort: SearchSortCreated, Count: 10, Page: 1},
+			wantIDs:   []int64{joined.Id, public.Id},
+			wantTotal: 2,
+			wantFacets: SearchFacets{
+				"Visibility": {TeamSearchPublic: 2, TeamSearchPrivate: 1},
+			},
+		},
+		{
+			title:     "can filter the teams the user is not a member of",
+			opts:      TeamSearchOptions{UserId: 20, NotMember: true, Sort: SearchSortCreated, Count: 10, Page: 1},
+			wantIDs:   []int64{private.Id, public.Id},
+			wantTotal: 2,
+			wantFacets: SearchFacets{
+				"Visibility": {TeamSearchPublic: 2, TeamSearchPrivate: 1},
+				"Membership": {TeamSearchMember: 1, TeamSearchNotMember: 2},
+			},
+		},
+		{
+			title:     "can sort by members and page the teams",
+			opts:      TeamSearchOptions{Sort: SearchSortMembers, Count: 1, Page: 1},
+			wantIDs:   []int64{joined.Id},
+			wantTotal: 3,
+		},
+		{
+			title:     "can get an empty page",
+			opts:      TeamSearchOptions{Count: 10, Page: 2},
+			wantTotal: 3,
+		},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+		teams, total, facets, err := SearchTeams(c, "lions", test.opts)
+		if err != nil {
+			t.Errorf("test %v - Error: %v", i, err)
+		}
+		if total != test.wantTotal {
+			t.Errorf("test %v - Error: want total %v, got %v", i, test.wantTotal, total)
+		}
+		if len(teams) != len(test.wantIDs) {
+			t.Errorf("test %v - Error: want %v teams, got %v", i, len(test.wantIDs), len(teams))
+			continue
+		}
+		for j, team := range teams {
+			if team.Id != test.wantIDs[j] {
+				t.Errorf("test %v - Error: want team %v == %v, got %v", i, j, test.wantIDs[j], team.Id)
+			}
+		}
+		for facet, values := range test.wantFacets {
+			for value, count := range values {
+				if facets[facet][value] != count {
+					t.Errorf("test %v - Error: want facet %v %v == %v, got %v", i, facet, value, count, facets[facet][value])
+				}
+			}
+		}
+	}
+}
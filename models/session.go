@@ -0,0 +1,233 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"appengine"
+
+	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/repository"
+)
+
+const (
+	// SessionLifetime is the duration after which an unused session expires.
+	SessionLifetime = 30 * 24 * time.Hour
+	// SessionRefreshInterval is the minimum duration between two refreshes of the expiry of a session.
+	SessionRefreshInterval = time.Hour
+	// maxSessionDeviceLength is the maximum length of the device name stored with a session.
+	maxSessionDeviceLength = 200
+	// sessionBatchSize is the maximum number of sessions deleted in a single datastore call.
+	sessionBatchSize = 500
+)
+
+// ErrSessionExpired is returned when a session token matches an expired session.
+//
+var ErrSessionExpired = errors.New("model/session: session expired")
+
+// Session represents a signed in device of a user.
+//
+// The token given to the device is never stored, the session is keyed by the hash of the token.
+// A session expires after SessionLifetime without being used.
+//
+type Session struct {
+	Id        int64
+	UserId    int64
+	TokenHash string `json:"-"` // hash of the token of the session, also the key of the session.
+	Device    string // user agent of the device which signed in.
+	Created   time.Time
+	LastUsed  time.Time
+	Expires   time.Time
+}
+
+// CreateSession creates a session for a user signing in from a device.
+// It returns the session and its token, to be sent in the Authorization header of the requests.
+//
+func CreateSession(c appengine.Context, userID int64, device string) (*Session, string, error) {
+	b := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		log.Errorf(c, "Session.Create: unable to generate token: %v", err)
+		return nil, "", err
+	}
+	token := fmt.Sprintf("%x", b)
+
+	id, _, err := repository.AllocateIDs(c, "Session", 1)
+	if err != nil {
+		log.Errorf(c, "Session.Create: %v", err)
+		return nil, "", err
+	}
+
+	if len(device) > maxSessionDeviceLength {
+		device = device[:maxSessionDeviceLength]
+	}
+
+	now := time.Now()
+	s := &Session{
+		Id:        id,
+		UserId:    userID,
+		TokenHash: hashSessionToken(token),
+		Device:    device,
+		Created:   now,
+		LastUsed:  now,
+		Expires:   now.Add(SessionLifetime),
+	}
+	if _, err = repository.Put(c, s.key(), s); err != nil {
+		log.Errorf(c, "Session.Create: %v", err)
+		return nil, "", errors.New("model/session: unable to put session in Datastore")
+	}
+	return s, token, nil
+}
+
+// hashSessionToken returns the hash under which the session of a token is stored.
+func hashSessionToken(token string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(token)))
+}
+
+// key returns the key of the session.
+func (s *Session) key() *repository.Key {
+	return repository.NewKey("Session", s.TokenHash, 0)
+}
+
+// SessionByToken returns the session of a token.
+// It returns ErrSessionExpired and deletes the session if it expired.
+//
+func SessionByToken(c appengine.Context, token string) (*Session, error) {
+	if len(token) == 0 {
+		return nil, repository.ErrNoSuchEntity
+	}
+
+	var s Session
+	if err := repository.Get(c, repository.NewKey("Session", hashSessionToken(token), 0), &s); err != nil {
+		return nil, err
+	}
+	if s.IsExpired() {
+		if err := s.Destroy(c); err != nil {
+			log.Errorf(c, "Session.ByToken: unable to delete expired session %d: %v", s.Id, err)
+		}
+		return nil, ErrSessionExpired
+	}
+	return &s, nil
+}
+
+// IsExpired checks if the session is past its expiry.
+//
+func (s *Session) IsExpired() bool {
+	return time.Now().After(s.Expires)
+}
+
+// Refresh extends the expiry of a session in use.
+// The session is written at most once per SessionRefreshInterval.
+//
+func (s *Session) Refresh(c appengine.Context) error {
+	now := time.Now()
+	if now.Sub(s.LastUsed) < SessionRefreshInterval {
+		return nil
+	}
+	s.LastUsed = now
+	s.Expires = now.Add(SessionLifetime)
+	_, err := repository.Put(c, s.key(), s)
+	return err
+}
+
+// Destroy removes a session, signing out its device.
+//
+func (s *Session) Destroy(c appengine.Context) error {
+	return repository.Delete(c, s.key())
+}
+
+// UserSessions returns the sessions of a user, starting with the most recently used.
+//
+func UserSessions(c appengine.Context, userID int64) []*Session {
+	q := repository.NewQuery("Session").Filter("UserId =", userID)
+
+	var sessions []*Session
+	if _, err := q.GetAll(c, &sessions); err != nil {
+		log.Errorf(c, "Session.UserSessions: error occurred during GetAll: %v", err)
+		return nil
+	}
+
+	var active []*Session
+	for _, s := range sessions {
+		if !s.IsExpired() {
+			active = append(active, s)
+		}
+	}
+	sort.Sort(SessionByLastUse(active))
+	return active
+}
+
+// UserSessionByID returns the session of a user with the given id.
+//
+func UserSessionByID(c appengine.Context, userID, id int64) (*Session, error) {
+	q := repository.NewQuery("Session").Filter("UserId =", userID).Filter("Id =", id)
+
+	var sessions []*Session
+	if _, err := q.GetAll(c, &sessions); err != nil {
+		log.Errorf(c, "Session.UserSessionByID: error occurred during GetAll: %v", err)
+		return nil, err
+	}
+	if len(sessions) == 0 || sessions[0].IsExpired() {
+		return nil, repository.ErrNoSuchEntity
+	}
+	return sessions[0], nil
+}
+
+// DestroyUserSessions removes all the sessions of a user, signing out all his devices.
+//
+func DestroyUserSessions(c appengine.Context, userID int64) error {
+	_, err := destroySessions(c, "UserId =", userID)
+	return err
+}
+
+// DestroyExpiredSessions removes the sessions past their expiry and returns their number.
+//
+func DestroyExpiredSessions(c appengine.Context) (int, error) {
+	return destroySessions(c, "Expires <", time.Now())
+}
+
+// destroySessions removes the sessions matching a filter by batches and returns their number.
+func destroySessions(c appengine.Context, filter string, value interface{}) (int, error) {
+	n := 0
+	for {
+		keys, err := repository.NewQuery("Session").Filter(filter, value).KeysOnly().Limit(sessionBatchSize).GetAll(c, nil)
+		if err != nil {
+			return n, err
+		}
+		if len(keys) == 0 {
+			return n, nil
+		}
+		if err = repository.DeleteMulti(c, keys); err != nil {
+			return n, err
+		}
+		n += len(keys)
+	}
+}
+
+// SessionByLastUse type used to sort sessions from the most recently used to the least recently used.
+//
+type SessionByLastUse []*Session
+
+func (a SessionByLastUse) Len() int           { return len(a) }
+func (a SessionByLastUse) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a SessionByLastUse) Less(i, j int) bool { return a[i].LastUsed.After(a[j].LastUsed) }
@@ -0,0 +1,192 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/taironas/gonawin/helpers/memcache"
+	"github.com/taironas/gonawin/repository"
+)
+
+// TestSessionByToken tests that a session is found from its token only while it is active.
+//
+func TestSessionByToken(t *testing.T) {
+	repository.Use(repository.NewMemory())
+	defer repository.Use(repository.Datastore)
+	memcache.Use(memcache.NewMemory())
+
+	c := repository.NewLocalContext(nil)
+
+	active, token, err := CreateSession(c, 1, "firefox")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if active.TokenHash == token || len(token) != 64 {
+		t.Errorf("Error: the token should not be stored, got token %q and hash %q", token, active.TokenHash)
+	}
+
+	expired, expiredToken, err := CreateSession(c, 1, "chrome")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	expired.Expires = time.Now().Add(-time.Minute)
+	if _, err = repository.Put(c, expired.key(), expired); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	tests := []struct {
+		title string
+		token string
+		id    int64
+		err   error
+	}{
+		{title: "can get an active session", token: token, id: active.Id},
+		{title: "cannot get a session with a wrong token", token: "foo", err: repository.ErrNoSuchEntity},
+		{title: "cannot get a session without token", token: "", err: repository.ErrNoSuchEntity},
+		{title: "cannot get an expired session", token: expiredToken, err: ErrSessionExpired},
+		{title: "expired session is deleted", token: expiredToken, err: repository.ErrNoSuchEntity},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+		s, err := SessionByToken(c, test.token)
+		if err != test.err {
+			t.Errorf("test %v - Error: want err %v, got %v", i, test.err, err)
+		} else if err == nil && s.Id != test.id {
+			t.Errorf("test %v - Error: want session %d, got %d", i, test.id, s.Id)
+		}
+	}
+}
+
+// TestSessionRefresh tests that the expiry of a session is extended when it is used.
+//
+func TestSessionRefresh(t *testing.T) {
+	repository.Use(repository.NewMemory())
+	defer repository.Use(repository.Datastore)
+	memcache.Use(memcache.NewMemory())
+
+	c := repository.NewLocalContext(nil)
+
+	s, token, err := CreateSession(c, 1, "firefox")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	expires := s.Expires
+	if err = s.Refresh(c); err != nil || !s.Expires.Equal(expires) {
+		t.Errorf("Error: a recent session should not be refreshed, got expiry %v, %v", s.Expires, err)
+	}
+
+	s.LastUsed = s.LastUsed.Add(-2 * SessionRefreshInterval)
+	s.Expires = s.Expires.Add(-2 * SessionRefreshInterval)
+	if err = s.Refresh(c); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	var got *Session
+	if got, err = SessionByToken(c, token); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if got.Expires.Before(expires) {
+		t.Errorf("Error: want expiry after %v, got %v", expires, got.Expires)
+	}
+}
+
+// TestUserSessions tests the listing and the sign out of the sessions of a user.
+//
+func TestUserSessions(t *testing.T) {
+	repository.Use(repository.NewMemory())
+	defer repository.Use(repository.Datastore)
+	memcache.Use(memcache.NewMemory())
+
+	c := repository.NewLocalContext(nil)
+
+	var ids []int64
+	for _, device := range []string{"firefox", "chrome", "safari"} {
+		s, _, err := CreateSession(c, 1, device)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		s.LastUsed = s.LastUsed.Add(time.Duration(len(ids)) * time.Minute)
+		if _, err = repository.Put(c, s.key(), s); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		ids = append(ids, s.Id)
+	}
+	other, _, err := CreateSession(c, 2, "firefox")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	other.Expires = time.Now().Add(-time.Minute)
+	if _, err = repository.Put(c, other.key(), other); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	sessions := UserSessions(c, 1)
+	if len(sessions) != 3 || sessions[0].Id != ids[2] || sessions[2].Id != ids[0] {
+		t.Errorf("Error: want sessions %v from the most recently used, got %v", ids, sessions)
+	}
+	if _, err = UserSessionByID(c, 2, ids[0]); err != repository.ErrNoSuchEntity {
+		t.Errorf("Error: a user should not get the session of another user, got %v", err)
+	}
+
+	var s *Session
+	if s, err = UserSessionByID(c, 1, ids[0]); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if err = s.Destroy(c); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if n := len(UserSessions(c, 1)); n != 2 {
+		t.Errorf("Error: want 2 sessions after a logout, got %d", n)
+	}
+
+	if n, err := DestroyExpiredSessions(c); err != nil || n != 1 {
+		t.Errorf("Error: want 1 expired session deleted, got %d, %v", n, err)
+	}
+	if err = DestroyUserSessions(c, 1); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if n := len(UserSessions(c, 1)); n != 0 {
+		t.Errorf("Error: want no session after a logout of all sessions, got %d", n)
+	}
+}
+
+// TestDestroySessionsByBatches tests that more sessions than a datastore call deletes are all removed.
+//
+func TestDestroySessionsByBatches(t *testing.T) {
+	repository.Use(repository.NewMemory())
+	defer repository.Use(repository.Datastore)
+	memcache.Use(memcache.NewMemory())
+
+	c := repository.NewLocalContext(nil)
+
+	for i := 0; i < sessionBatchSize+1; i++ {
+		for _, userID := range []int64{1, 2} {
+			s, _, err := CreateSession(c, userID, "firefox")
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			if userID == 2 {
+				s.Expires = time.Now().Add(-time.Minute)
+				if _, err = repository.Put(c, s.key(), s); err != nil {
+					t.Fatalf("Error: %v", err)
+				}
+			}
+		}
+	}
+
+	if n, err := DestroyExpiredSessions(c); err != nil || n != sessionBatchSize+1 {
+		t.Errorf("Error: want %d expired sessions deleted, got %d, %v", sessionBatchSize+1, n, err)
+	}
+	if err := DestroyUserSessions(c, 1); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	keys, err := repository.NewQuery("Session").KeysOnly().GetAll(c, nil)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if len(keys) != 0 {
+		t.Errorf("Error: want no session left, got %d", len(keys))
+	}
+}
@@ -20,14 +20,14 @@ import (
 	"errors"
 	"fmt"
 	"sort"
-	"strings"
 	"time"
 
 	"appengine"
-	"appengine/datastore"
 
 	"github.com/taironas/gonawin/helpers"
 	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/memcache"
+	"github.com/taironas/gonawin/repository"
 )
 
 // AccOfTournaments holds a tournament id and an accuracy id.
@@ -47,12 +47,17 @@ type Team struct {
 	AdminIds             []int64 // ids of User that are admins of the team
 	Private              bool
 	Created              time.Time
-	UserIds              []int64              // ids of Users <=> members of the team.
+	UserIds              []int64              // legacy ids of Users <=> members of the team, moved to TeamMember relations.
 	TournamentIds        []int64              // ids of Tournaments <=> Tournaments the team subscribed.
 	Accuracy             float64              // Overall Team accuracy.
 	AccOfTournaments 		 []AccOfTournaments // ids of Accuracies for each tournament the team is participating on .
 	PriceIds             []int64              // ids of Prices <=> prices defined for each tournament the team participates.
 	MembersCount         int64                // number of members in team
+	TrophyIds            []int64              // ids of Trophies <=> challenges won by the team.
+	OwnerIds             []int64              // ids of User that are owners of the team, owners are admins as well.
+	ModeratorIds         []int64              // ids of User that are moderators of the team.
+	SpectatorIds         []int64              // ids of User that are spectators of the team.
+	BannedIds            []int64              // ids of User that are banned from the team.
 }
 
 // TeamJSON is the JSON version of the Team struct.
@@ -71,30 +76,35 @@ type TeamJSON struct {
 	AccOfTournaments   *[]AccOfTournaments `json:",omitempty"`
 	PriceIds      *[]int64              `json:",omitempty"`
 	MembersCount  *int64                `json:",omitempty"`
+	TrophyIds     *[]int64              `json:",omitempty"`
+	OwnerIds      *[]int64              `json:",omitempty"`
+	ModeratorIds  *[]int64              `json:",omitempty"`
+	SpectatorIds  *[]int64              `json:",omitempty"`
+	BannedIds     *[]int64              `json:",omitempty"`
 }
 
 // CreateTeam creates a team given a name, description, an admin id and a private mode.
 //
 func CreateTeam(c appengine.Context, name string, description string, adminID int64, private bool) (*Team, error) {
 	// create new team
-	teamID, _, err := datastore.AllocateIDs(c, "Team", nil, 1)
+	teamID, _, err := repository.AllocateIDs(c, "Team", 1)
 	if err != nil {
 		return nil, err
 	}
 
-	key := datastore.NewKey(c, "Team", "", teamID, nil)
+	key := repository.NewKey("Team", "", teamID)
 	admins := make([]int64, 1)
 	admins[0] = adminID
 	var emptyArray []int64
 	var emtpyArrayOfAccOfTournament []AccOfTournaments
-	team := &Team{teamID, helpers.TrimLower(name), name, description, admins, private, time.Now(), emptyArray, emptyArray, float64(0), emtpyArrayOfAccOfTournament, emptyArray, 0}
+	team := &Team{teamID, helpers.TrimLower(name), name, description, admins, private, time.Now(), emptyArray, emptyArray, float64(0), emtpyArrayOfAccOfTournament, emptyArray, 0, emptyArray, []int64{adminID}, emptyArray, emptyArray, emptyArray}
 
-	_, err = datastore.Put(c, key, team)
+	_, err = repository.Put(c, key, team)
 	if err != nil {
 		return nil, err
 	}
 	// udpate inverted index
-	AddToTeamInvertedIndex(c, helpers.TrimLower(name), teamID)
+	AddToInvertedIndex(c, TeamSearchKind, name, teamID)
 
 	return team, err
 }
@@ -107,20 +117,26 @@ func (t *Team) Destroy(c appengine.Context) error {
 		return fmt.Errorf("Cannot find team with Id=%d", t.Id)
 	}
 
-	key := datastore.NewKey(c, "Team", "", t.Id, nil)
-	if errd := datastore.Delete(c, key); errd != nil {
+	// delete all team-user relationships
+	if err := t.removeMembers(c); err != nil {
+		return err
+	}
+
+	key := repository.NewKey("Team", "", t.Id)
+	if errd := repository.Delete(c, key); errd != nil {
 		return errd
 	}
+	changed(c, "Team", t.Id)
 
 	// remove key name.
-	return UpdateTeamInvertedIndex(c, t.KeyName, "", t.Id)
+	return UpdateInvertedIndex(c, TeamSearchKind, t.searchValues(), nil, t.Id)
 }
 
 // FindTeams searches for all Team entities with respect of a filter and a value.
 //
 func FindTeams(c appengine.Context, filter string, value interface{}) []*Team {
 
-	q := datastore.NewQuery("Team").Filter(filter+" =", value)
+	q := repository.NewQuery("Team").Filter(filter+" =", value)
 
 	var teams []*Team
 
@@ -137,9 +153,9 @@ func FindTeams(c appengine.Context, filter string, value interface{}) []*Team {
 func TeamByID(c appengine.Context, Id int64) (*Team, error) {
 
 	var t Team
-	key := datastore.NewKey(c, "Team", "", Id, nil)
+	key := repository.NewKey("Team", "", Id)
 
-	if err := datastore.Get(c, key, &t); err != nil {
+	if err := repository.Get(c, key, &t); err != nil {
 		log.Errorf(c, " team not found : %v", err)
 		return nil, err
 	}
@@ -148,8 +164,8 @@ func TeamByID(c appengine.Context, Id int64) (*Team, error) {
 
 // TeamKeyByID gets a team key given a team id.
 //
-func TeamKeyByID(c appengine.Context, Id int64) *datastore.Key {
-	return datastore.NewKey(c, "Team", "", Id, nil)
+func TeamKeyByID(c appengine.Context, Id int64) *repository.Key {
+	return repository.NewKey("Team", "", Id)
 }
 
 // Update updates a team given an id and a team pointer.
@@ -160,12 +176,12 @@ func (t *Team) Update(c appengine.Context) error {
 	k := TeamKeyByID(c, t.Id)
 	oldTeam := new(Team)
 	var err error
-	if err = datastore.Get(c, k, oldTeam); err == nil {
-		if _, err = datastore.Put(c, k, t); err != nil {
+	if err = repository.Get(c, k, oldTeam); err == nil {
+		if _, err = repository.Put(c, k, t); err != nil {
 			return err
 		}
-		// use lower trim names as team inverted index store them like this.
-		UpdateTeamInvertedIndex(c, oldTeam.KeyName, t.KeyName, t.Id)
+		changed(c, "Team", t.Id)
+		UpdateInvertedIndex(c, TeamSearchKind, oldTeam.searchValues(), t.searchValues(), t.Id)
 	}
 	return err
 }
@@ -173,7 +189,7 @@ func (t *Team) Update(c appengine.Context) error {
 // FindAllTeams gets all teams in datastore.
 //
 func FindAllTeams(c appengine.Context) []*Team {
-	q := datastore.NewQuery("Team")
+	q := repository.NewQuery("Team")
 
 	var teams []*Team
 
@@ -191,9 +207,10 @@ func GetNotJoinedTeams(c appengine.Context, u *User, count, page int64) []*Team
 	desc := "Get not joined teams"
 	teams := FindAllTeams(c)
 
+	teamIDs := u.TeamIDs(c)
 	var notJoined []*Team
 	for _, team := range teams {
-		if !team.Joined(c, u) {
+		if joined, _ := helpers.Contains(teamIDs, team.Id); !joined {
 			notJoined = append(notJoined, team)
 		}
 	}
@@ -211,6 +228,36 @@ func GetNotJoinedTeams(c appengine.Context, u *User, count, page int64) []*Team
 	return paged
 }
 
+// GetNotJoinedTeamsByCursor gets a page of the teams that a user has not joined,
+// starting with the most recent ones, and the cursor of the next page.
+//
+func GetNotJoinedTeamsByCursor(c appengine.Context, u *User, count int64, cursor string) ([]*Team, string, error) {
+	if count <= 0 {
+		return nil, "", nil
+	}
+	it := repository.NewQuery("Team").Order("-Created").Start(repository.Cursor(cursor)).Run(c)
+
+	teamIDs := u.TeamIDs(c)
+	var teams []*Team
+	for int64(len(teams)) < count {
+		var team Team
+		if _, err := it.Next(&team); err == repository.Done {
+			return teams, "", nil
+		} else if err != nil {
+			log.Errorf(c, "GetNotJoinedTeamsByCursor: error occurred during query: %v", err)
+			return nil, "", err
+		}
+		if joined, _ := helpers.Contains(teamIDs, team.Id); !joined {
+			teams = append(teams, &team)
+		}
+	}
+	next, err := it.Cursor()
+	if err != nil {
+		return nil, "", err
+	}
+	return teams, string(next), nil
+}
+
 // TeamsByIDs returns an array of teams from a given team IDs array.
 // An error could be returned.
 //
@@ -221,10 +268,10 @@ func TeamsByIDs(c appengine.Context, IDs []int64) ([]*Team, error) {
 
 	var wrongIndexes []int
 
-	if err := datastore.GetMulti(c, keys, teams); err != nil {
+	if err := repository.GetMulti(c, keys, teams); err != nil {
 		if me, ok := err.(appengine.MultiError); ok {
 			for i, merr := range me {
-				if merr == datastore.ErrNoSuchEntity {
+				if merr == repository.ErrNoSuchEntity {
 					log.Errorf(c, "TeamsByIDs, missing key: %v %v", err, keys[i].IntID())
 
 					wrongIndexes = append(wrongIndexes, i)
@@ -247,8 +294,8 @@ func TeamsByIDs(c appengine.Context, IDs []int64) ([]*Team, error) {
 
 // TeamsKeysByIDs returns an array of datastore keys from a given team IDs array.
 //
-func TeamsKeysByIDs(c appengine.Context, IDs []int64) []*datastore.Key {
-	keys := make([]*datastore.Key, len(IDs))
+func TeamsKeysByIDs(c appengine.Context, IDs []int64) []*repository.Key {
+	keys := make([]*repository.Key, len(IDs))
 	for i, id := range IDs {
 		keys[i] = TeamKeyByID(c, id)
 	}
@@ -258,19 +305,16 @@ func TeamsKeysByIDs(c appengine.Context, IDs []int64) []*datastore.Key {
 // Joined checks if a user has joined a team or not.
 //
 func (t *Team) Joined(c appengine.Context, u *User) bool {
-
-	hasTeam, _ := u.ContainsTeamID(t.Id)
-	return hasTeam
+	return u.ContainsTeamID(c, t.Id)
 }
 
 // Join let a user join a team.
-// TeamId is added to user entity.
-// UserId is added to team entity.
-// UserId is added to all current tournaments joined by the team entity.
+// User is added to the members of the team.
+// User is added to all current tournaments joined by the team entity.
 //
 func (t *Team) Join(c appengine.Context, u *User) error {
-	if err := u.AddTeamID(c, t.Id); err != nil {
-		return fmt.Errorf(" Team.Join, error joining team for user:%d Error: %v", u.Id, err)
+	if t.Joined(c, u) {
+		return fmt.Errorf(" Team.Join, user:%d is allready a member", u.Id)
 	}
 
 	if err := t.AddUserID(c, u.Id); err != nil {
@@ -284,15 +328,24 @@ func (t *Team) Join(c appengine.Context, u *User) error {
 }
 
 // Leave makes a user leave a team.
+// The roles of the user in the team are removed. The last owner of a team cannot leave it.
 // Todo: Should we check that the user is indeed a member of the team?
 //
 func (t *Team) Leave(c appengine.Context, u *User) error {
-	if err := u.RemoveTeamID(c, t.Id); err != nil {
-		return fmt.Errorf(" Team.Leave, error leaving team for user:%v Error: %v", u.Id, err)
+	if t.IsLastOwner(u.Id) {
+		return fmt.Errorf(" Team.Leave, user:%v is the last owner of the team", u.Id)
 	}
+	t.initOwners()
+	t.removeRoles(u.Id)
+
 	if err := t.RemoveUserID(c, u.Id); err != nil {
 		return fmt.Errorf(" Team.Leave, error leaving team for user:%v Error: %v", u.Id, err)
 	}
+	for _, tID := range t.TournamentIds {
+		if err := TeamLeaderboard(t.Id, tID).Remove(c, u.Id); err != nil {
+			log.Errorf(c, " Team.Leave, error removing user:%v from leaderboard of tournament:%v Error: %v", u.Id, tID, err)
+		}
+	}
 	// sar: 7 mar 2014
 	// when a user leaves a team should we unsubscribe him from the tournaments of that team?
 	// for now I would say no.
@@ -303,33 +356,258 @@ func (t *Team) Leave(c appengine.Context, u *User) error {
 	return nil
 }
 
+// Kick removes a member from the team.
+// The user also leaves the running tournaments of the team, unless he takes part
+// in them with another team.
+//
+func (t *Team) Kick(c appengine.Context, u *User) error {
+	if err := t.Leave(c, u); err != nil {
+		return err
+	}
+
+	otherTeams := u.Teams(c)
+
+	for _, tID := range t.TournamentIds {
+		inOtherTeam := false
+		for _, other := range otherTeams {
+			if other.Id == t.Id {
+				continue
+			}
+			if ok, _ := other.ContainsTournamentID(tID); ok {
+				inOtherTeam = true
+				break
+			}
+		}
+		if inOtherTeam {
+			continue
+		}
+
+		if tournament, err := TournamentByID(c, tID); err != nil {
+			log.Errorf(c, "Cannot find tournament with Id=%d", tID)
+		} else if time.Now().Before(tournament.End) {
+			if err := tournament.RemoveUserID(c, u.Id); err != nil {
+				log.Errorf(c, " Team.Kick: unable to remove user:%d from tournament:%d, %v", u.Id, tID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// IsBanned checks if a user is banned from the team.
+//
+func (t *Team) IsBanned(id int64) bool {
+	banned, _ := helpers.Contains(t.BannedIds, id)
+	return banned
+}
+
+// Ban bans a user from the team, a banned user cannot join the team nor request to join it.
+// If the user is a member of the team, he is kicked first. Pending requests and invitations are cleared.
+//
+func (t *Team) Ban(c appengine.Context, u *User) error {
+	if t.IsBanned(u.Id) {
+		return fmt.Errorf("Ban, user %d allready banned", u.Id)
+	}
+
+	if t.ContainsUserID(c, u.Id) {
+		if err := t.Kick(c, u); err != nil {
+			return err
+		}
+	}
+
+	if tr := findByTeamIDAndUserID(c, t.Id, u.Id); tr != nil {
+		if err := tr.Destroy(c); err != nil {
+			log.Errorf(c, " Team.Ban: unable to destroy team request %d, %v", tr.Id, err)
+		}
+	}
+	if ur := FindUserRequestByTeamAndUser(c, t.Id, u.Id); ur != nil {
+		if err := ur.Destroy(c); err != nil {
+			log.Errorf(c, " Team.Ban: unable to destroy user request %d, %v", ur.Id, err)
+		}
+	}
+
+	t.BannedIds = append(t.BannedIds, u.Id)
+	return t.Update(c)
+}
+
+// Unban lifts the ban of a user.
+//
+func (t *Team) Unban(c appengine.Context, id int64) error {
+	if !t.IsBanned(id) {
+		return fmt.Errorf("Unban, user %d not banned", id)
+	}
+
+	t.BannedIds = helpers.Remove(t.BannedIds, id)
+	return t.Update(c)
+}
+
 // IsTeamAdmin checks if user is admin of the team with id 'teamId'.
 //
 func IsTeamAdmin(c appengine.Context, teamID int64, userID int64) bool {
 
-	var team *Team
-	if team, err := TeamByID(c, teamID); team == nil || err != nil {
+	team, err := TeamByID(c, teamID)
+	if err != nil {
 		log.Errorf(c, " Team.IsTeamAdmin, error occurred during ById call: %v", err)
 		return false
 	}
 
-	for _, aid := range team.AdminIds {
-		if aid == userID {
-			return true
-		}
-	}
-	return false
+	ok, _ := team.ContainsAdminID(userID)
+	return ok
 }
 
 // GetWordFrequencyForTeam will get the frequency of that word in the team terms
 // given a id, and a word.
 //
 func GetWordFrequencyForTeam(c appengine.Context, Id int64, word string) int64 {
+	return int64(WordFrequency(c, TeamSearchKind, Id, word))
+}
+
+// GetTeamInvertedIndexes returns, given an array of words, the ids of the teams that use these words.
+//
+func GetTeamInvertedIndexes(c appengine.Context, words []string) ([]int64, error) {
+	return InvertedIndexes(c, TeamSearchKind, words)
+}
+
+// TeamSearchKind is the name of the team kind in the search engine.
+//
+const TeamSearchKind = "team"
+
+// Team search filters and facets.
+//
+const (
+	TeamSearchPublic    = "public"
+	TeamSearchPrivate   = "private"
+	TeamSearchMember    = "member"
+	TeamSearchNotMember = "notmember"
+)
+
+// TeamSearchSorts are the sort options of a team search.
+//
+var TeamSearchSorts = []string{SearchSortRelevance, SearchSortMembers, SearchSortAccuracy, SearchSortCreated}
+
+// TeamSearchOptions holds the filters, the sort option and the page of a team search.
+//
+type TeamSearchOptions struct {
+	Visibility string // public or private, all teams if empty.
+	UserId     int64  // id of the user searching, used by the membership filter and facet.
+	NotMember  bool   // only the teams the user is not a member of.
+	Sort       string
+	Count      int64
+	Page       int64
+}
+
+// SearchTeams returns a page of the teams matching the query and the options, the number
+// of teams matching and the visibility and membership facets of the teams matching the query.
+//
+func SearchTeams(c appengine.Context, query string, opts TeamSearchOptions) ([]*Team, int64, SearchFacets, error) {
+
+	ids, err := SearchIds(c, TeamSearchKind, query)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	var teams []*Team
+	if err = searchBatches(ids, func(batch []int64) error {
+		found, err := TeamsByIDs(c, batch)
+		teams = append(teams, found...)
+		return err
+	}); err != nil {
+		return nil, 0, nil, err
+	}
 
-	if teams := FindTeams(c, "Id", Id); teams != nil {
-		return helpers.CountTerm(strings.Split(teams[0].KeyName, " "), word)
+	var memberOf []int64
+	if opts.UserId > 0 {
+		u, err := UserByID(c, opts.UserId)
+		if err != nil {
+			u = &User{Id: opts.UserId}
+		}
+		memberOf = u.TeamIDs(c)
 	}
-	return 0
+
+	facets := make(SearchFacets)
+	var filtered []*Team
+	for _, t := range teams {
+		visibility := TeamSearchPublic
+		if t.Private {
+			visibility = TeamSearchPrivate
+		}
+		facets.add("Visibility", visibility)
+
+		membership := TeamSearchNotMember
+		if opts.UserId > 0 {
+			if ok, _ := helpers.Contains(memberOf, t.Id); ok {
+				membership = TeamSearchMember
+			}
+			facets.add("Membership", membership)
+		}
+
+		if len(opts.Visibility) > 0 && opts.Visibility != visibility {
+			continue
+		}
+		if opts.NotMember && membership == TeamSearchMember {
+			continue
+		}
+		filtered = append(filtered, t)
+	}
+
+	switch opts.Sort {
+	case SearchSortMembers:
+		sort.Stable(TeamByMembersCount(filtered))
+	case SearchSortAccuracy:
+		sort.Stable(sort.Reverse(TeamByAccuracy(filtered)))
+	case SearchSortCreated:
+		sort.Stable(TeamByCreation(filtered))
+	}
+
+	total := int64(len(filtered))
+	from, to := searchPageBounds(total, opts.Count, opts.Page)
+	return filtered[from:to], total, facets, nil
+}
+
+// TeamByMembersCount type used to sort teams by descending number of members.
+//
+type TeamByMembersCount []*Team
+
+func (a TeamByMembersCount) Len() int           { return len(a) }
+func (a TeamByMembersCount) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a TeamByMembersCount) Less(i, j int) bool { return a[i].MembersCount > a[j].MembersCount }
+
+// TeamByCreation type used to sort teams from the most recent to the oldest.
+//
+type TeamByCreation []*Team
+
+func (a TeamByCreation) Len() int           { return len(a) }
+func (a TeamByCreation) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a TeamByCreation) Less(i, j int) bool { return a[i].Created.After(a[j].Created) }
+
+func init() {
+	RegisterSearchKind(SearchKind{
+		Name:      TeamSearchKind,
+		Entity:    "Team",
+		Postings:  "TeamInvertedIndexShard",
+		Counter:   "WordCountTeam",
+		Fields:    []SearchField{{"Name", 1}},
+		Documents: teamSearchDocuments,
+	})
+}
+
+// searchValues returns the values of the team fields indexed by the search engine.
+//
+func (t *Team) searchValues() []string {
+	return []string{t.Name}
+}
+
+// teamSearchDocuments returns the indexed values of the teams with the given ids.
+//
+func teamSearchDocuments(c appengine.Context, ids []int64) map[int64][]string {
+	documents := make(map[int64][]string)
+	teams, err := TeamsByIDs(c, ids)
+	if err != nil {
+		log.Errorf(c, "teamSearchDocuments, unable to get teams: %v", err)
+	}
+	for _, t := range teams {
+		documents[t.Id] = t.searchValues()
+	}
+	return documents
 }
 
 // Players returns an array of users/ players that participates the given team.
@@ -338,13 +616,45 @@ func (t *Team) Players(c appengine.Context) ([]*User, error) {
 
 	var users []*User
 	var err error
-	if users, err = UsersByIds(c, t.UserIds); err != nil {
+	if users, err = UsersByIds(c, t.UserIDs(c)); err != nil {
 		return nil, err
 	}
 
 	return users, err
 }
 
+// UserIDs returns the ids of the members of the team, from the oldest member to the most recent one.
+//
+func (t *Team) UserIDs(c appengine.Context) []int64 {
+	if err := t.migrateRelations(c); err != nil {
+		log.Errorf(c, "Team.UserIDs: unable to migrate relations of team %d: %v", t.Id, err)
+	}
+
+	ids, err := relatedIDs(c, teamMemberKind, "FromId", t.Id)
+	if err != nil {
+		log.Errorf(c, "Team.UserIDs: unable to get members of team %d: %v", t.Id, err)
+	}
+	return ids
+}
+
+// PlayersByCursor returns a page of the members of the team, starting with the
+// most recent ones, and the cursor of the next page.
+//
+func (t *Team) PlayersByCursor(c appengine.Context, count int64, cursor string) ([]*User, string, error) {
+	if err := t.migrateRelations(c); err != nil {
+		return nil, "", err
+	}
+	ids, next, err := relatedIDsByCursor(c, teamMemberKind, "FromId", t.Id, count, cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	var users []*User
+	if users, err = UsersByIds(c, ids); err != nil {
+		return nil, "", err
+	}
+	return users, next, nil
+}
+
 // ContainsTournamentID checks if a given tournament id exists in a team entity.
 //
 func (t *Team) ContainsTournamentID(id int64) (bool, int) {
@@ -380,16 +690,6 @@ func (t *Team) AddTournamentID(c appengine.Context, tID int64) error {
 	if err := t.Update(c); err != nil {
 		return err
 	}
-
-	for _, uID := range t.UserIds {
-		user, err := UserByID(c, uID)
-		if err != nil {
-			log.Errorf(c, "Team.AddTournamentID, user not found")
-		} else {
-			log.Infof(c, "team Add tournament id add tournament id%v", user.Id)
-			user.AddTournamentID(c, tID)
-		}
-	}
 	return nil
 }
 
@@ -450,6 +750,33 @@ func (t *Team) removePriceID(c appengine.Context, pID int64) error {
 	return nil
 }
 
+// ContainsTrophyID checks if a given trophy id exists in a team entity.
+//
+func (t *Team) ContainsTrophyID(id int64) (bool, int) {
+	return helpers.Contains(t.TrophyIds, id)
+}
+
+// AddTrophyID adds a trophy Id in the TrophyIds array.
+//
+func (t *Team) AddTrophyID(c appengine.Context, tID int64) error {
+
+	if hasTrophy, _ := t.ContainsTrophyID(tID); hasTrophy {
+		return fmt.Errorf("AddTrophyID, allready a member")
+	}
+
+	t.TrophyIds = append(t.TrophyIds, tID)
+	if err := t.Update(c); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Trophies gets the trophies won by a team.
+//
+func (t *Team) Trophies(c appengine.Context) []*Trophy {
+	return TrophiesByIds(c, t.TrophyIds)
+}
+
 // RemovePriceByTournamentID removes price enity and price id from team enity with respect to tournament id.
 //
 func (t *Team) RemovePriceByTournamentID(c appengine.Context, tID int64) error {
@@ -500,60 +827,88 @@ func (t *Team) Accuracies(c appengine.Context) []*Accuracy {
 	return accs
 }
 
-// RemoveUserID removes a user Id in the UserId array.
+// RemoveUserID removes a user from the members of the team.
 //
 func (t *Team) RemoveUserID(c appengine.Context, uID int64) error {
 
-	hasUser := false
-	i := 0
-
-	if hasUser, i = t.ContainsUserID(uID); !hasUser {
+	if !t.ContainsUserID(c, uID) {
 		return fmt.Errorf("RemoveUserID, not a member")
 	}
 
-	// as the order of index in usersId is not important,
-	// replace elem at index i with last element and resize slice.
-	t.UserIds[i] = t.UserIds[len(t.UserIds)-1]
-	t.UserIds = t.UserIds[0 : len(t.UserIds)-1]
-	t.MembersCount = int64(len(t.UserIds))
+	// the legacy team ids of the user would restore the membership.
+	if u, err := UserByID(c, uID); err == nil {
+		if err = u.migrateRelations(c); err != nil {
+			return err
+		}
+	}
 
-	if err := t.Update(c); err != nil {
+	if err := removeRelation(c, teamMemberKind, t.Id, uID); err != nil {
 		return err
 	}
-	return nil
+	return t.updateMembersCount(c, -1)
 }
 
-// AddUserID adds a team Id in the UserId array.
+// AddUserID adds a user to the members of the team.
 //
 func (t *Team) AddUserID(c appengine.Context, uID int64) error {
 
-	if hasUser, _ := t.ContainsUserID(uID); hasUser {
+	if t.ContainsUserID(c, uID) {
 		return fmt.Errorf("AddUserID, allready a member")
 	}
 
-	t.UserIds = append(t.UserIds, uID)
-	t.MembersCount = int64(len(t.UserIds))
-	if err := t.Update(c); err != nil {
+	if err := addRelation(c, teamMemberKind, t.Id, uID); err != nil {
 		return err
 	}
-	return nil
+	return t.updateMembersCount(c, 1)
 }
 
-// AddUserToTournaments add user to teams current tournaments.
-//
-func (t *Team) AddUserToTournaments(c appengine.Context, uID int64) error {
-	if len(t.TournamentIds) == 0 {
-		return nil
+// updateMembersCount adds delta to the number of members of the team and updates the team.
+// The count is read again from the stored team in a transaction so that concurrent joins and leaves are all counted.
+func (t *Team) updateMembersCount(c appengine.Context, delta int64) error {
+	k := TeamKeyByID(c, t.Id)
+	t.KeyName = helpers.TrimLower(t.Name)
+	var oldTeam *Team
+	err := repository.RunInTransaction(c, func(tc appengine.Context) error {
+		oldTeam = new(Team)
+		if err := repository.Get(tc, k, oldTeam); err != nil {
+			return err
+		}
+		if t.MembersCount = oldTeam.MembersCount + delta; t.MembersCount < 0 {
+			t.MembersCount = 0
+		}
+		_, err := repository.Put(tc, k, t)
+		return err
+	}, nil)
+	if err != nil {
+		return err
 	}
+	changed(c, "Team", t.Id)
+	UpdateInvertedIndex(c, TeamSearchKind, oldTeam.searchValues(), t.searchValues(), t.Id)
+	return nil
+}
 
-	var u *User
-	var err error
-
-	if u, err = UserByID(c, uID); err != nil {
-		log.Errorf(c, "User not found %v", uID)
+// removeMembers removes all the members of the team.
+func (t *Team) removeMembers(c appengine.Context) error {
+	// the legacy team ids of the members would restore their membership.
+	players, err := t.Players(c)
+	if err != nil {
 		return err
 	}
+	for _, p := range players {
+		if err = p.migrateRelations(c); err != nil {
+			return err
+		}
+	}
+	if err = removeRelations(c, teamMemberKind, "FromId", t.Id); err != nil {
+		return err
+	}
+	t.MembersCount = 0
+	return nil
+}
 
+// AddUserToTournaments add user to teams current tournaments.
+//
+func (t *Team) AddUserToTournaments(c appengine.Context, uID int64) error {
 	for _, tID := range t.TournamentIds {
 		if tournament, err := TournamentByID(c, tID); err != nil {
 			log.Errorf(c, "Cannot find tournament with Id=%d", tID)
@@ -562,10 +917,6 @@ func (t *Team) AddUserToTournaments(c appengine.Context, uID int64) error {
 			if err := tournament.AddUserID(c, uID); err != nil {
 				log.Errorf(c, "Team.AddUserToTournaments: unable to add user:%d to tournament:%d", uID, tID)
 			}
-
-			if err = u.AddTournamentID(c, tournament.Id); err != nil {
-				log.Errorf(c, "Team.AddUserToTournaments: unable to add tournament id:%d to user:%d, %v", tID, uID, err)
-			}
 		}
 	}
 	return nil
@@ -576,35 +927,28 @@ func (t *Team) AddUserToTournaments(c appengine.Context, uID int64) error {
 //
 func (t *Team) AddAdmin(c appengine.Context, id int64) error {
 
-	if isMember, _ := t.ContainsUserID(id); isMember {
+	if t.ContainsUserID(c, id) {
 		if isAdmin, _ := t.ContainsAdminID(id); isAdmin {
 			return fmt.Errorf("User with %d is already an admin of team", id)
 		}
-		t.AdminIds = append(t.AdminIds, id)
-		if err := t.Update(c); err != nil {
-			return err
-		}
-		return nil
+		return t.SetRole(c, id, TeamRoleAdmin)
 	}
 	return fmt.Errorf("User with %d is not a member of the team", id)
 }
 
 // RemoveAdmin remove user of admins array in current team.
 // In order to remove an admin from a team, there should be at least an admin in the array.
+// The last owner of a team cannot be removed.
 //
 func (t *Team) RemoveAdmin(c appengine.Context, id int64) error {
 
-	if isMember, _ := t.ContainsUserID(id); isMember {
-		if isAdmin, i := t.ContainsAdminID(id); isAdmin {
+	if t.ContainsUserID(c, id) {
+		if isAdmin, _ := t.ContainsAdminID(id); isAdmin {
+			if t.IsLastOwner(id) {
+				return fmt.Errorf("Cannot remove admin %d as he is the last owner of the team", id)
+			}
 			if len(t.AdminIds) > 1 {
-				// as the order of index in adminIds is not important,
-				// replace elem at index i with last element and resize slice.
-				t.AdminIds[i] = t.AdminIds[len(t.AdminIds)-1]
-				t.AdminIds = t.AdminIds[0 : len(t.AdminIds)-1]
-				if err := t.Update(c); err != nil {
-					return err
-				}
-				return nil
+				return t.SetRole(c, id, TeamRoleMember)
 			}
 			return fmt.Errorf("Cannot remove admin %d as there are no admins left in team", id)
 		}
@@ -627,26 +971,31 @@ func (t *Team) ContainsAdminID(id int64) (bool, int) {
 
 // ContainsUserID checks if user is part of team.
 //
-func (t *Team) ContainsUserID(id int64) (bool, int) {
+func (t *Team) ContainsUserID(c appengine.Context, id int64) bool {
+	if err := t.migrateRelations(c); err != nil {
+		log.Errorf(c, "Team.ContainsUserID: unable to migrate relations of team %d: %v", t.Id, err)
+	}
 
-	for i, tID := range t.UserIds {
-		if tID == id {
-			return true, i
-		}
+	ok, err := hasRelation(c, teamMemberKind, t.Id, id)
+	if err != nil {
+		log.Errorf(c, "Team.ContainsUserID: unable to get relation: %v", err)
 	}
-	return false, -1
+	return ok
 }
 
 // UpdateTeams updates an array of teams.
 //
 func UpdateTeams(c appengine.Context, teams []*Team) error {
-	keys := make([]*datastore.Key, len(teams))
+	keys := make([]*repository.Key, len(teams))
+	ids := make([]int64, len(teams))
 	for i := range keys {
 		keys[i] = TeamKeyByID(c, teams[i].Id)
+		ids[i] = teams[i].Id
 	}
-	if _, err := datastore.PutMulti(c, keys, teams); err != nil {
+	if _, err := repository.PutMulti(c, keys, teams); err != nil {
 		return err
 	}
+	changed(c, "Team", ids...)
 	return nil
 }
 
@@ -657,14 +1006,18 @@ func (t *Team) RankingByUser(c appengine.Context, limit int) []*User {
 		return nil
 	}
 
+	key := memcache.Key(c, "team-ranking-users", memcache.Namespace("Team", t.Id), memcache.KindNamespace("User"))
 	var users []*User
-	var err error
-
-	if users, err = t.Players(c); err != nil {
+	if err := memcache.ReadThrough(c, key, RankingCacheTTL, &users, func() (err error) {
+		if users, err = t.Players(c); err != nil {
+			return err
+		}
+		sort.Sort(UserByScore(users))
+		return nil
+	}); err != nil {
 		return nil
 	}
 
-	sort.Sort(UserByScore(users))
 	if len(users) <= limit {
 		return users
 	}
@@ -780,22 +1133,9 @@ func (t *Team) Publish(c appengine.Context, activityType string, verb string, ob
 	if err := activity.save(c); err != nil {
 		return err
 	}
-	// add new activity id in user activity table for each member of the team
-	var players []*User
-	var err error
-	if players, err = t.Players(c); err != nil {
-		log.Errorf(c, "model/team, Publish: error occurred during Players call: %v", err)
-		return nil
-	}
-
-	for _, p := range players {
-		if err := activity.AddNewActivityID(c, p); err != nil {
-			log.Errorf(c, "model/team, Publish: error occurred during AddNewActivityID call: %v", err)
-		} else {
-			if err1 := p.Update(c); err1 != nil {
-				log.Errorf(c, "model/team, Publish: error occurred during update call: %v", err1)
-			}
-		}
+	// add new activity to the feed of each member of the team
+	if err := activity.addToFeeds(c, t.UserIDs(c)); err != nil {
+		log.Errorf(c, "model/team, Publish: error occurred during addToFeeds call: %v", err)
 	}
 
 	return nil
@@ -899,3 +1239,25 @@ func (t *Team) PriceByTournament(c appengine.Context, tid int64) *Price {
 	}
 	return nil
 }
+
+// WinnersHistory gets the resolved prices of a team across all its tournaments,
+// the most recent first.
+//
+func (t *Team) WinnersHistory(c appengine.Context) []*Price {
+	var history []*Price
+	for _, p := range FindPricesByTeam(c, t.Id) {
+		if p.IsResolved() {
+			history = append(history, p)
+		}
+	}
+	sort.Sort(PriceByResolution(history))
+	return history
+}
+
+// PriceByResolution holds an array of prices sorted by their resolution date, the most recent first.
+//
+type PriceByResolution []*Price
+
+func (a PriceByResolution) Len() int           { return len(a) }
+func (a PriceByResolution) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a PriceByResolution) Less(i, j int) bool { return a[i].Resolved.After(a[j].Resolved) }
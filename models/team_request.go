@@ -18,12 +18,22 @@ package models
 
 import (
 	"fmt"
+	"sort"
 	"time"
 
 	"appengine"
-	"appengine/datastore"
 
 	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/repository"
+)
+
+const (
+	// TeamRequestLifetime is the duration after which a pending request expires.
+	TeamRequestLifetime = 30 * 24 * time.Hour
+	// TeamRequestDenialCooldown is the duration a user has to wait after a denial to request again to join a team.
+	TeamRequestDenialCooldown = 7 * 24 * time.Hour
+	// TeamRequestMessageMaxLength is the maximum length of the message of a request.
+	TeamRequestMessageMaxLength = 500
 )
 
 // TeamRequest represents a request to join a team.
@@ -35,6 +45,17 @@ type TeamRequest struct {
 	UserId   int64
 	UserName string
 	Created  time.Time
+	Message  string `datastore:",noindex"` // message of the user to the team.
+}
+
+// TeamRequestDenial keeps track of a denied request, a user cannot request again
+// to join the team before the end of the cooldown.
+//
+type TeamRequestDenial struct {
+	Id      int64
+	TeamId  int64
+	UserId  int64
+	Created time.Time
 }
 
 // TeamRequestJSON is JSON representation of the TeamRequest entity.
@@ -46,22 +67,39 @@ type TeamRequestJSON struct {
 	UserId   *int64     `json:",omitempty"`
 	UserName *string    `json:",omitempty"`
 	Created  *time.Time `json:",omitempty"`
+	Message  *string    `json:",omitempty"`
 }
 
 // CreateTeamRequest creates a teamrequest with params teamid and userid.
 //
 func CreateTeamRequest(c appengine.Context, teamID int64, teamName string, userID int64, userName string) (*TeamRequest, error) {
+	return CreateTeamRequestWithMessage(c, teamID, teamName, userID, userName, "")
+}
+
+// CreateTeamRequestWithMessage creates a teamrequest with params teamid, userid and the message of the user.
+//
+func CreateTeamRequestWithMessage(c appengine.Context, teamID int64, teamName string, userID int64, userName string, message string) (*TeamRequest, error) {
+	if len(message) > TeamRequestMessageMaxLength {
+		return nil, fmt.Errorf("message is too long, %d characters max", TeamRequestMessageMaxLength)
+	}
+	// clear a previous request that expired.
+	if tr := findByTeamIDAndUserID(c, teamID, userID); tr != nil && tr.IsExpired() {
+		if err := tr.Destroy(c); err != nil {
+			return nil, err
+		}
+	}
+
 	// create new team request
-	teamRequestID, _, err := datastore.AllocateIDs(c, "TeamRequest", nil, 1)
+	teamRequestID, _, err := repository.AllocateIDs(c, "TeamRequest", 1)
 	if err != nil {
 		return nil, err
 	}
 
-	key := datastore.NewKey(c, "TeamRequest", "", teamRequestID, nil)
+	key := repository.NewKey("TeamRequest", "", teamRequestID)
 
-	teamRequest := &TeamRequest{teamRequestID, teamID, teamName, userID, userName, time.Now()}
+	teamRequest := &TeamRequest{teamRequestID, teamID, teamName, userID, userName, time.Now(), message}
 
-	_, err = datastore.Put(c, key, teamRequest)
+	_, err = repository.Put(c, key, teamRequest)
 	if err != nil {
 		return nil, err
 	}
@@ -80,16 +118,16 @@ func (tr *TeamRequest) Destroy(c appengine.Context) error {
 		return fmt.Errorf("Cannot find team request with teamRequestId=%d", tr.Id)
 	}
 
-	key := datastore.NewKey(c, "TeamRequest", "", teamRequest.Id, nil)
+	key := repository.NewKey("TeamRequest", "", teamRequest.Id)
 
-	return datastore.Delete(c, key)
+	return repository.Delete(c, key)
 }
 
 // FindTeamRequest searches for all TeamRequest entities with respect of a filter and a value.
 //
 func FindTeamRequest(c appengine.Context, filter string, value interface{}) []*TeamRequest {
 
-	q := datastore.NewQuery("TeamRequest").Filter(filter+" =", value)
+	q := repository.NewQuery("TeamRequest").Filter(filter+" =", value)
 
 	var teamRequests []*TeamRequest
 
@@ -104,7 +142,7 @@ func FindTeamRequest(c appengine.Context, filter string, value interface{}) []*T
 //
 func findByTeamIDAndUserID(c appengine.Context, teamID int64, userID int64) *TeamRequest {
 
-	q := datastore.NewQuery("TeamRequest").Filter("TeamId =", teamID).Filter("UserId =", userID).Limit(1)
+	q := repository.NewQuery("TeamRequest").Filter("TeamId =", teamID).Filter("UserId =", userID).Limit(1)
 
 	var teamRequests []*TeamRequest
 
@@ -123,19 +161,161 @@ func findByTeamIDAndUserID(c appengine.Context, teamID int64, userID int64) *Tea
 func TeamRequestByID(c appengine.Context, id int64) (*TeamRequest, error) {
 
 	var tr TeamRequest
-	key := datastore.NewKey(c, "TeamRequest", "", id, nil)
+	key := repository.NewKey("TeamRequest", "", id)
 
-	if err := datastore.Get(c, key, &tr); err != nil {
+	if err := repository.Get(c, key, &tr); err != nil {
 		log.Errorf(c, " teamrequest.ById, error occurred during Get: %v", err)
 		return &tr, err
 	}
 	return &tr, nil
 }
 
-// WasTeamRequestSent checks if for a team id, user id pair, a request was sent.
+// WasTeamRequestSent checks if for a team id, user id pair, a request was sent and has not expired yet.
 //
 func WasTeamRequestSent(c appengine.Context, teamID int64, userID int64) bool {
-	return findByTeamIDAndUserID(c, teamID, userID) != nil
+	tr := findByTeamIDAndUserID(c, teamID, userID)
+	return tr != nil && !tr.IsExpired()
+}
+
+// IsExpired checks if a team request is older than its lifetime.
+//
+func (tr *TeamRequest) IsExpired() bool {
+	return time.Since(tr.Created) > TeamRequestLifetime
+}
+
+// Allow makes the user of the request join the team and destroys the request.
+//
+func (tr *TeamRequest) Allow(c appengine.Context, team *Team) error {
+	user, err := UserByID(c, tr.UserId)
+	if err != nil {
+		return err
+	}
+	if err = team.Join(c, user); err != nil {
+		return err
+	}
+	// request is no more needed so clear it from datastore
+	return tr.Destroy(c)
+}
+
+// Deny destroys the request and keeps track of the denial.
+//
+func (tr *TeamRequest) Deny(c appengine.Context) error {
+	if _, err := createTeamRequestDenial(c, tr.TeamId, tr.UserId); err != nil {
+		return err
+	}
+	// request is no more needed so clear it from datastore
+	return tr.Destroy(c)
+}
+
+// TeamRequestsByIds returns the team requests with the given ids that belong to a team.
+//
+func TeamRequestsByIds(c appengine.Context, teamID int64, ids []int64) []*TeamRequest {
+	var teamRequests []*TeamRequest
+	for _, id := range ids {
+		if tr, err := TeamRequestByID(c, id); err != nil {
+			log.Errorf(c, " teamrequest.ByIds, error occurred during ByID call: %v", err)
+		} else if tr.TeamId == teamID {
+			teamRequests = append(teamRequests, tr)
+		}
+	}
+	return teamRequests
+}
+
+// TeamRequestsQueue returns the pending requests of a team, the oldest first,
+// with respect to the count and page. Expired requests are left out.
+//
+func TeamRequestsQueue(c appengine.Context, teamID int64, count, page int64) (queue []*TeamRequest, total int64) {
+	var pending []*TeamRequest
+	for _, tr := range FindTeamRequest(c, "TeamId", teamID) {
+		if !tr.IsExpired() {
+			pending = append(pending, tr)
+		}
+	}
+	sort.Sort(TeamRequestByCreation(pending))
+
+	total = int64(len(pending))
+	if count <= 0 || page <= 0 {
+		return nil, total
+	}
+	start := (page - 1) * count
+	if start >= total {
+		return nil, total
+	}
+	end := start + count
+	if end > total {
+		end = total
+	}
+	return pending[start:end], total
+}
+
+// TeamRequestByCreation holds an array of team requests sorted by their creation date, the oldest first.
+//
+type TeamRequestByCreation []*TeamRequest
+
+func (a TeamRequestByCreation) Len() int           { return len(a) }
+func (a TeamRequestByCreation) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a TeamRequestByCreation) Less(i, j int) bool { return a[i].Created.Before(a[j].Created) }
+
+// ExpiredTeamRequestsByCursor returns a page of the team requests older than their lifetime,
+// and the cursor of the next page.
+//
+func ExpiredTeamRequestsByCursor(c appengine.Context, count int64, cursor string) ([]*TeamRequest, string, error) {
+	q := repository.NewQuery("TeamRequest").Filter("Created <", time.Now().Add(-TeamRequestLifetime))
+	it := q.Start(repository.Cursor(cursor)).Run(c)
+
+	var teamRequests []*TeamRequest
+	for int64(len(teamRequests)) < count {
+		var tr TeamRequest
+		if _, err := it.Next(&tr); err == repository.Done {
+			return teamRequests, "", nil
+		} else if err != nil {
+			log.Errorf(c, " teamrequest.ExpiredTeamRequestsByCursor, error occurred during query: %v", err)
+			return nil, "", err
+		}
+		teamRequests = append(teamRequests, &tr)
+	}
+	next, err := it.Cursor()
+	if err != nil {
+		return nil, "", err
+	}
+	return teamRequests, string(next), nil
+}
+
+// createTeamRequestDenial creates a denial of a request with params teamid and userid.
+//
+func createTeamRequestDenial(c appengine.Context, teamID int64, userID int64) (*TeamRequestDenial, error) {
+	id, _, err := repository.AllocateIDs(c, "TeamRequestDenial", 1)
+	if err != nil {
+		return nil, err
+	}
+
+	key := repository.NewKey("TeamRequestDenial", "", id)
+	denial := &TeamRequestDenial{id, teamID, userID, time.Now()}
+	if _, err = repository.Put(c, key, denial); err != nil {
+		return nil, err
+	}
+	return denial, nil
+}
+
+// TeamRequestAllowedAt returns the date from which a user can request again to join a team.
+// A zero date is returned if the user was never denied.
+//
+func TeamRequestAllowedAt(c appengine.Context, teamID int64, userID int64) time.Time {
+	q := repository.NewQuery("TeamRequestDenial").Filter("TeamId =", teamID).Filter("UserId =", userID)
+
+	var denials []*TeamRequestDenial
+	if _, err := q.GetAll(c, &denials); err != nil {
+		log.Errorf(c, " teamrequest.TeamRequestAllowedAt, error occurred during GetAll: %v", err)
+		return time.Time{}
+	}
+
+	var allowed time.Time
+	for _, d := range denials {
+		if at := d.Created.Add(TeamRequestDenialCooldown); at.After(allowed) {
+			allowed = at
+		}
+	}
+	return allowed
 }
 
 // TeamsRequests returns an array of teamRequest entities from an array of teams.
@@ -143,7 +323,11 @@ func WasTeamRequestSent(c appengine.Context, teamID int64, userID int64) bool {
 func TeamsRequests(c appengine.Context, teams []*Team) []*TeamRequest {
 	var teamRequests []*TeamRequest
 	for _, team := range teams {
-		teamRequests = append(teamRequests, FindTeamRequest(c, "TeamId", team.Id)...)
+		for _, tr := range FindTeamRequest(c, "TeamId", team.Id) {
+			if !tr.IsExpired() {
+				teamRequests = append(teamRequests, tr)
+			}
+		}
 	}
 	return teamRequests
 }
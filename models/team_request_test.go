@@ -0,0 +1,150 @@
+package models
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/taironas/gonawin/helpers/memcache"
+	"github.com/taironas/gonawin/repository"
+)
+
+// TestExpiredTeamRequestsByCursor tests that the team requests older than TeamRequestLifetime are expired,
+// and that all of them are returned page after page.
+//
+func TestExpiredTeamRequestsByCursor(t *testing.T) {
+	repository.Use(repository.NewMemory())
+	defer repository.Use(repository.Datastore)
+	memcache.Use(memcache.NewMemory())
+
+	c := repository.NewLocalContext(nil)
+
+	tests := []struct {
+		title   string
+		age     time.Duration
+		expired bool
+	}{
+		{title: "new request", age: 0, expired: false},
+		{title: "request just before the end of its lifetime", age: TeamRequestLifetime - time.Hour, expired: false},
+		{title: "request just after the end of its lifetime", age: TeamRequestLifetime + time.Hour, expired: true},
+		{title: "old request", age: 2 * TeamRequestLifetime, expired: true},
+		{title: "another old request", age: 3 * TeamRequestLifetime, expired: true},
+	}
+
+	var want []int64
+	for i, test := range tests {
+		t.Log(test.title)
+		tr, err := CreateTeamRequest(c, int64(i+1), "starks", 1, "arya")
+		if err != nil {
+			t.Fatalf("test %v - Error: %v", i, err)
+		}
+		tr.Created = time.Now().Add(-test.age)
+		if _, err = repository.Put(c, repository.NewKey("TeamRequest", "", tr.Id), tr); err != nil {
+			t.Fatalf("test %v - Error: %v", i, err)
+		}
+		if tr.IsExpired() != test.expired {
+			t.Errorf("test %v - Error: expired should be %v", i, test.expired)
+		}
+		if test.expired {
+			want = append(want, tr.Id)
+		}
+	}
+
+	var got []int64
+	cursor := ""
+	for pages := 0; pages < len(tests); pages++ {
+		expired, next, err := ExpiredTeamRequestsByCursor(c, 2, cursor)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(expired) > 2 {
+			t.Errorf("Error: a page should have at most 2 requests, got %d", len(expired))
+		}
+		for _, tr := range expired {
+			got = append(got, tr.Id)
+		}
+		if cursor = next; len(cursor) == 0 {
+			break
+		}
+	}
+	sort.Sort(int64Slice(got))
+	if len(got) != len(want) {
+		t.Fatalf("Error: expired requests should be %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Error: expired requests should be %v, got %v", want, got)
+			break
+		}
+	}
+}
+
+// TestTeamRequestAllowedAt tests the date from which a user denied by a team can request again to join it.
+//
+func TestTeamRequestAllowedAt(t *testing.T) {
+	repository.Use(repository.NewMemory())
+	defer repository.Use(repository.Datastore)
+	memcache.Use(memcache.NewMemory())
+
+	c := repository.NewLocalContext(nil)
+
+	now := time.Now()
+	tests := []struct {
+		title   string
+		teamID  int64
+		userID  int64
+		denials []time.Time // creation dates of the denials of the user by the team.
+		want    time.Time
+	}{
+		{title: "never denied", teamID: 1, userID: 1, want: time.Time{}},
+		{
+			title:   "denied two days ago",
+			teamID:  1,
+			userID:  2,
+			denials: []time.Time{now.AddDate(0, 0, -2)},
+			want:    now.AddDate(0, 0, -2).Add(TeamRequestDenialCooldown),
+		},
+		{
+			title:   "denied long ago",
+			teamID:  1,
+			userID:  3,
+			denials: []time.Time{now.AddDate(-1, 0, 0)},
+			want:    now.AddDate(-1, 0, 0).Add(TeamRequestDenialCooldown),
+		},
+		{
+			title:   "the latest denial sets the cooldown",
+			teamID:  1,
+			userID:  4,
+			denials: []time.Time{now.AddDate(0, 0, -1), now.AddDate(0, 0, -20)},
+			want:    now.AddDate(0, 0, -1).Add(TeamRequestDenialCooldown),
+		},
+		{title: "denied by another team", teamID: 2, userID: 2, want: time.Time{}},
+	}
+
+	for i, test := range tests {
+		for _, created := range test.denials {
+			d, err := createTeamRequestDenial(c, test.teamID, test.userID)
+			if err != nil {
+				t.Fatalf("test %v - Error: %v", i, err)
+			}
+			d.Created = created
+			if _, err = repository.Put(c, repository.NewKey("TeamRequestDenial", "", d.Id), d); err != nil {
+				t.Fatalf("test %v - Error: %v", i, err)
+			}
+		}
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+		if got := TeamRequestAllowedAt(c, test.teamID, test.userID); !got.Equal(test.want) {
+			t.Errorf("test %v - Error: allowed at should be %v, got %v", i, test.want, got)
+		}
+	}
+
+	if allowed := TeamRequestAllowedAt(c, 1, 2); !now.Before(allowed) {
+		t.Errorf("Error: a user denied two days ago should not be allowed to request before %v", allowed)
+	}
+	if allowed := TeamRequestAllowedAt(c, 1, 3); now.Before(allowed) {
+		t.Errorf("Error: a user denied long ago should be allowed to request since %v", allowed)
+	}
+}
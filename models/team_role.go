@@ -0,0 +1,287 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package models
+
+import (
+	"fmt"
+
+	"appengine"
+
+	"github.com/taironas/gonawin/helpers"
+	"github.com/taironas/gonawin/helpers/log"
+)
+
+// Roles of a user in a team, from the highest to the lowest.
+//
+const (
+	TeamRoleOwner     = "owner"     // owns the team, can do everything.
+	TeamRoleAdmin     = "admin"     // administrates the team.
+	TeamRoleModerator = "moderator" // handles the invitations and requests of the team.
+	TeamRoleMember    = "member"    // plays with the team.
+	TeamRoleSpectator = "spectator" // follows the team.
+)
+
+// TeamRoles holds the roles of a team sorted from the highest to the lowest.
+//
+var TeamRoles = []string{TeamRoleOwner, TeamRoleAdmin, TeamRoleModerator, TeamRoleMember, TeamRoleSpectator}
+
+// Permissions on a team.
+//
+const (
+	TeamPermissionUpdate          = "update"          // update name, description and visibility of the team.
+	TeamPermissionDelete          = "delete"          // delete the team.
+	TeamPermissionInvite          = "invite"          // invite users to join the team.
+	TeamPermissionApproveRequests = "approverequests" // allow or deny the requests to join the team.
+	TeamPermissionEditPrices      = "editprices"      // edit the prices of the team.
+	TeamPermissionJoinTournaments = "jointournaments" // join and leave tournaments as a team.
+	TeamPermissionManageRoles     = "manageroles"     // change the roles of the members of the team.
+	TeamPermissionRemoveMembers   = "removemembers"   // kick and ban members of the team.
+)
+
+// TeamPermissions holds all the permissions on a team.
+//
+var TeamPermissions = []string{
+	TeamPermissionUpdate,
+	TeamPermissionDelete,
+	TeamPermissionInvite,
+	TeamPermissionApproveRequests,
+	TeamPermissionEditPrices,
+	TeamPermissionJoinTournaments,
+	TeamPermissionManageRoles,
+	TeamPermissionRemoveMembers,
+}
+
+// teamPermissions is the permission matrix of the team roles.
+//
+var teamPermissions = map[string][]string{
+	TeamRoleOwner: {
+		TeamPermissionUpdate,
+		TeamPermissionDelete,
+		TeamPermissionInvite,
+		TeamPermissionApproveRequests,
+		TeamPermissionEditPrices,
+		TeamPermissionJoinTournaments,
+		TeamPermissionManageRoles,
+		TeamPermissionRemoveMembers,
+	},
+	TeamRoleAdmin: {
+		TeamPermissionUpdate,
+		TeamPermissionInvite,
+		TeamPermissionApproveRequests,
+		TeamPermissionEditPrices,
+		TeamPermissionJoinTournaments,
+		TeamPermissionManageRoles,
+		TeamPermissionRemoveMembers,
+	},
+	TeamRoleModerator: {
+		TeamPermissionInvite,
+		TeamPermissionApproveRequests,
+	},
+	TeamRoleMember: {
+		TeamPermissionInvite,
+	},
+	TeamRoleSpectator: {},
+}
+
+// IsValidTeamRole checks that a role is supported.
+//
+func IsValidTeamRole(role string) bool {
+	_, ok := teamPermissions[role]
+	return ok
+}
+
+// roleLevel returns the level of a role, the lower the level the higher the role.
+// An unknown role has the lowest level.
+//
+func roleLevel(role string) int {
+	for i, r := range TeamRoles {
+		if r == role {
+			return i
+		}
+	}
+	return len(TeamRoles)
+}
+
+// RoleHasPermission checks if a role is granted a permission.
+//
+func RoleHasPermission(role string, permission string) bool {
+	for _, p := range teamPermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Owners returns the ids of the owners of the team.
+// Teams created before roles existed have no owners, their admins are considered as owners.
+//
+func (t *Team) Owners() []int64 {
+	if len(t.OwnerIds) == 0 {
+		return t.AdminIds
+	}
+	return t.OwnerIds
+}
+
+// IsOwner checks if a user is an owner of the team.
+//
+func (t *Team) IsOwner(id int64) bool {
+	ok, _ := helpers.Contains(t.Owners(), id)
+	return ok
+}
+
+// IsLastOwner checks if a user is the only owner of the team.
+//
+func (t *Team) IsLastOwner(id int64) bool {
+	return t.IsOwner(id) && len(t.Owners()) == 1
+}
+
+// Role returns the role of a user in the team, an empty string if the user is not part of the team.
+//
+func (t *Team) Role(c appengine.Context, id int64) string {
+	if t.IsOwner(id) {
+		return TeamRoleOwner
+	}
+	if ok, _ := t.ContainsAdminID(id); ok {
+		return TeamRoleAdmin
+	}
+	if ok, _ := helpers.Contains(t.ModeratorIds, id); ok {
+		return TeamRoleModerator
+	}
+	if ok, _ := helpers.Contains(t.SpectatorIds, id); ok {
+		return TeamRoleSpectator
+	}
+	if t.ContainsUserID(c, id) {
+		return TeamRoleMember
+	}
+	return ""
+}
+
+// HasPermission checks if a user is granted a permission on the team.
+//
+func (t *Team) HasPermission(c appengine.Context, id int64, permission string) bool {
+	return RoleHasPermission(t.Role(c, id), permission)
+}
+
+// HasTeamPermission checks if a user is granted a permission on the team with id 'teamID'.
+//
+func HasTeamPermission(c appengine.Context, teamID int64, userID int64, permission string) bool {
+	team, err := TeamByID(c, teamID)
+	if err != nil {
+		log.Errorf(c, " Team.HasTeamPermission, error occurred during ById call: %v", err)
+		return false
+	}
+	return team.HasPermission(c, userID, permission)
+}
+
+// CanSetRole checks if a user can give a role to another user of the team.
+// A user can only manage the roles below his own role and the owner role can only be given
+// by a transfer of ownership.
+//
+func (t *Team) CanSetRole(c appengine.Context, actorID int64, targetID int64, role string) bool {
+	if !t.HasPermission(c, actorID, TeamPermissionManageRoles) || actorID == targetID {
+		return false
+	}
+	if role == TeamRoleOwner || !IsValidTeamRole(role) {
+		return false
+	}
+	actor := roleLevel(t.Role(c, actorID))
+	if t.Role(c, actorID) == TeamRoleOwner {
+		return t.Role(c, targetID) != TeamRoleOwner
+	}
+	return actor < roleLevel(t.Role(c, targetID)) && actor < roleLevel(role)
+}
+
+// CanRemoveMember checks if a user can kick or ban another user of the team.
+// A user can only remove the users with a role below his own role.
+//
+func (t *Team) CanRemoveMember(c appengine.Context, actorID int64, targetID int64) bool {
+	if !t.HasPermission(c, actorID, TeamPermissionRemoveMembers) || actorID == targetID {
+		return false
+	}
+	return roleLevel(t.Role(c, actorID)) < roleLevel(t.Role(c, targetID))
+}
+
+// SetRole gives a role to a member of the team.
+// The last owner of a team cannot lose his role, use TransferOwnership instead.
+//
+func (t *Team) SetRole(c appengine.Context, id int64, role string) error {
+	if !t.ContainsUserID(c, id) {
+		return fmt.Errorf("User with %d is not a member of the team", id)
+	}
+	if !IsValidTeamRole(role) {
+		return fmt.Errorf("Role %s is not supported", role)
+	}
+	if role == TeamRoleOwner {
+		return fmt.Errorf("Owner role can only be given by a transfer of ownership")
+	}
+	if t.IsLastOwner(id) {
+		return fmt.Errorf("Cannot change role of user %d as he is the last owner of the team", id)
+	}
+
+	t.initOwners()
+	t.removeRoles(id)
+	switch role {
+	case TeamRoleAdmin:
+		t.AdminIds = append(t.AdminIds, id)
+	case TeamRoleModerator:
+		t.ModeratorIds = append(t.ModeratorIds, id)
+	case TeamRoleSpectator:
+		t.SpectatorIds = append(t.SpectatorIds, id)
+	}
+	return t.Update(c)
+}
+
+// TransferOwnership makes a member of the team an owner in place of the current owner,
+// who becomes an admin of the team.
+//
+func (t *Team) TransferOwnership(c appengine.Context, fromID int64, toID int64) error {
+	if !t.IsOwner(fromID) {
+		return fmt.Errorf("User with %d is not an owner of the team", fromID)
+	}
+	if !t.ContainsUserID(c, toID) {
+		return fmt.Errorf("User with %d is not a member of the team", toID)
+	}
+	if fromID == toID || t.IsOwner(toID) {
+		return fmt.Errorf("User with %d is already an owner of the team", toID)
+	}
+
+	t.initOwners()
+	t.removeRoles(toID)
+	t.OwnerIds = helpers.Remove(t.OwnerIds, fromID)
+	t.OwnerIds = append(t.OwnerIds, toID)
+	t.AdminIds = append(t.AdminIds, toID)
+	return t.Update(c)
+}
+
+// initOwners sets the owners of a team created before roles existed.
+//
+func (t *Team) initOwners() {
+	if len(t.OwnerIds) == 0 {
+		t.OwnerIds = append([]int64{}, t.AdminIds...)
+	}
+}
+
+// removeRoles removes a user from all the roles of the team, the user stays a member.
+// The entity is not updated.
+//
+func (t *Team) removeRoles(id int64) {
+	t.OwnerIds = helpers.Remove(t.OwnerIds, id)
+	t.AdminIds = helpers.Remove(t.AdminIds, id)
+	t.ModeratorIds = helpers.Remove(t.ModeratorIds, id)
+	t.SpectatorIds = helpers.Remove(t.SpectatorIds, id)
+}
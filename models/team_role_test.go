@@ -0,0 +1,164 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/taironas/gonawin/helpers/memcache"
+	"github.com/taironas/gonawin/repository"
+)
+
+// TestTeamRole tests the role of the users of a team.
+//
+func TestTeamRole(t *testing.T) {
+	repository.Use(repository.NewMemory())
+	defer repository.Use(repository.Datastore)
+	memcache.Use(memcache.NewMemory())
+
+	c := repository.NewLocalContext(nil)
+
+	team := Team{
+		Id:           1,
+		AdminIds:     []int64{1, 2},
+		OwnerIds:     []int64{1},
+		ModeratorIds: []int64{3},
+		SpectatorIds: []int64{5},
+		UserIds:      []int64{1, 2, 3, 4, 5},
+	}
+	legacy := Team{Id: 2, AdminIds: []int64{1}, UserIds: []int64{1, 2}}
+
+	tests := []struct {
+		title string
+		team  Team
+		id    int64
+		role  string
+	}{
+		{title: "owner", team: team, id: 1, role: TeamRoleOwner},
+		{title: "admin", team: team, id: 2, role: TeamRoleAdmin},
+		{title: "moderator", team: team, id: 3, role: TeamRoleModerator},
+		{title: "member", team: team, id: 4, role: TeamRoleMember},
+		{title: "spectator", team: team, id: 5, role: TeamRoleSpectator},
+		{title: "not part of the team", team: team, id: 6, role: ""},
+		{title: "admin of a team without owners is owner", team: legacy, id: 1, role: TeamRoleOwner},
+		{title: "member of a team without owners", team: legacy, id: 2, role: TeamRoleMember},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+		if got := test.team.Role(c, test.id); got != test.role {
+			t.Errorf("test %v - Error: want role == %s, got %s", i, test.role, got)
+		}
+	}
+}
+
+// TestTeamCanSetRole tests the permission matrix when changing the role of a user.
+//
+func TestTeamCanSetRole(t *testing.T) {
+	repository.Use(repository.NewMemory())
+	defer repository.Use(repository.Datastore)
+	memcache.Use(memcache.NewMemory())
+
+	c := repository.NewLocalContext(nil)
+
+	team := Team{
+		Id:           1,
+		AdminIds:     []int64{1, 2, 6},
+		OwnerIds:     []int64{1},
+		ModeratorIds: []int64{3},
+		UserIds:      []int64{1, 2, 3, 4, 6},
+	}
+
+	tests := []struct {
+		title  string
+		actor  int64
+		target int64
+		role   string
+		can    bool
+	}{
+		{title: "owner can make a member admin", actor: 1, target: 4, role: TeamRoleAdmin, can: true},
+		{title: "owner can demote an admin", actor: 1, target: 2, role: TeamRoleMember, can: true},
+		{title: "owner cannot give the owner role", actor: 1, target: 4, role: TeamRoleOwner, can: false},
+		{title: "owner cannot change his own role", actor: 1, target: 1, role: TeamRoleMember, can: false},
+		{title: "admin can make a member moderator", actor: 2, target: 4, role: TeamRoleModerator, can: true},
+		{title: "admin cannot make a member admin", actor: 2, target: 4, role: TeamRoleAdmin, can: false},
+		{title: "admin cannot demote another admin", actor: 2, target: 6, role: TeamRoleMember, can: false},
+		{title: "admin cannot demote the owner", actor: 2, target: 1, role: TeamRoleMember, can: false},
+		{title: "moderator cannot manage roles", actor: 3, target: 4, role: TeamRoleSpectator, can: false},
+		{title: "unknown role", actor: 1, target: 4, role: "captain", can: false},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+		if got := team.CanSetRole(c, test.actor, test.target, test.role); got != test.can {
+			t.Errorf("test %v - Error: want CanSetRole == %t, got %t", i, test.can, got)
+		}
+	}
+}
+
+// TestTeamCanRemoveMember tests the permission matrix when kicking or banning a user.
+//
+func TestTeamCanRemoveMember(t *testing.T) {
+	repository.Use(repository.NewMemory())
+	defer repository.Use(repository.Datastore)
+	memcache.Use(memcache.NewMemory())
+
+	c := repository.NewLocalContext(nil)
+
+	team := Team{
+		Id:           1,
+		AdminIds:     []int64{1, 2, 6},
+		OwnerIds:     []int64{1},
+		ModeratorIds: []int64{3},
+		SpectatorIds: []int64{5},
+		UserIds:      []int64{1, 2, 3, 4, 5, 6, 7},
+	}
+
+	tests := []struct {
+		title  string
+		actor  int64
+		target int64
+		can    bool
+	}{
+		{title: "owner can remove an admin", actor: 1, target: 2, can: true},
+		{title: "owner can remove a member", actor: 1, target: 4, can: true},
+		{title: "owner cannot remove himself", actor: 1, target: 1, can: false},
+		{title: "admin can remove a moderator", actor: 2, target: 3, can: true},
+		{title: "admin can remove a member", actor: 2, target: 4, can: true},
+		{title: "admin cannot remove the owner", actor: 2, target: 1, can: false},
+		{title: "admin cannot remove another admin", actor: 2, target: 6, can: false},
+		{title: "moderator cannot remove a member", actor: 3, target: 4, can: false},
+		{title: "member cannot remove another member", actor: 4, target: 7, can: false},
+		{title: "member cannot remove a spectator", actor: 4, target: 5, can: false},
+		{title: "member cannot remove the owner", actor: 4, target: 1, can: false},
+		{title: "user out of the team cannot remove a member", actor: 8, target: 4, can: false},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+		if got := team.CanRemoveMember(c, test.actor, test.target); got != test.can {
+			t.Errorf("test %v - Error: want CanRemoveMember == %t, got %t", i, test.can, got)
+		}
+	}
+}
+
+// TestTeamLastOwner tests that the last owner of a team is detected.
+//
+func TestTeamLastOwner(t *testing.T) {
+	tests := []struct {
+		title string
+		team  Team
+		id    int64
+		last  bool
+	}{
+		{title: "single owner", team: Team{OwnerIds: []int64{1}, AdminIds: []int64{1, 2}}, id: 1, last: true},
+		{title: "two owners", team: Team{OwnerIds: []int64{1, 2}, AdminIds: []int64{1, 2}}, id: 1, last: false},
+		{title: "not an owner", team: Team{OwnerIds: []int64{1}, AdminIds: []int64{1, 2}}, id: 2, last: false},
+		{title: "single admin of a team without owners", team: Team{AdminIds: []int64{1}}, id: 1, last: true},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+		if got := test.team.IsLastOwner(test.id); got != test.last {
+			t.Errorf("test %v - Error: want IsLastOwner == %t, got %t", i, test.last, got)
+		}
+	}
+}
@@ -20,14 +20,14 @@ import (
 	"fmt"
 	"sort"
 	"strconv"
-	"strings"
 	"time"
 
 	"appengine"
-	"appengine/datastore"
 
 	"github.com/taironas/gonawin/helpers"
 	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/memcache"
+	"github.com/taironas/gonawin/repository"
 )
 
 // Tournament holds tournament entity data.
@@ -44,11 +44,13 @@ type Tournament struct {
 	GroupIds             []int64
 	Matches1stStage      []int64
 	Matches2ndStage      []int64
-	UserIds              []int64
+	UserIds              []int64 // legacy ids of participants, moved to TournamentParticipant relations.
 	TeamIds              []int64
 	TwoLegged            bool
 	IsFirstStageComplete bool
 	Official             bool
+	ParticipantsCount    int64  // number of participants stored in relations.
+	PredictionVisibility string // when the predictions of the participants are revealed to the others, at kickoff when empty.
 }
 
 // TournamentJSON is the JSON version of the Tournament struct.
@@ -70,6 +72,43 @@ type TournamentJSON struct {
 	TwoLegged            *bool      `json:",omitempty"`
 	IsFirstStageComplete *bool      `json:",omitempty"`
 	Official             *bool      `json:",omitempty"`
+	ParticipantsCount    *int64     `json:",omitempty"`
+	PredictionVisibility *string    `json:",omitempty"`
+}
+
+// Visibilities of the predictions of the participants of a tournament to the other participants.
+const (
+	PredictionsAlwaysVisible  = "always"   // predictions are always visible.
+	PredictionsAtKickoff      = "kickoff"  // predictions are revealed when the match is locked.
+	PredictionsAtFinalWhistle = "finished" // predictions are revealed when the match is finished.
+)
+
+// PredictionVisibilities are the supported visibilities of the predictions of a tournament.
+//
+var PredictionVisibilities = []string{PredictionsAlwaysVisible, PredictionsAtKickoff, PredictionsAtFinalWhistle}
+
+// IsValidPredictionVisibility checks if a visibility of the predictions is supported.
+//
+func IsValidPredictionVisibility(visibility string) bool {
+	for _, v := range PredictionVisibilities {
+		if v == visibility {
+			return true
+		}
+	}
+	return false
+}
+
+// RevealsPredictions checks if the predictions of the participants on a match of the tournament
+// are visible to the other participants.
+//
+func (t *Tournament) RevealsPredictions(m *Tmatch) bool {
+	switch t.PredictionVisibility {
+	case PredictionsAlwaysVisible:
+		return true
+	case PredictionsAtFinalWhistle:
+		return m.Finished
+	}
+	return m.IsLocked()
 }
 
 // TournamentBuilder is interface used to build a tournament
@@ -88,12 +127,12 @@ type TournamentBuilder interface {
 //
 func CreateTournament(c appengine.Context, name string, description string, start time.Time, end time.Time, adminID int64) (*Tournament, error) {
 
-	tournamentId, _, err := datastore.AllocateIDs(c, "Tournament", nil, 1)
+	tournamentId, _, err := repository.AllocateIDs(c, "Tournament", 1)
 	if err != nil {
 		return nil, err
 	}
 
-	key := datastore.NewKey(c, "Tournament", "", tournamentId, nil)
+	key := repository.NewKey("Tournament", "", tournamentId)
 
 	// empty groups and tournaments for now
 	var emptyArray []int64
@@ -102,14 +141,14 @@ func CreateTournament(c appengine.Context, name string, description string, star
 	twoLegged := false
 	official := false
 
-	tournament := &Tournament{tournamentId, helpers.TrimLower(name), name, description, start, end, admins, time.Now(), emptyArray, emptyArray, emptyArray, emptyArray, emptyArray, twoLegged, false, official}
+	tournament := &Tournament{tournamentId, helpers.TrimLower(name), name, description, start, end, admins, time.Now(), emptyArray, emptyArray, emptyArray, emptyArray, emptyArray, twoLegged, false, official, 0, PredictionsAtKickoff}
 
-	_, err = datastore.Put(c, key, tournament)
+	_, err = repository.Put(c, key, tournament)
 	if err != nil {
 		return nil, err
 	}
 
-	AddToTournamentInvertedIndex(c, helpers.TrimLower(name), tournamentId)
+	AddToInvertedIndex(c, TournamentSearchKind, name, tournamentId)
 	return tournament, nil
 }
 
@@ -121,20 +160,26 @@ func (t *Tournament) Destroy(c appengine.Context) error {
 		return fmt.Errorf("Cannot find tournament with Id=%d", t.Id)
 	}
 
-	key := datastore.NewKey(c, "Tournament", "", t.Id, nil)
-	if errd := datastore.Delete(c, key); errd != nil {
+	// delete all tournament-user relationships
+	if err := t.removeParticipants(c); err != nil {
+		return err
+	}
+
+	key := repository.NewKey("Tournament", "", t.Id)
+	if errd := repository.Delete(c, key); errd != nil {
 		return errd
 	}
+	changed(c, "Tournament", t.Id)
 
 	// remove key name.
-	return UpdateTournamentInvertedIndex(c, t.KeyName, "", t.Id)
+	return UpdateInvertedIndex(c, TournamentSearchKind, t.searchValues(), nil, t.Id)
 }
 
 // FindTournaments finds all entity tournaments with respect of a filter and value.
 //
 func FindTournaments(c appengine.Context, filter string, value interface{}) []*Tournament {
 
-	q := datastore.NewQuery("Tournament").Filter(filter+" =", value)
+	q := repository.NewQuery("Tournament").Filter(filter+" =", value)
 	var tournaments []*Tournament
 	if _, err := q.GetAll(c, &tournaments); err != nil {
 		log.Errorf(c, " Tournament.Find, error occurred during GetAll: %v", err)
@@ -149,8 +194,8 @@ func FindTournaments(c appengine.Context, filter string, value interface{}) []*T
 func TournamentByID(c appengine.Context, id int64) (*Tournament, error) {
 
 	var t Tournament
-	key := datastore.NewKey(c, "Tournament", "", id, nil)
-	if err := datastore.Get(c, key, &t); err != nil {
+	key := repository.NewKey("Tournament", "", id)
+	if err := repository.Get(c, key, &t); err != nil {
 		log.Errorf(c, " tournament not found : %v", err)
 		return &t, err
 	}
@@ -159,9 +204,9 @@ func TournamentByID(c appengine.Context, id int64) (*Tournament, error) {
 
 // TournamentKeyByID gets a pointer to a tournament key given a tournament id.
 //
-func TournamentKeyByID(c appengine.Context, id int64) *datastore.Key {
+func TournamentKeyByID(c appengine.Context, id int64) *repository.Key {
 
-	key := datastore.NewKey(c, "Tournament", "", id, nil)
+	key := repository.NewKey("Tournament", "", id)
 	return key
 }
 
@@ -173,12 +218,12 @@ func (t *Tournament) Update(c appengine.Context) error {
 	t.KeyName = helpers.TrimLower(t.Name)
 	k := TournamentKeyByID(c, t.Id)
 	oldTournament := new(Tournament)
-	if err := datastore.Get(c, k, oldTournament); err == nil {
-		if _, err = datastore.Put(c, k, t); err != nil {
+	if err := repository.Get(c, k, oldTournament); err == nil {
+		if _, err = repository.Put(c, k, t); err != nil {
 			return err
 		}
-		// use name with trim lower as tournament inverted index stores lower key names.
-		UpdateTournamentInvertedIndex(c, oldTournament.KeyName, t.KeyName, t.Id)
+		changed(c, "Tournament", t.Id)
+		UpdateInvertedIndex(c, TournamentSearchKind, oldTournament.searchValues(), t.searchValues(), t.Id)
 	}
 	return nil
 }
@@ -187,7 +232,7 @@ func (t *Tournament) Update(c appengine.Context) error {
 //
 func FindAllTournaments(c appengine.Context, count, page int64) []*Tournament {
 	desc := "tournament.FindAllTournaments"
-	q := datastore.NewQuery("Tournament")
+	q := repository.NewQuery("Tournament")
 	var tournaments []*Tournament
 	if _, err := q.GetAll(c, &tournaments); err != nil {
 		log.Errorf(c, "%s error occurred during GetAll call: %v", desc, err)
@@ -206,6 +251,36 @@ func FindAllTournaments(c appengine.Context, count, page int64) []*Tournament {
 	return paged
 }
 
+// FindTournamentsByCursor finds a page of tournaments, starting with the most recent ones,
+// and the cursor of the next page.
+//
+func FindTournamentsByCursor(c appengine.Context, count int64, cursor string) ([]*Tournament, string, error) {
+	if count <= 0 {
+		return nil, "", nil
+	}
+	it := repository.NewQuery("Tournament").Order("-Created").Start(repository.Cursor(cursor)).Limit(int(count)).Run(c)
+
+	var tournaments []*Tournament
+	for {
+		var t Tournament
+		if _, err := it.Next(&t); err == repository.Done {
+			break
+		} else if err != nil {
+			log.Errorf(c, "tournament.FindTournamentsByCursor: error occurred during query: %v", err)
+			return nil, "", err
+		}
+		tournaments = append(tournaments, &t)
+	}
+	if int64(len(tournaments)) < count {
+		return tournaments, "", nil
+	}
+	next, err := it.Cursor()
+	if err != nil {
+		return nil, "", err
+	}
+	return tournaments, string(next), nil
+}
+
 // TournamentsByIds finds all tournaments with respect to array of ids.
 //
 func TournamentsByIds(c appengine.Context, ids []int64) ([]*Tournament, error) {
@@ -215,10 +290,10 @@ func TournamentsByIds(c appengine.Context, ids []int64) ([]*Tournament, error) {
 
 	var wrongIndexes []int
 
-	if err := datastore.GetMulti(c, keys, tournaments); err != nil {
+	if err := repository.GetMulti(c, keys, tournaments); err != nil {
 		if me, ok := err.(appengine.MultiError); ok {
 			for i, merr := range me {
-				if merr == datastore.ErrNoSuchEntity {
+				if merr == repository.ErrNoSuchEntity {
 					log.Errorf(c, "TournamentsByIds, missing key: %v %v", err, keys[i].IntID())
 
 					wrongIndexes = append(wrongIndexes, i)
@@ -241,8 +316,8 @@ func TournamentsByIds(c appengine.Context, ids []int64) ([]*Tournament, error) {
 
 // TournamentKeysByIds finds tournaments keys from an array of ids.
 //
-func TournamentKeysByIds(c appengine.Context, ids []int64) []*datastore.Key {
-	keys := make([]*datastore.Key, len(ids))
+func TournamentKeysByIds(c appengine.Context, ids []int64) []*repository.Key {
+	keys := make([]*repository.Key, len(ids))
 	for i, id := range ids {
 		keys[i] = TournamentKeyByID(c, id)
 	}
@@ -252,17 +327,14 @@ func TournamentKeysByIds(c appengine.Context, ids []int64) []*datastore.Key {
 // Joined checks if a user has joined a tournament.
 //
 func (t *Tournament) Joined(c appengine.Context, u *User) bool {
-	// change in contains
-	hasTournament, _ := u.ContainsTournamentID(t.Id)
-	return hasTournament
+	return u.ContainsTournamentID(c, t.Id)
 }
 
 // Join let a user join a tournament.
 //
 func (t *Tournament) Join(c appengine.Context, u *User) error {
-	// add
-	if err := u.AddTournamentID(c, t.Id); err != nil {
-		return fmt.Errorf(" Tournament.Join, error joining tournament for user:%v Error: %v", u.Id, err)
+	if t.Joined(c, u) {
+		return fmt.Errorf(" Tournament.Join, user:%v is allready a participant", u.Id)
 	}
 	if err := t.AddUserID(c, u.Id); err != nil {
 		return fmt.Errorf(" Tournament.Join, error joining tournament for user:%v Error: %v", u.Id, err)
@@ -289,7 +361,7 @@ func IsTournamentAdmin(c appengine.Context, tournamentId int64, userID int64) bo
 //
 func (t *Tournament) AddAdmin(c appengine.Context, id int64) error {
 
-	if ismember, _ := t.ContainsUserID(id); ismember {
+	if t.ContainsUserID(c, id) {
 		if isadmin, _ := t.ContainsAdminID(id); isadmin {
 			return fmt.Errorf("User with %v is already an admin of tournament", id)
 		}
@@ -307,7 +379,7 @@ func (t *Tournament) AddAdmin(c appengine.Context, id int64) error {
 //
 func (t *Tournament) RemoveAdmin(c appengine.Context, id int64) error {
 
-	if ismember, _ := t.ContainsUserID(id); !ismember {
+	if !t.ContainsUserID(c, id) {
 		return fmt.Errorf("User with %v is not a member of the tournament", id)
 	}
 
@@ -364,7 +436,7 @@ func (t *Tournament) TeamJoin(c appengine.Context, team *Team) error {
 	if err = t.AddTeamID(c, team.Id); err != nil {
 		return fmt.Errorf(" Tournament.TeamJoin, error adding team id to tournament entity:%d Error: %v", t.Id, err)
 	}
-	if err = t.AddUserIDs(c, team.UserIds); err != nil {
+	if err = t.AddUserIDs(c, team.UserIDs(c)); err != nil {
 		return fmt.Errorf(" Tournament.TeamJoin, error adding user ids to tournament entity:%d Error: %v", t.Id, err)
 	}
 
@@ -393,17 +465,169 @@ func (t *Tournament) TeamLeave(c appengine.Context, team *Team) error {
 	if err := team.RemovePriceByTournamentID(c, t.Id); err != nil {
 		return fmt.Errorf(" Tournament.TeamJoin, error removing price for team entity:%v Error: %v", team.Id, err)
 	}
+	if err := TeamLeaderboard(team.Id, t.Id).Clear(c); err != nil {
+		log.Errorf(c, " Tournament.TeamLeave, error clearing leaderboard of team:%v Error: %v", team.Id, err)
+	}
 	return nil
 }
 
 // GetWordFrequencyForTournament gets the frequency of given word with respect to tournament id.
 //
 func GetWordFrequencyForTournament(c appengine.Context, id int64, word string) int64 {
+	return int64(WordFrequency(c, TournamentSearchKind, id, word))
+}
+
+// GetTournamentInvertedIndexes returns, given an array of words, the ids of the tournaments that use these words.
+//
+func GetTournamentInvertedIndexes(c appengine.Context, words []string) ([]int64, error) {
+	return InvertedIndexes(c, TournamentSearchKind, words)
+}
+
+// TournamentSearchKind is the name of the tournament kind in the search engine.
+//
+const TournamentSearchKind = "tournament"
+
+// Tournament states, used by the tournament search filters and facets.
+//
+const (
+	TournamentUpcoming = "upcoming"
+	TournamentOngoing  = "ongoing"
+	TournamentFinished = "finished"
+)
+
+// Tournament search facet values of the official filter.
+//
+const (
+	TournamentSearchOfficial   = "official"
+	TournamentSearchUnofficial = "unofficial"
+)
 
-	if tournaments := FindTournaments(c, "Id", id); tournaments != nil {
-		return helpers.CountTerm(strings.Split(tournaments[0].KeyName, " "), word)
+// TournamentSearchSorts are the sort options of a tournament search.
+//
+var TournamentSearchSorts = []string{SearchSortRelevance, SearchSortMembers, SearchSortCreated}
+
+// TournamentSearchOptions holds the filters, the sort option and the page of a tournament search.
+//
+type TournamentSearchOptions struct {
+	State    string // upcoming, ongoing or finished, all tournaments if empty.
+	Official bool   // only the official tournaments.
+	Sort     string
+	Count    int64
+	Page     int64
+}
+
+// State returns whether the tournament is upcoming, ongoing or finished.
+//
+func (t *Tournament) State() string {
+	now := time.Now()
+	if now.Before(t.Start) {
+		return TournamentUpcoming
+	}
+	if now.After(t.End) {
+		return TournamentFinished
 	}
-	return 0
+	return TournamentOngoing
+}
+
+// SearchTournaments returns a page of the tournaments matching the query and the options, the number
+// of tournaments matching and the state and official facets of the tournaments matching the query.
+//
+func SearchTournaments(c appengine.Context, query string, opts TournamentSearchOptions) ([]*Tournament, int64, SearchFacets, error) {
+
+	ids, err := SearchIds(c, TournamentSearchKind, query)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	var tournaments []*Tournament
+	if err = searchBatches(ids, func(batch []int64) error {
+		found, err := TournamentsByIds(c, batch)
+		tournaments = append(tournaments, found...)
+		return err
+	}); err != nil {
+		return nil, 0, nil, err
+	}
+
+	facets := make(SearchFacets)
+	var filtered []*Tournament
+	for _, t := range tournaments {
+		state := t.State()
+		facets.add("State", state)
+
+		official := TournamentSearchUnofficial
+		if t.Official {
+			official = TournamentSearchOfficial
+		}
+		facets.add("Official", official)
+
+		if len(opts.State) > 0 && opts.State != state {
+			continue
+		}
+		if opts.Official && !t.Official {
+			continue
+		}
+		filtered = append(filtered, t)
+	}
+
+	switch opts.Sort {
+	case SearchSortMembers:
+		sort.Stable(TournamentByParticipants(filtered))
+	case SearchSortCreated:
+		sort.Stable(TournamentByCreation(filtered))
+	}
+
+	total := int64(len(filtered))
+	from, to := searchPageBounds(total, opts.Count, opts.Page)
+	return filtered[from:to], total, facets, nil
+}
+
+// TournamentByParticipants type used to sort tournaments by descending number of participants.
+//
+type TournamentByParticipants []*Tournament
+
+func (a TournamentByParticipants) Len() int      { return len(a) }
+func (a TournamentByParticipants) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a TournamentByParticipants) Less(i, j int) bool {
+	return a[i].CountParticipants() > a[j].CountParticipants()
+}
+
+// TournamentByCreation type used to sort tournaments from the most recent to the oldest.
+//
+type TournamentByCreation []*Tournament
+
+func (a TournamentByCreation) Len() int           { return len(a) }
+func (a TournamentByCreation) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a TournamentByCreation) Less(i, j int) bool { return a[i].Created.After(a[j].Created) }
+
+func init() {
+	RegisterSearchKind(SearchKind{
+		Name:      TournamentSearchKind,
+		Entity:    "Tournament",
+		Postings:  "TournamentInvertedIndexShard",
+		Counter:   "WordCountTournament",
+		Fields:    []SearchField{{"Name", 1}},
+		Documents: tournamentSearchDocuments,
+	})
+}
+
+// searchValues returns the values of the tournament fields indexed by the search engine.
+//
+func (t *Tournament) searchValues() []string {
+	return []string{t.Name}
+}
+
+// tournamentSearchDocuments returns the indexed values of the tournaments with the given ids.
+//
+func tournamentSearchDocuments(c appengine.Context, ids []int64) map[int64][]string {
+	documents := make(map[int64][]string)
+	tournaments, err := TournamentsByIds(c, ids)
+	if err != nil {
+		log.Errorf(c, "tournamentSearchDocuments, unable to get tournaments: %v", err)
+	}
+	for _, t := range tournaments {
+		documents[t.Id] = t.searchValues()
+	}
+	return documents
 }
 
 // Reset tournament values: Points, GoalsF, GoalsA to zero.
@@ -464,19 +688,58 @@ func (t *Tournament) Reset(c appengine.Context) error {
 //
 func (t *Tournament) Participants(c appengine.Context) []*User {
 	var users []*User
+	var err error
 
-	for _, uID := range t.UserIds {
-		user, err := UserByID(c, uID)
-		if err != nil {
-			log.Errorf(c, " Participants, cannot find user with Id=%d", uID)
-		} else {
-			users = append(users, user)
-		}
+	if users, err = UsersByIds(c, t.UserIDs(c)); err != nil {
+		log.Errorf(c, " Participants, cannot get participants of tournament %d: %v", t.Id, err)
 	}
 
 	return users
 }
 
+// UserIDs returns the ids of the participants of the tournament, from the oldest
+// participant to the most recent one.
+//
+func (t *Tournament) UserIDs(c appengine.Context) []int64 {
+	if err := t.migrateRelations(c); err != nil {
+		log.Errorf(c, "Tournament.UserIDs: unable to migrate relations of tournament %d: %v", t.Id, err)
+	}
+
+	ids, err := relatedIDs(c, tournamentParticipantKind, "FromId", t.Id)
+	if err != nil {
+		log.Errorf(c, "Tournament.UserIDs: unable to get participants of tournament %d: %v", t.Id, err)
+	}
+	return ids
+}
+
+// CountParticipants returns the number of participants of the tournament,
+// including the participants not moved to relations yet.
+//
+func (t *Tournament) CountParticipants() int64 {
+	if len(t.UserIds) > 0 {
+		return int64(len(t.UserIds))
+	}
+	return t.ParticipantsCount
+}
+
+// ParticipantsByCursor returns a page of the users that participate in the tournament,
+// starting with the most recent ones, and the cursor of the next page.
+//
+func (t *Tournament) ParticipantsByCursor(c appengine.Context, count int64, cursor string) ([]*User, string, error) {
+	if err := t.migrateRelations(c); err != nil {
+		return nil, "", err
+	}
+	ids, next, err := relatedIDsByCursor(c, tournamentParticipantKind, "FromId", t.Id, count, cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	var users []*User
+	if users, err = UsersByIds(c, ids); err != nil {
+		return nil, "", err
+	}
+	return users, next, nil
+}
+
 // Teams returns an array of teams involved in tournament, from a tournament.
 //
 func (t *Tournament) Teams(c appengine.Context) []*Team {
@@ -530,39 +793,83 @@ func (t *Tournament) AddTeamID(c appengine.Context, tID int64) error {
 	return nil
 }
 
-// RemoveUserID removes a user Id in the UserId array.
+// RemoveUserID removes a user from the participants of the tournament.
 //
 func (t *Tournament) RemoveUserID(c appengine.Context, uID int64) error {
 
-	hasUser := false
-	i := 0
-
-	if hasUser, i = t.ContainsUserID(uID); !hasUser {
+	if !t.ContainsUserID(c, uID) {
 		return fmt.Errorf("RemoveUserID, not a member")
 	}
 
-	// as the order of index in usersId is not important,
-	// replace elem at index i with last element and resize slice.
-	t.UserIds[i] = t.UserIds[len(t.UserIds)-1]
-	t.UserIds = t.UserIds[0 : len(t.UserIds)-1]
+	// the legacy tournament ids of the user would restore the participation.
+	if u, err := UserByID(c, uID); err == nil {
+		if err = u.migrateRelations(c); err != nil {
+			return err
+		}
+	}
 
-	if err := t.Update(c); err != nil {
+	if err := removeRelation(c, tournamentParticipantKind, t.Id, uID); err != nil {
 		return err
 	}
-	return nil
+	return t.updateParticipantsCount(c, -1)
 }
 
-// AddUserID adds a user Id in the UserId array.
+// AddUserID adds a user to the participants of the tournament.
 //
 func (t *Tournament) AddUserID(c appengine.Context, uID int64) error {
-	if hasUser, _ := t.ContainsUserID(uID); hasUser {
+	if t.ContainsUserID(c, uID) {
 		return fmt.Errorf("AddUserID, allready a member")
 	}
 
-	t.UserIds = append(t.UserIds, uID)
-	if err := t.Update(c); err != nil {
+	if err := addRelation(c, tournamentParticipantKind, t.Id, uID); err != nil {
+		return err
+	}
+	return t.updateParticipantsCount(c, 1)
+}
+
+// updateParticipantsCount adds delta to the number of participants of the tournament and updates the tournament.
+// The count is read again from the stored tournament in a transaction so that concurrent joins and leaves are all counted.
+func (t *Tournament) updateParticipantsCount(c appengine.Context, delta int64) error {
+	k := TournamentKeyByID(c, t.Id)
+	t.KeyName = helpers.TrimLower(t.Name)
+	var oldTournament *Tournament
+	err := repository.RunInTransaction(c, func(tc appengine.Context) error {
+		oldTournament = new(Tournament)
+		if err := repository.Get(tc, k, oldTournament); err != nil {
+			return err
+		}
+		if t.ParticipantsCount = oldTournament.ParticipantsCount + delta; t.ParticipantsCount < 0 {
+			t.ParticipantsCount = 0
+		}
+		_, err := repository.Put(tc, k, t)
+		return err
+	}, nil)
+	if err == repository.ErrNoSuchEntity {
+		// like Update, a tournament which is not stored is not saved.
+		if t.ParticipantsCount += delta; t.ParticipantsCount < 0 {
+			t.ParticipantsCount = 0
+		}
+		return nil
+	} else if err != nil {
 		return err
 	}
+	changed(c, "Tournament", t.Id)
+	UpdateInvertedIndex(c, TournamentSearchKind, oldTournament.searchValues(), t.searchValues(), t.Id)
+	return nil
+}
+
+// removeParticipants removes all the participants of the tournament.
+func (t *Tournament) removeParticipants(c appengine.Context) error {
+	// the legacy tournament ids of the participants would restore their participation.
+	for _, p := range t.Participants(c) {
+		if err := p.migrateRelations(c); err != nil {
+			return err
+		}
+	}
+	if err := removeRelations(c, tournamentParticipantKind, "FromId", t.Id); err != nil {
+		return err
+	}
+	t.ParticipantsCount = 0
 	return nil
 }
 
@@ -591,14 +898,16 @@ func (t *Tournament) ContainsTeamID(id int64) (bool, int) {
 
 // ContainsUserID checks if user is part of the tournament.
 //
-func (t *Tournament) ContainsUserID(id int64) (bool, int) {
+func (t *Tournament) ContainsUserID(c appengine.Context, id int64) bool {
+	if err := t.migrateRelations(c); err != nil {
+		log.Errorf(c, "Tournament.ContainsUserID: unable to migrate relations of tournament %d: %v", t.Id, err)
+	}
 
-	for i, tID := range t.UserIds {
-		if tID == id {
-			return true, i
-		}
+	ok, err := hasRelation(c, tournamentParticipantKind, t.Id, id)
+	if err != nil {
+		log.Errorf(c, "Tournament.ContainsUserID: unable to get relation: %v", err)
 	}
-	return false, -1
+	return ok
 }
 
 // RankingByUser ranks users with respect to their score in current tournament.
@@ -609,13 +918,24 @@ func (t *Tournament) RankingByUser(c appengine.Context, limit int) []*User {
 	if limit < 0 {
 		return nil
 	}
-	users := t.Participants(c)
-	// set score of user to score of tournament without persisting it.
-	for i, u := range users {
-		users[i].Score = u.ScoreByTournament(c, t.Id)
+	if users := t.leaderboardRanking(c, limit); users != nil {
+		return users
 	}
 
-	sort.Sort(UserByScore(users))
+	key := memcache.Key(c, "tournament-ranking-users", memcache.Namespace("Tournament", t.Id), memcache.KindNamespace("User"), memcache.KindNamespace("Score"))
+	var users []*User
+	if err := memcache.ReadThrough(c, key, RankingCacheTTL, &users, func() error {
+		users = t.Participants(c)
+		// set score of user to score of tournament without persisting it.
+		for i, u := range users {
+			users[i].Score = u.ScoreByTournament(c, t.Id)
+		}
+
+		sort.Sort(UserByScore(users))
+		return nil
+	}); err != nil {
+		log.Errorf(c, "model/tournament, RankingByUser: unable to get ranking: %v", err)
+	}
 
 	if len(users) <= limit {
 		return users
@@ -623,14 +943,58 @@ func (t *Tournament) RankingByUser(c appengine.Context, limit int) []*User {
 	return users[len(users)-limit:]
 }
 
+// leaderboardRanking returns the best users of the tournament leaderboard sorted by their score.
+// It returns nil when the leaderboard does not rank all the participants yet.
+func (t *Tournament) leaderboardRanking(c appengine.Context, limit int) []*User {
+	l := TournamentLeaderboard(t.Id)
+	if n, err := l.Count(c); err != nil || n == 0 || int64(n) < t.CountParticipants() {
+		return nil
+	}
+	positions, err := l.Top(c, 1, limit)
+	if err != nil {
+		log.Errorf(c, "model/tournament, leaderboardRanking: unable to get leaderboard: %v", err)
+		return nil
+	}
+	ids := make([]int64, len(positions))
+	for i, p := range positions {
+		ids[i] = p.UserId
+	}
+	var users []*User
+	if users, err = UsersByIds(c, ids); err != nil {
+		log.Errorf(c, "model/tournament, leaderboardRanking: unable to get users: %v", err)
+		return nil
+	}
+	byID := make(map[int64]*User, len(users))
+	for _, u := range users {
+		byID[u.Id] = u
+	}
+	// positions are sorted by decreasing score, rankings by increasing score.
+	ranking := make([]*User, 0, len(positions))
+	for i := len(positions) - 1; i >= 0; i-- {
+		if u, ok := byID[positions[i].UserId]; ok {
+			u.Score = positions[i].Score
+			ranking = append(ranking, u)
+		}
+	}
+	return ranking
+}
+
 // RankingByTeam ranks teams with respect ot their accuracy in the current tournament.
 //
 func (t *Tournament) RankingByTeam(c appengine.Context, limit int) []*Team {
 	if limit < 0 {
 		return nil
 	}
-	teams := t.Teams(c)
-	sort.Sort(TeamByAccuracy(teams))
+	key := memcache.Key(c, "tournament-ranking-teams", memcache.Namespace("Tournament", t.Id), memcache.KindNamespace("Team"))
+	var teams []*Team
+	if err := memcache.ReadThrough(c, key, RankingCacheTTL, &teams, func() error {
+		teams = t.Teams(c)
+		sort.Sort(TeamByAccuracy(teams))
+		return nil
+	}); err != nil {
+		log.Errorf(c, "model/tournament, RankingByTeam: unable to get ranking: %v", err)
+	}
+
 	if len(teams) <= limit {
 		return teams
 	}
@@ -653,16 +1017,9 @@ func (t *Tournament) Publish(c appengine.Context, activityType string, verb stri
 	if err := activity.save(c); err != nil {
 		return err
 	}
-	// add new activity id in user activity table for each participant of the tournament
-	for _, p := range t.Participants(c) {
-		if err := activity.AddNewActivityID(c, p); err != nil {
-			log.Errorf(c, "model/tournament, Publish: error occurred during AddNewActivityID call: %v", err)
-		} else {
-			if err1 := p.Update(c); err1 != nil {
-				log.Errorf(c, "model/tournament, Publish: error occurred during update call: %v", err1)
-			}
-
-		}
+	// add new activity to the feed of each participant of the tournament
+	if err := activity.addToFeeds(c, t.UserIDs(c)); err != nil {
+		log.Errorf(c, "model/tournament, Publish: error occurred during addToFeeds call: %v", err)
 	}
 
 	return nil
@@ -22,9 +22,9 @@ import (
 	"time"
 
 	"appengine"
-	"appengine/datastore"
 
 	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/repository"
 )
 
 const (
@@ -159,7 +159,6 @@ func CreateChampionsLeague(c appengine.Context, adminID int64) (*Tournament, err
 
 	// matches 2nd stage
 	var matches2ndStageIds []int64
-	var userIds []int64
 	var teamIds []int64
 
 	log.Infof(c, "Champions League: maps ready")
@@ -167,19 +166,19 @@ func CreateChampionsLeague(c appengine.Context, adminID int64) (*Tournament, err
 	// build teams
 	for teamName, teamCode := range clMapTeamCodes {
 
-		teamID, _, err1 := datastore.AllocateIDs(c, "Tteam", nil, 1)
+		teamID, _, err1 := repository.AllocateIDs(c, "Tteam", 1)
 		if err1 != nil {
 			return nil, err1
 		}
 		log.Infof(c, "Champions League: team: %v allocateIDs ok", teamName)
 
-		teamkey := datastore.NewKey(c, "Tteam", "", teamID, nil)
+		teamkey := repository.NewKey("Tteam", "", teamID)
 		log.Infof(c, "Champions League: team: %v NewKey ok", teamName)
 
 		team := &Tteam{teamID, teamName, teamCode}
 		log.Infof(c, "Champions League: team: %v instance of team ok", teamName)
 
-		_, err := datastore.Put(c, teamkey, team)
+		_, err := repository.Put(c, teamkey, team)
 		if err != nil {
 			return nil, err
 		}
@@ -192,14 +191,14 @@ func CreateChampionsLeague(c appengine.Context, adminID int64) (*Tournament, err
 	for _, matchData := range clMatches2ndStage[cQuarterFinals] {
 		log.Infof(c, "Champions League: quarter finals match data: %v", matchData)
 
-		matchID, _, err1 := datastore.AllocateIDs(c, "Tmatch", nil, 1)
+		matchID, _, err1 := repository.AllocateIDs(c, "Tmatch", 1)
 		if err1 != nil {
 			return nil, err1
 		}
 
 		log.Infof(c, "Champions League: match: %v allocateIDs ok", matchID)
 
-		matchkey := datastore.NewKey(c, "Tmatch", "", matchID, nil)
+		matchkey := repository.NewKey("Tmatch", "", matchID)
 		log.Infof(c, "Champions League: match: new key ok")
 
 		matchTime, _ := time.Parse(shortForm, matchData[cMatchDate])
@@ -223,7 +222,7 @@ func CreateChampionsLeague(c appengine.Context, adminID int64) (*Tournament, err
 		}
 		log.Infof(c, "Champions League: match 2nd round: build match ok")
 
-		_, err := datastore.Put(c, matchkey, match)
+		_, err := repository.Put(c, matchkey, match)
 		if err != nil {
 			return nil, err
 		}
@@ -240,14 +239,14 @@ func CreateChampionsLeague(c appengine.Context, adminID int64) (*Tournament, err
 		for _, matchData := range roundMatches {
 			log.Infof(c, "Champions League: second stage match data: %v", matchData)
 
-			matchID, _, err1 := datastore.AllocateIDs(c, "Tmatch", nil, 1)
+			matchID, _, err1 := repository.AllocateIDs(c, "Tmatch", 1)
 			if err1 != nil {
 				return nil, err1
 			}
 
 			log.Infof(c, "Champions League: match: %v allocateIDs ok", matchID)
 
-			matchkey := datastore.NewKey(c, "Tmatch", "", matchID, nil)
+			matchkey := repository.NewKey("Tmatch", "", matchID)
 			log.Infof(c, "Champions League: match: new key ok")
 
 			matchTime, _ := time.Parse(shortForm, matchData[cMatchDate])
@@ -271,7 +270,7 @@ func CreateChampionsLeague(c appengine.Context, adminID int64) (*Tournament, err
 			}
 			log.Infof(c, "Champions League: match 2nd round: build match ok")
 
-			_, err := datastore.Put(c, matchkey, match)
+			_, err := repository.Put(c, matchkey, match)
 			if err != nil {
 				return nil, err
 			}
@@ -297,7 +296,6 @@ func CreateChampionsLeague(c appengine.Context, adminID int64) (*Tournament, err
 	tournament.GroupIds = make([]int64, 0)
 	tournament.Matches1stStage = make([]int64, 0)
 	tournament.Matches2ndStage = matches2ndStageIds
-	tournament.UserIds = userIds
 	tournament.TeamIds = teamIds
 	tournament.TwoLegged = false
 	tournament.IsFirstStageComplete = false
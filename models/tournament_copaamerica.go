@@ -22,9 +22,9 @@ import (
 	"time"
 
 	"appengine"
-	"appengine/datastore"
 
 	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/repository"
 )
 
 // CopaAmericaTournament is a placeholder for the Copa America Tournament.
@@ -248,19 +248,19 @@ func CreateCopaAmerica(c appengine.Context, adminID int64) (*Tournament, error)
 		for i, teamName := range teams {
 			log.Infof(c, "%s: team: %v", desc, teamName)
 
-			teamID, _, err1 := datastore.AllocateIDs(c, "Tteam", nil, 1)
+			teamID, _, err1 := repository.AllocateIDs(c, "Tteam", 1)
 			if err1 != nil {
 				return nil, err1
 			}
 			log.Infof(c, "%s: team: %v allocateIDs ok", desc, teamName)
 
-			teamkey := datastore.NewKey(c, "Tteam", "", teamID, nil)
+			teamkey := repository.NewKey("Tteam", "", teamID)
 			log.Infof(c, "%s: team: %v NewKey ok", desc, teamName)
 
 			team := &Tteam{teamID, teamName, mapCountryCodes[teamName]}
 			log.Infof(c, "%s: team: %v instance of team ok", desc, teamName)
 
-			_, err := datastore.Put(c, teamkey, team)
+			_, err := repository.Put(c, teamkey, team)
 			if err != nil {
 				return nil, err
 			}
@@ -278,14 +278,14 @@ func CreateCopaAmerica(c appengine.Context, adminID int64) (*Tournament, error)
 		for matchIndex, matchData := range groupMatches {
 			log.Infof(c, "%s: match data: %v", desc, matchData)
 
-			matchID, _, err1 := datastore.AllocateIDs(c, "Tmatch", nil, 1)
+			matchID, _, err1 := repository.AllocateIDs(c, "Tmatch", 1)
 			if err1 != nil {
 				return nil, err1
 			}
 
 			log.Infof(c, "%s: match: %v allocateIDs ok", desc, matchID)
 
-			matchkey := datastore.NewKey(c, "Tmatch", "", matchID, nil)
+			matchkey := repository.NewKey("Tmatch", "", matchID)
 			log.Infof(c, "%s: match: new key ok", desc)
 
 			matchTime, _ := time.Parse(shortForm, matchData[cMatchDate])
@@ -309,7 +309,7 @@ func CreateCopaAmerica(c appengine.Context, adminID int64) (*Tournament, error)
 
 			log.Infof(c, "%s: match: build match ok", desc)
 
-			_, err := datastore.Put(c, matchkey, match)
+			_, err := repository.Put(c, matchkey, match)
 			if err != nil {
 				return nil, err
 			}
@@ -320,19 +320,19 @@ func CreateCopaAmerica(c appengine.Context, adminID int64) (*Tournament, error)
 			matches1stStageIds[int64(matchInternalID)-1] = matchID
 		}
 
-		groupID, _, err1 := datastore.AllocateIDs(c, "Tgroup", nil, 1)
+		groupID, _, err1 := repository.AllocateIDs(c, "Tgroup", 1)
 		if err1 != nil {
 			return nil, err1
 		}
 
 		log.Infof(c, "%s: Group: %v allocate Id ok", desc, groupName)
 
-		groupkey := datastore.NewKey(c, "Tgroup", "", groupID, nil)
+		groupkey := repository.NewKey("Tgroup", "", groupID)
 		log.Infof(c, "%s: Group: %v New Key ok", desc, groupName)
 
 		group.Id = groupID
 		groups[groupIndex] = group
-		_, err := datastore.Put(c, groupkey, &group)
+		_, err := repository.Put(c, groupkey, &group)
 		if err != nil {
 			return nil, err
 		}
@@ -349,7 +349,6 @@ func CreateCopaAmerica(c appengine.Context, adminID int64) (*Tournament, error)
 
 	// matches 2nd stage
 	var matches2ndStageIds []int64
-	var userIds []int64
 	var teamIds []int64
 
 	// mapMatches2ndRound  is a map where the key is a string which represent the rounds
@@ -364,14 +363,14 @@ func CreateCopaAmerica(c appengine.Context, adminID int64) (*Tournament, error)
 		for _, matchData := range roundMatches {
 			log.Infof(c, "%s: second phase match data: %v", desc, matchData)
 
-			matchID, _, err1 := datastore.AllocateIDs(c, "Tmatch", nil, 1)
+			matchID, _, err1 := repository.AllocateIDs(c, "Tmatch", 1)
 			if err1 != nil {
 				return nil, err1
 			}
 
 			log.Infof(c, "%s: match: %v allocateIDs ok", desc, matchID)
 
-			matchkey := datastore.NewKey(c, "Tmatch", "", matchID, nil)
+			matchkey := repository.NewKey("Tmatch", "", matchID)
 			log.Infof(c, "%s: match: new key ok", desc)
 
 			matchTime, _ := time.Parse(shortForm, matchData[cMatchDate])
@@ -395,7 +394,7 @@ func CreateCopaAmerica(c appengine.Context, adminID int64) (*Tournament, error)
 			}
 			log.Infof(c, "%s: match 2nd round: build match ok", desc)
 
-			_, err := datastore.Put(c, matchkey, match)
+			_, err := repository.Put(c, matchkey, match)
 			if err != nil {
 				return nil, err
 			}
@@ -419,7 +418,6 @@ func CreateCopaAmerica(c appengine.Context, adminID int64) (*Tournament, error)
 		tournament.GroupIds = groupIds
 		tournament.Matches1stStage = matches1stStageIds
 		tournament.Matches2ndStage = matches2ndStageIds
-		tournament.UserIds = userIds
 		tournament.TeamIds = teamIds
 		tournament.IsFirstStageComplete = false
 		if err1 := tournament.Update(c); err1 != nil {
@@ -20,10 +20,10 @@ import (
 	"math/rand"
 
 	"appengine"
-	"appengine/datastore"
 
 	"github.com/taironas/gonawin/helpers"
 	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/repository"
 )
 
 // Tgroup represents the group of teams of a tournament
@@ -42,9 +42,9 @@ type Tgroup struct {
 //
 func GroupByID(c appengine.Context, groupID int64) (*Tgroup, error) {
 	var g Tgroup
-	key := datastore.NewKey(c, "Tgroup", "", groupID, nil)
+	key := repository.NewKey("Tgroup", "", groupID)
 
-	if err := datastore.Get(c, key, &g); err != nil {
+	if err := repository.Get(c, key, &g); err != nil {
 		log.Errorf(c, "group not found : %v", err)
 		return &g, err
 	}
@@ -71,20 +71,20 @@ func Groups(c appengine.Context, groupIDs []int64) []*Tgroup {
 
 // GroupKeyByID gets pointer to a group key given a group id.
 //
-func GroupKeyByID(c appengine.Context, Id int64) *datastore.Key {
+func GroupKeyByID(c appengine.Context, Id int64) *repository.Key {
 
-	key := datastore.NewKey(c, "Tgroup", "", Id, nil)
+	key := repository.NewKey("Tgroup", "", Id)
 	return key
 }
 
 // UpdateGroups updates an array of groups.
 //
 func UpdateGroups(c appengine.Context, groups []*Tgroup) error {
-	keys := make([]*datastore.Key, len(groups))
+	keys := make([]*repository.Key, len(groups))
 	for i := range keys {
 		keys[i] = GroupKeyByID(c, groups[i].Id)
 	}
-	if _, err := datastore.PutMulti(c, keys, groups); err != nil {
+	if _, err := repository.PutMulti(c, keys, groups); err != nil {
 		return err
 	}
 	return nil
@@ -95,8 +95,8 @@ func UpdateGroups(c appengine.Context, groups []*Tgroup) error {
 func UpdateGroup(c appengine.Context, g *Tgroup) error {
 	k := GroupKeyByID(c, g.Id)
 	oldGroup := new(Tgroup)
-	if err := datastore.Get(c, k, oldGroup); err == nil {
-		if _, err = datastore.Put(c, k, g); err != nil {
+	if err := repository.Get(c, k, oldGroup); err == nil {
+		if _, err = repository.Put(c, k, g); err != nil {
 			return err
 		}
 	}
@@ -106,11 +106,11 @@ func UpdateGroup(c appengine.Context, g *Tgroup) error {
 // DestroyGroups destroys an array of groups.
 //
 func DestroyGroups(c appengine.Context, groupIDs []int64) error {
-	keys := make([]*datastore.Key, len(groupIDs))
+	keys := make([]*repository.Key, len(groupIDs))
 	for i := range keys {
 		keys[i] = GroupKeyByID(c, groupIDs[i])
 	}
-	if err := datastore.DeleteMulti(c, keys); err != nil {
+	if err := repository.DeleteMulti(c, keys); err != nil {
 		return err
 	}
 	return nil
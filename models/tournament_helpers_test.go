@@ -31,8 +31,8 @@ func checkTournament(got *Tournament, want *testTournament) error {
 		s = fmt.Sprintf("want End == %v, got %v", want.end, got.End)
 	} else if got.AdminIds[0] != want.adminID {
 		s = fmt.Sprintf("want AdminId == %d, got %d", want.adminID, got.AdminIds[0])
-	} else if len(got.UserIds) != len(want.userIDs) {
-		s = fmt.Sprintf("want UserIds count == %d, got %d", len(want.userIDs), len(got.UserIds))
+	} else if got.CountParticipants() != int64(len(want.userIDs)) {
+		s = fmt.Sprintf("want participants count == %d, got %d", len(want.userIDs), got.CountParticipants())
 	} else {
 		return nil
 	}
@@ -22,10 +22,10 @@ import (
 	"time"
 
 	"appengine"
-	"appengine/datastore"
 
 	"github.com/taironas/gonawin/helpers"
 	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/repository"
 )
 
 // Tmatch represents a tournament match.
@@ -45,13 +45,21 @@ type Tmatch struct {
 	CanPredict bool      // can user make a prediction (used to block predictions when match has started).
 }
 
+// IsLocked checks if the predictions on the match are over: the match is finished, or
+// its predictions are blocked and it has started. Predictions are still open while
+// CanPredict is true, even after the date of the match.
+//
+func (m *Tmatch) IsLocked() bool {
+	return m.Finished || (!m.CanPredict && !time.Now().Before(m.Date))
+}
+
 // MatchByID gets a Tmatch entity by id.
 //
 func MatchByID(c appengine.Context, matchID int64) (*Tmatch, error) {
 	var m Tmatch
-	key := datastore.NewKey(c, "Tmatch", "", matchID, nil)
+	key := repository.NewKey("Tmatch", "", matchID)
 
-	if err := datastore.Get(c, key, &m); err != nil {
+	if err := repository.Get(c, key, &m); err != nil {
 		log.Errorf(c, "match not found : %v", err)
 		return &m, err
 	}
@@ -93,8 +101,8 @@ func GetMatchByIDNumber(c appengine.Context, tournament Tournament, matchInterna
 
 // MatchKeyByID returns a pointer to a match key given a match id.
 //
-func MatchKeyByID(c appengine.Context, id int64) *datastore.Key {
-	key := datastore.NewKey(c, "Tmatch", "", id, nil)
+func MatchKeyByID(c appengine.Context, id int64) *repository.Key {
+	key := repository.NewKey("Tmatch", "", id)
 	return key
 }
 
@@ -103,10 +111,11 @@ func MatchKeyByID(c appengine.Context, id int64) *datastore.Key {
 func UpdateMatch(c appengine.Context, m *Tmatch) error {
 	k := MatchKeyByID(c, m.Id)
 	oldMatch := new(Tmatch)
-	if err := datastore.Get(c, k, oldMatch); err == nil {
-		if _, err = datastore.Put(c, k, m); err != nil {
+	if err := repository.Get(c, k, oldMatch); err == nil {
+		if _, err = repository.Put(c, k, m); err != nil {
 			return err
 		}
+		changed(c, "Tmatch", m.Id)
 	}
 	return nil
 }
@@ -114,26 +123,30 @@ func UpdateMatch(c appengine.Context, m *Tmatch) error {
 // UpdateMatches updates an array of matches.
 //
 func UpdateMatches(c appengine.Context, matches []*Tmatch) error {
-	keys := make([]*datastore.Key, len(matches))
+	keys := make([]*repository.Key, len(matches))
+	ids := make([]int64, len(matches))
 	for i := range keys {
 		keys[i] = MatchKeyByID(c, matches[i].Id)
+		ids[i] = matches[i].Id
 	}
-	if _, err := datastore.PutMulti(c, keys, matches); err != nil {
+	if _, err := repository.PutMulti(c, keys, matches); err != nil {
 		return err
 	}
+	changed(c, "Tmatch", ids...)
 	return nil
 }
 
 // DestroyMatches destroys an array of matches.
 //
 func DestroyMatches(c appengine.Context, matchIds []int64) error {
-	keys := make([]*datastore.Key, len(matchIds))
+	keys := make([]*repository.Key, len(matchIds))
 	for i := range keys {
 		keys[i] = MatchKeyByID(c, matchIds[i])
 	}
-	if err := datastore.DeleteMulti(c, keys); err != nil {
+	if err := repository.DeleteMulti(c, keys); err != nil {
 		return err
 	}
+	changed(c, "Tmatch", matchIds...)
 	return nil
 }
 
@@ -161,6 +174,8 @@ func SetResults(c appengine.Context, matches []*Tmatch, results1 []int64, result
 		log.Errorf(c, "%s unable to set results on matches: %v", desc, err)
 		return err
 	}
+	// store the values of the challenges for the matchdays that are over.
+	t.RecordChallengeDays(c)
 	allMatches := GetAllMatchesFromTournament(c, t)
 	phases := MatchesGroupByPhase(t, allMatches)
 
@@ -184,6 +199,14 @@ func SetResults(c appengine.Context, matches []*Tmatch, results1 []int64, result
 			if int(phaseID+1) < len(phases) {
 				UpdateNextPhase(c, t, &phases[phaseID], &phases[phaseID+1])
 			}
+			// phase is over, declare the winners of the challenges of this phase.
+			t.ResolveChallenges(c, phases[phaseID].Name, int(phaseID+1) == len(phases))
+			if int(phaseID+1) == len(phases) {
+				// tournament is over, declare the winners of the prices of each team.
+				if err := t.AddResolvePricesTask(c); err != nil {
+					log.Errorf(c, "%s unable to add task to resolve the prices: %v", desc, err)
+				}
+			}
 			log.Infof(c, "%s -------------------------------------------------->", desc)
 			// update flag first phase complete.
 			if phaseID == 0 {
@@ -217,6 +240,9 @@ func SetResult(c appengine.Context, m *Tmatch, result1 int64, result2 int64, t *
 		return err
 	}
 
+	// store the values of the challenges for the matchdays that are over.
+	t.RecordChallengeDays(c)
+
 	// update score for all users.
 	if err1 := t.UpdateUsersScore(c, m); err1 != nil {
 		log.Errorf(c, "%s unable to update users score on match with id: %v, %v", desc, m.Id, err)
@@ -244,6 +270,10 @@ func SetResult(c appengine.Context, m *Tmatch, result1 int64, result2 int64, t *
 			if int(phaseID+1) < len(phases) {
 				UpdateNextPhase(c, t, &phases[phaseID], &phases[phaseID+1])
 			}
+			// phase is over, declare the winners of the challenges of this phase.
+			// the tournament is over when phaseID is the last phase, the winners of the prices of each team
+			// are declared by the update scores task, once the scores of the match are added.
+			t.ResolveChallenges(c, phases[phaseID].Name, int(phaseID+1) == len(phases))
 			log.Infof(c, "%s -------------------------------------------------->", desc)
 			// update flag first phase complete.
 			if phaseID == 0 {
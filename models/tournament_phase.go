@@ -66,6 +66,14 @@ func lastMatchOfPhase(c appengine.Context, m *Tmatch, phases *[]Tphase) (bool, i
 	return false, int64(-1)
 }
 
+// IsLastMatch returns true if the match m is the last match of the last phase of the tournament.
+//
+func (t *Tournament) IsLastMatch(c appengine.Context, m *Tmatch) bool {
+	phases := MatchesGroupByPhase(t, GetAllMatchesFromTournament(c, t))
+	isLast, phaseID := lastMatchOfPhase(c, m, &phases)
+	return isLast && int(phaseID+1) == len(phases)
+}
+
 // UpdateNextPhase updates next phase in tournament.
 //
 func UpdateNextPhase(c appengine.Context, t *Tournament, currentphase *Tphase, nextphase *Tphase) error {
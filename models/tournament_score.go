@@ -22,10 +22,10 @@ import (
 	"net/url"
 
 	"appengine"
-	"appengine/taskqueue"
 
 	"github.com/taironas/gonawin/helpers"
 	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/taskqueue"
 )
 
 // UpdateUsersScore updates the score of the participants to the tournament.
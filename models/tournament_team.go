@@ -21,9 +21,9 @@ import (
 	"strings"
 
 	"appengine"
-	"appengine/datastore"
 
 	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/repository"
 )
 
 // Tteam represents a tournament team.
@@ -38,9 +38,9 @@ type Tteam struct {
 //
 func TTeamByID(c appengine.Context, teamID int64) (*Tteam, error) {
 	var t Tteam
-	key := datastore.NewKey(c, "Tteam", "", teamID, nil)
+	key := repository.NewKey("Tteam", "", teamID)
 
-	if err := datastore.Get(c, key, &t); err != nil {
+	if err := repository.Get(c, key, &t); err != nil {
 		log.Errorf(c, "team not found : %v", err)
 		return nil, err
 	}
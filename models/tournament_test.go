@@ -5,10 +5,10 @@ import (
 	"time"
 
 	"appengine/aetest"
-	"appengine/datastore"
 
 	"github.com/taironas/gonawin/helpers"
 	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/repository"
 )
 
 func TestCreateTournament(t *testing.T) {
@@ -88,7 +88,7 @@ func TestTournamentDestroy(t *testing.T) {
 	// perform a get query so that the results of the unapplied write are visible to subsequent global queries.
 	dummy := Tournament{}
 	key := TournamentKeyByID(c, tournament.Id)
-	if err := datastore.Get(c, key, &dummy); err != nil {
+	if err := repository.Get(c, key, &dummy); err != nil {
 		t.Fatal(err)
 	}
 
@@ -187,7 +187,7 @@ func TestFindTournaments(t *testing.T) {
 				// perform a get query so that the results of the unapplied write are visible to subsequent global queries.
 				dummy := Tournament{}
 				key := TournamentKeyByID(c, got.Id)
-				if err := datastore.Get(c, key, &dummy); err != nil {
+				if err := repository.Get(c, key, &dummy); err != nil {
 					t.Fatal(err)
 				}
 			}
@@ -210,3 +210,41 @@ func TestFindTournaments(t *testing.T) {
 		}
 	}
 }
+
+// TestRevealsPredictions tests when the predictions on a match are revealed for each visibility of a tournament.
+//
+func TestRevealsPredictions(t *testing.T) {
+	tomorrow := time.Now().Add(24 * time.Hour)
+	yesterday := time.Now().Add(-24 * time.Hour)
+
+	open := &Tmatch{Date: tomorrow, CanPredict: true}
+	blocked := &Tmatch{Date: tomorrow}
+	late := &Tmatch{Date: yesterday, CanPredict: true}
+	started := &Tmatch{Date: yesterday}
+	finished := &Tmatch{Date: yesterday, CanPredict: true, Finished: true}
+
+	tests := []struct {
+		title      string
+		visibility string
+		match      *Tmatch
+		want       bool
+	}{
+		{"always visible", PredictionsAlwaysVisible, open, true},
+		{"hidden before kickoff by default", "", open, false},
+		{"hidden before kickoff", PredictionsAtKickoff, open, false},
+		{"hidden before kickoff when blocked", PredictionsAtKickoff, blocked, false},
+		{"hidden after kickoff while predictions are open", PredictionsAtKickoff, late, false},
+		{"revealed at kickoff", PredictionsAtKickoff, started, true},
+		{"revealed when finished", PredictionsAtKickoff, finished, true},
+		{"hidden after kickoff until the final whistle", PredictionsAtFinalWhistle, started, false},
+		{"revealed at the final whistle", PredictionsAtFinalWhistle, finished, true},
+	}
+
+	for _, test := range tests {
+		t.Log(test.title)
+		tournament := &Tournament{PredictionVisibility: test.visibility}
+		if got := tournament.RevealsPredictions(test.match); got != test.want {
+			t.Errorf("test %q - error: expected %v got %v", test.title, test.want, got)
+		}
+	}
+}
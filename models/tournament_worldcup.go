@@ -22,9 +22,9 @@ import (
 	"time"
 
 	"appengine"
-	"appengine/datastore"
 
 	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/repository"
 )
 
 const (
@@ -343,19 +343,19 @@ func CreateWorldCup(c appengine.Context, adminID int64) (*Tournament, error) {
 		for i, teamName := range teams {
 			log.Infof(c, "World Cup: team: %v", teamName)
 
-			teamID, _, err1 := datastore.AllocateIDs(c, "Tteam", nil, 1)
+			teamID, _, err1 := repository.AllocateIDs(c, "Tteam", 1)
 			if err1 != nil {
 				return nil, err1
 			}
 			log.Infof(c, "World Cup: team: %v allocateIDs ok", teamName)
 
-			teamkey := datastore.NewKey(c, "Tteam", "", teamID, nil)
+			teamkey := repository.NewKey("Tteam", "", teamID)
 			log.Infof(c, "World Cup: team: %v NewKey ok", teamName)
 
 			team := &Tteam{teamID, teamName, mapCountryCodes[teamName]}
 			log.Infof(c, "World Cup: team: %v instance of team ok", teamName)
 
-			_, err := datastore.Put(c, teamkey, team)
+			_, err := repository.Put(c, teamkey, team)
 			if err != nil {
 				return nil, err
 			}
@@ -373,14 +373,14 @@ func CreateWorldCup(c appengine.Context, adminID int64) (*Tournament, error) {
 		for matchIndex, matchData := range groupMatches {
 			log.Infof(c, "World Cup: match data: %v", matchData)
 
-			matchID, _, err1 := datastore.AllocateIDs(c, "Tmatch", nil, 1)
+			matchID, _, err1 := repository.AllocateIDs(c, "Tmatch", 1)
 			if err1 != nil {
 				return nil, err1
 			}
 
 			log.Infof(c, "World Cup: match: %v allocateIDs ok", matchID)
 
-			matchkey := datastore.NewKey(c, "Tmatch", "", matchID, nil)
+			matchkey := repository.NewKey("Tmatch", "", matchID)
 			log.Infof(c, "World Cup: match: new key ok")
 
 			matchTime, _ := time.Parse(shortForm, matchData[cMatchDate])
@@ -403,7 +403,7 @@ func CreateWorldCup(c appengine.Context, adminID int64) (*Tournament, error) {
 			}
 			log.Infof(c, "World Cup: match: build match ok")
 
-			_, err := datastore.Put(c, matchkey, match)
+			_, err := repository.Put(c, matchkey, match)
 			if err != nil {
 				return nil, err
 			}
@@ -414,19 +414,19 @@ func CreateWorldCup(c appengine.Context, adminID int64) (*Tournament, error) {
 			matches1stStageIds[int64(matchInternalID)-1] = matchID
 		}
 
-		groupID, _, err1 := datastore.AllocateIDs(c, "Tgroup", nil, 1)
+		groupID, _, err1 := repository.AllocateIDs(c, "Tgroup", 1)
 		if err1 != nil {
 			return nil, err1
 		}
 
 		log.Infof(c, "World Cup: Group: %v allocate Id ok", groupName)
 
-		groupkey := datastore.NewKey(c, "Tgroup", "", groupID, nil)
+		groupkey := repository.NewKey("Tgroup", "", groupID)
 		log.Infof(c, "World Cup: Group: %v New Key ok", groupName)
 
 		group.Id = groupID
 		groups[groupIndex] = group
-		_, err := datastore.Put(c, groupkey, &group)
+		_, err := repository.Put(c, groupkey, &group)
 		if err != nil {
 			return nil, err
 		}
@@ -443,7 +443,6 @@ func CreateWorldCup(c appengine.Context, adminID int64) (*Tournament, error) {
 
 	// matches 2nd stage
 	var matches2ndStageIds []int64
-	var userIds []int64
 	var teamIds []int64
 	// mapMatches2ndRound  is a map where the key is a string which represent the rounds
 	// the key is a two dimensional string array. each element in the array represent a specific field in the match
@@ -457,14 +456,14 @@ func CreateWorldCup(c appengine.Context, adminID int64) (*Tournament, error) {
 		for _, matchData := range roundMatches {
 			log.Infof(c, "World Cup: second phase match data: %v", matchData)
 
-			matchID, _, err1 := datastore.AllocateIDs(c, "Tmatch", nil, 1)
+			matchID, _, err1 := repository.AllocateIDs(c, "Tmatch", 1)
 			if err1 != nil {
 				return nil, err1
 			}
 
 			log.Infof(c, "World Cup: match: %v allocateIDs ok", matchID)
 
-			matchkey := datastore.NewKey(c, "Tmatch", "", matchID, nil)
+			matchkey := repository.NewKey("Tmatch", "", matchID)
 			log.Infof(c, "World Cup: match: new key ok")
 
 			matchTime, _ := time.Parse(shortForm, matchData[cMatchDate])
@@ -488,7 +487,7 @@ func CreateWorldCup(c appengine.Context, adminID int64) (*Tournament, error) {
 			}
 			log.Infof(c, "World Cup: match 2nd round: build match ok")
 
-			_, err := datastore.Put(c, matchkey, match)
+			_, err := repository.Put(c, matchkey, match)
 			if err != nil {
 				return nil, err
 			}
@@ -512,7 +511,6 @@ func CreateWorldCup(c appengine.Context, adminID int64) (*Tournament, error) {
 		tournament.GroupIds = groupIds
 		tournament.Matches1stStage = matches1stStageIds
 		tournament.Matches2ndStage = matches2ndStageIds
-		tournament.UserIds = userIds
 		tournament.TeamIds = teamIds
 		tournament.IsFirstStageComplete = false
 		if err1 := tournament.Update(c); err1 != nil {
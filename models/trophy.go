@@ -0,0 +1,115 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"appengine"
+
+	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/repository"
+)
+
+// A Trophy entity is the reward a team gets when winning a challenge against another team.
+// It is built the same way as a Price: bound to a single team and a single tournament.
+//
+type Trophy struct {
+	Id             int64     // trophy id
+	TeamId         int64     // team id, a trophy is binded to a single team.
+	TournamentId   int64     // tournament id, the tournament where the trophy was won.
+	TournamentName string    // tournament name.
+	ChallengeId    int64     // id of the challenge won by the team.
+	Description    string    // the description of the trophy
+	Created        time.Time // date of creation
+}
+
+// CreateTrophy creates a Trophy entity given a team id, a tournament, a challenge id and a description.
+//
+func CreateTrophy(c appengine.Context, teamID, tournamentID int64, tournamentName string, challengeID int64, description string) (*Trophy, error) {
+
+	tID, _, err := repository.AllocateIDs(c, "Trophy", 1)
+	if err != nil {
+		return nil, err
+	}
+	key := repository.NewKey("Trophy", "", tID)
+	t := &Trophy{tID, teamID, tournamentID, tournamentName, challengeID, description, time.Now()}
+	if _, err = repository.Put(c, key, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Destroy a Trophy entity.
+//
+func (t *Trophy) Destroy(c appengine.Context) error {
+
+	if _, err := TrophyByID(c, t.Id); err != nil {
+		return fmt.Errorf("Cannot find trophy with Id=%d", t.Id)
+	}
+
+	key := repository.NewKey("Trophy", "", t.Id)
+
+	return repository.Delete(c, key)
+}
+
+// FindTrophiesByTeam searches for all Trophy entities given a team id.
+//
+func FindTrophiesByTeam(c appengine.Context, teamID int64) []*Trophy {
+	desc := "Trophy.FindTrophiesByTeam:"
+	q := repository.NewQuery("Trophy").
+		Filter("TeamId"+" =", teamID)
+
+	var trophies []*Trophy
+
+	if _, err := q.GetAll(c, &trophies); err != nil {
+		log.Errorf(c, "%s an error occurred during GetAll: %v", desc, err)
+		return nil
+	}
+
+	return trophies
+}
+
+// TrophyByID gets a Trophy given an id.
+//
+func TrophyByID(c appengine.Context, id int64) (*Trophy, error) {
+
+	var t Trophy
+	key := repository.NewKey("Trophy", "", id)
+
+	if err := repository.Get(c, key, &t); err != nil {
+		log.Errorf(c, "Trophy not found : %v", err)
+		return &t, err
+	}
+	return &t, nil
+}
+
+// TrophiesByIds gets an array of pointers to Trophy entities with respect to an array of ids.
+//
+func TrophiesByIds(c appengine.Context, ids []int64) []*Trophy {
+
+	var trophies []*Trophy
+	for _, id := range ids {
+		if t, err := TrophyByID(c, id); err == nil {
+			trophies = append(trophies, t)
+		} else {
+			log.Errorf(c, " Trophies.ByIds, error occurred during ByIds call: %v", err)
+		}
+	}
+	return trophies
+}
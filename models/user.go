@@ -17,19 +17,18 @@
 package models
 
 import (
-	"crypto/rand"
 	"errors"
 	"fmt"
-	"io"
+	"sort"
 	"strings"
 	"time"
 
 	"appengine"
-	"appengine/datastore"
-	gaeuser "appengine/user"
 
 	"github.com/taironas/gonawin/helpers"
 	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/helpers/platform"
+	"github.com/taironas/gonawin/repository"
 )
 
 // ScoreOfTournament holds the user's score for a tournament.
@@ -48,16 +47,18 @@ type User struct {
 	Name                  string
 	Alias                 string              // name to display chosen by user if requested.
 	IsAdmin               bool                // is user gonawin admin.
-	Auth                  string              // authentication auth token
-	PredictIds            []int64             // current user predicts.
+	Auth                  string              `json:"-"` // legacy authentication key, users now authenticate with sessions.
+	PredictIds            []int64             // legacy ids of user predicts, predicts are now queried by user id.
 	ArchivedPredictInds   []int64             // archived user predicts.
-	TournamentIds         []int64             // current tournament ids of user <=> tournaments user subscribed.
+	TournamentIds         []int64             // legacy ids of tournaments user subscribed, moved to TournamentParticipant relations.
 	ArchivedTournamentIds []int64             // archived tournament ids of user <=> finnished tournametns user subscribed.
-	TeamIds               []int64             // current team ids of user <=> teams user belongs to.
+	TeamIds               []int64             // legacy ids of teams user belongs to, moved to TeamMember relations.
 	Score                 int64               // overall user score.
 	ScoreOfTournaments    []ScoreOfTournament // ids of Scores for each tournament the user is participating on.
-	ActivityIds           []int64             // ids of user's activities
+	ActivityIds           []int64             // legacy ids of user's activities, moved to UserActivity relations.
 	Created               time.Time
+	BlockedIds            []int64     // ids of users blocked by the user.
+	Privacy               UserPrivacy // privacy settings of the user.
 }
 
 // UserJSON is the JSON representation of the User entity.
@@ -69,7 +70,7 @@ type UserJSON struct {
 	Name                  *string              `json:",omitempty"`
 	Alias                 *string              `json:",omitempty"`
 	IsAdmin               *bool                `json:",omitempty"`
-	Auth                  *string              `json:",omitempty"`
+	Auth                  *string              `json:"-"`
 	PredictIds            *[]int64             `json:",omitempty"`
 	ArchivedPredictInds   *[]int64             `json:",omitempty"`
 	TournamentIds         *[]int64             `json:",omitempty"`
@@ -79,18 +80,20 @@ type UserJSON struct {
 	ScoreOfTournaments    *[]ScoreOfTournament `json:",omitempty"`
 	ActivityIds           *[]int64             `json:",omitempty"`
 	Created               *time.Time           `json:",omitempty"`
+	BlockedIds            *[]int64             `json:",omitempty"`
+	Privacy               *UserPrivacy         `json:",omitempty"`
 }
 
 // CreateUser lets you create a user entity.
 //
 func CreateUser(c appengine.Context, email, username, name, alias string, isAdmin bool, auth string) (*User, error) {
 
-	userID, _, err := datastore.AllocateIDs(c, "User", nil, 1)
+	userID, _, err := repository.AllocateIDs(c, "User", 1)
 	if err != nil {
 		log.Errorf(c, " User.Create: %v", err)
 	}
 
-	key := datastore.NewKey(c, "User", "", userID, nil)
+	key := repository.NewKey("User", "", userID)
 
 	var emptyArray []int64
 	var emptyScores []ScoreOfTournament
@@ -98,36 +101,25 @@ func CreateUser(c appengine.Context, email, username, name, alias string, isAdmi
 		Id:                    userID,
 		Email:                 email,
 		Username:              username,
-		Name:                  name,
+		Name:                name,
 		Alias:                 alias,
 		IsAdmin:               isAdmin,
 		Auth:                  auth,
-		PredictIds:            emptyArray,
 		ArchivedPredictInds:   emptyArray,
-		TournamentIds:         emptyArray,
 		ArchivedTournamentIds: emptyArray,
-		TeamIds:               emptyArray,
 		Score:                 int64(0),
 		ScoreOfTournaments:    emptyScores,
-		ActivityIds:           emptyArray,
 		Created:               time.Now(),
+		BlockedIds:            emptyArray,
 	}
 
-	if _, err = datastore.Put(c, key, user); err != nil {
+	if _, err = repository.Put(c, key, user); err != nil {
 		log.Errorf(c, "User.Create: %v", err)
 		return nil, errors.New("model/user: Unable to put user in Datastore")
 	}
 
-	// add name to inverted index
-	// as name and username can have the same words.
-	// We build a string with a set of words between these two strings
-	allnames := name + " " + username
-	setOfNames := helpers.SetOfStrings(allnames)
-	names := ""
-	for _, n := range setOfNames {
-		names = names + " " + n
-	}
-	AddToUserInvertedIndex(c, names, user.Id)
+	// add name, username and alias to inverted index
+	UpdateInvertedIndex(c, UserSearchKind, nil, user.searchValues(), user.Id)
 
 	return user, nil
 }
@@ -142,33 +134,35 @@ func (u *User) Destroy(c appengine.Context) error {
 		return fmt.Errorf("Cannot find user with Id=%d", u.Id)
 	}
 
-	key := datastore.NewKey(c, "User", "", u.Id, nil)
+	key := repository.NewKey("User", "", u.Id)
 
-	if errd := datastore.Delete(c, key); errd != nil {
+	if errd := repository.Delete(c, key); errd != nil {
 		return errd
 	}
+	changed(c, "User", u.Id)
 
-	// remove key name.
-	if err = UpdateUserInvertedIndex(c, helpers.TrimLower(u.Name), "", u.Id); err != nil {
-		return err
+	// sign out all the devices of the user.
+	if err = DestroyUserSessions(c, u.Id); err != nil {
+		log.Errorf(c, "User.Destroy: unable to delete sessions of user %d: %v", u.Id, err)
 	}
-	// remove key username.
-	if err = UpdateUserInvertedIndex(c, helpers.TrimLower(u.Username), "", u.Id); err != nil {
-		return err
+	// revoke the personal access tokens of the user.
+	if err = DestroyUserAccessTokens(c, u.Id); err != nil {
+		log.Errorf(c, "User.Destroy: unable to delete access tokens of user %d: %v", u.Id, err)
 	}
-	// remove key alias.
-	if err = UpdateUserInvertedIndex(c, helpers.TrimLower(u.Alias), "", u.Id); err != nil {
-		return err
+	// unlink the accounts the user signs in with.
+	if err = DestroyUserIdentities(c, u.Id); err != nil {
+		log.Errorf(c, "User.Destroy: unable to delete identities of user %d: %v", u.Id, err)
 	}
 
-	return nil
+	// remove key name, username and alias.
+	return UpdateInvertedIndex(c, UserSearchKind, u.searchValues(), nil, u.Id)
 }
 
 // FindUser searches for a user entity given a filter and value.
 //
 func FindUser(c appengine.Context, filter string, value interface{}) *User {
 
-	q := datastore.NewQuery("User").Filter(filter+" =", value)
+	q := repository.NewQuery("User").Filter(filter+" =", value)
 	var users []*User
 	if _, err := q.GetAll(c, &users); err == nil && len(users) > 0 {
 		return users[0]
@@ -183,7 +177,7 @@ func FindUser(c appengine.Context, filter string, value interface{}) *User {
 // FindAllUsers finds all users present in datastore.
 //
 func FindAllUsers(c appengine.Context) []*User {
-	q := datastore.NewQuery("User")
+	q := repository.NewQuery("User")
 	var users []*User
 	if _, err := q.GetAll(c, &users); err != nil {
 		log.Errorf(c, "FindAllUser, error occurred during GetAll call: %v", err)
@@ -196,8 +190,8 @@ func FindAllUsers(c appengine.Context) []*User {
 func UserByID(c appengine.Context, id int64) (*User, error) {
 
 	var u User
-	key := datastore.NewKey(c, "User", "", id, nil)
-	if err := datastore.Get(c, key, &u); err != nil {
+	key := repository.NewKey("User", "", id)
+	if err := repository.Get(c, key, &u); err != nil {
 		log.Errorf(c, " user not found : %v", err)
 		return nil, err
 	}
@@ -213,10 +207,10 @@ func UsersByIds(c appengine.Context, ids []int64) ([]*User, error) {
 	keys := UserKeysByIds(c, ids)
 
 	var wrongIndexes []int
-	if err := datastore.GetMulti(c, keys, users); err != nil {
+	if err := repository.GetMulti(c, keys, users); err != nil {
 		if me, ok := err.(appengine.MultiError); ok {
 			for i, merr := range me {
-				if merr == datastore.ErrNoSuchEntity {
+				if merr == repository.ErrNoSuchEntity {
 					log.Errorf(c, "UsersByIds, missing key: %v %v", err, keys[i].IntID())
 					wrongIndexes = append(wrongIndexes, i)
 				}
@@ -247,8 +241,8 @@ func contains(s []int, e int) bool {
 
 // UserKeysByIds gets user keys given a list of user ids.
 //
-func UserKeysByIds(c appengine.Context, ids []int64) []*datastore.Key {
-	keys := make([]*datastore.Key, len(ids))
+func UserKeysByIds(c appengine.Context, ids []int64) []*repository.Key {
+	keys := make([]*repository.Key, len(ids))
 	for i, id := range ids {
 		keys[i] = UserKeyByID(c, id)
 	}
@@ -257,9 +251,9 @@ func UserKeysByIds(c appengine.Context, ids []int64) []*datastore.Key {
 
 // UserKeyByID gets key pointer given a user id.
 //
-func UserKeyByID(c appengine.Context, id int64) *datastore.Key {
+func UserKeyByID(c appengine.Context, id int64) *repository.Key {
 
-	key := datastore.NewKey(c, "User", "", id, nil)
+	key := repository.NewKey("User", "", id)
 	return key
 }
 
@@ -268,13 +262,12 @@ func UserKeyByID(c appengine.Context, id int64) *datastore.Key {
 func (u *User) Update(c appengine.Context) error {
 	k := UserKeyByID(c, u.Id)
 	oldUser := new(User)
-	if err := datastore.Get(c, k, oldUser); err == nil {
-		if _, err := datastore.Put(c, k, u); err != nil {
+	if err := repository.Get(c, k, oldUser); err == nil {
+		if _, err := repository.Put(c, k, u); err != nil {
 			return err
 		}
-		// use lower trim names for alias as user inverted index store them like this.
-		// alias is the only field that can be changed.
-		UpdateUserInvertedIndex(c, helpers.TrimLower(oldUser.Alias), helpers.TrimLower(u.Alias), u.Id)
+		changed(c, "User", u.Id)
+		UpdateInvertedIndex(c, UserSearchKind, oldUser.searchValues(), u.searchValues(), u.Id)
 	}
 	return nil
 }
@@ -298,7 +291,7 @@ func SigninUser(c appengine.Context, queryName string, email string, username st
 	if user = FindUser(c, queryName, queryValue); user == nil {
 		// create user if it does not exist
 
-		isAdmin := gaeuser.IsAdmin(c)
+		isAdmin := platform.IsAdmin(c, 0, nil)
 
 		// start with an empty alias.
 		alias := ""
@@ -306,7 +299,7 @@ func SigninUser(c appengine.Context, queryName string, email string, username st
 		var userCreate *User
 		var err error
 
-		if userCreate, err = CreateUser(c, email, username, name, alias, isAdmin, GenerateAuthKey()); err != nil {
+		if userCreate, err = CreateUser(c, email, username, name, alias, isAdmin, ""); err != nil {
 			log.Errorf(c, "Signup: %v", err)
 			return nil, errors.New("model/user: unable to create user")
 		}
@@ -320,35 +313,35 @@ func SigninUser(c appengine.Context, queryName string, email string, username st
 	return user, nil
 }
 
-// GenerateAuthKey generates authentication string key.
-// We use this function to create an authentication token for a user entity.
-//
-func GenerateAuthKey() string {
-	b := make([]byte, 16)
-	if _, err := io.ReadFull(rand.Reader, b); err != nil {
-		return ""
-	}
-	return fmt.Sprintf("%x", b)
-}
-
 // Teams returns an array of teams joined by the user.
 //
 func (u *User) Teams(c appengine.Context) []*Team {
 
 	var teams []*Team
+	var err error
 
-	for _, tID := range u.TeamIds {
-		t, err := TeamByID(c, tID)
-		if err != nil {
-			log.Errorf(c, "Teams, cannot find team with Id=%v", tID)
-		} else {
-			teams = append(teams, t)
-		}
+	if teams, err = TeamsByIDs(c, u.TeamIDs(c)); err != nil {
+		log.Errorf(c, "Something failed when calling TeamsByIDs from user.Teams: %v", err)
 	}
 
 	return teams
 }
 
+// TeamIDs returns the ids of the teams joined by the user, from the oldest membership
+// to the most recent one.
+//
+func (u *User) TeamIDs(c appengine.Context) []int64 {
+	if err := u.migrateRelations(c); err != nil {
+		log.Errorf(c, "User.TeamIDs: unable to migrate relations of user %d: %v", u.Id, err)
+	}
+
+	ids, err := relatedIDs(c, teamMemberKind, "ToId", u.Id)
+	if err != nil {
+		log.Errorf(c, "User.TeamIDs: unable to get teams of user %d: %v", u.Id, err)
+	}
+	return ids
+}
+
 // TeamsByPage returns an array of teams the user is involved participates from a user id.
 //
 func (u *User) TeamsByPage(c appengine.Context, count, page int64) []*Team {
@@ -365,6 +358,24 @@ func (u *User) TeamsByPage(c appengine.Context, count, page int64) []*Team {
 	return paged
 }
 
+// TeamsByCursor returns a page of the teams of the user, starting with the
+// most recently joined ones, and the cursor of the next page.
+//
+func (u *User) TeamsByCursor(c appengine.Context, count int64, cursor string) ([]*Team, string, error) {
+	if err := u.migrateRelations(c); err != nil {
+		return nil, "", err
+	}
+	ids, next, err := relatedIDsByCursor(c, teamMemberKind, "ToId", u.Id, count, cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	var teams []*Team
+	if teams, err = TeamsByIDs(c, ids); err != nil {
+		return nil, "", err
+	}
+	return teams, next, nil
+}
+
 // TournamentsByPage returns an array of tournaments the user is involved participates from a user id.
 //
 func (u *User) TournamentsByPage(c appengine.Context, count, page int64) []*Tournament {
@@ -381,59 +392,101 @@ func (u *User) TournamentsByPage(c appengine.Context, count, page int64) []*Tour
 	return paged
 }
 
-// AddPredictID adds a predict Id in the PredictId array.
+// TournamentsByCursor returns a page of the tournaments of the user, starting with the
+// most recently joined ones, and the cursor of the next page.
 //
-func (u *User) AddPredictID(c appengine.Context, pID int64) error {
-
-	u.PredictIds = append(u.PredictIds, pID)
-	if err := u.Update(c); err != nil {
-		return err
+func (u *User) TournamentsByCursor(c appengine.Context, count int64, cursor string) ([]*Tournament, string, error) {
+	if err := u.migrateRelations(c); err != nil {
+		return nil, "", err
 	}
-	return nil
+	ids, next, err := relatedIDsByCursor(c, tournamentParticipantKind, "ToId", u.Id, count, cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	var tournaments []*Tournament
+	if tournaments, err = TournamentsByIds(c, ids); err != nil {
+		return nil, "", err
+	}
+	return tournaments, next, nil
 }
 
-// AddTournamentID adds a tournament Id in the TournamentId array.
+// PredictsByCursor returns a page of the predictions of the user, starting with the
+// most recent ones, and the cursor of the next page.
 //
-func (u *User) AddTournamentID(c appengine.Context, tID int64) error {
-	if hasTournament, _ := u.ContainsTournamentID(tID); hasTournament {
-		return fmt.Errorf("AddTournamentID, allready a member")
+func (u *User) PredictsByCursor(c appengine.Context, count int64, cursor string) ([]*Predict, string, error) {
+	if count <= 0 {
+		return nil, "", nil
 	}
+	it := repository.NewQuery("Predict").Filter("UserId =", u.Id).Order("-Created").Start(repository.Cursor(cursor)).Run(c)
 
-	u.TournamentIds = append(u.TournamentIds, tID)
-	if err := u.Update(c); err != nil {
-		return err
+	var predicts []*Predict
+	for int64(len(predicts)) < count {
+		var p Predict
+		if _, err := it.Next(&p); err == repository.Done {
+			return predicts, "", nil
+		} else if err != nil {
+			return nil, "", err
+		}
+		predicts = append(predicts, &p)
 	}
-	return nil
+	next, err := it.Cursor()
+	if err != nil {
+		return nil, "", err
+	}
+	return predicts, string(next), nil
 }
 
-// RemoveTournamentID removes a tournament Id in the TournamentId array.
+// Predicts returns the predictions of the user.
 //
-func (u *User) RemoveTournamentID(c appengine.Context, tID int64) error {
-
-	hasTournament := false
-	i := 0
-
-	if hasTournament, i = u.ContainsTournamentID(tID); !hasTournament {
-		return fmt.Errorf("RemoveTournamentID, not a member")
+func (u *User) Predicts(c appengine.Context) (Predicts, error) {
+	var predicts []*Predict
+	if _, err := repository.NewQuery("Predict").Filter("UserId =", u.Id).GetAll(c, &predicts); err != nil {
+		return nil, err
 	}
+	return predicts, nil
+}
 
-	// as the order of index in tournamentsId is not important,
-	// replace elem at index i with last element and resize slice.
-	u.TournamentIds[i] = u.TournamentIds[len(u.TournamentIds)-1]
-	u.TournamentIds = u.TournamentIds[0 : len(u.TournamentIds)-1]
+// PredictIDs returns the ids of the predictions of the user.
+//
+func (u *User) PredictIDs(c appengine.Context) ([]int64, error) {
+	keys, err := repository.NewQuery("Predict").Filter("UserId =", u.Id).KeysOnly().GetAll(c, nil)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, len(keys))
+	for i, k := range keys {
+		ids[i] = k.IntID()
+	}
+	return ids, nil
+}
 
-	if err := u.Update(c); err != nil {
-		return err
+// ContainsTournamentID indicates if the user participates in a tournament.
+//
+func (u *User) ContainsTournamentID(c appengine.Context, id int64) bool {
+	if err := u.migrateRelations(c); err != nil {
+		log.Errorf(c, "User.ContainsTournamentID: unable to migrate relations of user %d: %v", u.Id, err)
 	}
 
-	return nil
+	ok, err := hasRelation(c, tournamentParticipantKind, id, u.Id)
+	if err != nil {
+		log.Errorf(c, "User.ContainsTournamentID: unable to get relation: %v", err)
+	}
+	return ok
 }
 
-// ContainsTournamentID indicates if a tournament Id exists for a user.
-// If the tournament Id exists, its position in the slice is returned otherwise -1.
+// TournamentIDs returns the ids of the tournaments the user participates in, from the oldest
+// participation to the most recent one.
 //
-func (u *User) ContainsTournamentID(id int64) (bool, int) {
-	return helpers.Contains(u.TournamentIds, id)
+func (u *User) TournamentIDs(c appengine.Context) []int64 {
+	if err := u.migrateRelations(c); err != nil {
+		log.Errorf(c, "User.TournamentIDs: unable to migrate relations of user %d: %v", u.Id, err)
+	}
+
+	ids, err := relatedIDs(c, tournamentParticipantKind, "ToId", u.Id)
+	if err != nil {
+		log.Errorf(c, "User.TournamentIDs: unable to get tournaments of user %d: %v", u.Id, err)
+	}
+	return ids
 }
 
 // Tournaments returns an array of tournament the user is involved in from a user.
@@ -443,92 +496,79 @@ func (u *User) Tournaments(c appengine.Context) []*Tournament {
 	var tournaments []*Tournament
 	var err error
 
-	if tournaments, err = TournamentsByIds(c, u.TournamentIds); err != nil {
+	if tournaments, err = TournamentsByIds(c, u.TournamentIDs(c)); err != nil {
 		log.Errorf(c, "Something failed when calling TournamentsByIds from user.Tournaments: %v", err)
 	}
 
 	return tournaments
 }
 
-// AddTeamID adds a team Id in the TeamId array.
+// HasBlocked checks if a user has blocked another user.
 //
-func (u *User) AddTeamID(c appengine.Context, tID int64) error {
-
-	if hasTeam, _ := u.ContainsTeamID(tID); hasTeam {
-		return fmt.Errorf("AddTeamID, allready a member")
-	}
-
-	u.TeamIds = append(u.TeamIds, tID)
-	if err := u.Update(c); err != nil {
-		return err
-	}
-	return nil
+func (u *User) HasBlocked(id int64) bool {
+	blocked, _ := helpers.Contains(u.BlockedIds, id)
+	return blocked
 }
 
-// RemoveTeamID removes a team Id in the TeamId array.
+// Block blocks a user, a blocked user cannot invite the user nor see his profile.
 //
-func (u *User) RemoveTeamID(c appengine.Context, tID int64) error {
-
-	hasTeam := false
-	i := 0
-
-	if hasTeam, i = u.ContainsTeamID(tID); !hasTeam {
-		return fmt.Errorf("RemoveTeamID, not a member")
+func (u *User) Block(c appengine.Context, id int64) error {
+	if id == u.Id {
+		return fmt.Errorf("Block, a user cannot block himself")
+	}
+	if u.HasBlocked(id) {
+		return fmt.Errorf("Block, user %d allready blocked", id)
 	}
 
-	// as the order of index in teamsId is not important,
-	// replace elem at index i with last element and resize slice.
-	u.TeamIds[i] = u.TeamIds[len(u.TeamIds)-1]
-	u.TeamIds = u.TeamIds[0 : len(u.TeamIds)-1]
+	u.BlockedIds = append(u.BlockedIds, id)
+	return u.Update(c)
+}
 
-	if err := u.Update(c); err != nil {
-		return err
+// Unblock unblocks a user.
+//
+func (u *User) Unblock(c appengine.Context, id int64) error {
+	if !u.HasBlocked(id) {
+		return fmt.Errorf("Unblock, user %d not blocked", id)
 	}
 
-	return nil
+	u.BlockedIds = helpers.Remove(u.BlockedIds, id)
+	return u.Update(c)
 }
 
-// ContainsTeamID checks if a given team id exists in the TeamId array if a user.
+// ContainsTeamID checks if the user is a member of a team.
 //
-func (u *User) ContainsTeamID(id int64) (bool, int) {
+func (u *User) ContainsTeamID(c appengine.Context, id int64) bool {
+	if err := u.migrateRelations(c); err != nil {
+		log.Errorf(c, "User.ContainsTeamID: unable to migrate relations of user %d: %v", u.Id, err)
+	}
 
-	for i, tID := range u.TeamIds {
-		if tID == id {
-			return true, i
-		}
+	ok, err := hasRelation(c, teamMemberKind, id, u.Id)
+	if err != nil {
+		log.Errorf(c, "User.ContainsTeamID: unable to get relation: %v", err)
 	}
-	return false, -1
+	return ok
 }
 
 // UpdateUsers updates an array of users.
 //
 func UpdateUsers(c appengine.Context, users []*User) error {
-	keys := make([]*datastore.Key, len(users))
+	keys := make([]*repository.Key, len(users))
+	ids := make([]int64, len(users))
 	for i := range keys {
 		keys[i] = UserKeyByID(c, users[i].Id)
+		ids[i] = users[i].Id
 	}
-	if _, err := datastore.PutMulti(c, keys, users); err != nil {
+	if _, err := repository.PutMulti(c, keys, users); err != nil {
 		return err
 	}
+	changed(c, "User", ids...)
 	return nil
 }
 
 // PredictFromMatchID returns the user predictions for a specific match.
 //
 func (u *User) PredictFromMatchID(c appengine.Context, mID int64) (*Predict, error) {
-
-	var predicts []*Predict
-	var err error
-	if predicts, err = PredictsByIds(c, u.PredictIds); err != nil {
-		return nil, err
-	}
-
-	for i, p := range predicts {
-		if p.MatchId == mID {
-			return predicts[i], nil
-		}
-	}
-	return nil, nil
+	return FindPredictByUserMatch(c, u.Id, mID), nil
 }
 
 // ScoreForMatch returns user's score for a given match.
@@ -566,10 +606,22 @@ func (u *User) Publish(c appengine.Context, activityType string, verb string, ob
 	if err := activity.save(c); err != nil {
 		return err
 	}
-	// add new activity id in user activity table
-	activity.AddNewActivityID(c, u)
+	// add new activity to the user feed
+	return activity.AddNewActivityID(c, u)
+}
 
-	return u.Update(c)
+// ActivityIDs returns the ids of the activities of the user, from the oldest to the most recent one.
+//
+func (u *User) ActivityIDs(c appengine.Context) []int64 {
+	if err := u.migrateRelations(c); err != nil {
+		log.Errorf(c, "User.ActivityIDs: unable to migrate relations of user %d: %v", u.Id, err)
+	}
+
+	ids, err := relatedIDs(c, userActivityKind, "FromId", u.Id)
+	if err != nil {
+		log.Errorf(c, "User.ActivityIDs: unable to get activities of user %d: %v", u.Id, err)
+	}
+	return ids
 }
 
 // BuildActivity build an activity.
@@ -583,7 +635,7 @@ func (u *User) BuildActivity(c appengine.Context, activityType string, verb stri
 	activity.Target = target
 	activity.Published = time.Now()
 	activity.CreatorID = u.Id
-	id, _, err1 := datastore.AllocateIDs(c, "Activity", nil, 1)
+	id, _, err1 := repository.AllocateIDs(c, "Activity", 1)
 	if err1 != nil {
 		log.Errorf(c, " BuildActivity: error occurred during AllocateIDs call: %v", err1)
 		return nil
@@ -616,14 +668,7 @@ func (u *User) TournamentScore(c appengine.Context, tournament *Tournament) (*Sc
 //
 func (u *User) AddTournamentScore(c appengine.Context, scoreID int64, tourID int64) error {
 	log.Infof(c, "model/user: add tournament score")
-	tournamentExist := false
-	for _, tid := range u.TournamentIds {
-		if tid == tourID {
-			tournamentExist = true
-			break
-		}
-	}
-	if !tournamentExist {
+	if !u.ContainsTournamentID(c, tourID) {
 		log.Infof(c, "model/user: add tournament score, tournament does not exist")
 		return errors.New("model/team: not member of tournament")
 	}
@@ -720,7 +765,7 @@ func (u *User) Invitations(c appengine.Context) []*Team {
 //
 func FindUsers(c appengine.Context, filter string, value interface{}) []*User {
 
-	q := datastore.NewQuery("User").Filter(filter+" =", value)
+	q := repository.NewQuery("User").Filter(filter+" =", value)
 	var users []*User
 	if _, err := q.GetAll(c, &users); err != nil {
 		log.Errorf(c, "FindUsers, error occurred during GetAll: %v", err)
@@ -733,9 +778,93 @@ func FindUsers(c appengine.Context, filter string, value interface{}) []*User {
 // GetWordFrequencyForUser gets the frequency of given word with respect to user id.
 //
 func GetWordFrequencyForUser(c appengine.Context, id int64, word string) int64 {
+	return int64(WordFrequency(c, UserSearchKind, id, word))
+}
 
-	if users := FindUsers(c, "Id", id); users != nil {
-		return helpers.CountTerm(strings.Split(users[0].Name, " "), word)
+// GetUserInvertedIndexes returns, given an array of words, the ids of the users that use these words.
+//
+func GetUserInvertedIndexes(c appengine.Context, words []string) ([]int64, error) {
+	return InvertedIndexes(c, UserSearchKind, words)
+}
+
+// UserSearchKind is the name of the user kind in the search engine.
+//
+const UserSearchKind = "user"
+
+// UserSearchSorts are the sort options of a user search.
+//
+var UserSearchSorts = []string{SearchSortRelevance, SearchSortCreated}
+
+// SearchUsers returns a page of the users matching the query, sorted by relevance or creation,
+// and the number of users matching. Users hidden from the search results of the viewer are skipped.
+//
+func SearchUsers(c appengine.Context, query string, sortBy string, count int64, page int64, viewer *User) ([]*User, int64, error) {
+
+	ids, err := SearchIds(c, UserSearchKind, query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var found []*User
+	if err = searchBatches(ids, func(batch []int64) error {
+		users, err := UsersByIds(c, batch)
+		found = append(found, users...)
+		return err
+	}); err != nil {
+		return nil, 0, err
+	}
+
+	users := make([]*User, 0, len(found))
+	for _, u := range found {
+		if !u.IsHiddenFromSearch(viewer) {
+			users = append(users, u)
+		}
+	}
+
+	if sortBy == SearchSortCreated {
+		sort.Stable(UserByCreation(users))
+	}
+
+	total := int64(len(users))
+	from, to := searchPageBounds(total, count, page)
+	return users[from:to], total, nil
+}
+
+// UserByCreation type used to sort users from the most recent to the oldest.
+//
+type UserByCreation []*User
+
+func (a UserByCreation) Len() int           { return len(a) }
+func (a UserByCreation) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a UserByCreation) Less(i, j int) bool { return a[i].Created.After(a[j].Created) }
+
+func init() {
+	RegisterSearchKind(SearchKind{
+		Name:      UserSearchKind,
+		Entity:    "User",
+		Postings:  "UserInvertedIndexShard",
+		Counter:   "WordCountUser",
+		Fields:    []SearchField{{"Name", 1}, {"Username", 1}, {"Alias", 1}},
+		Documents: userSearchDocuments,
+	})
+}
+
+// searchValues returns the values of the user fields indexed by the search engine.
+//
+func (u *User) searchValues() []string {
+	return []string{u.Name, u.Username, u.Alias}
+}
+
+// userSearchDocuments returns the indexed values of the users with the given ids.
+//
+func userSearchDocuments(c appengine.Context, ids []int64) map[int64][]string {
+	documents := make(map[int64][]string)
+	users, err := UsersByIds(c, ids)
+	if err != nil {
+		log.Errorf(c, "userSearchDocuments, unable to get users: %v", err)
+	}
+	for _, u := range users {
+		documents[u.Id] = u.searchValues()
 	}
-	return 0
+	return documents
 }
@@ -0,0 +1,213 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+package models
+
+import (
+	"time"
+
+	"appengine"
+
+	"github.com/taironas/gonawin/repository"
+)
+
+// UserData holds all the data linked to a user, exported at his request.
+//
+type UserData struct {
+	Exported     time.Time
+	User         *User
+	Identities   []*Identity
+	Sessions     []*Session
+	AccessTokens []*AccessToken
+	Teams        []UserDataTeam
+	Tournaments  []UserDataTournament
+	Predicts     []*Predict
+	Scores       []*Score
+	Activities   []*Activity    // activities published by the user.
+	Mentions     []*Activity    // activities of other users and teams naming the user.
+	TeamRequests []*TeamRequest // requests of the user to join teams.
+	Invitations  []*UserRequest // invitations of teams to the user.
+	Reports      []*Report      // reports sent by the user.
+}
+
+// UserDataTeam holds a team of the user and his role in it.
+//
+type UserDataTeam struct {
+	Id   int64
+	Name string
+	Role string
+}
+
+// UserDataTournament holds a tournament of the user and whether he administrates it.
+//
+type UserDataTournament struct {
+	Id    int64
+	Name  string
+	Admin bool
+}
+
+// ExportUserData gathers all the data linked to a user.
+//
+func ExportUserData(c appengine.Context, u *User) (*UserData, error) {
+	d := &UserData{
+		Exported:     time.Now(),
+		User:         u,
+		Identities:   u.Identities(c),
+		Sessions:     UserSessions(c, u.Id),
+		AccessTokens: UserAccessTokens(c, u.Id),
+		Scores:       u.Scores(c),
+		TeamRequests: FindTeamRequest(c, "UserId", u.Id),
+		Invitations:  FindUserRequests(c, "UserId", u.Id),
+		Reports:      FindReports(c, "ReporterId", u.Id),
+	}
+
+	for _, team := range u.Teams(c) {
+		d.Teams = append(d.Teams, UserDataTeam{team.Id, team.Name, team.Role(c, u.Id)})
+	}
+	for _, tournament := range u.Tournaments(c) {
+		admin, _ := tournament.ContainsAdminID(u.Id)
+		d.Tournaments = append(d.Tournaments, UserDataTournament{tournament.Id, tournament.Name, admin})
+	}
+
+	var err error
+	if d.Predicts, err = u.Predicts(c); err != nil {
+		return nil, err
+	}
+	if _, err = userActivitiesQuery(u.Id).GetAll(c, &d.Activities); err != nil {
+		return nil, err
+	}
+	if d.Mentions, err = userMentions(c, u.Id); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// userActivitiesQuery returns the query of the activities published by a user.
+// The creator of an activity is a user, a team or a tournament, so the type of its actor is checked too.
+func userActivitiesQuery(userID int64) *repository.Query {
+	return repository.NewQuery("Activity").Filter("CreatorID =", userID).Filter("Actor.Type =", "user")
+}
+
+// activityUserFields are the entities of an activity which can name a user.
+var activityUserFields = []string{"Actor", "Object", "Target"}
+
+// userMentionsQuery returns the query of the activities naming a user in one of their entities.
+func userMentionsQuery(field string, userID int64) *repository.Query {
+	return repository.NewQuery("Activity").Filter(field+".Type =", "user").Filter(field+".Id =", userID)
+}
+
+// userMentions returns the activities published by other users and teams which name a user.
+func userMentions(c appengine.Context, userID int64) ([]*Activity, error) {
+	var mentions []*Activity
+	seen := make(map[int64]bool)
+	for _, field := range activityUserFields {
+		var activities []*Activity
+		if _, err := userMentionsQuery(field, userID).GetAll(c, &activities); err != nil {
+			return nil, err
+		}
+		for _, a := range activities {
+			if seen[a.Id] || (a.publishedByUser() && a.CreatorID == userID) {
+				continue
+			}
+			seen[a.Id] = true
+			mentions = append(mentions, a)
+		}
+	}
+	return mentions, nil
+}
+
+// UserDataReference counts the entities of a kind still referencing a user with one of their fields.
+//
+type UserDataReference struct {
+	Kind  string
+	Field string
+	Count int64
+}
+
+// userReferences are the fields of the entities referencing a user, checked after a user deletion.
+var userReferences = []struct {
+	kind, field string
+}{
+	{"User", "Id"},
+	{"User", "BlockedIds"},
+	{"Identity", "UserId"},
+	{"Session", "UserId"},
+	{"AccessToken", "UserId"},
+	{teamMemberKind, "ToId"},
+	{tournamentParticipantKind, "ToId"},
+	{userActivityKind, "FromId"},
+	{"Predict", "UserId"},
+	{"Score", "UserId"},
+	{"LeaderboardEntry", "UserId"},
+	{"TeamRequest", "UserId"},
+	{"TeamRequestDenial", "UserId"},
+	{"UserRequest", "UserId"},
+	{"Report", "ReporterId"},
+	{"Report", "ResolverId"},
+	{"Challenge", "CreatorId"},
+	{"Team", "OwnerIds"},
+	{"Team", "AdminIds"},
+	{"Team", "ModeratorIds"},
+	{"Team", "SpectatorIds"},
+	{"Team", "BannedIds"},
+	{"Tournament", "AdminIds"},
+}
+
+// UserDataReferences returns the entities which still reference a user, by kind and field.
+// The reports of the user, the activities naming him and the words of the search index holding the user are checked as well.
+//
+func UserDataReferences(c appengine.Context, userID int64) ([]UserDataReference, error) {
+	var refs []UserDataReference
+	for _, r := range userReferences {
+		n, err := repository.NewQuery(r.kind).Filter(r.field+" =", userID).Count(c)
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			refs = append(refs, UserDataReference{r.kind, r.field, int64(n)})
+		}
+	}
+
+	n, err := repository.NewQuery("Report").Filter("Kind =", ReportKindUser).Filter("TargetId =", userID).Count(c)
+	if err != nil {
+		return nil, err
+	}
+	if n > 0 {
+		refs = append(refs, UserDataReference{"Report", "TargetId", int64(n)})
+	}
+
+	for _, field := range activityUserFields {
+		n, err := userMentionsQuery(field, userID).Count(c)
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			refs = append(refs, UserDataReference{"Activity", field + ".Id", int64(n)})
+		}
+	}
+
+	k, err := searchKind(UserSearchKind)
+	if err != nil {
+		return nil, err
+	}
+	words, err := userPostings(c, k, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(words) > 0 {
+		refs = append(refs, UserDataReference{k.Postings, "Ids", int64(len(words))})
+	}
+	return refs, nil
+}
@@ -0,0 +1,534 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+package models
+
+import (
+	"errors"
+	"time"
+
+	"appengine"
+
+	"github.com/taironas/gonawin/helpers"
+	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/repository"
+)
+
+// States of a user deletion.
+//
+const (
+	UserDeletionRunning   = "running"   // steps of the deletion are left.
+	UserDeletionCompleted = "completed" // all the steps are done but entities still reference the user.
+	UserDeletionVerified  = "verified"  // all the steps are done and no entity references the user.
+)
+
+var (
+	// ErrUserLastTeamOwner is returned when deleting the last owner of a team.
+	ErrUserLastTeamOwner = errors.New("model/user deletion: user is the last owner of a team")
+	// ErrUserLastTournamentAdmin is returned when deleting the only admin of a tournament.
+	ErrUserLastTournamentAdmin = errors.New("model/user deletion: user is the only admin of a tournament")
+)
+
+// UserDeletion records the deletion of all the data of a user.
+//
+// The data is deleted by steps, each step deleting the entities of a kind by batches, so that
+// the deletion can be run by tasks and resume where it stopped. When the last step is done, the
+// entities still referencing the user are counted in Remaining, empty when the deletion is verified.
+// The user deletion holds no personal data and is kept once completed.
+//
+type UserDeletion struct {
+	UserId    int64
+	Steps     []UserDeletionStep
+	Requested time.Time
+	Updated   time.Time
+	Completed time.Time           // zero while the deletion is running.
+	Remaining []UserDataReference // references to the user left once completed.
+}
+
+// UserDeletionStep holds the progress of a step of a user deletion.
+//
+type UserDeletionStep struct {
+	Name    string
+	Deleted int64 // number of entities deleted or updated by the step.
+	Done    bool
+}
+
+// userDeletionStep deletes or updates at most limit entities referencing a user.
+// It returns the number of entities processed, the step is done when it is lower than limit.
+type userDeletionStep func(c appengine.Context, userID int64, limit int) (int, error)
+
+// userDeletionSteps are the steps of a user deletion, in the order they are run.
+// The user is deleted last so that he can follow the deletion until then.
+var userDeletionSteps = []struct {
+	name string
+	run  userDeletionStep
+}{
+	{"teams", deleteUserTeams},
+	{"tournaments", deleteUserTournaments},
+	{"activities", deleteUserActivities},
+	{"mentions", anonymizeUserMentions},
+	{"feed", deleteUserEntities(userActivityKind, "FromId")},
+	{"predicts", deleteUserEntities("Predict", "UserId")},
+	{"scores", deleteUserEntities("Score", "UserId")},
+	{"leaderboards", deleteUserEntities("LeaderboardEntry", "UserId")},
+	{"teamrequests", deleteUserEntities("TeamRequest", "UserId")},
+	{"teamrequestdenials", deleteUserEntities("TeamRequestDenial", "UserId")},
+	{"invitations", deleteUserEntities("UserRequest", "UserId")},
+	{"reports", deleteUserEntities("Report", "ReporterId")},
+	{"reported", deleteUserReports},
+	{"resolvedreports", anonymizeUserReports},
+	{"challenges", anonymizeUserChallenges},
+	{"blocks", unblockUser},
+	{"user", destroyUser},
+	{"search", deleteUserPostings},
+}
+
+// CheckUserDeletion checks that a user can be deleted: teams cannot be left without owner and
+// tournaments without admin.
+//
+func CheckUserDeletion(c appengine.Context, u *User) error {
+	for _, team := range u.Teams(c) {
+		if team.IsLastOwner(u.Id) {
+			return ErrUserLastTeamOwner
+		}
+	}
+	for _, tournament := range FindTournaments(c, "AdminIds", u.Id) {
+		if len(tournament.AdminIds) <= 1 {
+			return ErrUserLastTournamentAdmin
+		}
+	}
+	return nil
+}
+
+// StartUserDeletion starts the deletion of all the data of a user, or returns the deletion
+// already running. The deletion is run by calling Run until it is completed.
+// The user is signed out of all his devices and his access tokens are revoked when the deletion starts.
+//
+func StartUserDeletion(c appengine.Context, u *User) (*UserDeletion, error) {
+	if d, err := UserDeletionByUserID(c, u.Id); err == nil && !d.IsCompleted() {
+		return d, nil
+	}
+	if err := CheckUserDeletion(c, u); err != nil {
+		return nil, err
+	}
+	if err := DestroyUserSessions(c, u.Id); err != nil {
+		return nil, err
+	}
+	if err := DestroyUserAccessTokens(c, u.Id); err != nil {
+		return nil, err
+	}
+	return RestartUserDeletion(c, u.Id)
+}
+
+// RestartUserDeletion runs all the steps of the deletion of a user again, to delete the data
+// left by a deletion which could not be verified.
+//
+func RestartUserDeletion(c appengine.Context, userID int64) (*UserDeletion, error) {
+	d := &UserDeletion{UserId: userID, Requested: time.Now()}
+	for _, s := range userDeletionSteps {
+		d.Steps = append(d.Steps, UserDeletionStep{Name: s.name})
+	}
+	if err := d.save(c); err != nil {
+		return nil, err
+	}
+	log.Infof(c, "UserDeletion: deletion of user %d started", userID)
+	return d, nil
+}
+
+// UserDeletionByUserID returns the deletion of a user.
+//
+func UserDeletionByUserID(c appengine.Context, userID int64) (*UserDeletion, error) {
+	var d UserDeletion
+	if err := repository.Get(c, userDeletionKey(userID), &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// UserDeletions returns the user deletions, completed or not.
+//
+func UserDeletions(c appengine.Context) ([]*UserDeletion, error) {
+	var deletions []*UserDeletion
+	if _, err := repository.NewQuery("UserDeletion").GetAll(c, &deletions); err != nil {
+		return nil, err
+	}
+	return deletions, nil
+}
+
+func userDeletionKey(userID int64) *repository.Key {
+	return repository.NewKey("UserDeletion", "", userID)
+}
+
+func (d *UserDeletion) save(c appengine.Context) error {
+	d.Updated = time.Now()
+	_, err := repository.Put(c, userDeletionKey(d.UserId), d)
+	return err
+}
+
+// IsCompleted reports whether all the steps of the deletion are done.
+//
+func (d *UserDeletion) IsCompleted() bool {
+	return !d.Completed.IsZero()
+}
+
+// IsVerified reports whether the deletion is completed and no entity references the user anymore.
+//
+func (d *UserDeletion) IsVerified() bool {
+	return d.IsCompleted() && len(d.Remaining) == 0
+}
+
+// State returns the state of the deletion, one of UserDeletionRunning, UserDeletionCompleted or UserDeletionVerified.
+//
+func (d *UserDeletion) State() string {
+	if !d.IsCompleted() {
+		return UserDeletionRunning
+	}
+	if !d.IsVerified() {
+		return UserDeletionCompleted
+	}
+	return UserDeletionVerified
+}
+
+// Run runs a batch of at most limit entities of the current step of the deletion and records
+// its progress. The deletion is verified once the last step is done.
+//
+func (d *UserDeletion) Run(c appengine.Context, limit int) error {
+	if d.IsCompleted() {
+		return nil
+	}
+
+	for _, s := range userDeletionSteps {
+		step := d.step(s.name)
+		if step.Done {
+			continue
+		}
+		n, err := s.run(c, d.UserId, limit)
+		step.Deleted += int64(n)
+		if err != nil {
+			log.Errorf(c, "UserDeletion.Run: step %s of user %d failed: %v", s.name, d.UserId, err)
+			if serr := d.save(c); serr != nil {
+				log.Errorf(c, "UserDeletion.Run: unable to save deletion of user %d: %v", d.UserId, serr)
+			}
+			return err
+		}
+		step.Done = n < limit
+		return d.save(c)
+	}
+
+	remaining, err := UserDataReferences(c, d.UserId)
+	if err != nil {
+		return err
+	}
+	d.Remaining = remaining
+	d.Completed = time.Now()
+	if len(remaining) > 0 {
+		log.Errorf(c, "UserDeletion.Run: deletion of user %d completed with references left: %v", d.UserId, remaining)
+	} else {
+		log.Infof(c, "UserDeletion.Run: deletion of user %d completed and verified", d.UserId)
+	}
+	return d.save(c)
+}
+
+// step returns the progress of a step of the deletion, added when the deletion started before the step existed.
+func (d *UserDeletion) step(name string) *UserDeletionStep {
+	for i := range d.Steps {
+		if d.Steps[i].Name == name {
+			return &d.Steps[i]
+		}
+	}
+	d.Steps = append(d.Steps, UserDeletionStep{Name: name})
+	return &d.Steps[len(d.Steps)-1]
+}
+
+// deleteUserEntities returns a step deleting the entities of a kind whose field holds the user id.
+func deleteUserEntities(kind, field string) userDeletionStep {
+	return func(c appengine.Context, userID int64, limit int) (int, error) {
+		keys, err := repository.NewQuery(kind).Filter(field+" =", userID).KeysOnly().Limit(limit).GetAll(c, nil)
+		if err != nil {
+			return 0, err
+		}
+		return len(keys), repository.DeleteMulti(c, keys)
+	}
+}
+
+// deleteUserTeams removes the user from the members and roles of his teams and from the winners of their prices.
+func deleteUserTeams(c appengine.Context, userID int64, limit int) (int, error) {
+	if u, err := UserByID(c, userID); err == nil {
+		if err = u.migrateRelations(c); err != nil {
+			return 0, err
+		}
+	}
+
+	ids, err := relatedIDs(c, teamMemberKind, "ToId", userID)
+	if err != nil {
+		return 0, err
+	}
+	for _, field := range []string{"OwnerIds", "AdminIds", "ModeratorIds", "SpectatorIds", "BannedIds"} {
+		keys, err := repository.NewQuery("Team").Filter(field+" =", userID).KeysOnly().GetAll(c, nil)
+		if err != nil {
+			return 0, err
+		}
+		for _, k := range keys {
+			if ok, _ := helpers.Contains(ids, k.IntID()); !ok {
+				ids = append(ids, k.IntID())
+			}
+		}
+	}
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	for _, id := range ids {
+		team, err := TeamByID(c, id)
+		if err != nil {
+			// the team is gone, only the membership is left.
+			if err = removeRelation(c, teamMemberKind, id, userID); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		for _, p := range team.Prices(c) {
+			if anonymizePriceWinner(p, userID) {
+				if err = p.Update(c); err != nil {
+					return 0, err
+				}
+			}
+		}
+		team.initOwners()
+		team.removeRoles(userID)
+		team.BannedIds = helpers.Remove(team.BannedIds, userID)
+		if team.ContainsUserID(c, userID) {
+			err = team.RemoveUserID(c, userID)
+		} else {
+			err = team.Update(c)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(ids), nil
+}
+
+// anonymizePriceWinner removes the user from the winners of a price, his rank is kept.
+// It reports whether the price was changed.
+func anonymizePriceWinner(p *Price, userID int64) bool {
+	changed := false
+	for i := range p.Winners {
+		if p.Winners[i].UserId == userID {
+			p.Winners[i].UserId = 0
+			p.Winners[i].Username = ""
+			changed = true
+		}
+	}
+	return changed
+}
+
+// deleteUserTournaments removes the user from the participants and admins of his tournaments.
+func deleteUserTournaments(c appengine.Context, userID int64, limit int) (int, error) {
+	ids, err := relatedIDs(c, tournamentParticipantKind, "ToId", userID)
+	if err != nil {
+		return 0, err
+	}
+	keys, err := repository.NewQuery("Tournament").Filter("AdminIds =", userID).KeysOnly().GetAll(c, nil)
+	if err != nil {
+		return 0, err
+	}
+	for _, k := range keys {
+		if ok, _ := helpers.Contains(ids, k.IntID()); !ok {
+			ids = append(ids, k.IntID())
+		}
+	}
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	for _, id := range ids {
+		tournament, err := TournamentByID(c, id)
+		if err != nil {
+			if err = removeRelation(c, tournamentParticipantKind, id, userID); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		tournament.AdminIds = helpers.Remove(tournament.AdminIds, userID)
+		if tournament.ContainsUserID(c, userID) {
+			err = tournament.RemoveUserID(c, userID)
+		} else {
+			err = tournament.Update(c)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(ids), nil
+}
+
+// deleteUserActivities deletes the activities published by the user and removes them from the feeds of the other users.
+// The feed links count in the limit, the activities are deleted once they are removed from all the feeds.
+func deleteUserActivities(c appengine.Context, userID int64, limit int) (int, error) {
+	keys, err := userActivitiesQuery(userID).KeysOnly().Limit(limit).GetAll(c, nil)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, k := range keys {
+		removed, err := removeRelationsUpTo(c, userActivityKind, "ToId", k.IntID(), limit-n)
+		if n += removed; err != nil {
+			return n, err
+		}
+		if n >= limit {
+			return n, nil
+		}
+	}
+	return n + len(keys), repository.DeleteMulti(c, keys)
+}
+
+// anonymizeUserMentions removes the user from the activities of other users and teams naming him,
+// such as the prices awarded to him. The activities he published are deleted by the previous step.
+func anonymizeUserMentions(c appengine.Context, userID int64, limit int) (int, error) {
+	n := 0
+	for _, field := range activityUserFields {
+		var activities []*Activity
+		keys, err := userMentionsQuery(field, userID).Limit(limit-n).GetAll(c, &activities)
+		if err != nil {
+			return n, err
+		}
+		if len(keys) == 0 {
+			continue
+		}
+		for _, a := range activities {
+			anonymizeActivityUser(a, userID)
+		}
+		if _, err = repository.PutMulti(c, keys, activities); err != nil {
+			return n, err
+		}
+		if n += len(keys); n >= limit {
+			break
+		}
+	}
+	return n, nil
+}
+
+// anonymizeActivityUser removes the user from the entities of an activity.
+func anonymizeActivityUser(a *Activity, userID int64) {
+	for _, e := range []*ActivityEntity{&a.Actor, &a.Object, &a.Target} {
+		if e.Type == "user" && e.Id == userID {
+			e.Id = 0
+			e.DisplayName = ""
+		}
+	}
+}
+
+// deleteUserReports deletes the reports of the user sent by other users.
+func deleteUserReports(c appengine.Context, userID int64, limit int) (int, error) {
+	keys, err := repository.NewQuery("Report").Filter("Kind =", ReportKindUser).Filter("TargetId =", userID).KeysOnly().Limit(limit).GetAll(c, nil)
+	if err != nil {
+		return 0, err
+	}
+	return len(keys), repository.DeleteMulti(c, keys)
+}
+
+// anonymizeUserReports removes the user from the reports he resolved as a gonawin admin.
+func anonymizeUserReports(c appengine.Context, userID int64, limit int) (int, error) {
+	var reports []*Report
+	keys, err := repository.NewQuery("Report").Filter("ResolverId =", userID).Limit(limit).GetAll(c, &reports)
+	if err != nil || len(keys) == 0 {
+		return 0, err
+	}
+	for _, r := range reports {
+		r.ResolverId = 0
+	}
+	_, err = repository.PutMulti(c, keys, reports)
+	return len(keys), err
+}
+
+// anonymizeUserChallenges removes the user from the challenges he created as a team admin.
+func anonymizeUserChallenges(c appengine.Context, userID int64, limit int) (int, error) {
+	var challenges []*Challenge
+	keys, err := repository.NewQuery("Challenge").Filter("CreatorId =", userID).Limit(limit).GetAll(c, &challenges)
+	if err != nil || len(keys) == 0 {
+		return 0, err
+	}
+	for _, ch := range challenges {
+		ch.CreatorId = 0
+	}
+	_, err = repository.PutMulti(c, keys, challenges)
+	return len(keys), err
+}
+
+// unblockUser removes the user from the users blocked by other users.
+func unblockUser(c appengine.Context, userID int64, limit int) (int, error) {
+	var users []*User
+	if _, err := repository.NewQuery("User").Filter("BlockedIds =", userID).Limit(limit).GetAll(c, &users); err != nil {
+		return 0, err
+	}
+	for _, u := range users {
+		if err := u.Unblock(c, userID); err != nil {
+			return 0, err
+		}
+	}
+	return len(users), nil
+}
+
+// destroyUser deletes the user with his identities, sessions, access tokens and search words.
+func destroyUser(c appengine.Context, userID int64, limit int) (int, error) {
+	u, err := UserByID(c, userID)
+	if err == repository.ErrNoSuchEntity {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return 1, u.Destroy(c)
+}
+
+// deleteUserPostings removes the user from the words of the search index left by older versions of the user.
+func deleteUserPostings(c appengine.Context, userID int64, limit int) (int, error) {
+	k, err := searchKind(UserSearchKind)
+	if err != nil {
+		return 0, err
+	}
+	words, err := userPostings(c, k, userID)
+	if err != nil {
+		return 0, err
+	}
+	if len(words) > limit {
+		words = words[:limit]
+	}
+	if len(words) == 0 {
+		return 0, nil
+	}
+	return len(words), updatePostings(c, k, userID, nil, words)
+}
+
+// userPostings returns the words of the search index of a kind holding an id.
+func userPostings(c appengine.Context, k *SearchKind, id int64) ([]string, error) {
+	var words []string
+	it := repository.NewQuery(k.Postings).Filter("Shard =", postingShard(id)).Run(c)
+	for {
+		var x InvertedIndex
+		_, err := it.Next(&x)
+		if err == repository.Done {
+			return words, nil
+		} else if err != nil {
+			return nil, err
+		}
+		for _, posted := range x.Ids {
+			if posted == id {
+				words = append(words, x.Word)
+				break
+			}
+		}
+	}
+}
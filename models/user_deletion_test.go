@@ -0,0 +1,302 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"appengine"
+
+	"github.com/taironas/gonawin/helpers/memcache"
+	"github.com/taironas/gonawin/repository"
+)
+
+// TestUserDeletion tests that a user deletion removes all the references to the user, by batches.
+//
+func TestUserDeletion(t *testing.T) {
+	repository.Use(repository.NewMemory())
+	defer repository.Use(repository.Datastore)
+	memcache.Use(memcache.NewMemory())
+
+	c := repository.NewLocalContext(nil)
+
+	arya, err := SigninUserWithIdentity(c, IdentityGoogle, "1", "arya@winterfell.com", true, "arya", "Arya Stark")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	jon, err := CreateUser(c, "jon@winterfell.com", "jon", "Jon Snow", "", false, "")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if _, _, err = CreateSession(c, arya.Id, "firefox"); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if _, _, err = CreateAccessToken(c, arya.Id, "bot", []string{ScopeReadRankings}); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	// a team where arya is a moderator and a team which banned her.
+	starks, err := CreateTeam(c, "starks", "winter is coming", jon.Id, false)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	for _, u := range []*User{jon, arya} {
+		if err = starks.Join(c, u); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+	}
+	if err = starks.SetRole(c, arya.Id, TeamRoleModerator); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	lannisters, err := CreateTeam(c, "lannisters", "hear me roar", jon.Id, false)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if err = lannisters.Join(c, arya); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if err = lannisters.Ban(c, arya); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	tournament, err := CreateTournament(c, "world cup", "", time.Now(), time.Now(), jon.Id)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	tournament.AdminIds = append(tournament.AdminIds, arya.Id)
+	if err = tournament.AddUserID(c, arya.Id); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	for match := int64(1); match <= 3; match++ {
+		if _, err = CreatePredict(c, arya.Id, 1, 0, match); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+	}
+	if _, err = CreateScore(c, arya.Id, tournament.Id); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if err = TournamentLeaderboard(tournament.Id).SetScores(c, []int64{arya.Id, jon.Id}, []int64{3, 1}); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	activity := arya.BuildActivity(c, "welcome", "joined gonawin", ActivityEntity{}, ActivityEntity{})
+	if err = activity.save(c); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	// the activity is in more feeds than the deletion removes in a run.
+	if err = activity.addToFeeds(c, []int64{arya.Id, jon.Id, jon.Id + 100, jon.Id + 101, jon.Id + 102}); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if err = starks.Publish(c, "price", "awarded the first price to", arya.Entity(), tournament.Entity()); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	if _, err = CreateTeamRequest(c, lannisters.Id, lannisters.Name, arya.Id, arya.Username); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if _, err = CreateUserRequest(c, starks.Id, arya.Id); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if _, err = CreateReport(c, arya.Id, ReportKindTeam, lannisters.Id, "they killed my father"); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if _, err = CreateReport(c, jon.Id, ReportKindUser, arya.Id, "she has a list"); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if err = jon.Block(c, arya.Id); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	if err = CheckUserDeletion(c, arya); err != nil {
+		t.Fatalf("Error: want arya to be deletable, got %v", err)
+	}
+	if refs, err := UserDataReferences(c, arya.Id); err != nil || len(refs) == 0 {
+		t.Fatalf("Error: want references to arya before the deletion, got %v, %v", refs, err)
+	}
+
+	d, err := StartUserDeletion(c, arya)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if again, err := StartUserDeletion(c, arya); err != nil || !again.Requested.Equal(d.Requested) {
+		t.Errorf("Error: want the running deletion, got %v, %v", again, err)
+	}
+	if sessions, tokens := UserSessions(c, arya.Id), UserAccessTokens(c, arya.Id); len(sessions) != 0 || len(tokens) != 0 {
+		t.Errorf("Error: want sessions and access tokens revoked when the deletion starts, got %d sessions and %d tokens", len(sessions), len(tokens))
+	}
+
+	for runs := 0; !d.IsCompleted(); runs++ {
+		if runs > 50 {
+			t.Fatalf("Error: deletion is not completed after %d runs: %+v", runs, d.Steps)
+		}
+		if err = d.Run(c, 2); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if d, err = UserDeletionByUserID(c, arya.Id); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+	}
+
+	if d.State() != UserDeletionVerified {
+		t.Errorf("Error: want deletion %s, got %s with references %v", UserDeletionVerified, d.State(), d.Remaining)
+	}
+	if step := d.step("predicts"); step.Deleted != 3 {
+		t.Errorf("Error: want 3 predicts deleted, got %+v", step)
+	}
+
+	if starks, err = TeamByID(c, starks.Id); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if lannisters, err = TeamByID(c, lannisters.Id); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if jon, err = UserByID(c, jon.Id); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	feeds, err := repository.NewQuery(userActivityKind).Filter("ToId =", activity.Id).KeysOnly().GetAll(c, nil)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	var prices []*Activity
+	if _, err = repository.NewQuery("Activity").Filter("Type =", "price").GetAll(c, &prices); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	tests := []struct {
+		title string
+		got   bool
+	}{
+		{title: "user is deleted", got: !userExists(c, arya.Id)},
+		{title: "other users are kept", got: starks.ContainsUserID(c, jon.Id) && starks.IsOwner(jon.Id)},
+		{title: "team members are updated", got: starks.MembersCount == 1 && len(starks.ModeratorIds) == 0},
+		{title: "team bans are removed", got: !lannisters.IsBanned(arya.Id)},
+		{title: "activities of the user are removed from feeds", got: len(jon.ActivityIDs(c)) == 1 && len(feeds) == 0},
+		{title: "activities naming the user are anonymized", got: len(prices) == 1 && prices[0].Object.Id == 0 && prices[0].Object.DisplayName == ""},
+		{title: "users are unblocked", got: !jon.HasBlocked(arya.Id)},
+		{title: "cannot sign in with the identity", got: signinUserID(c, IdentityGoogle, "1") != arya.Id},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+		if !test.got {
+			t.Errorf("test %v - Error: %s", i, test.title)
+		}
+	}
+}
+
+// TestCheckUserDeletion tests that the last owner of a team and the only admin of a tournament cannot be deleted.
+//
+func TestCheckUserDeletion(t *testing.T) {
+	repository.Use(repository.NewMemory())
+	defer repository.Use(repository.Datastore)
+	memcache.Use(memcache.NewMemory())
+
+	c := repository.NewLocalContext(nil)
+
+	owner, err := CreateUser(c, "ned@winterfell.com", "ned", "Eddard Stark", "", false, "")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	admin, err := CreateUser(c, "robert@kingslanding.com", "robert", "Robert Baratheon", "", false, "")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	team, err := CreateTeam(c, "starks", "winter is coming", owner.Id, false)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if err = team.Join(c, owner); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if _, err = CreateTournament(c, "world cup", "", time.Now(), time.Now(), admin.Id); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	tests := []struct {
+		title string
+		user  *User
+		err   error
+	}{
+		{title: "last owner of a team", user: owner, err: ErrUserLastTeamOwner},
+		{title: "only admin of a tournament", user: admin, err: ErrUserLastTournamentAdmin},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+		if err = CheckUserDeletion(c, test.user); err != test.err {
+			t.Errorf("test %v - Error: want err %v, got %v", i, test.err, err)
+		}
+		if _, err = StartUserDeletion(c, test.user); err != test.err {
+			t.Errorf("test %v - Error: want err %v when starting the deletion, got %v", i, test.err, err)
+		}
+	}
+}
+
+// TestExportUserData tests that the data of a user is exported.
+//
+func TestExportUserData(t *testing.T) {
+	repository.Use(repository.NewMemory())
+	defer repository.Use(repository.Datastore)
+	memcache.Use(memcache.NewMemory())
+
+	c := repository.NewLocalContext(nil)
+
+	u, err := SigninUserWithIdentity(c, IdentityTwitter, "1", "", false, "arya", "Arya Stark")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	team, err := CreateTeam(c, "starks", "winter is coming", u.Id, false)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if err = team.Join(c, u); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	tournament, err := CreateTournament(c, "world cup", "", time.Now(), time.Now(), u.Id)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if err = tournament.AddUserID(c, u.Id); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if _, err = CreatePredict(c, u.Id, 1, 0, 1); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if err = u.Publish(c, "welcome", "joined gonawin", ActivityEntity{}, ActivityEntity{}); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if err = team.Publish(c, "price", "awarded the first price to", u.Entity(), tournament.Entity()); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	d, err := ExportUserData(c, u)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	tests := []struct {
+		title string
+		got   bool
+	}{
+		{title: "profile", got: d.User.Id == u.Id},
+		{title: "identities", got: len(d.Identities) == 1 && d.Identities[0].Provider == IdentityTwitter},
+		{title: "teams with the role of the user", got: len(d.Teams) == 1 && d.Teams[0].Role == TeamRoleOwner},
+		{title: "tournaments", got: len(d.Tournaments) == 1 && d.Tournaments[0].Admin},
+		{title: "predicts", got: len(d.Predicts) == 1},
+		{title: "activities", got: len(d.Activities) > 0},
+		{title: "activities naming the user", got: len(d.Mentions) == 1 && d.Mentions[0].Type == "price"},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+		if !test.got {
+			t.Errorf("test %v - Error: %s", i, test.title)
+		}
+	}
+}
+
+// userExists reports whether a user entity exists.
+func userExists(c appengine.Context, id int64) bool {
+	_, err := UserByID(c, id)
+	return err == nil
+}
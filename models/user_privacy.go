@@ -0,0 +1,158 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package models
+
+import (
+	"time"
+
+	"appengine"
+
+	"github.com/taironas/gonawin/helpers"
+	"github.com/taironas/gonawin/helpers/log"
+)
+
+// Visibilities of the profile of a user.
+const (
+	ProfilePublic    = "public"    // everybody can see the teams, tournaments and scores of the user.
+	ProfileTeammates = "teammates" // only the members of the teams of the user can see them.
+	ProfilePrivate   = "private"   // only the user can see them.
+)
+
+// ProfileVisibilities are the supported visibilities of a profile.
+//
+var ProfileVisibilities = []string{ProfilePublic, ProfileTeammates, ProfilePrivate}
+
+// UserPrivacy holds the privacy settings of a user.
+// The zero value is the default: a public profile, predictions, search results and activities.
+//
+type UserPrivacy struct {
+	Profile         string // visibility of the profile, public when empty.
+	HidePredictions bool   // the predictions of the user are hidden from the other users until kickoff.
+	HideFromSearch  bool   // the user is not returned by the searches of the other users.
+	HideActivities  bool   // the activities of the user are hidden from the feeds of non teammates.
+}
+
+// IsValidProfileVisibility checks if a profile visibility is supported.
+//
+func IsValidProfileVisibility(visibility string) bool {
+	for _, v := range ProfileVisibilities {
+		if v == visibility {
+			return true
+		}
+	}
+	return false
+}
+
+// ProfileVisibility returns the visibility of the profile of the user.
+//
+func (u *User) ProfileVisibility() string {
+	if len(u.Privacy.Profile) == 0 {
+		return ProfilePublic
+	}
+	return u.Privacy.Profile
+}
+
+// IsTeammate checks if the user and another user are members of the same team.
+//
+func (u *User) IsTeammate(c appengine.Context, other *User) bool {
+	if other == nil {
+		return false
+	}
+	teamIDs := other.TeamIDs(c)
+	for _, id := range u.TeamIDs(c) {
+		if ok, _ := helpers.Contains(teamIDs, id); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// CanSeeProfile checks if a viewer can see the teams, tournaments and scores of the user.
+// The user and the gonawin admins always see them.
+//
+func (u *User) CanSeeProfile(c appengine.Context, viewer *User) bool {
+	if viewer != nil && (viewer.Id == u.Id || viewer.IsAdmin) {
+		return true
+	}
+	switch u.ProfileVisibility() {
+	case ProfilePublic:
+		return true
+	case ProfileTeammates:
+		return u.IsTeammate(c, viewer)
+	}
+	return false
+}
+
+// HidesPredictionFrom checks if the prediction of the user on a match starting at kickoff
+// is hidden from a viewer. Predictions are only hidden from the other users before kickoff.
+//
+func (u *User) HidesPredictionFrom(viewer *User, kickoff time.Time) bool {
+	if !u.Privacy.HidePredictions || (viewer != nil && viewer.Id == u.Id) {
+		return false
+	}
+	return time.Now().Before(kickoff)
+}
+
+// IsHiddenFromSearch checks if the user is hidden from the search results of a viewer.
+// A user always finds himself and the gonawin admins find all the users.
+//
+func (u *User) IsHiddenFromSearch(viewer *User) bool {
+	if !u.Privacy.HideFromSearch {
+		return false
+	}
+	return viewer == nil || (viewer.Id != u.Id && !viewer.IsAdmin)
+}
+
+// FilterHiddenActivities returns the activities of a feed the viewer can see, without the
+// activities published by users hiding them, unless the viewer is a teammate of the publisher.
+// The activities of teams and tournaments are always seen.
+//
+func FilterHiddenActivities(c appengine.Context, activities []*Activity, viewer *User) []*Activity {
+
+	var ids []int64
+	for _, a := range activities {
+		if a.publishedByUser() && a.CreatorID != viewer.Id {
+			if ok, _ := helpers.Contains(ids, a.CreatorID); !ok {
+				ids = append(ids, a.CreatorID)
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return activities
+	}
+
+	creators, err := UsersByIds(c, ids)
+	if err != nil {
+		log.Errorf(c, "FilterHiddenActivities: unable to get creators of activities: %v", err)
+		return activities
+	}
+
+	hidden := make(map[int64]bool)
+	for _, creator := range creators {
+		if creator.Privacy.HideActivities && !creator.IsTeammate(c, viewer) {
+			hidden[creator.Id] = true
+		}
+	}
+
+	visible := make([]*Activity, 0, len(activities))
+	for _, a := range activities {
+		if !a.publishedByUser() || !hidden[a.CreatorID] {
+			visible = append(visible, a)
+		}
+	}
+	return visible
+}
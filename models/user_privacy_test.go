@@ -0,0 +1,198 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/taironas/gonawin/helpers/memcache"
+	"github.com/taironas/gonawin/repository"
+)
+
+// TestCanSeeProfile tests the visibility of the profile of a user.
+//
+func TestCanSeeProfile(t *testing.T) {
+	repository.Use(repository.NewMemory())
+	defer repository.Use(repository.Datastore)
+	memcache.Use(memcache.NewMemory())
+
+	c := repository.NewLocalContext(nil)
+
+	arya, err := CreateUser(c, "arya@winterfell.com", "arya", "Arya Stark", "", false, "")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	jon, err := CreateUser(c, "jon@winterfell.com", "jon", "Jon Snow", "", false, "")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	cersei, err := CreateUser(c, "cersei@kingslanding.com", "cersei", "Cersei Lannister", "", false, "")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	admin, err := CreateUser(c, "admin@gonawin.com", "admin", "Admin", "", true, "")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	starks, err := CreateTeam(c, "starks", "winter is coming", jon.Id, false)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	for _, u := range []*User{jon, arya} {
+		if err = starks.Join(c, u); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+	}
+
+	tests := []struct {
+		title   string
+		profile string
+		viewer  *User
+		want    bool
+	}{
+		{"default profile is public", "", cersei, true},
+		{"public profile", ProfilePublic, cersei, true},
+		{"teammates profile seen by a teammate", ProfileTeammates, jon, true},
+		{"teammates profile hidden from a stranger", ProfileTeammates, cersei, false},
+		{"private profile hidden from a teammate", ProfilePrivate, jon, false},
+		{"private profile seen by the user", ProfilePrivate, arya, true},
+		{"private profile seen by an admin", ProfilePrivate, admin, true},
+	}
+
+	for _, test := range tests {
+		t.Log(test.title)
+		arya.Privacy.Profile = test.profile
+		if got := arya.CanSeeProfile(c, test.viewer); got != test.want {
+			t.Errorf("test %q - error: expected %v got %v", test.title, test.want, got)
+		}
+	}
+}
+
+// TestHidesPredictionFrom tests that hidden predictions are revealed at kickoff.
+//
+func TestHidesPredictionFrom(t *testing.T) {
+	arya := &User{Id: 1, Privacy: UserPrivacy{HidePredictions: true}}
+	jon := &User{Id: 2}
+
+	tomorrow := time.Now().Add(24 * time.Hour)
+	yesterday := time.Now().Add(-24 * time.Hour)
+
+	tests := []struct {
+		title   string
+		user    *User
+		viewer  *User
+		kickoff time.Time
+		want    bool
+	}{
+		{"prediction hidden before kickoff", arya, jon, tomorrow, true},
+		{"prediction revealed after kickoff", arya, jon, yesterday, false},
+		{"prediction seen by the user", arya, arya, tomorrow, false},
+		{"prediction not hidden by default", jon, arya, tomorrow, false},
+	}
+
+	for _, test := range tests {
+		t.Log(test.title)
+		if got := test.user.HidesPredictionFrom(test.viewer, test.kickoff); got != test.want {
+			t.Errorf("test %q - error: expected %v got %v", test.title, test.want, got)
+		}
+	}
+}
+
+// TestIsHiddenFromSearch tests that users hidden from search are only found by themselves and the admins.
+//
+func TestIsHiddenFromSearch(t *testing.T) {
+	arya := &User{Id: 1, Privacy: UserPrivacy{HideFromSearch: true}}
+	jon := &User{Id: 2}
+	admin := &User{Id: 3, IsAdmin: true}
+
+	tests := []struct {
+		title  string
+		user   *User
+		viewer *User
+		want   bool
+	}{
+		{"hidden from another user", arya, jon, true},
+		{"found by the user", arya, arya, false},
+		{"found by an admin", arya, admin, false},
+		{"found by default", jon, arya, false},
+	}
+
+	for _, test := range tests {
+		t.Log(test.title)
+		if got := test.user.IsHiddenFromSearch(test.viewer); got != test.want {
+			t.Errorf("test %q - error: expected %v got %v", test.title, test.want, got)
+		}
+	}
+}
+
+// TestFilterHiddenActivities tests that activities of users hiding them are only seen by their teammates.
+//
+func TestFilterHiddenActivities(t *testing.T) {
+	repository.Use(repository.NewMemory())
+	defer repository.Use(repository.Datastore)
+	memcache.Use(memcache.NewMemory())
+
+	c := repository.NewLocalContext(nil)
+
+	arya, err := CreateUser(c, "arya@winterfell.com", "arya", "Arya Stark", "", false, "")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	jon, err := CreateUser(c, "jon@winterfell.com", "jon", "Jon Snow", "", false, "")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	cersei, err := CreateUser(c, "cersei@kingslanding.com", "cersei", "Cersei Lannister", "", false, "")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	starks, err := CreateTeam(c, "starks", "winter is coming", jon.Id, false)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	for _, u := range []*User{jon, arya} {
+		if err = starks.Join(c, u); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+	}
+
+	arya.Privacy.HideActivities = true
+	if err = arya.Update(c); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	// the ids of teams and users can be the same.
+	team := ActivityEntity{Id: arya.Id, Type: "team", DisplayName: "wolves"}
+	activities := []*Activity{
+		{Id: 1, CreatorID: arya.Id, Actor: arya.Entity()},
+		{Id: 2, CreatorID: jon.Id, Actor: jon.Entity()},
+		{Id: 3, CreatorID: cersei.Id, Actor: cersei.Entity()},
+		{Id: 4},
+		{Id: 5, CreatorID: team.Id, Actor: team},
+	}
+
+	tests := []struct {
+		title  string
+		viewer *User
+		want   []int64
+	}{
+		{"activities seen by a teammate", jon, []int64{1, 2, 3, 4, 5}},
+		{"activities seen by the user", arya, []int64{1, 2, 3, 4, 5}},
+		{"activities hidden from a stranger", cersei, []int64{2, 3, 4, 5}},
+	}
+
+	for _, test := range tests {
+		t.Log(test.title)
+		got := FilterHiddenActivities(c, activities, test.viewer)
+		if len(got) != len(test.want) {
+			t.Errorf("test %q - error: expected %d activities got %d", test.title, len(test.want), len(got))
+			continue
+		}
+		for i, a := range got {
+			if a.Id != test.want[i] {
+				t.Errorf("test %q - error: expected activity %d got %d", test.title, test.want[i], a.Id)
+			}
+		}
+	}
+}
@@ -20,9 +20,9 @@ import (
 	"time"
 
 	"appengine"
-	"appengine/datastore"
 
 	"github.com/taironas/gonawin/helpers/log"
+	"github.com/taironas/gonawin/repository"
 )
 
 // UserRequest represents the user request entity.
@@ -47,16 +47,16 @@ type UserRequestJSON struct {
 //
 func CreateUserRequest(c appengine.Context, teamID int64, userID int64) (*UserRequest, error) {
 	// create new team request
-	id, _, err := datastore.AllocateIDs(c, "UserRequest", nil, 1)
+	id, _, err := repository.AllocateIDs(c, "UserRequest", 1)
 	if err != nil {
 		return nil, err
 	}
 
-	key := datastore.NewKey(c, "UserRequest", "", id, nil)
+	key := repository.NewKey("UserRequest", "", id)
 
 	ur := &UserRequest{id, teamID, userID, time.Now()}
 
-	_, err = datastore.Put(c, key, ur)
+	_, err = repository.Put(c, key, ur)
 	if err != nil {
 		return nil, err
 	}
@@ -67,15 +67,15 @@ func CreateUserRequest(c appengine.Context, teamID int64, userID int64) (*UserRe
 // Destroy a user request given a teamrequestid.
 //
 func (ur *UserRequest) Destroy(c appengine.Context) error {
-	key := datastore.NewKey(c, "UserRequest", "", ur.Id, nil)
-	return datastore.Delete(c, key)
+	key := repository.NewKey("UserRequest", "", ur.Id)
+	return repository.Delete(c, key)
 }
 
 // FindUserRequests searches for all TeamRequest entities with respect of a filter and a value.
 //
 func FindUserRequests(c appengine.Context, filter string, value interface{}) []*UserRequest {
 
-	q := datastore.NewQuery("UserRequest").Filter(filter+" =", value)
+	q := repository.NewQuery("UserRequest").Filter(filter+" =", value)
 
 	var userRequests []*UserRequest
 
@@ -89,7 +89,7 @@ func FindUserRequests(c appengine.Context, filter string, value interface{}) []*
 //
 func FindUserRequestByTeamAndUser(c appengine.Context, teamID int64, userID int64) *UserRequest {
 
-	q := datastore.NewQuery("UserRequest").Filter("TeamId =", teamID).Filter("UserId =", userID).Limit(1)
+	q := repository.NewQuery("UserRequest").Filter("TeamId =", teamID).Filter("UserId =", userID).Limit(1)
 
 	var userRequests []*UserRequest
 
@@ -108,9 +108,9 @@ func FindUserRequestByTeamAndUser(c appengine.Context, teamID int64, userID int6
 func UserRequestByID(c appengine.Context, id int64) (*UserRequest, error) {
 
 	var ur UserRequest
-	key := datastore.NewKey(c, "UserRequest", "", id, nil)
+	key := repository.NewKey("UserRequest", "", id)
 
-	if err := datastore.Get(c, key, &ur); err != nil {
+	if err := repository.Get(c, key, &ur); err != nil {
 		log.Errorf(c, " userrequest.ById, error occurred during Get: %v", err)
 		return &ur, err
 	}
@@ -8,6 +8,7 @@ import (
 
 	"appengine/aetest"
 
+	"github.com/taironas/gonawin/helpers"
 	"github.com/taironas/gonawin/test"
 )
 
@@ -538,7 +539,7 @@ func TestUserTeams(t *testing.T) {
 		}
 
 		if test.missingTeam {
-			if err = user.AddTeamID(c, 666 /*extra team Id*/); err != nil {
+			if err = addRelation(c, teamMemberKind, 666 /*extra team Id*/, user.Id); err != nil {
 				t.Errorf("Error: %v", err)
 			}
 		}
@@ -750,9 +751,9 @@ func TestUserTournamentsByPage(t *testing.T) {
 	}
 }
 
-// TestUserAddPredictID tests that predict Id is well added to a user entity.
+// TestUserPredicts tests that the predictions of a user are retrieved from the user entity.
 //
-func TestUserAddPredictID(t *testing.T) {
+func TestUserPredicts(t *testing.T) {
 
 	var c aetest.Context
 	var err error
@@ -764,14 +765,12 @@ func TestUserAddPredictID(t *testing.T) {
 	defer c.Close()
 
 	tests := []struct {
-		title     string
-		predictID int64
-		err       string
+		title   string
+		matches []int64
 	}{
 		{
-			"can add predict Id to user",
-			42,
-			"",
+			"can get predicts of user",
+			[]int64{42, 43},
 		},
 	}
 
@@ -783,19 +782,33 @@ func TestUserAddPredictID(t *testing.T) {
 	for _, test := range tests {
 		t.Log(test.title)
 
-		err = user.AddPredictID(c, test.predictID)
+		var want []int64
+		for _, matchID := range test.matches {
+			var p *Predict
+			if p, err = CreatePredict(c, user.Id, 1, 0, matchID); err != nil {
+				t.Errorf("Error: %v", err)
+			}
+			want = append(want, p.Id)
+		}
 
-		if !strings.Contains(gonawintest.ErrorString(err), test.err) {
-			t.Errorf("Error: want err: %s, got: %q", test.err, err)
-		} else if test.err == "" && user.PredictIds[0] != test.predictID {
-			t.Errorf("Error: a predict Id should have been retrieved from the user")
+		var got []int64
+		if got, err = user.PredictIDs(c); err != nil {
+			t.Errorf("Error: %v", err)
+		}
+		if len(got) != len(want) {
+			t.Errorf("Error: want predicts count == %d, got %d", len(want), len(got))
+		}
+		for _, id := range want {
+			if ok, _ := helpers.Contains(got, id); !ok {
+				t.Errorf("Error: predict Id %d should have been retrieved from the user", id)
+			}
 		}
 	}
 }
 
-// TestUserAddTournamentID tests that tournament Id is well added to a user entity.
+// TestUserContainsTournamentID tests if a user participates in a tournament.
 //
-func TestUserAddTournamentID(t *testing.T) {
+func TestUserContainsTournamentID(t *testing.T) {
 	var c aetest.Context
 	var err error
 	options := aetest.Options{StronglyConsistentDatastore: true}
@@ -805,95 +818,50 @@ func TestUserAddTournamentID(t *testing.T) {
 	}
 	defer c.Close()
 
-	tests := []struct {
-		title        string
-		tournamentId int64
-		err          string
-	}{
-		{
-			"can add tournament Id to user",
-			42,
-			"",
-		},
-		{
-			"cannot add twice same tournament Id to user",
-			42,
-			"AddTournamentID, allready a member",
-		},
-	}
-
 	var user *User
 	if user, err = CreateUser(c, "john.snow@winterfell.com", "john.snow", "John Snow", "Crow", false, ""); err != nil {
 		t.Errorf("Error: %v", err)
 	}
 
-	for _, test := range tests {
-		t.Log(test.title)
-		err = user.AddTournamentID(c, test.tournamentId)
-
-		if !strings.Contains(gonawintest.ErrorString(err), test.err) {
-			t.Errorf("Error: want err: %s, got: %q", test.err, err)
-		} else if test.err == "" && user.TournamentIds[0] != test.tournamentId {
-			t.Errorf("Error: a tournament Id should have been retrieved from the user")
-		}
-	}
-}
-
-// TestUserContainsTournamentID tests if a tournament Id exists for a user entity.
-//
-func TestUserContainsTournamentID(t *testing.T) {
-	var c aetest.Context
-	var err error
-	options := aetest.Options{StronglyConsistentDatastore: true}
-
-	if c, err = aetest.NewContext(&options); err != nil {
-		t.Fatal(err)
+	var tournament *Tournament
+	if tournament, err = CreateTournament(c, "tournament", "description", time.Now(), time.Now(), 10); err != nil {
+		t.Errorf("Error: %v", err)
 	}
-	defer c.Close()
 
 	tests := []struct {
 		title        string
-		tournamentId int64
+		tournamentID int64
 		contains     bool
-		index        int
 	}{
 		{
 			"contains tournament Id from user",
-			42,
+			tournament.Id,
 			true,
-			0,
 		},
 		{
 			"does not contain tournament Id from user",
 			54,
 			false,
-			-1,
 		},
 	}
 
-	var user *User
-	if user, err = CreateUser(c, "john.snow@winterfell.com", "john.snow", "John Snow", "Crow", false, ""); err != nil {
+	if err = tournament.AddUserID(c, user.Id); err != nil {
 		t.Errorf("Error: %v", err)
 	}
-
-	if err = user.AddTournamentID(c, tests[0].tournamentId); err != nil {
-		t.Errorf("Error: %v", err)
+	if err = tournament.AddUserID(c, user.Id); !strings.Contains(gonawintest.ErrorString(err), "AddUserID, allready a member") {
+		t.Errorf("Error: want err: AddUserID, allready a member, got: %q", err)
 	}
 
 	for _, test := range tests {
 		t.Log(test.title)
 
-		contains, index := user.ContainsTournamentID(test.tournamentId)
-
-		if contains != test.contains {
+		if contains := user.ContainsTournamentID(c, test.tournamentID); contains != test.contains {
 			t.Errorf("Error: want contains: %t, got: %t", test.contains, contains)
-		} else if index != test.index {
-			t.Errorf("Error: want index: %d, got: %d", test.index, index)
 		}
 	}
 }
 
-// TestUserRemoveTournamentID tests that tournament Id is well removed from a user entity.
+// TestUserRemoveTournamentID tests that a user no longer participates in a tournament he was removed from.
 //
 func TestUserRemoveTournamentID(t *testing.T) {
 	var c aetest.Context
@@ -905,42 +873,42 @@ func TestUserRemoveTournamentID(t *testing.T) {
 	}
 	defer c.Close()
 
+	var user *User
+	if user, err = CreateUser(c, "john.snow@winterfell.com", "john.snow", "John Snow", "Crow", false, ""); err != nil {
+		t.Errorf("Error: %v", err)
+	}
+
+	var tournament *Tournament
+	if tournament, err = CreateTournament(c, "tournament", "description", time.Now(), time.Now(), 10); err != nil {
+		t.Errorf("Error: %v", err)
+	}
+
+	if err = tournament.AddUserID(c, user.Id); err != nil {
+		t.Errorf("Error: %v", err)
+	}
+
 	tests := []struct {
-		title        string
-		tournamentId int64
-		err          string
+		title string
+		err   string
 	}{
 		{
 			"can remove tournament Id from user",
-			42,
 			"",
 		},
 		{
 			"cannot remove tournament Id from user",
-			54,
-			"RemoveTournamentID, not a member",
+			"RemoveUserID, not a member",
 		},
 	}
 
-	var user *User
-	if user, err = CreateUser(c, "john.snow@winterfell.com", "john.snow", "John Snow", "Crow", false, ""); err != nil {
-		t.Errorf("Error: %v", err)
-	}
-
-	if err = user.AddTournamentID(c, tests[0].tournamentId); err != nil {
-		t.Errorf("Error: %v", err)
-	}
-
 	for _, test := range tests {
 		t.Log(test.title)
 
-		err = user.RemoveTournamentID(c, test.tournamentId)
-
-		contains, _ := user.ContainsTournamentID(test.tournamentId)
+		err = tournament.RemoveUserID(c, user.Id)
 
 		if !strings.Contains(gonawintest.ErrorString(err), test.err) {
 			t.Errorf("Error: want err: %s, got: %q", test.err, err)
-		} else if test.err == "" && contains {
+		} else if test.err == "" && user.ContainsTournamentID(c, tournament.Id) {
 			t.Errorf("Error: tournament IDs should be empty")
 		}
 	}
@@ -1010,9 +978,9 @@ func TestUserTournaments(t *testing.T) {
 	}
 }
 
-// TestUserAddTeamID tests that team Id is well added to a user entity.
+// TestUserRemoveTeamID tests that a user is no longer a member of a team he was removed from.
 //
-func TestUserAddTeamID(t *testing.T) {
+func TestUserRemoveTeamID(t *testing.T) {
 
 	var c aetest.Context
 	var err error
@@ -1023,95 +991,48 @@ func TestUserAddTeamID(t *testing.T) {
 	}
 	defer c.Close()
 
-	tests := []struct {
-		title  string
-		teamID int64
-		err    string
-	}{
-		{
-			"can add team Id to user",
-			42,
-			"",
-		},
-		{
-			"cannot add twice same team Id to user",
-			42,
-			"AddTeamID, allready a member",
-		},
-	}
-
 	var user *User
 	if user, err = CreateUser(c, "john.snow@winterfell.com", "john.snow", "John Snow", "Crow", false, ""); err != nil {
 		t.Errorf("Error: %v", err)
 	}
 
-	for i, test := range tests {
-		t.Log(test.title)
-		err = user.AddTeamID(c, test.teamId)
-
-		if !strings.Contains(gonawintest.ErrorString(err), test.err) {
-			t.Errorf("test %d - Error: want err: %s, got: %q", i, test.err, err)
-		} else if test.err == "" && user.TeamIds[0] != test.teamId {
-			t.Errorf("test %d - Error: a team Id should have been retrieved from the user", i)
-		}
+	var team *Team
+	if team, err = CreateTeam(c, "night's watch", "guards of the wall", 10, false); err != nil {
+		t.Errorf("Error: %v", err)
 	}
-}
-
-// TestUserRemoveTeamID tests that team Id is well removed from a user entity.
-//
-func TestUserRemoveTeamID(t *testing.T) {
 
-	var c aetest.Context
-	var err error
-	options := aetest.Options{StronglyConsistentDatastore: true}
-
-	if c, err = aetest.NewContext(&options); err != nil {
-		t.Fatal(err)
+	if err = team.AddUserID(c, user.Id); err != nil {
+		t.Errorf("Error: %v", err)
 	}
-	defer c.Close()
 
 	tests := []struct {
-		title  string
-		teamID int64
-		err    string
+		title string
+		err   string
 	}{
 		{
 			"can remove team Id from user",
-			42,
 			"",
 		},
 		{
 			"cannot remove team Id from user",
-			54,
-			"RemoveTeamID, not a member",
+			"RemoveUserID, not a member",
 		},
 	}
 
-	var user *User
-	if user, err = CreateUser(c, "john.snow@winterfell.com", "john.snow", "John Snow", "Crow", false, ""); err != nil {
-		t.Errorf("Error: %v", err)
-	}
-
-	if err = user.AddTeamID(c, tests[0].teamID); err != nil {
-		t.Errorf("Error: %v", err)
-	}
-
 	for i, test := range tests {
 		t.Log(test.title)
 
-		err = user.RemoveTeamID(c, test.teamId)
-
-		contains, _ := user.ContainsTeamID(test.teamId)
+		err = team.RemoveUserID(c, user.Id)
 
 		if !strings.Contains(gonawintest.ErrorString(err), test.err) {
 			t.Errorf("test %d - Error: want err: %s, got: %q", i, test.err, err)
-		} else if test.err == "" && contains {
+		} else if test.err == "" && user.ContainsTeamID(c, team.Id) {
 			t.Errorf("test %d - Error: team IDs should be empty", i)
 		}
 	}
 }
 
-// TestUserContainsTeamID tests if a team Id exists for a user entity.
+// TestUserContainsTeamID tests if a user is a member of a team.
 //
 func TestUserContainsTeamID(t *testing.T) {
 	var c aetest.Context
@@ -1123,44 +1044,45 @@ func TestUserContainsTeamID(t *testing.T) {
 	}
 	defer c.Close()
 
+	var user *User
+	if user, err = CreateUser(c, "john.snow@winterfell.com", "john.snow", "John Snow", "Crow", false, ""); err != nil {
+		t.Errorf("Error: %v", err)
+	}
+
+	var team *Team
+	if team, err = CreateTeam(c, "night's watch", "guards of the wall", 10, false); err != nil {
+		t.Errorf("Error: %v", err)
+	}
+
 	tests := []struct {
 		title    string
 		teamID   int64
 		contains bool
-		index    int
 	}{
 		{
 			"contains team Id from user",
-			42,
+			team.Id,
 			true,
-			0,
 		},
 		{
 			"does not contain team Id from user",
 			54,
 			false,
-			-1,
 		},
 	}
 
-	var user *User
-	if user, err = CreateUser(c, "john.snow@winterfell.com", "john.snow", "John Snow", "Crow", false, ""); err != nil {
+	if err = team.AddUserID(c, user.Id); err != nil {
 		t.Errorf("Error: %v", err)
 	}
-
-	if err = user.AddTeamID(c, tests[0].teamID); err != nil {
-		t.Errorf("Error: %v", err)
+	if err = team.AddUserID(c, user.Id); !strings.Contains(gonawintest.ErrorString(err), "AddUserID, allready a member") {
+		t.Errorf("Error: want err: AddUserID, allready a member, got: %q", err)
 	}
 
 	for i, test := range tests {
 		t.Log(test.title)
 
-		contains, index := user.ContainsTeamID(test.teamId)
-
-		if contains != test.contains {
+		if contains := user.ContainsTeamID(c, test.teamID); contains != test.contains {
 			t.Errorf("test %d - Error: want contains: %t, got: %t", i, test.contains, contains)
-		} else if index != test.index {
-			t.Errorf("test %d - Error: want index: %d, got: %d", i, test.index, index)
 		}
 	}
 }
@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package repository
+
+import (
+	"log"
+	"net/http"
+
+	"appengine"
+)
+
+// localContext is an appengine.Context for code running outside App Engine.
+// It logs with the standard logger. App Engine services are not available.
+type localContext struct {
+	appengine.Context
+	req *http.Request
+}
+
+// NewLocalContext returns an appengine.Context usable with a repository
+// other than Datastore, for tests or outside App Engine.
+//
+func NewLocalContext(r *http.Request) appengine.Context {
+	return &localContext{req: r}
+}
+
+func (c *localContext) logf(level, format string, args ...interface{}) {
+	log.Printf(level+": "+format, args...)
+}
+
+func (c *localContext) Debugf(format string, args ...interface{}) {
+	c.logf("DEBUG", format, args...)
+}
+
+func (c *localContext) Infof(format string, args ...interface{}) {
+	c.logf("INFO", format, args...)
+}
+
+func (c *localContext) Warningf(format string, args ...interface{}) {
+	c.logf("WARNING", format, args...)
+}
+
+func (c *localContext) Errorf(format string, args ...interface{}) {
+	c.logf("ERROR", format, args...)
+}
+
+func (c *localContext) Criticalf(format string, args ...interface{}) {
+	c.logf("CRITICAL", format, args...)
+}
+
+func (c *localContext) FullyQualifiedAppID() string {
+	return "gonawin"
+}
+
+func (c *localContext) Request() interface{} {
+	return c.req
+}
@@ -0,0 +1,204 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package repository
+
+import (
+	"appengine"
+	"appengine/datastore"
+)
+
+// Datastore is the repository backed by App Engine datastore.
+//
+var Datastore Repository = datastoreRepository{}
+
+type datastoreRepository struct{}
+
+// toDatastoreKey converts a repository key into a datastore key.
+func toDatastoreKey(c appengine.Context, k *Key) *datastore.Key {
+	if k == nil {
+		return nil
+	}
+	return datastore.NewKey(c, k.kind, k.stringID, k.intID, nil)
+}
+
+// toDatastoreKeys converts repository keys into datastore keys.
+func toDatastoreKeys(c appengine.Context, keys []*Key) []*datastore.Key {
+	dkeys := make([]*datastore.Key, len(keys))
+	for i, k := range keys {
+		dkeys[i] = toDatastoreKey(c, k)
+	}
+	return dkeys
+}
+
+// fromDatastoreKey converts a datastore key into a repository key.
+func fromDatastoreKey(k *datastore.Key) *Key {
+	if k == nil {
+		return nil
+	}
+	return NewKey(k.Kind(), k.StringID(), k.IntID())
+}
+
+// fromDatastoreKeys converts datastore keys into repository keys.
+func fromDatastoreKeys(dkeys []*datastore.Key) []*Key {
+	if dkeys == nil {
+		return nil
+	}
+	keys := make([]*Key, len(dkeys))
+	for i, k := range dkeys {
+		keys[i] = fromDatastoreKey(k)
+	}
+	return keys
+}
+
+// fromDatastoreError translates datastore errors into repository errors.
+func fromDatastoreError(err error) error {
+	switch err {
+	case datastore.ErrNoSuchEntity:
+		return ErrNoSuchEntity
+	case datastore.Done:
+		return Done
+	case datastore.ErrInvalidEntityType:
+		return ErrInvalidEntityType
+	case datastore.ErrConcurrentTransaction:
+		return ErrConcurrentTransaction
+	}
+	if me, ok := err.(appengine.MultiError); ok {
+		errs := make(appengine.MultiError, len(me))
+		for i, e := range me {
+			errs[i] = fromDatastoreError(e)
+		}
+		return errs
+	}
+	return err
+}
+
+func (datastoreRepository) AllocateIDs(c appengine.Context, kind string, n int) (int64, int64, error) {
+	low, high, err := datastore.AllocateIDs(c, kind, nil, n)
+	return low, high, fromDatastoreError(err)
+}
+
+func (datastoreRepository) Get(c appengine.Context, key *Key, dst interface{}) error {
+	return fromDatastoreError(datastore.Get(c, toDatastoreKey(c, key), dst))
+}
+
+func (datastoreRepository) GetMulti(c appengine.Context, keys []*Key, dst interface{}) error {
+	return fromDatastoreError(datastore.GetMulti(c, toDatastoreKeys(c, keys), dst))
+}
+
+func (datastoreRepository) Put(c appengine.Context, key *Key, src interface{}) (*Key, error) {
+	k, err := datastore.Put(c, toDatastoreKey(c, key), src)
+	return fromDatastoreKey(k), fromDatastoreError(err)
+}
+
+func (datastoreRepository) PutMulti(c appengine.Context, keys []*Key, src interface{}) ([]*Key, error) {
+	dkeys, err := datastore.PutMulti(c, toDatastoreKeys(c, keys), src)
+	return fromDatastoreKeys(dkeys), fromDatastoreError(err)
+}
+
+func (datastoreRepository) Delete(c appengine.Context, key *Key) error {
+	return fromDatastoreError(datastore.Delete(c, toDatastoreKey(c, key)))
+}
+
+func (datastoreRepository) DeleteMulti(c appengine.Context, keys []*Key) error {
+	return fromDatastoreError(datastore.DeleteMulti(c, toDatastoreKeys(c, keys)))
+}
+
+// query builds the datastore query matching q.
+func (datastoreRepository) query(c appengine.Context, q *Query) (*datastore.Query, error) {
+	dq := datastore.NewQuery(q.kind)
+	for _, f := range q.filters {
+		value := f.value
+		if k, ok := value.(*Key); ok {
+			value = toDatastoreKey(c, k)
+		}
+		dq = dq.Filter(f.field+" "+f.op, value)
+	}
+	for _, o := range q.orders {
+		if o.desc {
+			dq = dq.Order("-" + o.field)
+		} else {
+			dq = dq.Order(o.field)
+		}
+	}
+	if q.limit >= 0 {
+		dq = dq.Limit(q.limit)
+	}
+	if q.offset > 0 {
+		dq = dq.Offset(q.offset)
+	}
+	if q.start != "" {
+		cursor, err := datastore.DecodeCursor(string(q.start))
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		dq = dq.Start(cursor)
+	}
+	if q.keysOnly {
+		dq = dq.KeysOnly()
+	}
+	return dq, nil
+}
+
+func (r datastoreRepository) GetAll(c appengine.Context, q *Query, dst interface{}) ([]*Key, error) {
+	dq, err := r.query(c, q)
+	if err != nil {
+		return nil, err
+	}
+	dkeys, err := dq.GetAll(c, dst)
+	return fromDatastoreKeys(dkeys), fromDatastoreError(err)
+}
+
+func (r datastoreRepository) Count(c appengine.Context, q *Query) (int, error) {
+	dq, err := r.query(c, q)
+	if err != nil {
+		return 0, err
+	}
+	n, err := dq.Count(c)
+	return n, fromDatastoreError(err)
+}
+
+func (r datastoreRepository) Run(c appengine.Context, q *Query) *Iterator {
+	dq, err := r.query(c, q)
+	if err != nil {
+		return &Iterator{
+			next:   func(dst interface{}) (*Key, error) { return nil, err },
+			cursor: func() (Cursor, error) { return "", err },
+		}
+	}
+	t := dq.Run(c)
+	return &Iterator{
+		next: func(dst interface{}) (*Key, error) {
+			k, err := t.Next(dst)
+			return fromDatastoreKey(k), fromDatastoreError(err)
+		},
+		cursor: func() (Cursor, error) {
+			cursor, err := t.Cursor()
+			if err != nil {
+				return "", fromDatastoreError(err)
+			}
+			return Cursor(cursor.String()), nil
+		},
+	}
+}
+
+func (datastoreRepository) RunInTransaction(c appengine.Context, f func(tc appengine.Context) error, opts *TransactionOptions) error {
+	var dopts *datastore.TransactionOptions
+	if opts != nil {
+		dopts = &datastore.TransactionOptions{XG: opts.XG}
+	}
+	return fromDatastoreError(datastore.RunInTransaction(c, f, dopts))
+}
@@ -0,0 +1,173 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package repository
+
+import (
+	"encoding/gob"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"appengine"
+)
+
+// fileRepository is an in-memory repository saved to a file after each write.
+type fileRepository struct {
+	*memoryRepository
+	path   string
+	saveMu sync.Mutex
+}
+
+// fileSnapshot is the content of the data file of a file repository.
+type fileSnapshot struct {
+	Entities map[string]map[string]memoryEntity // entities by kind and encoded key.
+	IDs      map[string]int64                   // last allocated ID by kind.
+}
+
+// NewFile returns a repository that keeps entities in memory and saves them
+// to the file at path after each write. Entities already saved in the file
+// are loaded. As the whole file is written on each write, it is suited to
+// small installations.
+//
+func NewFile(path string) (Repository, error) {
+	r := &fileRepository{memoryRepository: NewMemory().(*memoryRepository), path: path}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return r, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var snapshot fileSnapshot
+	if err := gob.NewDecoder(f).Decode(&snapshot); err != nil {
+		return nil, err
+	}
+	for kind, entities := range snapshot.Entities {
+		r.entities[kind] = make(map[Key]memoryEntity, len(entities))
+		for k, e := range entities {
+			key, err := decodeKey(kind, k)
+			if err != nil {
+				return nil, err
+			}
+			r.entities[kind][*key] = e
+		}
+	}
+	for kind, id := range snapshot.IDs {
+		r.ids[kind] = id
+	}
+	return r, nil
+}
+
+// encodeKey encodes the ID of a key.
+func encodeKey(k Key) string {
+	if k.stringID != "" {
+		return "s" + k.stringID
+	}
+	return "i" + strconv.FormatInt(k.intID, 10)
+}
+
+// decodeKey decodes the ID of a key of the given kind.
+func decodeKey(kind, s string) (*Key, error) {
+	if strings.HasPrefix(s, "s") {
+		return NewKey(kind, s[1:], 0), nil
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(s, "i"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return NewKey(kind, "", id), nil
+}
+
+// save writes the entities to the data file. The file is replaced atomically.
+func (r *fileRepository) save() error {
+	r.mu.Lock()
+	snapshot := fileSnapshot{
+		Entities: make(map[string]map[string]memoryEntity, len(r.entities)),
+		IDs:      make(map[string]int64, len(r.ids)),
+	}
+	for kind, entities := range r.entities {
+		snapshot.Entities[kind] = make(map[string]memoryEntity, len(entities))
+		for k, e := range entities {
+			snapshot.Entities[kind][encodeKey(k)] = e
+		}
+	}
+	for kind, id := range r.ids {
+		snapshot.IDs[kind] = id
+	}
+	r.mu.Unlock()
+
+	r.saveMu.Lock()
+	defer r.saveMu.Unlock()
+
+	tmp, err := ioutil.TempFile(filepath.Dir(r.path), filepath.Base(r.path))
+	if err != nil {
+		return err
+	}
+	if err := gob.NewEncoder(tmp).Encode(&snapshot); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), r.path)
+}
+
+// saved returns err, or the error saving the data file when err is nil.
+func (r *fileRepository) saved(c appengine.Context, err error) error {
+	if err != nil || r.inTransaction() {
+		return err
+	}
+	return r.save()
+}
+
+func (r *fileRepository) AllocateIDs(c appengine.Context, kind string, n int) (int64, int64, error) {
+	low, high, err := r.memoryRepository.AllocateIDs(c, kind, n)
+	return low, high, r.saved(c, err)
+}
+
+func (r *fileRepository) Put(c appengine.Context, key *Key, src interface{}) (*Key, error) {
+	k, err := r.memoryRepository.Put(c, key, src)
+	return k, r.saved(c, err)
+}
+
+func (r *fileRepository) PutMulti(c appengine.Context, keys []*Key, src interface{}) ([]*Key, error) {
+	k, err := r.memoryRepository.PutMulti(c, keys, src)
+	return k, r.saved(c, err)
+}
+
+func (r *fileRepository) Delete(c appengine.Context, key *Key) error {
+	return r.saved(c, r.memoryRepository.Delete(c, key))
+}
+
+func (r *fileRepository) DeleteMulti(c appengine.Context, keys []*Key) error {
+	return r.saved(c, r.memoryRepository.DeleteMulti(c, keys))
+}
+
+func (r *fileRepository) RunInTransaction(c appengine.Context, f func(tc appengine.Context) error, opts *TransactionOptions) error {
+	if err := r.memoryRepository.RunInTransaction(c, f, opts); err != nil {
+		return err
+	}
+	return r.save()
+}
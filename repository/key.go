@@ -0,0 +1,72 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package repository
+
+import (
+	"fmt"
+)
+
+// Key represents the key of a stored entity.
+//
+type Key struct {
+	kind     string
+	stringID string
+	intID    int64
+}
+
+// NewKey creates a new key for an entity of the given kind.
+// An entity is identified either by a string ID or by an integer ID.
+//
+func NewKey(kind, stringID string, intID int64) *Key {
+	return &Key{kind: kind, stringID: stringID, intID: intID}
+}
+
+// Kind returns the key's kind.
+//
+func (k *Key) Kind() string {
+	return k.kind
+}
+
+// StringID returns the key's string ID.
+//
+func (k *Key) StringID() string {
+	return k.stringID
+}
+
+// IntID returns the key's integer ID.
+//
+func (k *Key) IntID() int64 {
+	return k.intID
+}
+
+// Equal returns whether two keys are equal.
+//
+func (k *Key) Equal(o *Key) bool {
+	if k == nil || o == nil {
+		return k == o
+	}
+	return *k == *o
+}
+
+// String returns a string representation of the key.
+//
+func (k *Key) String() string {
+	if k.stringID != "" {
+		return fmt.Sprintf("/%s,%s", k.kind, k.stringID)
+	}
+	return fmt.Sprintf("/%s,%d", k.kind, k.intID)
+}
@@ -0,0 +1,651 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package repository
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/gob"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"appengine"
+)
+
+func init() {
+	// property values are saved as interface values by the file repository.
+	gob.Register(time.Time{})
+	gob.Register([]interface{}{})
+}
+
+// memoryRepository is a repository that keeps entities in memory.
+// Entities are stored gob encoded so that callers never share memory with
+// the store, the same way they never share memory with the datastore.
+type memoryRepository struct {
+	mu       sync.Mutex
+	txMu     sync.Mutex
+	entities map[string]map[Key]memoryEntity // entities by kind and key.
+	ids      map[string]int64                // last allocated ID by kind.
+	tx       bool                            // whether a transaction is running.
+}
+
+// memoryEntity is a stored entity.
+type memoryEntity struct {
+	Data       []byte                 // gob encoded entity.
+	Properties map[string]interface{} // values of the properties queries can filter and sort on.
+}
+
+// NewMemory returns an empty in-memory repository.
+//
+// Transactions are serialized and rolled back on error but they are not
+// isolated from writes made outside of a transaction.
+//
+func NewMemory() Repository {
+	return &memoryRepository{
+		entities: make(map[string]map[Key]memoryEntity),
+		ids:      make(map[string]int64),
+	}
+}
+
+// memoryEntry is a stored entity with its key.
+type memoryEntry struct {
+	key Key
+	memoryEntity
+}
+
+// encode gob encodes the struct pointed to by src and extracts its properties.
+func encode(src reflect.Value) (memoryEntity, error) {
+	if src.Kind() == reflect.Ptr {
+		if src.IsNil() {
+			return memoryEntity{}, ErrInvalidEntityType
+		}
+		src = src.Elem()
+	}
+	if src.Kind() != reflect.Struct {
+		return memoryEntity{}, ErrInvalidEntityType
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(src.Interface()); err != nil {
+		return memoryEntity{}, err
+	}
+	return memoryEntity{Data: buf.Bytes(), Properties: properties(src)}, nil
+}
+
+// properties returns the values of the properties of the struct v.
+// Only the values of basic types and the lists of them are returned,
+// the properties of nested structs are named after their field.
+func properties(v reflect.Value) map[string]interface{} {
+	props := make(map[string]interface{})
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).PkgPath != "" {
+			continue
+		}
+		f := v.Field(i)
+		if f.Kind() == reflect.Slice && f.Type().Elem().Kind() != reflect.Uint8 {
+			var values []interface{}
+			for j := 0; j < f.Len(); j++ {
+				if x, ok := propertyValue(f.Index(j)); ok {
+					values = append(values, x)
+				}
+			}
+			props[t.Field(i).Name] = values
+		} else if x, ok := propertyValue(f); ok {
+			props[t.Field(i).Name] = x
+		} else if f.Kind() == reflect.Struct {
+			// nested structs are flattened as datastore does, e.g. "Actor.Id".
+			for name, x := range properties(f) {
+				props[t.Field(i).Name+"."+name] = x
+			}
+		}
+	}
+	return props
+}
+
+// propertyValue converts a value to the type it is compared as.
+func propertyValue(v reflect.Value) (interface{}, bool) {
+	if !v.IsValid() {
+		return nil, false
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	case reflect.String:
+		return v.String(), true
+	case reflect.Bool:
+		return v.Bool(), true
+	}
+	if t, ok := v.Interface().(time.Time); ok {
+		return t, true
+	}
+	return nil, false
+}
+
+// decode resets the struct pointed to by dst and loads data into it.
+func decode(data []byte, dst reflect.Value) error {
+	if dst.Kind() != reflect.Ptr || dst.IsNil() || dst.Elem().Kind() != reflect.Struct {
+		return ErrInvalidEntityType
+	}
+	dst.Elem().Set(reflect.Zero(dst.Elem().Type()))
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(dst.Interface())
+}
+
+// elemPointer returns a pointer to the struct held in v, which is either a
+// struct or a struct pointer, allocating it when needed.
+func elemPointer(v reflect.Value) (reflect.Value, error) {
+	switch {
+	case v.Kind() == reflect.Struct && v.CanAddr():
+		return v.Addr(), nil
+	case v.Kind() == reflect.Ptr && v.Type().Elem().Kind() == reflect.Struct:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return v, nil
+	}
+	return reflect.Value{}, ErrInvalidEntityType
+}
+
+func (r *memoryRepository) AllocateIDs(c appengine.Context, kind string, n int) (int64, int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	low := r.ids[kind] + 1
+	r.ids[kind] += int64(n)
+	return low, r.ids[kind] + 1, nil
+}
+
+func (r *memoryRepository) Get(c appengine.Context, key *Key, dst interface{}) error {
+	r.mu.Lock()
+	e, ok := r.entities[key.kind][*key]
+	r.mu.Unlock()
+
+	if !ok {
+		return ErrNoSuchEntity
+	}
+	return decode(e.Data, reflect.ValueOf(dst))
+}
+
+func (r *memoryRepository) GetMulti(c appengine.Context, keys []*Key, dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Slice || v.Len() != len(keys) {
+		return ErrInvalidEntityType
+	}
+	errs := make(appengine.MultiError, len(keys))
+	failed := false
+	for i, key := range keys {
+		p, err := elemPointer(v.Index(i))
+		if err == nil {
+			err = r.Get(c, key, p.Interface())
+		}
+		if err != nil {
+			errs[i] = err
+			failed = true
+		}
+	}
+	if failed {
+		return errs
+	}
+	return nil
+}
+
+func (r *memoryRepository) Put(c appengine.Context, key *Key, src interface{}) (*Key, error) {
+	e, err := encode(reflect.ValueOf(src))
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k := *key
+	if k.intID == 0 && k.stringID == "" {
+		r.ids[k.kind]++
+		k.intID = r.ids[k.kind]
+	}
+	// IDs of entities saved with an explicit ID are never allocated.
+	if k.intID > r.ids[k.kind] {
+		r.ids[k.kind] = k.intID
+	}
+	if r.entities[k.kind] == nil {
+		r.entities[k.kind] = make(map[Key]memoryEntity)
+	}
+	r.entities[k.kind][k] = e
+	return &k, nil
+}
+
+func (r *memoryRepository) PutMulti(c appengine.Context, keys []*Key, src interface{}) ([]*Key, error) {
+	v := reflect.ValueOf(src)
+	if v.Kind() != reflect.Slice || v.Len() != len(keys) {
+		return nil, ErrInvalidEntityType
+	}
+	result := make([]*Key, len(keys))
+	errs := make(appengine.MultiError, len(keys))
+	failed := false
+	for i, key := range keys {
+		k, err := r.Put(c, key, v.Index(i).Interface())
+		if err != nil {
+			errs[i] = err
+			failed = true
+		}
+		result[i] = k
+	}
+	if failed {
+		return result, errs
+	}
+	return result, nil
+}
+
+func (r *memoryRepository) Delete(c appengine.Context, key *Key) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.entities[key.kind], *key)
+	return nil
+}
+
+func (r *memoryRepository) DeleteMulti(c appengine.Context, keys []*Key) error {
+	for _, key := range keys {
+		if err := r.Delete(c, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// run returns the entries matching q, sorted and paginated.
+func (r *memoryRepository) run(q *Query) ([]memoryEntry, error) {
+	r.mu.Lock()
+	var matches []memoryEntry
+	for k, e := range r.entities[q.kind] {
+		if matchFilters(q.filters, k, e.Properties) {
+			matches = append(matches, memoryEntry{key: k, memoryEntity: e})
+		}
+	}
+	r.mu.Unlock()
+
+	sort.Sort(byOrders{entries: matches, orders: q.orders})
+
+	if q.start != "" {
+		start, err := decodeCursor(q.kind, q.start, q.orders)
+		if err != nil {
+			return nil, err
+		}
+		i := sort.Search(len(matches), func(i int) bool { return lessEntries(q.orders, start, matches[i]) })
+		matches = matches[i:]
+	}
+
+	if q.offset > 0 {
+		if q.offset >= len(matches) {
+			return nil, nil
+		}
+		matches = matches[q.offset:]
+	}
+	if q.limit >= 0 && q.limit < len(matches) {
+		matches = matches[:q.limit]
+	}
+	return matches, nil
+}
+
+func (r *memoryRepository) GetAll(c appengine.Context, q *Query, dst interface{}) ([]*Key, error) {
+	var slice reflect.Value
+	if !q.keysOnly {
+		v := reflect.ValueOf(dst)
+		if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Slice {
+			return nil, ErrInvalidEntityType
+		}
+		slice = v.Elem()
+	}
+
+	entries, err := r.run(q)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*Key, len(entries))
+	for i, e := range entries {
+		k := e.key
+		keys[i] = &k
+		if q.keysOnly {
+			continue
+		}
+		elem := reflect.New(slice.Type().Elem()).Elem()
+		p, err := elemPointer(elem)
+		if err != nil {
+			return nil, err
+		}
+		if err := decode(e.Data, p); err != nil {
+			return nil, err
+		}
+		slice.Set(reflect.Append(slice, elem))
+	}
+	return keys, nil
+}
+
+func (r *memoryRepository) Count(c appengine.Context, q *Query) (int, error) {
+	entries, err := r.run(q)
+	return len(entries), err
+}
+
+func (r *memoryRepository) Run(c appengine.Context, q *Query) *Iterator {
+	entries, err := r.run(q)
+	var last *memoryEntry
+	return &Iterator{
+		next: func(dst interface{}) (*Key, error) {
+			if err != nil {
+				return nil, err
+			}
+			if len(entries) == 0 {
+				return nil, Done
+			}
+			e := entries[0]
+			entries = entries[1:]
+			if !q.keysOnly {
+				if err := decode(e.Data, reflect.ValueOf(dst)); err != nil {
+					return nil, err
+				}
+			}
+			last = &e
+			k := e.key
+			return &k, nil
+		},
+		cursor: func() (Cursor, error) {
+			if err != nil {
+				return "", err
+			}
+			if last == nil {
+				return q.start, nil
+			}
+			return encodeCursor(*last, q.orders)
+		},
+	}
+}
+
+// memoryCursor is the position of an entry in the sorted results of a query:
+// the values of the entry for the query orders, and its key.
+type memoryCursor struct {
+	Key    string
+	Values []interface{}
+}
+
+// encodeCursor returns the cursor positioned after e.
+func encodeCursor(e memoryEntry, orders []order) (Cursor, error) {
+	mc := memoryCursor{Key: encodeKey(e.key)}
+	for _, o := range orders {
+		mc.Values = append(mc.Values, sortValue(e.Properties[o.field]))
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(mc); err != nil {
+		return "", err
+	}
+	return Cursor(base64.URLEncoding.EncodeToString(buf.Bytes())), nil
+}
+
+// decodeCursor returns an entry with the position of the cursor.
+func decodeCursor(kind string, cursor Cursor, orders []order) (memoryEntry, error) {
+	data, err := base64.URLEncoding.DecodeString(string(cursor))
+	if err != nil {
+		return memoryEntry{}, ErrInvalidCursor
+	}
+	var mc memoryCursor
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&mc); err != nil || len(mc.Values) != len(orders) {
+		return memoryEntry{}, ErrInvalidCursor
+	}
+	k, err := decodeKey(kind, mc.Key)
+	if err != nil {
+		return memoryEntry{}, ErrInvalidCursor
+	}
+	e := memoryEntry{key: *k, memoryEntity: memoryEntity{Properties: make(map[string]interface{})}}
+	for i, o := range orders {
+		e.Properties[o.field] = mc.Values[i]
+	}
+	return e, nil
+}
+
+func (r *memoryRepository) RunInTransaction(c appengine.Context, f func(tc appengine.Context) error, opts *TransactionOptions) error {
+	r.txMu.Lock()
+	defer r.txMu.Unlock()
+
+	r.mu.Lock()
+	entities := make(map[string]map[Key]memoryEntity, len(r.entities))
+	for kind, m := range r.entities {
+		entities[kind] = make(map[Key]memoryEntity, len(m))
+		for k, e := range m {
+			entities[kind][k] = e
+		}
+	}
+	r.mu.Unlock()
+
+	r.setTransaction(true)
+	defer r.setTransaction(false)
+
+	if err := f(c); err != nil {
+		r.mu.Lock()
+		r.entities = entities
+		r.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (r *memoryRepository) setTransaction(tx bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tx = tx
+}
+
+// inTransaction reports whether a transaction is running.
+func (r *memoryRepository) inTransaction() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.tx
+}
+
+// matchFilters reports whether the entity with key k and properties props matches all filters.
+func matchFilters(filters []filter, k Key, props map[string]interface{}) bool {
+	for _, f := range filters {
+		if f.field == "__key__" {
+			o, ok := f.value.(*Key)
+			if !ok || !matchOp(f.op, compareKeys(&k, o)) {
+				return false
+			}
+			continue
+		}
+		prop, ok := props[f.field]
+		if !ok {
+			return false
+		}
+		// a multi-valued property matches when one of its values matches.
+		matched := false
+		if values, ok := prop.([]interface{}); ok {
+			for i := 0; i < len(values) && !matched; i++ {
+				cmp, ok := compare(values[i], f.value)
+				matched = ok && matchOp(f.op, cmp)
+			}
+		} else {
+			cmp, ok := compare(prop, f.value)
+			matched = ok && matchOp(f.op, cmp)
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// matchOp reports whether the result of a comparison satisfies op.
+func matchOp(op string, cmp int) bool {
+	switch op {
+	case "=":
+		return cmp == 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+// compare compares two property values. It returns false when the values
+// cannot be compared.
+func compare(a, b interface{}) (int, bool) {
+	if x, ok := propertyValue(reflect.ValueOf(a)); ok {
+		a = x
+	}
+	if y, ok := propertyValue(reflect.ValueOf(b)); ok {
+		b = y
+	}
+	switch x := a.(type) {
+	case int64:
+		if y, ok := b.(int64); ok {
+			return compareInt64(x, y), true
+		}
+	case float64:
+		if y, ok := b.(float64); ok {
+			switch {
+			case x < y:
+				return -1, true
+			case x > y:
+				return 1, true
+			}
+			return 0, true
+		}
+	case string:
+		if y, ok := b.(string); ok {
+			switch {
+			case x < y:
+				return -1, true
+			case x > y:
+				return 1, true
+			}
+			return 0, true
+		}
+	case bool:
+		if y, ok := b.(bool); ok {
+			switch {
+			case x == y:
+				return 0, true
+			case !x:
+				return -1, true
+			}
+			return 1, true
+		}
+	case time.Time:
+		if y, ok := b.(time.Time); ok {
+			switch {
+			case x.Before(y):
+				return -1, true
+			case x.After(y):
+				return 1, true
+			}
+			return 0, true
+		}
+	case *Key:
+		if y, ok := b.(*Key); ok {
+			return compareKeys(x, y), true
+		}
+	}
+	return 0, false
+}
+
+func compareInt64(x, y int64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// compareKeys orders keys by kind, then integer IDs before string IDs.
+func compareKeys(a, b *Key) int {
+	if a.kind != b.kind {
+		if a.kind < b.kind {
+			return -1
+		}
+		return 1
+	}
+	if a.stringID == "" && b.stringID == "" {
+		return compareInt64(a.intID, b.intID)
+	}
+	if a.stringID == "" {
+		return -1
+	}
+	if b.stringID == "" {
+		return 1
+	}
+	if a.stringID < b.stringID {
+		return -1
+	}
+	if a.stringID > b.stringID {
+		return 1
+	}
+	return 0
+}
+
+// byOrders sorts entries by the query orders, then by key.
+type byOrders struct {
+	entries []memoryEntry
+	orders  []order
+}
+
+func (s byOrders) Len() int      { return len(s.entries) }
+func (s byOrders) Swap(i, j int) { s.entries[i], s.entries[j] = s.entries[j], s.entries[i] }
+
+func (s byOrders) Less(i, j int) bool {
+	return lessEntries(s.orders, s.entries[i], s.entries[j])
+}
+
+// lessEntries reports whether a is sorted before b by the orders, then by key.
+func lessEntries(orders []order, a, b memoryEntry) bool {
+	for _, o := range orders {
+		var cmp int
+		if o.field == "__key__" {
+			cmp = compareKeys(&a.key, &b.key)
+		} else {
+			cmp, _ = compare(sortValue(a.Properties[o.field]), sortValue(b.Properties[o.field]))
+		}
+		if o.desc {
+			cmp = -cmp
+		}
+		if cmp != 0 {
+			return cmp < 0
+		}
+	}
+	return compareKeys(&a.key, &b.key) < 0
+}
+
+// sortValue returns the value a property is sorted by. Multi-valued
+// properties are sorted by their first value.
+func sortValue(prop interface{}) interface{} {
+	if values, ok := prop.([]interface{}); ok {
+		if len(values) == 0 {
+			return nil
+		}
+		return values[0]
+	}
+	return prop
+}
@@ -0,0 +1,201 @@
+package repository
+
+import (
+	"testing"
+
+	"appengine"
+)
+
+type testEntity struct {
+	Name  string
+	Score int64
+	Tags  []string
+}
+
+// TestMemoryQuery tests that queries on the in-memory repository filter, sort and paginate entities.
+//
+func TestMemoryQuery(t *testing.T) {
+	Use(NewMemory())
+	defer Use(Datastore)
+
+	c := NewLocalContext(nil)
+	entities := []testEntity{
+		{"john", 10, []string{"admin", "player"}},
+		{"jane", 30, []string{"player"}},
+		{"paul", 20, nil},
+	}
+	keys := make([]*Key, len(entities))
+	for i := range entities {
+		keys[i] = NewKey("TestEntity", "", int64(i+1))
+	}
+	if _, err := PutMulti(c, keys, entities); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		title string
+		query *Query
+		want  []string
+	}{
+		{"all entities in key order", NewQuery("TestEntity"), []string{"john", "jane", "paul"}},
+		{"equality filter", NewQuery("TestEntity").Filter("Name =", "jane"), []string{"jane"}},
+		{"inequality filter", NewQuery("TestEntity").Filter("Score >=", 20), []string{"jane", "paul"}},
+		{"multi-valued property", NewQuery("TestEntity").Filter("Tags =", "player"), []string{"john", "jane"}},
+		{"key filter", NewQuery("TestEntity").Filter("__key__ >", keys[0]), []string{"jane", "paul"}},
+		{"descending order", NewQuery("TestEntity").Order("-Score"), []string{"jane", "paul", "john"}},
+		{"limit and offset", NewQuery("TestEntity").Order("Name").Offset(1).Limit(1), []string{"john"}},
+	}
+
+	for i, test := range tests {
+		t.Log(test.title)
+		var got []testEntity
+		if _, err := test.query.GetAll(c, &got); err != nil {
+			t.Errorf("test %v - Error: %v", i, err)
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("test %v - Error: got %v entities, want %v", i, len(got), len(test.want))
+			continue
+		}
+		for j := range got {
+			if got[j].Name != test.want[j] {
+				t.Errorf("test %v - Error: got %v, want %v", i, got[j].Name, test.want[j])
+			}
+		}
+	}
+}
+
+type testNestedEntity struct {
+	Name  string
+	Owner testEntity
+}
+
+// TestMemoryNestedQuery tests that the properties of nested structs are filtered by their flattened name.
+//
+func TestMemoryNestedQuery(t *testing.T) {
+	Use(NewMemory())
+	defer Use(Datastore)
+
+	c := NewLocalContext(nil)
+	entities := []testNestedEntity{
+		{"team", testEntity{Name: "john", Score: 10}},
+		{"tournament", testEntity{Name: "jane", Score: 10}},
+	}
+	for i := range entities {
+		if _, err := Put(c, NewKey("TestNestedEntity", "", int64(i+1)), &entities[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []testNestedEntity
+	q := NewQuery("TestNestedEntity").Filter("Owner.Score =", 10).Filter("Owner.Name =", "jane")
+	if _, err := q.GetAll(c, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Name != "tournament" {
+		t.Errorf("Error: want [tournament], got %v", got)
+	}
+}
+
+// TestMemoryTransaction tests that a failed transaction is rolled back.
+//
+func TestMemoryTransaction(t *testing.T) {
+	Use(NewMemory())
+	defer Use(Datastore)
+
+	c := NewLocalContext(nil)
+	key := NewKey("TestEntity", "", 1)
+	if _, err := Put(c, key, &testEntity{Name: "john"}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := RunInTransaction(c, func(tc appengine.Context) error {
+		if _, err := Put(tc, key, &testEntity{Name: "jane"}); err != nil {
+			return err
+		}
+		return ErrConcurrentTransaction
+	}, nil)
+	if err != ErrConcurrentTransaction {
+		t.Errorf("Error: want %v, got %v", ErrConcurrentTransaction, err)
+	}
+
+	var e testEntity
+	if err := Get(c, key, &e); err != nil || e.Name != "john" {
+		t.Errorf("Error: transaction was not rolled back, got %v, %v", e.Name, err)
+	}
+}
+
+// TestMemoryCursor tests that query cursors resume after the last iterated
+// entity, even when entities are inserted before it.
+//
+func TestMemoryCursor(t *testing.T) {
+	Use(NewMemory())
+	defer Use(Datastore)
+
+	c := NewLocalContext(nil)
+	entities := []testEntity{
+		{Name: "john", Score: 10},
+		{Name: "jane", Score: 30},
+		{Name: "paul", Score: 20},
+		{Name: "ringo", Score: 20},
+	}
+	for i := range entities {
+		if _, err := Put(c, NewKey("TestEntity", "", int64(i+1)), &entities[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	q := NewQuery("TestEntity").Order("-Score").Limit(2)
+	page := func(cursor Cursor) ([]string, Cursor) {
+		var names []string
+		it := q.Start(cursor).Run(c)
+		for {
+			var e testEntity
+			if _, err := it.Next(&e); err == Done {
+				break
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			names = append(names, e.Name)
+		}
+		next, err := it.Cursor()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return names, next
+	}
+
+	first, cursor := page("")
+	// an entity inserted before the cursor does not shift the next page.
+	if _, err := Put(c, NewKey("TestEntity", "", 5), &testEntity{Name: "george", Score: 40}); err != nil {
+		t.Fatal(err)
+	}
+	second, cursor := page(cursor)
+	third, _ := page(cursor)
+
+	tests := []struct {
+		title string
+		got   []string
+		want  []string
+	}{
+		{"first page", first, []string{"jane", "paul"}},
+		{"second page", second, []string{"ringo", "john"}},
+		{"last page", third, nil},
+	}
+	for i, test := range tests {
+		t.Log(test.title)
+		if len(test.got) != len(test.want) {
+			t.Errorf("test %v - Error: got %v, want %v", i, test.got, test.want)
+			continue
+		}
+		for j := range test.got {
+			if test.got[j] != test.want[j] {
+				t.Errorf("test %v - Error: got %v, want %v", i, test.got, test.want)
+				break
+			}
+		}
+	}
+
+	if _, err := q.Start("not a cursor").GetAll(c, &[]testEntity{}); err != ErrInvalidCursor {
+		t.Errorf("Error: want %v, got %v", ErrInvalidCursor, err)
+	}
+}
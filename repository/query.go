@@ -0,0 +1,200 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package repository
+
+import (
+	"fmt"
+	"strings"
+
+	"appengine"
+)
+
+// filter is a query filter on a field, e.g. "Word >=".
+type filter struct {
+	field string
+	op    string
+	value interface{}
+}
+
+// order is a query sort order on a field.
+type order struct {
+	field string
+	desc  bool
+}
+
+// Query represents a query on the entities of a kind.
+//
+// Like datastore queries, a Query is immutable: its methods return a new
+// query and leave the receiver unchanged.
+//
+type Query struct {
+	kind     string
+	filters  []filter
+	orders   []order
+	limit    int
+	offset   int
+	start    Cursor
+	keysOnly bool
+	err      error
+}
+
+// Cursor is an opaque position in the results of a query.
+// The empty cursor is the start of the results.
+//
+type Cursor string
+
+// NewQuery creates a new query for the given kind.
+//
+func NewQuery(kind string) *Query {
+	return &Query{kind: kind, limit: -1}
+}
+
+func (q *Query) clone() *Query {
+	x := *q
+	x.filters = append([]filter(nil), q.filters...)
+	x.orders = append([]order(nil), q.orders...)
+	return &x
+}
+
+// Filter returns a derivative query with a field-based filter.
+// The filterStr argument must be a field name followed by optional space,
+// followed by an operator, one of ">", "<", ">=", "<=", or "=".
+//
+func (q *Query) Filter(filterStr string, value interface{}) *Query {
+	q = q.clone()
+	filterStr = strings.TrimSpace(filterStr)
+	if len(filterStr) < 1 {
+		q.err = fmt.Errorf("repository: invalid filter %q", filterStr)
+		return q
+	}
+	field := strings.TrimRight(filterStr, " ><=")
+	op := strings.TrimSpace(filterStr[len(field):])
+	switch op {
+	case "<=", ">=", "<", ">", "=":
+	default:
+		q.err = fmt.Errorf("repository: invalid operator %q in filter %q", op, filterStr)
+		return q
+	}
+	q.filters = append(q.filters, filter{field: field, op: op, value: value})
+	return q
+}
+
+// Order returns a derivative query with a field-based sort order.
+// A field name prefixed with "-" sorts in descending order.
+//
+func (q *Query) Order(fieldName string) *Query {
+	q = q.clone()
+	fieldName = strings.TrimSpace(fieldName)
+	o := order{field: fieldName}
+	if strings.HasPrefix(fieldName, "-") {
+		o = order{field: strings.TrimSpace(fieldName[1:]), desc: true}
+	}
+	if o.field == "" {
+		q.err = fmt.Errorf("repository: empty order")
+		return q
+	}
+	q.orders = append(q.orders, o)
+	return q
+}
+
+// Limit returns a derivative query that has a limit on the number of results returned.
+// A negative value means unlimited.
+//
+func (q *Query) Limit(limit int) *Query {
+	q = q.clone()
+	q.limit = limit
+	return q
+}
+
+// Offset returns a derivative query that has an offset of how many keys to skip over before returning results.
+//
+func (q *Query) Offset(offset int) *Query {
+	q = q.clone()
+	q.offset = offset
+	return q
+}
+
+// Start returns a derivative query with the given start point.
+// Unlike an offset, a cursor stays valid when entities are inserted before it.
+//
+func (q *Query) Start(cursor Cursor) *Query {
+	q = q.clone()
+	q.start = cursor
+	return q
+}
+
+// KeysOnly returns a derivative query that yields only keys, not keys and entities.
+//
+func (q *Query) KeysOnly() *Query {
+	q = q.clone()
+	q.keysOnly = true
+	return q
+}
+
+// GetAll runs the query and returns all the keys that match the query,
+// as well as appending the values to dst. dst must be a pointer to a
+// slice of structs or of struct pointers, it is ignored for keys-only queries.
+//
+func (q *Query) GetAll(c appengine.Context, dst interface{}) ([]*Key, error) {
+	if q.err != nil {
+		return nil, q.err
+	}
+	return current.GetAll(c, q, dst)
+}
+
+// Count returns the number of results for the query.
+//
+func (q *Query) Count(c appengine.Context) (int, error) {
+	if q.err != nil {
+		return 0, q.err
+	}
+	return current.Count(c, q)
+}
+
+// Run runs the query and returns an iterator on its results.
+//
+func (q *Query) Run(c appengine.Context) *Iterator {
+	if q.err != nil {
+		return &Iterator{
+			next:   func(dst interface{}) (*Key, error) { return nil, q.err },
+			cursor: func() (Cursor, error) { return "", q.err },
+		}
+	}
+	return current.Run(c, q)
+}
+
+// Iterator is the result of running a query.
+//
+type Iterator struct {
+	next   func(dst interface{}) (*Key, error)
+	cursor func() (Cursor, error)
+}
+
+// Next returns the key of the next result. When there are no more results,
+// Done is returned as the error. dst must be a struct pointer, it is
+// ignored for keys-only queries.
+//
+func (t *Iterator) Next(dst interface{}) (*Key, error) {
+	return t.next(dst)
+}
+
+// Cursor returns a cursor for the iterator's current location,
+// the query started with this cursor returns the results not yet iterated.
+//
+func (t *Iterator) Cursor() (Cursor, error) {
+	return t.cursor()
+}
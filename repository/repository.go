@@ -0,0 +1,133 @@
+/*
+ * Copyright (c) 2014 Santiago Arias | Remy Jourde
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+// Package repository provides the storage layer of gonawin app.
+//
+// Models never talk to a storage backend directly, they go through the
+// functions of this package which dispatch to the current Repository.
+// Two implementations are provided: Datastore, backed by App Engine
+// datastore (the default), and Memory, an in-memory store used by tests
+// and by gonawin when it runs outside App Engine.
+//
+package repository
+
+import (
+	"errors"
+
+	"appengine"
+)
+
+var (
+	// ErrNoSuchEntity is returned when no entity was found for a given key.
+	ErrNoSuchEntity = errors.New("repository: no such entity")
+	// Done is returned when a query iteration is completed.
+	Done = errors.New("repository: query has no more results")
+	// ErrInvalidEntityType is returned when a destination or source is not a struct pointer or a slice of structs.
+	ErrInvalidEntityType = errors.New("repository: invalid entity type")
+	// ErrInvalidCursor is returned when a query cursor cannot be decoded.
+	ErrInvalidCursor = errors.New("repository: invalid cursor")
+	// ErrConcurrentTransaction is returned when a transaction is rolled back due to a conflict.
+	ErrConcurrentTransaction = errors.New("repository: concurrent transaction")
+)
+
+// TransactionOptions are the options for running a transaction.
+//
+type TransactionOptions struct {
+	XG bool // whether the transaction can cross multiple entity groups.
+}
+
+// Repository is the interface implemented by gonawin storage backends.
+//
+// Entities are addressed by kind and key and are plain structs, exactly
+// as they are saved in the datastore. Multi operations return an
+// appengine.MultiError when some of the entities failed.
+//
+type Repository interface {
+	AllocateIDs(c appengine.Context, kind string, n int) (low, high int64, err error)
+	Get(c appengine.Context, key *Key, dst interface{}) error
+	GetMulti(c appengine.Context, keys []*Key, dst interface{}) error
+	Put(c appengine.Context, key *Key, src interface{}) (*Key, error)
+	PutMulti(c appengine.Context, keys []*Key, src interface{}) ([]*Key, error)
+	Delete(c appengine.Context, key *Key) error
+	DeleteMulti(c appengine.Context, keys []*Key) error
+	GetAll(c appengine.Context, q *Query, dst interface{}) ([]*Key, error)
+	Count(c appengine.Context, q *Query) (int, error)
+	Run(c appengine.Context, q *Query) *Iterator
+	RunInTransaction(c appengine.Context, f func(tc appengine.Context) error, opts *TransactionOptions) error
+}
+
+// current is the repository used by gonawin.
+var current Repository = Datastore
+
+// Use sets the repository used by gonawin.
+//
+func Use(r Repository) {
+	current = r
+}
+
+// Current returns the repository used by gonawin.
+//
+func Current() Repository {
+	return current
+}
+
+// AllocateIDs returns a range of n integer IDs for the given kind.
+//
+func AllocateIDs(c appengine.Context, kind string, n int) (low, high int64, err error) {
+	return current.AllocateIDs(c, kind, n)
+}
+
+// Get loads the entity stored for key into dst, which must be a struct pointer.
+//
+func Get(c appengine.Context, key *Key, dst interface{}) error {
+	return current.Get(c, key, dst)
+}
+
+// GetMulti is a batch version of Get. dst must be a slice of structs or of struct pointers.
+//
+func GetMulti(c appengine.Context, keys []*Key, dst interface{}) error {
+	return current.GetMulti(c, keys, dst)
+}
+
+// Put saves the entity src, which must be a struct pointer, with key.
+//
+func Put(c appengine.Context, key *Key, src interface{}) (*Key, error) {
+	return current.Put(c, key, src)
+}
+
+// PutMulti is a batch version of Put. src must be a slice of structs or of struct pointers.
+//
+func PutMulti(c appengine.Context, keys []*Key, src interface{}) ([]*Key, error) {
+	return current.PutMulti(c, keys, src)
+}
+
+// Delete deletes the entity for the given key.
+//
+func Delete(c appengine.Context, key *Key) error {
+	return current.Delete(c, key)
+}
+
+// DeleteMulti is a batch version of Delete.
+//
+func DeleteMulti(c appengine.Context, keys []*Key) error {
+	return current.DeleteMulti(c, keys)
+}
+
+// RunInTransaction runs f in a transaction.
+//
+func RunInTransaction(c appengine.Context, f func(tc appengine.Context) error, opts *TransactionOptions) error {
+	return current.RunInTransaction(c, f, opts)
+}
@@ -0,0 +1,210 @@
+package gonawintest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	gwconfig "github.com/taironas/gonawin/config"
+)
+
+// IdentityProvider is a local OpenID Connect provider to test the authentication of users.
+// Its authorization endpoint signs in the user given by the login_hint parameter without
+// asking anything, and its ID tokens are signed with a key generated at start.
+type IdentityProvider struct {
+	*httptest.Server
+	ClientId     string
+	ClientSecret string
+
+	mu    sync.Mutex
+	key   *rsa.PrivateKey
+	kid   string
+	codes map[string]map[string]interface{} // claims of the ID tokens by authorization code.
+	next  int
+}
+
+// NewIdentityProvider starts a local OpenID Connect provider for the given client.
+// It must be closed when the test ends.
+func NewIdentityProvider(clientID, clientSecret string) *IdentityProvider {
+	p := &IdentityProvider{
+		ClientId:     clientID,
+		ClientSecret: clientSecret,
+		codes:        make(map[string]map[string]interface{}),
+	}
+	p.RotateKey()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/authorize", p.authorize)
+	mux.HandleFunc("/token", p.token)
+	mux.HandleFunc("/keys", p.keys)
+	p.Server = httptest.NewServer(mux)
+	return p
+}
+
+// Config returns the gonawin configuration of the provider under the given name.
+func (p *IdentityProvider) Config(name string) gwconfig.OpenIDConnect {
+	return gwconfig.OpenIDConnect{
+		Name:         name,
+		Issuer:       p.URL,
+		ClientId:     p.ClientId,
+		ClientSecret: p.ClientSecret,
+	}
+}
+
+// RotateKey replaces the signing key of the provider by a new one with a new id.
+func (p *IdentityProvider) RotateKey() {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.next++
+	p.key = key
+	p.kid = fmt.Sprintf("key-%d", p.next)
+}
+
+// Claims returns the claims of a valid ID token of a user, for the client of the provider.
+func (p *IdentityProvider) Claims(subject, nonce string) map[string]interface{} {
+	return map[string]interface{}{
+		"iss":                p.URL,
+		"sub":                subject,
+		"aud":                p.ClientId,
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"iat":                time.Now().Unix(),
+		"nonce":              nonce,
+		"email":              subject + "@example.com",
+		"email_verified":     true,
+		"name":               subject,
+		"preferred_username": subject,
+	}
+}
+
+// IDToken returns an ID token with the given claims signed with the key of the provider.
+func (p *IdentityProvider) IDToken(claims map[string]interface{}) string {
+	p.mu.Lock()
+	key, kid := p.key, p.kid
+	p.mu.Unlock()
+	return SignToken(key, kid, claims)
+}
+
+// Code returns an authorization code the provider exchanges for an ID token with the given claims.
+func (p *IdentityProvider) Code(claims map[string]interface{}) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.next++
+	code := fmt.Sprintf("code-%d", p.next)
+	p.codes[code] = claims
+	return code
+}
+
+// SignToken returns a JSON Web Token with the given claims signed with RS256.
+func SignToken(key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": kid})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	hashed := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		panic(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func (p *IdentityProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 p.URL,
+		"authorization_endpoint": p.URL + "/authorize",
+		"token_endpoint":         p.URL + "/token",
+		"jwks_uri":               p.URL + "/keys",
+	})
+}
+
+func (p *IdentityProvider) authorize(w http.ResponseWriter, r *http.Request) {
+	if r.FormValue("client_id") != p.ClientId || r.FormValue("response_type") != "code" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	redirect, err := url.Parse(r.FormValue("redirect_uri"))
+	if err != nil || len(r.FormValue("redirect_uri")) == 0 {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	subject := r.FormValue("login_hint")
+	if len(subject) == 0 {
+		subject = "john.snow"
+	}
+	claims := p.Claims(subject, r.FormValue("nonce"))
+
+	q := redirect.Query()
+	q.Set("code", p.Code(claims))
+	q.Set("state", r.FormValue("state"))
+	redirect.RawQuery = q.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (p *IdentityProvider) token(w http.ResponseWriter, r *http.Request) {
+	id, secret, ok := r.BasicAuth()
+	id, _ = url.QueryUnescape(id)
+	secret, _ = url.QueryUnescape(secret)
+	if !ok || id != p.ClientId || secret != p.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	if r.FormValue("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+
+	p.mu.Lock()
+	claims, ok := p.codes[r.FormValue("code")]
+	delete(p.codes, r.FormValue("code"))
+	p.mu.Unlock()
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"access_token": "access-" + r.FormValue("code"),
+		"token_type":   "Bearer",
+		"id_token":     p.IDToken(claims),
+	})
+}
+
+func (p *IdentityProvider) keys(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	key, kid := p.key.PublicKey, p.kid
+	p.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": kid,
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}